@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errCheckDeadline is the cause of the checks cut at maxCheckDuration
+var errCheckDeadline = errors.New("the check exceeded the maxCheckDuration of this ipfs-check instance")
+
+// Stages of the active checks before the checker reports its own, see
+// check.Options.OnStage
+const (
+	// activeStageQueued is waiting for one of maxConcurrentChecks to end
+	activeStageQueued = "queued"
+	// activeStageRunning is running, before the first stage of the checker
+	activeStageRunning = "running"
+)
+
+// activeCheckKey is the context key of the activeCheck of a request
+type activeCheckKey struct{}
+
+// activeChecks are the check requests being served. The zero value is ready
+// to use.
+type activeChecks struct {
+	mu     sync.Mutex
+	checks map[uint64]*activeCheck
+	lastID uint64
+}
+
+type activeCheck struct {
+	id       uint64
+	endpoint string
+	target   string
+	started  time.Time
+	deadline time.Time
+	// stage is guarded by the mu of activeChecks
+	stage string
+}
+
+// activeCheckOutput is a check request being served, as listed by GET
+// /checks/active
+type activeCheckOutput struct {
+	ID uint64
+	// Endpoint is the path of the request, and Target the peer, multiaddr,
+	// CIDs or name it checks
+	Endpoint string
+	Target   string
+	// Stage is queued, running, or the stage the check is in: routing, dial,
+	// bitswap or diagnostics
+	Stage   string
+	Started time.Time
+	Elapsed time.Duration
+	// Deadline is when the check is cut at maxCheckDuration, nil without one
+	Deadline *time.Time
+}
+
+// activeChecksOutput is the response of GET /checks/active
+type activeChecksOutput struct {
+	// Checks are oldest first
+	Checks []activeCheckOutput
+}
+
+// add registers a check request, queued until it gets a check slot
+func (a *activeChecks) add(endpoint, target string, deadline time.Time) *activeCheck {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.checks == nil {
+		a.checks = make(map[uint64]*activeCheck)
+	}
+	a.lastID++
+	c := &activeCheck{id: a.lastID, endpoint: endpoint, target: target, started: time.Now(), deadline: deadline, stage: activeStageQueued}
+	a.checks[c.id] = c
+	return c
+}
+
+func (a *activeChecks) remove(c *activeCheck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.checks, c.id)
+}
+
+// setStage sets the stage of the check of the request of ctx, if it is
+// tracked
+func (a *activeChecks) setStage(ctx context.Context, stage string) {
+	if c, ok := ctx.Value(activeCheckKey{}).(*activeCheck); ok {
+		a.mu.Lock()
+		c.stage = stage
+		a.mu.Unlock()
+	}
+}
+
+// onStage returns the check.Options.OnStage of the check of the request of
+// ctx, nil if it is not tracked
+func (a *activeChecks) onStage(ctx context.Context) func(string) {
+	if ctx.Value(activeCheckKey{}) == nil {
+		return nil
+	}
+	return func(stage string) { a.setStage(ctx, stage) }
+}
+
+// list returns the active checks, oldest first
+func (a *activeChecks) list() activeChecksOutput {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	out := activeChecksOutput{Checks: make([]activeCheckOutput, 0, len(a.checks))}
+	for _, c := range a.checks {
+		o := activeCheckOutput{ID: c.id, Endpoint: c.endpoint, Target: c.target, Stage: c.stage, Started: c.started, Elapsed: now.Sub(c.started)}
+		if !c.deadline.IsZero() {
+			deadline := c.deadline
+			o.Deadline = &deadline
+		}
+		out.Checks = append(out.Checks, o)
+	}
+	slices.SortFunc(out.Checks, func(x, y activeCheckOutput) int { return cmp.Compare(x.ID, y.ID) })
+	return out
+}
+
+// checkTarget returns what the request checks, from its path and query
+func checkTarget(r *http.Request) string {
+	var parts []string
+	for _, name := range []string{"peerID", "name"} {
+		if v := r.PathValue(name); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	q := r.URL.Query()
+	if ma := q.Get("multiaddr"); ma != "" {
+		parts = append(parts, ma)
+	}
+	parts = append(parts, q["cid"]...)
+	return strings.Join(parts, " ")
+}
+
+// trackChecks lists the checks served by handler in GET /checks/active, and
+// cuts them at maxCheckDuration, including the time they wait in the queue
+func (d *daemon) trackChecks(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var deadline time.Time
+		if maxDuration := d.config().MaxCheckDuration; maxDuration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeoutCause(ctx, maxDuration, errCheckDeadline)
+			defer cancel()
+			deadline, _ = ctx.Deadline()
+		}
+		c := d.active.add(r.URL.Path, checkTarget(r), deadline)
+		defer d.active.remove(c)
+
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(ctx, activeCheckKey{}, c)))
+		if context.Cause(ctx) == errCheckDeadline {
+			log.Printf("Check %d of %s was cut at maxCheckDuration\n", c.id, c.target)
+		}
+	})
+}
+
+// activeChecksHandler serves GET /checks/active
+func (d *daemon) activeChecksHandler(w http.ResponseWriter, r *http.Request) {
+	out := d.active.list()
+	if d.validateResponses {
+		if err := validateResponse(out); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, out)
+}
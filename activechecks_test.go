@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveChecks(t *testing.T) {
+	d := &daemon{validateResponses: true, routers: newRouterFailover()}
+	cfg := defaultConfig()
+	d.cfg.Store(cfg)
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("GET /check/node/{peerID}", d.trackChecks(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, ok := d.acquireCheckSlot(w, r, cfg)
+		require.True(t, ok)
+		defer release()
+		d.checkOptions(r.Context(), cfg).OnStage(check.StageDial)
+		close(started)
+		<-done
+	})))
+	mux.HandleFunc("GET /checks/active", d.activeChecksHandler)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	go func() {
+		resp, err := http.Get(srv.URL + "/check/node/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	list := func() activeChecksOutput {
+		resp, err := http.Get(srv.URL + "/checks/active")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var out activeChecksOutput
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+		return out
+	}
+	out := list()
+	require.Len(t, out.Checks, 1)
+	c := out.Checks[0]
+	require.Equal(t, "/check/node/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK", c.Endpoint)
+	require.Equal(t, "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK", c.Target)
+	require.Equal(t, check.StageDial, c.Stage)
+	require.NotNil(t, c.Deadline)
+	require.WithinDuration(t, c.Started.Add(cfg.MaxCheckDuration), *c.Deadline, time.Second)
+
+	close(done)
+	require.Eventually(t, func() bool { return len(list().Checks) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMaxCheckDuration(t *testing.T) {
+	d := &daemon{}
+	cfg := defaultConfig()
+	cfg.MaxCheckDuration = 50 * time.Millisecond
+	d.cfg.Store(cfg)
+
+	handler := d.trackChecks(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A check with a much longer timeout
+		ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+		defer cancel()
+		<-ctx.Done()
+		writeCheckError(w, ctx.Err(), 0)
+	}))
+	w := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/check?cid=bafkqaaa", nil))
+	require.Less(t, time.Since(start), 10*time.Second)
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+	require.Empty(t, d.active.list().Checks)
+
+	cfg.MaxCheckDuration = cfg.CheckTimeout - time.Second
+	require.Error(t, cfg.validate())
+	cfg.MaxCheckDuration = 0
+	require.NoError(t, cfg.validate())
+}
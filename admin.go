@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+// cacheFlushOutput is the response of POST /admin/cache/flush
+type cacheFlushOutput struct {
+	// Flushed is the number of check results removed from the cache
+	Flushed int
+}
+
+// errUnknownAPIKey is returned when deleting an API key that does not exist
+var errUnknownAPIKey = errors.New("no such API key")
+
+// adminHandler serves the maintenance endpoints under /admin/ to the requests
+// passing d.adminToken as bearer token
+func (d *daemon) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/cache/flush", func(w http.ResponseWriter, r *http.Request) {
+		var out cacheFlushOutput
+		if d.cache != nil {
+			out.Flushed = d.cache.flush()
+		}
+		log.Printf("Admin: flushed %d check results from the cache\n", out.Flushed)
+		d.writeAdminJSON(w, out)
+	})
+	mux.HandleFunc("PUT /admin/log-level", func(w http.ResponseWriter, r *http.Request) {
+		subsystem := r.URL.Query().Get("subsystem")
+		if subsystem == "" {
+			subsystem = "*"
+		}
+		level := r.URL.Query().Get("level")
+		if err := logging.SetLogLevel(subsystem, level); err != nil {
+			writeInvalidParam(w, "level", "Invalid subsystem or level value ("+err.Error()+")")
+			return
+		}
+		log.Printf("Admin: set the log level of %s to %s\n", subsystem, level)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /admin/checks", func(w http.ResponseWriter, r *http.Request) {
+		d.writeAdminJSON(w, d.flights.list())
+	})
+	mux.HandleFunc("POST /admin/checks/{id}/abort", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid check ID", map[string]string{"parameter": "id"})
+			return
+		}
+		if !d.flights.abort(id) {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "no such check in flight", nil)
+			return
+		}
+		log.Printf("Admin: aborted check %d\n", id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /admin/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		keys := slices.Clone(d.config().APIKeys)
+		for i := range keys {
+			keys[i].Key = ""
+		}
+		if keys == nil {
+			keys = []apiKeyConfig{}
+		}
+		d.writeAdminJSON(w, keys)
+	})
+	mux.HandleFunc("PUT /admin/api-keys/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var k apiKeyConfig
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&k); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid API key: "+err.Error(), nil)
+			return
+		}
+		k.Name = r.PathValue("name")
+		err := d.updateAPIKeys(func(keys []apiKeyConfig) ([]apiKeyConfig, error) {
+			if i := slices.IndexFunc(keys, func(o apiKeyConfig) bool { return o.Name == k.Name }); i >= 0 {
+				keys[i] = k
+				return keys, nil
+			}
+			return append(keys, k), nil
+		})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error(), nil)
+			return
+		}
+		log.Printf("Admin: set API key %s\n", k.Name)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /admin/api-keys/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		err := d.updateAPIKeys(func(keys []apiKeyConfig) ([]apiKeyConfig, error) {
+			i := slices.IndexFunc(keys, func(o apiKeyConfig) bool { return o.Name == name })
+			if i < 0 {
+				return nil, errUnknownAPIKey
+			}
+			return slices.Delete(keys, i, i+1), nil
+		})
+		if errors.Is(err, errUnknownAPIKey) {
+			writeError(w, http.StatusNotFound, errCodeNotFound, err.Error(), nil)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error(), nil)
+			return
+		}
+		log.Printf("Admin: deleted API key %s\n", name)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return tokenAuth(mux, d.adminToken)
+}
+
+// updateAPIKeys replaces the API keys of the running config with the ones
+// returned by update, passed a copy of the current ones. The changes are lost
+// when the config file is reloaded.
+func (d *daemon) updateAPIKeys(update func([]apiKeyConfig) ([]apiKeyConfig, error)) error {
+	d.apiKeysMu.Lock()
+	defer d.apiKeysMu.Unlock()
+
+	cfg := *d.config()
+	keys, err := update(slices.Clone(cfg.APIKeys))
+	if err != nil {
+		return err
+	}
+	cfg.APIKeys = keys
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	d.cfg.Store(&cfg)
+	if d.rateLimiter != nil {
+		d.rateLimiter.setKeys(cfg.APIKeys)
+	}
+	return nil
+}
+
+func (d *daemon) writeAdminJSON(w http.ResponseWriter, data interface{}) {
+	if d.validateResponses {
+		if err := validateResponse(data); err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+// tokenAuth only passes the requests with token as bearer token to handler
+func tokenAuth(handler http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
+			writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "Unauthorized", nil)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminHandler(t *testing.T) {
+	d := &daemon{
+		adminToken:        "secret",
+		cache:             newCheckCache(10, time.Minute),
+		validateResponses: true,
+	}
+	srv := httptest.NewServer(d.adminHandler())
+	defer srv.Close()
+
+	do := func(method, path, token string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	require.Equal(t, http.StatusUnauthorized, do("GET", "/admin/checks", "").StatusCode)
+	require.Equal(t, http.StatusUnauthorized, do("GET", "/admin/checks", "wrong").StatusCode)
+
+	d.cache.add(checkCacheKey(url.Values{"cid": {"a"}}, check.Options{}, "", ""), "result")
+	resp := do("POST", "/admin/cache/flush", "secret")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var flushed cacheFlushOutput
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&flushed))
+	require.Equal(t, 1, flushed.Flushed)
+	_, ok := d.cache.get(checkCacheKey(url.Values{"cid": {"a"}}, check.Options{}, "", ""))
+	require.False(t, ok)
+
+	require.Equal(t, http.StatusNoContent, do("PUT", "/admin/log-level?subsystem=dht&level=error", "secret").StatusCode)
+	require.Equal(t, http.StatusBadRequest, do("PUT", "/admin/log-level?level=loud", "secret").StatusCode)
+	require.Equal(t, http.StatusBadRequest, do("PUT", "/admin/log-level?subsystem=nope&level=error", "secret").StatusCode)
+
+	// A stuck check is listed and can be aborted
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := d.flights.do(context.Background(), "cid=stuck", time.Minute, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return "partial", nil
+		})
+		done <- err
+	}()
+	<-started
+	resp = do("GET", "/admin/checks", "secret")
+	var checks []inFlightCheck
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&checks))
+	require.Len(t, checks, 1)
+	require.Equal(t, "cid=stuck", checks[0].Query)
+	require.Equal(t, 1, checks[0].Waiters)
+
+	require.Equal(t, http.StatusNotFound, do("POST", "/admin/checks/12345/abort", "secret").StatusCode)
+	require.Equal(t, http.StatusNoContent, do("POST", "/admin/checks/"+strconv.FormatUint(checks[0].ID, 10)+"/abort", "secret").StatusCode)
+	require.ErrorIs(t, <-done, errCheckAborted)
+	require.Empty(t, d.flights.list())
+}
+
+func TestAdminAPIKeys(t *testing.T) {
+	d := &daemon{adminToken: "secret", validateResponses: true}
+	cfg := defaultConfig()
+	cfg.APIKeys = []apiKeyConfig{{Name: "team-a", Key: "a"}}
+	d.cfg.Store(cfg)
+	d.rateLimiter = newClientRateLimiter(0, 0, cfg.APIKeys)
+	srv := httptest.NewServer(d.adminHandler())
+	defer srv.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	require.Equal(t, http.StatusNoContent, do("PUT", "/admin/api-keys/team-b", `{"Key":"b","MaxRequestThroughputMiB":256,"Webhooks":["https://example.com/hook"]}`).StatusCode)
+	require.Equal(t, http.StatusBadRequest, do("PUT", "/admin/api-keys/team-c", `{"Key":"b"}`).StatusCode, "keys are unique")
+	require.Equal(t, http.StatusBadRequest, do("PUT", "/admin/api-keys/team-c", `{"Key":"c","Webhooks":["ftp://example.com"]}`).StatusCode)
+	require.Equal(t, 256, d.config().apiKeyNamed("team-b").MaxRequestThroughputMiB)
+	name, allowed, ok := d.rateLimiter.allowKey("b")
+	require.True(t, ok && allowed, "the rate limiter knows the new key")
+	require.Equal(t, "team-b", name)
+
+	resp := do("GET", "/admin/api-keys", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var keys []apiKeyConfig
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&keys))
+	require.Len(t, keys, 2)
+	require.Equal(t, "team-b", keys[1].Name)
+	require.Empty(t, keys[1].Key, "the keys are not listed")
+
+	require.Equal(t, http.StatusNoContent, do("DELETE", "/admin/api-keys/team-a", "").StatusCode)
+	require.Equal(t, http.StatusNotFound, do("DELETE", "/admin/api-keys/team-a", "").StatusCode)
+	_, _, ok = d.rateLimiter.allowKey("a")
+	require.False(t, ok)
+}
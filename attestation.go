@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// loadAttestationKey reads the private key signing the attestations from
+// path, nil when path is empty
+func loadAttestationKey(path string) (crypto.PrivKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.UnmarshalPrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("decoding attestation key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// attestationQuery returns the query string identifying the check attested,
+// like checkCacheKey without the parameters that do not change what is
+// checked, and without the owner token, which is secret
+func attestationQuery(q url.Values) string {
+	key := make(url.Values, len(q))
+	for k, v := range q {
+		if k != "attest" && k != "format" && k != "nocache" && k != ownerTokenParam {
+			key[k] = v
+		}
+	}
+	return key.Encode()
+}
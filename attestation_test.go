@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttestationQuery(t *testing.T) {
+	q := url.Values{"cid": {"bafkqaaa"}, "multiaddr": {"/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"}}
+	want := attestationQuery(q)
+	q.Set("attest", "true")
+	q.Set("format", "dag-json")
+	q.Set(ownerTokenParam, "secret")
+	require.Equal(t, want, attestationQuery(q))
+	require.NotContains(t, attestationQuery(q), "secret")
+}
+
+func TestLoadAttestationKey(t *testing.T) {
+	key, err := loadAttestationKey("")
+	require.NoError(t, err)
+	require.Nil(t, key)
+
+	sk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	b, err := crypto.MarshalPrivateKey(sk)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "attestation.key")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+	key, err = loadAttestationKey(path)
+	require.NoError(t, err)
+	require.True(t, sk.Equals(key))
+
+	require.NoError(t, os.WriteFile(path, []byte("not a key"), 0o600))
+	_, err = loadAttestationKey(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// maxBodySize bounds the JSON bodies of the POST requests of checks
+const maxBodySize = 1 << 20
+
+// bodyQuery makes a check endpoint accept POST requests passing its query
+// parameters in a JSON object, e.g. lists of multiaddrs and CIDs too long for
+// a URL. The parameters of the body replace the ones of the same name in the
+// URL, so that the check is the same as the one of the GET request with all
+// the parameters in its URL.
+func bodyQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			if mt, _, err := mime.ParseMediaType(ct); err != nil || mt != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, errCodeInvalidBody, "the body of checks must be a JSON object of their query parameters", nil)
+				return
+			}
+		}
+		params, err := decodeBodyQuery(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, errCodeInvalidBody, fmt.Sprintf("the body is larger than %d bytes", maxBodySize), nil)
+				return
+			}
+			writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+			return
+		}
+		q := r.URL.Query()
+		for k, vs := range params {
+			q[k] = vs
+		}
+		r = r.Clone(r.Context())
+		r.URL.RawQuery = q.Encode()
+		r.Body = http.NoBody
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeBodyQuery decodes a JSON object of query parameters. Their values are
+// strings, numbers, booleans, or arrays of them for the parameters that can
+// be repeated, e.g. providers.
+func decodeBodyQuery(body io.Reader) (url.Values, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return url.Values{}, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, fmt.Errorf("invalid JSON body, expected an object of query parameters: %w", err)
+	}
+	params := make(url.Values, len(obj))
+	for k, raw := range obj {
+		var list []json.RawMessage
+		if err := json.Unmarshal(raw, &list); err != nil {
+			list = []json.RawMessage{raw}
+		}
+		for _, v := range list {
+			s, ok, err := bodyQueryValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of %q: %w", k, err)
+			}
+			if ok {
+				params[k] = append(params[k], s)
+			}
+		}
+	}
+	return params, nil
+}
+
+// bodyQueryValue returns the query parameter value of a JSON scalar, and
+// false for null
+func bodyQueryValue(raw json.RawMessage) (string, bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", false, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	case json.Number:
+		return v.String(), true, nil
+	case bool:
+		return fmt.Sprint(v), true, nil
+	}
+	return "", false, fmt.Errorf("expected a string, number or boolean")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBodyQuery(t *testing.T) {
+	params, err := decodeBodyQuery(strings.NewReader(`{"cid":"bafkqaaa","providers":["/p2p/a","/p2p/b"],"timeoutSeconds":30,"fetchBlock":true,"ipniIndexer":null}`))
+	require.NoError(t, err)
+	require.Equal(t, url.Values{
+		"cid":            {"bafkqaaa"},
+		"providers":      {"/p2p/a", "/p2p/b"},
+		"timeoutSeconds": {"30"},
+		"fetchBlock":     {"true"},
+	}, params)
+
+	params, err = decodeBodyQuery(strings.NewReader("  "))
+	require.NoError(t, err)
+	require.Empty(t, params)
+
+	_, err = decodeBodyQuery(strings.NewReader(`["bafkqaaa"]`))
+	require.Error(t, err, "the body is an object")
+	_, err = decodeBodyQuery(strings.NewReader(`{"cid":{"/":"bafkqaaa"}}`))
+	require.ErrorContains(t, err, `"cid"`)
+}
+
+func TestBodyQuery(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(bodyQuery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+	})))
+	defer srv.Close()
+
+	post := func(contentType, body string) int {
+		resp, err := http.Post(srv.URL+"/check?cid=bafkqaaa&timeoutSeconds=10", contentType, strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusOK, post("application/json", `{"multiaddr":"/p2p/a","timeoutSeconds":60}`))
+	require.Equal(t, url.Values{"cid": {"bafkqaaa"}, "multiaddr": {"/p2p/a"}, "timeoutSeconds": {"60"}}, query, "the body replaces the parameters of the URL")
+
+	require.Equal(t, http.StatusOK, post("", ""))
+	require.Equal(t, "bafkqaaa", query.Get("cid"))
+
+	require.Equal(t, http.StatusUnsupportedMediaType, post("application/x-www-form-urlencoded", "cid=bafkqaaa"))
+	require.Equal(t, http.StatusBadRequest, post("application/json", `{"cid":`))
+	require.Equal(t, http.StatusRequestEntityTooLarge, post("application/json", `{"cid":"`+strings.Repeat("a", maxBodySize)+`"}`))
+
+	// GET requests are passed as is
+	resp, err := http.Get(srv.URL + "/check?cid=bafkqaaa")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, url.Values{"cid": {"bafkqaaa"}}, query)
+}
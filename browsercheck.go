@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// browserCheckHandler serves GET /check/browser, which only dials the
+// addresses of the peer of the multiaddr parameter that browsers can dial
+func (d *daemon) browserCheckHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-IPFS-Check-Routing", d.checker.Routing())
+	cfg := d.config()
+	maStr := r.URL.Query().Get("multiaddr")
+	if maStr == "" {
+		writeMissingParam(w, "multiaddr")
+		return
+	}
+	ma, err := parseMultiaddr(maStr)
+	if err != nil {
+		writeInvalidParam(w, "multiaddr", err.Error())
+		return
+	}
+	checkTimeout := cfg.CheckTimeout
+	if timeoutStr := r.URL.Query().Get("timeoutSeconds"); timeoutStr != "" {
+		checkTimeout, err = time.ParseDuration(timeoutStr + "s")
+		if err != nil {
+			writeInvalidParam(w, "timeoutSeconds", "Invalid timeout value (in seconds)")
+			return
+		}
+	}
+
+	release, ok := d.acquireCheckSlot(w, r, cfg)
+	if !ok {
+		return
+	}
+	defer release()
+
+	log.Printf("Checking the browser reachability of %s with timeout %s\n", ma, checkTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	out, err := d.checker.CheckBrowserReachability(ctx, ma, d.checkOptions(ctx, cfg))
+	if err != nil {
+		writeCheckError(w, err, 0)
+		return
+	}
+
+	if d.validateResponses {
+		if err := validateResponse(out); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, out)
+}
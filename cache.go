@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// checkCache keeps the recent results of checks, so popular CIDs checked
+// repeatedly do not each trigger DHT walks and dials
+type checkCache struct {
+	mu  sync.Mutex
+	lru *expirable.LRU[string, cachedCheck]
+}
+
+type cachedCheck struct {
+	data     interface{}
+	cachedAt time.Time
+}
+
+func newCheckCache(size int, ttl time.Duration) *checkCache {
+	c := &checkCache{}
+	c.setConfig(size, ttl)
+	return c
+}
+
+// setConfig replaces the cache with an empty one of the given size and TTL.
+// A TTL of 0 disables caching.
+func (c *checkCache) setConfig(size int, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru = nil
+	if ttl > 0 && size > 0 {
+		c.lru = expirable.NewLRU[string, cachedCheck](size, nil, ttl)
+	}
+}
+
+// flush removes all the results from the cache, returning how many there were
+func (c *checkCache) flush() int {
+	c.mu.Lock()
+	lru := c.lru
+	c.mu.Unlock()
+	if lru == nil {
+		return 0
+	}
+	n := lru.Len()
+	lru.Purge()
+	return n
+}
+
+// checkCacheKey identifies the result of a check by its query parameters,
+// without the ones that do not change the result, and by the options it runs
+// with, which also depend on the config, e.g. the limits of API keys and the
+// IPNI indexer in use. Checks made with different API keys or owner tokens are
+// kept apart, so that a client is never served a result computed under the
+// limits of another. The verdict is computed from the cached result.
+func checkCacheKey(q url.Values, opts check.Options, apiKey string, owner peer.ID) string {
+	key := make(url.Values, len(q))
+	for k, v := range q {
+		if k != "nocache" && k != "verdict" && k != ownerTokenParam {
+			key[k] = v
+		}
+	}
+	opts.OnStage = nil
+	return fmt.Sprintf("%s\n%s\n%s\n%+v", key.Encode(), apiKey, owner, opts)
+}
+
+// get returns the cached result of the check, with its CachedAt set
+func (c *checkCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	lru := c.lru
+	c.mu.Unlock()
+	if lru == nil {
+		return nil, false
+	}
+	e, ok := lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return withCachedAt(e.data, e.cachedAt), true
+}
+
+func (c *checkCache) add(key string, data interface{}) {
+	c.mu.Lock()
+	lru := c.lru
+	c.mu.Unlock()
+	if lru != nil {
+		lru.Add(key, cachedCheck{data: data, cachedAt: time.Now()})
+	}
+}
+
+// withCachedAt returns a copy of the output of a check with CachedAt set, the
+// cached output being shared by the requests it is served to
+func withCachedAt(data interface{}, t time.Time) interface{} {
+	switch out := data.(type) {
+	case cidCheckOutput:
+		if out == nil {
+			return out
+		}
+		providers := make([]check.ProviderOutput, len(*out))
+		for i, p := range *out {
+			p.CachedAt = &t
+			providers[i] = p
+		}
+		return cidCheckOutput(&providers)
+	case *check.PeerCheckOutput:
+		cp := *out
+		cp.CachedAt = &t
+		return &cp
+	case *check.GatewayRetrievalOutput:
+		cp := *out
+		cp.CachedAt = &t
+		return &cp
+	case *check.PeerCIDsCheckOutput:
+		cp := *out
+		cp.CachedAt = &t
+		return &cp
+	}
+	return data
+}
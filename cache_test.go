@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCache(t *testing.T) {
+	c := newCheckCache(10, time.Minute)
+
+	q := url.Values{"cid": {"bafkqaaa"}, "multiaddr": {"/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"}}
+	opts := check.DefaultOptions()
+	key := checkCacheKey(q, opts, "", "")
+	q.Set("nocache", "true")
+	require.Equal(t, key, checkCacheKey(q, opts, "", ""), "nocache does not change the result")
+	q.Set("verdict", "true")
+	require.Equal(t, key, checkCacheKey(q, opts, "", ""), "the verdict is computed from the cached result")
+	opts.OnStage = func(string) {}
+	require.Equal(t, key, checkCacheKey(q, opts, "", ""), "reporting the stages does not change the result")
+	q.Set("fetchBlock", "true")
+	require.NotEqual(t, key, checkCacheKey(q, opts, "", ""))
+	q.Del("fetchBlock")
+
+	// Options set outside of the query, e.g. from the limits of an API key,
+	// change the result
+	opts.DAGMaxBlocks = 100
+	require.NotEqual(t, key, checkCacheKey(q, opts, "", ""))
+	opts = check.DefaultOptions()
+	opts.IPNIIndexer = "https://fallback.example.com"
+	require.NotEqual(t, key, checkCacheKey(q, opts, "", ""))
+
+	// Each API key and owner gets the results of its own checks
+	cfg := defaultConfig()
+	cfg.APIKeys = []apiKeyConfig{
+		{Name: "a", Key: "1", MaxRequestDialTimeout: time.Hour, DAGMaxBlocks: 100},
+		{Name: "b", Key: "2"},
+	}
+	require.NoError(t, cfg.validate())
+	keyA := checkCacheKey(q, cfg.forAPIKey("a").checkOptions(), "a", "")
+	keyB := checkCacheKey(q, cfg.forAPIKey("b").checkOptions(), "b", "")
+	require.NotEqual(t, keyA, keyB)
+	require.NotEqual(t, keyB, checkCacheKey(q, cfg.checkOptions(), "", ""), "anonymous checks are kept apart")
+	owner, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+	require.NotEqual(t, keyB, checkCacheKey(q, cfg.forAPIKey("b").checkOptions(), "b", owner))
+	c.add(keyA, &check.PeerCheckOutput{ConnectionError: "a"})
+	_, ok := c.get(keyB)
+	require.False(t, ok, "the result of a check made with a key is not served to another")
+
+	_, ok = c.get(key)
+	require.False(t, ok)
+
+	out := &check.PeerCheckOutput{ConnectionError: "failed"}
+	c.add(key, out)
+	data, ok := c.get(key)
+	require.True(t, ok)
+	cached := data.(*check.PeerCheckOutput)
+	require.Equal(t, "failed", cached.ConnectionError)
+	require.NotNil(t, cached.CachedAt)
+	require.Nil(t, out.CachedAt, "the cached result is not modified")
+
+	providers := []check.ProviderOutput{{ID: "a"}, {ID: "b"}}
+	c.add("cid", cidCheckOutput(&providers))
+	data, ok = c.get("cid")
+	require.True(t, ok)
+	for _, p := range *data.(cidCheckOutput) {
+		require.NotNil(t, p.CachedAt)
+	}
+	require.Nil(t, providers[0].CachedAt)
+
+	// A TTL of 0 disables caching
+	c.setConfig(10, 0)
+	c.add(key, out)
+	_, ok = c.get(key)
+	require.False(t, ok)
+}
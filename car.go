@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// carSource returns a peer that served the block in the result of a check,
+// along with the addresses it was connected on and the CID it served, which
+// is the one the path resolved to when the check had a path
+func carSource(data interface{}, maStr string, c cid.Cid) (peer.AddrInfo, cid.Cid, bool) {
+	var ai peer.AddrInfo
+	var connMaddrs []string
+	var res *check.PathResolutionOutput
+	switch out := data.(type) {
+	case cidCheckOutput:
+		if out == nil {
+			return ai, c, false
+		}
+		for _, p := range *out {
+			if !p.Available() {
+				continue
+			}
+			id, err := peer.Decode(p.ID)
+			if err != nil {
+				continue
+			}
+			ai.ID = id
+			connMaddrs = p.ConnectionMaddrs
+			res = p.PathResolution
+			break
+		}
+	case *check.PeerCheckOutput:
+		if !out.Available() {
+			return ai, c, false
+		}
+		ma, err := parseMultiaddr(maStr)
+		if err != nil {
+			return ai, c, false
+		}
+		p, err := peer.AddrInfoFromP2pAddr(ma)
+		if err != nil {
+			return ai, c, false
+		}
+		ai = *p
+		connMaddrs = out.ConnectionMaddrs
+		res = out.PathResolution
+	}
+	if ai.ID == "" {
+		return ai, c, false
+	}
+	if res != nil {
+		resolved, err := cid.Decode(res.ResolvedCID)
+		if err != nil {
+			return ai, c, false
+		}
+		c = resolved
+	}
+
+	for _, s := range connMaddrs {
+		if a, err := multiaddr.NewMultiaddr(s); err == nil {
+			ai.Addrs = append(ai.Addrs, a)
+		}
+	}
+	return ai, c, true
+}
+
+// carResponseWriter sets the CAR headers on the first write, so errors that
+// happen before any data is exported can still be sent as HTTP errors
+type carResponseWriter struct {
+	http.ResponseWriter
+	filename string
+	peer     peer.ID
+	written  bool
+}
+
+func (w *carResponseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.written = true
+		w.Header().Set("Content-Type", "application/vnd.ipld.car; version=1")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.filename))
+		w.Header().Set("X-IPFS-Check-Peer", w.peer.String())
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// serveCAR streams the DAG of cidKey, or of the CID its path resolved to, as a
+// CAR file downloaded from a peer that the check found serving it. If no peer did, the result of the check is
+// sent with a 404 status instead.
+func (d *daemon) serveCAR(ctx context.Context, w http.ResponseWriter, data interface{}, maStr string, cidKey cid.Cid, depth int, opts check.Options) {
+	ai, cidKey, ok := carSource(data, maStr, cidKey)
+	if !ok {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(data)
+		return
+	}
+
+	cw := &carResponseWriter{ResponseWriter: w, filename: cidKey.String() + ".car", peer: ai.ID}
+	if err := d.checker.ExportCAR(ctx, cw, ai, cidKey, depth, opts); err != nil {
+		if !cw.written {
+			writeError(w, http.StatusBadGateway, errCodeUpstream, fmt.Sprintf("exporting the data from %s: %s", ai.ID, err), nil)
+			return
+		}
+		// The status was already sent, the CAR file is cut short
+		log.Printf("Error exporting CAR of %s from %s: %v\n", cidKey, ai.ID, err)
+	}
+}
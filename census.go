@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// censusHandler serves GET /check/census/{cid}, the census of the provider
+// records of a CID held by the DHT servers closest to it
+func (d *daemon) censusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-IPFS-Check-Routing", d.checker.Routing())
+	cfg := d.config()
+	c, _, err := parseCid(r.PathValue("cid"))
+	if err != nil {
+		writeInvalidParam(w, "cid", err.Error())
+		return
+	}
+	checkTimeout := cfg.CheckTimeout
+	if timeoutStr := r.URL.Query().Get("timeoutSeconds"); timeoutStr != "" {
+		checkTimeout, err = time.ParseDuration(timeoutStr + "s")
+		if err != nil {
+			writeInvalidParam(w, "timeoutSeconds", "Invalid timeout value (in seconds)")
+			return
+		}
+	}
+	release, ok := d.acquireCheckSlot(w, r, cfg)
+	if !ok {
+		return
+	}
+	defer release()
+
+	log.Printf("Taking the census of the provider records of %s with timeout %s\n", c, checkTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	out, err := d.checker.RecordCensus(ctx, c)
+	if err != nil {
+		writeCheckError(w, err, 0)
+		return
+	}
+
+	if d.validateResponses {
+		if err := validateResponse(out); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, out)
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/urfave/cli/v2"
+)
+
+// newApp returns the command line of ipfs-check. Without a command, it
+// serves the API like the serve command.
+func newApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = name
+	app.Usage = "Server tool for checking the accessibility of your data by IPFS peers"
+	app.Version = version
+	app.Flags = serveFlags()
+	app.Action = serveCommand
+	app.Commands = []*cli.Command{
+		{
+			Name: "serve",
+			// start was the command of the Docker image
+			Aliases: []string{"start"},
+			Usage:   "serve the HTTP API and the web UI (the default command)",
+			Flags:   serveFlags(),
+			Action:  serveCommand,
+		},
+		{
+			Name:      "check",
+			Usage:     "check a CID, or a CID on the peer of --multiaddr, print the result and exit with status 1 if it is not retrievable",
+			ArgsUsage: "<cid>",
+			Flags: append(checkerFlags(false),
+				multiaddrFlag("the peer to check the CID on, the providers of the CID are checked when empty"),
+				&cli.StringFlag{
+					Name:    "format",
+					Value:   formatJSON,
+					EnvVars: []string{"IPFS_CHECK_FORMAT"},
+					Usage:   "format of the result: " + strings.Join(formatNames(), ", "),
+				},
+			),
+			Action: checkCommand,
+		},
+		{
+			Name:      "monitor",
+			Usage:     "re-check CIDs periodically without serving the API, and notify the webhooks when their availability changes",
+			ArgsUsage: "<cid>...",
+			Flags: append(checkerFlags(true),
+				append([]cli.Flag{multiaddrFlag("the peer to check the CIDs on, the providers of the CIDs are checked when empty")}, monitorFlags()...)...,
+			),
+			Action: monitorCommand,
+		},
+	}
+	return app
+}
+
+// checkerFlags are the flags of the commands running checks, which set up
+// the checker. acceleratedDHT is the default of --accelerated-dht, which
+// takes minutes to be ready.
+func checkerFlags(acceleratedDHT bool) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Value:   "",
+			EnvVars: []string{"IPFS_CHECK_CONFIG"},
+			Usage:   "path to a YAML config file with timeouts, limits and routing settings (reloaded on SIGHUP)",
+		},
+		&cli.StringSliceFlag{
+			Name:    "bootstrap-peer",
+			EnvVars: []string{"IPFS_CHECK_BOOTSTRAP_PEERS"},
+			Usage:   "multiaddr of a DHT bootstrap peer, overrides bootstrapPeers from the config file (can be passed multiple times)",
+		},
+		&cli.StringSliceFlag{
+			Name:    "fallback-bootstrap-peer",
+			EnvVars: []string{"IPFS_CHECK_FALLBACK_BOOTSTRAP_PEERS"},
+			Usage:   "multiaddr of a DHT bootstrap peer used while none of the bootstrap peers can be connected to, overrides fallbackBootstrapPeers from the config file (can be passed multiple times)",
+		},
+		&cli.StringFlag{
+			Name:    "dht-protocol-prefix",
+			EnvVars: []string{"IPFS_CHECK_DHT_PROTOCOL_PREFIX"},
+			Usage:   "DHT protocol prefix, overrides dhtProtocolPrefix from the config file (default: /ipfs)",
+		},
+		&cli.StringFlag{
+			Name:    "swarm-key",
+			EnvVars: []string{"IPFS_CHECK_SWARM_KEY"},
+			Usage:   "path to a swarm.key file to join a private network, overrides swarmKeyFile from the config file",
+		},
+		&cli.StringFlag{
+			Name:    "dns-resolver",
+			EnvVars: []string{"IPFS_CHECK_DNS_RESOLVER"},
+			Usage:   "DNS-over-HTTPS URL (e.g. https://cloudflare-dns.com/dns-query) or host[:port] of a DNS server to resolve DNS multiaddrs with, overrides dnsResolver from the config file",
+		},
+		&cli.BoolFlag{
+			Name:    "ipv4-only",
+			EnvVars: []string{"IPFS_CHECK_IPV4_ONLY"},
+			Usage:   "only listen on and dial IPv4 addresses, overrides addrFamily from the config file",
+		},
+		&cli.BoolFlag{
+			Name:    "ipv6-only",
+			EnvVars: []string{"IPFS_CHECK_IPV6_ONLY"},
+			Usage:   "only listen on and dial IPv6 addresses, e.g. in IPv6-only data centers, overrides addrFamily from the config file",
+		},
+		&cli.BoolFlag{
+			Name:    "local-network",
+			EnvVars: []string{"IPFS_CHECK_LOCAL_NETWORK"},
+			Usage:   "dial private addresses and serve /local/peers to discover the peers of the local network with mDNS, for instances run on a LAN (never on public instances), overrides localNetwork from the config file",
+		},
+		&cli.StringFlag{
+			Name:    "geoip-country-db",
+			EnvVars: []string{"IPFS_CHECK_GEOIP_COUNTRY_DB"},
+			Usage:   "path to a MaxMind country database (e.g. GeoLite2-Country.mmdb) to annotate the addresses of the checked peers with their country, overrides geoIPCountryDB from the config file",
+		},
+		&cli.StringFlag{
+			Name:    "geoip-asn-db",
+			EnvVars: []string{"IPFS_CHECK_GEOIP_ASN_DB"},
+			Usage:   "path to a MaxMind ASN database (e.g. GeoLite2-ASN.mmdb) to annotate the addresses of the checked peers with their autonomous system, overrides geoIPASNDB from the config file",
+		},
+		&cli.StringFlag{
+			Name:    "kubo-rpc",
+			EnvVars: []string{"IPFS_CHECK_KUBO_RPC"},
+			Usage:   "Kubo RPC API endpoint (e.g. http://127.0.0.1:5001) to compare its view with the checker's, overrides kuboRPC from the config file",
+		},
+		&cli.StringFlag{
+			Name:    "cluster-api",
+			EnvVars: []string{"IPFS_CHECK_CLUSTER_API"},
+			Usage:   "IPFS Cluster REST API endpoint (e.g. http://127.0.0.1:9094) to compare the status of its pins with what the peers serve, overrides clusterAPI from the config file",
+		},
+		&cli.BoolFlag{
+			Name:    "accelerated-dht",
+			Value:   acceleratedDHT,
+			EnvVars: []string{"IPFS_CHECK_ACCELERATED_DHT"},
+			Usage:   "run the accelerated DHT client",
+		},
+		&cli.BoolFlag{
+			Name:    "ephemeral",
+			EnvVars: []string{"IPFS_CHECK_EPHEMERAL"},
+			Usage:   "run without state on disk, with the standard DHT client, short timeouts and low resource limits, e.g. on spot instances (the config file still overrides these defaults)",
+		},
+		&cli.StringFlag{
+			Name:    "datastore-path",
+			EnvVars: []string{"IPFS_CHECK_DATASTORE_PATH"},
+			Usage:   "directory where the peerstore and the routing table are saved across restarts, making the accelerated DHT client ready in seconds instead of minutes",
+		},
+	}
+}
+
+// serveFlags are the flags of the serve command
+func serveFlags() []cli.Flag {
+	return append(checkerFlags(true), append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "address",
+			Value:   ":3333",
+			Usage:   "address to run on",
+			EnvVars: []string{"IPFS_CHECK_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:    "tls-cert",
+			EnvVars: []string{"IPFS_CHECK_TLS_CERT"},
+			Usage:   "path to the PEM certificate chain to serve the API over HTTPS and HTTP/2 with, reloaded when it changes",
+		},
+		&cli.StringFlag{
+			Name:    "tls-key",
+			EnvVars: []string{"IPFS_CHECK_TLS_KEY"},
+			Usage:   "path to the PEM private key of --tls-cert",
+		},
+		&cli.StringSliceFlag{
+			Name:    "acme-domain",
+			EnvVars: []string{"IPFS_CHECK_ACME_DOMAINS"},
+			Usage:   "domain to get a Let's Encrypt certificate for, to serve the API over HTTPS and HTTP/2 on --address, which must be reachable on port 443 (can be passed multiple times)",
+		},
+		&cli.StringFlag{
+			Name:    "acme-cache-dir",
+			EnvVars: []string{"IPFS_CHECK_ACME_CACHE_DIR"},
+			Usage:   "directory where the Let's Encrypt account and certificates are kept across restarts, which would otherwise request new certificates on each start",
+		},
+		&cli.StringFlag{
+			Name:    "acme-email",
+			EnvVars: []string{"IPFS_CHECK_ACME_EMAIL"},
+			Usage:   "contact email of the Let's Encrypt account, notified of problems with the certificates",
+		},
+		&cli.BoolFlag{
+			Name:    "http3",
+			EnvVars: []string{"IPFS_CHECK_HTTP3"},
+			Usage:   "also serve the API over HTTP/3 on the UDP port of --address, advertised to HTTPS clients with the Alt-Svc header (requires --tls-cert or --acme-domain)",
+		},
+		&cli.StringFlag{
+			Name:    "metrics-auth-username",
+			Value:   "",
+			EnvVars: []string{"IPFS_CHECK_METRICS_AUTH_USER"},
+			Usage:   "http basic auth user for the metrics endpoints",
+		},
+		&cli.StringFlag{
+			Name:    "metrics-auth-password",
+			Value:   "",
+			EnvVars: []string{"IPFS_CHECK_METRICS_AUTH_PASS"},
+			Usage:   "http basic auth password for the metrics endpoints",
+		},
+		&cli.DurationFlag{
+			Name:    "drain-timeout",
+			Value:   defaultCheckTimeout,
+			EnvVars: []string{"IPFS_CHECK_DRAIN_TIMEOUT"},
+			Usage:   "on shutdown, how long to wait for in-flight checks to finish before aborting them",
+		},
+		&cli.StringFlag{
+			Name:    "admin-token",
+			EnvVars: []string{"IPFS_CHECK_ADMIN_TOKEN"},
+			Usage:   "bearer token of the /admin maintenance endpoints, which are disabled when empty",
+		},
+		&cli.BoolFlag{
+			Name:    "validate-responses",
+			EnvVars: []string{"IPFS_CHECK_VALIDATE_RESPONSES"},
+			Usage:   "development mode: check every response against its JSON Schema served at /schemas/, answering with an error when it does not match",
+		},
+		&cli.BoolFlag{
+			Name:    "provide-test",
+			EnvVars: []string{"IPFS_CHECK_PROVIDE_TEST"},
+			Usage:   "enable the POST /dht/provide-test endpoint, which provides a throwaway CID to the DHT and checks that its provider record can be retrieved",
+		},
+		&cli.BoolFlag{
+			Name:    "monitor",
+			Value:   false,
+			EnvVars: []string{"IPFS_CHECK_MONITOR"},
+			Usage:   "enable the /monitor endpoint for registering CIDs to be re-checked periodically",
+		},
+		&cli.IntFlag{
+			Name:    "monitor-max-targets",
+			Value:   100,
+			EnvVars: []string{"IPFS_CHECK_MONITOR_MAX_TARGETS"},
+			Usage:   "maximum number of monitored targets (0 for unlimited)",
+		},
+		&cli.StringFlag{
+			Name:    "history-file",
+			EnvVars: []string{"IPFS_CHECK_HISTORY_FILE"},
+			Usage:   "path to a file where the results of the checks of each peer are kept, enables the /stats/peer/{peerID} endpoint",
+		},
+		&cli.DurationFlag{
+			Name:    "history-retention",
+			Value:   30 * 24 * time.Hour,
+			EnvVars: []string{"IPFS_CHECK_HISTORY_RETENTION"},
+			Usage:   "how long the results of checks are kept in the history file",
+		},
+		&cli.StringFlag{
+			Name:    "diagnostics-address",
+			EnvVars: []string{"IPFS_CHECK_DIAGNOSTICS_ADDRESS"},
+			Usage:   "private address to serve pprof, goroutine dumps and the open connections and streams on, e.g. 127.0.0.1:6060 (disabled when empty)",
+		},
+		&cli.StringFlag{
+			Name:    "web-dir",
+			EnvVars: []string{"IPFS_CHECK_WEB_DIR"},
+			Usage:   "directory the web UI is served from instead of the copy embedded in the binary",
+		},
+	}, monitorFlags()...)...)
+}
+
+// monitorFlags are the flags of the monitoring of the serve and monitor
+// commands
+func monitorFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:    "monitor-interval",
+			Value:   10 * time.Minute,
+			EnvVars: []string{"IPFS_CHECK_MONITOR_INTERVAL"},
+			Usage:   "default interval at which monitored CIDs are re-checked",
+		},
+		&cli.StringSliceFlag{
+			Name:    "monitor-webhook",
+			EnvVars: []string{"IPFS_CHECK_MONITOR_WEBHOOKS"},
+			Usage:   "URL to POST a JSON payload to when the availability of a monitored target changes (can be passed multiple times)",
+		},
+	}
+}
+
+// multiaddrFlag is the --multiaddr flag of the commands checking a peer
+func multiaddrFlag(usage string) cli.Flag {
+	return &cli.StringFlag{
+		Name:    "multiaddr",
+		EnvVars: []string{"IPFS_CHECK_MULTIADDR"},
+		Usage:   usage,
+	}
+}
+
+// signalContext returns the context of a command, canceled on SIGINT and
+// SIGTERM
+func signalContext(cctx *cli.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(cctx.Context, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// Restore the default behavior so a second signal terminates immediately
+		stop()
+	}()
+	return ctx, stop
+}
+
+// setupDaemon creates the daemon of a command with the config file and the
+// flags of checkerFlags, reloading the config file on SIGHUP until ctx is done
+func setupDaemon(ctx context.Context, cctx *cli.Context) (*daemon, error) {
+	ephemeral := cctx.Bool("ephemeral")
+	acceleratedDHT := cctx.Bool("accelerated-dht")
+	defaults := defaultConfig()
+	if ephemeral {
+		for _, flag := range []string{"datastore-path", "history-file"} {
+			if cctx.String(flag) != "" {
+				return nil, fmt.Errorf("--%s can not be used with --ephemeral, which keeps no state on disk", flag)
+			}
+		}
+		if cctx.IsSet("accelerated-dht") && acceleratedDHT {
+			return nil, fmt.Errorf("--accelerated-dht can not be used with --ephemeral, which uses the standard DHT client")
+		}
+		acceleratedDHT = false
+		defaults = ephemeralConfig()
+		log.Printf("Running in ephemeral mode: no state on disk, standard DHT client, short timeouts and low resource limits\n")
+	}
+
+	configPath := cctx.String("config")
+	cfg, err := loadConfigOnto(configPath, defaults)
+	if err != nil {
+		return nil, err
+	}
+	if cctx.IsSet("bootstrap-peer") {
+		cfg.BootstrapPeers = cctx.StringSlice("bootstrap-peer")
+	}
+	if cctx.IsSet("fallback-bootstrap-peer") {
+		cfg.FallbackBootstrapPeers = cctx.StringSlice("fallback-bootstrap-peer")
+	}
+	if cctx.IsSet("dht-protocol-prefix") {
+		cfg.DHTProtocolPrefix = protocol.ID(cctx.String("dht-protocol-prefix"))
+	}
+	if cctx.IsSet("swarm-key") {
+		cfg.SwarmKeyFile = cctx.String("swarm-key")
+	}
+	if cctx.IsSet("dns-resolver") {
+		cfg.DNSResolver = cctx.String("dns-resolver")
+	}
+	switch {
+	case cctx.Bool("ipv4-only") && cctx.Bool("ipv6-only"):
+		return nil, fmt.Errorf("--ipv4-only and --ipv6-only can not be used together")
+	case cctx.Bool("ipv4-only"):
+		cfg.AddrFamily = check.AddrFamilyIPv4
+	case cctx.Bool("ipv6-only"):
+		cfg.AddrFamily = check.AddrFamilyIPv6
+	}
+	if cctx.IsSet("local-network") {
+		cfg.LocalNetwork = cctx.Bool("local-network")
+	}
+	if cctx.IsSet("geoip-country-db") {
+		cfg.GeoIPCountryDB = cctx.String("geoip-country-db")
+	}
+	if cctx.IsSet("geoip-asn-db") {
+		cfg.GeoIPASNDB = cctx.String("geoip-asn-db")
+	}
+	if cctx.IsSet("kubo-rpc") {
+		cfg.KuboRPC = cctx.String("kubo-rpc")
+	}
+	if cctx.IsSet("cluster-api") {
+		cfg.ClusterAPI = cctx.String("cluster-api")
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	d, err := newDaemon(ctx, acceleratedDHT, cctx.String("datastore-path"), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if configPath != "" {
+		go reloadConfigOnSIGHUP(ctx, d, configPath)
+	}
+	return d, nil
+}
+
+// serveCommand serves the HTTP API until the process is interrupted
+func serveCommand(cctx *cli.Context) error {
+	tlsOpts := tlsOptions{
+		certFile:     cctx.String("tls-cert"),
+		keyFile:      cctx.String("tls-key"),
+		acmeDomains:  cctx.StringSlice("acme-domain"),
+		acmeCacheDir: cctx.String("acme-cache-dir"),
+		acmeEmail:    cctx.String("acme-email"),
+		http3:        cctx.Bool("http3"),
+	}
+	if err := tlsOpts.validate(); err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext(cctx)
+	defer stop()
+
+	d, err := setupDaemon(ctx, cctx)
+	if err != nil {
+		return err
+	}
+	d.validateResponses = cctx.Bool("validate-responses")
+	d.adminToken = cctx.String("admin-token")
+	d.webDir = cctx.String("web-dir")
+
+	if historyPath := cctx.String("history-file"); historyPath != "" {
+		d.history, err = openCheckHistory(historyPath, cctx.Duration("history-retention"))
+		if err != nil {
+			_ = d.close()
+			return err
+		}
+	}
+
+	if addr := cctx.String("diagnostics-address"); addr != "" {
+		if err := d.startDiagnostics(ctx, addr); err != nil {
+			_ = d.close()
+			return err
+		}
+	}
+
+	if cctx.Bool("provide-test") {
+		d.provideTest = newProvideTester(d)
+	}
+
+	if cctx.Bool("monitor") {
+		d.monitor = newMonitor(d, cctx.Duration("monitor-interval"), cctx.Int("monitor-max-targets"), cctx.StringSlice("monitor-webhook"))
+	}
+
+	err = startServer(ctx, d, cctx.String("address"), tlsOpts, cctx.String("metrics-auth-username"), cctx.String("metrics-auth-password"), cctx.Duration("drain-timeout"))
+	closeDaemon(d)
+	return err
+}
+
+// checkCommand runs the check of the CID passed as argument
+func checkCommand(cctx *cli.Context) error {
+	if cctx.NArg() != 1 {
+		return fmt.Errorf("expected the CID to check, got %d arguments", cctx.NArg())
+	}
+	cidKey, _, err := parseCid(cctx.Args().First())
+	if err != nil {
+		return err
+	}
+	var ma multiaddr.Multiaddr
+	if maStr := cctx.String("multiaddr"); maStr != "" {
+		if ma, err = parseMultiaddr(maStr); err != nil {
+			return err
+		}
+	}
+	format := cctx.String("format")
+	if !slices.Contains(formatNames(), format) {
+		return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(formatNames(), ", "))
+	}
+
+	ctx, stop := signalContext(cctx)
+	defer stop()
+	d, err := setupDaemon(ctx, cctx)
+	if err != nil {
+		return err
+	}
+	defer closeDaemon(d)
+	d.startServices(ctx)
+
+	cfg := d.config()
+	ctx, cancel := context.WithTimeout(ctx, cfg.CheckTimeout)
+	defer cancel()
+	opts := d.checkOptions(ctx, cfg)
+	var (
+		data      interface{}
+		available bool
+	)
+	if ma == nil {
+		out, err := d.runCidCheck(ctx, cidKey, opts)
+		if err != nil {
+			return err
+		}
+		data, available = out, cidCheckAvailable(out)
+	} else {
+		out, err := d.runPeerCheck(ctx, ma, cidKey, opts)
+		if err != nil {
+			return err
+		}
+		data, available = out, out.Available()
+	}
+
+	b, err := encodeResponse(data, format)
+	if err != nil {
+		return err
+	}
+	if _, err := cctx.App.Writer.Write(b); err != nil {
+		return err
+	}
+	if !available {
+		return cli.Exit("The CID is not retrievable", 1)
+	}
+	return nil
+}
+
+// monitorCommand re-checks the CIDs passed as arguments until the process is
+// interrupted, logging the results
+func monitorCommand(cctx *cli.Context) error {
+	if cctx.NArg() == 0 {
+		return fmt.Errorf("expected the CIDs to monitor")
+	}
+	var cids []cid.Cid
+	for _, s := range cctx.Args().Slice() {
+		c, _, err := parseCid(s)
+		if err != nil {
+			return err
+		}
+		cids = append(cids, c)
+	}
+	maStr := cctx.String("multiaddr")
+	if maStr != "" {
+		if _, err := parseMultiaddr(maStr); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signalContext(cctx)
+	defer stop()
+	d, err := setupDaemon(ctx, cctx)
+	if err != nil {
+		return err
+	}
+	defer closeDaemon(d)
+	d.startServices(ctx)
+
+	m := newMonitor(d, cctx.Duration("monitor-interval"), 0, cctx.StringSlice("monitor-webhook"))
+	for _, c := range cids {
+		if err := m.add(c, maStr, d.config().IPNIIndexer, "", "", 0); err != nil {
+			return err
+		}
+	}
+	if d.waitReady(ctx) {
+		m.start(ctx)
+		log.Printf("Monitoring %d CIDs every %s\n", len(cids), m.defaultInterval)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// closeDaemon shuts the daemon of a command down
+func closeDaemon(d *daemon) {
+	if err := d.close(); err != nil {
+		log.Printf("Error shutting down daemon: %v\n", err)
+	}
+	log.Printf("Shutdown complete")
+}
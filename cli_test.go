@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestCLIFlags(t *testing.T) {
+	app := newApp()
+	serve := app.Command("serve")
+	require.NotNil(t, serve)
+	require.Equal(t, serve, app.Command("start"), "the former command of the Docker image still serves")
+	require.Equal(t, flagNames(app.Flags), flagNames(serve.Flags), "running without command serves")
+
+	for _, c := range app.Commands {
+		for _, f := range c.Flags {
+			envVars := f.(cli.DocGenerationFlag).GetEnvVars()
+			require.Len(t, envVars, 1, "--%s of %s", f.Names()[0], c.Name)
+			require.True(t, strings.HasPrefix(envVars[0], "IPFS_CHECK_"), envVars[0])
+		}
+	}
+}
+
+func TestCLIArgs(t *testing.T) {
+	app := newApp()
+	app.ErrWriter = io.Discard
+	require.ErrorContains(t, app.Run([]string{name, "check"}), "expected the CID to check")
+	require.ErrorContains(t, app.Run([]string{name, "check", "--format", "xml", "bafkqaaa"}), "unknown format")
+	require.ErrorContains(t, app.Run([]string{name, "check", "--multiaddr", "/ip4/1.2.3.4", "bafkqaaa"}), "multiaddr")
+	require.ErrorContains(t, app.Run([]string{name, "monitor"}), "expected the CIDs to monitor")
+}
+
+func flagNames(flags []cli.Flag) []string {
+	var names []string
+	for _, f := range flags {
+		names = append(names, f.Names()[0])
+	}
+	return names
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := loadConfig("")
+	require.NoError(t, err)
+	require.Equal(t, defaultConfig(), cfg)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err = os.WriteFile(path, []byte(`
+checkTimeout: 30s
+maxProviders: 3
+rateLimit: 0.5
+`), 0o644)
+	require.NoError(t, err)
+
+	cfg, err = loadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, cfg.CheckTimeout)
+	require.Equal(t, 3, cfg.MaxProviders)
+	require.Equal(t, 0.5, cfg.RateLimit)
+	// unset fields keep their defaults
+	require.Equal(t, defaultIndexerURL, cfg.IPNIIndexer)
+
+	err = os.WriteFile(path, []byte("checkTimout: 30s\n"), 0o644)
+	require.NoError(t, err)
+	_, err = loadConfig(path)
+	require.Error(t, err, "unknown fields are rejected")
+
+	err = os.WriteFile(path, []byte("maxProviders: 0\n"), 0o644)
+	require.NoError(t, err)
+	_, err = loadConfig(path)
+	require.Error(t, err)
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.RateLimit = 1
+	require.NoError(t, cfg.validate())
+
+	cfg.RateLimitBurst = 0
+	require.Error(t, cfg.validate(), "a rate limit needs a burst")
+	cfg.RateLimit = 0
+	require.NoError(t, cfg.validate(), "no burst is needed without a rate limit")
+	cfg.RateLimit = -1
+	require.Error(t, cfg.validate())
+}
+
+func TestPinningServicesConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PinningServices = []string{"https://api.pinata.cloud"}
+	require.NoError(t, cfg.validate())
+	require.True(t, allowedOrigin(cfg.PinningServices, "https://API.pinata.cloud/psa"))
+	require.False(t, allowedOrigin(cfg.PinningServices, "http://api.pinata.cloud/psa"), "another scheme is another origin")
+	require.False(t, allowedOrigin(cfg.PinningServices, "https://api.pinata.cloud.example.com/psa"))
+	require.False(t, allowedOrigin(cfg.PinningServices, "https://api.pinata.cloud:8443/psa"))
+
+	cfg.PinningServices = []string{"api.pinata.cloud"}
+	require.Error(t, cfg.validate(), "origins must be http(s) URLs")
+	cfg.PinningServices = nil
+	cfg.MonitorWebhookOrigins = []string{"hooks.slack.com"}
+	require.Error(t, cfg.validate(), "origins must be http(s) URLs")
+}
+
+func TestResourceLimitsConfig(t *testing.T) {
+	cfg := defaultConfig()
+	require.Equal(t, check.ResourceLimits{}, cfg.resourceLimits(), "unlimited by default")
+
+	cfg.ResourceLimits = resourceLimitsConfig{Auto: true}
+	require.Error(t, cfg.validate(), "auto requires maxConcurrentChecks")
+	cfg.MaxConcurrentChecks = 10
+	require.NoError(t, cfg.validate())
+	require.Equal(t, check.AutoResourceLimits(10), cfg.resourceLimits())
+
+	cfg.ResourceLimits.Conns = 50
+	limits := cfg.resourceLimits()
+	require.Equal(t, 50, limits.Conns, "set limits override the scaled ones")
+	require.Equal(t, check.AutoResourceLimits(10).Streams, limits.Streams)
+
+	cfg.ResourceLimits = resourceLimitsConfig{Memory: -1}
+	require.Error(t, cfg.validate())
+}
+
+func TestDenylistConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Denylist = denylistConfig{Networks: []string{"192.0.2.0/24"}, Peers: []string{"12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"}}
+	require.NoError(t, cfg.validate())
+
+	cfg.Denylist.Networks = []string{"192.0.2.1"}
+	require.Error(t, cfg.validate(), "networks are CIDR prefixes")
+
+	cfg.Denylist = denylistConfig{ASNs: []uint{64500}}
+	require.Error(t, cfg.validate(), "denying autonomous systems requires an ASN database")
+	cfg.GeoIPASNDB = "GeoLite2-ASN.mmdb"
+	require.NoError(t, cfg.validate())
+}
+
+func TestAPIKeysConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.APIKeys = []apiKeyConfig{{Name: "a", Key: "1", RateLimit: 1, RateLimitBurst: 1}, {Name: "b", Key: "2"}}
+	require.NoError(t, cfg.validate())
+
+	cfg.APIKeys[1].Key = "1"
+	require.Error(t, cfg.validate(), "keys are unique")
+	cfg.APIKeys[1] = apiKeyConfig{Name: "b", Key: "2", RateLimit: 1}
+	require.Error(t, cfg.validate(), "a limited key needs a burst")
+	cfg.APIKeys[1] = apiKeyConfig{Key: "2"}
+	require.Error(t, cfg.validate(), "keys are named")
+	cfg.APIKeys[1] = apiKeyConfig{Name: "b", Key: "2", MaxRequestDialTimeout: time.Second}
+	require.Error(t, cfg.validate(), "the limits of a key allow the default timeouts")
+
+	// The limits of a key replace the ones of the config
+	cfg.APIKeys[1] = apiKeyConfig{Name: "b", Key: "2", MaxRequestDialTimeout: time.Hour, MaxRequestThroughputMiB: 512}
+	require.NoError(t, cfg.validate())
+	kc := cfg.forAPIKey("b")
+	require.Equal(t, time.Hour, kc.MaxRequestDialTimeout)
+	require.Equal(t, 512, kc.MaxRequestThroughputMiB)
+	require.Equal(t, cfg.MaxRequestBitswapTimeout, kc.MaxRequestBitswapTimeout)
+	require.NotEqual(t, time.Hour, cfg.MaxRequestDialTimeout)
+	require.Same(t, cfg, cfg.forAPIKey(""))
+	require.Equal(t, "b", cfg.apiKeyWithKey("2").Name)
+	require.Nil(t, cfg.apiKeyWithKey(""))
+}
+
+func TestPublicDenylistsConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PublicDenylists = []publicDenylistConfig{{Name: "badbits", Source: "https://badbits.dwebops.pub/badbits.deny"}, {Name: "local", Source: "local.deny", RefreshInterval: time.Minute}}
+	require.NoError(t, cfg.validate())
+
+	cfg.PublicDenylists[1].Name = "badbits"
+	require.Error(t, cfg.validate(), "names are unique")
+	cfg.PublicDenylists[1] = publicDenylistConfig{Name: "local"}
+	require.Error(t, cfg.validate(), "denylists need a source")
+	cfg.PublicDenylists[1] = publicDenylistConfig{Name: "local", Source: "local.deny", RefreshInterval: -time.Minute}
+	require.Error(t, cfg.validate())
+}
+
+func TestRetriesConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Retries = 2
+	require.NoError(t, cfg.validate())
+	require.Equal(t, 2, cfg.checkOptions().Retries)
+	require.Equal(t, time.Second, cfg.checkOptions().RetryBackoff)
+
+	cfg.Retries = check.MaxRetries + 1
+	require.Error(t, cfg.validate())
+	cfg.Retries = 1
+	cfg.RetryBackoff = 0
+	require.Error(t, cfg.validate())
+}
+
+func TestAddrFamilyConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.AddrFamily = check.AddrFamilyIPv6
+	require.NoError(t, cfg.validate())
+	cfg.AddrFamily = "ipv6"
+	require.Error(t, cfg.validate())
+}
+
+func TestAddrPolicyConfig(t *testing.T) {
+	cfg := defaultConfig()
+	p, err := cfg.addrPolicy()
+	require.NoError(t, err)
+	require.False(t, p.AllowPrivate, "private addresses are denied by default")
+
+	cfg.LocalNetwork = true
+	p, err = cfg.addrPolicy()
+	require.NoError(t, err)
+	require.True(t, p.AllowPrivate, "the local network mode allows private addresses")
+
+	cfg.AddrPolicy = addrPolicyConfig{DenyPrivate: true, DenyRelay: true, AllowedNetworks: []string{"10.8.0.0/16"}}
+	require.NoError(t, cfg.validate())
+	cfg.AddrPolicy.AllowedNetworks = []string{"10.8.0.1"}
+	require.Error(t, cfg.validate(), "networks are CIDR prefixes")
+}
+
+func TestStageBudgetsConfig(t *testing.T) {
+	cfg := defaultConfig()
+	// The default peer checks keep the timeouts of the options, uncut by
+	// the budgets of the stages
+	opts := cfg.checkOptions()
+	require.Zero(t, opts.StageBudgets)
+	def := check.DefaultOptions()
+	require.Equal(t, def.PeerDialTimeout, opts.PeerDialTimeout)
+	require.Equal(t, def.AddrDialTimeout, opts.AddrDialTimeout)
+	require.Equal(t, def.BitswapTimeout, opts.BitswapTimeout)
+	cfg.StageBudgets.Dial = 30 * time.Second
+	require.Equal(t, cfg.StageBudgets.Dial, cfg.checkOptions().StageBudgets.Dial)
+	cfg.StageBudgets.Bitswap = -time.Second
+	require.Error(t, cfg.validate())
+	cfg.StageBudgets = stageBudgetsConfig{}
+	require.NoError(t, cfg.validate(), "stages can be unbounded")
+}
+
+func TestOwnershipConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Ownership.Enabled = true
+	require.NoError(t, cfg.validate())
+	cfg.Ownership.MaxRequestDialTimeout = cfg.MaxRequestDialTimeout - time.Second
+	require.Error(t, cfg.validate(), "owners do not get shorter timeouts than everyone else")
+	cfg.Ownership.Enabled = false
+	require.NoError(t, cfg.validate())
+}
+
+func TestSelfTestConfig(t *testing.T) {
+	cfg := defaultConfig()
+	require.True(t, cfg.SelfTest.Enabled)
+	cfg.SelfTest.Interval = time.Second
+	require.Error(t, cfg.validate(), "self-tests write to the DHT, so they are not run every second")
+	cfg.SelfTest.Enabled = false
+	require.NoError(t, cfg.validate())
+}
+
+func TestFallbackConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.FallbackIPNIIndexers = []string{"https://indexer.example.com"}
+	cfg.FallbackBootstrapPeers = []string{"/ip4/1.2.3.4/tcp/4001/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"}
+	require.NoError(t, cfg.validate())
+
+	cfg.FallbackIPNIIndexers = []string{"indexer.example.com"}
+	require.Error(t, cfg.validate())
+	cfg.FallbackIPNIIndexers = nil
+	cfg.FallbackBootstrapPeers = []string{"/ip4/1.2.3.4/tcp/4001"}
+	require.Error(t, cfg.validate(), "bootstrap peers must have a peer ID")
+}
+
+func TestEphemeralConfig(t *testing.T) {
+	cfg := ephemeralConfig()
+	require.NoError(t, cfg.validate())
+	require.Less(t, cfg.CheckTimeout, defaultConfig().CheckTimeout)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("maxProviders: 3\n"), 0o644))
+	cfg, err := loadConfigOnto(path, ephemeralConfig())
+	require.NoError(t, err)
+	require.Equal(t, 3, cfg.MaxProviders, "the config file overrides the ephemeral defaults")
+	require.Equal(t, ephemeralConfig().CheckTimeout, cfg.CheckTimeout)
+
+	// Reloading the config file keeps the ephemeral defaults
+	require.NoError(t, os.WriteFile(path, []byte("maxProviders: 4\n"), 0o644))
+	d := &daemon{}
+	d.cfg.Store(cfg)
+	require.NoError(t, d.reloadConfig(path))
+	require.Equal(t, 4, d.config().MaxProviders)
+	require.Equal(t, ephemeralConfig().CheckTimeout, d.config().CheckTimeout)
+	require.True(t, d.config().ephemeral)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsConfig sets which web origins can call the API from a browser
+type corsConfig struct {
+	// AllowedOrigins are the origins allowed to call the API, e.g.
+	// https://check.ipfs.network, "*" allowing any origin
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	// AllowedMethods and AllowedHeaders are the methods and request headers
+	// allowed in cross-origin requests
+	AllowedMethods []string `yaml:"allowedMethods"`
+	AllowedHeaders []string `yaml:"allowedHeaders"`
+	// MaxAge is how long browsers can cache the response to a preflight
+	// request
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+func defaultCORSConfig() corsConfig {
+	return corsConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		AllowedHeaders: []string{"Authorization", "Content-Type", apiKeyHeader},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// allowedOrigin returns the value of the Access-Control-Allow-Origin header
+// of a request from origin, empty if the origin is not allowed
+func (c corsConfig) allowedOrigin(origin string) string {
+	if slices.Contains(c.AllowedOrigins, "*") {
+		return "*"
+	}
+	if origin != "" && slices.Contains(c.AllowedOrigins, origin) {
+		return origin
+	}
+	return ""
+}
+
+// corsMiddleware sets the CORS headers of the responses of next following
+// the current config, and answers preflight requests
+func (d *daemon) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := d.config().CORS
+		origin := r.Header.Get("Origin")
+		allowed := cfg.allowedOrigin(origin)
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			w.Header().Set("Access-Control-Expose-Headers", "X-IPFS-Check-Routing")
+		}
+		if allowed != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Preflight request
+		if allowed == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+		if cfg.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS(t *testing.T) {
+	d := &daemon{}
+	cfg := defaultConfig()
+	d.cfg.Store(cfg)
+	var served bool
+	h := d.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		served = false
+		req := httptest.NewRequest(method, "/check?cid=a", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Any origin is allowed by default
+	rec := request(http.MethodGet, "")
+	require.True(t, served)
+	require.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = request(http.MethodOptions, "https://example.com")
+	require.False(t, served, "preflight requests are answered by the middleware")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "GET, POST, PUT, DELETE", rec.Header().Get("Access-Control-Allow-Methods"))
+	require.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), apiKeyHeader)
+	require.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	// The API can be locked to a frontend
+	cfg = defaultConfig()
+	cfg.CORS.AllowedOrigins = []string{"https://check.example.com"}
+	d.cfg.Store(cfg)
+	rec = request(http.MethodGet, "https://check.example.com")
+	require.Equal(t, "https://check.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "Origin", rec.Header().Get("Vary"))
+
+	rec = request(http.MethodGet, "https://evil.example.com")
+	require.True(t, served, "the browser, not the server, enforces CORS on simple requests")
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = request(http.MethodOptions, "https://evil.example.com")
+	require.False(t, served)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestCORSConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+cors:
+  allowedOrigins: [https://check.example.com]
+`), 0o644))
+	cfg, err := loadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://check.example.com"}, cfg.CORS.AllowedOrigins)
+	require.Equal(t, defaultCORSConfig().AllowedMethods, cfg.CORS.AllowedMethods, "unset fields keep their defaults")
+
+	require.NoError(t, os.WriteFile(path, []byte("cors:\n  allowedOrigins: []\n"), 0o644))
+	_, err = loadConfig(path)
+	require.Error(t, err)
+}
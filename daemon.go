@@ -1,553 +1,463 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	vole "github.com/ipfs-shipyard/vole/lib"
-	"github.com/ipfs/boxo/ipns"
-	"github.com/ipfs/boxo/routing/http/client"
-	"github.com/ipfs/boxo/routing/http/contentrouter"
 	"github.com/ipfs/go-cid"
-	"github.com/libp2p/go-libp2p"
+	"github.com/ipfs/ipfs-check/pkg/check"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
-	"github.com/libp2p/go-libp2p-kad-dht/fullrt"
-	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
-	mplex "github.com/libp2p/go-libp2p-mplex"
-	record "github.com/libp2p/go-libp2p-record"
-	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
-	"github.com/libp2p/go-libp2p/core/routing"
-	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
 	"github.com/multiformats/go-multiaddr"
-	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-type kademlia interface {
-	routing.Routing
-	GetClosestPeers(ctx context.Context, key string) ([]peer.ID, error)
-}
-
 type daemon struct {
-	h              host.Host
-	dht            kademlia
-	dhtMessenger   *dhtpb.ProtocolMessenger
-	createTestHost func() (host.Host, error)
-	promRegistry   *prometheus.Registry
+	checker      *check.Checker
+	promRegistry *prometheus.Registry
+	monitor      *monitor
+	// history of the checks of each peer, nil if disabled
+	history *checkHistory
+
+	cfg atomic.Pointer[config]
+	// apiKeysMu serializes the changes of the API keys with the admin API
+	apiKeysMu   sync.Mutex
+	rateLimiter *clientRateLimiter
+	// cache of recent check results, nil if disabled
+	cache *checkCache
+	// queue bounds the checks running and waiting to run
+	queue checkQueue
+	// flights coalesces the identical checks running at the same time
+	flights checkFlights
+	// active are the check requests being served
+	active activeChecks
+	// validateResponses checks responses against their JSON Schema before sending them
+	validateResponses bool
+	// provideTest serves the provide tests, nil if disabled
+	provideTest *provideTester
+	// selfTest keeps the last self-test, see runSelfTests
+	selfTest selfTester
+	// geoIP locates the addresses of the checked peers, nil if disabled
+	geoIP *check.GeoIP
+	// adminToken is the bearer token of the /admin endpoints, which are
+	// disabled when empty
+	adminToken string
+	// webDir is the directory the web UI is served from, the embedded copy
+	// when empty
+	webDir string
+	// publicDenylists are the denylists of public gateways of the config,
+	// loaded by startPublicDenylists
+	publicDenylists []*check.PublicDenylist
+	// resourceLimitedChecks counts the peer checks cut short by the resource
+	// manager of the checker, nil until the server starts
+	resourceLimitedChecks prometheus.Counter
+	// routers picks the delegated routing endpoint of the checks
+	routers *routerFailover
+	// events publishes the checks to a message bus, nil if disabled
+	events *eventPublisher
+	// ownership keeps the ownership proofs of peer IDs, nil if disabled
+	ownership *ownershipRegistry
 }
 
-const (
-	// number of providers at which to stop looking for providers in the DHT
-	// When doing a check only with a CID
-	maxProvidersCount = 10
-
-	ipniSource = "IPNI"
-	dhtSource  = "Amino DHT"
-)
+func newDaemon(ctx context.Context, acceleratedDHT bool, datastorePath string, cfg *config) (*daemon, error) {
+	bootstrapPeers, err := parseBootstrapPeers(cfg.BootstrapPeers)
+	if err != nil {
+		return nil, err
+	}
+	fallbackBootstrapPeers, err := parseFallbackBootstrapPeers(cfg.FallbackBootstrapPeers)
+	if err != nil {
+		return nil, err
+	}
 
-// TODO: make this configurable, and add support and trustless retrieval probe for transport-ipfs-gateway-http
-var defaultProtocolFilter = []string{"transport-bitswap", "unknown"}
+	psk, err := loadSwarmKey(cfg.SwarmKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if psk != nil {
+		log.Printf("Using private network swarm key from %s\n", cfg.SwarmKeyFile)
+	}
 
-func newDaemon(ctx context.Context, acceleratedDHT bool) (*daemon, error) {
-	rm, err := NewResourceManager()
+	attestationKey, err := loadAttestationKey(cfg.Attestations.KeyFile)
 	if err != nil {
 		return nil, err
 	}
 
-	c, err := connmgr.NewConnManager(100, 900, connmgr.WithGracePeriod(time.Second*30))
+	resolver, err := check.NewDNSResolver(cfg.DNSResolver)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a custom registry for all prometheus metrics
-	promRegistry := prometheus.NewRegistry()
+	if datastorePath != "" {
+		if err := os.MkdirAll(datastorePath, 0o755); err != nil {
+			return nil, fmt.Errorf("creating datastore directory: %w", err)
+		}
+	}
 
-	h, err := libp2p.New(
-		libp2p.DefaultMuxers,
-		libp2p.Muxer(mplex.ID, mplex.DefaultTransport),
-		libp2p.ConnectionManager(c),
-		libp2p.ConnectionGater(&privateAddrFilterConnectionGater{}),
-		libp2p.ResourceManager(rm),
-		libp2p.EnableHolePunching(),
-		libp2p.PrometheusRegisterer(promRegistry),
-		libp2p.UserAgent(userAgent),
-	)
+	addrPolicy, err := cfg.addrPolicy()
 	if err != nil {
 		return nil, err
 	}
+	if p := cfg.AddrPolicy; !p.DenyPrivate || p.DenyRelay || len(p.AllowedNetworks) > 0 {
+		log.Printf("Address policy: private addresses denied: %t, relay addresses denied: %t, allowed networks: %v\n", !addrPolicy.AllowPrivate, p.DenyRelay, p.AllowedNetworks)
+	}
+
+	var geoIP *check.GeoIP
+	if cfg.GeoIPCountryDB != "" || cfg.GeoIPASNDB != "" {
+		geoIP, err = check.OpenGeoIP(cfg.GeoIPCountryDB, cfg.GeoIPASNDB)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Locating the addresses of the checked peers with the GeoIP databases %q and %q\n", cfg.GeoIPCountryDB, cfg.GeoIPASNDB)
+	}
+
+	var denylist *check.Denylist
+	if dl := cfg.Denylist; len(dl.Peers)+len(dl.Networks)+len(dl.ASNs)+len(dl.CIDFiles) > 0 {
+		denylist, err = check.NewDenylist(dl.Peers, dl.Networks, dl.ASNs, dl.CIDFiles)
+		if err != nil {
+			if geoIP != nil {
+				_ = geoIP.Close()
+			}
+			return nil, err
+		}
+		log.Printf("Denying %d peers, networks, autonomous systems and CIDs\n", denylist.Len())
+	}
+
+	publicDenylists := make([]*check.PublicDenylist, 0, len(cfg.PublicDenylists))
+	for _, l := range cfg.PublicDenylists {
+		publicDenylists = append(publicDenylists, check.NewPublicDenylist(l.Name, l.Source))
+	}
 
-	var d kademlia
-	if acceleratedDHT {
-		d, err = fullrt.NewFullRT(h, "/ipfs",
-			fullrt.DHTOption(
-				dht.BucketSize(20),
-				dht.Validator(record.NamespacedValidator{
-					"pk":   record.PublicKeyValidator{},
-					"ipns": ipns.Validator{},
-				}),
-				dht.BootstrapPeers(dht.GetDefaultBootstrapPeerAddrInfos()...),
-				dht.Mode(dht.ModeClient),
-			))
+	if cfg.AddrFamily != "" {
+		log.Printf("Only listening on and dialing %s addresses\n", cfg.AddrFamily)
+	}
+	if cfg.LocalNetwork {
+		log.Printf("Running in local network mode: dialing private addresses, do not expose this instance publicly\n")
+	}
 
-	} else {
-		d, err = dht.New(ctx, h, dht.Mode(dht.ModeClient), dht.BootstrapPeers(dht.GetDefaultBootstrapPeerAddrInfos()...))
+	limits := cfg.resourceLimits()
+	if limits != (check.ResourceLimits{}) {
+		log.Printf("Limiting the host to %d connections, %d streams and %d bytes of memory (0 for unlimited)\n", limits.Conns, limits.Streams, limits.Memory)
 	}
 
+	// Create a custom registry for all prometheus metrics
+	promRegistry := prometheus.NewRegistry()
+
+	checker, err := check.New(ctx, check.Config{
+		BootstrapPeers:         bootstrapPeers,
+		FallbackBootstrapPeers: fallbackBootstrapPeers,
+		DHTProtocolPrefix:      cfg.DHTProtocolPrefix,
+		AcceleratedDHT:         acceleratedDHT,
+		PSK:                    psk,
+		DNSResolver:            resolver,
+		PrometheusRegisterer:   promRegistry,
+		UserAgent:              userAgent,
+		DatastorePath:          datastorePath,
+		ResourceLimits:         limits,
+		GeoIP:                  geoIP,
+		Denylist:               denylist,
+		PublicDenylists:        publicDenylists,
+		AddrFamily:             cfg.AddrFamily,
+		Ephemeral:              cfg.ephemeral,
+		LocalNetwork:           cfg.LocalNetwork,
+		AddrPolicy:             addrPolicy,
+		AttestationKey:         attestationKey,
+	})
 	if err != nil {
+		if geoIP != nil {
+			_ = geoIP.Close()
+		}
 		return nil, err
 	}
 
-	pm, err := dhtProtocolMessenger("/ipfs/kad/1.0.0", h)
+	events, err := newEventPublisher(cfg.Events)
 	if err != nil {
+		if geoIP != nil {
+			_ = geoIP.Close()
+		}
+		_ = checker.Close()
 		return nil, err
 	}
 
-	return &daemon{
-		h:            h,
-		dht:          d,
-		dhtMessenger: pm,
+	daemon := &daemon{
+		checker:      checker,
 		promRegistry: promRegistry,
-		createTestHost: func() (host.Host, error) {
-			// TODO: when behind NAT, this will fail to determine its own public addresses which will block it from running dctur and hole punching
-			// See https://github.com/libp2p/go-libp2p/issues/2941
-			return libp2p.New(
-				libp2p.ConnectionGater(&privateAddrFilterConnectionGater{}),
-				libp2p.DefaultMuxers,
-				libp2p.Muxer("/mplex/6.7.0", mplex.DefaultTransport),
-				libp2p.EnableHolePunching(),
-				libp2p.UserAgent(userAgent),
-			)
-		}}, nil
-}
+		rateLimiter:  newClientRateLimiter(cfg.RateLimit, cfg.RateLimitBurst, cfg.APIKeys),
+		cache:        newCheckCache(cfg.CacheSize, cfg.CacheTTL),
+		geoIP:        geoIP,
+		routers:      newRouterFailover(),
+		events:       events,
 
-func (d *daemon) mustStart() {
-	// Wait for the DHT to be ready
-	if frt, ok := d.dht.(*fullrt.FullRT); ok {
-		if !frt.Ready() {
-			log.Printf("Please wait, initializing accelerated-dht client.. (mapping Amino DHT takes 5 mins or more)")
-		}
-		for !frt.Ready() {
-			time.Sleep(time.Second * 1)
-		}
-		log.Printf("Accelerated DHT client is ready")
+		publicDenylists: publicDenylists,
 	}
+	daemon.cfg.Store(cfg)
+	return daemon, nil
 }
 
-type cidCheckOutput *[]providerOutput
-
-type providerOutput struct {
-	ID                       string
-	ConnectionError          string
-	Addrs                    []string
-	ConnectionMaddrs         []string
-	DataAvailableOverBitswap BitswapCheckOutput
-	Source                   string
+// startServices starts the background work of the daemon needed by checks:
+// the public denylists, the health checks of the delegated routing endpoints
+// and the publication of check events
+func (d *daemon) startServices(ctx context.Context) {
+	d.startPublicDenylists(ctx)
+	go d.routers.run(ctx, d.config)
+	if d.events != nil {
+		go d.events.run(ctx)
+	}
 }
 
-// runCidCheck finds providers of a given CID, using the DHT and IPNI
-// concurrently. A check of connectivity and Bitswap availability is performed
-// for each provider found.
-func (d *daemon) runCidCheck(ctx context.Context, cidKey cid.Cid, ipniURL string) (cidCheckOutput, error) {
-	crClient, err := client.New(ipniURL,
-		client.WithStreamResultsRequired(),               // // https://specs.ipfs.tech/routing/http-routing-v1/#streaming
-		client.WithProtocolFilter(defaultProtocolFilter), // IPIP-484
-		client.WithDisabledLocalFiltering(false),         // force local filtering in case remote server does not support IPIP-484
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create content router client: %w", err)
+// startPublicDenylists loads the public denylists in the background, and
+// reloads them periodically until ctx is done. Checks run before a list is
+// loaded report it without an UpdatedAt.
+func (d *daemon) startPublicDenylists(ctx context.Context) {
+	for i, l := range d.config().PublicDenylists {
+		go d.publicDenylists[i].Run(ctx, cmp.Or(l.RefreshInterval, defaultPublicDenylistRefresh))
 	}
-	routerClient := contentrouter.NewContentRoutingClient(crClient)
+}
 
-	queryCtx, cancelQuery := context.WithCancel(ctx)
-	defer cancelQuery()
+// parseBootstrapPeers parses the configured bootstrap multiaddrs, defaulting
+// to the Amino DHT bootstrappers when none are configured
+func parseBootstrapPeers(addrs []string) ([]peer.AddrInfo, error) {
+	if len(addrs) == 0 {
+		return dht.GetDefaultBootstrapPeerAddrInfos(), nil
+	}
 
-	// half of the max providers count per source
-	providersPerSource := maxProvidersCount >> 1
-	if maxProvidersCount == 1 {
-		// Ensure at least one provider from each source when maxProvidersCount is 1
-		providersPerSource = 1
+	maddrs := make([]multiaddr.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		ma, err := multiaddr.NewMultiaddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap peer %q: %w", a, err)
+		}
+		maddrs = append(maddrs, ma)
 	}
+	return peer.AddrInfosFromP2pAddrs(maddrs...)
+}
 
-	// Find providers with DHT and IPNI concurrently (each half of the max providers count)
-	dhtProvsCh := d.dht.FindProvidersAsync(queryCtx, cidKey, providersPerSource)
-	ipniProvsCh := routerClient.FindProvidersAsync(queryCtx, cidKey, providersPerSource)
+// parseFallbackBootstrapPeers parses the configured fallback bootstrap
+// multiaddrs, which have no default
+func parseFallbackBootstrapPeers(addrs []string) ([]peer.AddrInfo, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	return parseBootstrapPeers(addrs)
+}
 
-	out := make([]providerOutput, 0, maxProvidersCount)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var providersCount int
-	var done bool
+// warmupLogInterval is how often the progress of the accelerated DHT client's crawl is logged
+const warmupLogInterval = 30 * time.Second
 
-	for !done {
-		var provider peer.AddrInfo
-		var open bool
-		var source string
+// waitReady waits for the DHT client to be ready, periodically logging the
+// progress of the accelerated DHT client's crawl. It returns false if ctx is
+// canceled first.
+func (d *daemon) waitReady(ctx context.Context) bool {
+	if d.checker.Ready() {
+		return true
+	}
+	log.Printf("Please wait, initializing accelerated-dht client.. (mapping Amino DHT takes 5 mins or more)")
 
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastLog := time.Now()
+	for !d.checker.Ready() {
 		select {
-		case provider, open = <-dhtProvsCh:
-			if !open {
-				dhtProvsCh = nil
-				if ipniProvsCh == nil {
-					done = true
-				}
-				continue
-			}
-			source = dhtSource
-		case provider, open = <-ipniProvsCh:
-			if !open {
-				ipniProvsCh = nil
-				if dhtProvsCh == nil {
-					done = true
-				}
-				continue
-			}
-			source = ipniSource
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
 		}
-		providersCount++
-		if providersCount == maxProvidersCount {
-			done = true
+		if time.Since(lastLog) < warmupLogInterval {
+			continue
+		}
+		lastLog = time.Now()
+		if crawl := d.checker.DHTStatus().Crawl; crawl != nil {
+			log.Printf("Mapping the DHT: %d peers queried, %d failed, %d discovered, %d buckets filled, about %s left\n",
+				crawl.PeersQueried, crawl.PeersFailed, crawl.PeersDiscovered, crawl.BucketsFilled, crawl.EstimatedRemaining.Round(time.Second))
 		}
-
-		wg.Add(1)
-		go func(provider peer.AddrInfo, src string) {
-			defer wg.Done()
-
-			outputAddrs := []string{}
-			if len(provider.Addrs) > 0 {
-				for _, addr := range provider.Addrs {
-					if manet.IsPublicAddr(addr) { // only return public addrs
-						outputAddrs = append(outputAddrs, addr.String())
-					}
-				}
-			} else {
-				// If no maddrs were returned from the FindProvider rpc call, try to get them from the DHT
-				peerAddrs, err := d.dht.FindPeer(ctx, provider.ID)
-				if err == nil {
-					for _, addr := range peerAddrs.Addrs {
-						if manet.IsPublicAddr(addr) { // only return public addrs
-							// Add to both output and to provider addrs for the check
-							outputAddrs = append(outputAddrs, addr.String())
-							provider.Addrs = append(provider.Addrs, addr)
-						}
-					}
-				}
-			}
-
-			provOutput := providerOutput{
-				ID:                       provider.ID.String(),
-				Addrs:                    outputAddrs,
-				DataAvailableOverBitswap: BitswapCheckOutput{},
-				Source:                   src,
-			}
-
-			testHost, err := d.createTestHost()
-			if err != nil {
-				log.Printf("Error creating test host: %v\n", err)
-				return
-			}
-			defer testHost.Close()
-
-			// Test Is the target connectable
-			dialCtx, dialCancel := context.WithTimeout(ctx, time.Second*15)
-			defer dialCancel()
-
-			_ = testHost.Connect(dialCtx, provider)
-			// Call NewStream to force NAT hole punching. see https://github.com/libp2p/go-libp2p/issues/2714
-			_, connErr := testHost.NewStream(dialCtx, provider.ID, "/ipfs/bitswap/1.2.0", "/ipfs/bitswap/1.1.0", "/ipfs/bitswap/1.0.0", "/ipfs/bitswap")
-
-			if connErr != nil {
-				provOutput.ConnectionError = connErr.Error()
-			} else {
-				// since we pass a libp2p host that's already connected to the peer the actual connection maddr we pass in doesn't matter
-				p2pAddr, _ := multiaddr.NewMultiaddr("/p2p/" + provider.ID.String())
-				provOutput.DataAvailableOverBitswap = checkBitswapCID(ctx, testHost, cidKey, p2pAddr)
-
-				for _, c := range testHost.Network().ConnsToPeer(provider.ID) {
-					provOutput.ConnectionMaddrs = append(provOutput.ConnectionMaddrs, c.RemoteMultiaddr().String())
-				}
-			}
-
-			mu.Lock()
-			out = append(out, provOutput)
-			mu.Unlock()
-		}(provider, source)
 	}
-	cancelQuery()
+	log.Printf("Accelerated DHT client is ready")
+	return true
+}
 
-	// Wait for all goroutines to finish
-	wg.Wait()
+// dhtStatusHandler serves the state of the DHT client and the progress of
+// the accelerated DHT client's crawl
+func (d *daemon) dhtStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := d.checker.DHTStatus()
+	if d.validateResponses {
+		if err := validateResponse(status); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, status)
+}
 
-	return &out, nil
+// networkStatusHandler serves the view of the network from the checker
+func (d *daemon) networkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := d.config()
+	status := d.checker.NetworkStatus(r.Context(), append([]string{cfg.IPNIIndexer}, cfg.FallbackIPNIIndexers...))
+	if d.validateResponses {
+		if err := validateResponse(status); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, status)
 }
 
-type peerCheckOutput struct {
-	ConnectionError              string
-	PeerFoundInDHT               map[string]int
-	ProviderRecordFromPeerInDHT  bool
-	ProviderRecordFromPeerInIPNI bool
-	ConnectionMaddrs             []string
-	DataAvailableOverBitswap     BitswapCheckOutput
+// checkOptions returns the options of checks that do not override them, with
+// the delegated routing endpoint picked by d.routers, reporting the stages of
+// the check of the request of ctx
+func (d *daemon) checkOptions(ctx context.Context, cfg *config) check.Options {
+	opts := cfg.checkOptions()
+	opts.IPNIIndexer = d.routers.pick(cfg)
+	opts.OnStage = d.active.onStage(ctx)
+	return opts
 }
 
-// runPeerCheck checks the connectivity and Bitswap availability of a CID from a given peer (either with just peer ID or specific multiaddr)
-func (d *daemon) runPeerCheck(ctx context.Context, ma multiaddr.Multiaddr, ai *peer.AddrInfo, c cid.Cid, ipniURL string) (*peerCheckOutput, error) {
-	addrMap, peerAddrDHTErr := peerAddrsInDHT(ctx, d.dht, d.dhtMessenger, ai.ID)
-
-	var inDHT, inIPNI bool
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-		inDHT = providerRecordFromPeerInDHT(ctx, d.dht, c, ai.ID)
-		wg.Done()
-	}()
-	go func() {
-		inIPNI = providerRecordFromPeerInIPNI(ctx, ipniURL, c, ai.ID)
-		wg.Done()
-	}()
-	wg.Wait()
-
-	out := &peerCheckOutput{
-		ProviderRecordFromPeerInDHT:  inDHT,
-		ProviderRecordFromPeerInIPNI: inIPNI,
-		PeerFoundInDHT:               addrMap,
-	}
-
-	var connectionFailed bool
-
-	// If peerID given,but no addresses check the DHT
-	if len(ai.Addrs) == 0 {
-		if peerAddrDHTErr != nil {
-			// PeerID is not resolvable via the DHT
-			connectionFailed = true
-			out.ConnectionError = peerAddrDHTErr.Error()
-		}
-		for a := range addrMap {
-			ma, err := multiaddr.NewMultiaddr(a)
-			if err != nil {
-				log.Println(fmt.Errorf("error parsing multiaddr %s: %w", a, err))
-				continue
-			}
-			ai.Addrs = append(ai.Addrs, ma)
+// checkerInfoHandler serves the vantage point of the checker
+func (d *daemon) checkerInfoHandler(w http.ResponseWriter, r *http.Request) {
+	info := d.checker.CheckerInfo()
+	if d.validateResponses {
+		if err := validateResponse(info); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
 		}
 	}
+	writeResponse(w, r, info)
+}
 
-	testHost, err := d.createTestHost()
-	if err != nil {
-		return nil, fmt.Errorf("server error: %w", err)
+// close shuts down the checker and the check history
+func (d *daemon) close() error {
+	var errs []error
+	if err := d.checker.Close(); err != nil {
+		errs = append(errs, err)
 	}
-	defer testHost.Close()
-
-	if !connectionFailed {
-		// Test Is the target connectable
-		dialCtx, dialCancel := context.WithTimeout(ctx, time.Second*120)
-
-		_ = testHost.Connect(dialCtx, *ai)
-		// Call NewStream to force NAT hole punching. see https://github.com/libp2p/go-libp2p/issues/2714
-		_, connErr := testHost.NewStream(dialCtx, ai.ID, "/ipfs/bitswap/1.2.0", "/ipfs/bitswap/1.1.0", "/ipfs/bitswap/1.0.0", "/ipfs/bitswap")
-		dialCancel()
-		if connErr != nil {
-			out.ConnectionError = connErr.Error()
-			return out, nil
+	if d.history != nil {
+		if err := d.history.close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing check history: %w", err))
 		}
 	}
-
-	// If so is the data available over Bitswap?
-	out.DataAvailableOverBitswap = checkBitswapCID(ctx, testHost, c, ma)
-
-	// Get all connection maddrs to the peer (in case we hole punched, there will usually be two: limited relay and direct)
-	for _, c := range testHost.Network().ConnsToPeer(ai.ID) {
-		out.ConnectionMaddrs = append(out.ConnectionMaddrs, c.RemoteMultiaddr().String())
+	if d.geoIP != nil {
+		if err := d.geoIP.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing GeoIP databases: %w", err))
+		}
 	}
-
-	return out, nil
+	return errors.Join(errs...)
 }
 
-type BitswapCheckOutput struct {
-	Duration  time.Duration
-	Found     bool
-	Responded bool
-	Error     string
+type cidCheckOutput *[]check.ProviderOutput
+
+// verdictCheckOutput is the result of a CID check passing verdict=true: the
+// providers, with the verdict summarizing their checks
+type verdictCheckOutput struct {
+	Verdict   check.VerdictOutput
+	Providers []check.ProviderOutput
 }
 
-func checkBitswapCID(ctx context.Context, host host.Host, c cid.Cid, ma multiaddr.Multiaddr) BitswapCheckOutput {
-	log.Printf("Start of Bitswap check for cid %s by attempting to connect to ma: %v with the peer: %s", c, ma, host.ID())
-	out := BitswapCheckOutput{}
-	start := time.Now()
+// withVerdict returns the result of a CID check with its verdict
+func withVerdict(out cidCheckOutput) verdictCheckOutput {
+	providers := []check.ProviderOutput{}
+	if out != nil {
+		providers = *out
+	}
+	return verdictCheckOutput{Verdict: check.CIDVerdict(providers), Providers: providers}
+}
 
-	bsOut, err := vole.CheckBitswapCID(ctx, host, c, ma, false)
-	if err != nil {
-		out.Error = err.Error()
-	} else {
-		out.Found = bsOut.Found
-		out.Responded = bsOut.Responded
-		if bsOut.Error != nil {
-			out.Error = bsOut.Error.Error()
+// setCIDMultibase sets the multibase the CID was passed in on the output of a
+// check, which the checker does not know of
+func setCIDMultibase(data interface{}, mb string) {
+	switch out := data.(type) {
+	case cidCheckOutput:
+		if out == nil {
+			return
+		}
+		for i := range *out {
+			(*out)[i].CID.Multibase = mb
+		}
+	case *check.PeerCheckOutput:
+		if out != nil {
+			out.CID.Multibase = mb
 		}
 	}
-
-	log.Printf("End of Bitswap check for %s by attempting to connect to ma: %v", c, ma)
-	out.Duration = time.Since(start)
-	return out
 }
 
-func peerAddrsInDHT(ctx context.Context, d kademlia, messenger *dhtpb.ProtocolMessenger, p peer.ID) (map[string]int, error) {
-	closestPeers, err := d.GetClosestPeers(ctx, string(p))
+// runCidCheck runs a CID check and adds the check of each provider to the history
+func (d *daemon) runCidCheck(ctx context.Context, cidKey cid.Cid, opts check.Options) (cidCheckOutput, error) {
+	out, err := d.checker.CheckCID(ctx, cidKey, opts)
 	if err != nil {
 		return nil, err
 	}
+	d.recordProviderChecks(ctx, cidKey, out)
+	return &out, nil
+}
 
-	resCh := make(chan *peer.AddrInfo, len(closestPeers))
-
-	numSuccessfulResponses := execOnMany(ctx, 0.3, time.Second*3, func(ctx context.Context, peerToQuery peer.ID) error {
-		endResults, err := messenger.GetClosestPeers(ctx, peerToQuery, p)
-		if err == nil {
-			for _, r := range endResults {
-				if r.ID == p {
-					resCh <- r
-					return nil
-				}
-			}
-			resCh <- nil
-		}
-		return err
-	}, closestPeers, false)
-	close(resCh)
-
-	if numSuccessfulResponses == 0 {
-		return nil, fmt.Errorf("host had trouble querying the DHT")
+// runProvidersCheck checks the providers passed in the request and adds their
+// checks to the history
+func (d *daemon) runProvidersCheck(ctx context.Context, cidKey cid.Cid, providers []peer.AddrInfo, opts check.Options) (cidCheckOutput, error) {
+	out, err := d.checker.CheckProviders(ctx, cidKey, providers, opts)
+	if err != nil {
+		return nil, err
 	}
+	d.recordProviderChecks(ctx, cidKey, out)
+	return &out, nil
+}
 
-	addrMap := make(map[string]int)
-	for r := range resCh {
-		if r == nil {
+func (d *daemon) recordProviderChecks(ctx context.Context, cidKey cid.Cid, out []check.ProviderOutput) {
+	for _, p := range out {
+		if p.ResourceLimited {
+			d.countResourceLimited()
 			continue
 		}
-		for _, addr := range r.Addrs {
-			addrMap[addr.String()]++
-		}
-	}
-
-	return addrMap, nil
-}
-
-func providerRecordFromPeerInDHT(ctx context.Context, d kademlia, c cid.Cid, p peer.ID) bool {
-	queryCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	provsCh := d.FindProvidersAsync(queryCtx, c, 0)
-	for {
-		select {
-		case prov, ok := <-provsCh:
-			if !ok {
-				return false
-			}
-			if prov.ID == p {
-				return true
-			}
-		case <-ctx.Done():
-			return false
+		if p.Denied {
+			continue
 		}
+		d.recordCheck(ctx, p.ID, cidKey, p.ConnectionError, p.DataAvailableOverBitswap)
 	}
 }
 
-func providerRecordFromPeerInIPNI(ctx context.Context, ipniURL string, c cid.Cid, p peer.ID) bool {
-	crClient, err := client.New(ipniURL, client.WithStreamResultsRequired())
+// runPeerCIDsCheck checks several CIDs against a peer and adds the check of
+// each CID to the history of the peer
+func (d *daemon) runPeerCIDsCheck(ctx context.Context, ma multiaddr.Multiaddr, cids []cid.Cid, opts check.Options) (*check.PeerCIDsCheckOutput, error) {
+	out, err := d.checker.CheckPeerCIDs(ctx, ma, cids, opts)
 	if err != nil {
-		log.Printf("failed to creat content router client: %s\n", err)
-		return false
+		return nil, err
 	}
-	routerClient := contentrouter.NewContentRoutingClient(crClient)
-
-	queryCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	provsCh := routerClient.FindProvidersAsync(queryCtx, c, 0)
-	for {
-		select {
-		case prov, ok := <-provsCh:
-			if !ok {
-				return false
-			}
-			if prov.ID == p {
-				return true
-			}
-		case <-ctx.Done():
-			return false
+	if out.ResourceLimited {
+		d.countResourceLimited()
+	} else if _, p := peer.SplitAddr(ma); p != "" {
+		for i, c := range cids {
+			d.recordCheck(ctx, p.String(), c, out.ConnectionError, out.CIDs[i].DataAvailableOverBitswap)
 		}
 	}
+	return out, nil
 }
 
-// Taken from the FullRT DHT client implementation
-//
-// execOnMany executes the given function on each of the peers, although it may only wait for a certain chunk of peers
-// to respond before considering the results "good enough" and returning.
-//
-// If sloppyExit is true then this function will return without waiting for all of its internal goroutines to close.
-// If sloppyExit is true then the passed in function MUST be able to safely complete an arbitrary amount of time after
-// execOnMany has returned (e.g. do not write to resources that might get closed or set to nil and therefore result in
-// a panic instead of just returning an error).
-func execOnMany(ctx context.Context, waitFrac float64, timeoutPerOp time.Duration, fn func(context.Context, peer.ID) error, peers []peer.ID, sloppyExit bool) int {
-	if len(peers) == 0 {
-		return 0
+// countResourceLimited counts a peer check cut short by the resource manager
+// of the checker. Such checks are not added to the history as they say nothing
+// about the peer.
+func (d *daemon) countResourceLimited() {
+	if d.resourceLimitedChecks != nil {
+		d.resourceLimitedChecks.Inc()
 	}
+}
 
-	// having a buffer that can take all of the elements is basically a hack to allow for sloppy exits that clean up
-	// the goroutines after the function is done rather than before
-	errCh := make(chan error, len(peers))
-	numSuccessfulToWaitFor := int(float64(len(peers)) * waitFrac)
-
-	putctx, cancel := context.WithTimeout(ctx, timeoutPerOp)
-	defer cancel()
-
-	for _, p := range peers {
-		go func(p peer.ID) {
-			errCh <- fn(putctx, p)
-		}(p)
+// runPeerCheck runs a peer check and adds it to the history
+func (d *daemon) runPeerCheck(ctx context.Context, ma multiaddr.Multiaddr, c cid.Cid, opts check.Options) (*check.PeerCheckOutput, error) {
+	out, err := d.checker.CheckPeer(ctx, ma, c, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	var numDone, numSuccess, successSinceLastTick int
-	var ticker *time.Ticker
-	var tickChan <-chan time.Time
-
-	for numDone < len(peers) {
-		select {
-		case err := <-errCh:
-			numDone++
-			if err == nil {
-				numSuccess++
-				if numSuccess >= numSuccessfulToWaitFor && ticker == nil {
-					// Once there are enough successes, wait a little longer
-					ticker = time.NewTicker(time.Millisecond * 500)
-					defer ticker.Stop()
-					tickChan = ticker.C
-					successSinceLastTick = numSuccess
-				}
-				// This is equivalent to numSuccess * 2 + numFailures >= len(peers) and is a heuristic that seems to be
-				// performing reasonably.
-				// TODO: Make this metric more configurable
-				// TODO: Have better heuristics in this function whether determined from observing static network
-				// properties or dynamically calculating them
-				if numSuccess+numDone >= len(peers) {
-					cancel()
-					if sloppyExit {
-						return numSuccess
-					}
-				}
-			}
-		case <-tickChan:
-			if numSuccess > successSinceLastTick {
-				// If there were additional successes, then wait another tick
-				successSinceLastTick = numSuccess
-			} else {
-				cancel()
-				if sloppyExit {
-					return numSuccess
-				}
-			}
-		}
+	if out.ResourceLimited {
+		d.countResourceLimited()
+	} else if _, p := peer.SplitAddr(ma); p != "" {
+		d.recordCheck(ctx, p.String(), c, out.ConnectionError, out.DataAvailableOverBitswap)
 	}
-	return numSuccess
+	return out, nil
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// swarmDiagnostics is the response of GET /debug/swarm
+type swarmDiagnostics struct {
+	Goroutines int
+	Peers      int
+	Conns      int
+	Streams    int
+	// ConnsByTransport counts the open connections by transport, e.g. quic-v1
+	ConnsByTransport map[string]int
+	// StreamsByProtocol counts the open streams by protocol, with the ones
+	// still negotiating their protocol under ""
+	StreamsByProtocol map[string]int
+	Connections       []connDiagnostics
+}
+
+// connDiagnostics describes an open connection of the host of the checker
+type connDiagnostics struct {
+	Peer       string
+	RemoteAddr string
+	// Direction is inbound or outbound
+	Direction string
+	Opened    time.Time
+	// Limited is whether the connection is relayed with limits
+	Limited bool
+	// Streams are the protocols of the open streams
+	Streams []string
+}
+
+// diagnoseSwarm returns the open connections and streams of h
+func diagnoseSwarm(h host.Host) swarmDiagnostics {
+	out := swarmDiagnostics{
+		Goroutines:        runtime.NumGoroutine(),
+		Peers:             len(h.Network().Peers()),
+		ConnsByTransport:  make(map[string]int),
+		StreamsByProtocol: make(map[string]int),
+		Connections:       []connDiagnostics{},
+	}
+	for _, c := range h.Network().Conns() {
+		stat := c.Stat()
+		conn := connDiagnostics{
+			Peer:       c.RemotePeer().String(),
+			RemoteAddr: c.RemoteMultiaddr().String(),
+			Direction:  stat.Direction.String(),
+			Opened:     stat.Opened,
+			Limited:    stat.Limited,
+			Streams:    []string{},
+		}
+		for _, s := range c.GetStreams() {
+			conn.Streams = append(conn.Streams, string(s.Protocol()))
+			out.StreamsByProtocol[string(s.Protocol())]++
+		}
+		out.ConnsByTransport[c.ConnState().Transport]++
+		out.Conns++
+		out.Streams += len(conn.Streams)
+		out.Connections = append(out.Connections, conn)
+	}
+	return out
+}
+
+// diagnosticsHandler serves the profiles of the process, a dump of its
+// goroutines and the open connections and streams of the checker. They must
+// not be served publicly.
+func (d *daemon) diagnosticsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_ = runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	mux.HandleFunc("GET /debug/swarm", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(diagnoseSwarm(d.checker.Host()))
+	})
+	return mux
+}
+
+// startDiagnostics serves the diagnostics endpoints on addr until ctx is done
+func (d *daemon) startDiagnostics(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: d.diagnosticsHandler()}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(l); err != http.ErrServerClosed {
+			log.Printf("Error serving the diagnostics endpoints: %v\n", err)
+		}
+	}()
+	log.Printf("Diagnostics endpoints at http://%s/debug/ (do not expose them publicly)\n", l.Addr())
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnoseSwarm(t *testing.T) {
+	h1, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h1.Close()
+	h2, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.SetStreamHandler("/test/1.0.0", func(s network.Stream) {})
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	s, err := h1.NewStream(context.Background(), h2.ID(), "/test/1.0.0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	out := diagnoseSwarm(h1)
+	require.Equal(t, 1, out.Peers)
+	require.Equal(t, 1, out.Conns)
+	require.Equal(t, 1, out.ConnsByTransport["tcp"])
+	require.Equal(t, 1, out.StreamsByProtocol["/test/1.0.0"])
+	require.Len(t, out.Connections, 1)
+	require.Equal(t, h2.ID().String(), out.Connections[0].Peer)
+	require.Equal(t, "Outbound", out.Connections[0].Direction)
+	require.Contains(t, out.Connections[0].Streams, "/test/1.0.0")
+	require.Positive(t, out.Goroutines)
+}
+
+func TestDiagnosticsHandler(t *testing.T) {
+	h := (&daemon{}).diagnosticsHandler()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/goroutines"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+	}
+}
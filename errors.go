@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+)
+
+// Codes of the errors returned by the API. Errors caused by the request are
+// 4xx, and 5xx are reserved for failures of the daemon or of the services it
+// depends on.
+const (
+	errCodeMissingParameter = "missing-parameter"
+	errCodeInvalidParameter = "invalid-parameter"
+	errCodeInvalidBody      = "invalid-body"
+	errCodeDeniedCID        = "denied-cid"
+	errCodeDeniedPeer       = "denied-peer"
+	errCodeOwnerRequired    = "owner-required"
+	errCodeUnauthorized     = "unauthorized"
+	errCodeNotFound         = "not-found"
+	errCodeMethodNotAllowed = "method-not-allowed"
+	errCodeRateLimited      = "rate-limited"
+	errCodeTooManyChecks    = "too-many-checks"
+	errCodeTimeout          = "timeout"
+	errCodeUpstream         = "upstream-error"
+	errCodeInternal         = "internal-error"
+)
+
+// apiErrorOutput is the body of the error responses of the API
+type apiErrorOutput struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details has more context about the error, e.g. the query parameter
+	// that is invalid
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// writeError answers the request with a JSON error
+func writeError(w http.ResponseWriter, status int, code, message string, details map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiErrorOutput{Error: apiError{Code: code, Message: message, Details: details}})
+}
+
+// writeMissingParam answers a request missing the query parameter param
+func writeMissingParam(w http.ResponseWriter, param string) {
+	writeError(w, http.StatusBadRequest, errCodeMissingParameter, "missing '"+param+"' query parameter", map[string]string{"parameter": param})
+}
+
+// writeInvalidParam answers a request with an invalid value of the query
+// parameter param
+func writeInvalidParam(w http.ResponseWriter, param, message string) {
+	writeError(w, http.StatusBadRequest, errCodeInvalidParameter, message, map[string]string{"parameter": param})
+}
+
+// writeTooManyChecks answers a request refused because maxConcurrentChecks
+// checks are running and maxQueuedChecks are waiting, with the statistics of
+// the queue
+func writeTooManyChecks(w http.ResponseWriter, stats queueStats, cfg *config) {
+	writeError(w, http.StatusServiceUnavailable, errCodeTooManyChecks, "too many checks in progress, try again later", map[string]string{
+		"running":             strconv.Itoa(stats.Running),
+		"queued":              strconv.Itoa(stats.Queued),
+		"maxConcurrentChecks": strconv.Itoa(cfg.MaxConcurrentChecks),
+		"maxQueuedChecks":     strconv.Itoa(cfg.MaxQueuedChecks),
+	})
+}
+
+// writeCheckError answers a request whose check failed with err, which is a
+// daemon fault unless it is a refusal of the denylist or a timeout. fallback
+// is the status of other errors, 0 for 500.
+func writeCheckError(w http.ResponseWriter, err error, fallback int) {
+	switch {
+	case errors.Is(err, check.ErrDeniedCID):
+		writeError(w, http.StatusUnavailableForLegalReasons, errCodeDeniedCID, err.Error(), nil)
+	case errors.Is(err, check.ErrDeniedPeer):
+		writeError(w, http.StatusForbidden, errCodeDeniedPeer, err.Error(), nil)
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, errCodeTimeout, err.Error(), nil)
+	case fallback == http.StatusBadGateway:
+		writeError(w, http.StatusBadGateway, errCodeUpstream, err.Error(), nil)
+	default:
+		writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// eventQueueSize is the number of events waiting to be published, beyond
+	// which new events are dropped
+	eventQueueSize = 1000
+	// eventBatchSize is the max number of events published at once
+	eventBatchSize = 100
+	eventTimeout   = 10 * time.Second
+)
+
+// checkEvent is published for each completed check of a peer, the same
+// checks as in the history
+type checkEvent struct {
+	Time time.Time
+	// PeerID and CID are salted hashes when the events are anonymized
+	PeerID string
+	CID    string
+	// Success is whether the peer was connected to and has the block, and
+	// FailureMode why not otherwise, as reported by the stats endpoint
+	Success     bool
+	FailureMode string
+	Responded   bool
+	Found       bool
+	// ConnectionError and BitswapError are left out when the events are
+	// anonymized, as they may contain addresses
+	ConnectionError string
+	BitswapError    string
+	BitswapDuration time.Duration
+}
+
+// eventSink is a message bus the events are published to
+type eventSink interface {
+	// publish sends events, each a JSON object
+	publish(ctx context.Context, events [][]byte) error
+	close() error
+}
+
+// eventPublisher publishes the check events to the configured sinks in the
+// background, so that a slow or unavailable bus does not slow down checks
+type eventPublisher struct {
+	sinks     []eventSink
+	anonymize bool
+	salt      []byte
+	queue     chan checkEvent
+	// events counts the events by whether they were published, dropped as the
+	// queue was full, or failed to be published
+	events *prometheus.CounterVec
+}
+
+// newEventPublisher returns the publisher of the events of cfg, nil if no bus
+// is configured
+func newEventPublisher(cfg eventsConfig) (*eventPublisher, error) {
+	var sinks []eventSink
+	if cfg.NATS != "" {
+		sinks = append(sinks, newNATSSink(cfg.NATS, cfg.NATSSubject))
+	}
+	if cfg.KafkaRESTProxy != "" {
+		sinks = append(sinks, &kafkaRESTSink{url: strings.TrimSuffix(cfg.KafkaRESTProxy, "/") + "/topics/" + url.PathEscape(cfg.KafkaTopic)})
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	salt := []byte(cfg.AnonymizeSalt)
+	if cfg.Anonymize && len(salt) == 0 {
+		// The hashes can then only be compared within the same run
+		salt = make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+	return &eventPublisher{
+		sinks:     sinks,
+		anonymize: cfg.Anonymize,
+		salt:      salt,
+		queue:     make(chan checkEvent, eventQueueSize),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ipfs_check_events_total",
+			Help: "Number of check events, by whether they were published, dropped because too many were waiting, or failed to be published",
+		}, []string{"result"}),
+	}, nil
+}
+
+// publish queues the event of a check record, dropping it if the queue is full
+func (p *eventPublisher) publish(r checkRecord) {
+	e := checkEvent{
+		Time:            r.Time,
+		PeerID:          r.PeerID,
+		CID:             r.CID,
+		Success:         r.success(),
+		FailureMode:     r.failureMode(),
+		Responded:       r.Responded,
+		Found:           r.Found,
+		ConnectionError: r.ConnectionError,
+		BitswapError:    r.BitswapError,
+		BitswapDuration: r.BitswapDuration,
+	}
+	if p.anonymize {
+		e.PeerID = p.hash(e.PeerID)
+		e.CID = p.hash(e.CID)
+		e.ConnectionError = ""
+		e.BitswapError = ""
+	}
+	select {
+	case p.queue <- e:
+	default:
+		p.events.WithLabelValues("dropped").Inc()
+	}
+}
+
+// hash returns the hex SHA-256 of the salt and s
+func (p *eventPublisher) hash(s string) string {
+	h := sha256.New()
+	h.Write(p.salt)
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// run publishes the queued events in batches until ctx is done, then closes
+// the sinks
+func (p *eventPublisher) run(ctx context.Context) {
+	defer func() {
+		for _, s := range p.sinks {
+			_ = s.close()
+		}
+	}()
+	for {
+		var batch [][]byte
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-p.queue:
+			batch = append(batch, p.encode(e))
+		}
+	fill:
+		for len(batch) < eventBatchSize {
+			select {
+			case e := <-p.queue:
+				batch = append(batch, p.encode(e))
+			default:
+				break fill
+			}
+		}
+
+		for _, s := range p.sinks {
+			sctx, cancel := context.WithTimeout(ctx, eventTimeout)
+			err := s.publish(sctx, batch)
+			cancel()
+			if err != nil {
+				log.Printf("Error publishing %d check events: %v\n", len(batch), err)
+				p.events.WithLabelValues("failed").Add(float64(len(batch)))
+			} else {
+				p.events.WithLabelValues("published").Add(float64(len(batch)))
+			}
+		}
+	}
+}
+
+func (p *eventPublisher) encode(e checkEvent) []byte {
+	b, _ := json.Marshal(e)
+	return b
+}
+
+// kafkaRESTSink publishes the events to a Kafka topic through a Kafka REST
+// Proxy, url being the URL of the topic
+type kafkaRESTSink struct {
+	url string
+}
+
+func (s *kafkaRESTSink) publish(ctx context.Context, events [][]byte) error {
+	type record struct {
+		Value json.RawMessage `json:"value"`
+	}
+	records := make([]record, len(events))
+	for i, e := range events {
+		records[i].Value = e
+	}
+	body, err := json.Marshal(map[string][]record{"records": records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("kafka REST proxy returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (s *kafkaRESTSink) close() error {
+	return nil
+}
+
+// natsSink publishes the events on a subject of a NATS server, speaking the
+// text protocol of NATS. It connects on the first publish and reconnects on
+// the next one after an error.
+type natsSink struct {
+	url     *url.URL
+	subject string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newNATSSink(rawURL, subject string) *natsSink {
+	// The URL is checked by the validation of the config
+	u, _ := url.Parse(rawURL)
+	return &natsSink{url: u, subject: subject}
+}
+
+func (s *natsSink) publish(ctx context.Context, events [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return fmt.Errorf("connecting to NATS: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, e := range events {
+		fmt.Fprintf(&buf, "PUB %s %d\r\n", s.subject, len(e))
+		buf.Write(e)
+		buf.WriteString("\r\n")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	_ = s.conn.SetWriteDeadline(time.Time{})
+	return nil
+}
+
+// connect opens the connection, must be called with mu held
+func (s *natsSink) connect(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.url.Host)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		_ = conn.Close()
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	opts := map[string]any{"verbose": false, "pedantic": false, "name": "ipfs-check", "lang": "go"}
+	if s.url.User != nil {
+		if pass, ok := s.url.User.Password(); ok {
+			opts["user"], opts["pass"] = s.url.User.Username(), pass
+		} else {
+			opts["auth_token"] = s.url.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	// The server answers the PING once it accepted the CONNECT
+	line, err = r.ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	if strings.TrimSpace(line) != "PONG" {
+		_ = conn.Close()
+		return errors.New(strings.TrimSpace(line))
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	s.conn = conn
+	go s.read(conn, r)
+	return nil
+}
+
+// read answers the PINGs of the server on conn, which disconnects clients
+// that do not, and logs its errors
+func (s *natsSink) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			s.mu.Lock()
+			if s.conn == conn {
+				_ = conn.Close()
+				s.conn = nil
+			}
+			s.mu.Unlock()
+			return
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			s.mu.Lock()
+			_, _ = io.WriteString(conn, "PONG\r\n")
+			s.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.Printf("NATS server error: %s\n", line)
+		}
+	}
+}
+
+func (s *natsSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATSServer accepts a client, answers its CONNECT and sends the payloads
+// of its PUBs on the subject
+func fakeNATSServer(t *testing.T, subject string) (string, <-chan []byte) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	msgs := make(chan []byte, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		_, _ = io.WriteString(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			var size int
+			switch fields := strings.Fields(line); fields[0] {
+			case "PING":
+				_, _ = io.WriteString(conn, "PONG\r\n")
+			case "PUB":
+				if fields[1] != subject {
+					return
+				}
+				_, _ = fmt.Sscan(fields[2], &size)
+				payload := make([]byte, size+2)
+				if _, err := io.ReadFull(r, payload); err != nil {
+					return
+				}
+				msgs <- payload[:size]
+			}
+		}
+	}()
+	return "nats://" + l.Addr().String(), msgs
+}
+
+func TestEventPublisher(t *testing.T) {
+	natsURL, natsMsgs := fakeNATSServer(t, "checks")
+
+	kafkaRecords := make(chan json.RawMessage, 10)
+	kafka := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/topics/checks", r.URL.Path)
+		require.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		var body struct {
+			Records []struct{ Value json.RawMessage }
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		for _, rec := range body.Records {
+			kafkaRecords <- rec.Value
+		}
+	}))
+	defer kafka.Close()
+
+	p, err := newEventPublisher(eventsConfig{NATS: natsURL, NATSSubject: "checks", KafkaRESTProxy: kafka.URL, KafkaTopic: "checks"})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.run(ctx)
+
+	p.publish(checkRecord{Time: time.Now(), PeerID: "peer", CID: "cid", ConnectionError: "dial failed"})
+	for _, msg := range [][]byte{<-natsMsgs, <-kafkaRecords} {
+		var e checkEvent
+		require.NoError(t, json.Unmarshal(msg, &e))
+		require.Equal(t, "peer", e.PeerID)
+		require.Equal(t, "cid", e.CID)
+		require.False(t, e.Success)
+		require.Equal(t, failureConnection, e.FailureMode)
+		require.Equal(t, "dial failed", e.ConnectionError)
+	}
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(p.events.WithLabelValues("published")) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestEventPublisherAnonymize(t *testing.T) {
+	cfg := eventsConfig{KafkaRESTProxy: "http://localhost:8082", KafkaTopic: "checks", Anonymize: true, AnonymizeSalt: "salt"}
+	p, err := newEventPublisher(cfg)
+	require.NoError(t, err)
+
+	p.publish(checkRecord{PeerID: "peer", CID: "cid", BitswapError: "stream reset by /ip4/192.0.2.1", Responded: true})
+	p.publish(checkRecord{PeerID: "peer", CID: "cid", Responded: true, Found: true})
+	e1, e2 := <-p.queue, <-p.queue
+	require.NotEqual(t, "peer", e1.PeerID)
+	require.NotEqual(t, "cid", e1.CID)
+	require.Equal(t, e1.PeerID, e2.PeerID, "the hashes can be compared")
+	require.Empty(t, e1.BitswapError)
+	require.Equal(t, failureBitswapError, e1.FailureMode)
+	require.True(t, e2.Success)
+
+	other, err := newEventPublisher(eventsConfig{KafkaRESTProxy: "http://localhost:8082", KafkaTopic: "checks", Anonymize: true})
+	require.NoError(t, err)
+	require.NotEqual(t, p.hash("peer"), other.hash("peer"), "a random salt is used without one")
+
+	// Events are dropped rather than blocking checks
+	for range eventQueueSize + 1 {
+		p.publish(checkRecord{})
+	}
+	require.Equal(t, 1.0, testutil.ToFloat64(p.events.WithLabelValues("dropped")))
+
+	p, err = newEventPublisher(eventsConfig{})
+	require.NoError(t, err)
+	require.Nil(t, p, "disabled without a bus")
+}
+
+func TestEventsConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Events.NATS = "nats://localhost:4222"
+	require.NoError(t, cfg.validate())
+	cfg.Events.NATS = "http://localhost:4222"
+	require.Error(t, cfg.validate())
+	cfg.Events.NATS = ""
+
+	cfg.Events.KafkaRESTProxy = "http://localhost:8082"
+	require.NoError(t, cfg.validate())
+	cfg.Events.KafkaTopic = ""
+	require.Error(t, cfg.validate())
+}
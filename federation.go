@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+)
+
+// extra time given to federated instances on top of the check timeout to
+// account for the HTTP round trip
+const federationTimeoutMargin = 5 * time.Second
+
+// federatedCheckOutput is the result of a check run from several ipfs-check
+// instances, the first vantage point being this instance
+type federatedCheckOutput struct {
+	VantagePoints []vantagePointOutput
+}
+
+type vantagePointOutput struct {
+	// URL is the ipfs-check backend the check ran on, empty for this instance
+	URL string
+	// Available is whether the data could be retrieved from this vantage point
+	Available bool
+	// Result is the output of the check, in the same format as a non-federated check
+	Result   interface{}
+	Error    string
+	Duration time.Duration
+	// CheckerInfo is the vantage point of the instance, nil if unknown, e.g.
+	// for instances too old to report it
+	CheckerInfo *check.CheckerInfoOutput
+}
+
+// checkAvailable returns whether the output of a CID or peer check shows the data is retrievable
+func checkAvailable(data interface{}) bool {
+	switch out := data.(type) {
+	case cidCheckOutput:
+		return cidCheckAvailable(out)
+	case *check.PeerCheckOutput:
+		return out.Available()
+	case *check.GatewayRetrievalOutput:
+		return out.Retrieved
+	case *check.PeerCIDsCheckOutput:
+		return out.ConnectionError == "" && out.Available == len(out.CIDs)
+	}
+	return false
+}
+
+// checkVantagePoints runs the check with the query parameters of the request
+// on every federated ipfs-check instance. query is modified. The instances
+// answer in JSON, the federated output being encoded in the format of the
+// request by this instance.
+func checkVantagePoints(ctx context.Context, urls []string, query url.Values, timeout time.Duration) []vantagePointOutput {
+	query.Del("federated") // don't let federated instances fan out again
+	query.Del(ownerTokenParam)
+	query.Del("format")
+	query.Set("timeoutSeconds", strconv.Itoa(int(timeout.Seconds())))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout+federationTimeoutMargin)
+	defer cancel()
+
+	out := make([]vantagePointOutput, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			start := time.Now()
+			out[i] = checkVantagePoint(ctx, u, query)
+			out[i].Duration = time.Since(start)
+		}(i, u)
+	}
+	wg.Wait()
+	return out
+}
+
+func checkVantagePoint(ctx context.Context, backendURL string, query url.Values) vantagePointOutput {
+	out := vantagePointOutput{URL: backendURL}
+
+	u := strings.TrimSuffix(backendURL, "/") + "/check?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		out.Error = fmt.Sprintf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return out
+	}
+
+	var info *check.CheckerInfoOutput
+	switch {
+	case query.Get("multiaddr") == "":
+		var provs []check.ProviderOutput
+		err = json.NewDecoder(resp.Body).Decode(&provs)
+		out.Result = cidCheckOutput(&provs)
+	case len(query["cid"]) > 1:
+		// Several CIDs checked against the peer at once
+		var peerCIDsOut check.PeerCIDsCheckOutput
+		err = json.NewDecoder(resp.Body).Decode(&peerCIDsOut)
+		out.Result, info = &peerCIDsOut, peerCIDsOut.CheckerInfo
+	default:
+		var peerOut check.PeerCheckOutput
+		err = json.NewDecoder(resp.Body).Decode(&peerOut)
+		out.Result, info = &peerOut, peerOut.CheckerInfo
+	}
+	if err != nil {
+		out.Result = nil
+		out.Error = fmt.Sprintf("invalid response: %s", err)
+		return out
+	}
+	out.Available = checkAvailable(out.Result)
+	out.CheckerInfo = info
+	if out.CheckerInfo == nil {
+		out.CheckerInfo = fetchCheckerInfo(ctx, backendURL)
+	}
+	return out
+}
+
+// fetchCheckerInfo returns the vantage point of a federated instance, nil if
+// it could not be fetched
+func fetchCheckerInfo(ctx context.Context, backendURL string) *check.CheckerInfoOutput {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(backendURL, "/")+"/checker", nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	var info check.CheckerInfoOutput
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil
+	}
+	return &info
+}
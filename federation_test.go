@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckVantagePoints(t *testing.T) {
+	var gotQuery url.Values
+	var gotAccept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/checker" {
+			_, _ = w.Write([]byte(`{"PeerID":"12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK","Addrs":["/ip4/1.2.3.4/tcp/4001"]}`))
+			return
+		}
+		gotQuery, gotAccept = r.URL.Query(), r.Header.Get("Accept")
+		_, _ = w.Write([]byte(`[{"ID":"12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK","ConnectionError":"","DataAvailableOverBitswap":{"Found":true,"Responded":true}}]`))
+	}))
+	defer srv.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "too many checks in progress", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	query := url.Values{"cid": []string{"bafkqaaa"}, "federated": []string{"true"}, "format": []string{"text"}}
+	out := checkVantagePoints(context.Background(), []string{srv.URL, failing.URL}, query, 10*time.Second)
+	require.Len(t, out, 2)
+
+	require.Empty(t, gotQuery.Get("federated"), "federated instances must not fan out again")
+	require.Equal(t, "10", gotQuery.Get("timeoutSeconds"))
+	require.False(t, gotQuery.Has("format"), "federated instances answer in JSON")
+	require.Equal(t, "application/json", gotAccept)
+
+	require.Equal(t, srv.URL, out[0].URL)
+	require.Empty(t, out[0].Error)
+	require.True(t, out[0].Available)
+	require.NotNil(t, out[0].CheckerInfo)
+	require.Equal(t, []string{"/ip4/1.2.3.4/tcp/4001"}, out[0].CheckerInfo.Addrs)
+
+	require.False(t, out[1].Available)
+	require.Contains(t, out[1].Error, "503")
+	require.Nil(t, out[1].CheckerInfo)
+}
+
+func TestCheckVantagePointsPeerCIDs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"PeerID":"12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK","Available":2,"CIDs":[{"CID":"bafkqaaa","DataAvailableOverBitswap":{"Found":true}},{"CID":"bafkqabi","DataAvailableOverBitswap":{"Found":true}}],"CheckerInfo":{"PeerID":"12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"}}`))
+	}))
+	defer srv.Close()
+
+	// Several CIDs checked against a peer get the output of such checks
+	query := url.Values{"cid": []string{"bafkqaaa", "bafkqabi"}, "multiaddr": []string{"/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"}}
+	out := checkVantagePoints(context.Background(), []string{srv.URL}, query, 10*time.Second)
+	require.Len(t, out, 1)
+	require.Empty(t, out[0].Error)
+	result, ok := out[0].Result.(*check.PeerCIDsCheckOutput)
+	require.True(t, ok, "%T", out[0].Result)
+	require.Len(t, result.CIDs, 2)
+	require.True(t, out[0].Available)
+	require.NotNil(t, out[0].CheckerInfo)
+}
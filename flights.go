@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// errCheckAborted is the error of the checks aborted through the admin API
+var errCheckAborted = errors.New("the check was aborted by an administrator")
+
+// checkFlights coalesces identical checks requested at the same time, e.g.
+// when a link to ipfs-check is shared publicly, into a single check whose
+// result is sent to every client. The check is aborted once all the clients
+// waiting for it went away.
+type checkFlights struct {
+	group singleflight.Group
+
+	mu      sync.Mutex
+	flights map[string]*checkFlight
+	lastID  uint64
+}
+
+type checkFlight struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	abort   context.CancelCauseFunc
+	waiters int
+	id      uint64
+	started time.Time
+}
+
+// inFlightCheck is a check running in the daemon, as listed by the admin API
+type inFlightCheck struct {
+	ID uint64
+	// Query is the query string identifying the check
+	Query   string
+	Started time.Time
+	// Waiters is the number of requests waiting for the result of the check
+	Waiters int
+}
+
+// do runs check for the first of the concurrent calls with the same key and
+// returns its result to all of them. The check runs with a timeout of its
+// own, as it outlives the ctx of the caller that started it when more
+// callers wait for it. shared is whether the result was sent to several
+// callers.
+func (f *checkFlights) do(ctx context.Context, key string, timeout time.Duration, check func(context.Context) (interface{}, error)) (data interface{}, shared bool, err error) {
+	f.mu.Lock()
+	if f.flights == nil {
+		f.flights = make(map[string]*checkFlight)
+	}
+	fl, ok := f.flights[key]
+	if !ok {
+		abortCtx, abort := context.WithCancelCause(context.WithoutCancel(ctx))
+		flightCtx, cancel := context.WithTimeout(abortCtx, timeout)
+		f.lastID++
+		fl = &checkFlight{ctx: flightCtx, cancel: cancel, abort: abort, id: f.lastID, started: time.Now()}
+		f.flights[key] = fl
+	}
+	fl.waiters++
+	f.mu.Unlock()
+
+	ch := f.group.DoChan(key, func() (interface{}, error) {
+		data, err := check(fl.ctx)
+		if context.Cause(fl.ctx) == errCheckAborted {
+			// Do not pass the partial result off as the result of the check
+			return nil, errCheckAborted
+		}
+		return data, err
+	})
+	select {
+	case res := <-ch:
+		f.leave(key, fl)
+		return res.Val, res.Shared, res.Err
+	case <-ctx.Done():
+		f.leave(key, fl)
+		return nil, false, ctx.Err()
+	}
+}
+
+// leave removes a caller of the flight, aborting the check when it was the
+// last one waiting for it
+func (f *checkFlights) leave(key string, fl *checkFlight) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fl.waiters--
+	if fl.waiters > 0 {
+		return
+	}
+	fl.cancel()
+	fl.abort(nil)
+	if f.flights[key] == fl {
+		delete(f.flights, key)
+	}
+	// Later callers start a new check rather than joining an aborted one
+	f.group.Forget(key)
+}
+
+// list returns the checks in flight, oldest first
+func (f *checkFlights) list() []inFlightCheck {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]inFlightCheck, 0, len(f.flights))
+	for key, fl := range f.flights {
+		out = append(out, inFlightCheck{ID: fl.id, Query: key, Started: fl.started, Waiters: fl.waiters})
+	}
+	slices.SortFunc(out, func(a, b inFlightCheck) int { return cmp.Compare(a.ID, b.ID) })
+	return out
+}
+
+// abort aborts the check in flight with the given ID, its callers getting
+// errCheckAborted. It returns false if there is no such check.
+func (f *checkFlights) abort(id uint64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, fl := range f.flights {
+		if fl.id != id {
+			continue
+		}
+		fl.abort(errCheckAborted)
+		delete(f.flights, key)
+		f.group.Forget(key)
+		return true
+	}
+	return false
+}
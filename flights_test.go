@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFlights(t *testing.T) {
+	var f checkFlights
+	var runs atomic.Int32
+	release := make(chan struct{})
+	check := func(ctx context.Context) (interface{}, error) {
+		runs.Add(1)
+		select {
+		case <-release:
+			return "result", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// Concurrent identical checks share a single run, which outlives the
+	// client that started it
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		_, _, err := f.do(firstCtx, "key", time.Minute, check)
+		firstDone <- err
+	}()
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 3)
+	shared := make([]bool, 3)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			results[i], shared[i], err = f.do(context.Background(), "key", time.Minute, check)
+			require.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.flights["key"].waiters == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	cancelFirst()
+	require.ErrorIs(t, <-firstDone, context.Canceled)
+	close(release)
+	wg.Wait()
+	require.EqualValues(t, 1, runs.Load())
+	for i := range results {
+		require.Equal(t, "result", results[i])
+		require.True(t, shared[i])
+	}
+
+	// The check is aborted once all its clients went away
+	aborted := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, _, _ = f.do(ctx, "other", time.Minute, func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			close(aborted)
+			return nil, ctx.Err()
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the check was not aborted")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+// The formats responses can be returned in, picked with the format query
+// parameter or the Accept header
+const (
+	formatJSON    = "json"
+	formatNDJSON  = "ndjson"
+	formatDAGJSON = "dag-json"
+	formatDAGCBOR = "dag-cbor"
+	formatText    = "text"
+	// formatKuboPeering is only available for the providers of CID checks
+	formatKuboPeering = "kubo-peering"
+)
+
+// responseFormats are the formats of responses with their media type, the
+// first being the default
+var responseFormats = []struct {
+	name      string
+	mediaType string
+}{
+	{formatJSON, "application/json"},
+	{formatNDJSON, "application/x-ndjson"},
+	{formatDAGJSON, "application/vnd.ipld.dag-json"},
+	{formatDAGCBOR, "application/vnd.ipld.dag-cbor"},
+	{formatText, "text/plain; charset=utf-8"},
+	{formatKuboPeering, "application/json"},
+}
+
+// acceptedMediaTypes maps the media types of the Accept header to formats
+var acceptedMediaTypes = map[string]string{
+	"application/json":              formatJSON,
+	"application/x-ndjson":          formatNDJSON,
+	"application/vnd.ipld.dag-json": formatDAGJSON,
+	"application/vnd.ipld.dag-cbor": formatDAGCBOR,
+	"application/cbor":              formatDAGCBOR,
+	"text/plain":                    formatText,
+}
+
+func formatNames() []string {
+	names := make([]string, len(responseFormats))
+	for i, f := range responseFormats {
+		names[i] = f.name
+	}
+	return names
+}
+
+// responseFormat returns the format of the response to r: the one of the
+// format query parameter, else the preferred one of the Accept header that is
+// supported, JSON by default
+func responseFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if f == "cbor" {
+			return formatDAGCBOR, nil
+		}
+		if !slices.Contains(formatNames(), f) {
+			return "", fmt.Errorf("Invalid format value (%s)", strings.Join(formatNames(), ", "))
+		}
+		return f, nil
+	}
+
+	best, bestQ := formatJSON, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		f, ok := acceptedMediaTypes[mediaType]
+		if mediaType == "*/*" || mediaType == "application/*" {
+			f, ok = formatJSON, true
+		}
+		if ok && q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best, nil
+}
+
+// writeResponse writes data in the format negotiated with r. Invalid format
+// query parameters are answered with an error.
+func writeResponse(w http.ResponseWriter, r *http.Request, data interface{}) {
+	writeResponseStatus(w, r, http.StatusOK, data)
+}
+
+// writeResponseStatus is writeResponse with another status than 200
+func writeResponseStatus(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	format, err := responseFormat(r)
+	if err != nil {
+		writeInvalidParam(w, "format", err.Error())
+		return
+	}
+	body, err := encodeResponse(data, format)
+	if errors.Is(err, errNotProviders) {
+		writeInvalidParam(w, "format", err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+		return
+	}
+	for _, f := range responseFormats {
+		if f.name == format {
+			w.Header().Set("Content-Type", f.mediaType)
+		}
+	}
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// encodeResponse encodes data in format
+func encodeResponse(data interface{}, format string) ([]byte, error) {
+	switch format {
+	case formatNDJSON:
+		return encodeNDJSON(data)
+	case formatDAGJSON, formatDAGCBOR:
+		return encodeDAG(data, format)
+	case formatText:
+		return []byte(formatTextOutput(data)), nil
+	case formatKuboPeering:
+		return encodeKuboPeering(data)
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(data)
+	return buf.Bytes(), err
+}
+
+// encodeNDJSON encodes each element of data on its own line if it is a list,
+// e.g. the providers of a CID check, and data on a single line otherwise
+func encodeNDJSON(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		err := enc.Encode(data)
+		return buf.Bytes(), err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := enc.Encode(v.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeDAG encodes data as DAG-JSON or DAG-CBOR, with the fields of its JSON
+// encoding
+func encodeDAG(data interface{}, format string) ([]byte, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagjson.Decode(nb, bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("converting the response to %s: %w", format, err)
+	}
+	var buf bytes.Buffer
+	if format == formatDAGCBOR {
+		err = dagcbor.Encode(nb.Build(), &buf)
+	} else {
+		err = dagjson.Encode(nb.Build(), &buf)
+	}
+	return buf.Bytes(), err
+}
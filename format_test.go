@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseFormat(t *testing.T) {
+	for _, tc := range []struct {
+		query, accept, format string
+	}{
+		{"", "", formatJSON},
+		{"", "*/*", formatJSON},
+		{"", "text/html, application/xml", formatJSON},
+		{"", "text/plain", formatText},
+		{"", "application/cbor", formatDAGCBOR},
+		{"", "application/x-ndjson;q=0.5, application/vnd.ipld.dag-json", formatDAGJSON},
+		{"", "application/json;q=0.8, text/plain;q=0.9", formatText},
+		{"", "text/plain;q=0.1, */*", formatJSON},
+		{"ndjson", "text/plain", formatNDJSON},
+		{"cbor", "", formatDAGCBOR},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/check?format="+tc.query, nil)
+		r.Header.Set("Accept", tc.accept)
+		format, err := responseFormat(r)
+		require.NoError(t, err)
+		require.Equal(t, tc.format, format, "format=%s, Accept: %s", tc.query, tc.accept)
+	}
+
+	_, err := responseFormat(httptest.NewRequest(http.MethodGet, "/check?format=xml", nil))
+	require.Error(t, err)
+}
+
+func TestEncodeResponse(t *testing.T) {
+	providers := []check.ProviderOutput{
+		{ID: "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK", Source: "IPNI", ConnectionMaddrs: []string{"/ip4/1.2.3.4/tcp/4001"},
+			DataAvailableOverBitswap: check.BitswapCheckOutput{Found: true, Duration: 12 * time.Millisecond}},
+		{ID: "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5", Source: "Amino DHT", ConnectionError: "failed to dial"},
+	}
+	data := cidCheckOutput(&providers)
+
+	ndjson, err := encodeResponse(data, formatNDJSON)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(ndjson)), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[1], `"ConnectionError":"failed to dial"`)
+
+	cbor, err := encodeResponse(data, formatDAGCBOR)
+	require.NoError(t, err)
+	nb := basicnode.Prototype.Any.NewBuilder()
+	require.NoError(t, dagcbor.Decode(nb, bytes.NewReader(cbor)))
+	require.Equal(t, int64(2), nb.Build().Length())
+
+	text, err := encodeResponse(data, formatText)
+	require.NoError(t, err)
+	require.Equal(t, `2 providers found, 1 serving the data
+
+12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK (IPNI)
+  Connection: ok (/ip4/1.2.3.4/tcp/4001)
+  Bitswap: found (12ms)
+
+12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5 (Amino DHT)
+  Connection: failed: failed to dial
+`, string(text))
+
+	verdict := withVerdict(data)
+	require.NoError(t, validateResponse(verdict))
+	require.Equal(t, check.VerdictAvailable, verdict.Verdict.Verdict)
+	text, err = encodeResponse(verdict, formatText)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(text), "Verdict: available\n1 of the 2 providers found serve the data\n\n2 providers found, 1 serving the data\n"), string(text))
+
+	// Results without a text summary are returned as YAML
+	text, err = encodeResponse(&check.DNSResolutionOutput{Addr: "/dns4/example.com/tcp/4001"}, formatText)
+	require.NoError(t, err)
+	require.Contains(t, string(text), "Addr: /dns4/example.com/tcp/4001\n")
+}
+
+func TestEncodeKuboPeering(t *testing.T) {
+	providers := []check.ProviderOutput{
+		{ID: "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK", ConnectionMaddrs: []string{"/ip4/1.2.3.4/tcp/4001"},
+			Addrs: []string{
+				"/ip4/1.2.3.4/tcp/4001/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK",
+				"/ip4/1.2.3.4/udp/4001/quic-v1",
+				"/ip4/5.6.7.8/tcp/4001/p2p/12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5/p2p-circuit",
+			},
+			DataAvailableOverBitswap: check.BitswapCheckOutput{Found: true}},
+		{ID: "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5", ConnectionError: "failed to dial"},
+	}
+	out, err := encodeResponse(cidCheckOutput(&providers), formatKuboPeering)
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"ID": "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK", "Addrs": ["/ip4/1.2.3.4/tcp/4001", "/ip4/1.2.3.4/udp/4001/quic-v1"]}]`, string(out))
+
+	withVerdictOut, err := encodeResponse(withVerdict(&providers), formatKuboPeering)
+	require.NoError(t, err)
+	require.JSONEq(t, string(out), string(withVerdictOut))
+
+	none, err := encodeResponse(cidCheckOutput(&[]check.ProviderOutput{}), formatKuboPeering)
+	require.NoError(t, err)
+	require.JSONEq(t, `[]`, string(none))
+
+	_, err = encodeResponse(&check.PeerCheckOutput{}, formatKuboPeering)
+	require.ErrorIs(t, err, errNotProviders)
+}
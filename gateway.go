@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+// parseContentPath parses the cid query parameter, which is either a CID or
+// multihash, an /ipfs/ or ipfs:// content path, or the URL of a path
+// (https://ipfs.io/ipfs/<cid>/...) or subdomain (https://<cid>.ipfs.dweb.link/...)
+// gateway. It returns the root CID, the multibase it was passed in and the
+// segments of the path under it.
+func parseContentPath(s string) (cid.Cid, string, []string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "/ipfs/"):
+		return parseRootAndPath(strings.TrimPrefix(s, "/ipfs/"))
+	case strings.HasPrefix(s, "ipfs://"):
+		return parseRootAndPath(strings.TrimPrefix(s, "ipfs://"))
+	case strings.HasPrefix(s, "/ipns/"), strings.HasPrefix(s, "ipns://"):
+		return cid.Undef, "", nil, errors.New("IPNS names are not supported, pass the /ipfs/ path they resolve to")
+	case strings.HasPrefix(s, "http://"), strings.HasPrefix(s, "https://"):
+		u, err := url.Parse(s)
+		if err != nil {
+			return cid.Undef, "", nil, err
+		}
+		if root, _, ok := strings.Cut(u.Hostname(), ".ipfs."); ok {
+			return parseRootAndPath(root + u.Path)
+		}
+		if p, ok := strings.CutPrefix(u.Path, "/ipfs/"); ok {
+			return parseRootAndPath(p)
+		}
+		return cid.Undef, "", nil, fmt.Errorf("%s is not the URL of a path or subdomain gateway", s)
+	default:
+		c, mb, err := parseCid(s)
+		return c, mb, nil, err
+	}
+}
+
+// parseRootAndPath parses a <cid>/<path> string
+func parseRootAndPath(s string) (cid.Cid, string, []string, error) {
+	root, p, _ := strings.Cut(s, "/")
+	c, mb, err := parseCid(root)
+	if err != nil {
+		return cid.Undef, "", nil, err
+	}
+	var segments []string
+	for _, seg := range strings.Split(p, "/") {
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	return c, mb, segments, nil
+}
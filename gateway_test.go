@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContentPath(t *testing.T) {
+	const root = "bafybeicklkqcnlvtiscr2hzkubjwnwjinvskffn4xorqeduft3wq7vm5u4"
+
+	for _, tc := range []struct {
+		input    string
+		segments []string
+	}{
+		{input: root},
+		{input: "/ipfs/" + root},
+		{input: "/ipfs/" + root + "/a/b/c.png", segments: []string{"a", "b", "c.png"}},
+		{input: "ipfs://" + root + "/a/", segments: []string{"a"}},
+		{input: "https://ipfs.io/ipfs/" + root + "/a/b%20c.png?filename=x", segments: []string{"a", "b c.png"}},
+		{input: "https://" + root + ".ipfs.dweb.link/a/b", segments: []string{"a", "b"}},
+		{input: "http://" + root + ".ipfs.localhost:8080/", segments: nil},
+	} {
+		c, mb, segments, err := parseContentPath(tc.input)
+		require.NoError(t, err, tc.input)
+		require.Equal(t, root, c.String(), tc.input)
+		require.Equal(t, tc.segments, segments, tc.input)
+		require.Equal(t, "base32", mb, tc.input)
+	}
+
+	for _, input := range []string{
+		"/ipns/example.com/a",
+		"https://example.com/a/b",
+		"https://ipfs.io/ipfs/notacid/a",
+	} {
+		_, _, _, err := parseContentPath(input)
+		require.Error(t, err, input)
+	}
+
+	_, _, _, err := parseContentPath("bafynotacid")
+	require.ErrorContains(t, err, "bafynotacid is neither a CID nor a multihash")
+}
+
+func TestIPNSName(t *testing.T) {
+	const key = "k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8"
+	for _, input := range []string{"/ipns/" + key, "ipns://" + key + "/a/b", " /ipns/" + key + "/"} {
+		name, ok := ipnsName(input)
+		require.True(t, ok, input)
+		require.Equal(t, key, name, input)
+	}
+	_, ok := ipnsName("/ipfs/" + key)
+	require.False(t, ok)
+}
+
+func TestParseCid(t *testing.T) {
+	v0 := cid.MustParse("QmcRD4wkPPi6dig81r5sLj9Zm1gDCL4zgpEj9CfuRrGbzF")
+	v1 := cid.NewCidV1(cid.DagProtobuf, v0.Hash())
+	raw := cid.NewCidV1(cid.Raw, v0.Hash())
+	base36, err := v1.StringOfBase(multibase.Base36)
+	require.NoError(t, err)
+	blake3, err := multihash.Sum([]byte(t.Name()), multihash.BLAKE3, -1)
+	require.NoError(t, err)
+	mhBase64, err := multibase.Encode(multibase.Base64, blake3)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		input     string
+		cid       cid.Cid
+		multibase string
+	}{
+		{v0.String(), v0, "base58btc"},
+		{v1.String(), v1, "base32"},
+		{base36, v1, "base36"},
+		{v0.Hash().HexString(), raw, "base16"},
+		{mhBase64, cid.NewCidV1(cid.Raw, blake3), "base64"},
+	} {
+		c, mb, err := parseCid(tc.input)
+		require.NoError(t, err, tc.input)
+		require.Equal(t, tc.cid, c, tc.input)
+		require.Equal(t, tc.multibase, mb, tc.input)
+	}
+}
+
+func TestParsePeerCIDs(t *testing.T) {
+	const a, b = "bafkreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy", "bafybeicklkqcnlvtiscr2hzkubjwnwjinvskffn4xorqeduft3wq7vm5u4"
+	cids, err := parsePeerCIDs([]string{a, "/ipfs/" + b})
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{cid.MustParse(a), cid.MustParse(b)}, cids)
+
+	_, err = parsePeerCIDs([]string{a, a})
+	require.Error(t, err, "duplicates")
+	_, err = parsePeerCIDs([]string{a, "/ipfs/" + b + "/index.html"})
+	require.Error(t, err, "paths")
+	tooMany := make([]string, check.MaxPeerCIDs+1)
+	for i := range tooMany {
+		tooMany[i] = a
+	}
+	_, err = parsePeerCIDs(tooMany)
+	require.Error(t, err)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Failure modes of a check of a peer, as reported by the stats endpoint
+const (
+	failureConnection        = "connection-failed"
+	failureBitswapError      = "bitswap-error"
+	failureBitswapNoResponse = "bitswap-no-response"
+	failureBlockNotFound     = "block-not-found"
+)
+
+// checkRecord is the outcome of checking a single peer, persisted one JSON
+// object per line in the history file
+type checkRecord struct {
+	Time            time.Time
+	PeerID          string
+	CID             string
+	ConnectionError string
+	Responded       bool
+	Found           bool
+	BitswapDuration time.Duration
+	BitswapError    string
+}
+
+func (r checkRecord) success() bool {
+	return r.ConnectionError == "" && r.Found
+}
+
+func (r checkRecord) failureMode() string {
+	switch {
+	case r.ConnectionError != "":
+		return failureConnection
+	case r.BitswapError != "":
+		return failureBitswapError
+	case !r.Responded:
+		return failureBitswapNoResponse
+	case !r.Found:
+		return failureBlockNotFound
+	}
+	return ""
+}
+
+// checkHistory keeps the results of the checks of every peer for a retention
+// period, in memory and appended to a file so they survive restarts. Expired
+// records are dropped from the file when it is opened, and every hour.
+type checkHistory struct {
+	mu        sync.Mutex
+	path      string
+	f         *os.File
+	retention time.Duration
+	records   map[string][]checkRecord
+	lastSweep time.Time
+}
+
+func openCheckHistory(path string, retention time.Duration) (*checkHistory, error) {
+	h := &checkHistory{
+		path:      path,
+		retention: retention,
+		records:   make(map[string][]checkRecord),
+		lastSweep: time.Now(),
+	}
+
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		cutoff := time.Now().Add(-retention)
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			var r checkRecord
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				// e.g. the last line cut short by a crash, which must not
+				// keep the daemon from starting
+				log.Printf("Skipping line %d of history file %s: %v\n", line, path, err)
+				continue
+			}
+			if r.Time.After(cutoff) {
+				h.records[r.PeerID] = append(h.records[r.PeerID], r)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("reading history file %s: %w", path, err)
+		}
+	}
+
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// compact rewrites the history file with the records in memory, without the
+// expired records and the lines that could not be parsed, and reopens it for
+// appending. h.mu must be held once h is shared.
+func (h *checkHistory) compact() error {
+	var recs []checkRecord
+	for _, peerRecs := range h.records {
+		recs = append(recs, peerRecs...)
+	}
+	slices.SortFunc(recs, func(a, b checkRecord) int { return a.Time.Compare(b.Time) })
+
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(tmp)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if h.f != nil {
+		h.f.Close()
+	}
+	h.f = f
+	return nil
+}
+
+// record adds the outcome of a check to the history, at the current time
+func (h *checkHistory) record(r checkRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Taking the time with the lock held keeps the records sorted
+	r.Time = time.Now()
+
+	if err := json.NewEncoder(h.f).Encode(r); err != nil {
+		log.Printf("Error writing check history: %v\n", err)
+	}
+
+	cutoff := r.Time.Add(-h.retention)
+	h.records[r.PeerID] = append(pruneRecords(h.records[r.PeerID], cutoff), r)
+
+	// Forget peers that have not been checked during the retention period,
+	// and drop the expired records from the file, which would otherwise grow
+	// forever
+	if r.Time.Sub(h.lastSweep) > time.Hour {
+		for p, recs := range h.records {
+			if recs = pruneRecords(recs, cutoff); len(recs) == 0 {
+				delete(h.records, p)
+			} else {
+				h.records[p] = recs
+			}
+		}
+		if err := h.compact(); err != nil {
+			log.Printf("Error compacting check history: %v\n", err)
+		}
+		h.lastSweep = r.Time
+	}
+}
+
+// pruneRecords drops the records older than cutoff, records are sorted by time
+func pruneRecords(recs []checkRecord, cutoff time.Time) []checkRecord {
+	i := 0
+	for i < len(recs) && !recs[i].Time.After(cutoff) {
+		i++
+	}
+	return recs[i:]
+}
+
+func (h *checkHistory) close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.f.Close()
+}
+
+// peerStats summarizes the checks of a peer during the retention period
+type peerStats struct {
+	PeerID      string
+	Checks      int
+	Successes   int
+	SuccessRate float64
+	// AverageBitswapDuration is the average duration of the Bitswap checks of
+	// the peer, over the checks in which it could be connected to
+	AverageBitswapDuration time.Duration
+	// FailureModes counts the failed checks by failure mode
+	FailureModes map[string]int
+	FirstCheck   time.Time
+	LastCheck    time.Time
+}
+
+func (h *checkHistory) peerStats(p peer.ID) peerStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recs := pruneRecords(h.records[p.String()], time.Now().Add(-h.retention))
+	stats := peerStats{
+		PeerID:       p.String(),
+		Checks:       len(recs),
+		FailureModes: make(map[string]int),
+	}
+	if len(recs) == 0 {
+		return stats
+	}
+	stats.FirstCheck = recs[0].Time
+	stats.LastCheck = recs[len(recs)-1].Time
+
+	var bitswapTotal time.Duration
+	var bitswapChecks int
+	for _, r := range recs {
+		if r.success() {
+			stats.Successes++
+		} else {
+			stats.FailureModes[r.failureMode()]++
+		}
+		if r.ConnectionError == "" {
+			bitswapTotal += r.BitswapDuration
+			bitswapChecks++
+		}
+	}
+	stats.SuccessRate = float64(stats.Successes) / float64(stats.Checks)
+	if bitswapChecks > 0 {
+		stats.AverageBitswapDuration = bitswapTotal / time.Duration(bitswapChecks)
+	}
+	return stats
+}
+
+// aggregateStats summarizes the checks of all the peers during the retention
+// period, per day, without the peers and the CIDs
+type aggregateStats struct {
+	Retention time.Duration
+	// Days are sorted by date, only the days with checks are included
+	Days []dayStats
+}
+
+// dayStats summarizes the checks of a UTC day
+type dayStats struct {
+	// Date is formatted as 2006-01-02
+	Date        string
+	Checks      int
+	Successes   int
+	SuccessRate float64
+	// FailureModes counts the failed checks by failure mode, and FailureRates
+	// are their shares of the checks
+	FailureModes map[string]int
+	FailureRates map[string]float64
+	// MedianBitswapDuration is the median duration of the Bitswap checks, over
+	// the checks in which the peer could be connected to
+	MedianBitswapDuration time.Duration
+}
+
+func (h *checkHistory) aggregateStats() aggregateStats {
+	h.mu.Lock()
+	cutoff := time.Now().Add(-h.retention)
+	days := make(map[string]*dayStats)
+	durations := make(map[string][]time.Duration)
+	for _, recs := range h.records {
+		for _, r := range pruneRecords(recs, cutoff) {
+			date := r.Time.UTC().Format(time.DateOnly)
+			day := days[date]
+			if day == nil {
+				day = &dayStats{Date: date, FailureModes: make(map[string]int), FailureRates: make(map[string]float64)}
+				days[date] = day
+			}
+			day.Checks++
+			if r.success() {
+				day.Successes++
+			} else {
+				day.FailureModes[r.failureMode()]++
+			}
+			if r.ConnectionError == "" {
+				durations[date] = append(durations[date], r.BitswapDuration)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	stats := aggregateStats{Retention: h.retention, Days: make([]dayStats, 0, len(days))}
+	for date, day := range days {
+		day.SuccessRate = float64(day.Successes) / float64(day.Checks)
+		for mode, n := range day.FailureModes {
+			day.FailureRates[mode] = float64(n) / float64(day.Checks)
+		}
+		day.MedianBitswapDuration = medianDuration(durations[date])
+		stats.Days = append(stats.Days, *day)
+	}
+	slices.SortFunc(stats.Days, func(a, b dayStats) int { return strings.Compare(a.Date, b.Date) })
+	return stats
+}
+
+// medianDuration returns the median of ds, which it sorts, 0 if empty
+func medianDuration(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	slices.Sort(ds)
+	if len(ds)%2 == 0 {
+		return (ds[len(ds)/2-1] + ds[len(ds)/2]) / 2
+	}
+	return ds[len(ds)/2]
+}
+
+// recordCheck adds a check of peer p to the history and publishes its event,
+// if they are enabled. Checks cut short by the check timeout or a shutdown are
+// not recorded as they say nothing about the peer.
+func (d *daemon) recordCheck(ctx context.Context, peerID string, c cid.Cid, connectionError string, bs check.BitswapCheckOutput) {
+	if (d.history == nil && d.events == nil) || ctx.Err() != nil {
+		return
+	}
+	r := checkRecord{
+		Time:            time.Now(),
+		PeerID:          peerID,
+		CID:             c.String(),
+		ConnectionError: connectionError,
+		Responded:       bs.Responded,
+		Found:           bs.Found,
+		BitswapDuration: bs.Duration,
+		BitswapError:    bs.Error,
+	}
+	if d.history != nil {
+		d.history.record(r)
+	}
+	if d.events != nil {
+		d.events.publish(r)
+	}
+}
+
+// aggregateStatsHandler serves GET /stats/aggregate
+func (h *checkHistory) aggregateStatsHandler(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, h.aggregateStats())
+}
+
+// peerStatsHandler serves GET /stats/peer/{peerID}
+func (h *checkHistory) peerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := peer.Decode(r.PathValue("peerID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error(), map[string]string{"parameter": "peerID"})
+		return
+	}
+	writeResponse(w, r, h.peerStats(p))
+}
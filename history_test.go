@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHistory(t *testing.T) {
+	p, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	// An expired record is dropped when the file is opened
+	expired, err := json.Marshal(checkRecord{Time: time.Now().Add(-2 * time.Hour), PeerID: p.String(), Found: true})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, append(expired, '\n'), 0o644))
+
+	h, err := openCheckHistory(path, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 0, h.peerStats(p).Checks)
+
+	h.record(checkRecord{PeerID: p.String(), Responded: true, Found: true, BitswapDuration: time.Second})
+	h.record(checkRecord{PeerID: p.String(), Responded: true, BitswapDuration: 3 * time.Second})
+	h.record(checkRecord{PeerID: p.String(), ConnectionError: "failed to dial"})
+	require.NoError(t, h.close())
+
+	// Records survive reopening the file
+	h, err = openCheckHistory(path, time.Hour)
+	require.NoError(t, err)
+	defer h.close()
+
+	stats := h.peerStats(p)
+	require.Equal(t, 3, stats.Checks)
+	require.Equal(t, 1, stats.Successes)
+	require.InDelta(t, 1.0/3, stats.SuccessRate, 0.001)
+	require.Equal(t, 2*time.Second, stats.AverageBitswapDuration)
+	require.Equal(t, map[string]int{failureBlockNotFound: 1, failureConnection: 1}, stats.FailureModes)
+}
+
+func TestCheckHistoryInvalidLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	valid, err := json.Marshal(checkRecord{Time: time.Now(), PeerID: "a", Found: true})
+	require.NoError(t, err)
+	// A line that is not JSON, and a last line cut short by a crash
+	content := string(valid) + "\nnot json\n" + string(valid[:len(valid)/2])
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	h, err := openCheckHistory(path, time.Hour)
+	require.NoError(t, err)
+	defer h.close()
+	require.Len(t, h.records["a"], 1)
+
+	// The invalid lines are dropped from the file
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(valid)+"\n", string(b))
+}
+
+func TestCheckHistoryCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	old, err := json.Marshal(checkRecord{Time: time.Now().Add(-30 * time.Minute), PeerID: "a", Found: true})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, append(old, '\n'), 0o644))
+
+	h, err := openCheckHistory(path, time.Hour)
+	require.NoError(t, err)
+	defer h.close()
+
+	// The record of a expires, and the hourly sweep is due
+	h.retention = 10 * time.Minute
+	h.lastSweep = time.Now().Add(-2 * time.Hour)
+	h.record(checkRecord{PeerID: "b", Found: true})
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 1)
+	var r checkRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &r))
+	require.Equal(t, "b", r.PeerID)
+
+	// Records are still appended to the compacted file
+	h.record(checkRecord{PeerID: "c", Found: true})
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(string(b)), "\n"), 2)
+}
+
+func TestAggregateStats(t *testing.T) {
+	h, err := openCheckHistory(filepath.Join(t.TempDir(), "history.jsonl"), 72*time.Hour)
+	require.NoError(t, err)
+	defer h.close()
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	h.records["a"] = []checkRecord{{Time: yesterday, PeerID: "a", CID: "x", ConnectionError: "failed to dial"}}
+	h.record(checkRecord{PeerID: "a", CID: "x", Responded: true, Found: true, BitswapDuration: time.Second})
+	h.record(checkRecord{PeerID: "b", CID: "y", Responded: true, Found: true, BitswapDuration: 2 * time.Second})
+	h.record(checkRecord{PeerID: "b", CID: "z", Responded: true, BitswapDuration: 5 * time.Second})
+	h.record(checkRecord{PeerID: "c", CID: "z", ConnectionError: "failed to dial"})
+
+	stats := h.aggregateStats()
+	require.Equal(t, 72*time.Hour, stats.Retention)
+	require.Len(t, stats.Days, 2)
+	require.Equal(t, yesterday.UTC().Format(time.DateOnly), stats.Days[0].Date)
+	require.Equal(t, 1, stats.Days[0].Checks)
+	require.Equal(t, map[string]int{failureConnection: 1}, stats.Days[0].FailureModes)
+
+	today := stats.Days[1]
+	require.Equal(t, time.Now().UTC().Format(time.DateOnly), today.Date)
+	require.Equal(t, 4, today.Checks)
+	require.Equal(t, 2, today.Successes)
+	require.Equal(t, 0.5, today.SuccessRate)
+	require.Equal(t, map[string]int{failureConnection: 1, failureBlockNotFound: 1}, today.FailureModes)
+	require.Equal(t, map[string]float64{failureConnection: 0.25, failureBlockNotFound: 0.25}, today.FailureRates)
+	require.Equal(t, 2*time.Second, today.MedianBitswapDuration)
+
+	// Nothing identifies the peers or the CIDs
+	out, err := json.Marshal(stats)
+	require.NoError(t, err)
+	require.NotContains(t, string(out), `"x"`)
+	require.NotContains(t, string(out), `"a"`)
+}
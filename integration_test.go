@@ -1,18 +1,34 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gavv/httpexpect/v2"
 	bsnet "github.com/ipfs/boxo/bitswap/network"
 	bsserver "github.com/ipfs/boxo/bitswap/server"
 	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
 	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/ipfs-check/pkg/check"
 	"github.com/ipfs/ipfs-check/test"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	mplex "github.com/libp2p/go-libp2p-mplex"
@@ -21,8 +37,10 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 )
@@ -32,7 +50,6 @@ func TestBasicIntegration(t *testing.T) {
 	defer cancel()
 
 	testDHTPrefix := protocol.TestingID
-	testDHTID := protocol.TestingID + "/kad/1.0.0"
 
 	dhtHost, err := libp2p.New()
 	require.NoError(t, err)
@@ -41,8 +58,21 @@ func TestBasicIntegration(t *testing.T) {
 	require.NoError(t, err)
 	defer dhtServer.Close()
 
+	// The checker refuses to check deniedCid and to dial deniedHost
+	deniedHost, err := libp2p.New()
+	require.NoError(t, err)
+	defer deniedHost.Close()
+	deniedMh, err := multihash.Sum([]byte("denied"), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	deniedCid := cid.NewCidV1(cid.Raw, deniedMh)
+	cidDenylist := filepath.Join(t.TempDir(), "denylist.txt")
+	require.NoError(t, os.WriteFile(cidDenylist, []byte("/ipfs/"+deniedCid.String()+"\n"), 0o644))
+	denylist, err := check.NewDenylist([]string{deniedHost.ID().String()}, nil, nil, []string{cidDenylist})
+	require.NoError(t, err)
+
+	daemons := make(chan *daemon, 1)
 	go func() {
-		rm, err := NewResourceManager()
+		rm, err := check.NewResourceManager(check.ResourceLimits{})
 		require.NoError(t, err)
 
 		c, err := connmgr.NewConnManager(600, 900, connmgr.WithGracePeriod(time.Second*30))
@@ -57,25 +87,42 @@ func TestBasicIntegration(t *testing.T) {
 		)
 		require.NoError(t, err)
 
-		pm, err := dhtProtocolMessenger(testDHTID, queryHost)
-		require.NoError(t, err)
 		queryDHT, err := dht.New(ctx, queryHost, dht.ProtocolPrefix(testDHTPrefix), dht.BootstrapPeers(peer.AddrInfo{ID: dhtHost.ID(), Addrs: dhtHost.Addrs()}))
 		require.NoError(t, err)
 
-		d := &daemon{
-			promRegistry: prometheus.NewRegistry(),
-			h:            queryHost,
-			dht:          queryDHT,
-			dhtMessenger: pm,
-			createTestHost: func() (host.Host, error) {
+		checker, err := check.New(ctx, check.Config{
+			Host:              queryHost,
+			DHT:               queryDHT,
+			DHTProtocolPrefix: testDHTPrefix,
+			BootstrapPeers:    []peer.AddrInfo{{ID: dhtHost.ID(), Addrs: dhtHost.Addrs()}},
+			NewTestHost: func() (host.Host, error) {
 				return libp2p.New(libp2p.DefaultMuxers,
 					libp2p.Muxer(mplex.ID, mplex.DefaultTransport),
 					libp2p.EnableHolePunching())
 			},
+			NewIsolatedHost: func() (host.Host, error) {
+				return libp2p.New(libp2p.NoListenAddrs, libp2p.DefaultMuxers,
+					libp2p.Muxer(mplex.ID, mplex.DefaultTransport))
+			},
+			Denylist: denylist,
+			// The test peers and services listen on loopback addresses
+			AddrPolicy: &check.AddrPolicy{AllowPrivate: true},
+		})
+		require.NoError(t, err)
+
+		d := &daemon{
+			promRegistry:      prometheus.NewRegistry(),
+			checker:           checker,
+			validateResponses: true,
+			routers:           newRouterFailover(),
 		}
-		_ = startServer(ctx, d, ":1234", "", "")
+		d.provideTest = newProvideTester(d)
+		daemons <- d
+		_ = startServer(ctx, d, ":1234", tlsOptions{}, "", "", 0)
 	}()
 
+	d := <-daemons
+
 	h, err := libp2p.New()
 	require.NoError(t, err)
 	defer h.Close()
@@ -101,6 +148,45 @@ func TestBasicIntegration(t *testing.T) {
 	require.NoError(t, err)
 	hostAddr := mas[0]
 
+	t.Run("DHT status", func(t *testing.T) {
+		status := httpexpect.Default(t, "http://localhost:1234").GET("/dht/status").
+			Expect().
+			Status(http.StatusOK).
+			JSON().Object()
+		status.Value("Ready").Boolean().IsTrue()
+		status.Value("Accelerated").Boolean().IsFalse()
+		status.Value("Routing").String().IsEqual(check.StandardDHTRouting)
+		status.Value("Crawl").IsNull()
+	})
+
+	t.Run("Provide test", func(t *testing.T) {
+		e := httpexpect.Default(t, "http://localhost:1234")
+		res := e.POST("/dht/provide-test").
+			Expect().
+			Status(http.StatusOK).
+			JSON().Object()
+		res.Value("Error").String().IsEmpty()
+		res.Value("Retrievable").Boolean().IsTrue()
+		res.Value("Propagation").Object().Value("Holders").Array().ContainsOnly(dhtHost.ID().String())
+
+		// Recent results are served again rather than providing a new CID
+		e.POST("/dht/provide-test").
+			Expect().
+			Status(http.StatusOK).
+			JSON().Object().Value("CID").IsEqual(res.Value("CID").Raw())
+	})
+
+	t.Run("JSON schemas", func(t *testing.T) {
+		e := httpexpect.Default(t, "http://localhost:1234")
+		schema := e.GET("/schemas/peerCheckOutput.json").
+			Expect().
+			Status(http.StatusOK).
+			JSON(httpexpect.ContentOpts{MediaType: "application/schema+json"}).Object()
+		schema.Value("title").String().IsEqual("peerCheckOutput")
+		schema.Value("properties").Object().ContainsKey("DataAvailableOverBitswap")
+		e.GET("/schemas/unknown.json").Expect().Status(http.StatusNotFound)
+	})
+
 	t.Run("Data on reachable peer that's advertised", func(t *testing.T) {
 		testData := []byte(t.Name())
 		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
@@ -116,11 +202,45 @@ func TestBasicIntegration(t *testing.T) {
 		obj := test.Query(t, "http://localhost:1234", testCid.String(), hostAddr.String())
 
 		obj.Value("ProviderRecordFromPeerInDHT").Boolean().IsTrue()
+		obj.Value("Advertisements").Object().Value("DHT").Boolean().IsTrue()
 		obj.Value("ConnectionError").String().IsEmpty()
 		obj.Value("ConnectionMaddrs").Array().ContainsAll(h.Addrs()[0])
 		obj.Value("DataAvailableOverBitswap").Object().Value("Error").String().IsEmpty()
 		obj.Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
 		obj.Value("DataAvailableOverBitswap").Object().Value("Responded").Boolean().IsTrue()
+		obj.Value("DataAvailableOverBitswap").Object().Value("ReceivedBlock").Boolean().IsTrue()
+		obj.Value("DataAvailableOverBitswap").Object().Value("Protocol").String().IsEqual("/ipfs/bitswap/1.2.0")
+		obj.Value("DataAvailableOverBitswap").Object().Value("BlockSize").Number().IsEqual(len(testData))
+		obj.Value("AddrSets").Object().Value("Identify").Array().NotEmpty()
+		obj.Value("AddrSets").Object().Value("Working").Array().ContainsAll(h.Addrs()[0])
+		dial := obj.Value("AddrDialResults").Array().Value(0).Object()
+		dial.Value("Transport").String().IsEqual("tcp")
+		dial.Value("Security").String().IsEqual("/tls/1.0.0")
+		dial.Value("Muxer").String().IsEqual("/yamux/1.0.0")
+		dial.Value("HandshakeFailure").String().IsEmpty()
+		dial.Value("Isolated").Boolean().IsTrue()
+		dial.Value("LocalAddr").String().NotEmpty()
+		obj.Value("RecordPropagation").IsNull()
+		// The test peer runs the DHT in client mode
+		obj.Value("DHTServer").Object().Value("Advertised").Boolean().IsFalse()
+		bitswap := obj.Value("Protocols").Array().Value(0).Object()
+		bitswap.Value("Name").String().IsEqual("Bitswap 1.2.0")
+		bitswap.Value("Supported").Boolean().IsTrue()
+		timings := obj.Value("Timings").Object()
+		for _, stage := range []string{"Routing", "Dial", "Negotiation", "Bitswap", "Total"} {
+			timings.Value(stage).Number().Gt(0)
+		}
+		stages := obj.Value("Stages").Object()
+		for _, stage := range []string{"Routing", "Dial", "Bitswap"} {
+			stages.Value(stage).Object().Value("Status").String().IsEqual(check.StageOK)
+		}
+
+		// The test DHT has a single server, which holds the record
+		propagation := test.QueryDeep(t, "http://localhost:1234", testCid.String(), hostAddr.String()).
+			Value("RecordPropagation").Object()
+		propagation.Value("Holders").Array().ContainsOnly(dhtHost.ID().String())
+		propagation.Value("Responded").Number().IsEqual(1)
+		propagation.Value("Partial").Boolean().IsFalse()
 	})
 
 	t.Run("Data on reachable peer that's not advertised", func(t *testing.T) {
@@ -141,6 +261,93 @@ func TestBasicIntegration(t *testing.T) {
 		obj.Value("DataAvailableOverBitswap").Object().Value("Error").String().IsEmpty()
 		obj.Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
 		obj.Value("DataAvailableOverBitswap").Object().Value("Responded").Boolean().IsTrue()
+		obj.Value("BitswapVersions").IsNull()
+
+		// The Bitswap server of the peer behaves the same over every version
+		versions := httpexpect.Default(t, "http://localhost:1234").GET("/check").
+			WithQuery("cid", testCid.String()).
+			WithQuery("multiaddr", hostAddr.String()).
+			WithQuery("bitswapVersions", "true").
+			Expect().
+			Status(http.StatusOK).
+			JSON().Object().Value("BitswapVersions").Object()
+		versions.Value("Versions").Array().Length().IsEqual(3)
+		for _, v := range versions.Value("Versions").Array().Iter() {
+			v.Object().Value("Supported").Boolean().IsTrue()
+			v.Object().Value("ReceivedBlock").Boolean().IsTrue()
+		}
+		versions.Value("Differences").Array().IsEmpty()
+	})
+
+	t.Run("Several CIDs checked against a peer", func(t *testing.T) {
+		var cids []string
+		for i := 0; i < 3; i++ {
+			testData := []byte(fmt.Sprintf("%s %d", t.Name(), i))
+			mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+			require.NoError(t, err)
+			testCid := cid.NewCidV1(cid.Raw, mh)
+			if i < 2 {
+				testBlock, err := blocks.NewBlockWithCid(testData, testCid)
+				require.NoError(t, err)
+				require.NoError(t, bstore.Put(ctx, testBlock))
+			}
+			cids = append(cids, testCid.String())
+		}
+
+		e := httpexpect.Default(t, "http://localhost:1234")
+		obj := e.GET("/check").WithQuery("cid", cids[0]).WithQuery("cid", cids[1]).WithQuery("cid", cids[2]).
+			WithQuery("multiaddr", hostAddr.String()).WithQuery("fetchBlock", true).
+			Expect().Status(http.StatusOK).JSON().Object()
+		obj.Value("ConnectionError").String().IsEmpty()
+		obj.Value("Available").Number().IsEqual(2)
+		results := obj.Value("CIDs").Array()
+		results.Length().IsEqual(3)
+		for i, c := range cids {
+			result := results.Value(i).Object()
+			result.Value("CID").String().IsEqual(c)
+			bitswap := result.Value("DataAvailableOverBitswap").Object()
+			bitswap.Value("Responded").Boolean().IsTrue()
+			bitswap.Value("ReceivedBlock").Boolean().IsEqual(i < 2)
+			bitswap.Value("ReceivedDontHave").Boolean().IsEqual(i == 2)
+		}
+
+		e.GET("/check").WithQuery("cid", cids[0]).WithQuery("cid", cids[1]).
+			Expect().Status(http.StatusBadRequest).JSON().Object().Value("error").Object().
+			Value("details").Object().Value("parameter").String().IsEqual("cid")
+		e.GET("/check").WithQuery("cid", cids[0]).WithQuery("cid", cids[0]).WithQuery("multiaddr", hostAddr.String()).
+			Expect().Status(http.StatusBadRequest)
+	})
+
+	t.Run("Results in other formats", func(t *testing.T) {
+		testData := []byte(t.Name())
+		testBlock := blocks.NewBlock(testData)
+		require.NoError(t, bstore.Put(ctx, testBlock))
+		require.NoError(t, dhtClient.Provide(ctx, testBlock.Cid(), true))
+
+		e := httpexpect.Default(t, "http://localhost:1234")
+		text := e.GET("/check").WithQuery("cid", testBlock.Cid().String()).WithQuery("multiaddr", hostAddr.String()).
+			WithQuery("format", "text").
+			Expect().Status(http.StatusOK)
+		text.Header("Content-Type").HasPrefix("text/plain")
+		text.Body().Contains("Bitswap: found")
+
+		cbor := e.GET("/check").WithQuery("cid", testBlock.Cid().String()).WithQuery("multiaddr", hostAddr.String()).
+			WithHeader("Accept", "application/vnd.ipld.dag-cbor").
+			Expect().Status(http.StatusOK)
+		cbor.Header("Content-Type").IsEqual("application/vnd.ipld.dag-cbor")
+		nb := basicnode.Prototype.Any.NewBuilder()
+		require.NoError(t, dagcbor.Decode(nb, strings.NewReader(cbor.Body().Raw())))
+		found, err := nb.Build().LookupByString("DataAvailableOverBitswap")
+		require.NoError(t, err)
+		found, err = found.LookupByString("Found")
+		require.NoError(t, err)
+		isFound, err := found.AsBool()
+		require.NoError(t, err)
+		require.True(t, isFound)
+
+		e.GET("/check").WithQuery("cid", testBlock.Cid().String()).WithQuery("format", "xml").
+			Expect().Status(http.StatusBadRequest).JSON().Object().Value("error").Object().
+			Value("details").Object().Value("parameter").String().IsEqual("format")
 	})
 
 	t.Run("Data that's advertised but not served", func(t *testing.T) {
@@ -159,6 +366,310 @@ func TestBasicIntegration(t *testing.T) {
 		obj.Value("DataAvailableOverBitswap").Object().Value("Error").String().IsEmpty()
 		obj.Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsFalse()
 		obj.Value("DataAvailableOverBitswap").Object().Value("Responded").Boolean().IsTrue()
+		obj.Value("DataAvailableOverBitswap").Object().Value("ReceivedDontHave").Boolean().IsTrue()
+	})
+
+	t.Run("Data hashed with blake3", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.BLAKE3, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		testBlock, err := blocks.NewBlockWithCid(testData, testCid)
+		require.NoError(t, err)
+		err = bstore.Put(ctx, testBlock)
+		require.NoError(t, err)
+
+		obj := test.Query(t, "http://localhost:1234", testCid.String(), hostAddr.String())
+
+		obj.Value("ConnectionError").String().IsEmpty()
+		obj.Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
+		cidInfo := obj.Value("CID").Object()
+		cidInfo.Value("Codec").String().IsEqual("raw")
+		cidInfo.Value("Multihash").String().IsEqual("blake3")
+		cidInfo.Value("Multibase").String().IsEqual("base32")
+		cidInfo.Value("CIDv1").String().IsEqual(testCid.String())
+		cidInfo.Value("Warnings").IsNull()
+
+		// The data of identity CIDs is in the CID, there are no providers to look for
+		e := httpexpect.Default(t, "http://localhost:1234")
+		e.GET("/check").WithQuery("cid", "bafkqaaa").
+			Expect().Status(http.StatusBadRequest).Body().Contains("identity CID")
+	})
+
+	t.Run("Provider selection strategies", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		testBlock, err := blocks.NewBlockWithCid(testData, testCid)
+		require.NoError(t, err)
+		err = bstore.Put(ctx, testBlock)
+		require.NoError(t, err)
+		err = dhtClient.Provide(ctx, testCid, true)
+		require.NoError(t, err)
+
+		for _, selection := range []string{check.SelectRandom, check.SelectAll} {
+			res := test.QuerySelection(t, "http://localhost:1234", testCid.String(), selection)
+			res.Length().IsEqual(1)
+			res.Value(0).Object().Value("ID").String().IsEqual(h.ID().String())
+			res.Value(0).Object().Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
+		}
+
+		e := httpexpect.Default(t, "http://localhost:1234")
+		apiErr := e.GET("/check").WithQuery("cid", testCid.String()).WithQuery("providerSelection", "best").
+			Expect().Status(http.StatusBadRequest).JSON().Object().Value("error").Object()
+		apiErr.Value("code").String().IsEqual("invalid-parameter")
+		apiErr.Value("details").Object().Value("parameter").String().IsEqual("providerSelection")
+	})
+
+	t.Run("Errors are JSON with a code", func(t *testing.T) {
+		e := httpexpect.Default(t, "http://localhost:1234")
+		apiErr := e.GET("/check").Expect().Status(http.StatusBadRequest).
+			JSON().Object().Value("error").Object()
+		apiErr.Value("code").String().IsEqual("missing-parameter")
+		apiErr.Value("details").Object().Value("parameter").String().IsEqual("cid")
+
+		apiErr = e.GET("/check").WithQuery("cid", deniedCid.String()).WithQuery("ipniIndexer", "not a url").
+			Expect().Status(http.StatusBadRequest).JSON().Object().Value("error").Object()
+		apiErr.Value("code").String().IsEqual("invalid-parameter")
+		apiErr.Value("details").Object().Value("parameter").String().IsEqual("ipniIndexer")
+		e.GET("/check").WithQuery("cid", deniedCid.String()).Expect().Status(http.StatusUnavailableForLegalReasons).
+			JSON().Object().Value("error").Object().Value("code").String().IsEqual("denied-cid")
+	})
+
+	t.Run("Parameters that can not be federated", func(t *testing.T) {
+		cfg := *d.config()
+		cfg.Federation = []string{"http://127.0.0.1:1"}
+		cfg.Attestations.Enabled = true
+		d.cfg.Store(&cfg)
+		defer d.cfg.Store(nil)
+
+		e := httpexpect.Default(t, "http://localhost:1234")
+		e.GET("/check").WithQuery("cid", deniedCid.String()).WithQuery("federated", "true").WithQuery("gateway", "true").
+			Expect().Status(http.StatusBadRequest).JSON().Object().Value("error").Object().
+			Value("details").Object().Value("parameter").String().IsEqual("gateway")
+		e.GET("/check").WithQuery("cid", deniedCid.String()).WithQuery("federated", "true").WithQuery("attest", "true").
+			Expect().Status(http.StatusBadRequest).JSON().Object().Value("error").Object().
+			Value("details").Object().Value("parameter").String().IsEqual("attest")
+	})
+
+	t.Run("Pinning service delegates", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		testBlock, err := blocks.NewBlockWithCid(testData, testCid)
+		require.NoError(t, err)
+		err = bstore.Put(ctx, testBlock)
+		require.NoError(t, err)
+
+		delegates := make([]string, 0, len(h.Addrs()))
+		for _, a := range h.Addrs() {
+			delegates = append(delegates, a.String()+"/p2p/"+h.ID().String())
+		}
+		pinningService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = fmt.Fprint(w, `{"error":{"reason":"UNAUTHORIZED","details":"invalid token"}}`)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"requestid": strings.TrimPrefix(r.URL.Path, "/pins/"),
+				"status":    "pinned",
+				"created":   time.Now(),
+				"pin":       map[string]any{"cid": testCid.String(), "name": "test"},
+				"delegates": delegates,
+				"info":      map[string]any{},
+			})
+		}))
+		defer pinningService.Close()
+
+		// Disabled until pinning services are configured
+		e := httpexpect.Default(t, "http://localhost:1234")
+		e.GET("/check/pinning-service").WithQuery("endpoint", pinningService.URL).WithQuery("requestID", "abc").
+			Expect().Status(http.StatusNotFound)
+		cfg := *d.config()
+		cfg.PinningServices = []string{pinningService.URL}
+		d.cfg.Store(&cfg)
+		defer d.cfg.Store(nil)
+
+		e.GET("/check/pinning-service").WithQuery("endpoint", "https://pinning.example.com").WithQuery("requestID", "abc").
+			Expect().Status(http.StatusBadRequest).JSON().Object().Value("error").Object().Value("code").String().IsEqual("invalid-parameter")
+		e.GET("/check/pinning-service").WithQuery("endpoint", pinningService.URL+"/?").WithQuery("requestID", "abc").
+			Expect().Status(http.StatusBadRequest)
+
+		out := e.GET("/check/pinning-service").WithQuery("endpoint", pinningService.URL).WithQuery("requestID", "abc").
+			WithHeader("Authorization", "Bearer secret").
+			Expect().Status(http.StatusOK).JSON().Object()
+		out.Value("RequestID").String().IsEqual("abc")
+		out.Value("Status").String().IsEqual("pinned")
+		out.Value("CID").String().IsEqual(testCid.String())
+		providers := out.Value("Providers").Array()
+		providers.Length().IsEqual(1)
+		providers.Value(0).Object().Value("Source").String().IsEqual(check.PinningServiceSource)
+		providers.Value(0).Object().Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
+
+		e.GET("/check/pinning-service").WithQuery("endpoint", pinningService.URL).WithQuery("requestID", "abc").
+			Expect().Status(http.StatusBadGateway).Body().Contains("UNAUTHORIZED").NotContains("invalid token")
+	})
+
+	t.Run("Plan without running the check", func(t *testing.T) {
+		mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		e := httpexpect.Default(t, "http://localhost:1234")
+		plan := e.GET("/check").WithQuery("cid", testCid.String()).WithQuery("plan", "true").
+			Expect().Status(http.StatusOK).JSON().Object()
+		plan.Value("MaxProviders").Number().IsEqual(10)
+		plan.Value("Routing").Array().Length().IsEqual(2)
+
+		plan = e.GET("/check").WithQuery("cid", testCid.String()).WithQuery("multiaddr", "/p2p/"+h.ID().String()).WithQuery("plan", "true").
+			Expect().Status(http.StatusOK).JSON().Object()
+		plan.Value("Addrs").IsNull()
+		plan.Value("Protocols").Array().ContainsAll(testDHTPrefix + "/kad/1.0.0")
+
+		e.GET("/check").WithQuery("cid", testCid.String()).WithQuery("plan", "maybe").
+			Expect().Status(http.StatusBadRequest)
+	})
+
+	t.Run("Denied CID and peer", func(t *testing.T) {
+		e := httpexpect.Default(t, "http://localhost:1234")
+		e.GET("/check").WithQuery("cid", deniedCid.String()).
+			Expect().Status(http.StatusUnavailableForLegalReasons)
+		e.GET("/check").WithQuery("cid", cid.NewCidV0(deniedMh).String()).WithQuery("plan", "true").
+			Expect().Status(http.StatusUnavailableForLegalReasons)
+
+		mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		e.GET("/check").WithQuery("cid", testCid.String()).WithQuery("multiaddr", "/p2p/"+deniedHost.ID().String()).
+			Expect().Status(http.StatusForbidden)
+
+		deniedAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: deniedHost.ID(), Addrs: deniedHost.Addrs()})
+		require.NoError(t, err)
+		res := test.QueryProviders(t, "http://localhost:1234", testCid.String(), deniedAddrs[0].String())
+		res.Length().IsEqual(1)
+		res.Value(0).Object().Value("Denied").Boolean().IsTrue()
+		res.Value(0).Object().Value("ConnectionError").String().IsEqual(check.ErrDeniedPeer.Error())
+	})
+
+	t.Run("Node check by peer ID", func(t *testing.T) {
+		e := httpexpect.Default(t, "http://localhost:1234")
+		out := e.GET("/check/node/"+h.ID().String()).WithQuery("timeoutSeconds", "30").
+			Expect().Status(http.StatusOK).JSON().Object()
+		out.Value("PeerID").String().IsEqual(h.ID().String())
+		out.Value("PeerFoundInDHT").Object().NotEmpty()
+		out.Value("ConnectionError").String().IsEmpty()
+		out.Value("Transports").Array().Value(0).Object().Value("Transport").String().IsEqual(check.TransportTCP)
+		out.Value("Transports").Array().Value(0).Object().Value("Connected").Boolean().IsTrue()
+		out.Value("RelayOnly").Boolean().IsFalse()
+		out.Value("Identify").Object().Value("Protocols").Array().ContainsAll("/ipfs/bitswap/1.2.0")
+		// The test peer runs the DHT in client mode
+		out.Value("DHTServer").Object().Value("Advertised").Boolean().IsFalse()
+
+		e.GET("/check/node/not-a-peer-id").Expect().Status(http.StatusBadRequest)
+		e.GET("/check/node/" + deniedHost.ID().String()).Expect().Status(http.StatusForbidden)
+	})
+
+	t.Run("Browser reachability", func(t *testing.T) {
+		e := httpexpect.Default(t, "http://localhost:1234")
+		var webTransportAddr multiaddr.Multiaddr
+		for _, a := range h.Addrs() {
+			if strings.HasPrefix(a.String(), "/ip4/127.0.0.1/") && strings.Contains(a.String(), "/webtransport/") {
+				webTransportAddr = a
+			}
+		}
+		require.NotNil(t, webTransportAddr)
+		out := e.GET("/check/browser").WithQuery("multiaddr", webTransportAddr.String()+"/p2p/"+h.ID().String()).
+			Expect().Status(http.StatusOK).JSON().Object()
+		out.Value("PeerID").String().IsEqual(h.ID().String())
+		out.Value("BrowserReachable").Boolean().IsTrue()
+		transports := out.Value("Transports").Array()
+		transports.Value(0).Object().Value("Transport").String().IsEqual(check.TransportWebTransport)
+		transports.Value(0).Object().Value("Connected").Boolean().IsTrue()
+		for _, r := range out.Value("AddrDialResults").Array().Iter() {
+			r.Object().Value("Transport").String().NotEqual("tcp")
+		}
+
+		// The test peer only listening on TCP is reachable by nodes, not by browsers
+		tcpHost, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		defer tcpHost.Close()
+		out = e.GET("/check/browser").WithQuery("multiaddr", tcpHost.Addrs()[0].String()+"/p2p/"+tcpHost.ID().String()).
+			Expect().Status(http.StatusOK).JSON().Object()
+		out.Value("BrowserReachable").Boolean().IsFalse()
+		out.Value("Error").String().NotEmpty()
+		out.Value("Addrs").Array().Value(0).Object().Value("Reason").String().NotEmpty()
+
+		e.GET("/check/browser").Expect().Status(http.StatusBadRequest)
+		e.GET("/check/browser").WithQuery("multiaddr", "/p2p/"+deniedHost.ID().String()).Expect().Status(http.StatusForbidden)
+	})
+
+	t.Run("IPNS records of a peer ID", func(t *testing.T) {
+		mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		name := ipns.NameFromPeer(h.ID())
+		rec, err := ipns.NewRecord(h.Peerstore().PrivKey(h.ID()), path.FromCid(testCid), 3, time.Now().Add(time.Hour), time.Minute)
+		require.NoError(t, err)
+		data, err := ipns.MarshalRecord(rec)
+		require.NoError(t, err)
+		require.NoError(t, dhtClient.PutValue(ctx, string(name.RoutingKey()), data))
+
+		e := httpexpect.Default(t, "http://localhost:1234")
+		out := e.GET("/check").WithQuery("cid", "/ipns/"+name.String()).
+			Expect().Status(http.StatusOK).JSON().Object()
+		out.Value("Name").String().IsEqual(name.String())
+		out.Value("PublicKey").Object().Value("Source").String().IsEqual(check.PublicKeyInPeerID)
+		out.Value("PublicKey").Object().Value("Verified").Boolean().IsTrue()
+		out.Value("Conflicting").Boolean().IsFalse()
+		records := out.Value("Records").Array()
+		records.Length().IsEqual(1)
+		records.Value(0).Object().Value("Value").String().IsEqual("/ipfs/" + testCid.String())
+		records.Value(0).Object().Value("Sequence").Number().IsEqual(3)
+		records.Value(0).Object().Value("SignatureValid").Boolean().IsTrue()
+		records.Value(0).Object().Value("Servers").Array().ContainsOnly(dhtHost.ID().String())
+
+		e.GET("/check/ipns/" + name.String()).Expect().Status(http.StatusOK).
+			JSON().Object().Value("Records").Array().Length().IsEqual(1)
+		e.GET("/check/ipns/example.com").Expect().Status(http.StatusBadRequest)
+		e.GET("/check/ipns/" + deniedHost.ID().String()).Expect().Status(http.StatusForbidden)
+	})
+
+	t.Run("Gateway retrieval simulation", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		testBlock, err := blocks.NewBlockWithCid(testData, testCid)
+		require.NoError(t, err)
+		require.NoError(t, bstore.Put(ctx, testBlock))
+		require.NoError(t, dhtClient.Provide(ctx, testCid, true))
+
+		e := httpexpect.Default(t, "http://localhost:1234")
+		out := e.GET("/check").WithQuery("cid", testCid.String()).WithQuery("gateway", "true").
+			Expect().Status(http.StatusOK).JSON().Object()
+		out.Value("Retrieved").Boolean().IsTrue()
+		out.Value("Provider").String().IsEqual(h.ID().String())
+		out.Value("Timeout").Number().IsEqual(check.GatewayTimeout)
+		out.Value("Duration").Number().Lt(check.GatewayTimeout)
+		provider := out.Value("Providers").Array().Find(func(_ int, v *httpexpect.Value) bool {
+			return v.Object().Value("ID").String().Raw() == h.ID().String()
+		}).Object()
+		provider.Value("Source").String().IsEqual(check.DHTSource)
+		provider.Value("ReceivedBlockAfter").Number().Gt(0)
+		provider.Value("Error").String().IsEmpty()
+
+		mh, err = multihash.Sum([]byte(t.Name()+" not provided"), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		out = e.GET("/check").WithQuery("cid", cid.NewCidV1(cid.Raw, mh).String()).WithQuery("gateway", "true").
+			Expect().Status(http.StatusOK).JSON().Object()
+		out.Value("Retrieved").Boolean().IsFalse()
+		out.Value("Providers").Array().IsEmpty()
+		out.Value("Error").String().IsEqual("no providers were found in the DHT or IPNI")
+
+		e.GET("/check").WithQuery("cid", testCid.String()).WithQuery("gateway", "true").WithQuery("multiaddr", hostAddr.String()).
+			Expect().Status(http.StatusBadRequest)
 	})
 
 	t.Run("Data found on reachable peer with just cid", func(t *testing.T) {
@@ -186,8 +697,314 @@ func TestBasicIntegration(t *testing.T) {
 		}
 
 		res.Value(0).Object().Value("ConnectionMaddrs").Array()
+		res.Value(0).Object().Value("Advertisements").Object().Value("DHT").Boolean().IsTrue()
 		res.Value(0).Object().Value("DataAvailableOverBitswap").Object().Value("Error").String().IsEmpty()
 		res.Value(0).Object().Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
 		res.Value(0).Object().Value("DataAvailableOverBitswap").Object().Value("Responded").Boolean().IsTrue()
+		res.Value(0).Object().Value("Timings").Object().Value("Routing").Number().Gt(0)
+		res.Value(0).Object().Value("Timings").Object().Value("Total").Number().Gt(0)
+	})
+
+	t.Run("Unreachable peer reports the stages that ran", func(t *testing.T) {
+		gone, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		goneAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: gone.ID(), Addrs: gone.Addrs()})
+		require.NoError(t, err)
+		require.NoError(t, gone.Close())
+
+		mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		obj := test.Query(t, "http://localhost:1234", cid.NewCidV1(cid.Raw, mh).String(), goneAddrs[0].String())
+		obj.Value("ConnectionError").String().NotEmpty()
+		stages := obj.Value("Stages").Object()
+		stages.Value("Dial").Object().Value("Status").String().IsEqual(check.StageFailed)
+		stages.Value("Bitswap").Object().Value("Status").String().IsEqual(check.StageSkipped)
+	})
+
+	t.Run("Failed dials are retried", func(t *testing.T) {
+		gone, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		goneAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: gone.ID(), Addrs: gone.Addrs()})
+		require.NoError(t, err)
+		require.NoError(t, gone.Close())
+
+		mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		e := httpexpect.Default(t, "http://localhost:1234")
+		obj := e.GET("/check").WithQuery("cid", cid.NewCidV1(cid.Raw, mh).String()).WithQuery("multiaddr", goneAddrs[0].String()).
+			WithQuery("retries", 1).Expect().Status(http.StatusOK).JSON().Object()
+		obj.Value("ConnectionError").String().NotEmpty()
+		attempts := obj.Value("DialAttempts").Array()
+		attempts.Length().IsEqual(2)
+		attempts.Value(0).Object().Value("Error").String().NotEmpty()
+		attempts.Value(1).Object().Value("Backoff").Number().IsEqual(time.Second)
+
+		e.GET("/check").WithQuery("cid", cid.NewCidV1(cid.Raw, mh).String()).WithQuery("retries", check.MaxRetries+1).
+			Expect().Status(http.StatusBadRequest)
+
+		// Working peers are connected to at the first attempt
+		obj = test.Query(t, "http://localhost:1234", cid.NewCidV1(cid.Raw, mh).String(), hostAddr.String())
+		obj.Value("DialAttempts").Array().Length().IsEqual(1)
+		obj.Value("DataAvailableOverBitswap").Object().Value("Attempts").Array().Length().IsEqual(1)
+	})
+
+	t.Run("Check cut at maxCheckDuration", func(t *testing.T) {
+		cfg := *d.config()
+		cfg.MaxCheckDuration = time.Second
+		d.cfg.Store(&cfg)
+		defer d.cfg.Store(nil)
+
+		// A peer whose connections are never answered, so that the dial
+		// outlasts maxCheckDuration
+		silent, err := manet.Listen(multiaddr.StringCast("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		defer silent.Close()
+		gone, err := libp2p.New(libp2p.NoListenAddrs)
+		require.NoError(t, err)
+		require.NoError(t, gone.Close())
+		silentAddr := silent.Multiaddr().Encapsulate(multiaddr.StringCast("/p2p/" + gone.ID().String()))
+
+		mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		httpexpect.Default(t, "http://localhost:1234").GET("/check").
+			WithQuery("cid", cid.NewCidV1(cid.Raw, mh).String()).WithQuery("multiaddr", silentAddr.String()).
+			Expect().Status(http.StatusGatewayTimeout).
+			JSON().Object().Value("error").Object().Value("code").String().IsEqual("timeout")
+	})
+
+	t.Run("Data on peer checked over a single transport", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		testBlock, err := blocks.NewBlockWithCid(testData, testCid)
+		require.NoError(t, err)
+		err = bstore.Put(ctx, testBlock)
+		require.NoError(t, err)
+
+		var quicAddr multiaddr.Multiaddr
+		for _, a := range h.Addrs() {
+			if _, err := a.ValueForProtocol(multiaddr.P_QUIC_V1); err == nil && len(a.Protocols()) == 3 {
+				quicAddr = a
+				break
+			}
+		}
+		require.NotNil(t, quicAddr)
+		quicMaddr := quicAddr.Encapsulate(multiaddr.StringCast("/p2p/" + h.ID().String())).String()
+
+		obj := test.QueryTransport(t, "http://localhost:1234", testCid.String(), quicMaddr, check.TransportQUIC)
+		obj.Value("ConnectionError").String().IsEmpty()
+		obj.Value("ConnectionMaddrs").Array().ContainsOnly(quicAddr.String())
+		conn := obj.Value("Connections").Array().Value(0).Object()
+		conn.Value("Transport").String().IsEqual("quic-v1")
+		conn.Value("Security").String().IsEmpty()
+		obj.Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
+
+		obj = test.QueryTransport(t, "http://localhost:1234", testCid.String(), quicMaddr, check.TransportTCP)
+		obj.Value("ConnectionError").String().IsEqual("the peer has no tcp address")
+		stages := obj.Value("Stages").Object()
+		stages.Value("Dial").Object().Value("Status").String().IsEqual(check.StageSkipped)
+		stages.Value("Bitswap").Object().Value("Status").String().IsEqual(check.StageSkipped)
+
+		e := httpexpect.Default(t, "http://localhost:1234")
+		e.GET("/check").WithQuery("cid", testCid.String()).WithQuery("transport", "carrier-pigeon").
+			Expect().Status(http.StatusBadRequest)
+	})
+
+	t.Run("Browser transports with certificate hashes", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		testBlock, err := blocks.NewBlockWithCid(testData, testCid)
+		require.NoError(t, err)
+		err = bstore.Put(ctx, testBlock)
+		require.NoError(t, err)
+
+		for _, transport := range []string{check.TransportWebTransport, check.TransportWebRTC} {
+			var addr multiaddr.Multiaddr
+			for _, a := range h.Addrs() {
+				if _, err := a.ValueForProtocol(multiaddr.P_IP4); err == nil && strings.Contains(a.String(), "/"+transport) {
+					addr = a
+					break
+				}
+			}
+			require.NotNil(t, addr, transport)
+			maddr := addr.Encapsulate(multiaddr.StringCast("/p2p/" + h.ID().String())).String()
+
+			obj := test.QueryTransport(t, "http://localhost:1234", testCid.String(), maddr, transport)
+			certHashes := obj.Value("CertHashChecks").Array()
+			certHashes.Length().IsEqual(1)
+			certHash := certHashes.Value(0).Object()
+			certHash.Value("Transport").String().IsEqual(transport)
+			certHash.Value("CertHashes").Array().ContainsOnly("sha2-256")
+			certHash.Value("Error").String().IsEmpty()
+			// WebRTC Direct dials between hosts of the same process are not
+			// reliable enough to assert on, the certhashes are validated anyway
+			if transport == check.TransportWebTransport {
+				obj.Value("ConnectionError").String().IsEmpty()
+				obj.Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
+				certHash.Value("Connected").Boolean().IsTrue()
+			}
+		}
+	})
+
+	t.Run("Data on peer passed as a provider without routing", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		testBlock, err := blocks.NewBlockWithCid(testData, testCid)
+		require.NoError(t, err)
+		err = bstore.Put(ctx, testBlock)
+		require.NoError(t, err)
+
+		res := test.QueryProviders(t, "http://localhost:1234", testCid.String(), hostAddr.String())
+
+		res.Length().IsEqual(1)
+		res.Value(0).Object().Value("ID").String().IsEqual(h.ID().String())
+		res.Value(0).Object().Value("Source").String().IsEqual("Request")
+		res.Value(0).Object().Value("ConnectionError").String().IsEmpty()
+		res.Value(0).Object().Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
+
+		// Providers passed without addresses are not looked up in the DHT
+		res = test.QueryProviders(t, "http://localhost:1234", testCid.String(), "/p2p/"+h.ID().String())
+		res.Length().IsEqual(1)
+		res.Value(0).Object().Value("Addrs").Array().IsEmpty()
+		res.Value(0).Object().Value("ConnectionError").String().Contains("no addresses supplied")
+		res.Value(0).Object().Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsFalse()
+	})
+
+	t.Run("Gateway URL resolved to the CID of the path", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		fileCid := cid.NewCidV1(cid.Raw, mh)
+		file, err := blocks.NewBlockWithCid(testData, fileCid)
+		require.NoError(t, err)
+		// UnixFS directory
+		dir := merkledag.NodeWithData([]byte{0x08, 0x01})
+		require.NoError(t, dir.AddRawLink("file.txt", &format.Link{Cid: fileCid}))
+		require.NoError(t, bstore.PutMany(ctx, []blocks.Block{file, dir}))
+
+		res := test.Query(t, "http://localhost:1234", "https://ipfs.io/ipfs/"+dir.Cid().String()+"/file.txt", hostAddr.String())
+
+		res.Value("ConnectionError").String().IsEmpty()
+		res.Value("PathResolution").Object().Value("ResolvedCID").String().IsEqual(fileCid.String())
+		res.Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsTrue()
+	})
+
+	t.Run("Path that can not be resolved", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		fileCid := cid.NewCidV1(cid.Raw, mh)
+		subdir := merkledag.NodeWithData([]byte{0x08, 0x01})
+		require.NoError(t, subdir.AddRawLink("file.txt", &format.Link{Cid: fileCid}))
+		dir := merkledag.NodeWithData([]byte{0x08, 0x01})
+		require.NoError(t, dir.AddNodeLink("a", subdir))
+		require.NoError(t, bstore.PutMany(ctx, []blocks.Block{subdir, dir}))
+
+		res := test.Query(t, "http://localhost:1234", "/ipfs/"+dir.Cid().String()+"/a/missing.txt", hostAddr.String())
+
+		res.Value("ConnectionError").String().IsEmpty()
+		pathRes := res.Value("PathResolution").Object()
+		pathRes.Value("Segments").Array().Length().IsEqual(1)
+		pathRes.Value("Segments").Array().Value(0).Object().Value("CID").String().IsEqual(subdir.Cid().String())
+		pathRes.Value("FailedSegment").String().IsEqual("missing.txt")
+		pathRes.Value("ResolvedCID").String().IsEmpty()
+		res.Value("DataAvailableOverBitswap").Object().Value("Found").Boolean().IsFalse()
+	})
+
+	t.Run("Data exported as a CAR file", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		childCid := cid.NewCidV1(cid.Raw, mh)
+		child, err := blocks.NewBlockWithCid(testData, childCid)
+		require.NoError(t, err)
+		root := merkledag.NodeWithData(testData)
+		require.NoError(t, root.AddRawLink("child", &format.Link{Cid: childCid}))
+		require.NoError(t, bstore.PutMany(ctx, []blocks.Block{child, root}))
+
+		car := test.QueryCAR(t, "http://localhost:1234", root.Cid().String(), hostAddr.String(), 1)
+
+		// header, then the root and the child blocks in depth-first order
+		var sections [][]byte
+		for len(car) > 0 {
+			n, read, err := varint.FromUvarint(car)
+			require.NoError(t, err)
+			require.LessOrEqual(t, read+int(n), len(car))
+			sections = append(sections, car[read:read+int(n)])
+			car = car[read+int(n):]
+		}
+		require.Len(t, sections, 3)
+		for i, b := range []blocks.Block{root, child} {
+			read, c, err := cid.CidFromBytes(sections[i+1])
+			require.NoError(t, err)
+			require.Equal(t, b.Cid(), c)
+			require.Equal(t, b.RawData(), sections[i+1][read:])
+		}
+	})
+
+	t.Run("Watch the provider records of a CID", func(t *testing.T) {
+		testData := []byte(t.Name())
+		mh, err := multihash.Sum(testData, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		testCid := cid.NewCidV1(cid.Raw, mh)
+		err = dhtClient.Provide(ctx, testCid, true)
+		require.NoError(t, err)
+
+		resp, err := http.Get("http://localhost:1234/watch?intervalSec=5&cid=" + testCid.String())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		// The first lookup runs right away
+		scanner := bufio.NewScanner(resp.Body)
+		require.True(t, scanner.Scan())
+		require.Equal(t, "event: records", scanner.Text())
+		require.True(t, scanner.Scan())
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		require.True(t, ok)
+		var ev watchEvent
+		require.NoError(t, json.Unmarshal([]byte(data), &ev))
+		require.Equal(t, []string{h.ID().String()}, ev.Records.DHT)
+		require.NotNil(t, ev.FirstFoundInDHT)
+		require.Equal(t, ev.Elapsed, *ev.FirstFoundInDHT)
+
+		e := httpexpect.Default(t, "http://localhost:1234")
+		e.GET("/watch").WithQuery("cid", testCid.String()).WithQuery("intervalSec", "1").
+			Expect().Status(http.StatusBadRequest)
+	})
+
+	t.Run("Network status", func(t *testing.T) {
+		status := httpexpect.Default(t, "http://localhost:1234").GET("/network/status").
+			Expect().
+			Status(http.StatusOK).
+			JSON().Object()
+		status.Value("DHT").Object().Value("Ready").Boolean().IsTrue()
+		status.Value("BootstrapReachable").Number().IsEqual(1)
+		status.Value("BootstrapPeers").Array().Value(0).Object().Value("ID").String().IsEqual(dhtHost.ID().String())
+		// The peer checks above looked peers up in the DHT
+		status.Value("DHTQueries").Number().Gt(0)
+		status.Value("DHTQueryLatency").Number().Gt(0)
+		status.Value("IPNI").Array().Length().IsEqual(1)
+
+		// The checker only listens on loopback addresses, which are not public
+		info := httpexpect.Default(t, "http://localhost:1234").GET("/checker").
+			Expect().
+			Status(http.StatusOK).
+			JSON().Object()
+		info.Value("Addrs").Array().IsEmpty()
+		info.Value("PeerID").String().NotEmpty()
+		status.Value("CheckerInfo").Object().Value("PeerID").IsEqual(info.Value("PeerID").Raw())
+	})
+
+	t.Run("Diagnostics are not served publicly", func(t *testing.T) {
+		e := httpexpect.Default(t, "http://localhost:1234")
+		e.GET("/debug/pprof/").Expect().Status(http.StatusNotFound)
+		e.GET("/debug/swarm").Expect().Status(http.StatusNotFound)
 	})
 }
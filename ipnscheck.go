@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+)
+
+// ipnsCheckHandler serves GET /check/ipns/{name}, the check of the IPNS
+// records of a name whose key is a peer ID
+func (d *daemon) ipnsCheckHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-IPFS-Check-Routing", d.checker.Routing())
+	cfg := d.config()
+	release, ok := d.acquireCheckSlot(w, r, cfg)
+	if !ok {
+		return
+	}
+	defer release()
+	d.serveIPNSCheck(w, r, r.PathValue("name"), "name")
+}
+
+// serveIPNSCheck checks the IPNS name nameStr, passed in the param parameter
+// of the request
+func (d *daemon) serveIPNSCheck(w http.ResponseWriter, r *http.Request, nameStr, param string) {
+	name, err := ipns.NameFromString(nameStr)
+	if err != nil {
+		writeInvalidParam(w, param, "Invalid IPNS name: only names of keys (peer IDs) are supported, not DNSLink names")
+		return
+	}
+	checkTimeout := d.config().CheckTimeout
+	if timeoutStr := r.URL.Query().Get("timeoutSeconds"); timeoutStr != "" {
+		checkTimeout, err = time.ParseDuration(timeoutStr + "s")
+		if err != nil {
+			writeInvalidParam(w, "timeoutSeconds", "Invalid timeout value (in seconds)")
+			return
+		}
+	}
+
+	log.Printf("Checking IPNS name %s with timeout %s\n", name, checkTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	out, err := d.checker.CheckIPNS(ctx, name)
+	if err != nil {
+		writeCheckError(w, err, 0)
+		return
+	}
+
+	if d.validateResponses {
+		if err := validateResponse(out); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, out)
+}
+
+// ipnsName returns the name of an /ipns/ or ipns:// path, without the path
+// under it
+func ipnsName(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	rest, ok := strings.CutPrefix(s, "/ipns/")
+	if !ok {
+		rest, ok = strings.CutPrefix(s, "ipns://")
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return name, ok
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// defaultLocalDiscoveryTimeout is how long GET /local/peers waits for the
+// answers to its mDNS query when the request does not pass timeoutSeconds
+const defaultLocalDiscoveryTimeout = 5 * time.Second
+
+// localPeersHandler serves GET /local/peers, which lists the peers of the
+// local network answering mDNS queries, in local network mode only
+func (d *daemon) localPeersHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := d.config()
+	timeout := defaultLocalDiscoveryTimeout
+	if timeoutStr := r.URL.Query().Get("timeoutSeconds"); timeoutStr != "" {
+		var err error
+		timeout, err = time.ParseDuration(timeoutStr + "s")
+		if err != nil || timeout <= 0 || timeout > cfg.CheckTimeout {
+			writeInvalidParam(w, "timeoutSeconds", "Invalid timeout value (in seconds), must be positive and at most the check timeout")
+			return
+		}
+	}
+
+	log.Printf("Discovering the peers of the local network for %s\n", timeout)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	out, err := d.checker.DiscoverLocalPeers(ctx)
+	if err != nil {
+		writeCheckError(w, err, 0)
+		return
+	}
+
+	if d.validateResponses {
+		if err := validateResponse(out); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, out)
+}
@@ -3,157 +3,629 @@ package main
 import (
 	"context"
 	"crypto/subtle"
-	"embed"
-	"encoding/json"
+	"crypto/tls"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/ipfs-check/pkg/check"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multibase"
 	"github.com/multiformats/go-multihash"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/urfave/cli/v2"
+	"github.com/quic-go/quic-go/http3"
 )
 
-//go:embed web
-var webFS embed.FS
-
 func main() {
-	app := cli.NewApp()
-	app.Name = name
-	app.Usage = "Server tool for checking the accessibility of your data by IPFS peers"
-	app.Flags = []cli.Flag{
-		&cli.StringFlag{
-			Name:    "address",
-			Value:   ":3333",
-			Usage:   "address to run on",
-			EnvVars: []string{"IPFS_CHECK_ADDRESS"},
-		},
-		&cli.BoolFlag{
-			Name:    "accelerated-dht",
-			Value:   true,
-			EnvVars: []string{"IPFS_CHECK_ACCELERATED_DHT"},
-			Usage:   "run the accelerated DHT client",
-		},
-		&cli.StringFlag{
-			Name:    "metrics-auth-username",
-			Value:   "",
-			EnvVars: []string{"IPFS_CHECK_METRICS_AUTH_USER"},
-			Usage:   "http basic auth user for the metrics endpoints",
-		},
-		&cli.StringFlag{
-			Name:    "metrics-auth-password",
-			Value:   "",
-			EnvVars: []string{"IPFS_CHECK_METRICS_AUTH_PASS"},
-			Usage:   "http basic auth password for the metrics endpoints",
-		},
-	}
-	app.Action = func(cctx *cli.Context) error {
-		ctx := cctx.Context
-
-		d, err := newDaemon(ctx, cctx.Bool("accelerated-dht"))
-		if err != nil {
-			return err
-		}
-
-		return startServer(ctx, d, cctx.String("address"), cctx.String("metrics-auth-username"), cctx.String("metrics-auth-password"))
-	}
-
-	err := app.Run(os.Args)
-	if err != nil {
+	if err := newApp().Run(os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
 
 const (
 	defaultCheckTimeout = 60 * time.Second
-	defaultIndexerURL   = "https://cid.contact"
+	defaultIndexerURL   = check.DefaultIndexerURL
 )
 
-func startServer(ctx context.Context, d *daemon, tcpListener, metricsUsername, metricPassword string) error {
+func reloadConfigOnSIGHUP(ctx context.Context, d *daemon, configPath string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			if err := d.reloadConfig(configPath); err != nil {
+				log.Printf("Error reloading config, keeping the current one: %v\n", err)
+				continue
+			}
+			log.Printf("Reloaded config from %s\n", configPath)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// startServer serves the HTTP API until ctx is canceled. In-flight requests are
+// then given up to drainTimeout to finish before being aborted.
+func startServer(ctx context.Context, d *daemon, tcpListener string, tlsOpts tlsOptions, metricsUsername, metricPassword string, drainTimeout time.Duration) error {
 	log.Printf("Starting %s %s\n", name, version)
+	ui, err := webHandler(d.webDir)
+	if err != nil {
+		return err
+	}
+	var tlsConf *tls.Config
+	scheme := "http"
+	if tlsOpts.enabled() {
+		if tlsConf, err = tlsOpts.tlsConfig(); err != nil {
+			return err
+		}
+		scheme = "https"
+	}
 	l, err := net.Listen("tcp", tcpListener)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Libp2p host peer id %s\n", d.h.ID())
-	log.Printf("Libp2p host listening on %v\n", d.h.Addrs())
-
-	d.mustStart()
+	log.Printf("Libp2p host peer id %s\n", d.checker.Host().ID())
+	log.Printf("Libp2p host listening on %v\n", d.checker.Host().Addrs())
 
-	log.Printf("Backend ready and listening on %v\n", l.Addr())
-
-	webAddr := getWebAddress(l)
-	log.Printf("Test fronted at http://%s/web/?backendURL=http://%s\n", webAddr, webAddr)
-	log.Printf("Metrics endpoint at http://%s/metrics\n", webAddr)
-	log.Printf("Ready to start serving.")
+	webURL := scheme + "://" + getWebAddress(l)
 
 	checkHandler := func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Access-Control-Allow-Origin", "*")
+		// Checks run with the standard DHT client while the accelerated one warms up
+		w.Header().Set("X-IPFS-Check-Routing", d.checker.Routing())
+
+		// Clients with an API key get its limits
+		cfg := d.config().forAPIKey(apiKeyName(r.Context()))
+		release, ok := d.acquireCheckSlot(w, r, cfg)
+		if !ok {
+			return
+		}
+		defer release()
 
 		maStr := r.URL.Query().Get("multiaddr")
 		cidStr := r.URL.Query().Get("cid")
 		timeoutStr := r.URL.Query().Get("timeoutSeconds")
 		ipniURL := r.URL.Query().Get("ipniIndexer")
+		fetchBlockStr := r.URL.Query().Get("fetchBlock")
+		autonatStr := r.URL.Query().Get("autonat")
+		bitswapVersionsStr := r.URL.Query().Get("bitswapVersions")
+		deepStr := r.URL.Query().Get("deep")
+		federatedStr := r.URL.Query().Get("federated")
+		providerStrs := r.URL.Query()["providers"]
+		carStr := r.URL.Query().Get("car")
+		carDepthStr := r.URL.Query().Get("carDepth")
+		nocacheStr := r.URL.Query().Get("nocache")
+		transport := r.URL.Query().Get("transport")
+		providerSelection := r.URL.Query().Get("providerSelection")
+		preferQUICStr := r.URL.Query().Get("preferQUIC")
+		rankBy := r.URL.Query().Get("rankBy")
+		filecoinStr := r.URL.Query().Get("filecoin")
+		planStr := r.URL.Query().Get("plan")
+		gatewayStr := r.URL.Query().Get("gateway")
+		dagStr := r.URL.Query().Get("dag")
+		throughputStr := r.URL.Query().Get("throughputMiB")
+		attestStr := r.URL.Query().Get("attest")
+		verdictStr := r.URL.Query().Get("verdict")
 
 		if cidStr == "" {
-			http.Error(w, "missing 'cid' query parameter", http.StatusBadRequest)
+			writeMissingParam(w, "cid")
 			return
 		}
-		cidKey, err := cid.Decode(cidStr)
-		if err != nil {
-			mh, mhErr := multihash.FromB58String(cidStr)
-			if mhErr != nil {
-				mh, mhErr = multihash.FromHexString(cidStr)
-				if mhErr != nil {
-					http.Error(w, err.Error(), http.StatusBadRequest)
-					return
-				}
+		// Several CIDs are checked against a single peer at once
+		var peerCIDs []cid.Cid
+		if cidStrs := r.URL.Query()["cid"]; len(cidStrs) > 1 {
+			var err error
+			if peerCIDs, err = parsePeerCIDs(cidStrs); err != nil {
+				writeInvalidParam(w, "cid", err.Error())
+				return
 			}
-			cidKey = cid.NewCidV1(cid.Raw, mh)
+		}
+		if name, ok := ipnsName(cidStr); ok {
+			// IPNS names have records to check rather than providers
+			d.serveIPNSCheck(w, r, name, "cid")
+			return
+		}
+		cidKey, cidMultibase, cidPath, err := parseContentPath(cidStr)
+		if err != nil {
+			writeInvalidParam(w, "cid", err.Error())
+			return
 		}
 
-		checkTimeout := defaultCheckTimeout
+		checkTimeout := cfg.CheckTimeout
 		if timeoutStr != "" {
 			checkTimeout, err = time.ParseDuration(timeoutStr + "s")
 			if err != nil {
-				http.Error(w, "Invalid timeout value (in seconds)", http.StatusBadRequest)
+				writeInvalidParam(w, "timeoutSeconds", "Invalid timeout value (in seconds)")
+				return
+			}
+		}
+
+		// The owner of the checked peer gets longer timeouts and DAG checks
+		owner, ok := d.requestOwner(w, r)
+		if !ok {
+			return
+		}
+		var ownsPeer bool
+		if owner != "" {
+			if ai, err := peer.AddrInfoFromString(maStr); err == nil && ai.ID == owner {
+				ownsPeer = true
+			}
+		}
+		maxDialTimeout, maxBitswapTimeout := cfg.MaxRequestDialTimeout, cfg.MaxRequestBitswapTimeout
+		if ownsPeer {
+			maxDialTimeout, maxBitswapTimeout = cfg.Ownership.MaxRequestDialTimeout, cfg.Ownership.MaxRequestBitswapTimeout
+		}
+
+		opts := cfg.checkOptions()
+		opts.OnStage = d.active.onStage(r.Context())
+		opts.Path = cidPath
+		if ipniURL != "" {
+			if u, err := url.Parse(ipniURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				writeInvalidParam(w, "ipniIndexer", "Invalid ipniIndexer value (http(s) URL of an IPNI indexer)")
+				return
+			}
+			opts.IPNIIndexer = ipniURL
+		} else {
+			opts.IPNIIndexer = d.routers.pick(cfg)
+		}
+		if fetchBlockStr != "" {
+			opts.FetchBlock, err = strconv.ParseBool(fetchBlockStr)
+			if err != nil {
+				writeInvalidParam(w, "fetchBlock", "Invalid fetchBlock value (true or false)")
+				return
+			}
+		}
+		if autonatStr != "" {
+			opts.AutoNAT, err = strconv.ParseBool(autonatStr)
+			if err != nil {
+				writeInvalidParam(w, "autonat", "Invalid autonat value (true or false)")
+				return
+			}
+		}
+		if bitswapVersionsStr != "" {
+			opts.BitswapVersions, err = strconv.ParseBool(bitswapVersionsStr)
+			if err != nil {
+				writeInvalidParam(w, "bitswapVersions", "Invalid bitswapVersions value (true or false)")
+				return
+			}
+		}
+		if deepStr != "" {
+			opts.DeepCheck, err = strconv.ParseBool(deepStr)
+			if err != nil {
+				writeInvalidParam(w, "deep", "Invalid deep value (true or false)")
+				return
+			}
+		}
+		dialTimeout, err := parseTimeoutParam(r.URL.Query(), "dialTimeoutSec", maxDialTimeout)
+		if err != nil {
+			writeInvalidParam(w, "dialTimeoutSec", err.Error())
+			return
+		}
+		if dialTimeout != 0 {
+			opts.ProviderDialTimeout = dialTimeout
+			opts.PeerDialTimeout = dialTimeout
+			opts.AddrDialTimeout = dialTimeout
+			// The budget of the stage does not cut the timeout asked for
+			if opts.StageBudgets.Dial > 0 {
+				opts.StageBudgets.Dial = max(opts.StageBudgets.Dial, dialTimeout)
+			}
+		}
+		bitswapTimeout, err := parseTimeoutParam(r.URL.Query(), "bitswapTimeoutSec", maxBitswapTimeout)
+		if err != nil {
+			writeInvalidParam(w, "bitswapTimeoutSec", err.Error())
+			return
+		}
+		if bitswapTimeout != 0 {
+			opts.BitswapTimeout = bitswapTimeout
+			if opts.StageBudgets.Bitswap > 0 {
+				opts.StageBudgets.Bitswap = max(opts.StageBudgets.Bitswap, bitswapTimeout)
+			}
+		}
+		opts.MaxProviders, err = parseIntParam(r.URL.Query(), "maxProviders", opts.MaxProviders, 1, cfg.MaxRequestProviders)
+		if err != nil {
+			writeInvalidParam(w, "maxProviders", err.Error())
+			return
+		}
+		if throughputStr != "" {
+			if cfg.MaxRequestThroughputMiB == 0 {
+				writeInvalidParam(w, "throughputMiB", "throughput measurements are disabled on this ipfs-check instance")
+				return
+			}
+			opts.ThroughputMiB, err = parseIntParam(r.URL.Query(), "throughputMiB", 0, 1, cfg.MaxRequestThroughputMiB)
+			if err != nil {
+				writeInvalidParam(w, "throughputMiB", err.Error())
+				return
+			}
+			// Downloading the data takes longer than the Bitswap stage of
+			// other checks
+			opts.StageBudgets.Bitswap = 0
+		}
+		opts.Retries, err = parseIntParam(r.URL.Query(), "retries", opts.Retries, 0, check.MaxRetries)
+		if err != nil {
+			writeInvalidParam(w, "retries", err.Error())
+			return
+		}
+		if providerSelection != "" {
+			if !slices.Contains(check.ProviderSelections, providerSelection) {
+				writeInvalidParam(w, "providerSelection", fmt.Sprintf("Invalid providerSelection value (%s)", strings.Join(check.ProviderSelections, ", ")))
+				return
+			}
+			opts.ProviderSelection = providerSelection
+		}
+		if preferQUICStr != "" {
+			opts.PreferQUIC, err = strconv.ParseBool(preferQUICStr)
+			if err != nil {
+				writeInvalidParam(w, "preferQUIC", "Invalid preferQUIC value (true or false)")
+				return
+			}
+		}
+		if filecoinStr != "" {
+			opts.FilecoinRetrieval, err = strconv.ParseBool(filecoinStr)
+			if err != nil {
+				writeInvalidParam(w, "filecoin", "Invalid filecoin value (true or false)")
 				return
 			}
 		}
+		if rankBy != "" {
+			if !slices.Contains(check.RankMetrics, rankBy) {
+				writeInvalidParam(w, "rankBy", fmt.Sprintf("Invalid rankBy value (%s)", strings.Join(check.RankMetrics, ", ")))
+				return
+			}
+			opts.RankBy = rankBy
+			// The throughput is measured by downloading the block
+			opts.FetchBlock = opts.FetchBlock || rankBy == check.RankByThroughput
+		}
 
-		if ipniURL == "" {
-			ipniURL = defaultIndexerURL
+		var federated bool
+		if federatedStr != "" {
+			federated, err = strconv.ParseBool(federatedStr)
+			if err != nil {
+				writeInvalidParam(w, "federated", "Invalid federated value (true or false)")
+				return
+			}
+			if federated && len(cfg.Federation) == 0 {
+				writeInvalidParam(w, "federated", "no federated ipfs-check instances are configured")
+				return
+			}
+		}
+
+		if dagStr != "" {
+			dag, err := strconv.ParseBool(dagStr)
+			if err != nil {
+				writeInvalidParam(w, "dag", "Invalid dag value (true or false)")
+				return
+			}
+			dagMaxBlocks := 0
+			if ownsPeer {
+				dagMaxBlocks = cfg.Ownership.DAGMaxBlocks
+			} else if k := cfg.apiKeyNamed(apiKeyName(r.Context())); k != nil {
+				dagMaxBlocks = k.DAGMaxBlocks
+			}
+			if dag && dagMaxBlocks == 0 {
+				writeError(w, http.StatusForbidden, errCodeOwnerRequired, "'dag' requires the owner token of the peer of 'multiaddr', see /ownership/challenge, or an API key allowing DAG checks", nil)
+				return
+			}
+			if dag && maStr == "" {
+				writeInvalidParam(w, "dag", "'dag' requires a 'multiaddr'")
+				return
+			}
+			if dag && federated {
+				writeInvalidParam(w, "dag", "'dag' and 'federated' can not be used together")
+				return
+			}
+			if dag {
+				opts.DAGMaxBlocks = dagMaxBlocks
+				// Downloading the DAG takes longer than the Bitswap stage of
+				// other checks
+				opts.StageBudgets.Bitswap = 0
+			}
+		}
+
+		var exportCAR bool
+		if carStr != "" {
+			exportCAR, err = strconv.ParseBool(carStr)
+			if err != nil {
+				writeInvalidParam(w, "car", "Invalid car value (true or false)")
+				return
+			}
+			if exportCAR && federated {
+				writeInvalidParam(w, "car", "'car' and 'federated' can not be used together")
+				return
+			}
+		}
+		var carDepth int
+		if carDepthStr != "" {
+			carDepth, err = strconv.Atoi(carDepthStr)
+			if err != nil || carDepth < 0 {
+				writeInvalidParam(w, "carDepth", "Invalid carDepth value (number of levels of links to follow)")
+				return
+			}
+		}
+
+		if transport != "" {
+			if !slices.Contains(check.Transports, transport) {
+				writeInvalidParam(w, "transport", fmt.Sprintf("Invalid transport value (%s)", strings.Join(check.Transports, ", ")))
+				return
+			}
+			opts.Transport = transport
+		}
+
+		var nocache bool
+		if nocacheStr != "" {
+			nocache, err = strconv.ParseBool(nocacheStr)
+			if err != nil {
+				writeInvalidParam(w, "nocache", "Invalid nocache value (true or false)")
+				return
+			}
+		}
+
+		var planOnly bool
+		if planStr != "" {
+			planOnly, err = strconv.ParseBool(planStr)
+			if err != nil {
+				writeInvalidParam(w, "plan", "Invalid plan value (true or false)")
+				return
+			}
+		}
+
+		var attest bool
+		if attestStr != "" {
+			attest, err = strconv.ParseBool(attestStr)
+			if err != nil {
+				writeInvalidParam(w, "attest", "Invalid attest value (true or false)")
+				return
+			}
+			if attest && !cfg.Attestations.Enabled {
+				writeInvalidParam(w, "attest", "Attestations are not enabled on this instance")
+				return
+			}
+			if attest && (federated || exportCAR || planOnly) {
+				writeInvalidParam(w, "attest", "'attest' can not be used with 'federated', 'car' or 'plan'")
+				return
+			}
+		}
+
+		var gatewayRetrieval bool
+		if gatewayStr != "" {
+			gatewayRetrieval, err = strconv.ParseBool(gatewayStr)
+			if err != nil {
+				writeInvalidParam(w, "gateway", "Invalid gateway value (true or false)")
+				return
+			}
+		}
+
+		var verdict bool
+		if verdictStr != "" {
+			verdict, err = strconv.ParseBool(verdictStr)
+			if err != nil {
+				writeInvalidParam(w, "verdict", "Invalid verdict value (true or false)")
+				return
+			}
+			if verdict && (federated || exportCAR || planOnly) {
+				writeInvalidParam(w, "verdict", "'verdict' can not be used with 'federated', 'car' or 'plan'")
+				return
+			}
+		}
+
+		var providers []peer.AddrInfo
+		var ma multiaddr.Multiaddr
+		if len(providerStrs) > 0 {
+			if maStr != "" {
+				writeInvalidParam(w, "providers", "'providers' and 'multiaddr' can not be used together")
+				return
+			}
+			providers, err = parseProviders(providerStrs)
+			if err != nil {
+				writeInvalidParam(w, "providers", err.Error())
+				return
+			}
+			if len(providers) > opts.MaxProviders {
+				writeInvalidParam(w, "providers", fmt.Sprintf("at most %d providers can be passed", opts.MaxProviders))
+				return
+			}
+		} else if maStr != "" {
+			ma, err = parseMultiaddr(maStr)
+			if err != nil {
+				writeInvalidParam(w, "multiaddr", err.Error())
+				return
+			}
+		}
+
+		if verdict && (ma != nil || gatewayRetrieval) {
+			writeInvalidParam(w, "verdict", "'verdict' summarizes the providers of a CID, and can not be used with 'multiaddr' or 'gateway'")
+			return
+		}
+
+		if rankBy != "" && (ma != nil || gatewayRetrieval) {
+			writeInvalidParam(w, "rankBy", "'rankBy' ranks the providers of a CID, and can not be used with 'multiaddr' or 'gateway'")
+			return
+		}
+
+		if opts.ThroughputMiB > 0 && (ma == nil || len(peerCIDs) > 0) {
+			writeInvalidParam(w, "throughputMiB", "'throughputMiB' requires a 'multiaddr' and a single 'cid'")
+			return
+		}
+
+		if len(peerCIDs) > 0 && (ma == nil || exportCAR || planOnly || gatewayRetrieval) {
+			writeInvalidParam(w, "cid", "'cid' can only be passed several times with a 'multiaddr', and not with 'car', 'plan' or 'gateway'")
+			return
+		}
+
+		if gatewayRetrieval && (ma != nil || len(providers) > 0 || len(cidPath) > 0 || exportCAR || planOnly || federated) {
+			writeInvalidParam(w, "gateway", "'gateway' can only be used with a CID without a path, and not with 'multiaddr', 'providers', 'car', 'plan' or 'federated'")
+			return
+		}
+
+		if ma == nil && len(providers) == 0 && cidKey.Prefix().MhType == multihash.IDENTITY {
+			writeInvalidParam(w, "cid", fmt.Sprintf("%s is an identity CID: its data is inlined in the CID, so it never needs to be retrieved from providers", cidKey))
+			return
+		}
+
+		if err := d.checker.Denied(cidKey, ma); err != nil {
+			writeCheckError(w, err, 0)
+			return
+		}
+		for _, c := range peerCIDs {
+			if err := d.checker.Denied(c, ma); err != nil {
+				writeCheckError(w, err, 0)
+				return
+			}
+		}
+
+		if ma == nil && len(providers) == 0 && !planOnly && check.IsPieceCID(cidKey) {
+			// Piece CIDs have no providers to check, their payload CIDs do
+			ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+			defer cancel()
+			out := d.checker.CheckPieceCID(ctx, cidKey, opts)
+			out.CID.Multibase = cidMultibase
+			if d.validateResponses {
+				if err := validateResponse(out); err != nil {
+					writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+					return
+				}
+			}
+			writeResponse(w, r, out)
+			return
+		}
+
+		if planOnly {
+			// Describe the check without running it
+			var plan check.CheckPlan
+			if len(providers) > 0 {
+				plan = d.checker.PlanProviders(cidKey, providers, opts)
+			} else if ma == nil {
+				plan = d.checker.PlanCID(cidKey, opts)
+			} else if plan, err = d.checker.PlanPeer(ma, cidKey, opts); err != nil {
+				writeInvalidParam(w, "multiaddr", err.Error())
+				return
+			}
+			plan.CID.Multibase = cidMultibase
+			if d.validateResponses {
+				if err := validateResponse(plan); err != nil {
+					writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+					return
+				}
+			}
+			writeResponse(w, r, plan)
+			return
 		}
 
 		log.Printf("Checking %s with timeout %s seconds", cidStr, checkTimeout.String())
-		withTimeout, cancel := context.WithTimeout(r.Context(), checkTimeout)
-		defer cancel()
+
+		// Run the check from the federated instances at the same time as the local one
+		var vantagePoints chan []vantagePointOutput
+		if federated {
+			vantagePoints = make(chan []vantagePointOutput, 1)
+			go func() {
+				vantagePoints <- checkVantagePoints(r.Context(), cfg.Federation, r.URL.Query(), checkTimeout)
+			}()
+		}
+		start := time.Now()
+
+		// Federated checks are not cached, as each instance caches its own results
+		cacheKey := checkCacheKey(r.URL.Query(), opts, apiKeyName(r.Context()), owner)
+		useCache := d.cache != nil && !federated
 
 		var data interface{}
-		if maStr == "" {
-			data, err = d.runCidCheck(withTimeout, cidKey, ipniURL)
+		var cached, shared bool
+		// Attestations are of what the check observes now, not of cached results
+		if useCache && !nocache && !attest {
+			data, cached = d.cache.get(cacheKey)
+		}
+		if cached {
+			log.Printf("Serving the cached result of the check of %s", cidStr)
 		} else {
-			ma, ai, err400 := parseMultiaddr(maStr)
-			if err400 != nil {
-				http.Error(w, err400.Error(), http.StatusBadRequest)
-				return
+			// Clients checking the same thing at the same time share a single check
+			data, shared, err = d.flights.do(r.Context(), cacheKey, checkTimeout, func(ctx context.Context) (interface{}, error) {
+				var data interface{}
+				var err error
+				if gatewayRetrieval {
+					data, err = d.checker.SimulateGatewayRetrieval(ctx, cidKey, opts)
+				} else if len(peerCIDs) > 0 {
+					data, err = d.runPeerCIDsCheck(ctx, ma, peerCIDs, opts)
+				} else if len(providers) > 0 {
+					data, err = d.runProvidersCheck(ctx, cidKey, providers, opts)
+				} else if ma == nil {
+					data, err = d.runCidCheck(ctx, cidKey, opts)
+				} else {
+					data, err = d.runPeerCheck(ctx, ma, cidKey, opts)
+				}
+				setCIDMultibase(data, cidMultibase)
+				return data, err
+			})
+			if shared {
+				log.Printf("Sharing the result of the check of %s with concurrent clients\n", cidStr)
 			}
-			data, err = d.runPeerCheck(withTimeout, ma, ai, cidKey, ipniURL)
+		}
+		if context.Cause(r.Context()) == errCheckDeadline {
+			// The check was cut at maxCheckDuration, its partial result is
+			// neither cached nor sent
+			writeError(w, http.StatusGatewayTimeout, errCodeTimeout, errCheckDeadline.Error(), nil)
+			return
+		}
+		if r.Context().Err() != nil {
+			// The client went away, which aborted the check. Its partial
+			// result is neither cached nor sent.
+			log.Printf("Check of %s aborted by the client after %s\n", cidStr, time.Since(start).Round(time.Millisecond))
+			return
+		}
+		if useCache && !cached && err == nil {
+			d.cache.add(cacheKey, data)
+		}
+		if federated {
+			local := vantagePointOutput{Available: checkAvailable(data), Result: data, Duration: time.Since(start), CheckerInfo: d.checker.CheckerInfo()}
+			if err != nil {
+				local = vantagePointOutput{Error: err.Error(), Duration: local.Duration, CheckerInfo: local.CheckerInfo}
+			}
+			data = federatedCheckOutput{VantagePoints: append([]vantagePointOutput{local}, <-vantagePoints...)}
+			err = nil
 		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeCheckError(w, err, 0)
+			return
+		}
+		if out, ok := data.(cidCheckOutput); ok && verdict {
+			data = withVerdict(out)
+		}
+		if exportCAR {
+			// The export gets its own timeout as the check may have used most of it
+			exportCtx, exportCancel := context.WithTimeout(r.Context(), checkTimeout)
+			defer exportCancel()
+			d.serveCAR(exportCtx, w, data, maStr, cidKey, carDepth, opts)
 			return
 		}
-		w.Header().Add("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(data)
+		if d.validateResponses {
+			if err := validateResponse(data); err != nil {
+				log.Printf("Invalid response: %v\n", err)
+				writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+				return
+			}
+		}
+		if attest {
+			a, err := d.checker.Attest(attestationQuery(r.URL.Query()), start, data)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+				return
+			}
+			writeResponse(w, r, a)
+			return
+		}
+		writeResponse(w, r, data)
 	}
 
 	// Register the default Go collector
@@ -184,10 +656,44 @@ func startServer(ctx context.Context, d *daemon, tcpListener, metricsUsername, m
 		Help: "Number of HTTP requests currently being served",
 	})
 
+	d.resourceLimitedChecks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_check_resource_limited_checks_total",
+		Help: "Number of peer checks that failed because the resource manager of ipfs-check refused a connection or stream",
+	})
+
+	runningChecks := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ipfs_check_running_checks",
+		Help: "Number of checks running",
+	}, func() float64 { return float64(d.queue.stats().Running) })
+	queuedChecks := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ipfs_check_queued_checks",
+		Help: "Number of checks waiting for a running check to end",
+	}, func() float64 { return float64(d.queue.stats().Queued) })
+
 	// Register metrics with our custom registry
 	d.promRegistry.MustRegister(requestsTotal)
 	d.promRegistry.MustRegister(requestDuration)
 	d.promRegistry.MustRegister(requestsInFlight)
+	d.promRegistry.MustRegister(d.resourceLimitedChecks)
+	d.promRegistry.MustRegister(runningChecks)
+	d.promRegistry.MustRegister(queuedChecks)
+	d.promRegistry.MustRegister(d.routers.checks)
+	if d.rateLimiter != nil {
+		d.promRegistry.MustRegister(d.rateLimiter.keyRequests)
+	}
+	if d.events != nil {
+		d.promRegistry.MustRegister(d.events.events)
+	}
+
+	// The API has its own mux, so that nothing registered on the default one,
+	// e.g. by net/http/pprof, is served publicly
+	mux := http.NewServeMux()
+
+	var checkEndpoint http.Handler = d.trackChecks(http.HandlerFunc(checkHandler))
+	if d.rateLimiter != nil {
+		checkEndpoint = d.rateLimiter.middleware(checkEndpoint)
+	}
+	checkEndpoint = bodyQuery(checkEndpoint)
 
 	// Instrument the checkHandler
 	instrumentedHandler := promhttp.InstrumentHandlerCounter(
@@ -196,37 +702,191 @@ func startServer(ctx context.Context, d *daemon, tcpListener, metricsUsername, m
 			requestDuration,
 			promhttp.InstrumentHandlerInFlight(
 				requestsInFlight,
-				http.HandlerFunc(checkHandler),
+				checkEndpoint,
 			),
 		),
 	)
 
-	http.Handle("/check", instrumentedHandler)
+	mux.Handle("/check", instrumentedHandler)
+
+	// The other check endpoints also take their query parameters in the JSON
+	// body of POST requests
+	handleCheck := func(pattern string, endpoint http.Handler) {
+		mux.Handle("GET "+pattern, endpoint)
+		mux.Handle("POST "+pattern, bodyQuery(endpoint))
+	}
 
 	// Use a single metrics endpoint for all Prometheus metrics
-	http.Handle("/metrics", BasicAuth(promhttp.HandlerFor(d.promRegistry, promhttp.HandlerOpts{}), metricsUsername, metricPassword))
-
-	// Serve frontend on /web
-	fileServer := http.FileServer(http.FS(webFS))
-	http.Handle("/web/", fileServer)
-	// Set up the root route to redirect to /web
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/web", http.StatusFound)
-	})
+	mux.Handle("/metrics", BasicAuth(promhttp.HandlerFor(d.promRegistry, promhttp.HandlerOpts{}), metricsUsername, metricPassword))
+
+	// Active checks reveal what others check, so they are protected like the metrics
+	mux.Handle("GET /checks/active", BasicAuth(http.HandlerFunc(d.activeChecksHandler), metricsUsername, metricPassword))
+
+	mux.HandleFunc("GET /dht/status", d.dhtStatusHandler)
 
+	mux.HandleFunc("GET /network/status", d.networkStatusHandler)
+
+	mux.HandleFunc("GET /checker", d.checkerInfoHandler)
+
+	mux.HandleFunc("GET /ready", d.readyHandler)
+
+	var watchEndpoint http.Handler = http.HandlerFunc(d.watchHandler)
+	if d.rateLimiter != nil {
+		watchEndpoint = d.rateLimiter.middleware(watchEndpoint)
+	}
+	mux.Handle("GET /watch", watchEndpoint)
+
+	var pinningServiceEndpoint http.Handler = d.trackChecks(http.HandlerFunc(d.pinningServiceHandler))
+	if d.rateLimiter != nil {
+		pinningServiceEndpoint = d.rateLimiter.middleware(pinningServiceEndpoint)
+	}
+	handleCheck("/check/pinning-service", pinningServiceEndpoint)
+
+	var nodeCheckEndpoint http.Handler = d.trackChecks(http.HandlerFunc(d.nodeCheckHandler))
+	if d.rateLimiter != nil {
+		nodeCheckEndpoint = d.rateLimiter.middleware(nodeCheckEndpoint)
+	}
+	handleCheck("/check/node/{peerID}", nodeCheckEndpoint)
+
+	var browserCheckEndpoint http.Handler = d.trackChecks(http.HandlerFunc(d.browserCheckHandler))
+	if d.rateLimiter != nil {
+		browserCheckEndpoint = d.rateLimiter.middleware(browserCheckEndpoint)
+	}
+	handleCheck("/check/browser", browserCheckEndpoint)
+
+	var ipnsCheckEndpoint http.Handler = d.trackChecks(http.HandlerFunc(d.ipnsCheckHandler))
+	if d.rateLimiter != nil {
+		ipnsCheckEndpoint = d.rateLimiter.middleware(ipnsCheckEndpoint)
+	}
+	handleCheck("/check/ipns/{name}", ipnsCheckEndpoint)
+
+	var censusEndpoint http.Handler = d.trackChecks(http.HandlerFunc(d.censusHandler))
+	if d.rateLimiter != nil {
+		censusEndpoint = d.rateLimiter.middleware(censusEndpoint)
+	}
+	handleCheck("/check/census/{cid}", censusEndpoint)
+
+	mux.HandleFunc("GET /schemas/{file}", schemaHandler)
+
+	if d.config().LocalNetwork {
+		mux.HandleFunc("GET /local/peers", d.localPeersHandler)
+		log.Printf("Local peers endpoint at %s/local/peers\n", webURL)
+	}
+
+	if d.config().Ownership.Enabled {
+		d.startOwnershipProofs()
+		var ownershipChallengeEndpoint http.Handler = http.HandlerFunc(d.ownershipChallengeHandler)
+		if d.rateLimiter != nil {
+			ownershipChallengeEndpoint = d.rateLimiter.middleware(ownershipChallengeEndpoint)
+		}
+		mux.Handle("POST /ownership/challenge", ownershipChallengeEndpoint)
+		mux.HandleFunc("GET /ownership/challenge/{nonce}", d.ownershipStatusHandler)
+		log.Printf("Ownership proof endpoints at %s/ownership/challenge\n", webURL)
+	}
+
+	if d.provideTest != nil {
+		mux.Handle("POST /dht/provide-test", d.provideTest)
+		log.Printf("Provide test endpoint at %s/dht/provide-test\n", webURL)
+	}
+
+	if d.monitor != nil {
+		// Registering targets makes the daemon do work on its own, so it is protected like the metrics
+		mux.Handle("/monitor", BasicAuth(d.monitor, metricsUsername, metricPassword))
+	}
+
+	if d.history != nil {
+		mux.HandleFunc("GET /stats/peer/{peerID}", d.history.peerStatsHandler)
+		mux.HandleFunc("GET /stats/aggregate", d.history.aggregateStatsHandler)
+		log.Printf("Peer stats endpoint at %s/stats/peer/{peerID}\n", webURL)
+	}
+
+	if d.adminToken != "" {
+		mux.Handle("/admin/", d.adminHandler())
+		log.Printf("Admin endpoints at %s/admin/\n", webURL)
+	}
+
+	// Serve the web UI on /, and on /web for the links to its former location
+	mux.Handle("/", ui)
+	mux.Handle("/web/", http.StripPrefix("/web", ui))
+
+	d.startServices(ctx)
+
+	handler := d.corsMiddleware(mux)
+	var h3 *http3.Server
+	if tlsOpts.http3 {
+		// HTTP/3 is served on the UDP port of the same number
+		udp, err := net.ListenPacket("udp", l.Addr().String())
+		if err != nil {
+			_ = l.Close()
+			return err
+		}
+		h3 = &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tlsConf)}
+		handler = altSvcMiddleware(h3, handler)
+		go func() {
+			if err := h3.Serve(udp); err != nil && err != http.ErrServerClosed {
+				log.Printf("Error serving HTTP/3: %v\n", err)
+			}
+		}()
+	}
+
+	srv := &http.Server{Handler: handler, TLSConfig: tlsConf}
 	done := make(chan error, 1)
 	go func() {
 		defer close(done)
-		done <- http.Serve(l, nil)
+		if tlsConf != nil {
+			// Serving over TLS also negotiates HTTP/2
+			done <- srv.ServeTLS(l, "", "")
+			return
+		}
+		done <- srv.Serve(l)
 	}()
+	switch {
+	case h3 != nil:
+		log.Printf("Backend listening on %v over HTTP/1.1, HTTP/2 and HTTP/3\n", l.Addr())
+	case tlsConf != nil:
+		log.Printf("Backend listening on %v over HTTP/1.1 and HTTP/2\n", l.Addr())
+	default:
+		log.Printf("Backend listening on %v\n", l.Addr())
+	}
+	log.Printf("DHT status endpoint at %s/dht/status\n", webURL)
+	log.Printf("Network status endpoint at %s/network/status\n", webURL)
+	log.Printf("Readiness endpoint at %s/ready\n", webURL)
+
+	if d.waitReady(ctx) {
+		if d.config().SelfTest.Enabled {
+			go d.runSelfTests(ctx)
+		}
+		log.Printf("Web UI at %s/\n", webURL)
+		log.Printf("Metrics endpoint at %s/metrics\n", webURL)
+		if d.monitor != nil {
+			d.monitor.start(ctx)
+			log.Printf("Monitor endpoint at %s/monitor\n", webURL)
+		}
+		log.Printf("Ready to start serving.")
+	}
 
 	select {
 	case err := <-done:
 		return err
 	case <-ctx.Done():
-		_ = l.Close()
-		return <-done
 	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight checks to finish", drainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		log.Printf("Drain timeout reached, aborting remaining checks")
+		// Closing the connections cancels the contexts of the remaining requests
+		_ = srv.Close()
+	}
+	if h3 != nil {
+		// The HTTP/3 server of quic-go can not be drained yet
+		_ = h3.Close()
+	}
+	if err := <-done; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 func BasicAuth(handler http.Handler, username, password string) http.Handler {
@@ -240,7 +900,7 @@ func BasicAuth(handler http.Handler, username, password string) http.Handler {
 
 		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "Unauthorized", nil)
 			return
 		}
 
@@ -263,14 +923,113 @@ func getWebAddress(l net.Listener) string {
 	}
 }
 
-func parseMultiaddr(maStr string) (multiaddr.Multiaddr, *peer.AddrInfo, error) {
+func parseMultiaddr(maStr string) (multiaddr.Multiaddr, error) {
 	ma, err := multiaddr.NewMultiaddr(maStr)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	ai, err := peer.AddrInfoFromP2pAddr(ma)
-	if err != nil {
-		return nil, nil, err
+	if _, err := ma.ValueForProtocol(multiaddr.P_P2P); err != nil {
+		return nil, fmt.Errorf("multiaddr %s is missing the /p2p/<peer-id> component", ma)
+	}
+	if _, err := peer.AddrInfoFromP2pAddr(ma); err != nil {
+		return nil, err
+	}
+	return ma, nil
+}
+
+// parseProviders parses the multiaddrs passed in the providers query
+// parameter, either repeated or comma separated, grouping them by peer
+func parseProviders(providerStrs []string) ([]peer.AddrInfo, error) {
+	var addrs []multiaddr.Multiaddr
+	for _, s := range providerStrs {
+		for _, maStr := range strings.Split(s, ",") {
+			maStr = strings.TrimSpace(maStr)
+			if maStr == "" {
+				continue
+			}
+			ma, err := parseMultiaddr(maStr)
+			if err != nil {
+				return nil, err
+			}
+			addrs = append(addrs, ma)
+		}
+	}
+	return peer.AddrInfosFromP2pAddrs(addrs...)
+}
+
+// parseTimeoutParam parses the query parameter name as a number of seconds of
+// at most maxTimeout, returning 0 when it is not set
+func parseTimeoutParam(query url.Values, name string, maxTimeout time.Duration) (time.Duration, error) {
+	str := query.Get(name)
+	if str == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(str + "s")
+	if err != nil || timeout <= 0 || timeout > maxTimeout {
+		return 0, fmt.Errorf("Invalid %s value (in seconds, at most %d)", name, int(maxTimeout.Seconds()))
+	}
+	return timeout, nil
+}
+
+// parseIntParam parses the query parameter name as an integer from lo to hi,
+// returning def when it is not set
+func parseIntParam(query url.Values, name string, def, lo, hi int) (int, error) {
+	str := query.Get(name)
+	if str == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("Invalid %s value (%d to %d)", name, lo, hi)
+	}
+	return n, nil
+}
+
+// parsePeerCIDs parses the CIDs of a multi-CID check, which can not have
+// paths or duplicates
+func parsePeerCIDs(cidStrs []string) ([]cid.Cid, error) {
+	if len(cidStrs) > check.MaxPeerCIDs {
+		return nil, fmt.Errorf("at most %d CIDs can be checked at once", check.MaxPeerCIDs)
+	}
+	cids := make([]cid.Cid, 0, len(cidStrs))
+	for _, s := range cidStrs {
+		c, _, p, err := parseContentPath(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) > 0 {
+			return nil, fmt.Errorf("%s: paths can not be checked with several CIDs", s)
+		}
+		if slices.Contains(cids, c) {
+			return nil, fmt.Errorf("%s is passed more than once", s)
+		}
+		cids = append(cids, c)
+	}
+	return cids, nil
+}
+
+// parseCid decodes a CID in any multibase, falling back to interpreting the
+// input as a base58, hex or multibase encoded multihash wrapped in a raw
+// CIDv1. It also returns the name of the multibase of the input.
+func parseCid(cidStr string) (cid.Cid, string, error) {
+	cidKey, err := cid.Decode(cidStr)
+	if err == nil {
+		enc, err := cid.ExtractEncoding(cidStr)
+		if err != nil {
+			return cid.Undef, "", err
+		}
+		return cidKey, multibase.EncodingToStr[enc], nil
+	}
+	if mh, mhErr := multihash.FromB58String(cidStr); mhErr == nil {
+		return cid.NewCidV1(cid.Raw, mh), multibase.EncodingToStr[multibase.Base58BTC], nil
+	}
+	if mh, mhErr := multihash.FromHexString(cidStr); mhErr == nil {
+		return cid.NewCidV1(cid.Raw, mh), multibase.EncodingToStr[multibase.Base16], nil
+	}
+	if enc, data, mbErr := multibase.Decode(cidStr); mbErr == nil {
+		if mh, mhErr := multihash.Cast(data); mhErr == nil {
+			return cid.NewCidV1(cid.Raw, mh), multibase.EncodingToStr[enc], nil
+		}
 	}
-	return ma, ai, nil
+	return cid.Undef, "", fmt.Errorf("%s is neither a CID nor a multihash: %w", cidStr, err)
 }
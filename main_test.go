@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeoutParam(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		timeout time.Duration
+		valid   bool
+	}{
+		{value: "", timeout: 0, valid: true},
+		{value: "5", timeout: 5 * time.Second, valid: true},
+		{value: "0.5", timeout: 500 * time.Millisecond, valid: true},
+		{value: "60", timeout: time.Minute, valid: true},
+		{value: "0"},
+		{value: "-5"},
+		{value: "61"},
+		{value: "5s"},
+		{value: "abc"},
+	} {
+		query := url.Values{}
+		if tc.value != "" {
+			query.Set("dialTimeoutSec", tc.value)
+		}
+		timeout, err := parseTimeoutParam(query, "dialTimeoutSec", time.Minute)
+		if !tc.valid {
+			require.Error(t, err, tc.value)
+			require.Contains(t, err.Error(), "at most 60", tc.value)
+			continue
+		}
+		require.NoError(t, err, tc.value)
+		require.Equal(t, tc.timeout, timeout, tc.value)
+	}
+}
+
+func TestParseIntParam(t *testing.T) {
+	maxProviders := defaultConfig().MaxRequestProviders
+	for _, tc := range []struct {
+		value string
+		n     int
+		valid bool
+	}{
+		{value: "", n: 7, valid: true},
+		{value: "1", n: 1, valid: true},
+		{value: "3", n: 3, valid: true},
+		{value: "0"},
+		{value: "-1"},
+		{value: "2.5"},
+		{value: "abc"},
+	} {
+		query := url.Values{}
+		if tc.value != "" {
+			query.Set("maxProviders", tc.value)
+		}
+		n, err := parseIntParam(query, "maxProviders", 7, 1, maxProviders)
+		if !tc.valid {
+			require.Error(t, err, tc.value)
+			continue
+		}
+		require.NoError(t, err, tc.value)
+		require.Equal(t, tc.n, n, tc.value)
+	}
+
+	// The bounds are inclusive
+	for n, valid := range map[int]bool{maxProviders: true, maxProviders + 1: false} {
+		query := url.Values{"maxProviders": {strconv.Itoa(n)}}
+		_, err := parseIntParam(query, "maxProviders", 7, 1, maxProviders)
+		require.Equal(t, valid, err == nil, n)
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// minimum interval at which a monitored target can be re-checked
+	minMonitorInterval = time.Minute
+)
+
+// monitor periodically re-runs checks for registered CIDs (optionally against
+// a specific peer) and keeps the latest result of each around so it can be
+// exposed via the HTTP API and as Prometheus gauges.
+type monitor struct {
+	d               *daemon
+	defaultInterval time.Duration
+	maxTargets      int
+	// webhooks notified of availability changes of every target
+	webhooks []string
+	// webhookClient posts to the webhooks of the config, and requestClient
+	// to the webhookURL of the targets, which come from requests and so
+	// are only posted to on the public addresses
+	webhookClient *http.Client
+	requestClient *http.Client
+
+	mu      sync.Mutex
+	ctx     context.Context
+	targets map[string]*monitorTarget
+
+	availableGauge *prometheus.GaugeVec
+	lastCheckGauge *prometheus.GaugeVec
+}
+
+type monitorTarget struct {
+	CID       string
+	Multiaddr string
+	IPNIURL   string
+	Interval  time.Duration
+	// Webhook is notified of availability changes in addition to the global webhooks
+	Webhook string
+	// APIKey is the name of the API key the target was added with, whose
+	// webhooks are also notified
+	APIKey string
+
+	// LastCheck is the zero time until the first check has completed
+	LastCheck time.Time
+	Available bool
+	Error     string
+	Result    interface{}
+
+	cancel context.CancelFunc
+}
+
+// monitorStatus is the JSON representation of a monitored target
+type monitorStatus struct {
+	CID       string
+	Multiaddr string
+	Interval  time.Duration
+	Webhook   string
+	APIKey    string
+	LastCheck time.Time
+	Available bool
+	Error     string
+	Result    interface{}
+}
+
+func newMonitor(d *daemon, defaultInterval time.Duration, maxTargets int, webhooks []string) *monitor {
+	m := &monitor{
+		d:               d,
+		defaultInterval: defaultInterval,
+		maxTargets:      maxTargets,
+		webhooks:        webhooks,
+		webhookClient:   &http.Client{Timeout: webhookTimeout},
+		requestClient:   (&check.AddrPolicy{}).HTTPClient(),
+		targets:         make(map[string]*monitorTarget),
+		availableGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ipfs_check_cid_available",
+			Help: "Whether a monitored CID was retrievable in its latest check (1 available, 0 unavailable)",
+		}, []string{"cid", "multiaddr"}),
+		lastCheckGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ipfs_check_cid_last_check_timestamp_seconds",
+			Help: "Unix timestamp of the latest check of a monitored CID",
+		}, []string{"cid", "multiaddr"}),
+	}
+	m.requestClient.Timeout = webhookTimeout
+	d.promRegistry.MustRegister(m.availableGauge)
+	d.promRegistry.MustRegister(m.lastCheckGauge)
+	return m
+}
+
+// start sets the context used by all monitoring loops. Targets added before
+// start are picked up once it is called.
+func (m *monitor) start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ctx = ctx
+	for _, t := range m.targets {
+		m.startTarget(t)
+	}
+}
+
+func monitorKey(cidKey, maStr string) string {
+	return cidKey + " " + maStr
+}
+
+// add registers a new target, or updates the settings of an existing one.
+// apiKey is the name of the API key it is added with, if any.
+func (m *monitor) add(cidKey cid.Cid, maStr, ipniURL, webhook, apiKey string, interval time.Duration) error {
+	if interval == 0 {
+		interval = m.defaultInterval
+	}
+	if interval < minMonitorInterval {
+		return fmt.Errorf("interval must be at least %s", minMonitorInterval)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := monitorKey(cidKey.String(), maStr)
+	if t, ok := m.targets[key]; ok {
+		if t.cancel != nil {
+			t.cancel()
+		}
+		t.Interval = interval
+		t.IPNIURL = ipniURL
+		t.Webhook = webhook
+		t.APIKey = apiKey
+		m.startTarget(t)
+		return nil
+	}
+
+	if m.maxTargets > 0 && len(m.targets) >= m.maxTargets {
+		return fmt.Errorf("maximum number of monitored targets (%d) reached", m.maxTargets)
+	}
+
+	t := &monitorTarget{
+		CID:       cidKey.String(),
+		Multiaddr: maStr,
+		IPNIURL:   ipniURL,
+		Interval:  interval,
+		Webhook:   webhook,
+		APIKey:    apiKey,
+	}
+	m.targets[key] = t
+	m.startTarget(t)
+	return nil
+}
+
+// remove stops monitoring a target. It returns false if the target was not monitored.
+func (m *monitor) remove(cidKey cid.Cid, maStr string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := monitorKey(cidKey.String(), maStr)
+	t, ok := m.targets[key]
+	if !ok {
+		return false
+	}
+	if t.cancel != nil {
+		t.cancel()
+	}
+	delete(m.targets, key)
+	m.availableGauge.DeleteLabelValues(t.CID, t.Multiaddr)
+	m.lastCheckGauge.DeleteLabelValues(t.CID, t.Multiaddr)
+	return true
+}
+
+// status returns a snapshot of all monitored targets sorted by CID and multiaddr
+func (m *monitor) status() []monitorStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]monitorStatus, 0, len(m.targets))
+	for _, t := range m.targets {
+		out = append(out, monitorStatus{
+			CID:       t.CID,
+			Multiaddr: t.Multiaddr,
+			Interval:  t.Interval,
+			Webhook:   t.Webhook,
+			APIKey:    t.APIKey,
+			LastCheck: t.LastCheck,
+			Available: t.Available,
+			Error:     t.Error,
+			Result:    t.Result,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CID != out[j].CID {
+			return out[i].CID < out[j].CID
+		}
+		return out[i].Multiaddr < out[j].Multiaddr
+	})
+	return out
+}
+
+// startTarget must be called with m.mu held
+func (m *monitor) startTarget(t *monitorTarget) {
+	if m.ctx == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	t.cancel = cancel
+	go m.loop(ctx, t.CID, t.Multiaddr, t.IPNIURL, t.Interval)
+}
+
+func (m *monitor) loop(ctx context.Context, cidStr, maStr, ipniURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.runOnce(ctx, cidStr, maStr, ipniURL)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *monitor) runOnce(ctx context.Context, cidStr, maStr, ipniURL string) {
+	cfg := m.d.config()
+	checkCtx, cancel := context.WithTimeout(ctx, cfg.CheckTimeout)
+	defer cancel()
+
+	opts := cfg.checkOptions()
+	opts.IPNIIndexer = ipniURL
+
+	var (
+		result    interface{}
+		available bool
+		errStr    string
+	)
+
+	cidKey, err := cid.Decode(cidStr)
+	if err != nil {
+		errStr = err.Error()
+	} else if maStr == "" {
+		out, err := m.d.runCidCheck(checkCtx, cidKey, opts)
+		if err != nil {
+			errStr = err.Error()
+		} else {
+			result = out
+			available = cidCheckAvailable(out)
+		}
+	} else {
+		ma, err := parseMultiaddr(maStr)
+		if err != nil {
+			errStr = err.Error()
+		} else {
+			out, err := m.d.runPeerCheck(checkCtx, ma, cidKey, opts)
+			if err != nil {
+				errStr = err.Error()
+			} else {
+				result = out
+				available = out.Available()
+			}
+		}
+	}
+
+	// Do not record results of checks aborted because the target was removed or the daemon is stopping
+	if ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.targets[monitorKey(cidStr, maStr)]
+	if !ok {
+		return
+	}
+
+	// Notify on state changes, but not on the first check of a target
+	if !t.LastCheck.IsZero() && t.Available != available {
+		payload := newWebhookPayload(cidStr, maStr, available, t.Available, now, errStr)
+		webhooks := m.webhooks
+		if k := m.d.config().apiKeyNamed(t.APIKey); k != nil {
+			webhooks = append(webhooks[:len(webhooks):len(webhooks)], k.Webhooks...)
+		}
+		if len(webhooks) > 0 {
+			notifyWebhooks(m.ctx, m.webhookClient, webhooks, payload)
+		}
+		if t.Webhook != "" {
+			notifyWebhooks(m.ctx, m.requestClient, []string{t.Webhook}, payload)
+		}
+	}
+
+	t.LastCheck = now
+	t.Available = available
+	t.Error = errStr
+	t.Result = result
+
+	availableValue := 0.0
+	if available {
+		availableValue = 1
+	}
+	m.availableGauge.WithLabelValues(cidStr, maStr).Set(availableValue)
+	m.lastCheckGauge.WithLabelValues(cidStr, maStr).Set(float64(now.Unix()))
+
+	log.Printf("Monitor check of %s (multiaddr %q) finished, available: %t", cidStr, maStr, available)
+}
+
+// cidCheckAvailable returns true if at least one provider served the block over Bitswap
+func cidCheckAvailable(out cidCheckOutput) bool {
+	if out == nil {
+		return false
+	}
+	for _, p := range *out {
+		if p.Available() {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP handles registration (POST), removal (DELETE) and listing (GET) of monitored targets
+func (m *monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeResponse(w, r, m.status())
+		return
+	}
+
+	cidStr := r.URL.Query().Get("cid")
+	maStr := r.URL.Query().Get("multiaddr")
+	if cidStr == "" {
+		writeMissingParam(w, "cid")
+		return
+	}
+	cidKey, _, err := parseCid(cidStr)
+	if err != nil {
+		writeInvalidParam(w, "cid", err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var ma multiaddr.Multiaddr
+		if maStr != "" {
+			if ma, err = parseMultiaddr(maStr); err != nil {
+				writeInvalidParam(w, "multiaddr", err.Error())
+				return
+			}
+		}
+
+		// webhookURL comes from anyone who can reach /monitor, so only
+		// the origins of the config are accepted
+		webhook := r.URL.Query().Get("webhookURL")
+		if webhook != "" {
+			if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				writeInvalidParam(w, "webhookURL", "Invalid webhook URL")
+				return
+			}
+			if !allowedOrigin(m.d.config().MonitorWebhookOrigins, webhook) {
+				writeInvalidParam(w, "webhookURL", "the webhook URL is not on one of the origins allowed by this ipfs-check instance")
+				return
+			}
+		}
+
+		if err := m.d.checker.Denied(cidKey, ma); err != nil {
+			writeCheckError(w, err, 0)
+			return
+		}
+
+		var interval time.Duration
+		if intervalStr := r.URL.Query().Get("intervalSeconds"); intervalStr != "" {
+			interval, err = time.ParseDuration(intervalStr + "s")
+			if err != nil {
+				writeInvalidParam(w, "intervalSeconds", "Invalid interval value (in seconds)")
+				return
+			}
+		}
+
+		ipniURL := r.URL.Query().Get("ipniIndexer")
+		if ipniURL == "" {
+			ipniURL = m.d.config().IPNIIndexer
+		}
+
+		// Targets added with an API key notify its webhooks
+		var apiKey string
+		if key := requestAPIKey(r); key != "" {
+			k := m.d.config().apiKeyWithKey(key)
+			if k == nil {
+				writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid API key", nil)
+				return
+			}
+			apiKey = k.Name
+		}
+
+		if err := m.add(cidKey, maStr, ipniURL, webhook, apiKey, interval); err != nil {
+			writeError(w, http.StatusBadRequest, errCodeInvalidParameter, err.Error(), nil)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if !m.remove(cidKey, maStr) {
+			writeError(w, http.StatusNotFound, errCodeNotFound, "target is not monitored", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "method not allowed", nil)
+	}
+}
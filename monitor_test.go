@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorTargets(t *testing.T) {
+	d := &daemon{promRegistry: prometheus.NewRegistry()}
+	m := newMonitor(d, time.Hour, 2, nil)
+
+	mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	testCid := cid.NewCidV1(cid.Raw, mh)
+
+	require.Error(t, m.add(testCid, "", defaultIndexerURL, "", "", time.Second), "interval below the minimum")
+	require.NoError(t, m.add(testCid, "", defaultIndexerURL, "", "", 0))
+	require.NoError(t, m.add(testCid, "/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK", defaultIndexerURL, "", "", 2*time.Hour))
+	require.Error(t, m.add(testCid, "/p2p/12D3KooWRTUNZVyVf7KBBNZ6MRR5SYGGjKzS6xyiU5zBeY9wxomo", defaultIndexerURL, "", "", 0), "max targets reached")
+
+	// re-adding an existing target only updates it
+	require.NoError(t, m.add(testCid, "", defaultIndexerURL, "", "", 3*time.Hour))
+
+	status := m.status()
+	require.Len(t, status, 2)
+	require.Equal(t, "", status[0].Multiaddr)
+	require.Equal(t, 3*time.Hour, status[0].Interval)
+	require.Equal(t, 2*time.Hour, status[1].Interval)
+
+	require.True(t, m.remove(testCid, ""))
+	require.False(t, m.remove(testCid, ""))
+	require.Len(t, m.status(), 1)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// nodeCheckHandler serves GET /check/node/{peerID}, the health report of a
+// node that only needs its peer ID, for operators checking their own node
+func (d *daemon) nodeCheckHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-IPFS-Check-Routing", d.checker.Routing())
+	cfg := d.config()
+	p, err := peer.Decode(r.PathValue("peerID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidParameter, "Invalid peer ID", map[string]string{"parameter": "peerID"})
+		return
+	}
+	checkTimeout := cfg.CheckTimeout
+	if timeoutStr := r.URL.Query().Get("timeoutSeconds"); timeoutStr != "" {
+		checkTimeout, err = time.ParseDuration(timeoutStr + "s")
+		if err != nil {
+			writeInvalidParam(w, "timeoutSeconds", "Invalid timeout value (in seconds)")
+			return
+		}
+	}
+
+	release, ok := d.acquireCheckSlot(w, r, cfg)
+	if !ok {
+		return
+	}
+	defer release()
+
+	log.Printf("Checking node %s with timeout %s\n", p, checkTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	out, err := d.checker.CheckNode(ctx, p, d.checkOptions(ctx, cfg))
+	if err != nil {
+		writeCheckError(w, err, 0)
+		return
+	}
+	if out.ResourceLimited {
+		d.countResourceLimited()
+	}
+
+	if d.validateResponses {
+		if err := validateResponse(out); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, out)
+}
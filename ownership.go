@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// The token of an ownership proof is passed in the ownerTokenHeader
+	// header or the ownerTokenParam query parameter
+	ownerTokenHeader = "X-IPFS-Check-Owner-Token"
+	ownerTokenParam  = "ownerToken"
+	// maxOwnershipChallenges bounds the challenges waiting to be signed
+	maxOwnershipChallenges = 10_000
+)
+
+var (
+	errTooManyChallenges = errors.New("too many ownership challenges are waiting to be signed, try again later")
+	errUnknownChallenge  = errors.New("unknown or expired challenge")
+)
+
+// ownershipChallengeOutput is the challenge a node operator answers to prove
+// control of a peer ID
+type ownershipChallengeOutput struct {
+	PeerID string
+	// Nonce is to be signed with the private key of the peer and sent over
+	// Protocol to one of CheckerAddrs, before ExpiresAt
+	Nonce        string
+	ExpiresAt    time.Time
+	Protocol     string
+	CheckerAddrs []string
+}
+
+// ownershipStatusOutput tells whether the nonce of a challenge was signed.
+// Token is then passed with the checks of the peer to unlock the owner
+// diagnostics until TokenExpiresAt.
+type ownershipStatusOutput struct {
+	PeerID         string
+	ExpiresAt      time.Time
+	Verified       bool
+	Token          string
+	TokenExpiresAt time.Time
+}
+
+type ownershipChallenge struct {
+	peer    peer.ID
+	expires time.Time
+	// token is set once the nonce is signed by the peer
+	token        string
+	tokenExpires time.Time
+}
+
+// ownerGrant is the peer a token proves the control of
+type ownerGrant struct {
+	peer    peer.ID
+	expires time.Time
+}
+
+// ownershipRegistry keeps the challenges of the ownership proofs, by nonce,
+// and the tokens of the verified ones
+type ownershipRegistry struct {
+	mu         sync.Mutex
+	challenges map[string]*ownershipChallenge
+	tokens     map[string]ownerGrant
+}
+
+func newOwnershipRegistry() *ownershipRegistry {
+	return &ownershipRegistry{
+		challenges: make(map[string]*ownershipChallenge),
+		tokens:     make(map[string]ownerGrant),
+	}
+}
+
+// challenge issues a nonce for p to sign within ttl
+func (o *ownershipRegistry) challenge(p peer.ID, ttl time.Duration) (string, time.Time, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pruneLocked()
+	if len(o.challenges) >= maxOwnershipChallenges {
+		return "", time.Time{}, errTooManyChallenges
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(ttl)
+	o.challenges[nonce] = &ownershipChallenge{peer: p, expires: expires}
+	return nonce, expires, nil
+}
+
+// accept verifies that nonce was issued to p, whose signature of it was
+// verified, and issues the token of the proof, valid for tokenTTL
+func (o *ownershipRegistry) accept(p peer.ID, nonce string, tokenTTL time.Duration) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ch, ok := o.challenges[nonce]
+	if !ok || time.Now().After(ch.expires) {
+		return errUnknownChallenge
+	}
+	if ch.peer != p {
+		return fmt.Errorf("the challenge was issued to %s, not %s", ch.peer, p)
+	}
+	if ch.token != "" {
+		return nil
+	}
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	ch.token, ch.tokenExpires = token, time.Now().Add(tokenTTL)
+	o.tokens[token] = ownerGrant{peer: p, expires: ch.tokenExpires}
+	log.Printf("Peer %s proved control of its peer ID\n", p)
+	return nil
+}
+
+// status returns the status of the challenge of nonce
+func (o *ownershipRegistry) status(nonce string) (ownershipStatusOutput, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pruneLocked()
+	ch, ok := o.challenges[nonce]
+	if !ok {
+		return ownershipStatusOutput{}, false
+	}
+	return ownershipStatusOutput{
+		PeerID:         ch.peer.String(),
+		ExpiresAt:      ch.expires,
+		Verified:       ch.token != "",
+		Token:          ch.token,
+		TokenExpiresAt: ch.tokenExpires,
+	}, true
+}
+
+// owner returns the peer whose control token proves
+func (o *ownershipRegistry) owner(token string) (peer.ID, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	g, ok := o.tokens[token]
+	if !ok || time.Now().After(g.expires) {
+		return "", false
+	}
+	return g.peer, true
+}
+
+// pruneLocked forgets the expired challenges and tokens, must be called
+// with mu held. The challenges of valid tokens are kept so their status can
+// be queried.
+func (o *ownershipRegistry) pruneLocked() {
+	now := time.Now()
+	for nonce, ch := range o.challenges {
+		if now.After(ch.expires) && (ch.token == "" || now.After(ch.tokenExpires)) {
+			delete(o.challenges, nonce)
+		}
+	}
+	for token, g := range o.tokens {
+		if now.After(g.expires) {
+			delete(o.tokens, token)
+		}
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// startOwnershipProofs serves the ownership protocol on the host of the
+// checker
+func (d *daemon) startOwnershipProofs() {
+	d.ownership = newOwnershipRegistry()
+	d.checker.HandleOwnershipProofs(func(p peer.ID, nonce string) error {
+		return d.ownership.accept(p, nonce, d.config().Ownership.TokenTTL)
+	})
+}
+
+// ownershipChallengeHandler serves POST /ownership/challenge, which issues
+// a challenge to prove control of the peer ID of the peerID parameter
+func (d *daemon) ownershipChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	peerStr := r.URL.Query().Get("peerID")
+	if peerStr == "" {
+		writeMissingParam(w, "peerID")
+		return
+	}
+	p, err := peer.Decode(peerStr)
+	if err != nil {
+		writeInvalidParam(w, "peerID", err.Error())
+		return
+	}
+
+	nonce, expires, err := d.ownership.challenge(p, d.config().Ownership.ChallengeTTL)
+	if errors.Is(err, errTooManyChallenges) {
+		writeError(w, http.StatusServiceUnavailable, errCodeTooManyChecks, err.Error(), nil)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+		return
+	}
+
+	h := d.checker.Host()
+	out := ownershipChallengeOutput{
+		PeerID:       p.String(),
+		Nonce:        nonce,
+		ExpiresAt:    expires,
+		Protocol:     string(check.OwnershipProtocol),
+		CheckerAddrs: []string{},
+	}
+	addrs, _ := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	for _, a := range addrs {
+		out.CheckerAddrs = append(out.CheckerAddrs, a.String())
+	}
+	writeResponse(w, r, out)
+}
+
+// ownershipStatusHandler serves GET /ownership/challenge/{nonce}, which tells
+// whether the nonce was signed and returns the token of the proof then
+func (d *daemon) ownershipStatusHandler(w http.ResponseWriter, r *http.Request) {
+	out, ok := d.ownership.status(r.PathValue("nonce"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errCodeNotFound, errUnknownChallenge.Error(), nil)
+		return
+	}
+	writeResponse(w, r, out)
+}
+
+// requestOwner returns the peer whose control the owner token of r proves,
+// empty without a token. It answers the request and returns false if the
+// token is invalid.
+func (d *daemon) requestOwner(w http.ResponseWriter, r *http.Request) (peer.ID, bool) {
+	token := r.Header.Get(ownerTokenHeader)
+	if t := r.URL.Query().Get(ownerTokenParam); t != "" {
+		token = t
+	}
+	if token == "" {
+		return "", true
+	}
+	if d.ownership != nil {
+		if p, ok := d.ownership.owner(token); ok {
+			return p, true
+		}
+	}
+	writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid or expired owner token", nil)
+	return "", false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnershipRegistry(t *testing.T) {
+	o := newOwnershipRegistry()
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+	other, err := test.RandPeerID()
+	require.NoError(t, err)
+
+	nonce, _, err := o.challenge(p, time.Minute)
+	require.NoError(t, err)
+	status, ok := o.status(nonce)
+	require.True(t, ok)
+	require.False(t, status.Verified)
+
+	require.ErrorIs(t, o.accept(p, "unknown", time.Hour), errUnknownChallenge)
+	require.Error(t, o.accept(other, nonce, time.Hour), "the challenge was issued to another peer")
+	require.NoError(t, o.accept(p, nonce, time.Hour))
+	status, ok = o.status(nonce)
+	require.True(t, ok)
+	require.True(t, status.Verified)
+	owner, ok := o.owner(status.Token)
+	require.True(t, ok)
+	require.Equal(t, p, owner)
+	_, ok = o.owner("unknown")
+	require.False(t, ok)
+
+	// Expired challenges can not be signed anymore
+	expired, _, err := o.challenge(p, -time.Second)
+	require.NoError(t, err)
+	require.ErrorIs(t, o.accept(p, expired, time.Hour), errUnknownChallenge)
+	_, ok = o.status(expired)
+	require.False(t, ok)
+
+	// Expired tokens prove nothing
+	nonce, _, err = o.challenge(p, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, o.accept(p, nonce, -time.Second))
+	status, _ = o.status(nonce)
+	_, ok = o.owner(status.Token)
+	require.False(t, ok)
+}
+
+func TestRequestOwner(t *testing.T) {
+	d := &daemon{ownership: newOwnershipRegistry()}
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+	nonce, _, err := d.ownership.challenge(p, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, d.ownership.accept(p, nonce, time.Hour))
+	status, _ := d.ownership.status(nonce)
+
+	owner, ok := d.requestOwner(httptest.NewRecorder(), httptest.NewRequest("GET", "/check", nil))
+	require.True(t, ok)
+	require.Empty(t, owner)
+
+	req := httptest.NewRequest("GET", "/check", nil)
+	req.Header.Set(ownerTokenHeader, status.Token)
+	owner, ok = d.requestOwner(httptest.NewRecorder(), req)
+	require.True(t, ok)
+	require.Equal(t, p, owner)
+
+	owner, ok = d.requestOwner(httptest.NewRecorder(), httptest.NewRequest("GET", "/check?ownerToken="+status.Token, nil))
+	require.True(t, ok)
+	require.Equal(t, p, owner)
+
+	w := httptest.NewRecorder()
+	_, ok = d.requestOwner(w, httptest.NewRequest("GET", "/check?ownerToken=wrong", nil))
+	require.False(t, ok)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+var errNotProviders = errors.New("the kubo-peering format is only available for the providers of CID checks")
+
+// kuboPeer is an entry of the Peering.Peers list of the Kubo configuration
+type kuboPeer struct {
+	ID    string
+	Addrs []string
+}
+
+// encodeKuboPeering encodes the providers of a CID check that served the block
+// over Bitswap as the Peering.Peers of the Kubo configuration, to be pasted in
+// it or passed to ipfs config --json Peering.Peers
+func encodeKuboPeering(data interface{}) ([]byte, error) {
+	var providers []check.ProviderOutput
+	switch out := data.(type) {
+	case cidCheckOutput:
+		if out != nil {
+			providers = *out
+		}
+	case verdictCheckOutput:
+		providers = out.Providers
+	default:
+		return nil, errNotProviders
+	}
+	b, err := json.MarshalIndent(kuboPeers(providers), "", "  ")
+	return append(b, '\n'), err
+}
+
+// kuboPeers returns the peering entries of the providers that served the
+// block over Bitswap, in their order, with the addresses they were connected
+// on first. Relay addresses are left out, as peering is meant to keep direct
+// connections.
+func kuboPeers(providers []check.ProviderOutput) []kuboPeer {
+	peers := []kuboPeer{}
+	for _, p := range providers {
+		if p.ConnectionError != "" || !p.DataAvailableOverBitswap.Found {
+			continue
+		}
+		kp := kuboPeer{ID: p.ID, Addrs: []string{}}
+		seen := make(map[string]struct{})
+		for _, s := range append(append([]string{}, p.ConnectionMaddrs...), p.Addrs...) {
+			a, err := multiaddr.NewMultiaddr(s)
+			if err != nil {
+				continue
+			}
+			// The peer ID is in its own field
+			a, _ = peer.SplitAddr(a)
+			if a == nil {
+				continue
+			}
+			if _, err := a.ValueForProtocol(multiaddr.P_CIRCUIT); err == nil {
+				continue
+			}
+			if _, ok := seen[a.String()]; ok {
+				continue
+			}
+			seen[a.String()] = struct{}{}
+			kp.Addrs = append(kp.Addrs, a.String())
+		}
+		peers = append(peers, kp)
+	}
+	return peers
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// pinningServiceHandler serves GET /check/pinning-service, which checks that
+// the delegates of a pin of a pinning service serve its CID. The token of the
+// pinning service is passed as bearer token, to keep it out of URLs and logs.
+// Only the pinning services of the config can be queried, so that the checker
+// can not be made to send requests to arbitrary URLs.
+func (d *daemon) pinningServiceHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := d.config()
+	if len(cfg.PinningServices) == 0 {
+		writeError(w, http.StatusNotFound, errCodeNotFound, "pinning service checks are disabled on this ipfs-check instance", nil)
+		return
+	}
+	endpoint := r.URL.Query().Get("endpoint")
+	requestID := r.URL.Query().Get("requestID")
+	if endpoint == "" {
+		writeMissingParam(w, "endpoint")
+		return
+	}
+	if requestID == "" {
+		writeMissingParam(w, "requestID")
+		return
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		writeInvalidParam(w, "endpoint", "Invalid endpoint value (http(s) URL of a Pinning Services API, without query)")
+		return
+	}
+	if !allowedOrigin(cfg.PinningServices, endpoint) {
+		writeInvalidParam(w, "endpoint", "the endpoint is not one of the pinning services allowed by this ipfs-check instance")
+		return
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	checkTimeout := cfg.CheckTimeout
+	if timeoutStr := r.URL.Query().Get("timeoutSeconds"); timeoutStr != "" {
+		var err error
+		checkTimeout, err = time.ParseDuration(timeoutStr + "s")
+		if err != nil {
+			writeInvalidParam(w, "timeoutSeconds", "Invalid timeout value (in seconds)")
+			return
+		}
+	}
+
+	release, ok := d.acquireCheckSlot(w, r, cfg)
+	if !ok {
+		return
+	}
+	defer release()
+
+	log.Printf("Checking pin %s of pinning service %s with timeout %s\n", requestID, endpoint, checkTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	out, err := d.checker.CheckPinningService(ctx, endpoint, token, requestID, d.checkOptions(ctx, cfg))
+	if err != nil {
+		writeCheckError(w, err, http.StatusBadGateway)
+		return
+	}
+	if c, err := cid.Decode(out.CID); err == nil {
+		d.recordProviderChecks(ctx, c, out.Providers)
+	}
+
+	if d.validateResponses {
+		if err := validateResponse(out); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, out)
+}
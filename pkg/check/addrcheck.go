@@ -0,0 +1,120 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Codes of the warnings returned by analyzeAddrs
+const (
+	AddrWarningLoopback            = "loopback-address"
+	AddrWarningPrivate             = "private-address"
+	AddrWarningUnspecified         = "unspecified-address"
+	AddrWarningRelayOnly           = "relay-only"
+	AddrWarningDeprecatedTransport = "deprecated-transport"
+	AddrWarningPeerIDMismatch      = "peer-id-mismatch"
+	// AddrWarningUnreachableFamily flags the addresses of the IP family the
+	// checker does not use, see Config.AddrFamily
+	AddrWarningUnreachableFamily = "unreachable-address-family"
+)
+
+// AddrWarning describes a problem with an address that is likely to make
+// dialing it fail, found before any dial is attempted
+type AddrWarning struct {
+	// Addr is the address the warning applies to, empty if it applies to the whole address set
+	Addr    string
+	Code    string
+	Message string
+}
+
+// analyzeAddrs flags addresses of peer p that other peers are unlikely to be
+// able to dial: private or loopback addresses, address sets that only contain
+// relay addresses, deprecated transports and addresses of another peer.
+func analyzeAddrs(p peer.ID, addrs []multiaddr.Multiaddr) []AddrWarning {
+	var warnings []AddrWarning
+	warn := func(addr multiaddr.Multiaddr, code, format string, args ...interface{}) {
+		w := AddrWarning{Code: code, Message: fmt.Sprintf(format, args...)}
+		if addr != nil {
+			w.Addr = addr.String()
+		}
+		warnings = append(warnings, w)
+	}
+
+	relayOnly := len(addrs) > 0
+	for _, addr := range addrs {
+		if isRelayAddr(addr) {
+			// the relay part of the address is what gets dialed
+			relayAddr, _ := multiaddr.SplitFunc(addr, func(c multiaddr.Component) bool {
+				return c.Protocol().Code == multiaddr.P_CIRCUIT
+			})
+			if relayAddr != nil {
+				warnAddrRange(relayAddr, addr, warn)
+			}
+		} else {
+			relayOnly = false
+			warnAddrRange(addr, addr, warn)
+		}
+
+		var hasTLS, hasQUIC bool
+		var lastPeer peer.ID
+		multiaddr.ForEach(addr, func(c multiaddr.Component) bool {
+			switch c.Protocol().Code {
+			case multiaddr.P_TLS:
+				hasTLS = true
+			case multiaddr.P_WS:
+				if !hasTLS {
+					warn(addr, AddrWarningDeprecatedTransport, "/ws without TLS can not be dialed from browsers in secure contexts, use /tls/ws or /wss")
+				}
+			case multiaddr.P_QUIC:
+				hasQUIC = true
+			case multiaddr.P_CIRCUIT:
+				// the peer ID before the circuit is the one of the relay
+				lastPeer = ""
+			case multiaddr.P_P2P:
+				lastPeer, _ = peer.IDFromBytes(c.RawValue())
+			}
+			return true
+		})
+		if hasQUIC {
+			warn(addr, AddrWarningDeprecatedTransport, "/quic (draft-29) is no longer supported by most implementations, use /quic-v1")
+		}
+		if lastPeer != "" && lastPeer != p {
+			warn(addr, AddrWarningPeerIDMismatch, "address belongs to peer %s, not %s", lastPeer, p)
+		}
+	}
+
+	if relayOnly {
+		warn(nil, AddrWarningRelayOnly, "all addresses are relay addresses, peers can only connect through relays and hole punching")
+	}
+	return warnings
+}
+
+// warnAddrRange flags dialAddr if it is not publicly routable, reporting the warning for addr
+func warnAddrRange(dialAddr, addr multiaddr.Multiaddr, warn func(multiaddr.Multiaddr, string, string, ...interface{})) {
+	if manet.IsPublicAddr(dialAddr) {
+		return
+	}
+	switch {
+	case manet.IsIPLoopback(dialAddr):
+		warn(addr, AddrWarningLoopback, "loopback addresses are only reachable from the same machine")
+	case manet.IsIPUnspecified(dialAddr):
+		warn(addr, AddrWarningUnspecified, "unspecified addresses (0.0.0.0 or ::) are listen addresses and can not be dialed")
+	case manet.IsPrivateAddr(dialAddr):
+		warn(addr, AddrWarningPrivate, "private addresses are only reachable from the same network")
+	default:
+		switch dialAddr.Protocols()[0].Code {
+		case multiaddr.P_IP4, multiaddr.P_IP6:
+			warn(addr, AddrWarningPrivate, "address is not publicly routable")
+		case multiaddr.P_DNS, multiaddr.P_DNS4, multiaddr.P_DNS6, multiaddr.P_DNSADDR:
+			warn(addr, AddrWarningPrivate, "domain name is not publicly resolvable")
+		}
+	}
+}
+
+func isRelayAddr(a multiaddr.Multiaddr) bool {
+	_, err := a.ValueForProtocol(multiaddr.P_CIRCUIT)
+	return err == nil
+}
@@ -0,0 +1,38 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeAddrs(t *testing.T) {
+	p, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+	other := "12D3KooWRTUNZVyVf7KBBNZ6MRR5SYGGjKzS6xyiU5zBeY9wxomo"
+
+	codes := func(addrs ...string) []string {
+		maddrs := make([]multiaddr.Multiaddr, 0, len(addrs))
+		for _, a := range addrs {
+			maddrs = append(maddrs, multiaddr.StringCast(a))
+		}
+		var out []string
+		for _, w := range analyzeAddrs(p, maddrs) {
+			out = append(out, w.Code)
+		}
+		return out
+	}
+
+	require.Empty(t, codes("/ip4/140.238.164.150/udp/4001/quic-v1", "/dns4/example.com/tcp/443/tls/ws"))
+	require.Empty(t, codes())
+	require.Equal(t, []string{AddrWarningLoopback}, codes("/ip4/127.0.0.1/tcp/4001", "/ip4/140.238.164.150/tcp/4001"))
+	require.Equal(t, []string{AddrWarningPrivate}, codes("/ip4/192.168.1.2/tcp/4001"))
+	require.Equal(t, []string{AddrWarningUnspecified}, codes("/ip6/::/tcp/4001"))
+	require.Equal(t, []string{AddrWarningDeprecatedTransport}, codes("/ip4/140.238.164.150/tcp/4001/ws"))
+	require.Equal(t, []string{AddrWarningDeprecatedTransport}, codes("/ip4/140.238.164.150/udp/4001/quic"))
+	require.Equal(t, []string{AddrWarningPeerIDMismatch}, codes("/ip4/140.238.164.150/tcp/4001/p2p/"+other))
+	require.Equal(t, []string{AddrWarningRelayOnly}, codes("/ip4/140.238.164.150/tcp/4001/p2p/"+other+"/p2p-circuit"))
+	require.Equal(t, []string{AddrWarningPrivate, AddrWarningRelayOnly}, codes("/ip4/10.0.0.1/tcp/4001/p2p/"+other+"/p2p-circuit/p2p/"+p.String()))
+}
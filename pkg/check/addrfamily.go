@@ -0,0 +1,82 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// IP families of Config.AddrFamily
+const (
+	AddrFamilyIPv4 = "ip4"
+	AddrFamilyIPv6 = "ip6"
+)
+
+// addrFamilyNames are the names of the IP families in messages
+var addrFamilyNames = map[string]string{
+	AddrFamilyIPv4: "IPv4",
+	AddrFamilyIPv6: "IPv6",
+}
+
+// ValidAddrFamily tells whether family is a valid Config.AddrFamily
+func ValidAddrFamily(family string) bool {
+	return family == "" || family == AddrFamilyIPv4 || family == AddrFamilyIPv6
+}
+
+// listenAddrsOption returns the libp2p option listening on the addresses of
+// family only, or of both families when it is empty. Private networks are
+// only listened on over TCP, as the QUIC based transports do not support
+// them.
+func listenAddrsOption(family string, private bool) libp2p.Option {
+	if family == "" && !private {
+		// the default listen addresses of libp2p
+		return func(cfg *libp2p.Config) error { return nil }
+	}
+	var addrs []string
+	for _, f := range []struct{ family, unspecified string }{
+		{AddrFamilyIPv4, "/ip4/0.0.0.0"},
+		{AddrFamilyIPv6, "/ip6/::"},
+	} {
+		if family != "" && family != f.family {
+			continue
+		}
+		if private {
+			addrs = append(addrs, f.unspecified+"/tcp/0", f.unspecified+"/tcp/0/ws")
+			continue
+		}
+		addrs = append(addrs,
+			f.unspecified+"/tcp/0",
+			f.unspecified+"/udp/0/quic-v1",
+			f.unspecified+"/udp/0/quic-v1/webtransport",
+			f.unspecified+"/udp/0/webrtc-direct",
+		)
+	}
+	return libp2p.ListenAddrStrings(addrs...)
+}
+
+// inAddrFamily tells whether a checker restricted to family can dial addr.
+// Relay addresses and the addresses whose family can not be told are
+// dialable.
+func inAddrFamily(addr multiaddr.Multiaddr, family string) bool {
+	f := addrFamily(addr)
+	return family == "" || f == "" || f == family
+}
+
+// analyzeAddrs returns the warnings of analyzeAddrs for the addresses of p,
+// with the addresses the checker can not dial because it is restricted to the
+// other IP family. The results of such checks are not what other peers see.
+func (ck *Checker) analyzeAddrs(p peer.ID, addrs []multiaddr.Multiaddr) []AddrWarning {
+	warnings := analyzeAddrs(p, addrs)
+	for _, addr := range addrs {
+		if !inAddrFamily(addr, ck.addrFamily) {
+			warnings = append(warnings, AddrWarning{
+				Addr:    addr.String(),
+				Code:    AddrWarningUnreachableFamily,
+				Message: fmt.Sprintf("ipfs-check only has %s connectivity and does not dial this address, which other peers may be able to", addrFamilyNames[ck.addrFamily]),
+			})
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,51 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckerAnalyzeAddrs(t *testing.T) {
+	p, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+	addrs := []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/140.238.164.150/udp/4001/quic-v1"),
+		multiaddr.StringCast("/ip6/2604:1380:4642:6600:82a5:d2ff:fe4d:3e5a/tcp/4001"),
+		multiaddr.StringCast("/dns/example.com/tcp/4001"),
+	}
+
+	require.Empty(t, (&Checker{}).analyzeAddrs(p, addrs))
+
+	warnings := (&Checker{addrFamily: AddrFamilyIPv6}).analyzeAddrs(p, addrs)
+	require.Len(t, warnings, 1)
+	require.Equal(t, AddrWarningUnreachableFamily, warnings[0].Code)
+	require.Equal(t, addrs[0].String(), warnings[0].Addr)
+	require.Contains(t, warnings[0].Message, "IPv6 connectivity")
+}
+
+func TestAddrFamilyConnectionGater(t *testing.T) {
+	g := &privateAddrFilterConnectionGater{family: AddrFamilyIPv4}
+	require.True(t, g.InterceptAddrDial("", multiaddr.StringCast("/ip4/140.238.164.150/tcp/4001")))
+	require.False(t, g.InterceptAddrDial("", multiaddr.StringCast("/ip6/2604:1380:4642:6600:82a5:d2ff:fe4d:3e5a/tcp/4001")))
+
+	g.family = ""
+	require.True(t, g.InterceptAddrDial("", multiaddr.StringCast("/ip6/2604:1380:4642:6600:82a5:d2ff:fe4d:3e5a/tcp/4001")))
+}
+
+func TestListenAddrsOption(t *testing.T) {
+	h, err := libp2p.New(listenAddrsOption(AddrFamilyIPv4, false))
+	require.NoError(t, err)
+	defer h.Close()
+	require.NotEmpty(t, h.Addrs())
+	for _, addr := range h.Addrs() {
+		require.Equal(t, AddrFamilyIPv4, addrFamily(addr), addr.String())
+	}
+
+	require.True(t, ValidAddrFamily(""))
+	require.True(t, ValidAddrFamily(AddrFamilyIPv6))
+	require.False(t, ValidAddrFamily("ipv6"))
+}
@@ -0,0 +1,162 @@
+package check
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Reasons of FilteredAddrOutput
+const (
+	// AddrFilteredPrivate is a private or loopback address, which the checker
+	// does not dial unless AddrPolicy allows it
+	AddrFilteredPrivate = "private"
+	// AddrFilteredRelay is a relay address, with AddrPolicy.DenyRelay
+	AddrFilteredRelay = "relay"
+	// AddrFilteredDenylist is an address in a network or autonomous system of
+	// the denylist
+	AddrFilteredDenylist = "denylist"
+)
+
+// errFilteredAddrs is the connection error of the peers whose addresses were
+// all filtered out, for other reasons than the denylist
+const errFilteredAddrs = "all the addresses of the peer were filtered out by the policy of this ipfs-check instance, see FilteredAddrs"
+
+// FilteredAddrOutput is an address of the peer the checker did not dial
+type FilteredAddrOutput struct {
+	Addr string
+	// Reason is one of AddrFilteredPrivate, AddrFilteredRelay and
+	// AddrFilteredDenylist, and Message explains it
+	Reason  string
+	Message string
+}
+
+// AddrPolicy decides which addresses the hosts created by New dial, besides
+// the denylist. The zero value refuses private and loopback addresses and
+// allows relay addresses, as public instances should.
+type AddrPolicy struct {
+	// AllowPrivate allows private and loopback addresses, see
+	// Config.LocalNetwork
+	AllowPrivate bool
+	// DenyRelay refuses relay addresses
+	DenyRelay bool
+	// AllowedNetworks are private networks that are dialed even without
+	// AllowPrivate, e.g. the subnet of a VPN
+	AllowedNetworks []*net.IPNet
+}
+
+// NewAddrPolicy returns the policy allowing or refusing private and relay
+// addresses, and allowing the CIDR networks of allowedNetworks
+func NewAddrPolicy(allowPrivate, denyRelay bool, allowedNetworks []string) (*AddrPolicy, error) {
+	p := &AddrPolicy{AllowPrivate: allowPrivate, DenyRelay: denyRelay}
+	for _, s := range allowedNetworks {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network %q: %w", s, err)
+		}
+		p.AllowedNetworks = append(p.AllowedNetworks, n)
+	}
+	return p, nil
+}
+
+// allowsIP returns whether the address, or the address of the relay of a
+// relay address, is public or allowed
+func (p *AddrPolicy) allowsIP(addr multiaddr.Multiaddr) bool {
+	if p.AllowPrivate || manet.IsPublicAddr(addr) {
+		return true
+	}
+	if ip := addrIP(addr); ip != nil {
+		for _, n := range p.AllowedNetworks {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dialControl refuses the connections to the IP addresses the policy does not
+// allow, see net.Dialer.Control
+func (p *AddrPolicy) dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if addr, err := manet.FromIP(ip); err == nil && p.allowsIP(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("refusing to connect to %s, which the address policy of this ipfs-check instance does not allow", host)
+}
+
+// HTTPClient returns a client of the services whose URLs come from requests,
+// which only connects to the addresses the policy allows and does not follow
+// redirects
+func (p *AddrPolicy) HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: 15 * time.Second, Control: p.dialControl}).DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			ForceAttemptHTTP2:   true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// filter returns why the policy refuses addr, nil if it allows it
+func (p *AddrPolicy) filter(addr multiaddr.Multiaddr) *FilteredAddrOutput {
+	switch {
+	case !p.allowsIP(addr):
+		return &FilteredAddrOutput{Addr: addr.String(), Reason: AddrFilteredPrivate, Message: "private and loopback addresses are not dialed by this ipfs-check instance"}
+	case p.DenyRelay && isRelayAddr(addr):
+		return &FilteredAddrOutput{Addr: addr.String(), Reason: AddrFilteredRelay, Message: "relay addresses are not dialed by this ipfs-check instance"}
+	}
+	return nil
+}
+
+// filterAddrs returns the addresses of addrs the checker dials, and the other
+// ones with the reason they are not dialed. The policy only applies when the
+// hosts of the checker are gated by it.
+func (ck *Checker) filterAddrs(addrs []multiaddr.Multiaddr) ([]multiaddr.Multiaddr, []FilteredAddrOutput) {
+	var allowed []multiaddr.Multiaddr
+	var filtered []FilteredAddrOutput
+	for _, a := range addrs {
+		if ck.denylist.deniesAddr(a, ck.geoIP) {
+			filtered = append(filtered, FilteredAddrOutput{Addr: a.String(), Reason: AddrFilteredDenylist, Message: "the address is in the denylist of this ipfs-check instance"})
+			continue
+		}
+		if ck.enforceAddrPolicy {
+			if f := ck.addrPolicy.filter(a); f != nil {
+				filtered = append(filtered, *f)
+				continue
+			}
+		}
+		allowed = append(allowed, a)
+	}
+	return allowed, filtered
+}
+
+// filteredAddrsError returns the connection error of a peer whose addresses
+// were all filtered out
+func filteredAddrsError(filtered []FilteredAddrOutput) string {
+	for _, f := range filtered {
+		if f.Reason != AddrFilteredDenylist {
+			return errFilteredAddrs
+		}
+	}
+	return errDeniedAddrs
+}
+
+// dialableAddr tells whether the policy of the checker allows addr, e.g.
+// whether it is public or the checker is in local network mode
+func (ck *Checker) dialableAddr(addr multiaddr.Multiaddr) bool {
+	return ck.addrPolicy.filter(addr) == nil
+}
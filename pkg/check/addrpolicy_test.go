@@ -0,0 +1,63 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddrPolicy(t *testing.T) {
+	const relayed = "/ip4/140.238.164.150/tcp/4001/p2p/12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5/p2p-circuit"
+	reason := func(p *AddrPolicy, addr string) string {
+		if f := p.filter(multiaddr.StringCast(addr)); f != nil {
+			return f.Reason
+		}
+		return ""
+	}
+
+	p := &AddrPolicy{}
+	require.Empty(t, reason(p, "/ip4/140.238.164.150/tcp/4001"))
+	require.Empty(t, reason(p, relayed))
+	require.Equal(t, AddrFilteredPrivate, reason(p, "/ip4/10.8.0.2/tcp/4001"))
+	require.Equal(t, AddrFilteredPrivate, reason(p, "/ip4/127.0.0.1/tcp/4001"))
+
+	p, err := NewAddrPolicy(false, true, []string{"10.8.0.0/16"})
+	require.NoError(t, err)
+	require.Equal(t, AddrFilteredRelay, reason(p, relayed))
+	require.Empty(t, reason(p, "/ip4/10.8.0.2/tcp/4001"), "allowed networks are dialed")
+	require.Equal(t, AddrFilteredPrivate, reason(p, "/ip4/10.9.0.2/tcp/4001"))
+
+	_, err = NewAddrPolicy(false, false, []string{"10.8.0.1"})
+	require.Error(t, err)
+
+	g := &privateAddrFilterConnectionGater{policy: *p}
+	require.True(t, g.InterceptAddrDial("", multiaddr.StringCast("/ip4/10.8.0.2/tcp/4001")))
+	require.False(t, g.InterceptAddrDial("", multiaddr.StringCast(relayed)))
+}
+
+func TestFilterAddrs(t *testing.T) {
+	deny, err := NewDenylist(nil, []string{"192.0.2.0/24"}, nil, nil)
+	require.NoError(t, err)
+	ck := &Checker{denylist: deny, enforceAddrPolicy: true}
+	addrs := []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/140.238.164.150/tcp/4001"),
+		multiaddr.StringCast("/ip4/192.168.1.10/tcp/4001"),
+		multiaddr.StringCast("/ip4/192.0.2.1/tcp/4001"),
+	}
+
+	allowed, filtered := ck.filterAddrs(addrs)
+	require.Equal(t, addrs[:1], allowed)
+	require.Equal(t, []FilteredAddrOutput{
+		{Addr: "/ip4/192.168.1.10/tcp/4001", Reason: AddrFilteredPrivate, Message: filtered[0].Message},
+		{Addr: "/ip4/192.0.2.1/tcp/4001", Reason: AddrFilteredDenylist, Message: filtered[1].Message},
+	}, filtered)
+	require.Equal(t, errFilteredAddrs, filteredAddrsError(filtered))
+	require.Equal(t, errDeniedAddrs, filteredAddrsError(filtered[1:]))
+
+	// The policy does not apply to the hosts passed in the Config
+	ck.enforceAddrPolicy = false
+	allowed, filtered = ck.filterAddrs(addrs)
+	require.Equal(t, addrs[:2], allowed)
+	require.Len(t, filtered, 1)
+}
@@ -0,0 +1,118 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+// ipniLookupTimeout bounds looking up a provider in the IPNI indexer
+const ipniLookupTimeout = 5 * time.Second
+
+// AdvertisementsOutput reconciles where a peer advertises the CID. Filecoin
+// storage providers for instance often only advertise to IPNI, so a peer
+// missing from the DHT is not necessarily unreachable.
+type AdvertisementsOutput struct {
+	// DHT is whether a provider record of the peer for the CID was found in the DHT
+	DHT bool
+	// IPNI is whether the IPNI indexer returned the peer as a provider of the CID
+	IPNI bool
+	// IPNILastAdvertisement is when the indexer last received an advertisement
+	// from the peer, for any CID, nil if the indexer does not know the peer
+	IPNILastAdvertisement *time.Time
+}
+
+// findAllProviders collects the IDs of the providers of c found by r until
+// the query ends or ctx is done
+func findAllProviders(ctx context.Context, r routing.ContentRouting, c cid.Cid) map[peer.ID]struct{} {
+	found := make(map[peer.ID]struct{})
+	for prov := range r.FindProvidersAsync(ctx, c, 0) {
+		found[prov.ID] = struct{}{}
+	}
+	return found
+}
+
+// ipniLastAdvertisement returns when the indexer last received an
+// advertisement from p, or nil if the indexer does not know p. Indexers that
+// only implement the delegated routing API do not know any provider.
+func ipniLastAdvertisement(ctx context.Context, indexerURL string, p peer.ID) (*time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipniLookupTimeout)
+	defer cancel()
+
+	u := strings.TrimSuffix(indexerURL, "/") + "/providers/" + p.String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected status from the indexer: %s", resp.Status)
+	}
+
+	var info struct {
+		LastAdvertisementTime time.Time
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("decoding provider info: %w", err)
+	}
+	if info.LastAdvertisementTime.IsZero() {
+		return nil, nil
+	}
+	return &info.LastAdvertisementTime, nil
+}
+
+// reconcileAdvertisements sets the Advertisements of the providers from the
+// providers found in each routing system and their last IPNI advertisement
+func reconcileAdvertisements(ctx context.Context, indexerURL string, out []ProviderOutput, inDHT, inIPNI map[peer.ID]struct{}) {
+	lastSeen := make(map[string]*time.Time)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range out {
+		if _, ok := lastSeen[out[i].ID]; ok {
+			continue
+		}
+		lastSeen[out[i].ID] = nil
+		p, err := peer.Decode(out[i].ID)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t, _ := ipniLastAdvertisement(ctx, indexerURL, p)
+			mu.Lock()
+			lastSeen[p.String()] = t
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for i := range out {
+		p, _ := peer.Decode(out[i].ID)
+		adv := &AdvertisementsOutput{IPNILastAdvertisement: lastSeen[out[i].ID]}
+		_, adv.DHT = inDHT[p]
+		_, adv.IPNI = inIPNI[p]
+		// The provider was found through this system even if the query was
+		// stopped before collecting all of its providers
+		adv.DHT = adv.DHT || out[i].Source == DHTSource
+		adv.IPNI = adv.IPNI || out[i].Source == IPNISource
+		out[i].Advertisements = adv
+	}
+}
@@ -0,0 +1,44 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileAdvertisements(t *testing.T) {
+	dhtOnly, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+	ipniOnly, err := peer.Decode("12D3KooWRTUNZVyVf7KBBNZ6MRR5SYGGjKzS6xyiU5zBeY9wxomo")
+	require.NoError(t, err)
+	lastAd := time.Date(2024, 8, 25, 12, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/providers/"+ipniOnly.String() {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"AddrInfo":{"ID":"%s","Addrs":[]},"LastAdvertisementTime":"%s"}`, ipniOnly, lastAd.Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	out := []ProviderOutput{
+		{ID: dhtOnly.String(), Source: DHTSource},
+		{ID: ipniOnly.String(), Source: IPNISource},
+	}
+	// The DHT query was stopped before finding any provider
+	inIPNI := map[peer.ID]struct{}{ipniOnly: {}}
+	reconcileAdvertisements(context.Background(), srv.URL+"/", out, map[peer.ID]struct{}{}, inIPNI)
+
+	require.Equal(t, &AdvertisementsOutput{DHT: true}, out[0].Advertisements)
+	require.True(t, out[1].Advertisements.IPNI)
+	require.False(t, out[1].Advertisements.DHT)
+	require.NotNil(t, out[1].Advertisements.IPNILastAdvertisement)
+	require.True(t, lastAd.Equal(*out[1].Advertisements.IPNILastAdvertisement))
+}
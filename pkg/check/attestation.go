@@ -0,0 +1,163 @@
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+// attestationSignaturePrefix prefixes the signed statements, so that the
+// signatures can not be used for anything else
+const attestationSignaturePrefix = "ipfs-check attestation:"
+
+// AttestationStatement is what a checker attests: that it observed Result
+// when running the check of Query at ObservedAt
+type AttestationStatement struct {
+	// Checker is the peer ID of the host the check ran from
+	Checker string
+	// Query identifies the check, e.g. the query string of the request
+	Query      string
+	ObservedAt time.Time
+	// Result is the JSON of the result of the check
+	Result json.RawMessage
+}
+
+// Attestation is a signed AttestationStatement, which third parties can
+// verify with VerifyAttestation to trust a result without trusting whoever
+// relays it
+type Attestation struct {
+	// Statement is the DAG-JSON of the AttestationStatement, and CID its CID.
+	// The signature is over these exact bytes.
+	Statement string
+	CID       string
+	// Signer is the peer ID of the key that signed the statement, whose
+	// public key is PublicKey, in the libp2p protobuf encoding
+	Signer    string
+	PublicKey []byte
+	Signature []byte
+}
+
+// Attest signs a statement that the checker observed result when running the
+// check of query at observedAt, with Config.AttestationKey or else the key of
+// the host of the checker
+func (ck *Checker) Attest(query string, observedAt time.Time, result any) (*Attestation, error) {
+	key := ck.attestationKey
+	if key == nil {
+		key = ck.h.Peerstore().PrivKey(ck.h.ID())
+	}
+	if key == nil {
+		return nil, fmt.Errorf("the private key of %s is not in the peerstore", ck.h.ID())
+	}
+	r, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return NewAttestation(key, AttestationStatement{
+		Checker:    ck.h.ID().String(),
+		Query:      query,
+		ObservedAt: observedAt.UTC(),
+		Result:     r,
+	})
+}
+
+// NewAttestation signs st with key
+func NewAttestation(key crypto.PrivKey, st AttestationStatement) (*Attestation, error) {
+	statement, err := encodeStatement(st)
+	if err != nil {
+		return nil, err
+	}
+	c, err := statementCID(statement)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	sig, err := key.Sign(append([]byte(attestationSignaturePrefix), statement...))
+	if err != nil {
+		return nil, err
+	}
+	return &Attestation{
+		Statement: string(statement),
+		CID:       c.String(),
+		Signer:    signer.String(),
+		PublicKey: pub,
+		Signature: sig,
+	}, nil
+}
+
+// VerifyAttestation checks that the statement of a is signed by its signer
+// and matches its CID, and returns the statement
+func VerifyAttestation(a *Attestation) (*AttestationStatement, error) {
+	pub, err := crypto.UnmarshalPublicKey(a.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	signer, err := peer.Decode(a.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer: %w", err)
+	}
+	if !signer.MatchesPublicKey(pub) {
+		return nil, errors.New("the public key is not the key of the signer")
+	}
+	ok, err := pub.Verify(append([]byte(attestationSignaturePrefix), a.Statement...), a.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("verifying the signature: %w", err)
+	}
+	if !ok {
+		return nil, errors.New("invalid signature")
+	}
+	c, err := statementCID([]byte(a.Statement))
+	if err != nil {
+		return nil, err
+	}
+	if c.String() != a.CID {
+		return nil, fmt.Errorf("the CID of the statement is %s, not %s", c, a.CID)
+	}
+	var st AttestationStatement
+	if err := json.Unmarshal([]byte(a.Statement), &st); err != nil {
+		return nil, fmt.Errorf("invalid statement: %w", err)
+	}
+	return &st, nil
+}
+
+// encodeStatement encodes st as DAG-JSON, whose map keys are sorted, so that
+// the same statement always has the same bytes and CID
+func encodeStatement(st AttestationStatement) ([]byte, error) {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagjson.Decode(nb, bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("converting the statement to DAG-JSON: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := dagjson.Encode(nb.Build(), &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// statementCID returns the CIDv1 of the DAG-JSON statement
+func statementCID(statement []byte) (cid.Cid, error) {
+	mh, err := multihash.Sum(statement, multihash.SHA2_256, -1)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.NewCidV1(cid.DagJSON, mh), nil
+}
@@ -0,0 +1,49 @@
+package check
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttestation(t *testing.T) {
+	ck := &Checker{h: newLoopbackHost(t)}
+	observedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, err := ck.Attest("cid=bafkqaaa", observedAt, BitswapCheckOutput{Found: true, Responded: true})
+	require.NoError(t, err)
+	require.Equal(t, ck.h.ID().String(), a.Signer, "the key of the host signs by default")
+
+	st, err := VerifyAttestation(a)
+	require.NoError(t, err)
+	require.Equal(t, ck.h.ID().String(), st.Checker)
+	require.Equal(t, "cid=bafkqaaa", st.Query)
+	require.True(t, observedAt.Equal(st.ObservedAt))
+	var result BitswapCheckOutput
+	require.NoError(t, json.Unmarshal(st.Result, &result))
+	require.True(t, result.Found)
+
+	// The statement is canonical, so the same statement has the same CID
+	again, err := ck.Attest("cid=bafkqaaa", observedAt, BitswapCheckOutput{Found: true, Responded: true})
+	require.NoError(t, err)
+	require.Equal(t, a.CID, again.CID)
+
+	tampered := *a
+	tampered.Statement = `{"Checker":"` + st.Checker + `","ObservedAt":"2024-05-01T12:00:00Z","Query":"cid=bafkqaaa","Result":{"Found":false}}`
+	_, err = VerifyAttestation(&tampered)
+	require.Error(t, err)
+
+	sk, _, err := ic.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	ck.attestationKey = sk
+	other, err := ck.Attest("cid=bafkqaaa", observedAt, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, a.Signer, other.Signer)
+	tampered = *a
+	tampered.PublicKey = other.PublicKey
+	_, err = VerifyAttestation(&tampered)
+	require.Error(t, err, "the public key must be the key of the signer")
+}
@@ -0,0 +1,161 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+	"github.com/libp2p/go-msgio/pbio"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+const (
+	autonatTimeout        = 30 * time.Second
+	autonatMaxMsgSize     = 8192
+	autonatMaxDialDataLen = 100_000
+)
+
+// AutoNATCheckOutput is the result of asking the peer to dial ipfs-check
+// back using AutoNAT v2. The peer is the one dialing, so this tests its
+// outbound connectivity, not whether it can be reached: a peer that can dial
+// ipfs-check but can not be dialed is likely behind a NAT or firewall that
+// blocks inbound connections.
+type AutoNATCheckOutput struct {
+	// Supported is whether the peer runs an AutoNAT v2 server
+	Supported bool
+	// Addr is the address of ipfs-check the peer dialed
+	Addr string
+	// DialStatus is the result of the dial reported by the peer: OK,
+	// E_DIAL_ERROR or E_DIAL_BACK_ERROR
+	DialStatus string
+	// DialBackVerified is whether ipfs-check received the dial back
+	DialBackVerified bool
+	Error            string
+}
+
+// checkAutoNAT asks peer p, which h is connected to, to dial h back on its
+// public addresses using the AutoNAT v2 protocol
+func checkAutoNAT(ctx context.Context, h host.Host, p peer.ID) *AutoNATCheckOutput {
+	var addrs []multiaddr.Multiaddr
+	for _, a := range h.Addrs() {
+		if manet.IsPublicAddr(a) {
+			addrs = append(addrs, a)
+		}
+	}
+	out := &AutoNATCheckOutput{}
+	if err := runAutoNATCheck(ctx, h, p, addrs, out); err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
+
+// runAutoNATCheck asks peer p to dial h back on one of addrs
+func runAutoNATCheck(ctx context.Context, h host.Host, p peer.ID, addrs []multiaddr.Multiaddr, out *AutoNATCheckOutput) error {
+	ctx, cancel := context.WithTimeout(ctx, autonatTimeout)
+	defer cancel()
+
+	if len(addrs) == 0 {
+		return errors.New("ipfs-check has no public addresses to be dialed on")
+	}
+
+	nonce := rand.Uint64()
+	dialedBack := make(chan struct{}, 1)
+	h.SetStreamHandler(autonatv2.DialBackProtocol, func(s network.Stream) {
+		defer s.Close()
+		_ = s.SetDeadline(time.Now().Add(autonatTimeout))
+		var msg pb.DialBack
+		if err := pbio.NewDelimitedReader(s, autonatMaxMsgSize).ReadMsg(&msg); err != nil || msg.GetNonce() != nonce {
+			_ = s.Reset()
+			return
+		}
+		select {
+		case dialedBack <- struct{}{}:
+		default:
+		}
+		_ = pbio.NewDelimitedWriter(s).WriteMsg(&pb.DialBackResponse{Status: pb.DialBackResponse_OK})
+	})
+	defer h.RemoveStreamHandler(autonatv2.DialBackProtocol)
+
+	s, err := h.NewStream(ctx, p, autonatv2.DialProtocol)
+	if err != nil {
+		if errors.Is(err, msmux.ErrNotSupported[protocol.ID]{}) {
+			return errors.New("the peer does not run an AutoNAT v2 server")
+		}
+		return err
+	}
+	defer s.Close()
+	out.Supported = true
+	_ = s.SetDeadline(time.Now().Add(autonatTimeout))
+
+	req := &pb.DialRequest{Nonce: nonce}
+	for _, a := range addrs {
+		req.Addrs = append(req.Addrs, a.Bytes())
+	}
+	w := pbio.NewDelimitedWriter(s)
+	r := pbio.NewDelimitedReader(s, autonatMaxMsgSize)
+	msg := pb.Message{Msg: &pb.Message_DialRequest{DialRequest: req}}
+	if err := w.WriteMsg(&msg); err != nil {
+		_ = s.Reset()
+		return err
+	}
+	if err := r.ReadMsg(&msg); err != nil {
+		_ = s.Reset()
+		return err
+	}
+
+	// The peer asks for data to be sent before dialing addresses with a
+	// different IP than the one it sees, to prevent amplification attacks
+	if ddReq := msg.GetDialDataRequest(); ddReq != nil {
+		if ddReq.GetNumBytes() > autonatMaxDialDataLen {
+			_ = s.Reset()
+			return fmt.Errorf("the peer requested too much dial data: %d bytes", ddReq.GetNumBytes())
+		}
+		data := make([]byte, 4000)
+		for remaining := int(ddReq.GetNumBytes()); remaining > 0; remaining -= len(data) {
+			if remaining < len(data) {
+				data = data[:remaining]
+			}
+			resp := pb.Message{Msg: &pb.Message_DialDataResponse{DialDataResponse: &pb.DialDataResponse{Data: data}}}
+			if err := w.WriteMsg(&resp); err != nil {
+				_ = s.Reset()
+				return err
+			}
+		}
+		if err := r.ReadMsg(&msg); err != nil {
+			_ = s.Reset()
+			return err
+		}
+	}
+
+	resp := msg.GetDialResponse()
+	if resp == nil {
+		return errors.New("invalid response from the peer")
+	}
+	if resp.GetStatus() != pb.DialResponse_OK {
+		return fmt.Errorf("the peer did not dial: %s", resp.GetStatus())
+	}
+	if int(resp.GetAddrIdx()) >= len(addrs) {
+		return errors.New("invalid response from the peer: address index out of range")
+	}
+	out.Addr = addrs[resp.GetAddrIdx()].String()
+	out.DialStatus = resp.GetDialStatus().String()
+
+	if resp.GetDialStatus() == pb.DialStatus_OK {
+		select {
+		case <-dialedBack:
+			out.DialBackVerified = true
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
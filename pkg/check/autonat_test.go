@@ -0,0 +1,88 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+	"github.com/libp2p/go-msgio/pbio"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoNAT(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	h := newLoopbackHost(t)
+	connect := func(target peer.ID, addrs []multiaddr.Multiaddr) {
+		require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: target, Addrs: addrs}))
+	}
+
+	// Without AutoNAT v2 server
+	target := newLoopbackHost(t)
+	connect(target.ID(), target.Addrs())
+	out := &AutoNATCheckOutput{}
+	require.ErrorContains(t, runAutoNATCheck(ctx, h, target.ID(), h.Addrs(), out), "does not run an AutoNAT v2 server")
+	require.False(t, out.Supported)
+
+	// The server of go-libp2p only dials public addresses back, which tells
+	// the request was understood
+	server, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.EnableAutoNATv2())
+	require.NoError(t, err)
+	defer server.Close()
+	connect(server.ID(), server.Addrs())
+	out = &AutoNATCheckOutput{}
+	require.ErrorContains(t, runAutoNATCheck(ctx, h, server.ID(), h.Addrs(), out), pb.DialResponse_E_DIAL_REFUSED.String())
+	require.True(t, out.Supported)
+
+	// A server dialing back the address it was given, from another host like
+	// the one of go-libp2p
+	dialer, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer dialer.Close()
+	target.SetStreamHandler(autonatv2.DialProtocol, func(s network.Stream) {
+		defer s.Close()
+		var msg pb.Message
+		if err := pbio.NewDelimitedReader(s, autonatMaxMsgSize).ReadMsg(&msg); err != nil {
+			_ = s.Reset()
+			return
+		}
+		req := msg.GetDialRequest()
+		addr, err := multiaddr.NewMultiaddrBytes(req.GetAddrs()[0])
+		if err != nil {
+			_ = s.Reset()
+			return
+		}
+		dialStatus := pb.DialStatus_E_DIAL_ERROR
+		if dialer.Connect(ctx, peer.AddrInfo{ID: s.Conn().RemotePeer(), Addrs: []multiaddr.Multiaddr{addr}}) == nil {
+			if db, err := dialer.NewStream(ctx, s.Conn().RemotePeer(), autonatv2.DialBackProtocol); err == nil {
+				_ = pbio.NewDelimitedWriter(db).WriteMsg(&pb.DialBack{Nonce: req.GetNonce()})
+				var resp pb.DialBackResponse
+				if pbio.NewDelimitedReader(db, autonatMaxMsgSize).ReadMsg(&resp) == nil {
+					dialStatus = pb.DialStatus_OK
+				}
+				_ = db.Close()
+			}
+		}
+		_ = pbio.NewDelimitedWriter(s).WriteMsg(&pb.Message{Msg: &pb.Message_DialResponse{DialResponse: &pb.DialResponse{
+			Status:     pb.DialResponse_OK,
+			DialStatus: dialStatus,
+		}}})
+	})
+	out = &AutoNATCheckOutput{}
+	require.NoError(t, runAutoNATCheck(ctx, h, target.ID(), h.Addrs(), out))
+	require.True(t, out.Supported)
+	require.Equal(t, h.Addrs()[0].String(), out.Addr)
+	require.Equal(t, pb.DialStatus_OK.String(), out.DialStatus)
+	require.True(t, out.DialBackVerified)
+
+	// Without public addresses to be dialed on, the peer is not asked
+	out = checkAutoNAT(ctx, h, target.ID())
+	require.Contains(t, out.Error, "no public addresses")
+	require.False(t, out.Supported)
+}
@@ -0,0 +1,298 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	bsmsgpb "github.com/ipfs/boxo/bitswap/message/pb"
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+// how long to wait at least for the peer to send the block after a WANT-BLOCK
+const bitswapBlockTimeout = 30 * time.Second
+
+type BitswapCheckOutput struct {
+	Duration time.Duration
+	// Found is whether the peer said it has the block, either with a HAVE or by sending the block
+	Found     bool
+	Responded bool
+	Error     string
+	// Protocol is the Bitswap protocol version negotiated with the peer
+	Protocol string
+	// ReceivedHave is whether the peer answered the WANT-HAVE with a HAVE
+	ReceivedHave bool
+	// ReceivedDontHave is whether the peer answered with a DONT_HAVE
+	ReceivedDontHave bool
+	// ReceivedBlock is whether the peer sent the block, and it matched the CID
+	ReceivedBlock bool
+	// BlockSize is the size in bytes of the received block
+	BlockSize int
+	// BytesPerSecond is the throughput of the block transfer, measured from
+	// sending the want to receiving the block
+	BytesPerSecond float64
+	// ResourceLimited is whether Error comes from the resource manager of the
+	// checker refusing a stream rather than from the peer
+	ResourceLimited bool
+	// Attempts are the attempts of the check, more than one when the peer
+	// did not answer and the check was retried
+	Attempts []AttemptOutput
+}
+
+// checkBitswapCID asks the peer at ma for c with a WANT-HAVE. Peers may send
+// small blocks right away instead of a HAVE. If fetchBlock is set and the peer
+// claims to have the block, it is also requested with a WANT-BLOCK to verify
+// that the peer actually serves it. Received blocks are hash-verified. timeout
+// is how long to wait for the peer to answer the WANT-HAVE.
+func checkBitswapCID(ctx context.Context, host host.Host, c cid.Cid, ma multiaddr.Multiaddr, fetchBlock bool, timeout time.Duration) BitswapCheckOutput {
+	log.Printf("Start of Bitswap check for cid %s by attempting to connect to ma: %v with the peer: %s", c, ma, host.ID())
+	out := BitswapCheckOutput{}
+	start := time.Now()
+
+	if err := runBitswapCheck(ctx, host, c, ma, fetchBlock, timeout, &out); err != nil {
+		out.Error = err.Error()
+		out.ResourceLimited = isResourceLimited(err)
+	}
+
+	log.Printf("End of Bitswap check for %s by attempting to connect to ma: %v", c, ma)
+	out.Duration = time.Since(start)
+	return out
+}
+
+func runBitswapCheck(ctx context.Context, h host.Host, c cid.Cid, ma multiaddr.Multiaddr, fetchBlock bool, responseTimeout time.Duration, out *BitswapCheckOutput) error {
+	ai, err := peer.AddrInfoFromP2pAddr(ma)
+	if err != nil {
+		return err
+	}
+	if err := h.Connect(ctx, *ai); err != nil {
+		return err
+	}
+
+	// Create a new stream to ensure we wait for hole punching even if it takes
+	// longer than the built-in limit in the Bitswap implementation, and to learn
+	// the protocol version the peer supports
+	sctx, cancel := context.WithTimeout(ctx, responseTimeout)
+	defer cancel()
+	s, err := h.NewStream(sctx, ai.ID, bsnet.ProtocolBitswap, bsnet.ProtocolBitswapOneOne, bsnet.ProtocolBitswapOneZero, bsnet.ProtocolBitswapNoVers)
+	if err != nil {
+		return err
+	}
+	out.Protocol = string(s.Protocol())
+	_ = s.Close()
+
+	bs := bsnet.NewFromIpfsHost(h, rhelp.Null{})
+	rcv := &bitswapReceiver{
+		target: ai.ID,
+		result: make(chan bitswapMsgOrErr),
+	}
+	bs.Start(rcv)
+	defer bs.Stop()
+
+	wantTypes := []bsmsgpb.Message_Wantlist_WantType{bsmsgpb.Message_Wantlist_Have}
+	if fetchBlock {
+		wantTypes = append(wantTypes, bsmsgpb.Message_Wantlist_Block)
+	}
+
+	for _, wantType := range wantTypes {
+		timeout := responseTimeout
+		if wantType == bsmsgpb.Message_Wantlist_Block {
+			timeout = max(bitswapBlockTimeout, responseTimeout)
+		}
+
+		msg := bsmsg.New(false)
+		msg.AddEntry(c, 0, wantType, true)
+		sent := time.Now()
+		if err := bs.SendMessage(ctx, ai.ID, msg); err != nil {
+			return err
+		}
+
+		resp, err := rcv.waitForResponse(ctx, c, timeout)
+		if resp == nil && err == nil {
+			// the peer did not answer in time
+			return nil
+		}
+		out.Responded = true
+		if err != nil {
+			return err
+		}
+
+		for _, b := range resp.Blocks() {
+			if !b.Cid().Equals(c) {
+				continue
+			}
+			if err := verifyBlock(b); err != nil {
+				return err
+			}
+			out.ReceivedBlock = true
+			out.Found = true
+			out.BlockSize = len(b.RawData())
+			if elapsed := time.Since(sent); elapsed > 0 {
+				out.BytesPerSecond = float64(out.BlockSize) / elapsed.Seconds()
+			}
+			return nil
+		}
+		if cidsContain(resp.Haves(), c) {
+			out.ReceivedHave = true
+			out.Found = true
+			// ask for the block itself if fetchBlock is set
+			continue
+		}
+		if cidsContain(resp.DontHaves(), c) {
+			out.ReceivedDontHave = true
+			return nil
+		}
+	}
+	return nil
+}
+
+// verifyBlock checks that the data of b matches its CID
+func verifyBlock(b blocks.Block) error {
+	if sum, err := b.Cid().Prefix().Sum(b.RawData()); err != nil || !sum.Equals(b.Cid()) {
+		return errors.New("the peer sent a block that does not match the CID")
+	}
+	return nil
+}
+
+// blockFetcher downloads blocks from a peer over Bitswap, one at a time
+type blockFetcher struct {
+	bs      bsnet.BitSwapNetwork
+	rcv     *bitswapReceiver
+	p       peer.ID
+	timeout time.Duration
+}
+
+// newBlockFetcher returns a fetcher of the blocks of peer p, which h must be
+// connected to. It must be closed after use.
+func newBlockFetcher(h host.Host, p peer.ID, timeout time.Duration) *blockFetcher {
+	f := &blockFetcher{
+		bs: bsnet.NewFromIpfsHost(h, rhelp.Null{}),
+		rcv: &bitswapReceiver{
+			target: p,
+			result: make(chan bitswapMsgOrErr),
+		},
+		p:       p,
+		timeout: timeout,
+	}
+	f.bs.Start(f.rcv)
+	return f
+}
+
+func (f *blockFetcher) close() {
+	f.bs.Stop()
+}
+
+// fetch requests c with a WANT-BLOCK and returns the block once verified.
+// Blocks of identity CIDs are decoded from the CID.
+func (f *blockFetcher) fetch(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if c.Prefix().MhType == multihash.IDENTITY {
+		dmh, err := multihash.Decode(c.Hash())
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewBlockWithCid(dmh.Digest, c)
+	}
+
+	msg := bsmsg.New(false)
+	msg.AddEntry(c, 0, bsmsgpb.Message_Wantlist_Block, true)
+	if err := f.bs.SendMessage(ctx, f.p, msg); err != nil {
+		return nil, err
+	}
+	resp, err := f.rcv.waitForResponse(ctx, c, f.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("the peer did not send block %s in time", c)
+	}
+	for _, b := range resp.Blocks() {
+		if b.Cid().Equals(c) {
+			if err := verifyBlock(b); err != nil {
+				return nil, err
+			}
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("the peer does not have block %s", c)
+}
+
+func cidsContain(cids []cid.Cid, c cid.Cid) bool {
+	for _, k := range cids {
+		if k.Equals(c) {
+			return true
+		}
+	}
+	return false
+}
+
+type bitswapReceiver struct {
+	target peer.ID
+	result chan bitswapMsgOrErr
+}
+
+type bitswapMsgOrErr struct {
+	msg bsmsg.BitSwapMessage
+	err error
+}
+
+// waitForResponse returns the first message from the target peer that
+// mentions c, or nil if the peer did not answer within timeout
+func (r *bitswapReceiver) waitForResponse(ctx context.Context, c cid.Cid, timeout time.Duration) (bsmsg.BitSwapMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		select {
+		case res := <-r.result:
+			if res.err != nil {
+				return nil, res.err
+			}
+			// the peer may also send us its own wants
+			for _, b := range res.msg.Blocks() {
+				if b.Cid().Equals(c) {
+					return res.msg, nil
+				}
+			}
+			if cidsContain(res.msg.Haves(), c) || cidsContain(res.msg.DontHaves(), c) {
+				return res.msg, nil
+			}
+		case <-ctx.Done():
+			return nil, nil
+		}
+	}
+}
+
+func (r *bitswapReceiver) ReceiveMessage(ctx context.Context, sender peer.ID, incoming bsmsg.BitSwapMessage) {
+	res := bitswapMsgOrErr{msg: incoming}
+	if sender != r.target {
+		res = bitswapMsgOrErr{err: fmt.Errorf("expected peerID %v, got %v", r.target, sender)}
+	}
+	select {
+	case <-ctx.Done():
+	case r.result <- res:
+	}
+}
+
+func (r *bitswapReceiver) ReceiveError(err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case r.result <- bitswapMsgOrErr{err: err}:
+	}
+}
+
+func (r *bitswapReceiver) PeerConnected(id peer.ID) {}
+
+func (r *bitswapReceiver) PeerDisconnected(id peer.ID) {}
+
+var _ bsnet.Receiver = (*bitswapReceiver)(nil)
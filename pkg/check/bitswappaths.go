@@ -0,0 +1,171 @@
+package check
+
+import (
+	"context"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	bsmsgpb "github.com/ipfs/boxo/bitswap/message/pb"
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-msgio"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// bitswapProtocols are the Bitswap protocols, from the newest
+var bitswapProtocols = []protocol.ID{bsnet.ProtocolBitswap, bsnet.ProtocolBitswapOneOne, bsnet.ProtocolBitswapOneZero, bsnet.ProtocolBitswapNoVers}
+
+// BitswapPathOutput is the result of asking the peer for the CID over one of
+// the connections to it, e.g. the relayed and the direct connection after
+// hole punching
+type BitswapPathOutput struct {
+	// Addr is the remote address of the connection the WANT-HAVE was sent
+	// over, and Relayed whether it goes through a relay
+	Addr    string
+	Relayed bool
+	// Responded is whether the peer answered in time, and Latency the time
+	// from sending the WANT-HAVE to receiving the answer
+	Responded bool
+	Latency   time.Duration
+	// ResponseAddr is the remote address of the connection the answer came
+	// over. The peer picks the connection of its answers, usually the direct
+	// one when there is one.
+	ResponseAddr string
+	Error        string
+}
+
+// bitswapResponse is a Bitswap message of the peer, with the address of the
+// connection it came over
+type bitswapResponse struct {
+	msg  bsmsg.BitSwapMessage
+	addr string
+}
+
+// probeBitswapPaths asks p for c with a WANT-HAVE over each of the
+// connections of h to p, one after the other, to tell whether each path
+// carries data. It returns nil unless h has several connections to p. h must
+// not be used for Bitswap concurrently, as its Bitswap stream handlers are
+// replaced.
+func probeBitswapPaths(ctx context.Context, h host.Host, p peer.ID, c cid.Cid, timeout time.Duration) []BitswapPathOutput {
+	conns := h.Network().ConnsToPeer(p)
+	if len(conns) < 2 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	responses := receiveBitswapResponses(ctx, h, p)
+	defer removeBitswapHandlers(h)
+
+	out := make([]BitswapPathOutput, len(conns))
+	for i, conn := range conns {
+		out[i] = probeBitswapPath(ctx, conn, c, timeout, responses)
+	}
+	return out
+}
+
+// receiveBitswapResponses replaces the Bitswap stream handlers of h with ones
+// passing the messages of p to the returned channel, until ctx is done. They
+// must be removed with removeBitswapHandlers.
+func receiveBitswapResponses(ctx context.Context, h host.Host, p peer.ID) <-chan bitswapResponse {
+	responses := make(chan bitswapResponse)
+	handler := func(s network.Stream) {
+		defer s.Close()
+		if s.Conn().RemotePeer() != p {
+			_ = s.Reset()
+			return
+		}
+		r := msgio.NewVarintReaderSize(s, network.MessageSizeMax)
+		for {
+			msg, err := bsmsg.FromMsgReader(r)
+			if err != nil {
+				return
+			}
+			select {
+			case responses <- bitswapResponse{msg: msg, addr: s.Conn().RemoteMultiaddr().String()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	for _, proto := range bitswapProtocols {
+		h.SetStreamHandler(proto, handler)
+	}
+	return responses
+}
+
+func removeBitswapHandlers(h host.Host) {
+	for _, proto := range bitswapProtocols {
+		h.RemoveStreamHandler(proto)
+	}
+}
+
+// probeBitswapPath sends a WANT-HAVE for c over conn and waits for the answer
+// in responses
+func probeBitswapPath(ctx context.Context, conn network.Conn, c cid.Cid, timeout time.Duration, responses <-chan bitswapResponse) BitswapPathOutput {
+	out := BitswapPathOutput{
+		Addr:    conn.RemoteMultiaddr().String(),
+		Relayed: conn.Stat().Limited || isRelayAddr(conn.RemoteMultiaddr()),
+	}
+	ctx, cancel := context.WithTimeout(network.WithAllowLimitedConn(ctx, "bitswap path probe"), timeout)
+	defer cancel()
+
+	s, err := conn.NewStream(ctx)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	defer s.Close()
+	proto, err := msmux.SelectOneOf(bitswapProtocols, s)
+	if err != nil {
+		_ = s.Reset()
+		out.Error = err.Error()
+		return out
+	}
+
+	msg := bsmsg.New(false)
+	msg.AddEntry(c, 0, bsmsgpb.Message_Wantlist_Have, true)
+	sent := time.Now()
+	if err := writeBitswapMessage(s, proto, msg); err != nil {
+		_ = s.Reset()
+		out.Error = err.Error()
+		return out
+	}
+
+	for {
+		select {
+		case resp := <-responses:
+			if !cidsContain(resp.msg.Haves(), c) && !cidsContain(resp.msg.DontHaves(), c) && !blocksContain(resp.msg, c) {
+				// e.g. the wants of the peer
+				continue
+			}
+			out.Responded = true
+			out.Latency = time.Since(sent)
+			out.ResponseAddr = resp.addr
+			return out
+		case <-ctx.Done():
+			return out
+		}
+	}
+}
+
+// writeBitswapMessage writes msg to s in the wire format of proto
+func writeBitswapMessage(s network.Stream, proto protocol.ID, msg bsmsg.BitSwapMessage) error {
+	if proto == bsnet.ProtocolBitswapOneZero || proto == bsnet.ProtocolBitswapNoVers {
+		return msg.ToNetV0(s)
+	}
+	return msg.ToNetV1(s)
+}
+
+func blocksContain(msg bsmsg.BitSwapMessage, c cid.Cid) bool {
+	for _, b := range msg.Blocks() {
+		if b.Cid().Equals(c) {
+			return true
+		}
+	}
+	return false
+}
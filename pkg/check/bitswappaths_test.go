@@ -0,0 +1,73 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	bsserver "github.com/ipfs/boxo/bitswap/server"
+	"github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
+	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeBitswapPaths(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	relay, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.EnableRelayService(), libp2p.ForceReachabilityPublic())
+	require.NoError(t, err)
+	defer relay.Close()
+	relayInfo := peer.AddrInfo{ID: relay.ID(), Addrs: relay.Addrs()}
+
+	target, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer target.Close()
+	require.NoError(t, target.Connect(ctx, relayInfo))
+	_, err = client.Reserve(ctx, target, relayInfo)
+	require.NoError(t, err)
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	block := blocks.NewBlock([]byte(t.Name()))
+	require.NoError(t, bstore.Put(ctx, block))
+	bn := bsnet.NewFromIpfsHost(target, rhelp.Null{})
+	server := bsserver.New(ctx, bn, bstore)
+	bn.Start(server)
+	defer server.Close()
+
+	h, err := libp2p.New(libp2p.NoListenAddrs, libp2p.EnableRelay())
+	require.NoError(t, err)
+	defer h.Close()
+	require.Nil(t, probeBitswapPaths(ctx, h, target.ID(), block.Cid(), 5*time.Second), "no connection")
+
+	// Connect through the relay, then directly as after hole punching
+	require.NoError(t, h.Connect(ctx, relayInfo))
+	circuit := multiaddr.StringCast("/p2p/" + relay.ID().String() + "/p2p-circuit")
+	require.NoError(t, h.Connect(network.WithAllowLimitedConn(ctx, "test"), peer.AddrInfo{ID: target.ID(), Addrs: []multiaddr.Multiaddr{relay.Addrs()[0].Encapsulate(circuit)}}))
+	h.Peerstore().AddAddrs(target.ID(), target.Addrs(), time.Minute)
+	_, err = h.Network().DialPeer(network.WithForceDirectDial(ctx, "test"), target.ID())
+	require.NoError(t, err)
+	require.Len(t, h.Network().ConnsToPeer(target.ID()), 2)
+
+	paths := probeBitswapPaths(ctx, h, target.ID(), block.Cid(), 5*time.Second)
+	require.Len(t, paths, 2)
+	relayed := 0
+	for _, p := range paths {
+		require.Empty(t, p.Error)
+		require.True(t, p.Responded, p.Addr)
+		require.NotEmpty(t, p.ResponseAddr)
+		require.Positive(t, p.Latency)
+		if p.Relayed {
+			relayed++
+		}
+	}
+	require.Equal(t, 1, relayed)
+}
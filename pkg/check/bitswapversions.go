@@ -0,0 +1,153 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	bsmsgpb "github.com/ipfs/boxo/bitswap/message/pb"
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// probedBitswapVersions are the Bitswap protocol versions probed separately
+// with Options.BitswapVersions, from the newest
+var probedBitswapVersions = []protocol.ID{bsnet.ProtocolBitswap, bsnet.ProtocolBitswapOneOne, bsnet.ProtocolBitswapOneZero}
+
+// BitswapVersionsOutput is the result of asking the peer for the CID over
+// each Bitswap protocol version separately, for peers whose Bitswap
+// implementation behaves differently across versions
+type BitswapVersionsOutput struct {
+	Versions []BitswapVersionOutput
+	// Differences describes how the answers over the versions the peer
+	// supports differ, or do not follow the version they were sent over
+	Differences []string
+}
+
+// BitswapVersionOutput is the result of sending a WANT-HAVE for the CID over
+// a single Bitswap protocol version
+type BitswapVersionOutput struct {
+	Protocol string
+	// Supported is whether the peer accepted a stream of the protocol
+	Supported bool
+	// Responded is whether the peer answered in time, and Latency the time
+	// from sending the WANT-HAVE to receiving the answer
+	Responded bool
+	Latency   time.Duration
+	// ReceivedHave, ReceivedDontHave and ReceivedBlock tell how the peer
+	// answered. HAVE and DONT_HAVE only exist since Bitswap 1.2.0, over older
+	// versions the peer is expected to send the block.
+	ReceivedHave     bool
+	ReceivedDontHave bool
+	ReceivedBlock    bool
+	Error            string
+}
+
+// found is whether the peer said it has the block over the version
+func (v BitswapVersionOutput) found() bool {
+	return v.ReceivedHave || v.ReceivedBlock
+}
+
+// probeBitswapVersions asks p for c with a WANT-HAVE over each of
+// probedBitswapVersions, one after the other, and compares the answers. h must
+// be connected to p, and not be used for Bitswap concurrently, as its Bitswap
+// stream handlers are replaced.
+func probeBitswapVersions(ctx context.Context, h host.Host, p peer.ID, c cid.Cid, timeout time.Duration) *BitswapVersionsOutput {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	responses := receiveBitswapResponses(ctx, h, p)
+	defer removeBitswapHandlers(h)
+
+	out := &BitswapVersionsOutput{}
+	for _, proto := range probedBitswapVersions {
+		out.Versions = append(out.Versions, probeBitswapVersion(ctx, h, p, proto, c, timeout, responses))
+	}
+	out.Differences = bitswapVersionDifferences(out.Versions)
+	return out
+}
+
+// probeBitswapVersion sends a WANT-HAVE for c over a stream of proto and
+// waits for the answer in responses, which may come over any version
+func probeBitswapVersion(ctx context.Context, h host.Host, p peer.ID, proto protocol.ID, c cid.Cid, timeout time.Duration, responses <-chan bitswapResponse) BitswapVersionOutput {
+	out := BitswapVersionOutput{Protocol: string(proto)}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	s, err := h.NewStream(ctx, p, proto)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	defer s.Close()
+	out.Supported = true
+
+	msg := bsmsg.New(false)
+	msg.AddEntry(c, 0, bsmsgpb.Message_Wantlist_Have, true)
+	sent := time.Now()
+	if err := writeBitswapMessage(s, proto, msg); err != nil {
+		_ = s.Reset()
+		out.Error = err.Error()
+		return out
+	}
+
+	for {
+		select {
+		case resp := <-responses:
+			out.ReceivedHave = cidsContain(resp.msg.Haves(), c)
+			out.ReceivedDontHave = cidsContain(resp.msg.DontHaves(), c)
+			for _, b := range resp.msg.Blocks() {
+				if b.Cid().Equals(c) {
+					if err := verifyBlock(b); err != nil {
+						out.Error = err.Error()
+					} else {
+						out.ReceivedBlock = true
+					}
+				}
+			}
+			if !out.ReceivedHave && !out.ReceivedDontHave && !out.ReceivedBlock && out.Error == "" {
+				// e.g. the wants of the peer
+				continue
+			}
+			out.Responded = true
+			out.Latency = time.Since(sent)
+			return out
+		case <-ctx.Done():
+			return out
+		}
+	}
+}
+
+// bitswapVersionDifferences describes how the answers over the supported
+// versions differ, and the HAVE and DONT_HAVE answers over versions older
+// than 1.2.0, which do not define them
+func bitswapVersionDifferences(versions []BitswapVersionOutput) []string {
+	diffs := []string{}
+	var foundOver, notFoundOver, silentOver []string
+	for _, v := range versions {
+		if !v.Supported {
+			continue
+		}
+		switch {
+		case !v.Responded:
+			silentOver = append(silentOver, v.Protocol)
+		case v.found():
+			foundOver = append(foundOver, v.Protocol)
+		default:
+			notFoundOver = append(notFoundOver, v.Protocol)
+		}
+		if v.Protocol != string(bsnet.ProtocolBitswap) && (v.ReceivedHave || v.ReceivedDontHave) {
+			diffs = append(diffs, fmt.Sprintf("The peer answered with a HAVE or DONT_HAVE over %s, which only %s defines", v.Protocol, bsnet.ProtocolBitswap))
+		}
+	}
+	if len(foundOver) > 0 && len(notFoundOver) > 0 {
+		diffs = append(diffs, fmt.Sprintf("The peer has the block over %v but not over %v", foundOver, notFoundOver))
+	}
+	if len(silentOver) > 0 && len(foundOver)+len(notFoundOver) > 0 {
+		diffs = append(diffs, fmt.Sprintf("The peer did not answer over %v, unlike over the other versions", silentOver))
+	}
+	return diffs
+}
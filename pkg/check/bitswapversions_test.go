@@ -0,0 +1,90 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	bsserver "github.com/ipfs/boxo/bitswap/server"
+	"github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
+	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-msgio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeBitswapVersions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	newHost := func() host.Host {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	h := newHost()
+	block := blocks.NewBlock([]byte(t.Name()))
+
+	// A Bitswap server behaves the same over all the versions
+	target := newHost()
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, bstore.Put(ctx, block))
+	bn := bsnet.NewFromIpfsHost(target, rhelp.Null{})
+	server := bsserver.New(ctx, bn, bstore)
+	bn.Start(server)
+	defer server.Close()
+	require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()}))
+
+	out := probeBitswapVersions(ctx, h, target.ID(), block.Cid(), 5*time.Second)
+	require.Len(t, out.Versions, len(probedBitswapVersions))
+	for _, v := range out.Versions {
+		require.True(t, v.Supported, v.Protocol)
+		require.True(t, v.Responded, v.Protocol)
+		require.True(t, v.ReceivedBlock, "small blocks are sent right away over %s", v.Protocol)
+	}
+	require.Empty(t, out.Differences)
+
+	// A partial implementation answers with a HAVE over 1.2.0, a DONT_HAVE
+	// over 1.1.0 and does not support 1.0.0
+	partial := newHost()
+	answer := func(build func(msg bsmsg.BitSwapMessage, c cid.Cid)) network.StreamHandler {
+		return func(s network.Stream) {
+			defer s.Close()
+			req, err := bsmsg.FromMsgReader(msgio.NewVarintReaderSize(s, network.MessageSizeMax))
+			if err != nil {
+				return
+			}
+			resp := bsmsg.New(false)
+			for _, e := range req.Wantlist() {
+				build(resp, e.Cid)
+			}
+			rs, err := partial.NewStream(ctx, s.Conn().RemotePeer(), s.Protocol())
+			if err != nil {
+				return
+			}
+			defer rs.Close()
+			_ = resp.ToNetV1(rs)
+		}
+	}
+	partial.SetStreamHandler(bsnet.ProtocolBitswap, answer(func(msg bsmsg.BitSwapMessage, c cid.Cid) { msg.AddHave(c) }))
+	partial.SetStreamHandler(bsnet.ProtocolBitswapOneOne, answer(func(msg bsmsg.BitSwapMessage, c cid.Cid) { msg.AddDontHave(c) }))
+	require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: partial.ID(), Addrs: partial.Addrs()}))
+
+	out = probeBitswapVersions(ctx, h, partial.ID(), block.Cid(), 5*time.Second)
+	require.True(t, out.Versions[0].ReceivedHave)
+	require.True(t, out.Versions[1].ReceivedDontHave)
+	require.False(t, out.Versions[2].Supported)
+	require.NotEmpty(t, out.Versions[2].Error)
+	require.Len(t, out.Differences, 2)
+	require.Contains(t, out.Differences[0], "DONT_HAVE over "+string(bsnet.ProtocolBitswapOneOne))
+	require.Contains(t, out.Differences[1], "has the block over ["+string(bsnet.ProtocolBitswap)+"] but not over ["+string(bsnet.ProtocolBitswapOneOne)+"]")
+}
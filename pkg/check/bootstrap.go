@@ -0,0 +1,75 @@
+package check
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// bootstrapSets are the bootstrap peers the DHT client joins the DHT through:
+// the primary ones, and the fallback ones used while none of the primary
+// ones can be connected to
+type bootstrapSets struct {
+	h        host.Host
+	primary  []peer.AddrInfo
+	fallback []peer.AddrInfo
+	// usingFallback is whether the last time the DHT client needed bootstrap
+	// peers, none of the primary ones could be connected to
+	usingFallback atomic.Bool
+}
+
+// peers returns the bootstrap peers of the DHT client, which it asks for
+// whenever its routing table is empty. The primary peers are health-checked
+// by connecting to them, and the fallback peers returned instead if none
+// could be connected to.
+func (b *bootstrapSets) peers() []peer.AddrInfo {
+	if len(b.fallback) == 0 {
+		return b.primary
+	}
+	if b.anyReachable(b.primary) {
+		if b.usingFallback.Swap(false) {
+			log.Printf("Primary bootstrap peers reachable again, no longer using the fallback ones\n")
+		}
+		return b.primary
+	}
+	if !b.usingFallback.Swap(true) {
+		log.Printf("None of the %d primary bootstrap peers could be connected to, using the %d fallback ones\n", len(b.primary), len(b.fallback))
+	}
+	return b.fallback
+}
+
+// all returns the primary and the fallback peers, for the accelerated DHT
+// client which only reads its bootstrap peers on startup
+func (b *bootstrapSets) all() []peer.AddrInfo {
+	return append(append([]peer.AddrInfo{}, b.primary...), b.fallback...)
+}
+
+// anyReachable returns whether the host is or could get connected to any of
+// peers, trying them concurrently
+func (b *bootstrapSets) anyReachable(peers []peer.AddrInfo) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), networkStatusTimeout)
+	defer cancel()
+
+	var reachable atomic.Bool
+	var wg sync.WaitGroup
+	for _, ai := range peers {
+		if b.h.Network().Connectedness(ai.ID) == network.Connected {
+			return true
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.h.Connect(ctx, ai) == nil {
+				reachable.Store(true)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return reachable.Load()
+}
@@ -0,0 +1,42 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootstrapSets(t *testing.T) {
+	newHost := func() host.Host {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	h, primary, fallback := newHost(), newHost(), newHost()
+	primaryInfo := peer.AddrInfo{ID: primary.ID(), Addrs: primary.Addrs()}
+	fallbackInfo := []peer.AddrInfo{{ID: fallback.ID(), Addrs: fallback.Addrs()}}
+
+	b := &bootstrapSets{h: h, primary: []peer.AddrInfo{primaryInfo}}
+	require.Equal(t, b.primary, b.peers(), "the primary peers are used without fallback ones")
+
+	b.fallback = fallbackInfo
+	require.Equal(t, b.primary, b.peers())
+	require.False(t, b.usingFallback.Load())
+	require.Equal(t, append(b.primary, fallbackInfo...), b.all())
+
+	// The primary peer goes away
+	require.NoError(t, primary.Close())
+	h.Network().ClosePeer(primary.ID())
+	require.Equal(t, fallbackInfo, b.peers())
+	require.True(t, b.usingFallback.Load())
+
+	// and is replaced by a reachable one
+	restarted := newHost()
+	b.primary = []peer.AddrInfo{{ID: restarted.ID(), Addrs: restarted.Addrs()}}
+	require.Equal(t, b.primary, b.peers())
+	require.False(t, b.usingFallback.Load())
+}
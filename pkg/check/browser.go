@@ -0,0 +1,182 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// TransportSecureWebSocket is the transport of WebSocket addresses with TLS,
+// the only WebSockets browsers can open from secure contexts
+const TransportSecureWebSocket = "wss"
+
+// browserTransports are the transports browsers can dial, in the order of
+// BrowserReachabilityOutput.Transports
+var browserTransports = []string{TransportWebTransport, TransportWebRTC, TransportSecureWebSocket}
+
+// BrowserAddrOutput tells whether a browser could dial an address of the peer
+type BrowserAddrOutput struct {
+	Addr string
+	// Transport is the transport a browser would dial the address with, one of
+	// TransportWebTransport, TransportWebRTC and TransportSecureWebSocket, and
+	// empty if browsers cannot dial it. For relay addresses, it is the
+	// transport of the relay.
+	Transport string
+	Relayed   bool
+	// Reason is why browsers cannot dial the address
+	Reason string
+}
+
+// BrowserReachabilityOutput tells whether web apps, e.g. using Helia, can
+// connect to the peer. Browsers cannot open TCP or QUIC connections, so a
+// peer reachable by other nodes may still be unreachable from browsers.
+type BrowserReachabilityOutput struct {
+	PeerID string
+	// BrowserReachable is whether any of the addresses browsers can dial
+	// could be connected to
+	BrowserReachable bool
+	// Addrs are the addresses of the peer, passed or found in the DHT, with
+	// the transport browsers would dial each with
+	Addrs []BrowserAddrOutput
+	// PeerFoundInDHT are the addresses of the peer returned by the DHT peers
+	// closest to it when no address was passed, and DHTError why the DHT
+	// could not be queried
+	PeerFoundInDHT map[string]int
+	DHTError       string
+	// FilteredAddrs are the addresses browsers can dial that the checker did
+	// not, with the reason why
+	FilteredAddrs []FilteredAddrOutput
+	// Error is why no address could be dialed, e.g. the peer has none that
+	// browsers can dial
+	Error string
+	// AddrDialResults are the results of dialing each of the addresses
+	// browsers can dial separately, only over their browser transports
+	AddrDialResults []AddrDialOutput
+	CertHashChecks  []CertHashCheckOutput
+	// Transports has the reachability of the peer over each of the browser
+	// transports of its addresses
+	Transports []TransportReachabilityOutput
+	// CheckerInfo is the vantage point of the checker that ran the check
+	CheckerInfo *CheckerInfoOutput
+}
+
+// CheckBrowserReachability checks whether browsers can connect to the peer of
+// ma, dialing only its WebTransport, WebRTC Direct and secure WebSocket
+// addresses. Like in CheckPeer, the addresses are looked up in the DHT when ma
+// is only /p2p/<peer-id>. All the addresses found that browsers can dial are
+// then dialed, so stale ones, which DHT peers keep for long, each wait for
+// opts.AddrDialTimeout and hold the result back that long. Passing a full
+// multiaddr skips the lookup and dials only that address.
+func (ck *Checker) CheckBrowserReachability(ctx context.Context, ma multiaddr.Multiaddr, opts Options) (*BrowserReachabilityOutput, error) {
+	opts = opts.withDefaults()
+	ai, err := peer.AddrInfoFromP2pAddr(ma)
+	if err != nil {
+		return nil, err
+	}
+	if err := ck.Denied(cid.Undef, ma); err != nil {
+		return nil, err
+	}
+	out := &BrowserReachabilityOutput{PeerID: ai.ID.String(), CheckerInfo: ck.CheckerInfo(), Addrs: []BrowserAddrOutput{}}
+
+	addrs := ai.Addrs
+	if len(addrs) == 0 {
+		clearDialBackoff(ck.h, ai.ID)
+		out.PeerFoundInDHT, err = peerAddrsInDHT(ctx, ck.timedRouting(), ck.dhtMessenger, ai.ID)
+		if err != nil {
+			out.DHTError = err.Error()
+		}
+		for a := range out.PeerFoundInDHT {
+			dhtAddr, err := multiaddr.NewMultiaddr(a)
+			if err != nil {
+				log.Println(fmt.Errorf("error parsing multiaddr %s: %w", a, err))
+				continue
+			}
+			addrs = append(addrs, dhtAddr)
+		}
+		slices.SortFunc(addrs, func(a, b multiaddr.Multiaddr) int { return strings.Compare(a.String(), b.String()) })
+	}
+
+	var browserAddrs []multiaddr.Multiaddr
+	for _, addr := range addrs {
+		a := browserAddr(addr)
+		out.Addrs = append(out.Addrs, a)
+		if a.Transport != "" {
+			browserAddrs = append(browserAddrs, addr)
+		}
+	}
+	allowed, filtered := ck.filterAddrs(browserAddrs)
+	out.FilteredAddrs = filtered
+	switch {
+	case len(addrs) == 0:
+		out.Error = "no addresses of the peer were found in the DHT"
+		return out, nil
+	case len(browserAddrs) == 0:
+		out.Error = "the peer has no WebTransport, WebRTC Direct or secure WebSocket address that browsers can dial"
+		return out, nil
+	case len(allowed) == 0:
+		out.Error = filteredAddrsError(filtered)
+		return out, nil
+	}
+
+	out.AddrDialResults = ck.dialAddrs(ctx, ai.ID, allowed, opts.AddrDialTimeout)
+	out.CertHashChecks = checkCertHashes(allowed, out.AddrDialResults)
+	for _, transport := range browserTransports {
+		r := TransportReachabilityOutput{Transport: transport}
+		for i, addr := range allowed {
+			if browserAddr(addr).Transport != transport {
+				continue
+			}
+			r.Addrs = append(r.Addrs, addr.String())
+			r.Connected = r.Connected || out.AddrDialResults[i].Error == ""
+		}
+		if len(r.Addrs) > 0 {
+			out.Transports = append(out.Transports, r)
+		}
+		out.BrowserReachable = out.BrowserReachable || r.Connected
+	}
+	if !out.BrowserReachable {
+		out.Error = "none of the addresses browsers can dial could be connected to"
+	}
+	return out, nil
+}
+
+// browserAddr returns the transport a browser would dial addr with, or why
+// browsers cannot dial it
+func browserAddr(addr multiaddr.Multiaddr) BrowserAddrOutput {
+	out := BrowserAddrOutput{Addr: addr.String()}
+	if isRelayAddr(addr) {
+		out.Relayed = true
+		// Browsers connect to the relay, whose address comes first
+		addr, _ = multiaddr.SplitFunc(addr, func(c multiaddr.Component) bool {
+			return c.Protocol().Code == multiaddr.P_CIRCUIT
+		})
+	}
+	has := func(code int) bool {
+		_, err := addr.ValueForProtocol(code)
+		return err == nil
+	}
+
+	switch {
+	case has(multiaddr.P_WEBTRANSPORT) || has(multiaddr.P_WEBRTC_DIRECT):
+		if !has(multiaddr.P_CERTHASH) {
+			out.Reason = "browsers can only dial WebTransport and WebRTC Direct addresses with the hashes of the certificate of the peer"
+		} else if has(multiaddr.P_WEBTRANSPORT) {
+			out.Transport = TransportWebTransport
+		} else {
+			out.Transport = TransportWebRTC
+		}
+	case has(multiaddr.P_WSS) || (has(multiaddr.P_WS) && has(multiaddr.P_TLS)):
+		out.Transport = TransportSecureWebSocket
+	case has(multiaddr.P_WS):
+		out.Reason = "browsers cannot open WebSockets without TLS from secure contexts, e.g. web apps served over HTTPS"
+	default:
+		out.Reason = "browsers cannot open TCP or QUIC connections"
+	}
+	return out
+}
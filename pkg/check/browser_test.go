@@ -0,0 +1,37 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrowserAddr(t *testing.T) {
+	const certHash = "/certhash/uEiAkH5a4DPGKUuOBjYw0CgwjvcJCJMD2K_1aluKR_tpevQ"
+	transport := func(addr string) string {
+		return browserAddr(multiaddr.StringCast(addr)).Transport
+	}
+
+	require.Equal(t, TransportWebTransport, transport("/ip4/1.2.3.4/udp/4001/quic-v1/webtransport"+certHash))
+	require.Equal(t, TransportWebRTC, transport("/ip4/1.2.3.4/udp/4001/webrtc-direct"+certHash))
+	require.Equal(t, TransportSecureWebSocket, transport("/dns4/example.com/tcp/443/wss"))
+	require.Equal(t, TransportSecureWebSocket, transport("/dns4/example.com/tcp/443/tls/sni/example.com/ws"))
+
+	for _, addr := range []string{
+		"/ip4/1.2.3.4/tcp/4001",
+		"/ip4/1.2.3.4/udp/4001/quic-v1",
+		"/ip4/1.2.3.4/tcp/4002/ws",
+		"/ip4/1.2.3.4/udp/4001/quic-v1/webtransport",
+	} {
+		out := browserAddr(multiaddr.StringCast(addr))
+		require.Empty(t, out.Transport, addr)
+		require.NotEmpty(t, out.Reason, addr)
+	}
+
+	relayed := browserAddr(multiaddr.StringCast("/dns4/relay.example.com/tcp/443/wss/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK/p2p-circuit"))
+	require.True(t, relayed.Relayed)
+	require.Equal(t, TransportSecureWebSocket, relayed.Transport, "the transport of the relay is used")
+	relayed = browserAddr(multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK/p2p-circuit/webrtc"))
+	require.Empty(t, relayed.Transport)
+}
@@ -0,0 +1,152 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	_ "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	_ "github.com/ipld/go-ipld-prime/codec/raw"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/multicodec"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-varint"
+)
+
+// carMaxBlocks bounds the number of blocks exported in a CAR file
+const carMaxBlocks = 10_000
+
+// ExportCAR downloads the DAG rooted at c from the peer over Bitswap and
+// writes it to w as a CARv1 file, in depth-first order. Links are followed up
+// to depth levels below the root, 0 exporting only the root block. Every block
+// is verified against its CID before being written, so the file proves the
+// data was retrievable from the peer. Nothing is written to w if the peer can
+// not be connected to or does not send the root block.
+func (ck *Checker) ExportCAR(ctx context.Context, w io.Writer, ai peer.AddrInfo, c cid.Cid, depth int, opts Options) error {
+	opts = opts.withDefaults()
+
+	testHost, err := ck.connectTestHost(ctx, ai, opts.PeerDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer testHost.Close()
+
+	f := newBlockFetcher(testHost, ai.ID, max(bitswapBlockTimeout, opts.BitswapTimeout))
+	defer f.close()
+
+	// The root is fetched before anything is written, so that callers can
+	// still report the failures of peers that do not serve the data
+	root, err := f.fetch(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err := writeCARHeader(w, c); err != nil {
+		return err
+	}
+
+	seen := map[cid.Cid]struct{}{c: {}}
+	var export func(b blocks.Block, depth int) error
+	export = func(b blocks.Block, depth int) error {
+		if err := writeCARBlock(w, b); err != nil {
+			return err
+		}
+		if depth == 0 {
+			return nil
+		}
+
+		links, err := blockLinks(b)
+		if err != nil {
+			return err
+		}
+		for _, l := range links {
+			if _, ok := seen[l]; ok {
+				continue
+			}
+			if len(seen) == carMaxBlocks {
+				return fmt.Errorf("the DAG has more than %d blocks", carMaxBlocks)
+			}
+			seen[l] = struct{}{}
+
+			lb, err := f.fetch(ctx, l)
+			if err != nil {
+				return err
+			}
+			if err := export(lb, depth-1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return export(root, depth)
+}
+
+// blockLinks returns the CIDs linked from b, for the codecs with a registered decoder
+func blockLinks(b blocks.Block) ([]cid.Cid, error) {
+	decode, err := multicodec.LookupDecoder(b.Cid().Prefix().Codec)
+	if err != nil {
+		return nil, fmt.Errorf("decoding block %s: %w", b.Cid(), err)
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := decode(nb, bytes.NewReader(b.RawData())); err != nil {
+		return nil, fmt.Errorf("decoding block %s: %w", b.Cid(), err)
+	}
+	links, err := traversal.SelectLinks(nb.Build())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]cid.Cid, 0, len(links))
+	for _, l := range links {
+		if cl, ok := l.(cidlink.Link); ok {
+			out = append(out, cl.Cid)
+		}
+	}
+	return out, nil
+}
+
+// writeCARHeader writes the header of a CARv1 file with a single root
+func writeCARHeader(w io.Writer, root cid.Cid) error {
+	header, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "roots", qp.List(1, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Link(cidlink.Link{Cid: root}))
+		}))
+		qp.MapEntry(ma, "version", qp.Int(1))
+	})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := dagcbor.Encode(header, &buf); err != nil {
+		return err
+	}
+	return writeCARSection(w, buf.Bytes())
+}
+
+func writeCARBlock(w io.Writer, b blocks.Block) error {
+	return writeCARSection(w, b.Cid().Bytes(), b.RawData())
+}
+
+// writeCARSection writes the concatenation of parts prefixed with its length
+func writeCARSection(w io.Writer, parts ...[]byte) error {
+	var n int
+	for _, p := range parts {
+		n += len(p)
+	}
+	if _, err := w.Write(varint.ToUvarint(uint64(n))); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	bsserver "github.com/ipfs/boxo/bitswap/server"
+	"github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
+	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCAR(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	target := newLoopbackHost(t)
+
+	leaf := rawBlock(t, "leaf")
+	root := dagCBORBlock(t, "root", leaf.Cid())
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, bstore.PutMany(ctx, []blocks.Block{leaf, root}))
+	bn := bsnet.NewFromIpfsHost(target, rhelp.Null{})
+	server := bsserver.New(ctx, bn, bstore)
+	bn.Start(server)
+	defer server.Close()
+
+	ck := &Checker{
+		newTestHost: func() (host.Host, error) {
+			return libp2p.New(libp2p.NoListenAddrs)
+		},
+	}
+	ai := peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()}
+
+	var buf bytes.Buffer
+	require.NoError(t, ck.ExportCAR(ctx, &buf, ai, root.Cid(), 1, Options{}))
+	var expected bytes.Buffer
+	require.NoError(t, writeCARHeader(&expected, root.Cid()))
+	require.NoError(t, writeCARBlock(&expected, root))
+	require.NoError(t, writeCARBlock(&expected, leaf))
+	require.Equal(t, expected.Bytes(), buf.Bytes())
+
+	// Nothing is written when the peer does not have the root
+	buf.Reset()
+	missing := rawBlock(t, "missing")
+	require.Error(t, ck.ExportCAR(ctx, &buf, ai, missing.Cid(), 1, Options{}))
+	require.Zero(t, buf.Len())
+}
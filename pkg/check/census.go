@@ -0,0 +1,128 @@
+package check
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// RecordCensusOutput is the census of the provider records of a CID held by
+// each of the DHT servers closest to it, which are the ones provides store
+// records on and lookups query
+type RecordCensusOutput struct {
+	CID CIDInfoOutput
+	// ClosestPeers is the number of closest DHT servers found, Responded the
+	// number of them that answered GET_PROVIDERS, and Holders the number of
+	// them holding provider records of the CID
+	ClosestPeers int
+	Responded    int
+	Holders      int
+	// Servers has the answer of each of the closest DHT servers, the ones
+	// holding the most provider records first
+	Servers []DHTServerCensusOutput
+	// Providers is the number of servers listing each provider. Providers
+	// listed by few servers did not reach all of them, or their records are
+	// expiring.
+	Providers map[string]int
+	// Diagnostics has the unverifiable or contradictory data returned by the
+	// servers, which flags servers returning bad or poisoned records
+	Diagnostics []DHTRecordProblem
+	Duration    time.Duration
+	Error       string
+}
+
+// DHTServerCensusOutput is the answer of one of the DHT servers closest to a
+// CID to GET_PROVIDERS
+type DHTServerCensusOutput struct {
+	ID string
+	// HoldsRecord is whether the server returned provider records of the CID,
+	// from the Providers it lists
+	HoldsRecord bool
+	Providers   []string
+	// Suspicious is whether the server returned data flagged in the
+	// Diagnostics of the census
+	Suspicious bool
+	Duration   time.Duration
+	// Error is why the server did not answer
+	Error string
+}
+
+// RecordCensus asks each of the DHT servers closest to c which providers of c
+// it holds records of. Unlike CheckCID, which stops at the first providers
+// found, it waits for every server to answer or time out, to show how the
+// records propagated and which servers misbehave. The providers and closer
+// peers returned are validated against the signed peer records the checker
+// holds.
+func (ck *Checker) RecordCensus(ctx context.Context, c cid.Cid) (*RecordCensusOutput, error) {
+	if err := ck.Denied(c, nil); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	out := &RecordCensusOutput{CID: inspectCID(c), Servers: []DHTServerCensusOutput{}, Providers: make(map[string]int), Diagnostics: []DHTRecordProblem{}}
+	defer func() { out.Duration = time.Since(start) }()
+
+	closestPeers, err := ck.timedRouting().GetClosestPeers(ctx, string(c.Hash()))
+	if err != nil {
+		out.Error = err.Error()
+		return out, nil
+	}
+	out.ClosestPeers = len(closestPeers)
+
+	// Like checkRecordPropagation, wait for every server to answer or time out
+	ctx, cancel := context.WithTimeout(ctx, propagationQueryTimeout)
+	defer cancel()
+	out.Servers = make([]DHTServerCensusOutput, len(closestPeers))
+	problems := make([][]DHTRecordProblem, len(closestPeers))
+	var wg sync.WaitGroup
+	for i, server := range closestPeers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := DHTServerCensusOutput{ID: server.String(), Providers: []string{}}
+			queryStart := time.Now()
+			provs, closer, err := ck.dhtMessenger.GetProviders(ctx, server, c.Hash())
+			s.Duration = time.Since(queryStart)
+			if err != nil {
+				s.Error = err.Error()
+			}
+			problems[i] = diagnoseDHTAnswer(ck.h.Peerstore(), server, provs, closer)
+			s.Suspicious = len(problems[i]) > 0
+			for _, prov := range provs {
+				s.Providers = append(s.Providers, prov.ID.String())
+			}
+			slices.Sort(s.Providers)
+			s.HoldsRecord = len(s.Providers) > 0
+			out.Servers[i] = s
+		}()
+	}
+	wg.Wait()
+	for _, p := range problems {
+		out.Diagnostics = append(out.Diagnostics, p...)
+	}
+	tallyCensus(out)
+	return out, nil
+}
+
+// tallyCensus counts the servers that answered and the servers listing each
+// provider, and sorts the servers of the census
+func tallyCensus(out *RecordCensusOutput) {
+	for _, s := range out.Servers {
+		if s.Error == "" {
+			out.Responded++
+		}
+		if s.HoldsRecord {
+			out.Holders++
+		}
+		for _, p := range s.Providers {
+			out.Providers[p]++
+		}
+	}
+	slices.SortStableFunc(out.Servers, func(a, b DHTServerCensusOutput) int {
+		return cmp.Or(cmp.Compare(len(b.Providers), len(a.Providers)), cmp.Compare(a.ID, b.ID))
+	})
+}
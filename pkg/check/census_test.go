@@ -0,0 +1,28 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTallyCensus(t *testing.T) {
+	out := &RecordCensusOutput{
+		Providers: make(map[string]int),
+		Servers: []DHTServerCensusOutput{
+			{ID: "a", Providers: []string{}},
+			{ID: "b", Providers: []string{"p1"}, HoldsRecord: true},
+			{ID: "c", Providers: []string{}, Error: "protocols not supported"},
+			{ID: "d", Providers: []string{"p1", "p2"}, HoldsRecord: true},
+		},
+	}
+	tallyCensus(out)
+	require.Equal(t, 3, out.Responded)
+	require.Equal(t, 2, out.Holders)
+	require.Equal(t, map[string]int{"p1": 2, "p2": 1}, out.Providers)
+	var ids []string
+	for _, s := range out.Servers {
+		ids = append(ids, s.ID)
+	}
+	require.Equal(t, []string{"d", "b", "a", "c"}, ids, "the servers holding the most records come first")
+}
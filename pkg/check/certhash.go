@@ -0,0 +1,104 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+)
+
+// CertHashCheckOutput is the result of validating the certificate hashes of a
+// WebTransport or WebRTC Direct address. Browsers can only dial these
+// addresses with valid certificate hashes matching the certificate of the peer.
+type CertHashCheckOutput struct {
+	Addr string
+	// Transport is TransportWebTransport or TransportWebRTC
+	Transport string
+	// CertHashes are the hash functions of the certificate hashes in the address
+	CertHashes []string
+	// Dialed is whether the address was dialed separately, and Connected
+	// whether that dial succeeded
+	Dialed    bool
+	Connected bool
+	// Error is the problem with the certificate hashes, empty if none was found
+	Error string
+}
+
+// checkCertHashes validates the certificate hashes of the WebTransport and
+// WebRTC Direct addresses in addrs. The results of dialing the addresses
+// separately, if any, tell certificate mismatches apart from other failures.
+func checkCertHashes(addrs []multiaddr.Multiaddr, dials []AddrDialOutput) []CertHashCheckOutput {
+	var out []CertHashCheckOutput
+	for _, addr := range addrs {
+		var transport string
+		switch {
+		case usesTransport(addr, TransportWebTransport):
+			transport = TransportWebTransport
+		case usesTransport(addr, TransportWebRTC):
+			transport = TransportWebRTC
+		default:
+			continue
+		}
+		res := CertHashCheckOutput{Addr: addr.String(), Transport: transport, CertHashes: []string{}}
+
+		var hashes []string
+		multiaddr.ForEach(addr, func(c multiaddr.Component) bool {
+			if c.Protocol().Code == multiaddr.P_CERTHASH {
+				hashes = append(hashes, c.Value())
+			}
+			return true
+		})
+		for _, h := range hashes {
+			name, err := certHashFunction(h)
+			if err != nil {
+				res.Error = err.Error()
+				break
+			}
+			res.CertHashes = append(res.CertHashes, name)
+			if name != "sha2-256" {
+				res.Error = fmt.Sprintf("browsers only accept sha2-256 certificate hashes, not %s", name)
+			}
+		}
+		switch {
+		case res.Error != "":
+		case len(hashes) == 0:
+			res.Error = "the address has no certhash, browsers can not dial it"
+		case transport == TransportWebRTC && len(hashes) > 1:
+			res.Error = "WebRTC Direct addresses must have a single certhash"
+		}
+
+		for _, d := range dials {
+			if d.Addr != res.Addr {
+				continue
+			}
+			res.Dialed = true
+			res.Connected = d.Error == ""
+			if res.Error == "" && isCertMismatch(d.Error) {
+				res.Error = "the certificate of the peer does not match the certhash, which is likely outdated: " + d.Error
+			}
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+// certHashFunction returns the name of the hash function of a certhash
+func certHashFunction(s string) (string, error) {
+	_, b, err := multibase.Decode(s)
+	if err != nil {
+		return "", fmt.Errorf("certhash %s is not multibase encoded: %w", s, err)
+	}
+	dh, err := multihash.Decode(b)
+	if err != nil {
+		return "", fmt.Errorf("certhash %s is not a multihash: %w", s, err)
+	}
+	return dh.Name, nil
+}
+
+// isCertMismatch returns whether a dial error is due to the certificate of
+// the peer not matching the certhash of the address
+func isCertMismatch(dialErr string) bool {
+	return strings.Contains(dialErr, "cert hash not found") || strings.Contains(dialErr, "fingerprint")
+}
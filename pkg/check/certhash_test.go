@@ -0,0 +1,55 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCertHashes(t *testing.T) {
+	certHash := func(code uint64) string {
+		mh, err := multihash.Sum([]byte("certificate"), code, -1)
+		require.NoError(t, err)
+		s, err := multibase.Encode(multibase.Base64url, mh)
+		require.NoError(t, err)
+		return s
+	}
+	sha256, sha1 := certHash(multihash.SHA2_256), certHash(multihash.SHA1)
+
+	addrs := []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001"),
+		multiaddr.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1/webtransport/certhash/" + sha256 + "/certhash/" + sha256),
+		multiaddr.StringCast("/ip4/1.2.3.4/udp/4002/quic-v1/webtransport"),
+		multiaddr.StringCast("/ip4/1.2.3.4/udp/4003/webrtc-direct/certhash/" + sha1),
+		multiaddr.StringCast("/ip4/1.2.3.4/udp/4004/webrtc-direct/certhash/" + sha256 + "/certhash/" + sha256),
+		multiaddr.StringCast("/ip4/1.2.3.4/udp/4005/webrtc-direct/certhash/" + sha256),
+	}
+	dials := []AddrDialOutput{
+		{Addr: addrs[1].String()},
+		{Addr: addrs[5].String(), Error: "failed to negotiate security protocol: remote fingerprint does not match"},
+	}
+
+	out := checkCertHashes(addrs, dials)
+	require.Len(t, out, 5, "only WebTransport and WebRTC Direct addresses are checked")
+
+	require.Equal(t, TransportWebTransport, out[0].Transport)
+	require.Equal(t, []string{"sha2-256", "sha2-256"}, out[0].CertHashes)
+	require.True(t, out[0].Dialed)
+	require.True(t, out[0].Connected)
+	require.Empty(t, out[0].Error)
+
+	require.Contains(t, out[1].Error, "no certhash")
+	require.False(t, out[1].Dialed)
+
+	require.Equal(t, TransportWebRTC, out[2].Transport)
+	require.Contains(t, out[2].Error, "only accept sha2-256")
+
+	require.Contains(t, out[3].Error, "single certhash")
+
+	require.True(t, out[4].Dialed)
+	require.False(t, out[4].Connected)
+	require.Contains(t, out[4].Error, "does not match the certhash")
+}
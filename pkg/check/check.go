@@ -0,0 +1,1690 @@
+// Package check implements the checks run by ipfs-check: whether the data of
+// a CID can be retrieved over Bitswap from the providers found in the DHT and
+// IPNI, or from a given peer. Other Go programs, e.g. pinning services or
+// gateways, can use it to run the same diagnostics in-process.
+package check
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/routing/http/client"
+	"github.com/ipfs/boxo/routing/http/contentrouter"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/fullrt"
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	mplex "github.com/libp2p/go-libp2p-mplex"
+	record "github.com/libp2p/go-libp2p-record"
+	coreconnmgr "github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DHT is the DHT client used to find providers and peers
+type DHT interface {
+	routing.Routing
+	io.Closer
+	GetClosestPeers(ctx context.Context, key string) ([]peer.ID, error)
+}
+
+// Sources of the providers in the results of a CID check
+const (
+	IPNISource   = "IPNI"
+	DHTSource    = "Amino DHT"
+	CallerSource = "Request"
+)
+
+// errNoAddrsSupplied is the connection error of the providers passed by the
+// caller without addresses, which are not looked up in the DHT
+const errNoAddrsSupplied = "no addresses supplied for the provider, pass its multiaddrs"
+
+// DefaultIndexerURL is the IPNI indexer used when Options.IPNIIndexer is empty
+const DefaultIndexerURL = "https://cid.contact"
+
+// Settings of the host and DHT client of an ephemeral checker, see
+// Config.Ephemeral
+const (
+	ephemeralConnsLowWater       = 20
+	ephemeralConnsHighWater      = 100
+	ephemeralConnsGracePeriod    = 10 * time.Second
+	ephemeralRefreshQueryTimeout = 5 * time.Second
+)
+
+// TODO: make this configurable
+var defaultProtocolFilter = []string{ProtocolBitswap, ProtocolHTTP, "unknown"}
+
+// Config configures a Checker
+type Config struct {
+	// Host and DHT are an existing libp2p host and DHT client to run the
+	// checks with. When Host is nil, New creates both from the settings below
+	// and Close shuts them down.
+	Host host.Host
+	DHT  DHT
+	// NewTestHost creates the short-lived hosts the checked peers are dialed
+	// from, defaulting to hosts using the settings below
+	NewTestHost func() (host.Host, error)
+	// NewIsolatedHost creates the hosts each address of the checked peers is
+	// dialed from separately. They must be new hosts, without listen
+	// addresses and with an empty peerstore, see AddrDialOutput.Isolated. It
+	// defaults to such hosts using the settings below, unless NewTestHost is
+	// set, whose hosts are then used and the dials not reported as isolated.
+	NewIsolatedHost func() (host.Host, error)
+
+	// BootstrapPeers are the peers used to join the DHT, defaulting to the
+	// Amino DHT bootstrappers
+	BootstrapPeers []peer.AddrInfo
+	// FallbackBootstrapPeers are joined through instead of BootstrapPeers
+	// while none of BootstrapPeers can be connected to, e.g. bootstrappers run
+	// by another organization. The accelerated DHT client uses both from the
+	// start.
+	FallbackBootstrapPeers []peer.AddrInfo
+	// DHTProtocolPrefix is the prefix of the DHT protocol, /ipfs by default
+	DHTProtocolPrefix protocol.ID
+	// AcceleratedDHT uses the accelerated DHT client, which maps the whole DHT
+	// before being ready
+	AcceleratedDHT bool
+	// PSK is the pre-shared key of a private network, nil for the public network
+	PSK pnet.PSK
+	// AttestationKey signs the attestations of Attest, the key of the host
+	// when nil
+	AttestationKey crypto.PrivKey
+	// DNSResolver resolves DNS multiaddrs, madns.DefaultResolver by default
+	DNSResolver *madns.Resolver
+	// PrometheusRegisterer registers the metrics of the libp2p host, the
+	// default Prometheus registerer when nil
+	PrometheusRegisterer prometheus.Registerer
+	// UserAgent is the libp2p user agent of the hosts
+	UserAgent string
+	// ResourceLimits bound the resources of the host created by New,
+	// unlimited by default
+	ResourceLimits ResourceLimits
+	// GeoIP annotates the addresses of the checked peers with their country
+	// and autonomous system, disabled when nil. It is not closed by Close.
+	GeoIP *GeoIP
+	// Denylist lists the peers and networks the checker refuses to dial and
+	// the CIDs it refuses to check, nothing is denied when nil
+	Denylist *Denylist
+	// PublicDenylists are the denylists of public gateways, e.g. badbits,
+	// which checks report whether the checked CID is in. Loading them is up
+	// to the caller.
+	PublicDenylists []*PublicDenylist
+	// DatastorePath is a directory where the peers of the routing table are
+	// saved, with their addresses, to be restored on the next start. The
+	// accelerated DHT client then connects to them instead of crawling the
+	// whole DHT. Nothing is saved when empty.
+	DatastorePath string
+	// AddrFamily restricts the hosts created by New to listen on and dial the
+	// addresses of one IP family, AddrFamilyIPv4 or AddrFamilyIPv6, e.g. in
+	// IPv6-only data centers. The addresses of the other family are flagged
+	// in the results with AddrWarningUnreachableFamily. Both are used when
+	// empty.
+	AddrFamily string
+	// Ephemeral tunes the host and DHT client created by New for short-lived
+	// instances, e.g. spot instances: the connection manager keeps fewer
+	// connections and the routing table refresh queries time out sooner. It
+	// requires the standard DHT client and no DatastorePath.
+	Ephemeral bool
+	// LocalNetwork lets the hosts created by New dial and accept private and
+	// loopback addresses, and enables DiscoverLocalPeers, so that instances
+	// run on a LAN can check the nodes of that network. Public instances
+	// should not enable it, as it lets their users make the checker dial
+	// the network it runs in.
+	LocalNetwork bool
+	// AddrPolicy decides which addresses the hosts created by New dial,
+	// refusing private addresses when nil. LocalNetwork overrides its
+	// AllowPrivate. The addresses it refuses are not dialed and reported in
+	// the FilteredAddrs of the results.
+	AddrPolicy *AddrPolicy
+	// ConnectionGater filters the connections of the hosts created by New,
+	// replacing the default gater, which applies AddrPolicy and refuses the
+	// peers and addresses of Denylist. Only the denylist is then reported in
+	// FilteredAddrs.
+	ConnectionGater coreconnmgr.ConnectionGater
+}
+
+// Checker runs checks from a libp2p host connected to the DHT. It is safe for
+// concurrent use.
+type Checker struct {
+	h            host.Host
+	dht          DHT
+	dhtMessenger *dhtpb.ProtocolMessenger
+	// dhtProtocol is the protocol ID of the DHT, e.g. /ipfs/kad/1.0.0, and
+	// dhtPrefix its prefix
+	dhtProtocol protocol.ID
+	dhtPrefix   protocol.ID
+	newTestHost func() (host.Host, error)
+	// newSelfTestHost creates the hosts of SelfTest, which are not gated as
+	// they connect to each other
+	newSelfTestHost func() (host.Host, error)
+	// newIsolatedHost creates the hosts of the dials of single addresses, and
+	// isolatedDials is whether they are isolated
+	newIsolatedHost func() (host.Host, error)
+	isolatedDials   bool
+	dnsResolver     *madns.Resolver
+	// crawler tracks the crawls of the accelerated DHT client, nil for the standard one
+	crawler *progressCrawler
+	// fallbackDHT is the standard DHT client used while the accelerated DHT
+	// client is not ready, nil when it is not used
+	fallbackDHT DHT
+	// datastorePath is where the routing table snapshot is saved on Close, empty to not save it
+	datastorePath string
+	// ownsHost is whether the host and DHT client were created by New
+	ownsHost bool
+	// bootstrap are the peers used to join the DHT
+	bootstrap *bootstrapSets
+	// queryLatency has the durations of the recent DHT lookups of checks
+	queryLatency latencyWindow
+	// geoIP locates the addresses of the checked peers, nil if disabled
+	geoIP *GeoIP
+	// denylist lists the peers and CIDs that are not checked, nil if disabled
+	denylist *Denylist
+	// publicDenylists are the denylists the checked CIDs are looked up in
+	publicDenylists []*PublicDenylist
+	// addrFamily is the only IP family the checker dials, both when empty
+	addrFamily string
+	// localNetwork is whether DiscoverLocalPeers is enabled, see
+	// Config.LocalNetwork
+	localNetwork bool
+	// addrPolicy decides which addresses are dialed, and enforceAddrPolicy
+	// is whether the hosts of the checks are gated by it, i.e. were not
+	// passed in the Config
+	addrPolicy        AddrPolicy
+	enforceAddrPolicy bool
+	// pinningClient queries the pinning services, see CheckPinningService
+	pinningClient *http.Client
+	// attestationKey is Config.AttestationKey
+	attestationKey crypto.PrivKey
+	// probes are the probes added to the peer checks with RegisterProbe
+	probesMu sync.RWMutex
+	probes   []Probe
+}
+
+// New returns a Checker configured by cfg
+func New(ctx context.Context, cfg Config) (*Checker, error) {
+	if !ValidAddrFamily(cfg.AddrFamily) {
+		return nil, fmt.Errorf("invalid address family %q, must be %s or %s", cfg.AddrFamily, AddrFamilyIPv4, AddrFamilyIPv6)
+	}
+	if cfg.Ephemeral && (cfg.AcceleratedDHT || cfg.DatastorePath != "") {
+		return nil, errors.New("an ephemeral checker can not use the accelerated DHT client or a datastore")
+	}
+	if cfg.DHTProtocolPrefix == "" {
+		cfg.DHTProtocolPrefix = dht.DefaultPrefix
+	}
+	if len(cfg.BootstrapPeers) == 0 {
+		cfg.BootstrapPeers = dht.GetDefaultBootstrapPeerAddrInfos()
+	}
+	if cfg.DNSResolver == nil {
+		cfg.DNSResolver = madns.DefaultResolver
+	}
+	var policy AddrPolicy
+	if cfg.AddrPolicy != nil {
+		policy = *cfg.AddrPolicy
+	}
+	policy.AllowPrivate = policy.AllowPrivate || cfg.LocalNetwork
+	enforcePolicy := cfg.ConnectionGater == nil && cfg.NewTestHost == nil && cfg.NewIsolatedHost == nil
+	if cfg.ConnectionGater == nil {
+		cfg.ConnectionGater = &privateAddrFilterConnectionGater{deny: cfg.Denylist, geoIP: cfg.GeoIP, family: cfg.AddrFamily, policy: policy}
+	}
+
+	ck := &Checker{
+		h:               cfg.Host,
+		dht:             cfg.DHT,
+		newTestHost:     cfg.NewTestHost,
+		dnsResolver:     cfg.DNSResolver,
+		bootstrap:       &bootstrapSets{primary: cfg.BootstrapPeers, fallback: cfg.FallbackBootstrapPeers},
+		geoIP:           cfg.GeoIP,
+		denylist:        cfg.Denylist,
+		publicDenylists: cfg.PublicDenylists,
+		addrFamily:      cfg.AddrFamily,
+		localNetwork:    cfg.LocalNetwork,
+		attestationKey:  cfg.AttestationKey,
+
+		addrPolicy:        policy,
+		enforceAddrPolicy: enforcePolicy,
+		pinningClient:     policy.HTTPClient(),
+	}
+	ck.newIsolatedHost, ck.isolatedDials = cfg.NewIsolatedHost, cfg.NewIsolatedHost != nil
+	switch {
+	case ck.newIsolatedHost == nil && ck.newTestHost == nil:
+		ck.newIsolatedHost = func() (host.Host, error) {
+			// Without listen addresses, connections are made from new
+			// source ports rather than from the ports of listeners
+			return libp2p.New(
+				libp2p.NoListenAddrs,
+				libp2p.ConnectionGater(cfg.ConnectionGater),
+				libp2p.DefaultMuxers,
+				libp2p.Muxer("/mplex/6.7.0", mplex.DefaultTransport),
+				libp2p.UserAgent(cfg.UserAgent),
+				libp2p.MultiaddrResolver(cfg.DNSResolver),
+				privateNetworkOption(cfg.PSK),
+			)
+		}
+		ck.isolatedDials = true
+	case ck.newIsolatedHost == nil:
+		ck.newIsolatedHost = ck.newTestHost
+	}
+	ck.newSelfTestHost = ck.newTestHost
+	if ck.newSelfTestHost == nil {
+		ck.newSelfTestHost = func() (host.Host, error) {
+			return libp2p.New(
+				libp2p.DefaultMuxers,
+				libp2p.UserAgent(cfg.UserAgent),
+				libp2p.MultiaddrResolver(cfg.DNSResolver),
+				privateNetworkOption(cfg.PSK),
+				listenAddrsOption(cfg.AddrFamily, cfg.PSK != nil),
+			)
+		}
+	}
+	if ck.newTestHost == nil {
+		ck.newTestHost = func() (host.Host, error) {
+			// TODO: when behind NAT, this will fail to determine its own public addresses which will block it from running dctur and hole punching
+			// See https://github.com/libp2p/go-libp2p/issues/2941
+			return libp2p.New(
+				libp2p.ConnectionGater(cfg.ConnectionGater),
+				libp2p.DefaultMuxers,
+				libp2p.Muxer("/mplex/6.7.0", mplex.DefaultTransport),
+				libp2p.EnableHolePunching(),
+				libp2p.UserAgent(cfg.UserAgent),
+				libp2p.MultiaddrResolver(cfg.DNSResolver),
+				privateNetworkOption(cfg.PSK),
+				listenAddrsOption(cfg.AddrFamily, cfg.PSK != nil),
+			)
+		}
+	}
+
+	switch {
+	case ck.h == nil:
+		if err := ck.startHost(ctx, cfg); err != nil {
+			return nil, err
+		}
+	case ck.dht == nil:
+		return nil, errors.New("a DHT client is required when passing a host")
+	default:
+		ck.bootstrap.h = ck.h
+	}
+
+	ck.dhtPrefix = cfg.DHTProtocolPrefix
+	ck.dhtProtocol = cfg.DHTProtocolPrefix + "/kad/1.0.0"
+	pm, err := dhtProtocolMessenger(ck.dhtProtocol, ck.h)
+	if err != nil {
+		_ = ck.Close()
+		return nil, err
+	}
+	ck.dhtMessenger = pm
+	return ck, nil
+}
+
+// startHost creates the libp2p host and DHT client of the checker
+func (ck *Checker) startHost(ctx context.Context, cfg Config) error {
+	rm, err := NewResourceManager(cfg.ResourceLimits)
+	if err != nil {
+		return err
+	}
+
+	lowWater, highWater, gracePeriod := 100, 900, 30*time.Second
+	if cfg.Ephemeral {
+		lowWater, highWater, gracePeriod = ephemeralConnsLowWater, ephemeralConnsHighWater, ephemeralConnsGracePeriod
+	}
+	c, err := connmgr.NewConnManager(lowWater, highWater, connmgr.WithGracePeriod(gracePeriod))
+	if err != nil {
+		return err
+	}
+
+	opts := []libp2p.Option{
+		libp2p.DefaultMuxers,
+		libp2p.Muxer(mplex.ID, mplex.DefaultTransport),
+		libp2p.ConnectionManager(c),
+		libp2p.ConnectionGater(cfg.ConnectionGater),
+		libp2p.ResourceManager(rm),
+		libp2p.EnableHolePunching(),
+		libp2p.UserAgent(cfg.UserAgent),
+		libp2p.MultiaddrResolver(cfg.DNSResolver),
+		privateNetworkOption(cfg.PSK),
+		listenAddrsOption(cfg.AddrFamily, cfg.PSK != nil),
+	}
+	if cfg.PrometheusRegisterer != nil {
+		opts = append(opts, libp2p.PrometheusRegisterer(cfg.PrometheusRegisterer))
+	}
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return err
+	}
+	ck.bootstrap.h = h
+
+	var snapshot *routingSnapshot
+	if cfg.DatastorePath != "" {
+		snapshot = loadFreshSnapshot(cfg.DatastorePath)
+		if snapshot != nil {
+			// Restore the peerstore
+			for _, ai := range snapshot.Peers {
+				h.Peerstore().AddAddrs(ai.ID, ai.Addrs, peerstore.AddressTTL)
+			}
+		}
+	}
+
+	var d DHT
+	if cfg.AcceleratedDHT {
+		ck.crawler, err = newProgressCrawler(h, cfg.DatastorePath, snapshot)
+		if err != nil {
+			_ = h.Close()
+			return err
+		}
+		d, err = fullrt.NewFullRT(h, cfg.DHTProtocolPrefix,
+			fullrt.WithCrawler(ck.crawler),
+			fullrt.DHTOption(
+				dht.BucketSize(20),
+				dht.Validator(record.NamespacedValidator{
+					"pk":   record.PublicKeyValidator{},
+					"ipns": ipns.Validator{},
+				}),
+				dht.BootstrapPeers(ck.bootstrap.all()...),
+				dht.Mode(dht.ModeClient),
+			))
+		if err == nil {
+			// Serve checks with the standard client until the whole DHT is mapped
+			ck.fallbackDHT, err = dht.New(ctx, h, dht.Mode(dht.ModeClient), dht.ProtocolPrefix(cfg.DHTProtocolPrefix), dht.BootstrapPeersFunc(ck.bootstrap.peers))
+			if err != nil {
+				_ = d.Close()
+			}
+		}
+	} else {
+		dhtOpts := []dht.Option{dht.Mode(dht.ModeClient), dht.ProtocolPrefix(cfg.DHTProtocolPrefix), dht.BootstrapPeersFunc(ck.bootstrap.peers)}
+		if cfg.Ephemeral {
+			dhtOpts = append(dhtOpts, dht.RoutingTableRefreshQueryTimeout(ephemeralRefreshQueryTimeout))
+		}
+		d, err = dht.New(ctx, h, dhtOpts...)
+	}
+
+	if err != nil {
+		_ = h.Close()
+		return err
+	}
+
+	ck.h = h
+	ck.dht = d
+	ck.datastorePath = cfg.DatastorePath
+	ck.ownsHost = true
+	return nil
+}
+
+// Host returns the libp2p host used for DHT and IPNI lookups
+func (ck *Checker) Host() host.Host {
+	return ck.h
+}
+
+// Ready returns whether the DHT client is ready, which is only false while
+// the accelerated DHT client maps the DHT. Checks are run with the standard
+// DHT client in the meantime.
+func (ck *Checker) Ready() bool {
+	if frt, ok := ck.dht.(*fullrt.FullRT); ok {
+		return frt.Ready()
+	}
+	return true
+}
+
+// Routing clients reported by Checker.Routing
+const (
+	AcceleratedDHTRouting = "accelerated DHT"
+	StandardDHTRouting    = "standard DHT"
+)
+
+// Routing returns which DHT client checks currently use
+func (ck *Checker) Routing() string {
+	if _, ok := ck.routing().(*fullrt.FullRT); ok {
+		return AcceleratedDHTRouting
+	}
+	return StandardDHTRouting
+}
+
+// routing returns the DHT client to run checks with, the standard one while
+// the accelerated one is not ready
+func (ck *Checker) routing() DHT {
+	if ck.fallbackDHT != nil && !ck.Ready() {
+		return ck.fallbackDHT
+	}
+	return ck.dht
+}
+
+// timedRouting returns the DHT client of routing, recording the durations of
+// its lookups for NetworkStatus
+func (ck *Checker) timedRouting() DHT {
+	return timedDHT{DHT: ck.routing(), latency: &ck.queryLatency}
+}
+
+// Close shuts down the DHT client and the libp2p host if they were created by New
+func (ck *Checker) Close() error {
+	if !ck.ownsHost {
+		return nil
+	}
+	var errs []error
+	if ck.datastorePath != "" {
+		if err := ck.saveSnapshot(); err != nil {
+			errs = append(errs, fmt.Errorf("saving routing table snapshot: %w", err))
+		}
+	}
+	if err := ck.dht.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("closing DHT client: %w", err))
+	}
+	if ck.fallbackDHT != nil {
+		if err := ck.fallbackDHT.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing fallback DHT client: %w", err))
+		}
+	}
+	if err := ck.h.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("closing libp2p host: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Options tune a single check. Zero fields take the value of DefaultOptions.
+type Options struct {
+	// IPNIIndexer is the delegated routing endpoint used to find providers
+	IPNIIndexer string
+	// KuboRPC is the RPC API endpoint of a Kubo node whose view of the network
+	// is compared with the checker's own (disabled when empty)
+	KuboRPC string
+	// ClusterAPI is the REST API endpoint of an IPFS Cluster whose pins are
+	// compared with what the peers serve (disabled when empty)
+	ClusterAPI string
+	// PieceIndexer is the endpoint CheckPieceCID asks for the payload CIDs of
+	// Filecoin pieces (disabled when empty)
+	PieceIndexer string
+	// MaxProviders is the number of providers at which to stop looking for
+	// providers in a CID check
+	MaxProviders int
+	// ProviderSelection is the strategy used to select the providers checked
+	// in a CID check, one of ProviderSelections
+	ProviderSelection string
+	// PreferQUIC selects the providers with public QUIC addresses before the
+	// others in a CID check
+	PreferQUIC bool
+	// FilecoinRetrieval probes the Graphsync and HTTP piece retrieval
+	// endpoints of the Filecoin storage providers found in IPNI in CID checks
+	FilecoinRetrieval bool
+	// RankBy orders the providers of a CID check by one of RankMetrics, from
+	// the recommended one, see RankProviders. They are in the order their
+	// checks ended by default.
+	RankBy string
+	// ProviderDialTimeout bounds connecting to each provider in a CID check
+	ProviderDialTimeout time.Duration
+	// PeerDialTimeout bounds connecting to the peer in a peer check
+	PeerDialTimeout time.Duration
+	// AddrDialTimeout bounds dialing each address of the peer separately in a peer check
+	AddrDialTimeout time.Duration
+	// BitswapTimeout is how long to wait for a peer to answer a Bitswap request
+	BitswapTimeout time.Duration
+	// FetchBlock requests the block from peers that claim to have it
+	FetchBlock bool
+	// AutoNAT asks the peer to dial the checker back in peer checks
+	AutoNAT bool
+	// BitswapVersions asks the peer for the CID over each Bitswap protocol
+	// version separately in peer checks
+	BitswapVersions bool
+	// Path is a UnixFS path under the checked CID. When set, it is resolved
+	// with the blocks of each peer and the CID it points to is checked instead.
+	Path []string
+	// Transport restricts the dials to the peers to the direct addresses of
+	// one of Transports, all addresses being dialed when empty
+	Transport string
+	// DeepCheck asks each of the DHT servers closest to the CID whether it
+	// holds a provider record of the peer in peer checks
+	DeepCheck bool
+	// DAGMaxBlocks downloads the DAG rooted at the checked CID from the peer
+	// in peer checks, up to that many blocks, when positive. It is not
+	// downloaded by default, as it can take long.
+	DAGMaxBlocks int
+	// ThroughputMiB downloads up to that many MiB of the DAG rooted at the
+	// checked CID from the peer in peer checks, when positive, to measure
+	// how fast it serves data
+	ThroughputMiB int
+	// Retries is how many times the connection to a peer and its Bitswap check
+	// are retried when they fail in a way that may be transient, e.g. behind
+	// a flaky NAT, at most MaxRetries. They are not retried by default.
+	Retries int
+	// RetryBackoff is how long to wait before the first retry, each next one
+	// waiting twice as long as the previous one
+	RetryBackoff time.Duration
+	// StageBudgets bound the time each stage of peer and node checks can
+	// take. They are not bounded by default.
+	StageBudgets StageBudgets
+	// OnStage is called with the name of each stage a peer or node check
+	// enters, one of StageRouting, StageDial, StageBitswap and
+	// StageDiagnostics, e.g. to show the progress of checks. CID checks only
+	// report StageRouting, as their providers are checked as they are found.
+	OnStage func(stage string)
+}
+
+// DefaultOptions returns the options used for the zero fields of Options
+func DefaultOptions() Options {
+	return Options{
+		IPNIIndexer:         DefaultIndexerURL,
+		MaxProviders:        10,
+		ProviderSelection:   SelectFirst,
+		ProviderDialTimeout: 15 * time.Second,
+		PeerDialTimeout:     120 * time.Second,
+		AddrDialTimeout:     15 * time.Second,
+		BitswapTimeout:      10 * time.Second,
+		RetryBackoff:        time.Second,
+	}
+}
+
+func (o Options) withDefaults() Options {
+	def := DefaultOptions()
+	o.IPNIIndexer = cmp.Or(o.IPNIIndexer, def.IPNIIndexer)
+	o.MaxProviders = cmp.Or(o.MaxProviders, def.MaxProviders)
+	o.ProviderSelection = cmp.Or(o.ProviderSelection, def.ProviderSelection)
+	o.ProviderDialTimeout = cmp.Or(o.ProviderDialTimeout, def.ProviderDialTimeout)
+	o.PeerDialTimeout = cmp.Or(o.PeerDialTimeout, def.PeerDialTimeout)
+	o.AddrDialTimeout = cmp.Or(o.AddrDialTimeout, def.AddrDialTimeout)
+	o.BitswapTimeout = cmp.Or(o.BitswapTimeout, def.BitswapTimeout)
+	o.RetryBackoff = cmp.Or(o.RetryBackoff, def.RetryBackoff)
+	o.Retries = min(o.Retries, MaxRetries)
+	return o
+}
+
+// ProviderOutput is the result of checking a provider in a CID check
+type ProviderOutput struct {
+	ID                       string
+	ConnectionError          string
+	Addrs                    []string
+	ConnectionMaddrs         []string
+	DataAvailableOverBitswap BitswapCheckOutput
+	// DataAvailableOverHTTP is the result of requesting the block over HTTP
+	// from the providers found in IPNI that advertise it, nil otherwise
+	DataAvailableOverHTTP *HTTPCheckOutput
+	// RetrievalProtocols compares the retrieval protocols the provider
+	// advertises in IPNI with the ones it served the block over, nil for
+	// providers not found in IPNI
+	RetrievalProtocols []ProtocolCheckOutput
+	Source             string
+	// FoundByKubo is whether the configured Kubo node also found this provider
+	FoundByKubo bool
+	// Cluster is the status of the pin of the CID on the cluster peer whose
+	// IPFS daemon is the provider, nil if the provider is not part of the
+	// configured IPFS Cluster
+	Cluster *ClusterPinStatus
+	// AddrWarnings lists problems with the provider's addresses found before dialing
+	AddrWarnings []AddrWarning
+	// FilteredAddrs are the addresses of the provider that were not dialed,
+	// with the reason why
+	FilteredAddrs []FilteredAddrOutput
+	// DNSResolutions has the result of resolving the DNS addresses of the provider
+	DNSResolutions []DNSResolutionOutput
+	// AddrLocations has the country and autonomous system of the addresses
+	// of the provider, nil unless GeoIP databases are configured
+	AddrLocations []AddrLocation
+	// AddrFamilies has the results of dialing the IPv4 and IPv6 addresses of
+	// the provider separately, nil unless the provider is dual-stack
+	AddrFamilies *AddrFamiliesOutput
+	// PathResolution is the result of resolving Options.Path with the blocks
+	// of the provider, nil without a path or if the provider could not be
+	// connected to
+	PathResolution *PathResolutionOutput
+	// Advertisements tells whether the provider advertises the CID in the DHT
+	// and in IPNI, nil when the providers were passed to CheckProviders
+	Advertisements *AdvertisementsOutput
+	// CachedAt is when the result was computed if it was served from a cache,
+	// nil for fresh results
+	CachedAt *time.Time
+	// DialBackoff is whether the host of the checker had a failed dial of the
+	// peer in backoff, which was cleared so that the peer was dialed again
+	DialBackoff bool
+	// DialAttempts are the attempts of connecting to the provider, more than one
+	// when the connection failed and was retried
+	DialAttempts []AttemptOutput
+	// ResourceLimited is whether the connection or the Bitswap check failed
+	// because the resource manager of the checker refused a connection or
+	// stream. The failure then says nothing about the provider.
+	ResourceLimited bool
+	// Denied is whether the provider, or all its addresses, are in the
+	// denylist of the checker, which did not dial it
+	Denied bool
+	// PeerIDMismatch is set when the addresses of the provider are served
+	// by another peer
+	PeerIDMismatch *PeerIDMismatchOutput
+	// CertHashChecks validates the certificate hashes of the WebTransport and
+	// WebRTC Direct addresses of the provider
+	CertHashChecks []CertHashCheckOutput
+	// Connections has the protocols negotiated on each of ConnectionMaddrs
+	Connections []ConnectionStateOutput
+	// Timings has the duration of each stage of the check of the provider
+	Timings TimingsOutput
+	// CID describes the checked CID
+	CID CIDInfoOutput
+	// FilecoinRetrieval is the result of probing the retrieval endpoints of
+	// the provider when it is a Filecoin storage provider advertising the
+	// CID over Graphsync in IPNI, nil otherwise or without
+	// Options.FilecoinRetrieval
+	FilecoinRetrieval *FilecoinRetrievalOutput
+	// Rank is the position of the provider in the order of Options.RankBy,
+	// from 1, 0 when the providers are not ranked or the provider could not
+	// be
+	Rank int
+}
+
+// Available returns whether the provider could be connected to and has the
+// block, or sent it over HTTP
+func (o *ProviderOutput) Available() bool {
+	return (o.ConnectionError == "" && o.DataAvailableOverBitswap.Found) ||
+		(o.DataAvailableOverHTTP != nil && o.DataAvailableOverHTTP.Found)
+}
+
+// CheckCID finds providers of a given CID, using the DHT and IPNI
+// concurrently. A check of connectivity and Bitswap availability is performed
+// for each provider found. When a Kubo RPC endpoint is set, the providers it
+// finds are compared with the ones found by the checker. If opts.FetchBlock
+// is set, the block is downloaded from providers that claim to have it.
+//
+// With the default SelectFirst strategy, providers are checked as soon as
+// they are found. Other strategies, and opts.PreferQUIC, first collect the
+// providers found until the lookups end to select the ones to check.
+func (ck *Checker) CheckCID(ctx context.Context, cidKey cid.Cid, opts Options) ([]ProviderOutput, error) {
+	if ck.denylist.deniesCID(cidKey) {
+		return nil, ErrDeniedCID
+	}
+	opts = opts.withDefaults()
+	opts.stage(StageRouting)
+	crClient, err := client.New(opts.IPNIIndexer,
+		client.WithStreamResultsRequired(),               // // https://specs.ipfs.tech/routing/http-routing-v1/#streaming
+		client.WithProtocolFilter(defaultProtocolFilter), // IPIP-484
+		client.WithDisabledLocalFiltering(false),         // force local filtering in case remote server does not support IPIP-484
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create content router client: %w", err)
+	}
+	routerClient := contentrouter.NewContentRoutingClient(crClient)
+
+	queryCtx, cancelQuery := context.WithCancel(ctx)
+	defer cancelQuery()
+	start := time.Now()
+
+	maxProvidersCount := opts.MaxProviders
+	if opts.ProviderSelection == SelectAll {
+		maxProvidersCount = maxProviderCandidates
+	}
+
+	// half of the max providers count per source
+	providersPerSource := maxProvidersCount >> 1
+	if maxProvidersCount == 1 {
+		// Ensure at least one provider from each source when maxProvidersCount is 1
+		providersPerSource = 1
+	}
+	// Selecting the providers requires collecting all of them first, up to
+	// maxProviderCandidates
+	collect := opts.ProviderSelection != SelectFirst || opts.PreferQUIC
+	if collect {
+		providersPerSource = 0
+	}
+
+	// Find providers with DHT and IPNI concurrently (each half of the max providers count)
+	dhtProvsCh := ck.routing().FindProvidersAsync(queryCtx, cidKey, providersPerSource)
+	ipniProvsCh, ipniProtocols := findIPNIProvidersAsync(queryCtx, crClient, cidKey)
+
+	// While the providers are checked, collect all the provider records of
+	// both systems to tell where each provider advertises the CID
+	advCtx, cancelAdv := context.WithCancel(ctx)
+	defer cancelAdv()
+	var inDHT, inIPNI map[peer.ID]struct{}
+	var advWg sync.WaitGroup
+	advWg.Add(2)
+	go func() {
+		defer advWg.Done()
+		inDHT = findAllProviders(advCtx, ck.routing(), cidKey)
+	}()
+	go func() {
+		defer advWg.Done()
+		inIPNI = findAllProviders(advCtx, routerClient, cidKey)
+	}()
+
+	// The Kubo node looks for providers for as long as the checker does
+	var kuboProvs []peer.AddrInfo
+	kuboDone := make(chan struct{})
+	if opts.KuboRPC != "" {
+		go func() {
+			defer close(kuboDone)
+			err := newKuboClient(opts.KuboRPC).findProviders(queryCtx, cidKey, maxProvidersCount, func(p peer.AddrInfo) bool {
+				kuboProvs = append(kuboProvs, p)
+				return true
+			})
+			if err != nil && queryCtx.Err() == nil {
+				log.Printf("Error finding providers with Kubo RPC: %v\n", err)
+			}
+		}()
+	} else {
+		close(kuboDone)
+	}
+
+	// The cluster is asked for the status of the pins while the providers are found
+	var clusterPins []clusterPin
+	clusterDone := make(chan struct{})
+	if opts.ClusterAPI != "" {
+		go func() {
+			defer close(clusterDone)
+			var err error
+			clusterPins, err = newClusterClient(opts.ClusterAPI).pinStatus(ctx, cidKey)
+			if err != nil {
+				log.Printf("Error getting the pin status from IPFS Cluster: %v\n", err)
+			}
+		}()
+	} else {
+		close(clusterDone)
+	}
+
+	out := make([]ProviderOutput, 0, maxProvidersCount)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var providersCount int
+	var done bool
+
+	checkProvider := func(provider peer.AddrInfo, src string) {
+		defer wg.Done()
+
+		foundAfter := time.Since(start)
+		provOutput := ck.checkProvider(ctx, provider, src, cidKey, opts)
+		provOutput.Timings.Routing += foundAfter
+		provOutput.Timings.Total += foundAfter
+		if protocols, ok := ipniProtocols.get(provider.ID); ok && !provOutput.Denied {
+			ck.checkRetrievalProtocols(ctx, &provOutput, provider, protocols, cidKey, opts)
+			if opts.FilecoinRetrieval && slices.Contains(protocols, ProtocolGraphsync) {
+				provOutput.FilecoinRetrieval = ck.checkFilecoinRetrieval(ctx, provider, ipniProtocols.graphsyncMetadata(provider.ID), opts)
+			}
+		}
+
+		mu.Lock()
+		out = append(out, provOutput)
+		mu.Unlock()
+	}
+
+	if collect {
+		done = true
+		candidates := collectProviders(dhtProvsCh, ipniProvsCh, maxProviderCandidates)
+		for _, c := range selectProviders(candidates, opts.MaxProviders, opts.ProviderSelection, opts.PreferQUIC) {
+			wg.Add(1)
+			go checkProvider(c.AddrInfo, c.source)
+		}
+	}
+	for !done {
+		var provider peer.AddrInfo
+		var open bool
+		var source string
+
+		select {
+		case provider, open = <-dhtProvsCh:
+			if !open {
+				dhtProvsCh = nil
+				if ipniProvsCh == nil {
+					done = true
+				}
+				continue
+			}
+			source = DHTSource
+		case provider, open = <-ipniProvsCh:
+			if !open {
+				ipniProvsCh = nil
+				if dhtProvsCh == nil {
+					done = true
+				}
+				continue
+			}
+			source = IPNISource
+		}
+		providersCount++
+		if providersCount == maxProvidersCount {
+			done = true
+		}
+
+		wg.Add(1)
+		go checkProvider(provider, source)
+	}
+	cancelQuery()
+	<-kuboDone
+
+	// Wait for all goroutines to finish
+	wg.Wait()
+
+	if len(kuboProvs) > 0 {
+		foundByKubo := make(map[string]struct{}, len(kuboProvs))
+		for _, p := range kuboProvs {
+			foundByKubo[p.ID.String()] = struct{}{}
+		}
+		foundByChecker := make(map[string]struct{}, len(out))
+		for i := range out {
+			_, out[i].FoundByKubo = foundByKubo[out[i].ID]
+			foundByChecker[out[i].ID] = struct{}{}
+		}
+
+		// Also check the providers only the Kubo node found
+		for _, p := range kuboProvs {
+			if _, ok := foundByChecker[p.ID.String()]; ok {
+				continue
+			}
+			foundByChecker[p.ID.String()] = struct{}{}
+			wg.Add(1)
+			go checkProvider(p, KuboSource)
+		}
+		wg.Wait()
+		for i := range out {
+			if out[i].Source == KuboSource {
+				out[i].FoundByKubo = true
+			}
+		}
+	}
+
+	<-clusterDone
+	if len(clusterPins) > 0 {
+		checked := make(map[string]struct{}, len(out))
+		for i := range out {
+			checked[out[i].ID] = struct{}{}
+		}
+
+		// Also check the peers the cluster says pinned the CID that were not found
+		for _, p := range pinnedProviders(clusterPins) {
+			if _, ok := checked[p.ID.String()]; ok {
+				continue
+			}
+			checked[p.ID.String()] = struct{}{}
+			wg.Add(1)
+			go checkProvider(p, ClusterSource)
+		}
+		wg.Wait()
+		setClusterPins(out, clusterPins)
+	}
+
+	cancelAdv()
+	advWg.Wait()
+	reconcileAdvertisements(ctx, opts.IPNIIndexer, out, inDHT, inIPNI)
+	if opts.RankBy != "" {
+		RankProviders(out, opts.RankBy)
+	}
+
+	return out, nil
+}
+
+// CheckProviders checks the connectivity and Bitswap availability of a CID
+// from the providers passed in the request, skipping content routing. This
+// allows verifying new providers before their records have propagated.
+func (ck *Checker) CheckProviders(ctx context.Context, cidKey cid.Cid, providers []peer.AddrInfo, opts Options) ([]ProviderOutput, error) {
+	out, err := ck.checkProviders(ctx, cidKey, providers, CallerSource, opts.withDefaults())
+	if err == nil && opts.RankBy != "" {
+		RankProviders(out, opts.RankBy)
+	}
+	return out, err
+}
+
+// checkProviders checks the providers concurrently, reporting src as their
+// source
+func (ck *Checker) checkProviders(ctx context.Context, cidKey cid.Cid, providers []peer.AddrInfo, src string, opts Options) ([]ProviderOutput, error) {
+	if ck.denylist.deniesCID(cidKey) {
+		return nil, ErrDeniedCID
+	}
+	out := make([]ProviderOutput, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider peer.AddrInfo) {
+			defer wg.Done()
+			out[i] = ck.checkProvider(ctx, provider, src, cidKey, opts)
+		}(i, provider)
+	}
+	wg.Wait()
+
+	return out, nil
+}
+
+// checkProvider checks the connectivity and Bitswap availability of a CID from
+// a provider, looking up its addresses in the DHT when none are known, except
+// for the providers passed by the caller. Failures to run the check are
+// reported in the ConnectionError of the provider.
+func (ck *Checker) checkProvider(ctx context.Context, provider peer.AddrInfo, src string, cidKey cid.Cid, opts Options) ProviderOutput {
+	dialTimeout := opts.ProviderDialTimeout
+	dialBackoff := clearDialBackoff(ck.h, provider.ID, provider.Addrs...)
+	checkStart := time.Now()
+	stageStart := checkStart
+	var timings TimingsOutput
+
+	outputAddrs := []string{}
+	var filteredAddrs []FilteredAddrOutput
+	if len(provider.Addrs) > 0 {
+		for _, addr := range provider.Addrs {
+			if ck.dialableAddr(addr) { // only return the addrs that can be dialed
+				outputAddrs = append(outputAddrs, addr.String())
+			}
+		}
+	} else if src != CallerSource {
+		// If no maddrs were returned from the FindProvider rpc call, try to get them from the DHT
+		peerAddrs, err := ck.timedRouting().FindPeer(ctx, provider.ID)
+		if err == nil {
+			for _, addr := range peerAddrs.Addrs {
+				if f := ck.addrPolicy.filter(addr); f != nil {
+					filteredAddrs = append(filteredAddrs, *f)
+					continue
+				}
+				// Add to both output and to provider addrs for the check
+				outputAddrs = append(outputAddrs, addr.String())
+				provider.Addrs = append(provider.Addrs, addr)
+			}
+		}
+	}
+	timings.Routing = since(&stageStart)
+	dnsResolutions := resolveDNSAddrs(ctx, ck.dnsResolver, provider.Addrs)
+	timings.AddrResolution = since(&stageStart)
+
+	provOutput := ProviderOutput{
+		ID:                       provider.ID.String(),
+		Addrs:                    outputAddrs,
+		DataAvailableOverBitswap: BitswapCheckOutput{},
+		Source:                   src,
+		DialBackoff:              dialBackoff,
+		AddrWarnings:             ck.analyzeAddrs(provider.ID, provider.Addrs),
+		FilteredAddrs:            filteredAddrs,
+		DNSResolutions:           dnsResolutions,
+		AddrLocations:            ck.geoIP.locateResolved(provider.Addrs, dnsResolutions),
+		CertHashChecks:           checkCertHashes(provider.Addrs, nil),
+		CID:                      inspectCID(cidKey),
+	}
+	provOutput.CID.Denylists = ck.lookupPublicDenylists(cidKey)
+
+	if ck.denylist.deniesPeer(provider.ID) {
+		provOutput.ConnectionError = ErrDeniedPeer.Error()
+		provOutput.Denied = true
+		timings.Total = time.Since(checkStart)
+		provOutput.Timings = timings
+		return provOutput
+	}
+	if len(provider.Addrs) == 0 && src == CallerSource {
+		provOutput.ConnectionError = errNoAddrsSupplied
+		timings.Total = time.Since(checkStart)
+		provOutput.Timings = timings
+		return provOutput
+	}
+	if len(provider.Addrs) > 0 {
+		var filtered []FilteredAddrOutput
+		provider.Addrs, filtered = ck.filterAddrs(provider.Addrs)
+		provOutput.FilteredAddrs = append(provOutput.FilteredAddrs, filtered...)
+	}
+	if len(provider.Addrs) == 0 && len(provOutput.FilteredAddrs) > 0 {
+		provOutput.ConnectionError = filteredAddrsError(provOutput.FilteredAddrs)
+		provOutput.Denied = provOutput.ConnectionError == errDeniedAddrs
+		timings.Total = time.Since(checkStart)
+		provOutput.Timings = timings
+		return provOutput
+	}
+
+	if opts.Transport != "" {
+		provider.Addrs = filterTransport(provider.Addrs, opts.Transport)
+		if len(provider.Addrs) == 0 {
+			provOutput.ConnectionError = fmt.Sprintf("the provider has no %s address", opts.Transport)
+			timings.Total = time.Since(checkStart)
+			provOutput.Timings = timings
+			return provOutput
+		}
+	}
+
+	// Dial the IPv4 and IPv6 addresses separately alongside the main connection
+	addrFamilies := make(chan *AddrFamiliesOutput, 1)
+	go func() {
+		addrFamilies <- ck.dialAddrFamilies(ctx, provider.ID, provider.Addrs, dialTimeout)
+	}()
+
+	testHost, err := ck.newTestHost()
+	if err != nil {
+		provOutput.ConnectionError = fmt.Sprintf("creating a test host: %s", err)
+		provOutput.ResourceLimited = isResourceLimited(err)
+		provOutput.AddrFamilies = <-addrFamilies
+		timings.Total = time.Since(checkStart)
+		provOutput.Timings = timings
+		return provOutput
+	}
+	defer testHost.Close()
+
+	// Test Is the target connectable
+	var connErr error
+	var dialStart time.Time
+	provOutput.DialAttempts, dialStart, connErr = connectBitswapWithRetries(ctx, testHost, provider, dialTimeout, &timings, opts)
+
+	if connErr != nil {
+		provOutput.ConnectionError = connErr.Error()
+		provOutput.ResourceLimited = isResourceLimited(connErr)
+		provOutput.PeerIDMismatch = peerIDMismatch(connErr)
+	} else {
+		// since we pass a libp2p host that's already connected to the peer the actual connection maddr we pass in doesn't matter
+		p2pAddr, _ := multiaddr.NewMultiaddr("/p2p/" + provider.ID.String())
+		stageStart = time.Now()
+		target := cidKey
+		if len(opts.Path) > 0 {
+			target, provOutput.PathResolution, _ = resolvePathOnHost(ctx, testHost, provider.ID, cidKey, opts.Path, opts.BitswapTimeout)
+		}
+		if target.Defined() {
+			provOutput.DataAvailableOverBitswap = checkBitswapCIDWithRetries(ctx, testHost, target, p2pAddr, opts)
+		} else {
+			provOutput.DataAvailableOverBitswap.Error = errPathResolution
+		}
+		provOutput.ResourceLimited = provOutput.DataAvailableOverBitswap.ResourceLimited
+		timings.Bitswap = since(&stageStart)
+
+		for _, c := range testHost.Network().ConnsToPeer(provider.ID) {
+			provOutput.ConnectionMaddrs = append(provOutput.ConnectionMaddrs, c.RemoteMultiaddr().String())
+		}
+		provOutput.Connections = connectionStates(testHost.Network().ConnsToPeer(provider.ID), dialStart)
+	}
+
+	provOutput.AddrFamilies = <-addrFamilies
+	timings.Total = time.Since(checkStart)
+	provOutput.Timings = timings
+	return provOutput
+}
+
+// PeerCheckOutput is the result of a peer check
+type PeerCheckOutput struct {
+	ConnectionError              string
+	PeerFoundInDHT               map[string]int
+	ProviderRecordFromPeerInDHT  bool
+	ProviderRecordFromPeerInIPNI bool
+	ConnectionMaddrs             []string
+	DataAvailableOverBitswap     BitswapCheckOutput
+	// Kubo is the view of the configured Kubo node, nil if none is configured
+	Kubo *KuboCheckOutput
+	// Cluster is the view of the configured IPFS Cluster, nil if none is
+	// configured
+	Cluster *ClusterCheckOutput
+	// AddrWarnings lists problems with the passed multiaddr and the peer's
+	// addresses in the DHT found before dialing
+	AddrWarnings []AddrWarning
+	// FilteredAddrs are the addresses of the peer that were not dialed, with
+	// the reason why
+	FilteredAddrs []FilteredAddrOutput
+	// AddrDialResults has the result of dialing each of the peer's addresses separately
+	AddrDialResults []AddrDialOutput
+	// RelayChecks has the result of each stage of connecting through every
+	// relay, only set when the peer is only reachable through relays
+	RelayChecks []RelayCheckOutput
+	// RelayReservations has the status of the reservation of the peer with
+	// each relay of its relay addresses
+	RelayReservations []RelayReservationOutput
+	// AutoNAT is the result of asking the peer to dial ipfs-check back, which
+	// tests the outbound connectivity of the peer rather than its inbound
+	// reachability, nil unless requested or if the peer could not be
+	// connected to
+	AutoNAT *AutoNATCheckOutput
+	// DNSResolutions has the result of resolving the DNS addresses of the peer
+	DNSResolutions []DNSResolutionOutput
+	// AddrLocations has the country and autonomous system of the addresses
+	// of the peer, nil unless GeoIP databases are configured
+	AddrLocations []AddrLocation
+	// AddrFamilies has the results of dialing the IPv4 and IPv6 addresses of
+	// the peer separately, nil unless the peer is dual-stack
+	AddrFamilies *AddrFamiliesOutput
+	// PathResolution is the result of resolving Options.Path with the blocks
+	// of the peer, nil without a path or if the peer could not be connected to
+	PathResolution *PathResolutionOutput
+	// AddrSets compares the addresses of the peer in the DHT, announced over
+	// Identify and that worked
+	AddrSets *PeerAddrSetsOutput
+	// Advertisements reconciles ProviderRecordFromPeerInDHT and
+	// ProviderRecordFromPeerInIPNI with when the peer last advertised to IPNI
+	Advertisements *AdvertisementsOutput
+	// CachedAt is when the result was computed if it was served from a cache,
+	// nil for fresh results
+	CachedAt *time.Time
+	// DialBackoff is whether the host of the checker had a failed dial of the
+	// peer in backoff, which was cleared so that the peer was dialed again
+	DialBackoff bool
+	// DialAttempts are the attempts of connecting to the peer, more than one
+	// when the connection failed and was retried
+	DialAttempts []AttemptOutput
+	// ResourceLimited is whether the connection or the Bitswap check failed
+	// because the resource manager of the checker refused a connection or
+	// stream. The failure then says nothing about the peer.
+	ResourceLimited bool
+	// PeerIDMismatch is set when the connection failed because the addresses
+	// are served by another peer, e.g. because of a stale DNS record or a
+	// reused IP address
+	PeerIDMismatch *PeerIDMismatchOutput
+	// CertHashChecks validates the certificate hashes of the WebTransport and
+	// WebRTC Direct addresses of the peer, using the results of dialing them
+	CertHashChecks []CertHashCheckOutput
+	// Connections has the protocols negotiated on each of ConnectionMaddrs
+	Connections []ConnectionStateOutput
+	// BitswapPaths has the result of asking the peer for the CID over each
+	// of ConnectionMaddrs, nil unless there are several, e.g. a relayed and
+	// a direct connection after hole punching
+	BitswapPaths []BitswapPathOutput
+	// BitswapVersions has the result of asking the peer for the CID over each
+	// Bitswap protocol version, nil unless Options.BitswapVersions is set or
+	// if the peer could not be connected to
+	BitswapVersions *BitswapVersionsOutput
+	// DAG has the result of downloading the DAG rooted at the CID from the
+	// peer, nil unless Options.DAGMaxBlocks is set and the peer has the CID
+	DAG *DAGCheckOutput
+	// Throughput has the speed at which the peer served the DAG rooted at the
+	// CID, nil unless Options.ThroughputMiB is set and the peer has the CID
+	Throughput *ThroughputOutput
+	// Timings has the duration of each stage of the check
+	Timings TimingsOutput
+	// Stages tells which stages of the check ran and which failed
+	Stages StagesOutput
+	// Pipeline has a step for each stage of PipelineStages and each probe
+	// registered with RegisterProbe, in the order they ran
+	Pipeline []PipelineStepOutput
+	// DHTServer is the result of querying the peer as a DHT server, nil if
+	// the peer could not be connected to
+	DHTServer *DHTServerCheckOutput
+	// RecordPropagation tells how many of the DHT servers closest to the CID
+	// hold a provider record of the peer, nil unless Options.DeepCheck is set
+	RecordPropagation *RecordPropagationOutput
+	// CID describes the checked CID
+	CID CIDInfoOutput
+	// Protocols tells which of a set of protocols the peer supports, nil if
+	// the peer could not be connected to
+	Protocols []ProtocolSupportOutput
+	// CheckerInfo is the vantage point of the checker that ran the check
+	CheckerInfo *CheckerInfoOutput
+}
+
+// Available returns whether the peer could be connected to and has the block
+func (o *PeerCheckOutput) Available() bool {
+	return o.ConnectionError == "" && o.DataAvailableOverBitswap.Found
+}
+
+// CheckPeer checks the connectivity and Bitswap availability of a CID from a
+// given peer, either with just a /p2p/<peer-id> multiaddr or a specific one.
+// The check runs the stages of PipelineStages in order, with the probes
+// registered with RegisterProbe.
+func (ck *Checker) CheckPeer(ctx context.Context, ma multiaddr.Multiaddr, c cid.Cid, opts Options) (*PeerCheckOutput, error) {
+	opts = opts.withDefaults()
+	ai, err := peer.AddrInfoFromP2pAddr(ma)
+	if err != nil {
+		return nil, err
+	}
+	if err := ck.Denied(c, ma); err != nil {
+		return nil, err
+	}
+
+	// The peer may be a DHT server the host failed to dial before, e.g. while
+	// crawling the DHT, and that just came online
+	dialBackoff := clearDialBackoff(ck.h, ai.ID, ai.Addrs...)
+	checkStart := time.Now()
+	stages := newStageTracker(ctx, opts)
+	pc := &peerCheck{
+		ck:         ck,
+		ma:         ma,
+		ai:         ai,
+		c:          c,
+		opts:       opts,
+		stageStart: checkStart,
+		out:        &PeerCheckOutput{CID: inspectCID(c), CheckerInfo: ck.CheckerInfo(), DialBackoff: dialBackoff},
+		target:     &ProbeTarget{Peer: ai.ID, Addrs: ai.Addrs, CID: c, Options: opts},
+	}
+	defer pc.close()
+
+	out := pc.out
+	out.Pipeline, err = ck.runPipeline(stages, pc.target, []pipelineStage{
+		{PipelineRouting, pc.routing},
+		{PipelineAddressFilter, pc.filterAddrs},
+		{PipelineDial, pc.dial},
+		{PipelineRetrieval, pc.retrieve},
+		{PipelineProtocolProbe, pc.probeProtocols},
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Stages.Exhausted = stages.end()
+	out.Timings.Total = time.Since(checkStart)
+	return out, nil
+}
+
+// peerCheck is the state of a peer check passed along the stages of its
+// pipeline
+type peerCheck struct {
+	ck   *Checker
+	ma   multiaddr.Multiaddr
+	ai   *peer.AddrInfo
+	c    cid.Cid
+	opts Options
+	out  *PeerCheckOutput
+	// target is what the registered probes run against
+	target *ProbeTarget
+	// stageStart is when the current part of the timings started
+	stageStart time.Time
+	// dialStart is when the attempt that connected the test host started
+	dialStart time.Time
+
+	// addrMap has the addresses of the peer found in the DHT, and
+	// peerAddrDHTErr why they could not be looked up
+	addrMap        map[string]int
+	peerAddrDHTErr error
+	testHost       host.Host
+	idSub          event.Subscription
+}
+
+func (pc *peerCheck) close() {
+	if pc.idSub != nil {
+		pc.idSub.Close()
+	}
+	if pc.testHost != nil {
+		pc.testHost.Close()
+	}
+}
+
+// routing looks up the peer and its provider records
+func (pc *peerCheck) routing(ctx context.Context) (StageOutput, bool, error) {
+	ck, c, ai, opts, out := pc.ck, pc.c, pc.ai, pc.opts, pc.out
+	routing := ck.timedRouting()
+	pc.addrMap, pc.peerAddrDHTErr = peerAddrsInDHT(ctx, routing, ck.dhtMessenger, ai.ID)
+
+	var inDHT, inIPNI bool
+	var ipniLastAd *time.Time
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		inDHT = providerRecordFromPeerInDHT(ctx, routing, c, ai.ID)
+		wg.Done()
+	}()
+	go func() {
+		inIPNI = providerRecordFromPeerInIPNI(ctx, opts.IPNIIndexer, c, ai.ID)
+		wg.Done()
+	}()
+	go func() {
+		ipniLastAd, _ = ipniLastAdvertisement(ctx, opts.IPNIIndexer, ai.ID)
+		wg.Done()
+	}()
+	if kuboRPC := opts.KuboRPC; kuboRPC != "" {
+		wg.Add(1)
+		go func() {
+			out.Kubo = newKuboClient(kuboRPC).checkPeer(ctx, c, ai.ID)
+			wg.Done()
+		}()
+	}
+	if clusterAPI := opts.ClusterAPI; clusterAPI != "" {
+		wg.Add(1)
+		go func() {
+			out.Cluster = newClusterClient(clusterAPI).checkPeer(ctx, c, ai.ID)
+			wg.Done()
+		}()
+	}
+	if opts.DeepCheck {
+		wg.Add(1)
+		go func() {
+			out.RecordPropagation = checkRecordPropagation(ctx, routing, ck.dhtMessenger, c, ai.ID)
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	out.Timings.Routing = since(&pc.stageStart)
+	out.Stages.Routing = stageOK()
+	out.ProviderRecordFromPeerInDHT = inDHT
+	out.ProviderRecordFromPeerInIPNI = inIPNI
+	out.PeerFoundInDHT = pc.addrMap
+	out.Advertisements = &AdvertisementsOutput{
+		DHT:                   inDHT,
+		IPNI:                  inIPNI,
+		IPNILastAdvertisement: ipniLastAd,
+	}
+	out.CID.Denylists = ck.lookupPublicDenylists(c)
+	if pc.peerAddrDHTErr != nil {
+		// The passed addresses, if any, are still checked
+		out.Stages.Routing = stageFailed(pc.peerAddrDHTErr.Error())
+	}
+	return out.Stages.Routing, false, nil
+}
+
+// filterAddrs analyzes the addresses of the peer, and keeps the ones to dial
+func (pc *peerCheck) filterAddrs(ctx context.Context) (StageOutput, bool, error) {
+	ck, ai, opts, out := pc.ck, pc.ai, pc.opts, pc.out
+	warnAddrs := make([]multiaddr.Multiaddr, 0, len(pc.addrMap)+1)
+	if len(ai.Addrs) > 0 {
+		warnAddrs = append(warnAddrs, pc.ma)
+	}
+	for a := range pc.addrMap {
+		if dhtAddr, err := multiaddr.NewMultiaddr(a); err == nil {
+			warnAddrs = append(warnAddrs, dhtAddr)
+		}
+	}
+	out.AddrWarnings = ck.analyzeAddrs(ai.ID, warnAddrs)
+	out.DNSResolutions = resolveDNSAddrs(ctx, ck.dnsResolver, warnAddrs)
+	out.AddrLocations = ck.geoIP.locateResolved(warnAddrs, out.DNSResolutions)
+	out.Timings.AddrResolution = since(&pc.stageStart)
+
+	// If peerID given,but no addresses check the DHT
+	if len(ai.Addrs) == 0 {
+		if pc.peerAddrDHTErr != nil {
+			// PeerID is not resolvable via the DHT
+			out.ConnectionError = pc.peerAddrDHTErr.Error()
+			return pc.stop(stageSkipped("the addresses of the peer could not be looked up in the DHT"))
+		}
+		for a := range pc.addrMap {
+			ma, err := multiaddr.NewMultiaddr(a)
+			if err != nil {
+				log.Println(fmt.Errorf("error parsing multiaddr %s: %w", a, err))
+				continue
+			}
+			ai.Addrs = append(ai.Addrs, ma)
+		}
+	}
+
+	if len(ai.Addrs) > 0 {
+		// The addresses found in the DHT can be denied
+		ai.Addrs, out.FilteredAddrs = ck.filterAddrs(ai.Addrs)
+		if len(ai.Addrs) == 0 {
+			out.ConnectionError = filteredAddrsError(out.FilteredAddrs)
+			return pc.stop(stageSkipped(out.ConnectionError))
+		}
+	}
+
+	if opts.Transport != "" {
+		ai.Addrs = filterTransport(ai.Addrs, opts.Transport)
+		if len(ai.Addrs) == 0 {
+			out.ConnectionError = fmt.Sprintf("the peer has no %s address", opts.Transport)
+			return pc.stop(stageSkipped(out.ConnectionError))
+		}
+	}
+	pc.target.Addrs = ai.Addrs
+	return stageOK(), false, nil
+}
+
+// stop stops the check before the peer could be dialed, with the status of
+// the Dial stage
+func (pc *peerCheck) stop(dial StageOutput) (StageOutput, bool, error) {
+	pc.out.Stages.Dial = dial
+	pc.out.Stages.Bitswap = stageSkipped(errNotConnected)
+	pc.out.AddrSets = comparePeerAddrs(pc.addrMap, nil, nil, nil)
+	return stageFailed(pc.out.ConnectionError), true, nil
+}
+
+// dial dials each address of the peer, and connects to it with the working
+// ones
+func (pc *peerCheck) dial(ctx context.Context) (StageOutput, bool, error) {
+	ck, ai, opts, out := pc.ck, pc.ai, pc.opts, pc.out
+	var err error
+	if pc.testHost, err = ck.newTestHost(); err != nil {
+		return StageOutput{}, true, fmt.Errorf("server error: %w", err)
+	}
+	if pc.idSub, err = pc.testHost.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted)); err != nil {
+		return StageOutput{}, true, fmt.Errorf("server error: %w", err)
+	}
+	pc.target.Host = pc.testHost
+
+	if len(ai.Addrs) > 0 {
+		pc.stageStart = time.Now()
+		out.AddrDialResults = ck.dialAddrs(ctx, ai.ID, ai.Addrs, opts.AddrDialTimeout)
+		out.AddrFamilies = summarizeAddrFamilies(out.AddrDialResults)
+		out.CertHashChecks = checkCertHashes(ai.Addrs, out.AddrDialResults)
+
+		relayOnly := true
+		for _, addr := range ai.Addrs {
+			relayOnly = relayOnly && isRelayAddr(addr)
+		}
+		if relayOnly {
+			out.RelayChecks = ck.checkRelays(ctx, ai.ID, ai.Addrs, opts.PeerDialTimeout)
+		}
+		out.RelayReservations = ck.checkRelayReservations(ctx, ai.ID, ai.Addrs, opts.AddrDialTimeout)
+
+		// Only use the addresses that work for the connection used by the Bitswap check
+		var working []multiaddr.Multiaddr
+		for i, r := range out.AddrDialResults {
+			if r.Error == "" {
+				working = append(working, ai.Addrs[i])
+			}
+		}
+		if len(working) > 0 {
+			ai.Addrs = working
+		}
+		pc.target.Addrs = ai.Addrs
+		out.Timings.Dial = since(&pc.stageStart)
+	}
+
+	// Test Is the target connectable
+	var connErr error
+	out.DialAttempts, pc.dialStart, connErr = connectBitswapWithRetries(ctx, pc.testHost, *ai, opts.PeerDialTimeout, &out.Timings, opts)
+	if connErr != nil {
+		out.ConnectionError = connErr.Error()
+		out.ResourceLimited = isResourceLimited(connErr)
+		out.PeerIDMismatch = peerIDMismatch(connErr)
+		out.Stages.Dial = stageFailed(out.ConnectionError)
+		out.Stages.Bitswap = stageSkipped(errNotConnected)
+		out.AddrSets = comparePeerAddrs(pc.addrMap, nil, out.AddrDialResults, nil)
+		return out.Stages.Dial, true, nil
+	}
+	out.Stages.Dial = stageOK()
+	pc.target.Connected = true
+
+	if opts.AutoNAT {
+		out.AutoNAT = checkAutoNAT(ctx, pc.testHost, ai.ID)
+	}
+	return out.Stages.Dial, false, nil
+}
+
+// retrieve asks the peer for the block, resolving the path with its blocks
+// first, and for the DAG when requested
+func (pc *peerCheck) retrieve(ctx context.Context) (StageOutput, bool, error) {
+	ai, opts, out, testHost := pc.ai, pc.opts, pc.out, pc.testHost
+	pc.stageStart = time.Now()
+	target := pc.c
+	if len(opts.Path) > 0 {
+		target, out.PathResolution, _ = resolvePathOnHost(ctx, testHost, ai.ID, pc.c, opts.Path, opts.BitswapTimeout)
+	}
+
+	// If so is the data available over Bitswap?
+	if target.Defined() {
+		out.DataAvailableOverBitswap = checkBitswapCIDWithRetries(ctx, testHost, target, pc.ma, opts)
+		out.ResourceLimited = out.DataAvailableOverBitswap.ResourceLimited
+	} else {
+		out.DataAvailableOverBitswap.Error = errPathResolution
+	}
+	out.Timings.Bitswap = since(&pc.stageStart)
+	if out.DataAvailableOverBitswap.Error != "" {
+		out.Stages.Bitswap = stageFailed(out.DataAvailableOverBitswap.Error)
+	} else {
+		out.Stages.Bitswap = stageOK()
+	}
+
+	// Get all connection maddrs to the peer (in case we hole punched, there will usually be two: limited relay and direct)
+	for _, c := range testHost.Network().ConnsToPeer(ai.ID) {
+		out.ConnectionMaddrs = append(out.ConnectionMaddrs, c.RemoteMultiaddr().String())
+	}
+	out.Connections = connectionStates(testHost.Network().ConnsToPeer(ai.ID), pc.dialStart)
+	if target.Defined() && opts.DAGMaxBlocks > 0 && out.DataAvailableOverBitswap.Found {
+		out.DAG = checkDAG(ctx, testHost, ai.ID, target, opts.DAGMaxBlocks, opts.BitswapTimeout)
+	}
+	if target.Defined() && opts.ThroughputMiB > 0 && out.DataAvailableOverBitswap.Found {
+		out.Throughput = measureThroughput(ctx, testHost, ai.ID, target, int64(opts.ThroughputMiB)<<20, opts.BitswapTimeout)
+	}
+	if target.Defined() {
+		out.BitswapPaths = probeBitswapPaths(ctx, testHost, ai.ID, target, opts.BitswapTimeout)
+		if opts.BitswapVersions {
+			out.BitswapVersions = probeBitswapVersions(ctx, testHost, ai.ID, target, opts.BitswapTimeout)
+		}
+	}
+	return out.Stages.Bitswap, false, nil
+}
+
+// probeProtocols probes the DHT server and the other protocols of the peer,
+// and compares its addresses once Identify completed
+func (pc *peerCheck) probeProtocols(ctx context.Context) (StageOutput, bool, error) {
+	ck, ai, out := pc.ck, pc.ai, pc.out
+	announced := waitForIdentify(ctx, pc.idSub, ai.ID)
+	out.DHTServer = ck.checkDHTServer(ctx, pc.testHost, ai.ID, pc.c)
+	out.Protocols = ck.checkProtocols(ctx, pc.testHost, ai.ID)
+	out.AddrSets = comparePeerAddrs(pc.addrMap, announced, out.AddrDialResults, out.ConnectionMaddrs)
+	return stageOK(), false, nil
+}
+
+func peerAddrsInDHT(ctx context.Context, d DHT, messenger *dhtpb.ProtocolMessenger, p peer.ID) (map[string]int, error) {
+	closestPeers, err := d.GetClosestPeers(ctx, string(p))
+	if err != nil {
+		return nil, err
+	}
+
+	resCh := make(chan *peer.AddrInfo, len(closestPeers))
+
+	numSuccessfulResponses := execOnMany(ctx, 0.3, time.Second*3, func(ctx context.Context, peerToQuery peer.ID) error {
+		endResults, err := messenger.GetClosestPeers(ctx, peerToQuery, p)
+		if err == nil {
+			for _, r := range endResults {
+				if r.ID == p {
+					resCh <- r
+					return nil
+				}
+			}
+			resCh <- nil
+		}
+		return err
+	}, closestPeers, false)
+	close(resCh)
+
+	if numSuccessfulResponses == 0 {
+		return nil, fmt.Errorf("host had trouble querying the DHT")
+	}
+
+	addrMap := make(map[string]int)
+	for r := range resCh {
+		if r == nil {
+			continue
+		}
+		for _, addr := range r.Addrs {
+			addrMap[addr.String()]++
+		}
+	}
+
+	return addrMap, nil
+}
+
+func providerRecordFromPeerInDHT(ctx context.Context, d DHT, c cid.Cid, p peer.ID) bool {
+	queryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	provsCh := d.FindProvidersAsync(queryCtx, c, 0)
+	for {
+		select {
+		case prov, ok := <-provsCh:
+			if !ok {
+				return false
+			}
+			if prov.ID == p {
+				return true
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func providerRecordFromPeerInIPNI(ctx context.Context, ipniURL string, c cid.Cid, p peer.ID) bool {
+	crClient, err := client.New(ipniURL, client.WithStreamResultsRequired())
+	if err != nil {
+		log.Printf("failed to creat content router client: %s\n", err)
+		return false
+	}
+	routerClient := contentrouter.NewContentRoutingClient(crClient)
+
+	queryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	provsCh := routerClient.FindProvidersAsync(queryCtx, c, 0)
+	for {
+		select {
+		case prov, ok := <-provsCh:
+			if !ok {
+				return false
+			}
+			if prov.ID == p {
+				return true
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Taken from the FullRT DHT client implementation
+//
+// execOnMany executes the given function on each of the peers, although it may only wait for a certain chunk of peers
+// to respond before considering the results "good enough" and returning.
+//
+// If sloppyExit is true then this function will return without waiting for all of its internal goroutines to close.
+// If sloppyExit is true then the passed in function MUST be able to safely complete an arbitrary amount of time after
+// execOnMany has returned (e.g. do not write to resources that might get closed or set to nil and therefore result in
+// a panic instead of just returning an error).
+func execOnMany(ctx context.Context, waitFrac float64, timeoutPerOp time.Duration, fn func(context.Context, peer.ID) error, peers []peer.ID, sloppyExit bool) int {
+	if len(peers) == 0 {
+		return 0
+	}
+
+	// having a buffer that can take all of the elements is basically a hack to allow for sloppy exits that clean up
+	// the goroutines after the function is done rather than before
+	errCh := make(chan error, len(peers))
+	numSuccessfulToWaitFor := int(float64(len(peers)) * waitFrac)
+
+	putctx, cancel := context.WithTimeout(ctx, timeoutPerOp)
+	defer cancel()
+
+	for _, p := range peers {
+		go func(p peer.ID) {
+			errCh <- fn(putctx, p)
+		}(p)
+	}
+
+	var numDone, numSuccess, successSinceLastTick int
+	var ticker *time.Ticker
+	var tickChan <-chan time.Time
+
+	for numDone < len(peers) {
+		select {
+		case err := <-errCh:
+			numDone++
+			if err == nil {
+				numSuccess++
+				if numSuccess >= numSuccessfulToWaitFor && ticker == nil {
+					// Once there are enough successes, wait a little longer
+					ticker = time.NewTicker(time.Millisecond * 500)
+					defer ticker.Stop()
+					tickChan = ticker.C
+					successSinceLastTick = numSuccess
+				}
+				// This is equivalent to numSuccess * 2 + numFailures >= len(peers) and is a heuristic that seems to be
+				// performing reasonably.
+				// TODO: Make this metric more configurable
+				// TODO: Have better heuristics in this function whether determined from observing static network
+				// properties or dynamically calculating them
+				if numSuccess+numDone >= len(peers) {
+					cancel()
+					if sloppyExit {
+						return numSuccess
+					}
+				}
+			}
+		case <-tickChan:
+			if numSuccess > successSinceLastTick {
+				// If there were additional successes, then wait another tick
+				successSinceLastTick = numSuccess
+			} else {
+				cancel()
+				if sloppyExit {
+					return numSuccess
+				}
+			}
+		}
+	}
+	return numSuccess
+}
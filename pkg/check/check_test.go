@@ -0,0 +1,73 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPeerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+	d, err := dht.New(ctx, h, dht.Mode(dht.ModeClient), dht.BootstrapPeers())
+	require.NoError(t, err)
+	defer d.Close()
+	ck, err := New(ctx, Config{
+		Host: h,
+		DHT:  d,
+		NewTestHost: func() (host.Host, error) {
+			return libp2p.New(libp2p.NoListenAddrs)
+		},
+	})
+	require.NoError(t, err)
+
+	// A peer that accepts connections but never completes a handshake
+	l, err := manet.Listen(multiaddr.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+	ma := l.Multiaddr().Encapsulate(multiaddr.StringCast("/p2p/" + p.String()))
+
+	mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	opts := Options{PeerDialTimeout: time.Minute, AddrDialTimeout: time.Minute, BitswapTimeout: time.Minute}
+
+	checkCtx, cancelCheck := context.WithCancel(ctx)
+	time.AfterFunc(200*time.Millisecond, cancelCheck)
+	start := time.Now()
+	out, err := ck.CheckPeer(checkCtx, ma, cid.NewCidV1(cid.Raw, mh), opts)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 10*time.Second, "the dials are aborted with the check")
+	require.NotEmpty(t, out.ConnectionError)
+}
+
+func TestNewEphemeral(t *testing.T) {
+	_, err := New(context.Background(), Config{Ephemeral: true, AcceleratedDHT: true})
+	require.Error(t, err)
+	_, err = New(context.Background(), Config{Ephemeral: true, DatastorePath: t.TempDir()})
+	require.Error(t, err)
+}
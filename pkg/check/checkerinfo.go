@@ -0,0 +1,41 @@
+package check
+
+import (
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// CheckerInfoOutput describes the vantage point of the checker: the public
+// addresses other peers see it on and the networks they are in. Results from
+// checkers with different vantage points, e.g. federated instances, can
+// differ for the same peer.
+type CheckerInfoOutput struct {
+	PeerID string
+	// Addrs are the public addresses of the checker, including the ones
+	// observed by the peers it is connected to and mapped by NAT
+	Addrs []string
+	// Locations has the country and autonomous system of Addrs, nil unless
+	// GeoIP databases are configured
+	Locations []AddrLocation
+	// AddrFamily is the only IP family the checker uses, see
+	// Config.AddrFamily, empty when it uses both
+	AddrFamily string
+}
+
+// CheckerInfo returns the vantage point of the checker
+func (ck *Checker) CheckerInfo() *CheckerInfoOutput {
+	out := &CheckerInfoOutput{
+		PeerID:     ck.h.ID().String(),
+		Addrs:      []string{},
+		AddrFamily: ck.addrFamily,
+	}
+	var public []multiaddr.Multiaddr
+	for _, a := range ck.h.Addrs() {
+		if manet.IsPublicAddr(a) {
+			public = append(public, a)
+			out.Addrs = append(out.Addrs, a.String())
+		}
+	}
+	out.Locations = ck.geoIP.locate(public)
+	return out
+}
@@ -0,0 +1,31 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckerInfo(t *testing.T) {
+	public := multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001")
+	h, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.AddrsFactory(func(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+			return append(addrs, public)
+		}),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+
+	ck := &Checker{h: h, addrFamily: AddrFamilyIPv4}
+	out := ck.CheckerInfo()
+	require.Equal(t, h.ID().String(), out.PeerID)
+	require.Equal(t, []string{public.String()}, out.Addrs, "only public addresses are reported")
+	require.Nil(t, out.Locations)
+	require.Equal(t, AddrFamilyIPv4, out.AddrFamily)
+
+	ck.geoIP = &GeoIP{asn: fakeLookup{"1.2.3.4": {"autonomous_system_number": uint(64500), "autonomous_system_organization": "Example Cloud"}}}
+	require.Equal(t, []AddrLocation{{Addr: public.String(), ASN: 64500, ASOrg: "Example Cloud"}}, ck.CheckerInfo().Locations)
+}
@@ -0,0 +1,61 @@
+package check
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+)
+
+// CIDInfoOutput describes the checked CID, so that unusual CIDs can be told
+// apart from unavailable ones
+type CIDInfoOutput struct {
+	// Version is the CID version, 0 or 1
+	Version uint64
+	// Codec is the name of the codec of the data, e.g. dag-pb or raw
+	Codec string
+	// Multihash is the name of the hash function of the data, e.g. sha2-256
+	Multihash string
+	// CIDv1 is the normalized form of the CID: the CIDv1 in base32, which
+	// CIDv0 CIDs are converted to by gateways and most tools
+	CIDv1 string
+	// Multibase is the name of the multibase the CID was passed in, only set
+	// by the ipfs-check server
+	Multibase string
+	// Warnings lists the properties of the CID that may affect the check
+	Warnings []string
+	// Denylists tells whether the CID is in each of the public denylists
+	// configured on the ipfs-check server, e.g. badbits. Gateways using a
+	// denylist refuse to serve the CIDs in it even if they are retrievable.
+	Denylists []DenylistOutput
+}
+
+// inspectCID describes c and warns about the codecs and hash functions the
+// check can not fully handle
+func inspectCID(c cid.Cid) CIDInfoOutput {
+	prefix := c.Prefix()
+	out := CIDInfoOutput{
+		Version:   prefix.Version,
+		Codec:     multicodec.Code(prefix.Codec).String(),
+		Multihash: multicodec.Code(prefix.MhType).String(),
+		CIDv1:     cid.NewCidV1(prefix.Codec, c.Hash()).String(),
+	}
+
+	if IsPieceCID(c) {
+		out.Warnings = append(out.Warnings, "the CID is a Filecoin commitment, not the CID of IPFS data, and can not be retrieved over Bitswap")
+	} else if codec := multicodec.Code(prefix.Codec); !slices.Contains(multicodec.KnownCodes(), codec) {
+		out.Warnings = append(out.Warnings, fmt.Sprintf("unknown codec 0x%x, the CID may be malformed", prefix.Codec))
+	} else if codec.Tag() != "ipld" {
+		out.Warnings = append(out.Warnings, fmt.Sprintf("%s is not an IPLD codec, the CID may be malformed", codec))
+	}
+
+	switch _, err := multihash.GetHasher(prefix.MhType); {
+	case prefix.MhType == multihash.IDENTITY:
+		out.Warnings = append(out.Warnings, "the data is inlined in identity CIDs, which never need to be retrieved from peers")
+	case err != nil:
+		out.Warnings = append(out.Warnings, fmt.Sprintf("ipfs-check can not verify blocks hashed with %s", out.Multihash))
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectCID(t *testing.T) {
+	v0 := cid.MustParse("QmcRD4wkPPi6dig81r5sLj9Zm1gDCL4zgpEj9CfuRrGbzF")
+	out := inspectCID(v0)
+	require.EqualValues(t, 0, out.Version)
+	require.Equal(t, "dag-pb", out.Codec)
+	require.Equal(t, "sha2-256", out.Multihash)
+	require.Equal(t, cid.NewCidV1(cid.DagProtobuf, v0.Hash()).String(), out.CIDv1)
+	require.Empty(t, out.Warnings)
+
+	mh, err := multihash.Sum([]byte(t.Name()), multihash.BLAKE3, -1)
+	require.NoError(t, err)
+	out = inspectCID(cid.NewCidV1(cid.Raw, mh))
+	require.Equal(t, "blake3", out.Multihash)
+	require.Empty(t, out.Warnings, "blake3 blocks can be verified")
+
+	out = inspectCID(cid.MustParse("bafkqaaa"))
+	require.Equal(t, "identity", out.Multihash)
+	require.Len(t, out.Warnings, 1)
+	require.Contains(t, out.Warnings[0], "identity")
+
+	// Neither an IPLD codec nor a hash function ipfs-check can verify
+	unknownMh, err := multihash.Encode(make([]byte, 32), 0xb401)
+	require.NoError(t, err)
+	out = inspectCID(cid.NewCidV1(multihash.SHA2_256, unknownMh))
+	require.Len(t, out.Warnings, 2)
+	require.Contains(t, out.Warnings[0], "not an IPLD codec")
+	require.Contains(t, out.Warnings[1], "can not verify")
+}
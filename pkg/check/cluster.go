@@ -0,0 +1,167 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// ClusterSource is the source of the providers only the IPFS Cluster says
+// they pinned the CID
+const ClusterSource = "IPFS Cluster"
+
+// clusterClient queries the REST API of an IPFS Cluster for the status of
+// the pins on its peers, so it can be compared with what the checked peers
+// actually serve
+type clusterClient struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+func newClusterClient(endpoint string) *clusterClient {
+	return &clusterClient{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: http.DefaultClient,
+	}
+}
+
+// ClusterPinStatus is the status of the pin of the CID on a cluster peer
+type ClusterPinStatus struct {
+	// ClusterPeer is the ID of the cluster peer and PeerName its name
+	ClusterPeer string
+	PeerName    string
+	// IPFSPeer is the peer ID of the IPFS daemon of the cluster peer
+	IPFSPeer string
+	// Status is the status of the pin, e.g. pinned, pinning, pin_error,
+	// remote or unpinned
+	Status string
+	Error  string
+}
+
+// ClusterCheckOutput is the view of the configured IPFS Cluster in a peer check
+type ClusterCheckOutput struct {
+	// Endpoint is the IPFS Cluster REST API endpoint that was queried
+	Endpoint string
+	// PeerStatus is the status of the pin on the checked peer, empty if the
+	// peer is not the IPFS daemon of a cluster peer
+	PeerStatus string
+	// Pins has the status of the pin on every cluster peer
+	Pins  []ClusterPinStatus
+	Error string
+}
+
+// clusterPin is the status of a pin on a cluster peer, with the addresses of
+// its IPFS daemon to check it
+type clusterPin struct {
+	ClusterPinStatus
+	addrs []multiaddr.Multiaddr
+}
+
+// pinStatus returns the status of the pin of c on every peer of the cluster
+// (GET /pins/{cid}), sorted by cluster peer
+func (cc *clusterClient) pinStatus(ctx context.Context, c cid.Cid) ([]clusterPin, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/pins/%s", cc.endpoint, c), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cc.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("ipfs-cluster: unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var info struct {
+		PeerMap map[string]struct {
+			PeerName          string   `json:"peername"`
+			IPFSPeerID        string   `json:"ipfs_peer_id"`
+			IPFSPeerAddresses []string `json:"ipfs_peer_addresses"`
+			Status            string   `json:"status"`
+			Error             string   `json:"error"`
+		} `json:"peer_map"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("ipfs-cluster: %w", err)
+	}
+	pins := make([]clusterPin, 0, len(info.PeerMap))
+	for clusterPeer, s := range info.PeerMap {
+		pin := clusterPin{ClusterPinStatus: ClusterPinStatus{
+			ClusterPeer: clusterPeer,
+			PeerName:    s.PeerName,
+			IPFSPeer:    s.IPFSPeerID,
+			Status:      s.Status,
+			Error:       s.Error,
+		}}
+		for _, a := range s.IPFSPeerAddresses {
+			if ma, err := multiaddr.NewMultiaddr(a); err == nil {
+				// The addresses end with the peer ID of the IPFS daemon
+				if transport, _ := peer.SplitAddr(ma); transport != nil {
+					pin.addrs = append(pin.addrs, transport)
+				}
+			}
+		}
+		pins = append(pins, pin)
+	}
+	slices.SortFunc(pins, func(a, b clusterPin) int { return strings.Compare(a.ClusterPeer, b.ClusterPeer) })
+	return pins, nil
+}
+
+// checkPeer returns the cluster's view of the pin of c, on p and on every
+// cluster peer
+func (cc *clusterClient) checkPeer(ctx context.Context, c cid.Cid, p peer.ID) *ClusterCheckOutput {
+	out := &ClusterCheckOutput{Endpoint: cc.endpoint, Pins: []ClusterPinStatus{}}
+	pins, err := cc.pinStatus(ctx, c)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	for _, pin := range pins {
+		out.Pins = append(out.Pins, pin.ClusterPinStatus)
+		if pin.IPFSPeer == p.String() {
+			out.PeerStatus = pin.Status
+		}
+	}
+	return out
+}
+
+// pinnedProviders returns the IPFS daemons of the cluster peers on which the
+// cluster says c is pinned, with the addresses they announce
+func pinnedProviders(pins []clusterPin) []peer.AddrInfo {
+	var provs []peer.AddrInfo
+	for _, pin := range pins {
+		if pin.Status != "pinned" {
+			continue
+		}
+		p, err := peer.Decode(pin.IPFSPeer)
+		if err != nil {
+			continue
+		}
+		provs = append(provs, peer.AddrInfo{ID: p, Addrs: pin.addrs})
+	}
+	return provs
+}
+
+// setClusterPins sets the Cluster status of the providers that are the IPFS
+// daemon of a cluster peer
+func setClusterPins(out []ProviderOutput, pins []clusterPin) {
+	byPeer := make(map[string]ClusterPinStatus, len(pins))
+	for _, pin := range pins {
+		byPeer[pin.IPFSPeer] = pin.ClusterPinStatus
+	}
+	for i := range out {
+		if status, ok := byPeer[out[i].ID]; ok {
+			out[i].Cluster = &status
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterClient(t *testing.T) {
+	mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	testCid := cid.NewCidV1(cid.Raw, mh)
+
+	pinned, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+	failed, err := peer.Decode("12D3KooWRTUNZVyVf7KBBNZ6MRR5SYGGjKzS6xyiU5zBeY9wxomo")
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pins/"+testCid.String() {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":404,"message":"not found"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"cid":"%s","name":"","peer_map":{
+			"12D3KooWClusterB":{"peername":"b","ipfs_peer_id":"%s","ipfs_peer_addresses":["/ip4/1.2.3.4/tcp/4001/p2p/%s"],"status":"pinned","error":""},
+			"12D3KooWClusterA":{"peername":"a","ipfs_peer_id":"%s","ipfs_peer_addresses":[],"status":"pin_error","error":"context deadline exceeded"}
+		}}`, testCid, pinned, pinned, failed)
+	}))
+	defer srv.Close()
+
+	cc := newClusterClient(srv.URL + "/")
+	ctx := context.Background()
+
+	pins, err := cc.pinStatus(ctx, testCid)
+	require.NoError(t, err)
+	require.Len(t, pins, 2)
+	require.Equal(t, "a", pins[0].PeerName, "pins are sorted by cluster peer")
+	require.Equal(t, "pin_error", pins[0].Status)
+	require.Equal(t, "context deadline exceeded", pins[0].Error)
+
+	provs := pinnedProviders(pins)
+	require.Len(t, provs, 1)
+	require.Equal(t, pinned, provs[0].ID)
+	require.Equal(t, "/ip4/1.2.3.4/tcp/4001", provs[0].Addrs[0].String(), "the peer ID is removed from the addresses")
+
+	out := []ProviderOutput{{ID: pinned.String()}, {ID: "other"}}
+	setClusterPins(out, pins)
+	require.Equal(t, "pinned", out[0].Cluster.Status)
+	require.Nil(t, out[1].Cluster)
+
+	peerOut := cc.checkPeer(ctx, testCid, failed)
+	require.Empty(t, peerOut.Error)
+	require.Equal(t, "pin_error", peerOut.PeerStatus)
+	require.Len(t, peerOut.Pins, 2)
+
+	peerOut = cc.checkPeer(ctx, cid.NewCidV1(cid.DagProtobuf, mh), failed)
+	require.Contains(t, peerOut.Error, "404")
+}
@@ -0,0 +1,72 @@
+package check
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DAGCheckOutput is the result of downloading the whole DAG rooted at the
+// checked CID from the peer, see Options.DAGMaxBlocks
+type DAGCheckOutput struct {
+	// Blocks is the number of blocks received and verified
+	Blocks int
+	// Complete is whether every block of the DAG was received
+	Complete bool
+	// Truncated is whether the download stopped after DAGMaxBlocks blocks,
+	// the rest of the DAG being unchecked
+	Truncated bool
+	// MissingCID is the first block that could not be retrieved, and Error
+	// why, or why the DAG could not be walked further
+	MissingCID string
+	Error      string
+	Duration   time.Duration
+}
+
+// checkDAG downloads the DAG rooted at c from the peer over Bitswap, in
+// depth-first order, stopping at the first block that can not be retrieved or
+// after maxBlocks blocks
+func checkDAG(ctx context.Context, h host.Host, p peer.ID, c cid.Cid, maxBlocks int, timeout time.Duration) *DAGCheckOutput {
+	start := time.Now()
+	out := &DAGCheckOutput{}
+	f := newBlockFetcher(h, p, max(bitswapBlockTimeout, timeout))
+	defer f.close()
+
+	seen := make(map[cid.Cid]struct{})
+	queue := []cid.Cid{c}
+	for len(queue) > 0 {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		if out.Blocks == maxBlocks {
+			out.Truncated = true
+			break
+		}
+		seen[c] = struct{}{}
+
+		b, err := f.fetch(ctx, c)
+		if err != nil {
+			out.MissingCID, out.Error = c.String(), err.Error()
+			break
+		}
+		out.Blocks++
+		links, err := blockLinks(b)
+		if err != nil {
+			// The links of the block can not be followed
+			out.Error = err.Error()
+			break
+		}
+		// Pushed in reverse to be visited in order
+		for i := len(links) - 1; i >= 0; i-- {
+			queue = append(queue, links[i])
+		}
+	}
+	out.Complete = out.Error == "" && !out.Truncated
+	out.Duration = time.Since(start)
+	return out
+}
@@ -0,0 +1,197 @@
+package check
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+var (
+	// ErrDeniedCID is returned when checking a CID of the denylist
+	ErrDeniedCID = errors.New("the CID is in the denylist of this ipfs-check instance")
+	// ErrDeniedPeer is returned when checking a peer, or an address, of the
+	// denylist
+	ErrDeniedPeer = errors.New("the peer is in the denylist of this ipfs-check instance")
+)
+
+// errDeniedAddrs is the connection error of the peers whose addresses are all
+// in the denylist
+const errDeniedAddrs = "all the addresses of the peer are in the denylist of this ipfs-check instance"
+
+// Denylist lists the peers, networks and autonomous systems the checker
+// refuses to dial, and the CIDs it refuses to check. A nil Denylist denies
+// nothing.
+type Denylist struct {
+	peers    map[peer.ID]struct{}
+	networks []*net.IPNet
+	asns     map[uint]struct{}
+	// cids has the multihashes of the CIDs listed as is
+	cids map[string]struct{}
+	// hashedCIDs has the hex SHA-256 hashes of "<CIDv1 base32>/" of the CIDs
+	// listed in the badbits format
+	hashedCIDs map[string]struct{}
+}
+
+// NewDenylist returns a denylist of peer IDs, CIDR networks, autonomous
+// system numbers and of the CIDs listed in cidFiles. Each line of the files
+// is either a CID, optionally prefixed with /ipfs/, or a //<hex SHA-256>
+// entry of the badbits list. Other entries, e.g. paths or IPNS names, are
+// ignored. Denying autonomous systems requires the checker to have a GeoIP
+// ASN database.
+func NewDenylist(peers, networks []string, asns []uint, cidFiles []string) (*Denylist, error) {
+	dl := &Denylist{
+		peers:      make(map[peer.ID]struct{}, len(peers)),
+		asns:       make(map[uint]struct{}, len(asns)),
+		cids:       make(map[string]struct{}),
+		hashedCIDs: make(map[string]struct{}),
+	}
+	for _, s := range peers {
+		p, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied peer ID %q: %w", s, err)
+		}
+		dl.peers[p] = struct{}{}
+	}
+	for _, s := range networks {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied network %q: %w", s, err)
+		}
+		dl.networks = append(dl.networks, n)
+	}
+	for _, asn := range asns {
+		dl.asns[asn] = struct{}{}
+	}
+	for _, path := range cidFiles {
+		if err := dl.loadCIDs(path); err != nil {
+			return nil, fmt.Errorf("reading CID denylist %s: %w", path, err)
+		}
+	}
+	return dl, nil
+}
+
+// loadCIDs adds the CIDs of the file at path
+func (dl *Denylist) loadCIDs(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return dl.readCIDs(f)
+}
+
+func (dl *Denylist) readCIDs(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if hash, ok := strings.CutPrefix(line, "//"); ok {
+			if b, err := hex.DecodeString(hash); err == nil && len(b) == sha256.Size {
+				dl.hashedCIDs[hash] = struct{}{}
+			}
+			continue
+		}
+		if c, err := cid.Decode(strings.TrimPrefix(line, "/ipfs/")); err == nil {
+			dl.cids[string(c.Hash())] = struct{}{}
+		}
+	}
+	return sc.Err()
+}
+
+// Len returns the number of entries of the denylist
+func (dl *Denylist) Len() int {
+	if dl == nil {
+		return 0
+	}
+	return len(dl.peers) + len(dl.networks) + len(dl.asns) + len(dl.cids) + len(dl.hashedCIDs)
+}
+
+// deniesCID returns whether c is in the denylist
+func (dl *Denylist) deniesCID(c cid.Cid) bool {
+	if dl == nil {
+		return false
+	}
+	if _, ok := dl.cids[string(c.Hash())]; ok {
+		return true
+	}
+	if len(dl.hashedCIDs) == 0 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(cid.NewCidV1(c.Type(), c.Hash()).String() + "/"))
+	_, ok := dl.hashedCIDs[hex.EncodeToString(sum[:])]
+	return ok
+}
+
+// deniesPeer returns whether p is in the denylist
+func (dl *Denylist) deniesPeer(p peer.ID) bool {
+	if dl == nil {
+		return false
+	}
+	_, ok := dl.peers[p]
+	return ok
+}
+
+// deniesAddr returns whether the IP address of a is in a denied network or
+// autonomous system, which g looks up. Addresses without an IP address, e.g.
+// DNS addresses, are checked once resolved.
+func (dl *Denylist) deniesAddr(a multiaddr.Multiaddr, g *GeoIP) bool {
+	if dl == nil {
+		return false
+	}
+	ip := addrIP(a)
+	if ip == nil {
+		return false
+	}
+	for _, n := range dl.networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	if len(dl.asns) > 0 {
+		if asn, _ := g.lookupASN(ip); asn != 0 {
+			_, ok := dl.asns[asn]
+			return ok
+		}
+	}
+	return false
+}
+
+// filterAddrs returns the addresses of addrs that are not denied
+func (dl *Denylist) filterAddrs(addrs []multiaddr.Multiaddr, g *GeoIP) []multiaddr.Multiaddr {
+	if dl == nil {
+		return addrs
+	}
+	var allowed []multiaddr.Multiaddr
+	for _, a := range addrs {
+		if !dl.deniesAddr(a, g) {
+			allowed = append(allowed, a)
+		}
+	}
+	return allowed
+}
+
+// Denied returns ErrDeniedCID if c is in the denylist of the checker, and
+// ErrDeniedPeer if the peer of ma, or its address, is. ma can be nil, e.g.
+// for CID checks.
+func (ck *Checker) Denied(c cid.Cid, ma multiaddr.Multiaddr) error {
+	if ck.denylist.deniesCID(c) {
+		return ErrDeniedCID
+	}
+	if ma == nil {
+		return nil
+	}
+	addr, p := peer.SplitAddr(ma)
+	if ck.denylist.deniesPeer(p) || (addr != nil && ck.denylist.deniesAddr(addr, ck.geoIP)) {
+		return ErrDeniedPeer
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package check
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenylist(t *testing.T) {
+	mhCid := func(data string) cid.Cid {
+		mh, err := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		return cid.NewCidV1(cid.DagProtobuf, mh)
+	}
+	plain, hashed, allowed := mhCid("plain"), mhCid("hashed"), mhCid("allowed")
+	sum := sha256.Sum256([]byte(hashed.String() + "/"))
+	list := "# comment\n" +
+		"/ipfs/" + plain.String() + "\n" +
+		"//" + hex.EncodeToString(sum[:]) + "\n" +
+		"/ipns/example.com\n"
+	path := filepath.Join(t.TempDir(), "badbits.deny")
+	require.NoError(t, os.WriteFile(path, []byte(list), 0o644))
+
+	const deniedPeer = "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"
+	dl, err := NewDenylist([]string{deniedPeer}, []string{"192.0.2.0/24"}, []uint{64500}, []string{path})
+	require.NoError(t, err)
+	require.Equal(t, 5, dl.Len())
+
+	require.True(t, dl.deniesCID(plain))
+	require.True(t, dl.deniesCID(cid.NewCidV0(plain.Hash())), "CIDv0 and CIDv1 of the same multihash are denied")
+	require.True(t, dl.deniesCID(hashed))
+	require.True(t, dl.deniesCID(cid.NewCidV0(hashed.Hash())), "badbits entries hash the CIDv1")
+	require.False(t, dl.deniesCID(allowed))
+
+	geoIP := &GeoIP{asn: fakeLookup{"198.51.100.1": {"autonomous_system_number": uint(64500)}}}
+	ck := &Checker{denylist: dl, geoIP: geoIP}
+	require.ErrorIs(t, ck.Denied(plain, nil), ErrDeniedCID)
+	require.NoError(t, ck.Denied(allowed, nil))
+	require.ErrorIs(t, ck.Denied(allowed, multiaddr.StringCast("/p2p/"+deniedPeer)), ErrDeniedPeer)
+	require.ErrorIs(t, ck.Denied(allowed, multiaddr.StringCast("/ip4/192.0.2.1/tcp/4001/p2p/12D3KooWJ5eoEWtbt4MHJXgYC8Gb2P9VGWaX69zHBXDqbPqxVQAk")), ErrDeniedPeer)
+	require.NoError(t, ck.Denied(allowed, multiaddr.StringCast("/ip4/203.0.113.1/tcp/4001/p2p/12D3KooWJ5eoEWtbt4MHJXgYC8Gb2P9VGWaX69zHBXDqbPqxVQAk")))
+
+	addrs := []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/192.0.2.1/tcp/4001"),
+		multiaddr.StringCast("/ip4/198.51.100.1/tcp/4001"),
+		multiaddr.StringCast("/ip4/203.0.113.1/tcp/4001"),
+		multiaddr.StringCast("/dns4/example.com/tcp/4001"),
+	}
+	require.Equal(t, addrs[2:], dl.filterAddrs(addrs, geoIP))
+	require.Equal(t, addrs[1:], dl.filterAddrs(addrs, nil), "autonomous systems are only denied with a GeoIP ASN database")
+
+	var disabled *Denylist
+	require.False(t, disabled.deniesCID(plain))
+	require.Equal(t, addrs, disabled.filterAddrs(addrs, geoIP))
+
+	_, err = NewDenylist([]string{"not a peer ID"}, nil, nil, nil)
+	require.Error(t, err)
+	_, err = NewDenylist(nil, []string{"192.0.2.1"}, nil, nil)
+	require.Error(t, err)
+}
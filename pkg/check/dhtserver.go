@@ -0,0 +1,71 @@
+package check
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DHTServerCheckOutput is the result of querying the peer directly as a DHT
+// server. Peers running the DHT in client mode, which do not serve records
+// to other peers, do not advertise the DHT protocol and are not queried.
+type DHTServerCheckOutput struct {
+	// Advertised is whether the peer advertises the DHT protocol over
+	// identify, i.e. runs the DHT in server mode
+	Advertised bool
+	// FindNode is whether the peer answered a FIND_NODE query with closer
+	// peers, which a DHT server with an empty routing table can not do
+	FindNode      bool
+	ClosestPeers  int
+	FindNodeError string
+	// GetProviders is whether the peer answered a GET_PROVIDERS query for
+	// the CID, and Providers the number of provider records it returned. No
+	// query is sent in node checks, which have no CID.
+	GetProviders      bool
+	Providers         int
+	GetProvidersError string
+}
+
+// checkDHTServer queries peer p, which h is connected to and has identified,
+// with FIND_NODE and GET_PROVIDERS if it advertises the DHT protocol. The
+// GET_PROVIDERS query is skipped when c is cid.Undef.
+func (ck *Checker) checkDHTServer(ctx context.Context, h host.Host, p peer.ID, c cid.Cid) *DHTServerCheckOutput {
+	out := &DHTServerCheckOutput{}
+	supported, err := h.Peerstore().SupportsProtocols(p, ck.dhtProtocol)
+	out.Advertised = err == nil && len(supported) > 0
+	if !out.Advertised {
+		return out
+	}
+
+	messenger, err := dhtProtocolMessenger(ck.dhtProtocol, h)
+	if err != nil {
+		out.FindNodeError = err.Error()
+		out.GetProvidersError = err.Error()
+		return out
+	}
+
+	closest, err := messenger.GetClosestPeers(ctx, p, p)
+	out.ClosestPeers = len(closest)
+	switch {
+	case err != nil:
+		out.FindNodeError = err.Error()
+	case len(closest) == 0:
+		out.FindNodeError = "the peer returned no closer peers, its routing table is empty"
+	default:
+		out.FindNode = true
+	}
+
+	if !c.Defined() {
+		return out
+	}
+	provs, _, err := messenger.GetProviders(ctx, p, c.Hash())
+	if err != nil {
+		out.GetProvidersError = err.Error()
+	} else {
+		out.GetProviders = true
+		out.Providers = len(provs)
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDHTServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	newDHTNode := func(mode dht.ModeOpt) host.Host {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		d, err := dht.New(ctx, h, dht.ProtocolPrefix("/test"), dht.Mode(mode))
+		require.NoError(t, err)
+		t.Cleanup(func() { d.Close() })
+		return h
+	}
+	server, otherServer, client := newDHTNode(dht.ModeServer), newDHTNode(dht.ModeServer), newDHTNode(dht.ModeClient)
+	require.NoError(t, otherServer.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}))
+
+	mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	c := cid.NewCidV1(cid.Raw, mh)
+
+	ck := &Checker{dhtProtocol: "/test/kad/1.0.0"}
+	check := func(target host.Host) *DHTServerCheckOutput {
+		h, err := libp2p.New(libp2p.NoListenAddrs)
+		require.NoError(t, err)
+		defer h.Close()
+		sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+		require.NoError(t, err)
+		defer sub.Close()
+		require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()}))
+		waitForIdentify(ctx, sub, target.ID())
+		return ck.checkDHTServer(ctx, h, target.ID(), c)
+	}
+
+	// The servers add each other to their routing tables once identified
+	require.Eventually(t, func() bool { return check(server).FindNode }, 10*time.Second, 100*time.Millisecond)
+	out := check(server)
+	require.True(t, out.Advertised)
+	require.Positive(t, out.ClosestPeers)
+	require.True(t, out.GetProviders)
+	require.Zero(t, out.Providers)
+	require.Empty(t, out.GetProvidersError)
+
+	out = check(client)
+	require.Equal(t, &DHTServerCheckOutput{}, out, "DHT clients are not queried")
+}
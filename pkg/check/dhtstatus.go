@@ -0,0 +1,199 @@
+package check
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/crawler"
+	"github.com/libp2p/go-libp2p-kad-dht/fullrt"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DHTStatusOutput is the state of the DHT client of a Checker
+type DHTStatusOutput struct {
+	// Accelerated is whether the accelerated DHT client is used
+	Accelerated bool
+	// Ready is whether the DHT client is ready, which is only false while the
+	// accelerated DHT client maps the DHT
+	Ready bool
+	// Routing is the DHT client checks currently use
+	Routing string
+	// RoutingTableSize is the number of peers in the routing table
+	RoutingTableSize int
+	// Crawl is the progress of the current or last crawl of the DHT by the
+	// accelerated DHT client, nil for the standard client
+	Crawl *CrawlProgressOutput
+}
+
+// CrawlProgressOutput is the progress of a crawl of the DHT
+type CrawlProgressOutput struct {
+	Running bool
+	Started time.Time
+	// Duration is the time spent crawling so far, or the total time of the
+	// crawl when it is not running
+	Duration time.Duration
+	// PeersQueried is the number of peers that returned their routing table
+	PeersQueried int
+	// PeersFailed is the number of peers that could not be queried
+	PeersFailed int
+	// PeersDiscovered is the number of peers found so far, queried or not
+	PeersDiscovered int
+	// BucketsFilled is the number of k-buckets, relative to the checker's
+	// peer ID, with at least bucketSize queried peers
+	BucketsFilled int
+	// EstimatedRemaining is the estimated time left for the crawl to complete
+	EstimatedRemaining time.Duration
+	// CompletedCrawls is the number of crawls completed since startup
+	CompletedCrawls int
+	// LastCrawlDuration is how long the last completed crawl took
+	LastCrawlDuration time.Duration
+}
+
+const bucketSize = 20
+
+// progressCrawler is the crawler of the accelerated DHT client, keeping track
+// of the progress of each crawl. When a datastore directory is set, the peers
+// found by each crawl are saved to it, and the first crawl after a restart
+// connects to the saved peers instead of crawling.
+type progressCrawler struct {
+	crawler.Crawler
+	h    host.Host
+	self kb.ID
+	// dir is the directory the snapshot is saved to, empty to not save it
+	dir string
+	// snapshot is replayed by the first crawl, nil if there is none
+	snapshot *routingSnapshot
+
+	mu              sync.Mutex
+	running         bool
+	started         time.Time
+	finished        time.Time
+	queried, failed int
+	discovered      map[peer.ID]struct{}
+	buckets         map[int]int
+	completed       int
+	lastDuration    time.Duration
+}
+
+func newProgressCrawler(h host.Host, dir string, snapshot *routingSnapshot) (*progressCrawler, error) {
+	c, err := crawler.NewDefaultCrawler(h, crawler.WithParallelism(200))
+	if err != nil {
+		return nil, err
+	}
+	return &progressCrawler{Crawler: c, h: h, self: kb.ConvertPeerID(h.ID()), dir: dir, snapshot: snapshot}, nil
+}
+
+func (c *progressCrawler) Run(ctx context.Context, startingPeers []*peer.AddrInfo, handleSuccess crawler.HandleQueryResult, handleFail crawler.HandleQueryFail) {
+	c.mu.Lock()
+	c.running = true
+	c.started = time.Now()
+	c.queried, c.failed = 0, 0
+	c.discovered = make(map[peer.ID]struct{}, len(startingPeers))
+	for _, ai := range startingPeers {
+		c.discovered[ai.ID] = struct{}{}
+	}
+	c.buckets = make(map[int]int)
+	c.mu.Unlock()
+
+	var succeeded []peer.ID
+	onSuccess := func(p peer.ID, rtPeers []*peer.AddrInfo) {
+		c.mu.Lock()
+		c.queried++
+		c.buckets[kb.CommonPrefixLen(c.self, kb.ConvertPeerID(p))]++
+		c.discovered[p] = struct{}{}
+		for _, ai := range rtPeers {
+			c.discovered[ai.ID] = struct{}{}
+		}
+		c.mu.Unlock()
+		succeeded = append(succeeded, p)
+		handleSuccess(p, rtPeers)
+	}
+	onFail := func(p peer.ID, err error) {
+		c.mu.Lock()
+		c.failed++
+		c.discovered[p] = struct{}{}
+		c.mu.Unlock()
+		handleFail(p, err)
+	}
+
+	replayed := false
+	if s := c.snapshot; s != nil {
+		c.snapshot = nil
+		log.Printf("Connecting to the %d peers of the routing table snapshot from %s\n", len(s.Peers), s.Saved.Format(time.RFC3339))
+		replaySnapshot(ctx, c.h, s, onSuccess, onFail)
+		// Crawl anyway if most of the peers are gone
+		replayed = len(succeeded) >= len(s.Peers)/2
+	}
+	if !replayed {
+		c.Crawler.Run(ctx, startingPeers, onSuccess, onFail)
+		if c.dir != "" && ctx.Err() == nil {
+			if err := saveSnapshot(c.dir, c.h.Peerstore(), succeeded); err != nil {
+				log.Printf("Error saving the routing table snapshot: %v\n", err)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.running = false
+	c.finished = time.Now()
+	c.completed++
+	c.lastDuration = c.finished.Sub(c.started)
+	c.mu.Unlock()
+}
+
+func (c *progressCrawler) progress() *CrawlProgressOutput {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := &CrawlProgressOutput{
+		Running:           c.running,
+		Started:           c.started,
+		PeersQueried:      c.queried,
+		PeersFailed:       c.failed,
+		PeersDiscovered:   len(c.discovered),
+		CompletedCrawls:   c.completed,
+		LastCrawlDuration: c.lastDuration,
+	}
+	for _, n := range c.buckets {
+		if n >= bucketSize {
+			out.BucketsFilled++
+		}
+	}
+	if !c.running {
+		out.Duration = c.finished.Sub(c.started)
+		return out
+	}
+
+	out.Duration = time.Since(c.started)
+	if c.lastDuration > 0 {
+		// Later crawls take about as long as the previous one
+		out.EstimatedRemaining = max(c.lastDuration-out.Duration, 0)
+	} else if done := c.queried + c.failed; done > 0 {
+		// The peers left to query, at the rate they have been queried so far
+		pending := len(c.discovered) - done
+		out.EstimatedRemaining = out.Duration * time.Duration(pending) / time.Duration(done)
+	}
+	return out
+}
+
+// DHTStatus returns the state of the DHT client, including the progress of
+// the crawl of the accelerated DHT client
+func (ck *Checker) DHTStatus() DHTStatusOutput {
+	out := DHTStatusOutput{Ready: ck.Ready(), Routing: ck.Routing()}
+	switch d := ck.dht.(type) {
+	case *fullrt.FullRT:
+		out.Accelerated = true
+		out.RoutingTableSize = len(d.Stat())
+	case *dht.IpfsDHT:
+		out.RoutingTableSize = d.RoutingTable().Size()
+	}
+	if ck.crawler != nil {
+		out.Crawl = ck.crawler.progress()
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package check
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-kad-dht/crawler"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+// stepCrawler queries the starting peers, calling step after each query
+type stepCrawler struct {
+	step func()
+}
+
+func (c stepCrawler) Run(ctx context.Context, startingPeers []*peer.AddrInfo, handleSuccess crawler.HandleQueryResult, handleFail crawler.HandleQueryFail) {
+	for i, ai := range startingPeers {
+		if i%2 == 0 {
+			handleSuccess(ai.ID, startingPeers)
+		} else {
+			handleFail(ai.ID, context.DeadlineExceeded)
+		}
+		c.step()
+	}
+}
+
+func TestProgressCrawler(t *testing.T) {
+	self, err := test.RandPeerID()
+	require.NoError(t, err)
+	var peers []*peer.AddrInfo
+	for i := 0; i < 4; i++ {
+		p, err := test.RandPeerID()
+		require.NoError(t, err)
+		peers = append(peers, &peer.AddrInfo{ID: p})
+	}
+
+	c := &progressCrawler{self: kb.ConvertPeerID(self)}
+	var steps []*CrawlProgressOutput
+	c.Crawler = stepCrawler{step: func() { steps = append(steps, c.progress()) }}
+	c.Run(context.Background(), peers, func(peer.ID, []*peer.AddrInfo) {}, func(peer.ID, error) {})
+
+	require.Len(t, steps, 4)
+	require.True(t, steps[0].Running)
+	require.Equal(t, 1, steps[0].PeersQueried)
+	require.Equal(t, 4, steps[0].PeersDiscovered)
+	require.Equal(t, 1, steps[1].PeersFailed)
+	require.Zero(t, steps[0].CompletedCrawls)
+
+	out := c.progress()
+	require.False(t, out.Running)
+	require.Equal(t, 2, out.PeersQueried)
+	require.Equal(t, 2, out.PeersFailed)
+	require.Equal(t, 1, out.CompletedCrawls)
+	require.Equal(t, out.Duration, out.LastCrawlDuration)
+	require.Zero(t, out.EstimatedRemaining)
+}
@@ -0,0 +1,275 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// maxConcurrentAddrDials bounds the addresses of a peer dialed at once,
+	// each from its own host
+	maxConcurrentAddrDials = 8
+	// maxDialedAddrs bounds the addresses of a peer dialed in a check, so a
+	// peer announcing a lot of them can not make the checker dial them all
+	maxDialedAddrs = 32
+)
+
+// errAddrNotDialed is the error of the addresses of a peer beyond maxDialedAddrs
+var errAddrNotDialed = fmt.Sprintf("not dialed, only the first %d addresses of a peer are dialed", maxDialedAddrs)
+
+// AddrDialOutput is the result of dialing a single address of a peer
+type AddrDialOutput struct {
+	Addr string
+	// Duration of the dial, including the security and muxer handshakes
+	Duration time.Duration
+	Error    string
+	// Transport, Security and Muxer are what was negotiated on the
+	// connection, empty if the dial failed
+	Transport string
+	Security  string
+	Muxer     string
+	// HandshakeFailure is HandshakeSecurity or HandshakeMuxer when the dial
+	// failed while negotiating the security protocol or the stream
+	// multiplexer, which points at an interoperability problem rather than
+	// at an unreachable address
+	HandshakeFailure string
+	// PeerIDMismatch is set when the address is served by another peer
+	PeerIDMismatch *PeerIDMismatchOutput
+	// Isolated is whether the address was dialed from a new host without
+	// listen addresses and with an empty peerstore, so from a new source port
+	// and without reusing the connections, addresses or dial backoffs of the
+	// checker and of other checks, see Config.NewIsolatedHost
+	Isolated bool
+	// LocalAddr is the address the connection was made from, empty if the
+	// dial failed
+	LocalAddr string
+}
+
+// dialAddrs dials the addresses of p separately, maxConcurrentAddrDials at a
+// time, each from its own isolated host, so the result of each address is not
+// hidden by the dialer's address ranking nor by existing connections. Only the
+// first maxDialedAddrs addresses are dialed. Results are returned in the order
+// of addrs.
+func (ck *Checker) dialAddrs(ctx context.Context, p peer.ID, addrs []multiaddr.Multiaddr, timeout time.Duration) []AddrDialOutput {
+	out := make([]AddrDialOutput, len(addrs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentAddrDials)
+	for i, addr := range addrs {
+		if i >= maxDialedAddrs {
+			out[i] = AddrDialOutput{Addr: addr.String(), Error: errAddrNotDialed}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, addr multiaddr.Multiaddr) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			out[i] = ck.dialAddr(ctx, p, addr, timeout)
+		}(i, addr)
+	}
+	wg.Wait()
+
+	return out
+}
+
+func (ck *Checker) dialAddr(ctx context.Context, p peer.ID, addr multiaddr.Multiaddr, timeout time.Duration) AddrDialOutput {
+	out := AddrDialOutput{Addr: addr.String(), Isolated: ck.isolatedDials}
+
+	start := time.Now()
+	state, localAddr, err := ck.dialPeer(ctx, peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{addr}}, timeout)
+	out.Duration = time.Since(start)
+	if err != nil {
+		out.Error = err.Error()
+		out.PeerIDMismatch = peerIDMismatch(err)
+		if out.PeerIDMismatch == nil {
+			// A handshake with the wrong peer is not an interoperability problem
+			out.HandshakeFailure = handshakeFailure(out.Error)
+		}
+	} else if state != nil {
+		out.Transport, out.Security, out.Muxer = state.Transport, state.Security, state.Muxer
+		out.LocalAddr = localAddr.String()
+	}
+	return out
+}
+
+// dialPeer connects to ai from a new isolated host, only using the addresses
+// in ai, and returns what was negotiated on the connection and the address it
+// was made from
+func (ck *Checker) dialPeer(ctx context.Context, ai peer.AddrInfo, timeout time.Duration) (*ConnectionStateOutput, multiaddr.Multiaddr, error) {
+	dialHost, err := ck.newIsolatedHost()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dialHost.Close()
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	if err := dialHost.Connect(dialCtx, ai); err != nil {
+		return nil, nil, err
+	}
+	conns := dialHost.Network().ConnsToPeer(ai.ID)
+	if len(conns) == 0 {
+		return nil, nil, nil
+	}
+	state := connectionState(conns[0], start)
+	return &state, conns[0].LocalMultiaddr(), nil
+}
+
+// connectBitswap connects h to ai and opens a Bitswap stream, which forces
+// NAT hole punching when the peer is only reachable through a relay, see
+// https://github.com/libp2p/go-libp2p/issues/2714. The error of a failed
+// connection is returned as is, as opening a stream after it would only fail
+// with the dial backoff the failure left in the swarm. The durations of the
+// connection and of the stream negotiation are recorded in timings.
+func connectBitswap(ctx context.Context, h host.Host, ai peer.AddrInfo, timings *TimingsOutput) error {
+	clearDialBackoff(h, ai.ID)
+	start := time.Now()
+	err := h.Connect(ctx, ai)
+	timings.Dial += since(&start)
+	if err != nil {
+		return err
+	}
+	_, err = h.NewStream(ctx, ai.ID, "/ipfs/bitswap/1.2.0", "/ipfs/bitswap/1.1.0", "/ipfs/bitswap/1.0.0", "/ipfs/bitswap")
+	timings.Negotiation = since(&start)
+	return err
+}
+
+// clearDialBackoff forgets the failed dials of h to p, so a peer that just
+// came online is dialed again instead of being reported unreachable from a
+// cached failure. Hosts returned by Config.NewTestHost may be reused across
+// checks. It returns whether h had a failed dial of p in backoff, to addrs or
+// to the addresses of p in its peerstore.
+func clearDialBackoff(h host.Host, p peer.ID, addrs ...multiaddr.Multiaddr) bool {
+	sw, ok := h.Network().(*swarm.Swarm)
+	if !ok {
+		return false
+	}
+	backoff := false
+	for _, a := range append(h.Peerstore().Addrs(p), addrs...) {
+		if sw.Backoff().Backoff(p, a) {
+			backoff = true
+			break
+		}
+	}
+	sw.Backoff().Clear(p)
+	return backoff
+}
+
+// AddrFamilyOutput is the result of dialing the addresses of a peer of one IP family
+type AddrFamilyOutput struct {
+	Addrs     []string
+	Connected bool
+	Error     string
+}
+
+// AddrFamiliesOutput splits the dial results of a dual-stack peer by IP
+// family, as broken IPv6 routes are hidden by dials using all addresses
+type AddrFamiliesOutput struct {
+	IPv4 AddrFamilyOutput
+	IPv6 AddrFamilyOutput
+}
+
+// addrFamily returns the IP family of the address dialed for addr, empty if
+// it can not be told or if addr is a relay address
+func addrFamily(addr multiaddr.Multiaddr) string {
+	if isRelayAddr(addr) {
+		return ""
+	}
+	switch addr.Protocols()[0].Code {
+	case multiaddr.P_IP4, multiaddr.P_DNS4:
+		return AddrFamilyIPv4
+	case multiaddr.P_IP6, multiaddr.P_DNS6:
+		return AddrFamilyIPv6
+	}
+	return ""
+}
+
+// splitAddrFamilies returns the IPv4 and IPv6 addresses in addrs
+func splitAddrFamilies(addrs []multiaddr.Multiaddr) (ip4, ip6 []multiaddr.Multiaddr) {
+	for _, addr := range addrs {
+		switch addrFamily(addr) {
+		case AddrFamilyIPv4:
+			ip4 = append(ip4, addr)
+		case AddrFamilyIPv6:
+			ip6 = append(ip6, addr)
+		}
+	}
+	return ip4, ip6
+}
+
+// summarizeAddrFamilies groups the results of dialing each address separately
+// by IP family, nil if the peer is not dual-stack
+func summarizeAddrFamilies(results []AddrDialOutput) *AddrFamiliesOutput {
+	out := &AddrFamiliesOutput{}
+	for _, r := range results {
+		addr, err := multiaddr.NewMultiaddr(r.Addr)
+		if err != nil {
+			continue
+		}
+		var f *AddrFamilyOutput
+		switch addrFamily(addr) {
+		case AddrFamilyIPv4:
+			f = &out.IPv4
+		case AddrFamilyIPv6:
+			f = &out.IPv6
+		default:
+			continue
+		}
+		f.Addrs = append(f.Addrs, r.Addr)
+		if r.Error == "" {
+			f.Connected = true
+		} else if f.Error == "" {
+			f.Error = r.Error
+		}
+	}
+	if len(out.IPv4.Addrs) == 0 || len(out.IPv6.Addrs) == 0 {
+		return nil
+	}
+	for _, f := range []*AddrFamilyOutput{&out.IPv4, &out.IPv6} {
+		if f.Connected {
+			f.Error = ""
+		}
+	}
+	return out
+}
+
+// dialAddrFamilies dials the IPv4 and IPv6 addresses of a dual-stack peer
+// separately, each from its own isolated host. It returns nil if the peer is not
+// dual-stack, or if the checker is restricted to one family.
+func (ck *Checker) dialAddrFamilies(ctx context.Context, p peer.ID, addrs []multiaddr.Multiaddr, timeout time.Duration) *AddrFamiliesOutput {
+	ip4, ip6 := splitAddrFamilies(addrs)
+	if len(ip4) == 0 || len(ip6) == 0 || ck.addrFamily != "" {
+		return nil
+	}
+
+	out := &AddrFamiliesOutput{}
+	var wg sync.WaitGroup
+	for _, f := range []struct {
+		out   *AddrFamilyOutput
+		addrs []multiaddr.Multiaddr
+	}{{&out.IPv4, ip4}, {&out.IPv6, ip6}} {
+		for _, addr := range f.addrs {
+			f.out.Addrs = append(f.out.Addrs, addr.String())
+		}
+		wg.Add(1)
+		go func(f *AddrFamilyOutput, addrs []multiaddr.Multiaddr) {
+			defer wg.Done()
+			if _, _, err := ck.dialPeer(ctx, peer.AddrInfo{ID: p, Addrs: addrs}, timeout); err != nil {
+				f.Error = err.Error()
+			} else {
+				f.Connected = true
+			}
+		}(f.out, f.addrs)
+	}
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,165 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeAddrFamilies(t *testing.T) {
+	results := []AddrDialOutput{
+		{Addr: "/ip4/1.2.3.4/tcp/4001"},
+		{Addr: "/ip6/2001:db8::1/tcp/4001", Error: "no route to host"},
+		{Addr: "/dns6/example.com/udp/4001/quic-v1", Error: "timeout"},
+		{Addr: "/ip4/1.2.3.4/tcp/4001/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK/p2p-circuit"},
+	}
+
+	out := summarizeAddrFamilies(results)
+	require.NotNil(t, out)
+	require.Equal(t, AddrFamilyOutput{Addrs: []string{"/ip4/1.2.3.4/tcp/4001"}, Connected: true}, out.IPv4)
+	require.False(t, out.IPv6.Connected)
+	require.Len(t, out.IPv6.Addrs, 2)
+	require.Equal(t, "no route to host", out.IPv6.Error)
+
+	// not dual-stack, relay addresses don't count
+	require.Nil(t, summarizeAddrFamilies(results[:1]))
+	require.Nil(t, summarizeAddrFamilies([]AddrDialOutput{results[0], results[3]}))
+}
+
+func TestConnectBitswapClearsDialBackoff(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+	// Nothing listens on port 1
+	ai := peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/1")}}
+
+	require.Error(t, h.Connect(context.Background(), ai))
+	require.ErrorIs(t, h.Connect(context.Background(), ai), swarm.ErrDialBackoff)
+
+	// The peer is dialed again rather than reported from the cached failure
+	err = connectBitswap(context.Background(), h, ai, &TimingsOutput{})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, swarm.ErrDialBackoff)
+}
+
+func TestClearDialBackoff(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+	// Nothing listens on port 1
+	ai := peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/1")}}
+
+	require.False(t, clearDialBackoff(h, p, ai.Addrs...))
+	require.Error(t, h.Connect(context.Background(), ai))
+	// The failed dial is reported once, then forgotten
+	require.True(t, clearDialBackoff(h, p))
+	require.False(t, clearDialBackoff(h, p, ai.Addrs...))
+	require.NotErrorIs(t, h.Connect(context.Background(), ai), swarm.ErrDialBackoff)
+}
+
+func TestDialAddrIsolated(t *testing.T) {
+	target, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer target.Close()
+
+	var dialers []peer.ID
+	ck := &Checker{
+		newIsolatedHost: func() (host.Host, error) {
+			h, err := libp2p.New(libp2p.NoListenAddrs)
+			if err == nil {
+				dialers = append(dialers, h.ID())
+			}
+			return h, err
+		},
+		isolatedDials: true,
+	}
+	first := ck.dialAddr(context.Background(), target.ID(), target.Addrs()[0], 10*time.Second)
+	require.Empty(t, first.Error)
+	require.True(t, first.Isolated)
+	require.NotEmpty(t, first.LocalAddr)
+	second := ck.dialAddr(context.Background(), target.ID(), target.Addrs()[0], 10*time.Second)
+	require.Empty(t, second.Error)
+	require.NotEqual(t, first.LocalAddr, second.LocalAddr, "each dial is made from a new source port")
+	require.Len(t, dialers, 2)
+	require.NotEqual(t, dialers[0], dialers[1], "each dial is made from a new host")
+}
+
+// closeHookHost calls onClose when the host is closed
+type closeHookHost struct {
+	host.Host
+	onClose func()
+}
+
+func (h closeHookHost) Close() error {
+	h.onClose()
+	return h.Host.Close()
+}
+
+func TestDialAddrsBounded(t *testing.T) {
+	p, err := test.RandPeerID()
+	require.NoError(t, err)
+	// Addresses of TEST-NET-1, whose dials hang until the timeout
+	var addrs []multiaddr.Multiaddr
+	for i := 0; i < maxDialedAddrs+5; i++ {
+		addrs = append(addrs, multiaddr.StringCast(fmt.Sprintf("/ip4/192.0.2.1/tcp/%d", 4001+i)))
+	}
+
+	var active, maxActive atomic.Int32
+	ck := &Checker{
+		newIsolatedHost: func() (host.Host, error) {
+			h, err := libp2p.New(libp2p.NoListenAddrs)
+			if err != nil {
+				return nil, err
+			}
+			n := active.Add(1)
+			for m := maxActive.Load(); n > m && !maxActive.CompareAndSwap(m, n); m = maxActive.Load() {
+			}
+			return closeHookHost{Host: h, onClose: func() { active.Add(-1) }}, nil
+		},
+	}
+	out := ck.dialAddrs(context.Background(), p, addrs, 200*time.Millisecond)
+	require.Len(t, out, len(addrs))
+	require.LessOrEqual(t, maxActive.Load(), int32(maxConcurrentAddrDials))
+	for i, r := range out {
+		require.Equal(t, addrs[i].String(), r.Addr)
+		require.NotEmpty(t, r.Error)
+		require.Equal(t, i >= maxDialedAddrs, r.Error == errAddrNotDialed, r.Addr)
+	}
+}
+
+func TestIsolatedHostDefaults(t *testing.T) {
+	ctx := context.Background()
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+	d, err := dht.New(ctx, h, dht.Mode(dht.ModeClient), dht.BootstrapPeers())
+	require.NoError(t, err)
+	defer d.Close()
+
+	ck, err := New(ctx, Config{Host: h, DHT: d})
+	require.NoError(t, err)
+	require.True(t, ck.isolatedDials)
+	isolated, err := ck.newIsolatedHost()
+	require.NoError(t, err)
+	defer isolated.Close()
+	require.Empty(t, isolated.Addrs(), "isolated hosts do not listen")
+
+	ck, err = New(ctx, Config{Host: h, DHT: d, NewTestHost: func() (host.Host, error) { return libp2p.New(libp2p.NoListenAddrs) }})
+	require.NoError(t, err)
+	require.False(t, ck.isolatedDials, "the hosts of NewTestHost are not known to be isolated")
+}
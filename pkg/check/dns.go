@@ -0,0 +1,155 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+// NewDNSResolver returns the resolver used for DNS multiaddrs. spec is either
+// empty for the system resolver, the URL of a DNS-over-HTTPS endpoint or the
+// host[:port] of a DNS server.
+func NewDNSResolver(spec string) (*madns.Resolver, error) {
+	switch {
+	case spec == "":
+		return madns.DefaultResolver, nil
+	case strings.HasPrefix(spec, "https://"):
+		return madns.NewResolver(madns.WithDefaultResolver(&dohResolver{url: spec, client: http.DefaultClient}))
+	case strings.Contains(spec, "://"):
+		return nil, fmt.Errorf("the DNS resolver must be an https:// DNS-over-HTTPS URL or the host[:port] of a DNS server, got %q", spec)
+	}
+
+	server := spec
+	if _, _, err := net.SplitHostPort(spec); err != nil {
+		server = net.JoinHostPort(spec, "53")
+	}
+	return madns.NewResolver(madns.WithDefaultResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}))
+}
+
+// dohResolver resolves names with DNS-over-HTTPS (RFC 8484)
+type dohResolver struct {
+	url    string
+	client *http.Client
+}
+
+func (r *dohResolver) LookupIPAddr(ctx context.Context, domain string) ([]net.IPAddr, error) {
+	var addrs []net.IPAddr
+	var errs []error
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		answers, err := r.query(ctx, domain, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, rr := range answers {
+			switch rr := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, net.IPAddr{IP: rr.A})
+			case *dns.AAAA:
+				addrs = append(addrs, net.IPAddr{IP: rr.AAAA})
+			}
+		}
+	}
+	if len(addrs) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return addrs, nil
+}
+
+func (r *dohResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	answers, err := r.query(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	var txts []string
+	for _, rr := range answers {
+		if txt, ok := rr.(*dns.TXT); ok {
+			txts = append(txts, strings.Join(txt.Txt, ""))
+		}
+	}
+	return txts, nil
+}
+
+func (r *dohResolver) query(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	// RFC 8484 recommends an ID of 0 for cache friendliness
+	msg.Id = 0
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS query for %s failed with status code %d", name, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	reply := new(dns.Msg)
+	if err := reply.Unpack(body); err != nil {
+		return nil, err
+	}
+	if reply.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("lookup %s: %s", name, dns.RcodeToString[reply.Rcode])
+	}
+	return reply.Answer, nil
+}
+
+// DNSResolutionOutput is the result of resolving a DNS multiaddr
+type DNSResolutionOutput struct {
+	Addr     string
+	Resolved []string
+	Error    string
+}
+
+// resolveDNSAddrs resolves the DNS components of every address that has one,
+// so DNS failures are reported on their own instead of as dial errors
+func resolveDNSAddrs(ctx context.Context, resolver *madns.Resolver, addrs []multiaddr.Multiaddr) []DNSResolutionOutput {
+	var out []DNSResolutionOutput
+	for _, addr := range addrs {
+		if !madns.Matches(addr) {
+			continue
+		}
+		res := DNSResolutionOutput{Addr: addr.String()}
+		resolved, err := resolver.Resolve(ctx, addr)
+		if err != nil {
+			res.Error = err.Error()
+		} else if len(resolved) == 0 {
+			res.Error = "no addresses found"
+		}
+		for _, r := range resolved {
+			res.Resolved = append(res.Resolved, r.String())
+		}
+		out = append(out, res)
+	}
+	return out
+}
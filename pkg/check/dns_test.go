@@ -0,0 +1,60 @@
+package check
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoHResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := new(dns.Msg)
+		require.NoError(t, req.Unpack(body))
+
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		switch {
+		case q.Name != "example.com.":
+			resp.Rcode = dns.RcodeNameError
+		case q.Qtype == dns.TypeA:
+			resp.Answer = append(resp.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("93.184.215.14"),
+			})
+		}
+		packed, err := resp.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	defer srv.Close()
+
+	// httptest only serves plain HTTP, so build the resolver by hand
+	resolver := &dohResolver{url: srv.URL, client: srv.Client()}
+	addrs, err := resolver.LookupIPAddr(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	require.Equal(t, "93.184.215.14", addrs[0].IP.String())
+
+	_, err = resolver.LookupIPAddr(context.Background(), "missing.example.com")
+	require.ErrorContains(t, err, "NXDOMAIN")
+
+	_, err = NewDNSResolver("udp://127.0.0.1")
+	require.Error(t, err)
+	res, err := NewDNSResolver("127.0.0.1:5353")
+	require.NoError(t, err)
+
+	// addresses without DNS components are not reported
+	out := resolveDNSAddrs(context.Background(), res, []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001")})
+	require.Empty(t, out)
+}
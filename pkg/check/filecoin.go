@@ -0,0 +1,204 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// graphsyncMetadataCode is the multicodec prefixing the metadata of the
+// transport-graphsync-filecoinv1 records in IPNI
+const graphsyncMetadataCode = 0x0910
+
+// graphsyncProtocols are the libp2p protocols of Graphsync, newest first
+var graphsyncProtocols = []protocol.ID{"/ipfs/graphsync/2.0.0", "/ipfs/graphsync/1.0.0"}
+
+// FilecoinRetrievalOutput is the result of probing the retrieval endpoints of
+// a Filecoin storage provider found in IPNI, see Options.FilecoinRetrieval.
+// It tells whether data stored on Filecoin is retrievable, apart from whether
+// it is over IPFS.
+type FilecoinRetrievalOutput struct {
+	// PieceCID is the piece holding the CID, and VerifiedDeal and
+	// FastRetrieval the terms of its deal, from the Graphsync metadata of the
+	// IPNI record
+	PieceCID      string
+	VerifiedDeal  bool
+	FastRetrieval bool
+	// Graphsync tells whether the storage provider accepts Graphsync streams
+	Graphsync GraphsyncProbeOutput
+	// PieceRetrieval is the result of requesting the piece from the HTTP
+	// addresses of the storage provider, nil when the piece CID is unknown
+	PieceRetrieval *HTTPCheckOutput
+	// Error is why the metadata of the record could not be read
+	Error string
+}
+
+// GraphsyncProbeOutput is the result of opening a Graphsync stream to a
+// storage provider. The stream is closed right away: the CID is not
+// retrieved over it.
+type GraphsyncProbeOutput struct {
+	// Protocol is the Graphsync protocol negotiated, empty if none was
+	Protocol string
+	Duration time.Duration
+	Error    string
+}
+
+// graphsyncMetadata is the metadata of a transport-graphsync-filecoinv1 record
+type graphsyncMetadata struct {
+	pieceCID      string
+	verifiedDeal  bool
+	fastRetrieval bool
+}
+
+// parseGraphsyncMetadata parses the metadata of a Graphsync record, the
+// base64 of the multicodec and the DAG-CBOR of the piece and deal terms
+func parseGraphsyncMetadata(raw json.RawMessage) (graphsyncMetadata, error) {
+	var md graphsyncMetadata
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return md, fmt.Errorf("invalid Graphsync metadata: %w", err)
+	}
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return md, fmt.Errorf("invalid Graphsync metadata: %w", err)
+	}
+	code, n := binary.Uvarint(b)
+	if n <= 0 || code != graphsyncMetadataCode {
+		return md, errors.New("the metadata is not Graphsync metadata")
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, bytes.NewReader(b[n:])); err != nil {
+		return md, fmt.Errorf("invalid Graphsync metadata: %w", err)
+	}
+	node := nb.Build()
+	if v, err := node.LookupByString("PieceCID"); err == nil {
+		if l, err := v.AsLink(); err == nil {
+			if cl, ok := l.(cidlink.Link); ok {
+				md.pieceCID = cl.Cid.String()
+			}
+		}
+	}
+	if v, err := node.LookupByString("VerifiedDeal"); err == nil {
+		md.verifiedDeal, _ = v.AsBool()
+	}
+	if v, err := node.LookupByString("FastRetrieval"); err == nil {
+		md.fastRetrieval, _ = v.AsBool()
+	}
+	return md, nil
+}
+
+// checkFilecoinRetrieval probes the Graphsync and HTTP piece retrieval
+// endpoints of a storage provider that advertises the CID over Graphsync in
+// IPNI, with the metadata of its record
+func (ck *Checker) checkFilecoinRetrieval(ctx context.Context, provider peer.AddrInfo, metadata json.RawMessage, opts Options) *FilecoinRetrievalOutput {
+	out := &FilecoinRetrievalOutput{}
+	if metadata != nil {
+		md, err := parseGraphsyncMetadata(metadata)
+		if err != nil {
+			out.Error = err.Error()
+		}
+		out.PieceCID, out.VerifiedDeal, out.FastRetrieval = md.pieceCID, md.verifiedDeal, md.fastRetrieval
+	}
+
+	var libp2pAddrs []multiaddr.Multiaddr
+	for _, a := range provider.Addrs {
+		if _, ok := httpProviderURL(a); !ok {
+			libp2pAddrs = append(libp2pAddrs, a)
+		}
+	}
+	libp2pAddrs, _ = ck.filterAddrs(libp2pAddrs)
+	if len(libp2pAddrs) == 0 {
+		out.Graphsync.Error = "the storage provider has no libp2p address"
+	} else if h, err := ck.newTestHost(); err != nil {
+		out.Graphsync.Error = err.Error()
+	} else {
+		out.Graphsync = probeGraphsync(ctx, h, peer.AddrInfo{ID: provider.ID, Addrs: libp2pAddrs}, opts.ProviderDialTimeout)
+		h.Close()
+	}
+
+	if out.PieceCID != "" {
+		addrs := ck.denylist.filterAddrs(httpAddrs(provider.Addrs), ck.geoIP)
+		out.PieceRetrieval = checkPieceRetrieval(ctx, httpProviderClient, addrs, out.PieceCID, opts.BitswapTimeout)
+	}
+	return out
+}
+
+// probeGraphsync connects to the storage provider and opens a Graphsync
+// stream to it
+func probeGraphsync(ctx context.Context, h host.Host, ai peer.AddrInfo, timeout time.Duration) GraphsyncProbeOutput {
+	var out GraphsyncProbeOutput
+	start := time.Now()
+	defer func() { out.Duration = time.Since(start) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := h.Connect(ctx, ai); err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	s, err := h.NewStream(ctx, ai.ID, graphsyncProtocols...)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.Protocol = string(s.Protocol())
+	_ = s.Reset()
+	return out
+}
+
+// checkPieceRetrieval asks each of the HTTP addresses of the storage provider
+// whether it serves the piece, with a HEAD request, until one of them does.
+// The piece is not downloaded, as pieces are up to 64 GiB.
+func checkPieceRetrieval(ctx context.Context, client *http.Client, addrs []multiaddr.Multiaddr, pieceCID string, timeout time.Duration) *HTTPCheckOutput {
+	out := &HTTPCheckOutput{}
+	start := time.Now()
+	defer func() { out.Duration = time.Since(start) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for _, addr := range addrs {
+		base, ok := httpProviderURL(addr)
+		if !ok {
+			continue
+		}
+		out.URL = base + "/piece/" + pieceCID
+		out.StatusCode = 0
+		out.Error = ""
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, out.URL, nil)
+		if err != nil {
+			out.Error = err.Error()
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			out.Error = err.Error()
+			continue
+		}
+		resp.Body.Close()
+		out.StatusCode = resp.StatusCode
+		if resp.StatusCode != http.StatusOK {
+			out.Error = fmt.Sprintf("the storage provider answered with status %s", resp.Status)
+			continue
+		}
+		out.Found = true
+		return out
+	}
+	if out.URL == "" {
+		out.Error = "the storage provider has no HTTP address"
+	}
+	return out
+}
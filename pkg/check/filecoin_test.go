@@ -0,0 +1,94 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+const testPieceCID = "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq"
+
+func TestParseGraphsyncMetadata(t *testing.T) {
+	n, err := qp.BuildMap(basicnode.Prototype.Any, 3, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "PieceCID", qp.Link(cidlink.Link{Cid: cid.MustParse(testPieceCID)}))
+		qp.MapEntry(ma, "VerifiedDeal", qp.Bool(true))
+		qp.MapEntry(ma, "FastRetrieval", qp.Bool(false))
+	})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, dagcbor.Encode(n, &buf))
+	b := binary.AppendUvarint(nil, graphsyncMetadataCode)
+	raw, err := json.Marshal(base64.StdEncoding.EncodeToString(append(b, buf.Bytes()...)))
+	require.NoError(t, err)
+
+	md, err := parseGraphsyncMetadata(raw)
+	require.NoError(t, err)
+	require.Equal(t, graphsyncMetadata{pieceCID: testPieceCID, verifiedDeal: true}, md)
+
+	// The metadata of Bitswap records is a bare multicodec
+	_, err = parseGraphsyncMetadata(json.RawMessage(`"gBI="`))
+	require.Error(t, err)
+}
+
+func TestProbeGraphsync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	h := newLoopbackHost(t)
+	sp := newLoopbackHost(t)
+	ai := peer.AddrInfo{ID: sp.ID(), Addrs: sp.Addrs()}
+
+	out := probeGraphsync(ctx, h, ai, 10*time.Second)
+	require.Empty(t, out.Protocol)
+	require.NotEmpty(t, out.Error, "the storage provider does not serve Graphsync")
+
+	sp.SetStreamHandler(graphsyncProtocols[1], func(s network.Stream) {
+		_, _ = io.Copy(io.Discard, s)
+		s.Close()
+	})
+	out = probeGraphsync(ctx, h, ai, 10*time.Second)
+	require.Empty(t, out.Error)
+	require.Equal(t, string(graphsyncProtocols[1]), out.Protocol)
+}
+
+func TestCheckPieceRetrieval(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodHead, r.Method)
+		if r.URL.Path != "/piece/"+testPieceCID {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	addrs := []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/" + port + "/http")}
+
+	out := checkPieceRetrieval(context.Background(), srv.Client(), addrs, testPieceCID, 10*time.Second)
+	require.True(t, out.Found, out.Error)
+	require.Equal(t, srv.URL+"/piece/"+testPieceCID, out.URL)
+
+	out = checkPieceRetrieval(context.Background(), srv.Client(), addrs, "baga6ea4seaqother", 10*time.Second)
+	require.False(t, out.Found)
+	require.Equal(t, http.StatusNotFound, out.StatusCode)
+
+	out = checkPieceRetrieval(context.Background(), srv.Client(), nil, testPieceCID, 10*time.Second)
+	require.Equal(t, "the storage provider has no HTTP address", out.Error)
+}
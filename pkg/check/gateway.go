@@ -0,0 +1,195 @@
+package check
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/routing/http/client"
+	"github.com/ipfs/boxo/routing/http/contentrouter"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// GatewayTimeout is how long public gateways such as ipfs.io wait for the
+// data before answering with a 504
+const GatewayTimeout = 30 * time.Second
+
+// errRetrievedElsewhere is the error of the providers whose retrieval was
+// stopped because another provider sent the block first
+const errRetrievedElsewhere = "another provider sent the block first"
+
+// GatewayProviderOutput is the retrieval of the block from one of the
+// providers in a gateway simulation. The durations are counted from the start
+// of the simulation, and are 0 for the steps that were not reached.
+type GatewayProviderOutput struct {
+	ID     string
+	Source string
+	// FoundAfter is when the provider was found
+	FoundAfter time.Duration
+	// ConnectedAfter is when the provider was connected to
+	ConnectedAfter time.Duration
+	// ReceivedBlockAfter is when the provider sent the block
+	ReceivedBlockAfter time.Duration
+	Error              string
+}
+
+// GatewayRetrievalOutput is the result of retrieving a block the way a public
+// gateway does, telling whether the gateway would have served it in time
+type GatewayRetrievalOutput struct {
+	// Retrieved is whether a provider sent the block within Timeout, and
+	// Provider the first one that did
+	Retrieved bool
+	Provider  string
+	Timeout   time.Duration
+	// Duration is how long the retrieval took, until the block was received
+	// or the retrieval gave up
+	Duration time.Duration
+	// Providers are the providers the block was requested from, in the order
+	// they were found
+	Providers []GatewayProviderOutput
+	// Error is why the block was not retrieved
+	Error string
+	// Denylists tells whether the CID is in the public denylists configured on
+	// the ipfs-check server. A gateway using one that lists it refuses the
+	// CID even if it was retrieved.
+	Denylists []DenylistOutput
+	// CachedAt is when the result was computed if it was served from a cache,
+	// nil for fresh results
+	CachedAt *time.Time
+	// CheckerInfo is the vantage point of the checker that ran the check
+	CheckerInfo *CheckerInfoOutput
+}
+
+// SimulateGatewayRetrieval retrieves the root block of c the way a public
+// gateway does: providers are looked up in the DHT and IPNI concurrently, and
+// the block is requested over Bitswap from each provider as soon as it is
+// found, in parallel, until one sends it or GatewayTimeout elapses. Unlike
+// CheckCID, the providers are not otherwise checked.
+func (ck *Checker) SimulateGatewayRetrieval(ctx context.Context, c cid.Cid, opts Options) (*GatewayRetrievalOutput, error) {
+	if ck.denylist.deniesCID(c) {
+		return nil, ErrDeniedCID
+	}
+	opts = opts.withDefaults()
+	crClient, err := client.New(opts.IPNIIndexer,
+		client.WithStreamResultsRequired(),
+		client.WithProtocolFilter(defaultProtocolFilter),
+		client.WithDisabledLocalFiltering(false),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create content router client: %w", err)
+	}
+
+	start := time.Now()
+	gwCtx, cancel := context.WithTimeout(ctx, GatewayTimeout)
+	defer cancel()
+	dhtProvsCh := ck.routing().FindProvidersAsync(gwCtx, c, maxProviderCandidates)
+	ipniProvsCh := contentrouter.NewContentRoutingClient(crClient).FindProvidersAsync(gwCtx, c, maxProviderCandidates)
+
+	out := &GatewayRetrievalOutput{Timeout: GatewayTimeout, Providers: []GatewayProviderOutput{}, Denylists: ck.lookupPublicDenylists(c), CheckerInfo: ck.CheckerInfo()}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	retrieve := func(provider peer.AddrInfo, src string) {
+		defer wg.Done()
+		p := ck.retrieveFromProvider(gwCtx, provider, src, c, start, opts)
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case p.Error == "" && !out.Retrieved:
+			out.Retrieved = true
+			out.Provider = p.ID
+			out.Duration = p.ReceivedBlockAfter
+			// Like a gateway, stop the other retrievals
+			cancel()
+		case p.Error != "" && out.Retrieved:
+			p.Error = errRetrievedElsewhere
+		}
+		out.Providers = append(out.Providers, p)
+	}
+
+	seen := make(map[peer.ID]struct{})
+	for dhtProvsCh != nil || ipniProvsCh != nil {
+		var provider peer.AddrInfo
+		var open bool
+		var source string
+		select {
+		case provider, open = <-dhtProvsCh:
+			if !open {
+				dhtProvsCh = nil
+				continue
+			}
+			source = DHTSource
+		case provider, open = <-ipniProvsCh:
+			if !open {
+				ipniProvsCh = nil
+				continue
+			}
+			source = IPNISource
+		}
+		if _, ok := seen[provider.ID]; ok {
+			continue
+		}
+		seen[provider.ID] = struct{}{}
+		wg.Add(1)
+		go retrieve(provider, source)
+	}
+	wg.Wait()
+
+	slices.SortFunc(out.Providers, func(a, b GatewayProviderOutput) int {
+		return cmp.Compare(a.FoundAfter, b.FoundAfter)
+	})
+	if !out.Retrieved {
+		out.Duration = time.Since(start)
+		switch {
+		case ctx.Err() != nil:
+			out.Error = fmt.Sprintf("the check timed out after %s, before the %s gateway timeout", out.Duration.Round(time.Second), GatewayTimeout)
+		case len(out.Providers) == 0:
+			out.Error = "no providers were found in the DHT or IPNI"
+		default:
+			out.Error = fmt.Sprintf("none of the %d providers found sent the block within the %s gateway timeout", len(out.Providers), GatewayTimeout)
+		}
+	}
+	return out, nil
+}
+
+// retrieveFromProvider connects to provider and requests c from it over
+// Bitswap until it is received or ctx ends
+func (ck *Checker) retrieveFromProvider(ctx context.Context, provider peer.AddrInfo, src string, c cid.Cid, start time.Time, opts Options) GatewayProviderOutput {
+	out := GatewayProviderOutput{ID: provider.ID.String(), Source: src, FoundAfter: time.Since(start)}
+	if ck.denylist.deniesPeer(provider.ID) {
+		out.Error = ErrDeniedPeer.Error()
+		return out
+	}
+	if len(provider.Addrs) == 0 {
+		// Like gateways, look the addresses of the provider up in the DHT
+		if ai, err := ck.timedRouting().FindPeer(ctx, provider.ID); err == nil {
+			provider.Addrs = ai.Addrs
+		}
+	}
+	if provider.Addrs, _ = ck.filterAddrs(provider.Addrs); len(provider.Addrs) == 0 {
+		out.Error = "no allowed addresses of the provider were found"
+		return out
+	}
+
+	testHost, err := ck.connectTestHost(ctx, provider, opts.ProviderDialTimeout)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	defer testHost.Close()
+	out.ConnectedAfter = time.Since(start)
+
+	// The fetcher gives up when ctx ends, as the gateway would
+	f := newBlockFetcher(testHost, provider.ID, GatewayTimeout)
+	defer f.close()
+	if _, err := f.fetch(ctx, c); err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.ReceivedBlockAfter = time.Since(start)
+	return out
+}
@@ -0,0 +1,151 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP annotates IP addresses with their country and autonomous system,
+// using local MaxMind databases, e.g. GeoLite2-Country and GeoLite2-ASN
+type GeoIP struct {
+	country ipLookup
+	asn     ipLookup
+	closers []io.Closer
+}
+
+// ipLookup finds the record of an IP address in a MaxMind database
+type ipLookup interface {
+	Lookup(ip net.IP, result any) error
+}
+
+// OpenGeoIP opens the MaxMind databases of the countries and of the
+// autonomous systems of IP addresses, either of which can be empty
+func OpenGeoIP(countryDB, asnDB string) (*GeoIP, error) {
+	g := &GeoIP{}
+	for _, db := range []struct {
+		path   string
+		lookup *ipLookup
+	}{{countryDB, &g.country}, {asnDB, &g.asn}} {
+		if db.path == "" {
+			continue
+		}
+		r, err := maxminddb.Open(db.path)
+		if err != nil {
+			_ = g.Close()
+			return nil, fmt.Errorf("opening GeoIP database %s: %w", db.path, err)
+		}
+		*db.lookup = r
+		g.closers = append(g.closers, r)
+	}
+	return g, nil
+}
+
+// Close closes the databases
+func (g *GeoIP) Close() error {
+	var errs []error
+	for _, c := range g.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// AddrLocation tells where the IP address of a multiaddr is
+type AddrLocation struct {
+	Addr string
+	// Country is the ISO 3166-1 alpha-2 code of the country of the IP
+	// address, empty if unknown
+	Country string
+	// ASN is the number of the autonomous system of the IP address, 0 if
+	// unknown, and ASOrg the organization running it
+	ASN   uint
+	ASOrg string
+}
+
+// locate returns the location of the IP addresses among addrs that are in
+// the databases. Relay addresses are skipped, their IP address being the
+// relay's.
+func (g *GeoIP) locate(addrs []multiaddr.Multiaddr) []AddrLocation {
+	if g == nil {
+		return nil
+	}
+	out := []AddrLocation{}
+	for _, a := range addrs {
+		if isRelayAddr(a) {
+			continue
+		}
+		ip := addrIP(a)
+		if ip == nil {
+			continue
+		}
+		loc := AddrLocation{Addr: a.String()}
+		if g.country != nil {
+			var rec struct {
+				Country struct {
+					ISOCode string `maxminddb:"iso_code"`
+				} `maxminddb:"country"`
+				RegisteredCountry struct {
+					ISOCode string `maxminddb:"iso_code"`
+				} `maxminddb:"registered_country"`
+			}
+			if err := g.country.Lookup(ip, &rec); err == nil {
+				loc.Country = rec.Country.ISOCode
+				if loc.Country == "" {
+					loc.Country = rec.RegisteredCountry.ISOCode
+				}
+			}
+		}
+		loc.ASN, loc.ASOrg = g.lookupASN(ip)
+		if loc.Country != "" || loc.ASN != 0 {
+			out = append(out, loc)
+		}
+	}
+	return out
+}
+
+// lookupASN returns the number of the autonomous system of ip and the
+// organization running it, 0 if unknown
+func (g *GeoIP) lookupASN(ip net.IP) (uint, string) {
+	if g == nil || g.asn == nil {
+		return 0, ""
+	}
+	var rec struct {
+		Number uint   `maxminddb:"autonomous_system_number"`
+		Org    string `maxminddb:"autonomous_system_organization"`
+	}
+	if err := g.asn.Lookup(ip, &rec); err != nil {
+		return 0, ""
+	}
+	return rec.Number, rec.Org
+}
+
+// locateResolved returns the location of addrs and of the addresses their DNS
+// components resolved to
+func (g *GeoIP) locateResolved(addrs []multiaddr.Multiaddr, resolutions []DNSResolutionOutput) []AddrLocation {
+	if g == nil {
+		return nil
+	}
+	all := append([]multiaddr.Multiaddr{}, addrs...)
+	for _, res := range resolutions {
+		for _, r := range res.Resolved {
+			if ma, err := multiaddr.NewMultiaddr(r); err == nil {
+				all = append(all, ma)
+			}
+		}
+	}
+	return g.locate(all)
+}
+
+// addrIP returns the IP address of a, nil if it has none
+func addrIP(a multiaddr.Multiaddr) net.IP {
+	for _, code := range []int{multiaddr.P_IP4, multiaddr.P_IP6} {
+		if v, err := a.ValueForProtocol(code); err == nil {
+			return net.ParseIP(v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package check
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLookup is an in-memory MaxMind database, mapping IP addresses to their
+// records, keyed by the maxminddb tags of the decoded fields
+type fakeLookup map[string]map[string]any
+
+func (f fakeLookup) Lookup(ip net.IP, result any) error {
+	rec, ok := f[ip.String()]
+	if !ok {
+		return errors.New("not found")
+	}
+	decodeRecord(rec, reflect.ValueOf(result).Elem())
+	return nil
+}
+
+func decodeRecord(rec map[string]any, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		val, ok := rec[v.Type().Field(i).Tag.Get("maxminddb")]
+		if !ok {
+			continue
+		}
+		if nested, ok := val.(map[string]any); ok {
+			decodeRecord(nested, v.Field(i))
+		} else {
+			v.Field(i).Set(reflect.ValueOf(val))
+		}
+	}
+}
+
+func TestGeoIPLocate(t *testing.T) {
+	g := &GeoIP{
+		country: fakeLookup{
+			"1.2.3.4": {"country": map[string]any{"iso_code": "FR"}},
+			"2001:db8::1": {
+				"country":            map[string]any{},
+				"registered_country": map[string]any{"iso_code": "DE"},
+			},
+		},
+		asn: fakeLookup{
+			"1.2.3.4":     {"autonomous_system_number": uint(64500), "autonomous_system_organization": "Example Cloud"},
+			"5.6.7.8":     {"autonomous_system_number": uint(64501)},
+			"10.0.0.1":    {"autonomous_system_number": uint(64502)},
+			"2001:db8::1": {"autonomous_system_number": uint(64503)},
+		},
+	}
+	addrs := []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001"),
+		multiaddr.StringCast("/ip6/2001:db8::1/udp/4001/quic-v1"),
+		multiaddr.StringCast("/ip4/9.9.9.9/tcp/4001"),
+		multiaddr.StringCast("/ip4/10.0.0.1/tcp/4001/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK/p2p-circuit"),
+		multiaddr.StringCast("/dns4/example.com/tcp/4001"),
+	}
+	resolutions := []DNSResolutionOutput{{Addr: "/dns4/example.com/tcp/4001", Resolved: []string{"/ip4/5.6.7.8/tcp/4001"}}}
+
+	require.Equal(t, []AddrLocation{
+		{Addr: "/ip4/1.2.3.4/tcp/4001", Country: "FR", ASN: 64500, ASOrg: "Example Cloud"},
+		{Addr: "/ip6/2001:db8::1/udp/4001/quic-v1", Country: "DE", ASN: 64503},
+		{Addr: "/ip4/5.6.7.8/tcp/4001", ASN: 64501},
+	}, g.locateResolved(addrs, resolutions), "unknown IPs, relay addresses and DNS addresses are skipped")
+
+	var disabled *GeoIP
+	require.Nil(t, disabled.locateResolved(addrs, resolutions))
+}
+
+func TestOpenGeoIP(t *testing.T) {
+	g, err := OpenGeoIP("", "")
+	require.NoError(t, err)
+	require.NoError(t, g.Close())
+
+	_, err = OpenGeoIP(filepath.Join(t.TempDir(), "missing.mmdb"), "")
+	require.ErrorContains(t, err, "missing.mmdb")
+}
@@ -0,0 +1,99 @@
+package check
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/sec"
+)
+
+// Stages of the connection upgrade a dial can fail at, see
+// AddrDialOutput.HandshakeFailure
+const (
+	HandshakeSecurity = "security"
+	HandshakeMuxer    = "muxer"
+)
+
+// ConnectionStateOutput is what was negotiated on a connection to a peer
+type ConnectionStateOutput struct {
+	Addr      string
+	Transport string
+	// Security is the security protocol, e.g. /tls/1.0.0 (TLS 1.3) or /noise,
+	// and Muxer the stream multiplexer, e.g. /yamux/1.0.0 or /mplex/6.7.0.
+	// Both are empty for transports with built-in security and streams, i.e.
+	// QUIC, WebTransport and WebRTC Direct.
+	Security string
+	Muxer    string
+	// HandshakeDuration is the time from the start of the dial to the end of
+	// the upgrade of the connection, i.e. the transport dial followed by the
+	// security and muxer handshakes, or the built-in handshake of QUIC,
+	// WebTransport and WebRTC Direct
+	HandshakeDuration time.Duration
+}
+
+// connectionStates returns what was negotiated on each of conns, which were
+// dialed from dialStart
+func connectionStates(conns []network.Conn, dialStart time.Time) []ConnectionStateOutput {
+	var out []ConnectionStateOutput
+	for _, c := range conns {
+		out = append(out, connectionState(c, dialStart))
+	}
+	return out
+}
+
+func connectionState(c network.Conn, dialStart time.Time) ConnectionStateOutput {
+	state := c.ConnState()
+	return ConnectionStateOutput{
+		Addr:      c.RemoteMultiaddr().String(),
+		Transport: state.Transport,
+		Security:  string(state.Security),
+		Muxer:     string(state.StreamMultiplexer),
+		// The swarm sets Opened once the connection is upgraded
+		HandshakeDuration: max(c.Stat().Opened.Sub(dialStart), 0),
+	}
+}
+
+// handshakeFailure returns the stage of the connection upgrade a dial error
+// comes from, empty if the dial did not fail during the upgrade. The
+// upgrader of libp2p does not export these errors, so they are matched by
+// their message.
+func handshakeFailure(dialErr string) string {
+	switch {
+	case strings.Contains(dialErr, "failed to negotiate security protocol"):
+		return HandshakeSecurity
+	case strings.Contains(dialErr, "failed to negotiate stream multiplexer"):
+		return HandshakeMuxer
+	}
+	return ""
+}
+
+// PeerIDMismatchOutput tells that a dialed address is served by another peer
+// than the one expected, e.g. because of a stale DNS record or a reused IP
+// address
+type PeerIDMismatchOutput struct {
+	Expected string
+	Actual   string
+}
+
+// peerIDMismatchMessage matches the message of sec.ErrPeerIDMismatch, for the
+// transports that do not wrap it, e.g. QUIC
+var peerIDMismatchMessage = regexp.MustCompile(`peer id mismatch: expected (\S+), but remote key matches (\S+)`)
+
+// peerIDMismatch returns the expected and actual peer IDs if a dial failed
+// because the address is served by another peer, nil otherwise
+func peerIDMismatch(dialErr error) *PeerIDMismatchOutput {
+	if dialErr == nil {
+		return nil
+	}
+	var mismatch sec.ErrPeerIDMismatch
+	if errors.As(dialErr, &mismatch) {
+		return &PeerIDMismatchOutput{Expected: mismatch.Expected.String(), Actual: mismatch.Actual.String()}
+	}
+	if m := peerIDMismatchMessage.FindStringSubmatch(dialErr.Error()); m != nil {
+		return &PeerIDMismatchOutput{Expected: m[1], Actual: m[2]}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	libp2ptls "github.com/libp2p/go-libp2p/p2p/security/tls"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshake(t *testing.T) {
+	newHost := func(security libp2p.Option) peer.AddrInfo {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), security)
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		return peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	}
+	noiseOnly := newHost(libp2p.Security(noise.ID, noise.New))
+	tlsOnly := newHost(libp2p.Security(libp2ptls.ID, libp2ptls.New))
+
+	h, err := libp2p.New(libp2p.NoListenAddrs, libp2p.Security(noise.ID, noise.New))
+	require.NoError(t, err)
+	defer h.Close()
+
+	start := time.Now()
+	require.NoError(t, h.Connect(context.Background(), noiseOnly))
+	elapsed := time.Since(start)
+	states := connectionStates(h.Network().ConnsToPeer(noiseOnly.ID), start)
+	require.Len(t, states, 1)
+	require.Equal(t, "tcp", states[0].Transport)
+	require.Equal(t, string(noise.ID), states[0].Security)
+	require.Equal(t, "/yamux/1.0.0", states[0].Muxer)
+	require.Positive(t, states[0].HandshakeDuration)
+	require.LessOrEqual(t, states[0].HandshakeDuration, elapsed)
+
+	err = h.Connect(context.Background(), tlsOnly)
+	require.Error(t, err)
+	require.Equal(t, HandshakeSecurity, handshakeFailure(err.Error()))
+	require.Empty(t, handshakeFailure("dial tcp 127.0.0.1:1: connect: connection refused"))
+}
+
+func TestPeerIDMismatch(t *testing.T) {
+	target, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/udp/0/quic-v1"))
+	require.NoError(t, err)
+	defer target.Close()
+	other, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer other.Close()
+
+	for _, addr := range target.Addrs() {
+		h, err := libp2p.New(libp2p.NoListenAddrs)
+		require.NoError(t, err)
+		// Dial the address of target expecting the other peer
+		err = h.Connect(context.Background(), peer.AddrInfo{ID: other.ID(), Addrs: []multiaddr.Multiaddr{addr}})
+		h.Close()
+		require.Error(t, err, addr)
+		require.Equal(t, &PeerIDMismatchOutput{Expected: other.ID().String(), Actual: target.ID().String()}, peerIDMismatch(err), addr)
+	}
+
+	require.Nil(t, peerIDMismatch(nil))
+	require.Nil(t, peerIDMismatch(errors.New("dial tcp 127.0.0.1:1: connect: connection refused")))
+}
@@ -0,0 +1,149 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// httpMaxBlockSize bounds the size of the blocks downloaded from HTTP
+// providers, which is the maximum block size of Bitswap
+const httpMaxBlockSize = 2 << 20
+
+// HTTPCheckOutput is the result of requesting the block from a provider over
+// HTTP, with the trustless gateway protocol
+type HTTPCheckOutput struct {
+	// URL is the URL the block was last requested from
+	URL string
+	// StatusCode is the status of the last response, 0 without response
+	StatusCode int
+	// Found is whether the provider sent the block, and it matched the CID
+	Found    bool
+	Duration time.Duration
+	Error    string
+}
+
+// httpProviderClient downloads blocks from the HTTP providers found in IPNI.
+// Like the libp2p host, it does not connect to private addresses.
+var httpProviderClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: 15 * time.Second, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+	},
+}
+
+// dialPublicOnly refuses connections to non-public addresses, so the
+// addresses in IPNI records can not make the checker query private services
+func dialPublicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if addr, err := manet.FromIP(ip); err == nil && manet.IsPublicAddr(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("refusing to connect to the non-public address %s", host)
+}
+
+// httpProviderURL returns the base URL of an /http, /https or /tls/http address
+func httpProviderURL(addr multiaddr.Multiaddr) (string, bool) {
+	var host, port, scheme string
+	multiaddr.ForEach(addr, func(c multiaddr.Component) bool {
+		switch c.Protocol().Code {
+		case multiaddr.P_IP4, multiaddr.P_DNS, multiaddr.P_DNS4, multiaddr.P_DNS6:
+			host = c.Value()
+		case multiaddr.P_IP6:
+			host = "[" + c.Value() + "]"
+		case multiaddr.P_TCP:
+			port = c.Value()
+		case multiaddr.P_TLS, multiaddr.P_HTTPS:
+			scheme = "https"
+		case multiaddr.P_HTTP:
+			if scheme == "" {
+				scheme = "http"
+			}
+		}
+		return true
+	})
+	if host == "" || scheme == "" {
+		return "", false
+	}
+	if port != "" && !(scheme == "https" && port == "443") && !(scheme == "http" && port == "80") {
+		host += ":" + port
+	}
+	return scheme + "://" + host, true
+}
+
+// checkHTTPRetrieval requests c as a raw block from each of the HTTP
+// addresses of the provider until one of them sends it. Received blocks are
+// hash-verified.
+func checkHTTPRetrieval(ctx context.Context, client *http.Client, addrs []multiaddr.Multiaddr, c cid.Cid, timeout time.Duration) *HTTPCheckOutput {
+	out := &HTTPCheckOutput{}
+	start := time.Now()
+	defer func() { out.Duration = time.Since(start) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for _, addr := range addrs {
+		base, ok := httpProviderURL(addr)
+		if !ok {
+			continue
+		}
+		out.URL = base + "/ipfs/" + c.String() + "?format=raw"
+		out.StatusCode = 0
+		out.Error = ""
+		if err := fetchHTTPBlock(ctx, client, out, c); err != nil {
+			out.Error = err.Error()
+			continue
+		}
+		out.Found = true
+		return out
+	}
+	if out.URL == "" {
+		out.Error = "the provider has no HTTP address"
+	}
+	return out
+}
+
+// fetchHTTPBlock requests the raw block c from out.URL
+func fetchHTTPBlock(ctx context.Context, client *http.Client, out *HTTPCheckOutput, c cid.Cid) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, out.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.raw")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	out.StatusCode = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the provider answered with status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxBlockSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > httpMaxBlockSize {
+		return fmt.Errorf("the provider sent more than %d bytes, the maximum size of a block", httpMaxBlockSize)
+	}
+	b, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return err
+	}
+	return verifyBlock(b)
+}
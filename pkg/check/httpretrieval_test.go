@@ -0,0 +1,75 @@
+package check
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPProviderURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		"/dns4/example.com/tcp/443/https":    "https://example.com",
+		"/dns/example.com/tcp/8443/tls/http": "https://example.com:8443",
+		"/ip4/1.2.3.4/tcp/80/http":           "http://1.2.3.4",
+		"/ip6/2001:db8::1/tcp/8080/http":     "http://[2001:db8::1]:8080",
+	} {
+		u, ok := httpProviderURL(multiaddr.StringCast(addr))
+		require.True(t, ok, addr)
+		require.Equal(t, want, u, addr)
+	}
+	_, ok := httpProviderURL(multiaddr.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1"))
+	require.False(t, ok)
+}
+
+func TestCheckHTTPRetrieval(t *testing.T) {
+	data := []byte(t.Name())
+	mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	c := cid.NewCidV1(cid.Raw, mh)
+
+	body := data
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/vnd.ipld.raw", r.Header.Get("Accept"))
+		if r.URL.Path != "/ipfs/"+c.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+	addr, err := manet.FromNetAddr(srv.Listener.Addr())
+	require.NoError(t, err)
+	addrs := []multiaddr.Multiaddr{addr.Encapsulate(multiaddr.StringCast("/http"))}
+
+	out := checkHTTPRetrieval(context.Background(), srv.Client(), addrs, c, time.Second)
+	require.True(t, out.Found)
+	require.Equal(t, http.StatusOK, out.StatusCode)
+	require.Equal(t, srv.URL+"/ipfs/"+c.String()+"?format=raw", out.URL)
+	require.Empty(t, out.Error)
+
+	body = []byte("not the block")
+	out = checkHTTPRetrieval(context.Background(), srv.Client(), addrs, c, time.Second)
+	require.False(t, out.Found)
+	require.Contains(t, out.Error, "does not match the CID")
+
+	out = checkHTTPRetrieval(context.Background(), srv.Client(), addrs, cid.NewCidV1(cid.DagProtobuf, mh), time.Second)
+	require.False(t, out.Found)
+	require.Equal(t, http.StatusNotFound, out.StatusCode)
+
+	out = checkHTTPRetrieval(context.Background(), srv.Client(), []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1")}, c, time.Second)
+	require.False(t, out.Found)
+	require.Equal(t, "the provider has no HTTP address", out.Error)
+
+	// IPNI records can not make the checker query private services
+	out = checkHTTPRetrieval(context.Background(), httpProviderClient, addrs, c, time.Second)
+	require.False(t, out.Found)
+	require.Contains(t, out.Error, "refusing to connect to the non-public address 127.0.0.1")
+}
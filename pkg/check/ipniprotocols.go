@@ -0,0 +1,195 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/ipfs/boxo/routing/http/client"
+	"github.com/ipfs/boxo/routing/http/types"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Retrieval protocols advertised in the metadata of IPNI records
+const (
+	ProtocolBitswap   = "transport-bitswap"
+	ProtocolHTTP      = "transport-ipfs-gateway-http"
+	ProtocolGraphsync = "transport-graphsync-filecoinv1"
+)
+
+// ProtocolCheckOutput compares a retrieval protocol the provider advertises
+// in IPNI with what it actually serves the block over
+type ProtocolCheckOutput struct {
+	Protocol   string
+	Advertised bool
+	// Probed is whether the block was requested with the protocol, as
+	// ipfs-check can not retrieve blocks with every protocol, e.g. Graphsync
+	Probed bool
+	// Working is whether the provider sent the block over the protocol
+	Working bool
+	Error   string
+}
+
+// ipniProtocols are the retrieval protocols advertised by the providers
+// found in IPNI
+type ipniProtocols struct {
+	mu        sync.Mutex
+	protocols map[peer.ID][]string
+	// graphsync is the metadata of the Graphsync records, by provider
+	graphsync map[peer.ID]json.RawMessage
+}
+
+// add adds the protocols of a record of id, with its extra fields holding
+// the metadata of each protocol
+func (p *ipniProtocols) add(id peer.ID, protocols []string, extra map[string]json.RawMessage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.protocols[id] = append(p.protocols[id], protocols...)
+	if md, ok := extra[ProtocolGraphsync]; ok {
+		p.graphsync[id] = md
+	}
+}
+
+// graphsyncMetadata returns the metadata of the Graphsync record of id, nil
+// if it has none
+func (p *ipniProtocols) graphsyncMetadata(id peer.ID) json.RawMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.graphsync[id]
+}
+
+// get returns the protocols advertised by id, and whether it was found in IPNI
+func (p *ipniProtocols) get(id peer.ID) ([]string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	protocols, ok := p.protocols[id]
+	return slices.Clone(protocols), ok
+}
+
+// findIPNIProvidersAsync is the FindProvidersAsync of the content router of
+// crClient, which also keeps the retrieval protocols of the records
+func findIPNIProvidersAsync(ctx context.Context, crClient *client.Client, c cid.Cid) (<-chan peer.AddrInfo, *ipniProtocols) {
+	protocols := &ipniProtocols{protocols: make(map[peer.ID][]string), graphsync: make(map[peer.ID]json.RawMessage)}
+	ch := make(chan peer.AddrInfo)
+	results, err := crClient.FindProviders(ctx, c)
+	if err != nil {
+		log.Printf("Error finding providers in IPNI: %v\n", err)
+		close(ch)
+		return ch, protocols
+	}
+
+	go func() {
+		defer close(ch)
+		defer results.Close()
+		for results.Next() {
+			res := results.Val()
+			if res.Err != nil {
+				continue
+			}
+			var ai peer.AddrInfo
+			var advertised []string
+			var extra map[string]json.RawMessage
+			var addrs []types.Multiaddr
+			switch r := res.Val.(type) {
+			case *types.PeerRecord:
+				if r.ID == nil {
+					continue
+				}
+				ai.ID, addrs, advertised, extra = *r.ID, r.Addrs, r.Protocols, r.Extra
+			case *types.BitswapRecord: //lint:ignore SA1019 // legacy records
+				if r.ID == nil {
+					continue
+				}
+				ai.ID, addrs, advertised = *r.ID, r.Addrs, []string{r.Protocol}
+			default:
+				continue
+			}
+			for _, a := range addrs {
+				ai.Addrs = append(ai.Addrs, a.Multiaddr)
+			}
+			protocols.add(ai.ID, advertised, extra)
+
+			select {
+			case ch <- ai:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, protocols
+}
+
+// checkRetrievalProtocols requests the block over HTTP from the provider
+// found in IPNI if it advertises it, then compares the protocols it
+// advertises with the ones it served the block over
+func (ck *Checker) checkRetrievalProtocols(ctx context.Context, out *ProviderOutput, provider peer.AddrInfo, advertised []string, c cid.Cid, opts Options) {
+	if slices.Contains(advertised, ProtocolHTTP) {
+		target := c
+		if len(opts.Path) > 0 {
+			// The path is resolved with the blocks the provider sent over Bitswap
+			target = cid.Undef
+			if out.PathResolution != nil {
+				target, _ = cid.Decode(out.PathResolution.ResolvedCID)
+			}
+		}
+		if target.Defined() {
+			addrs := ck.denylist.filterAddrs(httpAddrs(provider.Addrs), ck.geoIP)
+			out.DataAvailableOverHTTP = checkHTTPRetrieval(ctx, httpProviderClient, addrs, target, opts.BitswapTimeout)
+		} else {
+			out.DataAvailableOverHTTP = &HTTPCheckOutput{Error: "the path could not be resolved with the blocks sent over Bitswap"}
+		}
+	}
+	out.RetrievalProtocols = retrievalProtocols(advertised, out)
+}
+
+// retrievalProtocols compares the protocols advertised by the provider with
+// the ones it served the block over in its check out. Bitswap is reported
+// when it works even if it is not advertised.
+func retrievalProtocols(advertised []string, out *ProviderOutput) []ProtocolCheckOutput {
+	var protocols []ProtocolCheckOutput
+	for _, p := range advertised {
+		if !slices.ContainsFunc(protocols, func(o ProtocolCheckOutput) bool { return o.Protocol == p }) {
+			protocols = append(protocols, ProtocolCheckOutput{Protocol: p, Advertised: true})
+		}
+	}
+	if !slices.Contains(advertised, ProtocolBitswap) && out.ConnectionError == "" && out.DataAvailableOverBitswap.Found {
+		protocols = append(protocols, ProtocolCheckOutput{Protocol: ProtocolBitswap})
+	}
+
+	for i := range protocols {
+		p := &protocols[i]
+		switch p.Protocol {
+		case ProtocolBitswap:
+			p.Probed = true
+			p.Working = out.ConnectionError == "" && out.DataAvailableOverBitswap.Found
+			if p.Error = out.ConnectionError; p.Error == "" && !p.Working {
+				p.Error = out.DataAvailableOverBitswap.Error
+				if p.Error == "" {
+					p.Error = "the provider does not have the block"
+				}
+			}
+		case ProtocolHTTP:
+			if http := out.DataAvailableOverHTTP; http != nil {
+				p.Probed = true
+				p.Working = http.Found
+				p.Error = http.Error
+			}
+		}
+	}
+	return protocols
+}
+
+// httpAddrs returns the addresses of addrs served over HTTP
+func httpAddrs(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	var out []multiaddr.Multiaddr
+	for _, a := range addrs {
+		if _, ok := httpProviderURL(a); ok {
+			out = append(out, a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/boxo/routing/http/client"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindIPNIProvidersAsync(t *testing.T) {
+	const httpProvider = "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK"
+	const bitswapProvider = "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintf(w, `{"Schema":"peer","ID":%q,"Addrs":["/dns4/example.com/tcp/443/https"],"Protocols":[%q]}`+"\n", httpProvider, ProtocolHTTP)
+		fmt.Fprintf(w, `{"Schema":"peer","ID":%q,"Addrs":["/ip4/1.2.3.4/tcp/4001"],"Protocols":[%q,%q]}`+"\n", bitswapProvider, ProtocolBitswap, ProtocolGraphsync)
+	}))
+	defer srv.Close()
+	crClient, err := client.New(srv.URL, client.WithStreamResultsRequired())
+	require.NoError(t, err)
+
+	ch, protocols := findIPNIProvidersAsync(context.Background(), crClient, cid.MustParse("bafkqaaa"))
+	var found []peer.AddrInfo
+	for ai := range ch {
+		found = append(found, ai)
+	}
+	require.Len(t, found, 2)
+	require.Equal(t, httpProvider, found[0].ID.String())
+	require.Equal(t, "/dns4/example.com/tcp/443/https", found[0].Addrs[0].String())
+
+	advertised, ok := protocols.get(found[0].ID)
+	require.True(t, ok)
+	require.Equal(t, []string{ProtocolHTTP}, advertised)
+	advertised, ok = protocols.get(found[1].ID)
+	require.True(t, ok)
+	require.Equal(t, []string{ProtocolBitswap, ProtocolGraphsync}, advertised)
+}
+
+func TestRetrievalProtocols(t *testing.T) {
+	require.Equal(t, []ProtocolCheckOutput{
+		{Protocol: ProtocolHTTP, Advertised: true, Probed: true, Working: true},
+		{Protocol: ProtocolBitswap, Advertised: true, Probed: true, Error: "failed to dial"},
+		{Protocol: ProtocolGraphsync, Advertised: true},
+	}, retrievalProtocols([]string{ProtocolHTTP, ProtocolBitswap, ProtocolGraphsync}, &ProviderOutput{
+		ConnectionError:       "failed to dial",
+		DataAvailableOverHTTP: &HTTPCheckOutput{Found: true},
+	}))
+
+	require.Equal(t, []ProtocolCheckOutput{
+		{Protocol: ProtocolHTTP, Advertised: true, Probed: true, Error: "the provider answered with status 404 Not Found"},
+		{Protocol: ProtocolBitswap, Probed: true, Working: true},
+	}, retrievalProtocols([]string{ProtocolHTTP}, &ProviderOutput{
+		DataAvailableOverBitswap: BitswapCheckOutput{Found: true},
+		DataAvailableOverHTTP:    &HTTPCheckOutput{Error: "the provider answered with status 404 Not Found"},
+	}), "working protocols that are not advertised are reported")
+
+	require.Equal(t, []ProtocolCheckOutput{
+		{Protocol: ProtocolBitswap, Advertised: true, Probed: true, Error: "the provider does not have the block"},
+	}, retrievalProtocols([]string{ProtocolBitswap, ProtocolBitswap}, &ProviderOutput{}))
+}
@@ -0,0 +1,250 @@
+package check
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Sources of the public key of an IPNS name
+const (
+	// PublicKeyInPeerID is for the keys inlined in the peer ID, e.g. Ed25519 keys
+	PublicKeyInPeerID = "peer ID"
+	// PublicKeyInRecord is for the keys embedded in the IPNS records
+	PublicKeyInRecord = "record"
+	// PublicKeyInDHT is for the keys fetched from the /pk/ records of the DHT
+	PublicKeyInDHT = "DHT"
+)
+
+// IPNSPublicKeyOutput tells where the public key of an IPNS name was found,
+// and whether it is the key of the name, i.e. hashes to its peer ID. Only
+// keys inlined in the peer ID need no verification.
+type IPNSPublicKeyOutput struct {
+	Source   string
+	Type     string
+	Verified bool
+	Error    string
+}
+
+// IPNSRecordOutput is one of the IPNS records of a name returned by the DHT
+// servers closest to it
+type IPNSRecordOutput struct {
+	// Value is the path the record points to
+	Value    string
+	Sequence uint64
+	EOL      time.Time
+	TTL      time.Duration
+	Expired  bool
+	// SignatureValid is whether the record is signed by the key of the name.
+	// Error is why the record is invalid, including expired records.
+	SignatureValid bool
+	Error          string
+	// Servers are the DHT servers holding the record
+	Servers []string
+}
+
+// IPNSCheckOutput is the result of checking the IPNS records of a name whose
+// key is a peer ID
+type IPNSCheckOutput struct {
+	Name      string
+	PublicKey IPNSPublicKeyOutput
+	// ClosestPeers is the number of DHT servers closest to the name found, and
+	// Responded the number of them that answered GET_VALUE
+	ClosestPeers int
+	Responded    int
+	// Records are the distinct records held by the servers, highest sequence
+	// number first
+	Records []IPNSRecordOutput
+	// Conflicting is whether the valid, unexpired records disagree on the
+	// value or sequence number, so resolving the name depends on the servers
+	// queried
+	Conflicting bool
+	Duration    time.Duration
+	Error       string
+}
+
+// dhtValues are the values of a key held by the DHT servers closest to it
+type dhtValues struct {
+	closestPeers int
+	responded    int
+	// servers are the servers holding each value
+	servers map[string][]peer.ID
+}
+
+// CheckIPNS asks each of the DHT servers closest to name for its IPNS record,
+// then validates the records against the public key of the name
+func (ck *Checker) CheckIPNS(ctx context.Context, name ipns.Name) (*IPNSCheckOutput, error) {
+	if ck.denylist.deniesPeer(name.Peer()) {
+		return nil, ErrDeniedPeer
+	}
+
+	start := time.Now()
+	out := &IPNSCheckOutput{Name: name.String(), Records: []IPNSRecordOutput{}}
+	defer func() { out.Duration = time.Since(start) }()
+
+	routing := ck.timedRouting()
+	vals, err := getDHTValues(ctx, routing, ck.dhtMessenger, string(name.RoutingKey()))
+	if err != nil {
+		out.Error = err.Error()
+		return out, nil
+	}
+	out.ClosestPeers = vals.closestPeers
+	out.Responded = vals.responded
+
+	recs := make(map[string]*ipns.Record, len(vals.servers))
+	for v := range vals.servers {
+		if rec, err := ipns.UnmarshalRecord([]byte(v)); err == nil {
+			recs[v] = rec
+		}
+	}
+	var pk ic.PubKey
+	pk, out.PublicKey = ck.ipnsPublicKey(ctx, routing, name, recs)
+
+	for v, servers := range vals.servers {
+		r := ipnsRecordOutput(recs[v], pk)
+		for _, s := range servers {
+			r.Servers = append(r.Servers, s.String())
+		}
+		slices.Sort(r.Servers)
+		out.Records = append(out.Records, r)
+	}
+	slices.SortFunc(out.Records, func(a, b IPNSRecordOutput) int {
+		return cmp.Or(cmp.Compare(b.Sequence, a.Sequence), cmp.Compare(a.Servers[0], b.Servers[0]))
+	})
+	out.Conflicting = ipnsRecordsConflict(out.Records)
+	return out, nil
+}
+
+// getDHTValues asks each of the DHT servers closest to key for its value
+func getDHTValues(ctx context.Context, d DHT, messenger *dhtpb.ProtocolMessenger, key string) (*dhtValues, error) {
+	closestPeers, err := d.GetClosestPeers(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	out := &dhtValues{closestPeers: len(closestPeers), servers: make(map[string][]peer.ID)}
+
+	// Like checkRecordPropagation, wait for every server to answer or time out
+	ctx, cancel := context.WithTimeout(ctx, propagationQueryTimeout)
+	defer cancel()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, server := range closestPeers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec, _, err := messenger.GetValue(ctx, server, key)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			out.responded++
+			if rec != nil {
+				out.servers[string(rec.GetValue())] = append(out.servers[string(rec.GetValue())], server)
+			}
+		}()
+	}
+	wg.Wait()
+	return out, nil
+}
+
+// ipnsPublicKey returns the public key of name: the key inlined in its peer
+// ID, else the one embedded in its records, else its /pk/ record in the DHT.
+// The key is nil when it could not be found or does not match the name.
+func (ck *Checker) ipnsPublicKey(ctx context.Context, d DHT, name ipns.Name, recs map[string]*ipns.Record) (ic.PubKey, IPNSPublicKeyOutput) {
+	p := name.Peer()
+	if pk, err := p.ExtractPublicKey(); err == nil {
+		return pk, IPNSPublicKeyOutput{Source: PublicKeyInPeerID, Type: pk.Type().String(), Verified: true}
+	}
+	for _, rec := range recs {
+		if pk, err := rec.PubKey(); err == nil {
+			return verifyPublicKey(pk, p, PublicKeyInRecord)
+		}
+	}
+
+	vals, err := getDHTValues(ctx, d, ck.dhtMessenger, "/pk/"+string(p))
+	if err != nil {
+		return nil, IPNSPublicKeyOutput{Source: PublicKeyInDHT, Error: err.Error()}
+	}
+	var out IPNSPublicKeyOutput
+	for v := range vals.servers {
+		pk, err := ic.UnmarshalPublicKey([]byte(v))
+		if err != nil {
+			continue
+		}
+		var key ic.PubKey
+		if key, out = verifyPublicKey(pk, p, PublicKeyInDHT); key != nil {
+			return key, out
+		}
+	}
+	if out.Error == "" {
+		out = IPNSPublicKeyOutput{Source: PublicKeyInDHT, Error: "no DHT server returned the public key of the name"}
+	}
+	return nil, out
+}
+
+// verifyPublicKey checks that pk, found in source, hashes to p
+func verifyPublicKey(pk ic.PubKey, p peer.ID, source string) (ic.PubKey, IPNSPublicKeyOutput) {
+	out := IPNSPublicKeyOutput{Source: source, Type: pk.Type().String()}
+	if id, err := peer.IDFromPublicKey(pk); err != nil || id != p {
+		out.Error = "the public key does not match the peer ID of the name"
+		return nil, out
+	}
+	out.Verified = true
+	return pk, out
+}
+
+// ipnsRecordOutput describes rec, validated against the public key pk of its
+// name. rec is nil if it could not be decoded.
+func ipnsRecordOutput(rec *ipns.Record, pk ic.PubKey) IPNSRecordOutput {
+	var out IPNSRecordOutput
+	if rec == nil {
+		out.Error = "the record is not a valid IPNS record"
+		return out
+	}
+	if v, err := rec.Value(); err == nil {
+		out.Value = v.String()
+	}
+	out.Sequence, _ = rec.Sequence()
+	out.TTL, _ = rec.TTL()
+	if eol, err := rec.Validity(); err == nil {
+		out.EOL = eol
+		out.Expired = time.Now().After(eol)
+	}
+	if pk == nil {
+		out.Error = "the public key of the name is unknown, the signature could not be verified"
+		return out
+	}
+	if err := ipns.Validate(rec, pk); err != nil {
+		out.Error = err.Error()
+		out.SignatureValid = errors.Is(err, ipns.ErrExpiredRecord)
+		return out
+	}
+	out.SignatureValid = true
+	return out
+}
+
+// ipnsRecordsConflict returns whether the valid, unexpired records disagree
+// on the value or sequence number
+func ipnsRecordsConflict(records []IPNSRecordOutput) bool {
+	var first *IPNSRecordOutput
+	for i, r := range records {
+		if !r.SignatureValid || r.Expired {
+			continue
+		}
+		if first == nil {
+			first = &records[i]
+		} else if r.Value != first.Value || r.Sequence != first.Sequence {
+			return true
+		}
+	}
+	return false
+}
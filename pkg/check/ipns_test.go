@@ -0,0 +1,79 @@
+package check
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPNSRecordOutput(t *testing.T) {
+	sk, pk, err := ic.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	value := path.FromCid(cid.MustParse("bafkqaaa"))
+
+	rec, err := ipns.NewRecord(sk, value, 7, time.Now().Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	out := ipnsRecordOutput(rec, pk)
+	require.Equal(t, "/ipfs/bafkqaaa", out.Value)
+	require.Equal(t, uint64(7), out.Sequence)
+	require.Equal(t, time.Minute, out.TTL)
+	require.True(t, out.SignatureValid)
+	require.False(t, out.Expired)
+	require.Empty(t, out.Error)
+
+	expired, err := ipns.NewRecord(sk, value, 7, time.Now().Add(-time.Hour), time.Minute)
+	require.NoError(t, err)
+	out = ipnsRecordOutput(expired, pk)
+	require.True(t, out.SignatureValid)
+	require.True(t, out.Expired)
+	require.NotEmpty(t, out.Error)
+
+	_, otherPk, err := ic.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	out = ipnsRecordOutput(rec, otherPk)
+	require.False(t, out.SignatureValid, "the record is not signed by the key of the name")
+	require.NotEmpty(t, out.Error)
+
+	require.NotEmpty(t, ipnsRecordOutput(nil, pk).Error)
+}
+
+func TestVerifyPublicKey(t *testing.T) {
+	_, pk, err := ic.GenerateRSAKeyPair(2048, rand.Reader)
+	require.NoError(t, err)
+	p, err := peer.IDFromPublicKey(pk)
+	require.NoError(t, err)
+	_, otherPk, err := ic.GenerateRSAKeyPair(2048, rand.Reader)
+	require.NoError(t, err)
+
+	key, out := verifyPublicKey(pk, p, PublicKeyInDHT)
+	require.Equal(t, pk, key)
+	require.Equal(t, IPNSPublicKeyOutput{Source: PublicKeyInDHT, Type: "RSA", Verified: true}, out)
+
+	key, out = verifyPublicKey(otherPk, p, PublicKeyInDHT)
+	require.Nil(t, key)
+	require.False(t, out.Verified)
+	require.NotEmpty(t, out.Error)
+}
+
+func TestIPNSRecordsConflict(t *testing.T) {
+	valid := func(value string, seq uint64) IPNSRecordOutput {
+		return IPNSRecordOutput{Value: value, Sequence: seq, SignatureValid: true}
+	}
+
+	require.False(t, ipnsRecordsConflict(nil))
+	require.False(t, ipnsRecordsConflict([]IPNSRecordOutput{valid("/ipfs/a", 1), valid("/ipfs/a", 1)}), "records re-signed with another EOL agree")
+	require.True(t, ipnsRecordsConflict([]IPNSRecordOutput{valid("/ipfs/b", 2), valid("/ipfs/a", 1)}))
+	require.True(t, ipnsRecordsConflict([]IPNSRecordOutput{valid("/ipfs/a", 2), valid("/ipfs/b", 2)}))
+	require.False(t, ipnsRecordsConflict([]IPNSRecordOutput{
+		valid("/ipfs/a", 2),
+		{Value: "/ipfs/b", Sequence: 3},
+		{Value: "/ipfs/c", Sequence: 1, SignatureValid: true, Expired: true},
+	}), "invalid and expired records are ignored")
+}
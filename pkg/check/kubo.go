@@ -0,0 +1,161 @@
+package check
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+const (
+	KuboSource = "Kubo RPC"
+
+	// number of providers after which to stop a routing/findprovs query when
+	// looking for a specific peer
+	kuboMaxProviders = 100
+)
+
+// kuboClient queries the RPC API of a Kubo node so its view of the network
+// can be compared with the view of the checker's own libp2p host.
+type kuboClient struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+func newKuboClient(endpoint string) *kuboClient {
+	return &kuboClient{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: http.DefaultClient,
+	}
+}
+
+// KuboCheckOutput is the view of the configured Kubo node in a peer check
+type KuboCheckOutput struct {
+	// Endpoint is the Kubo RPC endpoint that was queried
+	Endpoint string
+	// ProviderRecordFromPeer is whether the Kubo node found the peer as a provider of the CID
+	ProviderRecordFromPeer bool
+	// HasBlockLocally is whether the Kubo node has the block in its own blockstore
+	HasBlockLocally bool
+	Error           string
+}
+
+func (k *kuboClient) post(ctx context.Context, command string, args url.Values) (*http.Response, error) {
+	u := fmt.Sprintf("%s/api/v0/%s?%s", k.endpoint, command, args.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, kuboError(resp)
+	}
+	return resp, nil
+}
+
+type kuboRPCError struct {
+	Message string
+}
+
+func (e *kuboRPCError) Error() string {
+	return "kubo: " + e.Message
+}
+
+func kuboError(resp *http.Response) error {
+	var rpcErr kuboRPCError
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err := json.Unmarshal(body, &rpcErr); err != nil || rpcErr.Message == "" {
+		return fmt.Errorf("kubo: unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return &rpcErr
+}
+
+// findProviders calls fn for every provider of c found by the Kubo node's
+// routing system (routing/findprovs) until fn returns false
+func (k *kuboClient) findProviders(ctx context.Context, c cid.Cid, numProviders int, fn func(peer.AddrInfo) bool) error {
+	resp, err := k.post(ctx, "routing/findprovs", url.Values{
+		"arg":           []string{c.String()},
+		"num-providers": []string{strconv.Itoa(numProviders)},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Type      routing.QueryEventType
+			Responses []*peer.AddrInfo
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return err
+		}
+		if event.Type != routing.Provider {
+			continue
+		}
+		for _, p := range event.Responses {
+			if p != nil && !fn(*p) {
+				return nil
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// hasBlockLocally returns whether the Kubo node has the block for c in its
+// blockstore (block/stat --offline)
+func (k *kuboClient) hasBlockLocally(ctx context.Context, c cid.Cid) (bool, error) {
+	resp, err := k.post(ctx, "block/stat", url.Values{
+		"arg":     []string{c.String()},
+		"offline": []string{"true"},
+	})
+	if err != nil {
+		var rpcErr *kuboRPCError
+		if errors.As(err, &rpcErr) && strings.Contains(rpcErr.Message, "not found") {
+			return false, nil
+		}
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// checkPeer returns the Kubo node's view of whether p provides c
+func (k *kuboClient) checkPeer(ctx context.Context, c cid.Cid, p peer.ID) *KuboCheckOutput {
+	out := &KuboCheckOutput{Endpoint: k.endpoint}
+
+	hasBlock, err := k.hasBlockLocally(ctx, c)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.HasBlockLocally = hasBlock
+
+	err = k.findProviders(ctx, c, kuboMaxProviders, func(prov peer.AddrInfo) bool {
+		if prov.ID == p {
+			out.ProviderRecordFromPeer = true
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKuboClient(t *testing.T) {
+	mh, err := multihash.Sum([]byte(t.Name()), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	testCid := cid.NewCidV1(cid.Raw, mh)
+	missingCid := cid.NewCidV1(cid.DagProtobuf, mh)
+
+	provider, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+	other, err := peer.Decode("12D3KooWRTUNZVyVf7KBBNZ6MRR5SYGGjKzS6xyiU5zBeY9wxomo")
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arg := r.URL.Query().Get("arg")
+		switch r.URL.Path {
+		case "/api/v0/block/stat":
+			if arg != testCid.String() {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `{"Message":"block was not found locally (offline): ipld: could not find node","Code":0,"Type":"error"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"Key":"%s","Size":5}`, arg)
+		case "/api/v0/routing/findprovs":
+			// a query event followed by a provider event
+			fmt.Fprintf(w, `{"Extra":"","ID":"%s","Responses":null,"Type":0}`+"\n", other)
+			fmt.Fprintf(w, `{"Extra":"","ID":"","Responses":[{"Addrs":["/ip4/1.2.3.4/tcp/4001"],"ID":"%s"}],"Type":4}`+"\n", provider)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	k := newKuboClient(srv.URL + "/")
+	ctx := context.Background()
+
+	out := k.checkPeer(ctx, testCid, provider)
+	require.Empty(t, out.Error)
+	require.True(t, out.HasBlockLocally)
+	require.True(t, out.ProviderRecordFromPeer)
+
+	out = k.checkPeer(ctx, missingCid, other)
+	require.Empty(t, out.Error)
+	require.False(t, out.HasBlockLocally)
+	require.False(t, out.ProviderRecordFromPeer)
+}
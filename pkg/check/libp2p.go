@@ -1,4 +1,4 @@
-package main
+package check
 
 import (
 	"github.com/libp2p/go-libp2p/core/connmgr"
@@ -6,27 +6,35 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	ma "github.com/multiformats/go-multiaddr"
-	manet "github.com/multiformats/go-multiaddr/net"
 )
 
-type privateAddrFilterConnectionGater struct{}
+// privateAddrFilterConnectionGater refuses connections with the addresses
+// refused by the address policy, private ones by default, and with the peers
+// and addresses of the denylist
+type privateAddrFilterConnectionGater struct {
+	deny  *Denylist
+	geoIP *GeoIP
+	// family is the only IP family dialed, both when empty
+	family string
+	policy AddrPolicy
+}
 
 var _ connmgr.ConnectionGater = (*privateAddrFilterConnectionGater)(nil)
 
 func (f *privateAddrFilterConnectionGater) InterceptAddrDial(_ peer.ID, addr ma.Multiaddr) (allow bool) {
-	return manet.IsPublicAddr(addr)
+	return f.policy.filter(addr) == nil && inAddrFamily(addr, f.family) && !f.deny.deniesAddr(addr, f.geoIP)
 }
 
 func (f *privateAddrFilterConnectionGater) InterceptPeerDial(p peer.ID) (allow bool) {
-	return true
+	return !f.deny.deniesPeer(p)
 }
 
 func (f *privateAddrFilterConnectionGater) InterceptAccept(connAddr network.ConnMultiaddrs) (allow bool) {
-	return manet.IsPublicAddr(connAddr.RemoteMultiaddr())
+	return f.policy.allowsIP(connAddr.RemoteMultiaddr())
 }
 
-func (f *privateAddrFilterConnectionGater) InterceptSecured(_ network.Direction, _ peer.ID, connAddr network.ConnMultiaddrs) (allow bool) {
-	return manet.IsPublicAddr(connAddr.RemoteMultiaddr())
+func (f *privateAddrFilterConnectionGater) InterceptSecured(_ network.Direction, p peer.ID, connAddr network.ConnMultiaddrs) (allow bool) {
+	return f.policy.allowsIP(connAddr.RemoteMultiaddr()) && !f.deny.deniesPeer(p)
 }
 
 func (f *privateAddrFilterConnectionGater) InterceptUpgraded(_ network.Conn) (allow bool, reason control.DisconnectReason) {
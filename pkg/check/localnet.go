@@ -0,0 +1,184 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/miekg/dns"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// ErrLocalNetworkDisabled is returned by DiscoverLocalPeers when the checker
+// is not in local network mode, see Config.LocalNetwork
+var ErrLocalNetworkDisabled = errors.New("local network mode is disabled on this ipfs-check instance")
+
+const (
+	// mdnsService is the DNS-SD service libp2p peers announce over mDNS
+	mdnsService = "_p2p._udp.local."
+	// mdnsDNSAddrPrefix prefixes the multiaddrs in the TXT records of peers
+	mdnsDNSAddrPrefix = "dnsaddr="
+	// mdnsQueryInterval is how often the query is repeated while discovering,
+	// as mDNS packets may be lost
+	mdnsQueryInterval = time.Second
+)
+
+// mdnsGroups are the multicast groups mDNS queries are sent to
+var mdnsGroups = []*net.UDPAddr{
+	{IP: net.IPv4(224, 0, 0, 251), Port: 5353},
+	{IP: net.ParseIP("ff02::fb"), Port: 5353},
+}
+
+// LocalPeerOutput is a peer of the local network that answered an mDNS query
+type LocalPeerOutput struct {
+	PeerID string
+	Addrs  []string
+}
+
+// LocalPeersOutput are the peers discovered on the local network
+type LocalPeersOutput struct {
+	Peers []LocalPeerOutput
+}
+
+// DiscoverLocalPeers looks for libp2p peers on the local network with mDNS
+// until ctx is done, the way Kubo and other libp2p nodes discover each other
+// on a LAN. Their addresses are added to the peerstore, so they can be
+// checked right away. It returns ErrLocalNetworkDisabled unless the checker
+// is in local network mode.
+func (ck *Checker) DiscoverLocalPeers(ctx context.Context) (*LocalPeersOutput, error) {
+	if !ck.localNetwork {
+		return nil, ErrLocalNetworkDisabled
+	}
+	found, err := mdnsDiscover(ctx, mdnsGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &LocalPeersOutput{Peers: []LocalPeerOutput{}}
+	for _, ai := range found {
+		if ai.ID == ck.h.ID() {
+			continue
+		}
+		ck.h.Peerstore().AddAddrs(ai.ID, ai.Addrs, time.Hour)
+		p := LocalPeerOutput{PeerID: ai.ID.String(), Addrs: []string{}}
+		for _, a := range ai.Addrs {
+			p.Addrs = append(p.Addrs, a.String())
+		}
+		out.Peers = append(out.Peers, p)
+	}
+	return out, nil
+}
+
+// mdnsDiscover sends the mDNS query of libp2p peers to groups until ctx is
+// done, and returns the peers of the answers, sorted by ID. Answers are
+// requested by unicast, so they are received on the socket of the query.
+func mdnsDiscover(ctx context.Context, groups []*net.UDPAddr) ([]peer.AddrInfo, error) {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		_ = conn.SetReadDeadline(time.Now())
+	}()
+
+	query := new(dns.Msg)
+	query.SetQuestion(mdnsService, dns.TypePTR)
+	query.Id = 0
+	query.RecursionDesired = false
+	// The QU bit asks for unicast answers
+	query.Question[0].Qclass |= 1 << 15
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	send := func() error {
+		var errs []error
+		for _, g := range groups {
+			if _, err := conn.WriteToUDP(packet, g); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) == len(groups) {
+			return errors.Join(errs...)
+		}
+		return nil
+	}
+	if err := send(); err != nil {
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(mdnsQueryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = send()
+			}
+		}
+	}()
+
+	addrs := make(map[peer.ID][]multiaddr.Multiaddr)
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+		var msg dns.Msg
+		if err := msg.Unpack(buf[:n]); err != nil || !msg.Response {
+			continue
+		}
+		for _, rr := range slices.Concat(msg.Answer, msg.Extra) {
+			txt, ok := rr.(*dns.TXT)
+			if !ok {
+				continue
+			}
+			for _, s := range txt.Txt {
+				ai, ok := parseMDNSAddr(s)
+				if !ok {
+					continue
+				}
+				for _, a := range ai.Addrs {
+					if !slices.ContainsFunc(addrs[ai.ID], a.Equal) {
+						addrs[ai.ID] = append(addrs[ai.ID], a)
+					}
+				}
+			}
+		}
+	}
+
+	peers := make([]peer.AddrInfo, 0, len(addrs))
+	for id, a := range addrs {
+		peers = append(peers, peer.AddrInfo{ID: id, Addrs: a})
+	}
+	slices.SortFunc(peers, func(a, b peer.AddrInfo) int { return strings.Compare(a.ID.String(), b.ID.String()) })
+	return peers, nil
+}
+
+// parseMDNSAddr parses a dnsaddr=<multiaddr>/p2p/<peer-id> TXT string
+func parseMDNSAddr(s string) (*peer.AddrInfo, bool) {
+	s, ok := strings.CutPrefix(s, mdnsDNSAddrPrefix)
+	if !ok {
+		return nil, false
+	}
+	ma, err := multiaddr.NewMultiaddr(s)
+	if err != nil {
+		return nil, false
+	}
+	ai, err := peer.AddrInfoFromP2pAddr(ma)
+	if err != nil {
+		return nil, false
+	}
+	return ai, true
+}
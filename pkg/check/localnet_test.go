@@ -0,0 +1,96 @@
+package check
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMDNSResponder answers the libp2p mDNS queries it receives with the TXT
+// records of the peer of addrs, like the mDNS service of libp2p
+func fakeMDNSResponder(t *testing.T, addrs ...string) *net.UDPAddr {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var query dns.Msg
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Question) != 1 || query.Question[0].Name != mdnsService {
+				continue
+			}
+			resp := new(dns.Msg)
+			resp.Response = true
+			resp.Authoritative = true
+			resp.Answer = []dns.RR{&dns.PTR{
+				Hdr: dns.RR_Header{Name: mdnsService, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 120},
+				Ptr: "peer." + mdnsService,
+			}}
+			txt := &dns.TXT{Hdr: dns.RR_Header{Name: "peer." + mdnsService, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120}}
+			for _, a := range addrs {
+				txt.Txt = append(txt.Txt, mdnsDNSAddrPrefix+a)
+			}
+			resp.Extra = []dns.RR{txt}
+			packet, err := resp.Pack()
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteToUDP(packet, from)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+func TestMDNSDiscover(t *testing.T) {
+	const id = "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5"
+	responder := fakeMDNSResponder(t,
+		"/ip4/192.168.1.10/tcp/4001/p2p/"+id,
+		"/ip4/192.168.1.10/udp/4001/quic-v1/p2p/"+id,
+		"not a multiaddr",
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*mdnsQueryInterval+100*time.Millisecond)
+	defer cancel()
+	peers, err := mdnsDiscover(ctx, []*net.UDPAddr{responder})
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	require.Equal(t, id, peers[0].ID.String())
+	// The repeated queries do not duplicate the addresses
+	require.Equal(t, []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/192.168.1.10/tcp/4001"),
+		multiaddr.StringCast("/ip4/192.168.1.10/udp/4001/quic-v1"),
+	}, peers[0].Addrs)
+}
+
+func TestLocalNetworkConnectionGater(t *testing.T) {
+	private := multiaddr.StringCast("/ip4/192.168.1.10/tcp/4001")
+	g := &privateAddrFilterConnectionGater{}
+	require.False(t, g.InterceptAddrDial("", private))
+	require.False(t, g.InterceptAddrDial("", multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")))
+
+	g.policy.AllowPrivate = true
+	require.True(t, g.InterceptAddrDial("", private))
+	require.True(t, g.InterceptAddrDial("", multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")))
+
+	// The denylist still applies
+	deny, err := NewDenylist(nil, []string{"192.168.1.0/24"}, nil, nil)
+	require.NoError(t, err)
+	g.deny = deny
+	require.False(t, g.InterceptAddrDial("", private))
+}
+
+func TestDiscoverLocalPeersDisabled(t *testing.T) {
+	ck := &Checker{}
+	_, err := ck.DiscoverLocalPeers(context.Background())
+	require.ErrorIs(t, err, ErrLocalNetworkDisabled)
+}
@@ -0,0 +1,203 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// latencyWindowSize is the number of recent DHT queries the average
+	// latency is computed over
+	latencyWindowSize = 100
+	// networkStatusTimeout bounds dialing each bootstrap peer and querying
+	// each IPNI endpoint
+	networkStatusTimeout = 5 * time.Second
+)
+
+// NetworkStatusOutput is the view of the network from the checker, to tell
+// a degraded network or checker apart from a problem with the checked peers
+type NetworkStatusOutput struct {
+	DHT DHTStatusOutput
+	// BootstrapPeers tells which of the bootstrap peers, primary then
+	// fallback ones, could be connected to, and BootstrapReachable how many
+	BootstrapPeers     []BootstrapPeerStatus
+	BootstrapReachable int
+	// BootstrapFallback is whether the DHT client last joined the DHT
+	// through the fallback bootstrap peers, none of the primary ones being
+	// reachable
+	BootstrapFallback bool
+	// DHTQueryLatency is the average duration of the recent DHT lookups of
+	// checks, over DHTQueries lookups, 0 if there were none
+	DHTQueryLatency time.Duration
+	DHTQueries      int
+	// IPNI tells whether each IPNI endpoint responds
+	IPNI []IPNIStatusOutput
+	// AddrFamily is the only IP family the checker uses, see
+	// Config.AddrFamily, empty when it uses both
+	AddrFamily string
+	// CheckerInfo has the public addresses of the checker and their networks
+	CheckerInfo *CheckerInfoOutput
+}
+
+// BootstrapPeerStatus tells whether the checker is connected to a bootstrap peer
+type BootstrapPeerStatus struct {
+	ID string
+	// Fallback is whether the peer is one of Config.FallbackBootstrapPeers
+	Fallback  bool
+	Reachable bool
+	Error     string
+}
+
+// IPNIStatusOutput tells whether an IPNI endpoint responds to delegated
+// routing requests
+type IPNIStatusOutput struct {
+	URL        string
+	Responding bool
+	Duration   time.Duration
+	Error      string
+}
+
+// NetworkStatus returns the view of the network from the checker, connecting
+// to the bootstrap peers it is not connected to and querying each of the
+// IPNI endpoints
+func (ck *Checker) NetworkStatus(ctx context.Context, ipniURLs []string) NetworkStatusOutput {
+	bootstrapPeers := ck.bootstrap.all()
+	out := NetworkStatusOutput{
+		DHT:               ck.DHTStatus(),
+		BootstrapPeers:    make([]BootstrapPeerStatus, len(bootstrapPeers)),
+		BootstrapFallback: ck.bootstrap.usingFallback.Load(),
+		IPNI:              make([]IPNIStatusOutput, len(ipniURLs)),
+		AddrFamily:        ck.addrFamily,
+		CheckerInfo:       ck.CheckerInfo(),
+	}
+	out.DHTQueryLatency, out.DHTQueries = ck.queryLatency.average()
+
+	var wg sync.WaitGroup
+	for i, ai := range bootstrapPeers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out.BootstrapPeers[i] = ck.bootstrapPeerStatus(ctx, ai)
+			out.BootstrapPeers[i].Fallback = i >= len(ck.bootstrap.primary)
+		}()
+	}
+	for i, u := range ipniURLs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out.IPNI[i] = IPNIStatus(ctx, u)
+		}()
+	}
+	wg.Wait()
+
+	for _, s := range out.BootstrapPeers {
+		if s.Reachable {
+			out.BootstrapReachable++
+		}
+	}
+	return out
+}
+
+func (ck *Checker) bootstrapPeerStatus(ctx context.Context, ai peer.AddrInfo) BootstrapPeerStatus {
+	out := BootstrapPeerStatus{ID: ai.ID.String()}
+	if ck.h.Network().Connectedness(ai.ID) == network.Connected {
+		out.Reachable = true
+		return out
+	}
+	ctx, cancel := context.WithTimeout(ctx, networkStatusTimeout)
+	defer cancel()
+	if err := ck.h.Connect(ctx, ai); err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.Reachable = true
+	return out
+}
+
+// IPNIStatus asks the IPNI endpoint for the providers of the empty identity
+// CID, which any delegated routing endpoint can answer
+func IPNIStatus(ctx context.Context, indexerURL string) IPNIStatusOutput {
+	out := IPNIStatusOutput{URL: indexerURL}
+	ctx, cancel := context.WithTimeout(ctx, networkStatusTimeout)
+	defer cancel()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(indexerURL, "/")+"/routing/v1/providers/bafkqaaa", nil)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	resp, err := http.DefaultClient.Do(req)
+	out.Duration = time.Since(start)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		out.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+		return out
+	}
+	out.Responding = true
+	return out
+}
+
+// latencyWindow keeps the durations of the last latencyWindowSize queries
+type latencyWindow struct {
+	mu        sync.Mutex
+	durations [latencyWindowSize]time.Duration
+	n, next   int
+}
+
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.durations[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+	w.n = min(w.n+1, latencyWindowSize)
+}
+
+// average returns the average of the kept durations and their number
+func (w *latencyWindow) average() (time.Duration, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.n == 0 {
+		return 0, 0
+	}
+	var sum time.Duration
+	for _, d := range w.durations[:w.n] {
+		sum += d
+	}
+	return sum / time.Duration(w.n), w.n
+}
+
+// timedDHT records the durations of the successful lookups of a DHT
+type timedDHT struct {
+	DHT
+	latency *latencyWindow
+}
+
+func (d timedDHT) GetClosestPeers(ctx context.Context, key string) ([]peer.ID, error) {
+	start := time.Now()
+	peers, err := d.DHT.GetClosestPeers(ctx, key)
+	if err == nil {
+		d.latency.observe(time.Since(start))
+	}
+	return peers, err
+}
+
+func (d timedDHT) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	start := time.Now()
+	ai, err := d.DHT.FindPeer(ctx, p)
+	if err == nil {
+		d.latency.observe(time.Since(start))
+	}
+	return ai, err
+}
@@ -0,0 +1,50 @@
+package check
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyWindow(t *testing.T) {
+	var w latencyWindow
+	avg, n := w.average()
+	require.Zero(t, avg)
+	require.Zero(t, n)
+
+	w.observe(time.Second)
+	w.observe(3 * time.Second)
+	avg, n = w.average()
+	require.Equal(t, 2*time.Second, avg)
+	require.Equal(t, 2, n)
+
+	// Only the last latencyWindowSize durations are kept
+	for i := 0; i < latencyWindowSize; i++ {
+		w.observe(time.Millisecond)
+	}
+	avg, n = w.average()
+	require.Equal(t, time.Millisecond, avg)
+	require.Equal(t, latencyWindowSize, n)
+}
+
+func TestIPNIStatus(t *testing.T) {
+	status := http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/routing/v1/providers/bafkqaaa", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	out := IPNIStatus(context.Background(), srv.URL+"/")
+	require.True(t, out.Responding, "a delegated routing endpoint without providers responds")
+	require.Empty(t, out.Error)
+
+	status = http.StatusBadGateway
+	out = IPNIStatus(context.Background(), srv.URL)
+	require.False(t, out.Responding)
+	require.Contains(t, out.Error, "502")
+}
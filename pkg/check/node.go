@@ -0,0 +1,313 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Codes of the problems of NodeCheckOutput
+const (
+	NodeProblemNotInDHT             = "not-in-dht"
+	NodeProblemUnreachable          = "unreachable"
+	NodeProblemRelayOnly            = "relay-only"
+	NodeProblemRelayReservation     = "relay-reservation"
+	NodeProblemUnreachableTransport = "unreachable-transport"
+	NodeProblemStaleDHTAddrs        = "stale-dht-addrs"
+	NodeProblemAddrsMissingFromDHT  = "addrs-missing-from-dht"
+	NodeProblemBrokenDHTServer      = "broken-dht-server"
+)
+
+// NodeProblem is a problem found by a node check, from the most to the least
+// serious
+type NodeProblem struct {
+	Code    string
+	Message string
+}
+
+// TransportReachabilityOutput tells whether the peer could be reached over
+// one of Transports
+type TransportReachabilityOutput struct {
+	Transport string
+	// Addrs are the addresses of the peer using the transport
+	Addrs []string
+	// Connected is whether any of Addrs could be connected to
+	Connected bool
+}
+
+// IdentifyOutput is what the peer told about itself over Identify
+type IdentifyOutput struct {
+	AgentVersion    string
+	ProtocolVersion string
+	// ListenAddrs are the addresses the peer announced
+	ListenAddrs []string
+	// Protocols are the protocols the peer advertised
+	Protocols []string
+}
+
+// NodeCheckOutput is the health report of a peer, which only needs its peer
+// ID: whether it can be found in the DHT, which of its addresses and
+// transports can be dialed, whether it depends on relays and how it behaves
+// as a DHT server
+type NodeCheckOutput struct {
+	PeerID string
+	// Healthy is whether no problem was found
+	Healthy  bool
+	Problems []NodeProblem
+	// PeerFoundInDHT are the addresses of the peer returned by the DHT peers
+	// closest to it, with the number of peers that returned each, and
+	// DHTError why the DHT could not be queried
+	PeerFoundInDHT map[string]int
+	DHTError       string
+	// ConnectionError is the error connecting to the peer with all its
+	// working addresses, and ConnectionMaddrs the addresses connected to
+	ConnectionError  string
+	ConnectionMaddrs []string
+	Connections      []ConnectionStateOutput
+	DialBackoff      bool
+	ResourceLimited  bool
+	PeerIDMismatch   *PeerIDMismatchOutput
+	AddrWarnings     []AddrWarning
+	FilteredAddrs    []FilteredAddrOutput
+	DNSResolutions   []DNSResolutionOutput
+	AddrLocations    []AddrLocation
+	AddrDialResults  []AddrDialOutput
+	AddrFamilies     *AddrFamiliesOutput
+	CertHashChecks   []CertHashCheckOutput
+	// Transports has the reachability of the peer over each of the
+	// transports of its addresses
+	Transports []TransportReachabilityOutput
+	// RelayOnly is whether the peer only has relay addresses, and
+	// RelayChecks the result of connecting through each relay then
+	RelayOnly   bool
+	RelayChecks []RelayCheckOutput
+	// RelayReservations has the status of the reservation of the peer with
+	// each relay of its relay addresses
+	RelayReservations []RelayReservationOutput
+	// Identify is nil if the peer could not be connected to or did not
+	// complete the Identify exchange
+	Identify  *IdentifyOutput
+	AddrSets  *PeerAddrSetsOutput
+	DHTServer *DHTServerCheckOutput
+	Protocols []ProtocolSupportOutput
+	Timings   TimingsOutput
+	// Exhausted is the first stage cut short by its budget in
+	// Options.StageBudgets or by the deadline of the check, nil if none was
+	Exhausted *ExhaustedStageOutput
+	// CheckerInfo is the vantage point of the checker that ran the check
+	CheckerInfo *CheckerInfoOutput
+}
+
+// CheckNode checks the health of peer p without a CID, looking its addresses
+// up in the DHT like CheckPeer with a /p2p/<peer-id> multiaddr
+func (ck *Checker) CheckNode(ctx context.Context, p peer.ID, opts Options) (*NodeCheckOutput, error) {
+	opts = opts.withDefaults()
+	if ck.denylist.deniesPeer(p) {
+		return nil, ErrDeniedPeer
+	}
+
+	dialBackoff := clearDialBackoff(ck.h, p)
+	checkStart := time.Now()
+	stageStart := checkStart
+	stages := newStageTracker(ctx, opts)
+	out := &NodeCheckOutput{PeerID: p.String(), CheckerInfo: ck.CheckerInfo(), DialBackoff: dialBackoff}
+	defer func() {
+		out.Exhausted = stages.end()
+		out.Problems = diagnoseNode(out)
+		out.Healthy = len(out.Problems) == 0
+		out.Timings.Total = time.Since(checkStart)
+	}()
+
+	sctx := stages.start(StageRouting)
+	addrMap, err := peerAddrsInDHT(sctx, ck.timedRouting(), ck.dhtMessenger, p)
+	out.PeerFoundInDHT = addrMap
+	if err != nil {
+		out.DHTError = err.Error()
+	}
+	out.Timings.Routing = since(&stageStart)
+
+	var addrs []multiaddr.Multiaddr
+	for a := range addrMap {
+		ma, err := multiaddr.NewMultiaddr(a)
+		if err != nil {
+			log.Println(fmt.Errorf("error parsing multiaddr %s: %w", a, err))
+			continue
+		}
+		addrs = append(addrs, ma)
+	}
+	slices.SortFunc(addrs, func(a, b multiaddr.Multiaddr) int { return strings.Compare(a.String(), b.String()) })
+	out.AddrWarnings = ck.analyzeAddrs(p, addrs)
+	out.DNSResolutions = resolveDNSAddrs(sctx, ck.dnsResolver, addrs)
+	out.AddrLocations = ck.geoIP.locateResolved(addrs, out.DNSResolutions)
+	out.Timings.AddrResolution = since(&stageStart)
+
+	allowed, filtered := ck.filterAddrs(addrs)
+	out.FilteredAddrs = filtered
+	switch {
+	case len(addrs) == 0:
+		out.ConnectionError = "no addresses of the peer were found in the DHT"
+	case len(allowed) == 0:
+		out.ConnectionError = filteredAddrsError(filtered)
+	default:
+		addrs = allowed
+	}
+	if out.ConnectionError != "" {
+		out.AddrSets = comparePeerAddrs(addrMap, nil, nil, nil)
+		return out, nil
+	}
+
+	sctx = stages.start(StageDial)
+	out.AddrDialResults = ck.dialAddrs(sctx, p, addrs, opts.AddrDialTimeout)
+	out.AddrFamilies = summarizeAddrFamilies(out.AddrDialResults)
+	out.CertHashChecks = checkCertHashes(addrs, out.AddrDialResults)
+	out.Transports = summarizeTransports(addrs, out.AddrDialResults)
+	out.RelayOnly = true
+	for _, addr := range addrs {
+		out.RelayOnly = out.RelayOnly && isRelayAddr(addr)
+	}
+	if out.RelayOnly {
+		out.RelayChecks = ck.checkRelays(sctx, p, addrs, opts.PeerDialTimeout)
+	}
+	out.RelayReservations = ck.checkRelayReservations(sctx, p, addrs, opts.AddrDialTimeout)
+	var working []multiaddr.Multiaddr
+	for i, r := range out.AddrDialResults {
+		if r.Error == "" {
+			working = append(working, addrs[i])
+		}
+	}
+	if len(working) > 0 {
+		addrs = working
+	}
+	out.Timings.Dial = since(&stageStart)
+
+	testHost, err := ck.newTestHost()
+	if err != nil {
+		return nil, fmt.Errorf("server error: %w", err)
+	}
+	defer testHost.Close()
+	idSub, err := testHost.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		return nil, fmt.Errorf("server error: %w", err)
+	}
+	defer idSub.Close()
+
+	dialCtx, dialCancel := context.WithTimeout(sctx, opts.PeerDialTimeout)
+	dialStart := time.Now()
+	connErr := testHost.Connect(dialCtx, peer.AddrInfo{ID: p, Addrs: addrs})
+	dialCancel()
+	out.Timings.Dial += since(&stageStart)
+	if connErr != nil {
+		out.ConnectionError = connErr.Error()
+		out.ResourceLimited = isResourceLimited(connErr)
+		out.PeerIDMismatch = peerIDMismatch(connErr)
+		out.AddrSets = comparePeerAddrs(addrMap, nil, out.AddrDialResults, nil)
+		return out, nil
+	}
+	for _, c := range testHost.Network().ConnsToPeer(p) {
+		out.ConnectionMaddrs = append(out.ConnectionMaddrs, c.RemoteMultiaddr().String())
+	}
+	out.Connections = connectionStates(testHost.Network().ConnsToPeer(p), dialStart)
+
+	sctx = stages.start(StageDiagnostics)
+	announced := waitForIdentify(sctx, idSub, p)
+	if announced != nil {
+		out.Identify = identifyInfo(testHost, p, announced)
+	}
+	out.DHTServer = ck.checkDHTServer(sctx, testHost, p, cid.Undef)
+	out.Protocols = ck.checkProtocols(sctx, testHost, p)
+	out.AddrSets = comparePeerAddrs(addrMap, announced, out.AddrDialResults, out.ConnectionMaddrs)
+	return out, nil
+}
+
+// identifyInfo returns what p, which h identified, told about itself
+func identifyInfo(h host.Host, p peer.ID, listenAddrs []multiaddr.Multiaddr) *IdentifyOutput {
+	out := &IdentifyOutput{ListenAddrs: make([]string, 0, len(listenAddrs))}
+	if v, err := h.Peerstore().Get(p, "AgentVersion"); err == nil {
+		out.AgentVersion, _ = v.(string)
+	}
+	if v, err := h.Peerstore().Get(p, "ProtocolVersion"); err == nil {
+		out.ProtocolVersion, _ = v.(string)
+	}
+	for _, a := range listenAddrs {
+		out.ListenAddrs = append(out.ListenAddrs, a.String())
+	}
+	protos, _ := h.Peerstore().GetProtocols(p)
+	for _, proto := range protos {
+		out.Protocols = append(out.Protocols, string(proto))
+	}
+	return out
+}
+
+// summarizeTransports groups the results of dialing addrs by transport, in
+// the order of Transports
+func summarizeTransports(addrs []multiaddr.Multiaddr, dials []AddrDialOutput) []TransportReachabilityOutput {
+	var out []TransportReachabilityOutput
+	for _, transport := range Transports {
+		r := TransportReachabilityOutput{Transport: transport}
+		for i, addr := range addrs {
+			if !usesTransport(addr, transport) {
+				continue
+			}
+			r.Addrs = append(r.Addrs, addr.String())
+			r.Connected = r.Connected || (i < len(dials) && dials[i].Error == "")
+		}
+		if len(r.Addrs) > 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// diagnoseNode lists the problems of the node whose check is out
+func diagnoseNode(out *NodeCheckOutput) []NodeProblem {
+	var problems []NodeProblem
+	add := func(code, format string, args ...interface{}) {
+		problems = append(problems, NodeProblem{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(out.PeerFoundInDHT) == 0 {
+		add(NodeProblemNotInDHT, "no DHT server returned addresses of the peer, other peers can not find it")
+	}
+	if out.ConnectionError != "" && len(out.PeerFoundInDHT) > 0 {
+		add(NodeProblemUnreachable, "the peer could not be connected to: %s", out.ConnectionError)
+	}
+	if out.RelayOnly {
+		add(NodeProblemRelayOnly, "the peer only has relay addresses, it depends on relays and hole punching to be reached")
+	}
+	for _, r := range out.RelayReservations {
+		switch r.Status {
+		case ReservationMissing:
+			add(NodeProblemRelayReservation, "the peer announces relay %s but has no reservation with it, it may have expired", r.RelayPeerID)
+		case ReservationPeerUnreachable, ReservationRelayOverloaded, ReservationPermissionDenied, ReservationNotARelay:
+			add(NodeProblemRelayReservation, "relay %s can not connect to the peer: %s", r.RelayPeerID, r.Status)
+		}
+	}
+	if out.ConnectionError == "" {
+		for _, t := range out.Transports {
+			if !t.Connected {
+				add(NodeProblemUnreachableTransport, "none of the %s addresses of the peer could be connected to", t.Transport)
+			}
+		}
+	}
+	if sets := out.AddrSets; sets != nil && sets.Identify != nil {
+		if len(sets.StaleInDHT) > 0 {
+			add(NodeProblemStaleDHTAddrs, "the DHT has %d addresses the peer does not announce anymore", len(sets.StaleInDHT))
+		}
+		if len(sets.MissingFromDHT) > 0 {
+			add(NodeProblemAddrsMissingFromDHT, "%d public addresses the peer announces are not in the DHT", len(sets.MissingFromDHT))
+		}
+	}
+	if s := out.DHTServer; s != nil && s.Advertised && !s.FindNode {
+		add(NodeProblemBrokenDHTServer, "the peer runs a DHT server that does not answer FIND_NODE queries: %s", s.FindNodeError)
+	}
+	return problems
+}
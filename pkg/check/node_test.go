@@ -0,0 +1,69 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeTransports(t *testing.T) {
+	addrs := []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001"),
+		multiaddr.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1"),
+		multiaddr.StringCast("/ip6/2001:db8::1/udp/4001/quic-v1"),
+		multiaddr.StringCast("/ip4/5.6.7.8/tcp/4001/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK/p2p-circuit"),
+	}
+	dials := []AddrDialOutput{{Error: "timeout"}, {Error: "timeout"}, {}, {}}
+	require.Equal(t, []TransportReachabilityOutput{
+		{Transport: TransportTCP, Addrs: []string{"/ip4/1.2.3.4/tcp/4001"}},
+		{Transport: TransportQUIC, Addrs: []string{"/ip4/1.2.3.4/udp/4001/quic-v1", "/ip6/2001:db8::1/udp/4001/quic-v1"}, Connected: true},
+	}, summarizeTransports(addrs, dials), "relay addresses use no transport of their own")
+}
+
+func TestDiagnoseNode(t *testing.T) {
+	codes := func(problems []NodeProblem) []string {
+		var out []string
+		for _, p := range problems {
+			out = append(out, p.Code)
+		}
+		return out
+	}
+
+	require.Equal(t, []string{NodeProblemNotInDHT}, codes(diagnoseNode(&NodeCheckOutput{
+		ConnectionError: "no addresses of the peer were found in the DHT",
+	})))
+
+	require.Equal(t, []string{NodeProblemUnreachable, NodeProblemRelayOnly}, codes(diagnoseNode(&NodeCheckOutput{
+		PeerFoundInDHT:  map[string]int{"/ip4/5.6.7.8/tcp/4001/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK/p2p-circuit": 3},
+		ConnectionError: "failed to dial",
+		RelayOnly:       true,
+	})))
+
+	require.Equal(t, []string{NodeProblemUnreachableTransport, NodeProblemStaleDHTAddrs, NodeProblemBrokenDHTServer}, codes(diagnoseNode(&NodeCheckOutput{
+		PeerFoundInDHT: map[string]int{"/ip4/1.2.3.4/tcp/4001": 3, "/ip4/1.2.3.4/udp/4001/quic-v1": 3},
+		Transports: []TransportReachabilityOutput{
+			{Transport: TransportTCP, Addrs: []string{"/ip4/1.2.3.4/tcp/4001"}},
+			{Transport: TransportQUIC, Addrs: []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}, Connected: true},
+		},
+		AddrSets:  &PeerAddrSetsOutput{Identify: []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}, StaleInDHT: []string{"/ip4/1.2.3.4/tcp/4001"}},
+		DHTServer: &DHTServerCheckOutput{Advertised: true, FindNodeError: "the peer returned no closer peers, its routing table is empty"},
+	})))
+
+	require.Equal(t, []string{NodeProblemRelayReservation}, codes(diagnoseNode(&NodeCheckOutput{
+		PeerFoundInDHT: map[string]int{"/ip4/1.2.3.4/udp/4001/quic-v1": 3},
+		Transports:     []TransportReachabilityOutput{{Transport: TransportQUIC, Addrs: []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}, Connected: true}},
+		RelayReservations: []RelayReservationOutput{
+			{RelayPeerID: "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK", Status: ReservationMissing},
+			{RelayPeerID: "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK", Status: ReservationActive},
+			{Error: "connecting to the relay: timeout"},
+		},
+	})))
+
+	require.Empty(t, diagnoseNode(&NodeCheckOutput{
+		PeerFoundInDHT: map[string]int{"/ip4/1.2.3.4/udp/4001/quic-v1": 3},
+		Transports:     []TransportReachabilityOutput{{Transport: TransportQUIC, Addrs: []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}, Connected: true}},
+		AddrSets:       &PeerAddrSetsOutput{Identify: []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}},
+		DHTServer:      &DHTServerCheckOutput{},
+	}))
+}
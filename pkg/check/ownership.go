@@ -0,0 +1,123 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// OwnershipProtocol is the protocol over which a peer proves it controls its
+// peer ID to the checker, see HandleOwnershipProofs and ProveOwnership
+const OwnershipProtocol = protocol.ID("/ipfs-check/ownership/1.0.0")
+
+const (
+	// ownershipSignaturePrefix prefixes the signed nonces, so that the
+	// signatures can not be used for anything else
+	ownershipSignaturePrefix = "ipfs-check ownership proof:"
+	ownershipMaxMsgSize      = 4096
+	ownershipTimeout         = 30 * time.Second
+)
+
+// ownershipProof is sent by the peer on an OwnershipProtocol stream
+type ownershipProof struct {
+	Nonce string
+	// Signature is the signature of the prefixed nonce by the private key of
+	// the peer ID
+	Signature []byte
+}
+
+// ownershipResult is the answer of the checker to an ownershipProof
+type ownershipResult struct {
+	Error string
+}
+
+// HandleOwnershipProofs serves OwnershipProtocol on the host of the checker.
+// Peers prove control of their peer ID by signing the nonce of a challenge
+// with its private key over a stream they open to the checker, whose
+// handshake also authenticates the peer ID. Once the signature is verified,
+// accept is called with the peer and the nonce, and returns an error if the
+// nonce was not issued to the peer.
+func (ck *Checker) HandleOwnershipProofs(accept func(p peer.ID, nonce string) error) {
+	ck.h.SetStreamHandler(OwnershipProtocol, func(s network.Stream) {
+		defer s.Close()
+		_ = s.SetDeadline(time.Now().Add(ownershipTimeout))
+
+		var proof ownershipProof
+		if err := json.NewDecoder(io.LimitReader(s, ownershipMaxMsgSize)).Decode(&proof); err != nil {
+			_ = s.Reset()
+			return
+		}
+		p := s.Conn().RemotePeer()
+		err := verifyOwnershipProof(s.Conn().RemotePublicKey(), p, proof)
+		if err == nil {
+			err = accept(p, proof.Nonce)
+		}
+		var res ownershipResult
+		if err != nil {
+			res.Error = err.Error()
+		}
+		_ = json.NewEncoder(s).Encode(res)
+	})
+}
+
+// verifyOwnershipProof checks that the proof is signed with the key of p
+func verifyOwnershipProof(pub crypto.PubKey, p peer.ID, proof ownershipProof) error {
+	if pub == nil {
+		return fmt.Errorf("the public key of %s is unknown", p)
+	}
+	ok, err := pub.Verify([]byte(ownershipSignaturePrefix+proof.Nonce), proof.Signature)
+	if err != nil {
+		return fmt.Errorf("verifying the signature: %w", err)
+	}
+	if !ok {
+		return errors.New("the nonce is not signed with the key of the peer ID")
+	}
+	return nil
+}
+
+// ProveOwnership proves to the checker that h controls its peer ID, signing
+// the nonce of a challenge of the checker with the private key of h over an
+// OwnershipProtocol stream. Node operators run it from a host with the
+// identity of their node.
+func ProveOwnership(ctx context.Context, h host.Host, checker peer.AddrInfo, nonce string) error {
+	key := h.Peerstore().PrivKey(h.ID())
+	if key == nil {
+		return fmt.Errorf("the private key of %s is not in the peerstore", h.ID())
+	}
+	sig, err := key.Sign([]byte(ownershipSignaturePrefix + nonce))
+	if err != nil {
+		return err
+	}
+
+	if err := h.Connect(ctx, checker); err != nil {
+		return fmt.Errorf("connecting to the checker: %w", err)
+	}
+	s, err := h.NewStream(ctx, checker.ID, OwnershipProtocol)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+	if err := json.NewEncoder(s).Encode(ownershipProof{Nonce: nonce, Signature: sig}); err != nil {
+		return err
+	}
+	var res ownershipResult
+	if err := json.NewDecoder(io.LimitReader(s, ownershipMaxMsgSize)).Decode(&res); err != nil {
+		return fmt.Errorf("reading the answer of the checker: %w", err)
+	}
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	bsserver "github.com/ipfs/boxo/bitswap/server"
+	"github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/libp2p/go-libp2p"
+	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoopbackHost(t *testing.T) host.Host {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestProveOwnership(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	checker := newLoopbackHost(t)
+	ck := &Checker{h: checker}
+	type accepted struct {
+		p     peer.ID
+		nonce string
+	}
+	var got []accepted
+	ck.HandleOwnershipProofs(func(p peer.ID, nonce string) error {
+		if nonce == "unknown" {
+			return errors.New("unknown challenge")
+		}
+		got = append(got, accepted{p, nonce})
+		return nil
+	})
+	checkerInfo := peer.AddrInfo{ID: checker.ID(), Addrs: checker.Addrs()}
+
+	node := newLoopbackHost(t)
+	require.NoError(t, ProveOwnership(ctx, node, checkerInfo, "nonce"))
+	require.Equal(t, []accepted{{node.ID(), "nonce"}}, got)
+
+	require.ErrorContains(t, ProveOwnership(ctx, node, checkerInfo, "unknown"), "unknown challenge")
+	require.Len(t, got, 1)
+}
+
+func TestVerifyOwnershipProof(t *testing.T) {
+	h := newLoopbackHost(t)
+	key := h.Peerstore().PrivKey(h.ID())
+	sig, err := key.Sign([]byte(ownershipSignaturePrefix + "nonce"))
+	require.NoError(t, err)
+	require.NoError(t, verifyOwnershipProof(key.GetPublic(), h.ID(), ownershipProof{Nonce: "nonce", Signature: sig}))
+
+	// The signature is of another nonce
+	require.Error(t, verifyOwnershipProof(key.GetPublic(), h.ID(), ownershipProof{Nonce: "other", Signature: sig}))
+	// The nonce is signed by another key
+	other := newLoopbackHost(t)
+	require.Error(t, verifyOwnershipProof(other.Peerstore().PubKey(other.ID()), other.ID(), ownershipProof{Nonce: "nonce", Signature: sig}))
+	// A signature of the bare nonce is refused, it could have been made for
+	// something else
+	bare, err := key.Sign([]byte("nonce"))
+	require.NoError(t, err)
+	require.Error(t, verifyOwnershipProof(key.GetPublic(), h.ID(), ownershipProof{Nonce: "nonce", Signature: bare}))
+}
+
+// dagCBORBlock returns a DAG-CBOR block linking to links
+func dagCBORBlock(t *testing.T, name string, links ...cid.Cid) blocks.Block {
+	n, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "name", qp.String(name))
+		qp.MapEntry(ma, "links", qp.List(int64(len(links)), func(la datamodel.ListAssembler) {
+			for _, l := range links {
+				qp.ListEntry(la, qp.Link(cidlink.Link{Cid: l}))
+			}
+		}))
+	})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, dagcbor.Encode(n, &buf))
+	c, err := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: multihash.SHA2_256, MhLength: -1}.Sum(buf.Bytes())
+	require.NoError(t, err)
+	b, err := blocks.NewBlockWithCid(buf.Bytes(), c)
+	require.NoError(t, err)
+	return b
+}
+
+func rawBlock(t *testing.T, data string) blocks.Block {
+	c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: multihash.SHA2_256, MhLength: -1}.Sum([]byte(data))
+	require.NoError(t, err)
+	b, err := blocks.NewBlockWithCid([]byte(data), c)
+	require.NoError(t, err)
+	return b
+}
+
+func TestCheckDAG(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	h := newLoopbackHost(t)
+	target := newLoopbackHost(t)
+
+	leaf1 := rawBlock(t, "leaf 1")
+	leaf2 := rawBlock(t, "leaf 2")
+	missing := rawBlock(t, "missing")
+	root := dagCBORBlock(t, "root", leaf1.Cid(), leaf2.Cid(), leaf1.Cid())
+	broken := dagCBORBlock(t, "broken", leaf1.Cid(), missing.Cid())
+
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, bstore.PutMany(ctx, []blocks.Block{root, leaf1, leaf2, broken}))
+	bn := bsnet.NewFromIpfsHost(target, rhelp.Null{})
+	server := bsserver.New(ctx, bn, bstore)
+	bn.Start(server)
+	defer server.Close()
+	require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()}))
+
+	// Duplicate links are downloaded once
+	out := checkDAG(ctx, h, target.ID(), root.Cid(), 10, time.Second)
+	require.True(t, out.Complete, out.Error)
+	require.Equal(t, 3, out.Blocks)
+
+	out = checkDAG(ctx, h, target.ID(), root.Cid(), 2, time.Second)
+	require.False(t, out.Complete)
+	require.True(t, out.Truncated)
+	require.Equal(t, 2, out.Blocks)
+
+	out = checkDAG(ctx, h, target.ID(), broken.Cid(), 10, time.Second)
+	require.False(t, out.Complete)
+	require.Equal(t, 2, out.Blocks)
+	require.Equal(t, missing.Cid().String(), out.MissingCID)
+	require.NotEmpty(t, out.Error)
+}
@@ -0,0 +1,149 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Types of UnixFS nodes, stored in the Data field of dag-pb nodes
+const (
+	unixfsDirectory = 1
+	unixfsHAMTShard = 5
+)
+
+// errPathResolution is the Bitswap check error of peers the path could not be resolved with
+const errPathResolution = "the path could not be resolved with the blocks of the peer"
+
+// PathResolutionOutput is the result of resolving the UnixFS path of a check
+// with the blocks of a peer
+type PathResolutionOutput struct {
+	// Segments lists the segments of the path that were resolved, with the
+	// CIDs they point to
+	Segments []PathSegmentOutput
+	// ResolvedCID is the CID the whole path points to, empty if resolution failed
+	ResolvedCID string
+	// FailedSegment is the segment at which resolution failed
+	FailedSegment string
+	Error         string
+}
+
+// PathSegmentOutput is a resolved segment of a UnixFS path
+type PathSegmentOutput struct {
+	Name string
+	CID  string
+}
+
+// resolvePathOnHost resolves the path segments under root with the blocks of
+// peer p, which h must be connected to
+func resolvePathOnHost(ctx context.Context, h host.Host, p peer.ID, root cid.Cid, segments []string, timeout time.Duration) (cid.Cid, *PathResolutionOutput, error) {
+	f := newBlockFetcher(h, p, max(bitswapBlockTimeout, timeout))
+	defer f.close()
+
+	out := &PathResolutionOutput{}
+	c := root
+	for _, name := range segments {
+		next, err := resolveSegment(ctx, f, c, name)
+		if err != nil {
+			out.FailedSegment = name
+			out.Error = err.Error()
+			return cid.Undef, out, fmt.Errorf("resolving %q: %w", name, err)
+		}
+		c = next
+		out.Segments = append(out.Segments, PathSegmentOutput{Name: name, CID: c.String()})
+	}
+	out.ResolvedCID = c.String()
+	return c, out, nil
+}
+
+// connectTestHost returns a new test host connected to the peer. It must be
+// closed after use.
+func (ck *Checker) connectTestHost(ctx context.Context, ai peer.AddrInfo, timeout time.Duration) (host.Host, error) {
+	testHost, err := ck.newTestHost()
+	if err != nil {
+		return nil, err
+	}
+
+	dialCtx, dialCancel := context.WithTimeout(ctx, timeout)
+	defer dialCancel()
+	if err := testHost.Connect(dialCtx, ai); err != nil {
+		_ = testHost.Close()
+		return nil, err
+	}
+	return testHost, nil
+}
+
+// resolveSegment returns the CID of the entry called name in the UnixFS directory c
+func resolveSegment(ctx context.Context, f *blockFetcher, c cid.Cid, name string) (cid.Cid, error) {
+	if c.Prefix().Codec != cid.DagProtobuf {
+		return cid.Undef, fmt.Errorf("%s is not a UnixFS directory", c)
+	}
+	b, err := f.fetch(ctx, c)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	nb := dagpb.Type.PBNode.NewBuilder()
+	if err := dagpb.DecodeBytes(nb, b.RawData()); err != nil {
+		return cid.Undef, fmt.Errorf("decoding block %s: %w", c, err)
+	}
+	node := nb.Build().(dagpb.PBNode)
+	if !node.FieldData().Exists() {
+		return cid.Undef, fmt.Errorf("%s is not a UnixFS node", c)
+	}
+	typ, err := unixfsType(node.FieldData().Must().Bytes())
+	if err != nil {
+		return cid.Undef, fmt.Errorf("decoding UnixFS data of %s: %w", c, err)
+	}
+	switch typ {
+	case unixfsDirectory:
+	case unixfsHAMTShard:
+		return cid.Undef, fmt.Errorf("%s is a HAMT-sharded directory, which is not supported yet", c)
+	default:
+		return cid.Undef, fmt.Errorf("%s is not a UnixFS directory", c)
+	}
+
+	links := node.FieldLinks().Iterator()
+	for !links.Done() {
+		_, l := links.Next()
+		if !l.FieldName().Exists() || l.FieldName().Must().String() != name {
+			continue
+		}
+		if cl, ok := l.FieldHash().Link().(cidlink.Link); ok {
+			return cl.Cid, nil
+		}
+	}
+	return cid.Undef, fmt.Errorf("directory %s has no entry named %q", c, name)
+}
+
+// unixfsType decodes the Type field of the UnixFS protobuf message in the Data of a dag-pb node
+func unixfsType(data []byte) (uint64, error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num == 1 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			return v, nil
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return 0, errors.New("missing UnixFS type")
+}
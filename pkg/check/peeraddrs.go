@@ -0,0 +1,103 @@
+package check
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// identifyTimeout bounds waiting for the Identify exchange once connected to a peer
+const identifyTimeout = 5 * time.Second
+
+// PeerAddrSetsOutput compares the addresses of a peer found in the DHT, the
+// ones it announces over Identify and the ones that worked, to tell stale DHT
+// records apart from misconfigured announce addresses
+type PeerAddrSetsOutput struct {
+	// DHT are the addresses returned by the DHT peers closest to the peer
+	DHT []string
+	// Identify are the listen addresses the peer announced over Identify,
+	// nil if the Identify exchange did not complete
+	Identify []string
+	// Working are the addresses that could be connected to
+	Working []string
+	// StaleInDHT are the DHT addresses the peer does not announce anymore
+	StaleInDHT []string
+	// MissingFromDHT are the public addresses the peer announces that are not in the DHT
+	MissingFromDHT []string
+	// AnnouncedNotWorking are the addresses the peer announces that could not be connected to
+	AnnouncedNotWorking []string
+}
+
+// waitForIdentify returns the listen addresses p announced in the first
+// Identify exchange received on sub, or nil if none is received in time
+func waitForIdentify(ctx context.Context, sub event.Subscription, p peer.ID) []multiaddr.Multiaddr {
+	ctx, cancel := context.WithTimeout(ctx, identifyTimeout)
+	defer cancel()
+	for {
+		select {
+		case e, ok := <-sub.Out():
+			if !ok {
+				return nil
+			}
+			if evt := e.(event.EvtPeerIdentificationCompleted); evt.Peer == p {
+				return evt.ListenAddrs
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// comparePeerAddrs builds the address sets of a peer from the addresses found
+// in the DHT, the ones announced over Identify (nil if unknown), the results of
+// dialing addresses separately and the addresses of the established connections
+func comparePeerAddrs(dhtAddrs map[string]int, identify []multiaddr.Multiaddr, dials []AddrDialOutput, connMaddrs []string) *PeerAddrSetsOutput {
+	out := &PeerAddrSetsOutput{
+		DHT:     make([]string, 0, len(dhtAddrs)),
+		Working: []string{},
+	}
+	for a := range dhtAddrs {
+		out.DHT = append(out.DHT, a)
+	}
+	slices.Sort(out.DHT)
+
+	failed := make(map[string]bool)
+	for _, r := range dials {
+		if r.Error != "" {
+			failed[r.Addr] = true
+		} else if !slices.Contains(out.Working, r.Addr) {
+			out.Working = append(out.Working, r.Addr)
+		}
+	}
+	for _, a := range connMaddrs {
+		if !slices.Contains(out.Working, a) {
+			out.Working = append(out.Working, a)
+		}
+	}
+
+	if identify == nil {
+		return out
+	}
+	out.Identify = make([]string, 0, len(identify))
+	for _, a := range identify {
+		s := a.String()
+		out.Identify = append(out.Identify, s)
+		if _, ok := dhtAddrs[s]; !ok && manet.IsPublicAddr(a) {
+			out.MissingFromDHT = append(out.MissingFromDHT, s)
+		}
+		if failed[s] {
+			out.AnnouncedNotWorking = append(out.AnnouncedNotWorking, s)
+		}
+	}
+	for _, a := range out.DHT {
+		if !slices.Contains(out.Identify, a) {
+			out.StaleInDHT = append(out.StaleInDHT, a)
+		}
+	}
+	return out
+}
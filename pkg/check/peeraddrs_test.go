@@ -0,0 +1,39 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComparePeerAddrs(t *testing.T) {
+	dhtAddrs := map[string]int{
+		"/ip4/1.2.3.4/tcp/4001": 3,
+		"/ip4/5.6.7.8/tcp/4001": 1, // stale record
+	}
+	identify := []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001"),
+		multiaddr.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1"), // not propagated to the DHT
+		multiaddr.StringCast("/ip4/192.168.1.2/tcp/4001"),     // private, not expected in the DHT
+	}
+	dials := []AddrDialOutput{
+		{Addr: "/ip4/1.2.3.4/tcp/4001", Error: "connection refused"},
+		{Addr: "/ip4/5.6.7.8/tcp/4001", Error: "timeout"},
+	}
+	connMaddrs := []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}
+
+	out := comparePeerAddrs(dhtAddrs, identify, dials, connMaddrs)
+	require.Equal(t, []string{"/ip4/1.2.3.4/tcp/4001", "/ip4/5.6.7.8/tcp/4001"}, out.DHT)
+	require.Len(t, out.Identify, 3)
+	require.Equal(t, []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}, out.Working)
+	require.Equal(t, []string{"/ip4/5.6.7.8/tcp/4001"}, out.StaleInDHT)
+	require.Equal(t, []string{"/ip4/1.2.3.4/udp/4001/quic-v1"}, out.MissingFromDHT)
+	require.Equal(t, []string{"/ip4/1.2.3.4/tcp/4001"}, out.AnnouncedNotWorking)
+
+	// without Identify, the DHT addresses can not be compared
+	out = comparePeerAddrs(dhtAddrs, nil, dials, nil)
+	require.Nil(t, out.Identify)
+	require.Empty(t, out.StaleInDHT)
+	require.Empty(t, out.Working)
+}
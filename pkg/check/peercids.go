@@ -0,0 +1,278 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	bsmsgpb "github.com/ipfs/boxo/bitswap/message/pb"
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	"github.com/ipfs/go-cid"
+	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// MaxPeerCIDs is the maximum number of CIDs checked against a peer at once
+const MaxPeerCIDs = 100
+
+// CIDAvailabilityOutput is whether the peer of a multi-CID check serves one
+// of the CIDs
+type CIDAvailabilityOutput struct {
+	CID                      string
+	DataAvailableOverBitswap BitswapCheckOutput
+}
+
+// PeerCIDsCheckOutput is the result of checking several CIDs against a
+// single peer, over a single connection and Bitswap network
+type PeerCIDsCheckOutput struct {
+	ConnectionError  string
+	ConnectionMaddrs []string
+	// DialAttempts are the attempts of connecting to the peer, more than one
+	// when the connection failed and was retried
+	DialAttempts []AttemptOutput
+	// ResourceLimited is whether the connection or the Bitswap checks failed
+	// because the resource manager of the checker refused a connection or
+	// stream. The failure then says nothing about the peer.
+	ResourceLimited bool
+	// Available is the number of CIDs the peer has
+	Available int
+	// CIDs are the results of each CID, in the order they were passed
+	CIDs     []CIDAvailabilityOutput
+	Duration time.Duration
+	// CachedAt is when the result was computed if it was served from a cache,
+	// nil for fresh results
+	CachedAt *time.Time
+	// CheckerInfo is the vantage point of the checker that ran the check
+	CheckerInfo *CheckerInfoOutput
+}
+
+// CheckPeerCIDs checks whether the peer of ma serves each of cids over
+// Bitswap. Unlike running CheckPeer for each CID, the peer is connected to
+// once, and all the CIDs are asked for in the same Bitswap messages. The
+// addresses of the peer are looked up in the DHT if ma has none. cids must
+// not have duplicates.
+func (ck *Checker) CheckPeerCIDs(ctx context.Context, ma multiaddr.Multiaddr, cids []cid.Cid, opts Options) (*PeerCIDsCheckOutput, error) {
+	opts = opts.withDefaults()
+	if len(cids) > MaxPeerCIDs {
+		return nil, fmt.Errorf("at most %d CIDs can be checked at once", MaxPeerCIDs)
+	}
+	ai, err := peer.AddrInfoFromP2pAddr(ma)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[cid.Cid]struct{}, len(cids))
+	for _, c := range cids {
+		if _, ok := seen[c]; ok {
+			return nil, fmt.Errorf("%s is passed more than once", c)
+		}
+		seen[c] = struct{}{}
+		if err := ck.Denied(c, ma); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	out := &PeerCIDsCheckOutput{CIDs: make([]CIDAvailabilityOutput, len(cids)), CheckerInfo: ck.CheckerInfo()}
+	for i, c := range cids {
+		out.CIDs[i].CID = c.String()
+	}
+	defer func() { out.Duration = time.Since(start) }()
+
+	if len(ai.Addrs) == 0 {
+		clearDialBackoff(ck.h, ai.ID)
+		found, err := ck.timedRouting().FindPeer(ctx, ai.ID)
+		if err != nil {
+			out.ConnectionError = err.Error()
+			return out, nil
+		}
+		ai.Addrs = found.Addrs
+	}
+	var filtered []FilteredAddrOutput
+	if ai.Addrs, filtered = ck.filterAddrs(ai.Addrs); len(ai.Addrs) == 0 {
+		out.ConnectionError = filteredAddrsError(filtered)
+		return out, nil
+	}
+	if opts.Transport != "" {
+		if ai.Addrs = filterTransport(ai.Addrs, opts.Transport); len(ai.Addrs) == 0 {
+			out.ConnectionError = fmt.Sprintf("the peer has no %s address", opts.Transport)
+			return out, nil
+		}
+	}
+
+	testHost, err := ck.newTestHost()
+	if err != nil {
+		return nil, fmt.Errorf("server error: %w", err)
+	}
+	defer testHost.Close()
+
+	var timings TimingsOutput
+	var connErr error
+	out.DialAttempts, _, connErr = connectBitswapWithRetries(ctx, testHost, *ai, opts.PeerDialTimeout, &timings, opts)
+	if connErr != nil {
+		out.ConnectionError = connErr.Error()
+		out.ResourceLimited = isResourceLimited(connErr)
+		return out, nil
+	}
+	for _, c := range testHost.Network().ConnsToPeer(ai.ID) {
+		out.ConnectionMaddrs = append(out.ConnectionMaddrs, c.RemoteMultiaddr().String())
+	}
+
+	for i, bsOut := range checkBitswapCIDs(ctx, testHost, ai.ID, cids, opts.FetchBlock, opts.BitswapTimeout) {
+		out.CIDs[i].DataAvailableOverBitswap = bsOut
+		out.ResourceLimited = out.ResourceLimited || bsOut.ResourceLimited
+		if bsOut.Found {
+			out.Available++
+		}
+	}
+	return out, nil
+}
+
+// checkBitswapCIDs asks p for all of cids in a single WANT-HAVE message, and
+// waits up to timeout for the answers. If fetchBlock is set, the blocks the
+// peer claims to have are then requested together with a WANT-BLOCK. Received
+// blocks are hash-verified. h must be connected to p. The results are in the
+// order of cids.
+func checkBitswapCIDs(ctx context.Context, h host.Host, p peer.ID, cids []cid.Cid, fetchBlock bool, timeout time.Duration) []BitswapCheckOutput {
+	log.Printf("Start of Bitswap check of %d CIDs with the peer %s\n", len(cids), p)
+	defer log.Printf("End of Bitswap check of %d CIDs with the peer %s\n", len(cids), p)
+	outs := make([]BitswapCheckOutput, len(cids))
+	start := time.Now()
+	// pending are the indexes of the CIDs waiting for an answer, by CID
+	pending := make(map[cid.Cid]int, len(cids))
+	for i, c := range cids {
+		pending[c] = i
+	}
+	fail := func(err error) []BitswapCheckOutput {
+		for _, i := range pending {
+			outs[i].Error = err.Error()
+			outs[i].ResourceLimited = isResourceLimited(err)
+			outs[i].Duration = time.Since(start)
+		}
+		return outs
+	}
+
+	sctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	s, err := h.NewStream(sctx, p, bsnet.ProtocolBitswap, bsnet.ProtocolBitswapOneOne, bsnet.ProtocolBitswapOneZero, bsnet.ProtocolBitswapNoVers)
+	if err != nil {
+		return fail(err)
+	}
+	for i := range outs {
+		outs[i].Protocol = string(s.Protocol())
+	}
+	_ = s.Close()
+
+	bs := bsnet.NewFromIpfsHost(h, rhelp.Null{})
+	rcv := &bitswapReceiver{target: p, result: make(chan bitswapMsgOrErr)}
+	bs.Start(rcv)
+	defer bs.Stop()
+
+	msg := bsmsg.New(false)
+	for _, c := range cids {
+		msg.AddEntry(c, 0, bsmsgpb.Message_Wantlist_Have, true)
+	}
+	sent := time.Now()
+	if err := bs.SendMessage(ctx, p, msg); err != nil {
+		return fail(err)
+	}
+	if err := rcv.waitForAnswers(ctx, pending, timeout, func(resp bsmsg.BitSwapMessage, i int) {
+		answerBitswapCheck(&outs[i], resp, cids[i], sent)
+		outs[i].Duration = time.Since(start)
+	}); err != nil {
+		return fail(err)
+	}
+	for _, i := range pending {
+		outs[i].Duration = time.Since(start)
+	}
+
+	if !fetchBlock {
+		return outs
+	}
+	pending = make(map[cid.Cid]int)
+	msg = bsmsg.New(false)
+	for i, c := range cids {
+		if outs[i].ReceivedHave && !outs[i].ReceivedBlock {
+			pending[c] = i
+			msg.AddEntry(c, 0, bsmsgpb.Message_Wantlist_Block, true)
+		}
+	}
+	if len(pending) == 0 {
+		return outs
+	}
+	sent = time.Now()
+	if err := bs.SendMessage(ctx, p, msg); err != nil {
+		return fail(err)
+	}
+	if err := rcv.waitForAnswers(ctx, pending, max(bitswapBlockTimeout, timeout), func(resp bsmsg.BitSwapMessage, i int) {
+		answerBitswapCheck(&outs[i], resp, cids[i], sent)
+		outs[i].Duration = time.Since(start)
+	}); err != nil {
+		return fail(err)
+	}
+	return outs
+}
+
+// answerBitswapCheck records in out the answer of the peer about c in resp,
+// sent after a want sent at sent
+func answerBitswapCheck(out *BitswapCheckOutput, resp bsmsg.BitSwapMessage, c cid.Cid, sent time.Time) {
+	out.Responded = true
+	for _, b := range resp.Blocks() {
+		if !b.Cid().Equals(c) {
+			continue
+		}
+		if err := verifyBlock(b); err != nil {
+			out.Error = err.Error()
+			return
+		}
+		out.ReceivedBlock = true
+		out.Found = true
+		out.BlockSize = len(b.RawData())
+		if elapsed := time.Since(sent); elapsed > 0 {
+			out.BytesPerSecond = float64(out.BlockSize) / elapsed.Seconds()
+		}
+		return
+	}
+	if cidsContain(resp.Haves(), c) {
+		out.ReceivedHave = true
+		out.Found = true
+	} else if cidsContain(resp.DontHaves(), c) {
+		out.ReceivedDontHave = true
+	}
+}
+
+// waitForAnswers calls answer for each message from the target peer that
+// mentions one of the pending CIDs, which is then removed from pending, until
+// all of them are answered or timeout elapses
+func (r *bitswapReceiver) waitForAnswers(ctx context.Context, pending map[cid.Cid]int, timeout time.Duration, answer func(bsmsg.BitSwapMessage, int)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for len(pending) > 0 {
+		select {
+		case res := <-r.result:
+			if res.err != nil {
+				return res.err
+			}
+			var mentioned []cid.Cid
+			for _, b := range res.msg.Blocks() {
+				mentioned = append(mentioned, b.Cid())
+			}
+			mentioned = append(mentioned, res.msg.Haves()...)
+			mentioned = append(mentioned, res.msg.DontHaves()...)
+			for _, c := range mentioned {
+				// the peer may also send us its own wants
+				if i, ok := pending[c]; ok {
+					answer(res.msg, i)
+					delete(pending, c)
+				}
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
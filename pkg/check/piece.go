@@ -0,0 +1,109 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multicodec"
+)
+
+// fr32Sha256Trunc254Padbintree is the multihash of the piece CIDs v2 of
+// FRC-0069, which carry the size of the piece
+const fr32Sha256Trunc254Padbintree = 0x1011
+
+// pieceCIDMessage explains why piece CIDs are not checked like other CIDs
+const pieceCIDMessage = "this is a Filecoin piece commitment (CommP), which identifies the data of a Filecoin deal rather than an IPFS block: it can not be retrieved over Bitswap, check the payload CID of the data instead"
+
+// PieceCIDOutput is the result of the CID check of a Filecoin piece CID,
+// which has no providers to check
+type PieceCIDOutput struct {
+	CID CIDInfoOutput
+	// Message explains why the piece CID is not retrievable over Bitswap
+	Message string
+	// PieceIndexer is the endpoint queried for the payload CIDs of the
+	// piece, empty when none is configured, see Options.PieceIndexer
+	PieceIndexer string
+	// PayloadCIDs are the root CIDs of the data in the piece, to check
+	// instead of the piece CID
+	PayloadCIDs []string
+	// Error is why the payload CIDs could not be found
+	Error string
+}
+
+// IsPieceCID returns whether c is a Filecoin commitment, with one of the
+// fil-commitment codecs or the multihash of piece CIDs v2
+func IsPieceCID(c cid.Cid) bool {
+	prefix := c.Prefix()
+	switch multicodec.Code(prefix.Codec) {
+	case multicodec.FilCommitmentUnsealed, multicodec.FilCommitmentSealed:
+		return true
+	}
+	return prefix.MhType == fr32Sha256Trunc254Padbintree
+}
+
+// CheckPieceCID explains that the piece CID c is not retrievable over
+// Bitswap, and looks up the payload CIDs of the piece in opts.PieceIndexer if
+// one is set
+func (ck *Checker) CheckPieceCID(ctx context.Context, c cid.Cid, opts Options) PieceCIDOutput {
+	out := PieceCIDOutput{CID: inspectCID(c), Message: pieceCIDMessage, PieceIndexer: opts.PieceIndexer}
+	if multicodec.Code(c.Prefix().Codec) == multicodec.FilCommitmentSealed {
+		out.Message = "this is a Filecoin sealed sector commitment (CommR), which identifies a replica of a sector rather than an IPFS block: it can not be retrieved over Bitswap, check the payload CID of the data instead"
+		return out
+	}
+	if opts.PieceIndexer == "" {
+		return out
+	}
+	payloads, err := findPiecePayloads(ctx, http.DefaultClient, opts.PieceIndexer, c)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.PayloadCIDs = payloads
+	if len(payloads) == 0 {
+		out.Error = "the piece indexer knows no payload CID for this piece"
+	}
+	return out
+}
+
+// findPiecePayloads asks the piece indexer at endpoint for the payload CIDs
+// of the piece, with GET <endpoint>/pieces/<piece CID>, answered with
+// {"PayloadCIDs": [...]}. A 404 means the piece is unknown.
+func findPiecePayloads(ctx context.Context, client *http.Client, endpoint string, piece cid.Cid) ([]string, error) {
+	u := strings.TrimSuffix(endpoint, "/") + "/pieces/" + piece.String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying the piece indexer: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the piece indexer answered with status %s", resp.Status)
+	}
+	var body struct {
+		PayloadCIDs []string
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid answer of the piece indexer: %w", err)
+	}
+	var payloads []string
+	for _, s := range body.PayloadCIDs {
+		c, err := cid.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload CID %q from the piece indexer: %w", s, err)
+		}
+		payloads = append(payloads, c.String())
+	}
+	return payloads, nil
+}
@@ -0,0 +1,56 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPieceCID(t *testing.T) {
+	require.True(t, IsPieceCID(cid.MustParse(testPieceCID)))
+	require.False(t, IsPieceCID(cid.MustParse("bafybeicklkqcnlvtiscr2hzkubjwnwjinvskffn4xorqeduft3wq7vm5u4")))
+
+	mh, err := multihash.Encode(make([]byte, 34), fr32Sha256Trunc254Padbintree)
+	require.NoError(t, err)
+	require.True(t, IsPieceCID(cid.NewCidV1(cid.Raw, mh)), "piece CIDs v2 are raw")
+
+	out := inspectCID(cid.MustParse(testPieceCID))
+	require.Equal(t, multicodec.FilCommitmentUnsealed.String(), out.Codec)
+	require.Contains(t, out.Warnings[0], "Filecoin commitment")
+}
+
+func TestCheckPieceCID(t *testing.T) {
+	const payload = "bafybeicklkqcnlvtiscr2hzkubjwnwjinvskffn4xorqeduft3wq7vm5u4"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pieces/"+testPieceCID {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"PayloadCIDs": [%q]}`, payload)
+	}))
+	defer srv.Close()
+	ck := &Checker{}
+	piece := cid.MustParse(testPieceCID)
+
+	out := ck.CheckPieceCID(context.Background(), piece, Options{})
+	require.Equal(t, pieceCIDMessage, out.Message)
+	require.Empty(t, out.PayloadCIDs, "without piece indexer")
+	require.Empty(t, out.Error)
+
+	out = ck.CheckPieceCID(context.Background(), piece, Options{PieceIndexer: srv.URL + "/"})
+	require.Equal(t, []string{payload}, out.PayloadCIDs)
+	require.Empty(t, out.Error)
+
+	mh, err := multihash.Encode(make([]byte, 34), fr32Sha256Trunc254Padbintree)
+	require.NoError(t, err)
+	out = ck.CheckPieceCID(context.Background(), cid.NewCidV1(cid.Raw, mh), Options{PieceIndexer: srv.URL})
+	require.Empty(t, out.PayloadCIDs)
+	require.Equal(t, "the piece indexer knows no payload CID for this piece", out.Error)
+}
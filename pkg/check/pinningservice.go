@@ -0,0 +1,140 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PinningServiceSource is the source of the delegates of a pin of a pinning service
+const PinningServiceSource = "Pinning Service"
+
+// PinningServiceCheckOutput is the result of checking a pin of a pinning
+// service
+type PinningServiceCheckOutput struct {
+	// Endpoint is the Pinning Services API endpoint that was queried
+	Endpoint  string
+	RequestID string
+	// Status is the status of the pin in the pinning service: queued,
+	// pinning, pinned or failed
+	Status string
+	CID    string
+	Name   string
+	// Delegates are the multiaddrs the pinning service says serve the CID
+	Delegates []string
+	// Providers has the result of checking each delegate
+	Providers []ProviderOutput
+}
+
+// pinStatus is a pin of the Pinning Services API,
+// see https://ipfs.github.io/pinning-services-api-spec/
+type pinStatus struct {
+	RequestID string `json:"requestid"`
+	Status    string `json:"status"`
+	Pin       struct {
+		CID  string `json:"cid"`
+		Name string `json:"name"`
+	} `json:"pin"`
+	Delegates []string `json:"delegates"`
+}
+
+// CheckPinningService fetches the pin with requestID from the Pinning Services
+// API at endpoint, authenticated with token, then checks the connectivity and
+// Bitswap availability of its CID from each of its delegates. The pinning
+// service is only connected to on the addresses allowed by Config.AddrPolicy.
+func (ck *Checker) CheckPinningService(ctx context.Context, endpoint, token, requestID string, opts Options) (*PinningServiceCheckOutput, error) {
+	opts = opts.withDefaults()
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	ps, err := getPinStatus(ctx, ck.pinningClient, endpoint, token, requestID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := cid.Decode(ps.Pin.CID)
+	if err != nil {
+		return nil, fmt.Errorf("pinning service: invalid CID %q: %w", ps.Pin.CID, err)
+	}
+
+	out := &PinningServiceCheckOutput{
+		Endpoint:  endpoint,
+		RequestID: ps.RequestID,
+		Status:    ps.Status,
+		CID:       c.String(),
+		Name:      ps.Pin.Name,
+		Delegates: []string{},
+		Providers: []ProviderOutput{},
+	}
+	var delegates []multiaddr.Multiaddr
+	for _, d := range ps.Delegates {
+		out.Delegates = append(out.Delegates, d)
+		if ma, err := multiaddr.NewMultiaddr(d); err == nil {
+			delegates = append(delegates, ma)
+		}
+	}
+	providers, err := peer.AddrInfosFromP2pAddrs(delegates...)
+	if err != nil {
+		return nil, fmt.Errorf("pinning service: invalid delegates: %w", err)
+	}
+	out.Providers, err = ck.checkProviders(ctx, c, providers, PinningServiceSource, opts)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pinErrorReason matches the reasons of the errors of the Pinning Services
+// API, e.g. UNAUTHORIZED, the only part of error responses that is reported
+var pinErrorReason = regexp.MustCompile(`^[A-Z][A-Z_]{0,63}$`)
+
+// getPinStatus gets the pin with requestID from the Pinning Services API at
+// endpoint (GET /pins/{requestid}) with client
+func getPinStatus(ctx context.Context, client *http.Client, endpoint, token, requestID string) (*pinStatus, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("pinning service: %w", err)
+	}
+	// A query would swallow the path of the pin
+	if u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return nil, errors.New("pinning service: the endpoint must not have a query or a fragment")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/pins/"+url.PathEscape(requestID), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("pinning service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// The body is not reported, as the endpoint is chosen by the caller
+		var failure struct {
+			Error struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if err := json.Unmarshal(body, &failure); err != nil || !pinErrorReason.MatchString(failure.Error.Reason) {
+			return nil, fmt.Errorf("pinning service: unexpected status code %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("pinning service: status code %d: %s", resp.StatusCode, failure.Error.Reason)
+	}
+
+	var ps pinStatus
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&ps); err != nil {
+		return nil, fmt.Errorf("pinning service: %w", err)
+	}
+	return &ps, nil
+}
@@ -0,0 +1,63 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPinStatus(t *testing.T) {
+	ctx := context.Background()
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/pins/abc":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = fmt.Fprint(w, `{"error":{"reason":"UNAUTHORIZED","details":"internal details"}}`)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"requestid":"abc","status":"pinned","pin":{"cid":"bafkqaaa","name":"test"},"delegates":[]}`)
+		case "/pins/redirect":
+			http.Redirect(w, r, "/pins/abc", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprint(w, "internal details")
+		}
+	}))
+	defer server.Close()
+	client := (&AddrPolicy{AllowPrivate: true}).HTTPClient()
+
+	ps, err := getPinStatus(ctx, client, server.URL, "secret", "abc")
+	require.NoError(t, err)
+	require.Equal(t, "pinned", ps.Status)
+	require.Equal(t, "bafkqaaa", ps.Pin.CID)
+
+	// Only the reason of errors is reported, not the body of the response
+	_, err = getPinStatus(ctx, client, server.URL, "", "abc")
+	require.ErrorContains(t, err, "UNAUTHORIZED")
+	require.NotContains(t, err.Error(), "internal details")
+	_, err = getPinStatus(ctx, client, server.URL, "secret", "other")
+	require.ErrorContains(t, err, "unexpected status code 500")
+	require.NotContains(t, err.Error(), "internal details")
+
+	// Redirects are not followed
+	_, err = getPinStatus(ctx, client, server.URL, "secret", "redirect")
+	require.ErrorContains(t, err, "unexpected status code 302")
+
+	// A query in the endpoint would swallow the path of the pin
+	requests = 0
+	_, err = getPinStatus(ctx, client, server.URL+"/?", "secret", "abc")
+	require.Error(t, err)
+	require.Zero(t, requests)
+
+	// The default policy refuses loopback addresses
+	_, err = getPinStatus(ctx, (&AddrPolicy{}).HTTPClient(), server.URL, "secret", "abc")
+	require.ErrorContains(t, err, "refusing to connect")
+	require.Zero(t, requests)
+}
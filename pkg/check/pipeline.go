@@ -0,0 +1,175 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Stages of the pipeline of peer checks, in the order they run. The probes
+// registered with RegisterProbe run at the end of their stage.
+const (
+	// PipelineRouting looks the peer and its provider records up
+	PipelineRouting = "routing"
+	// PipelineAddressFilter analyzes the addresses of the peer and filters
+	// the ones that are not dialed
+	PipelineAddressFilter = "addressFilter"
+	// PipelineDial connects to the peer
+	PipelineDial = "dial"
+	// PipelineRetrieval asks the peer for the data
+	PipelineRetrieval = "retrieval"
+	// PipelineProtocolProbe probes the protocols the peer supports. It runs
+	// after PipelineRetrieval, once Identify completed.
+	PipelineProtocolProbe = "protocolProbe"
+)
+
+// PipelineStages lists the stages of the pipeline of peer checks in order
+var PipelineStages = []string{PipelineRouting, PipelineAddressFilter, PipelineDial, PipelineRetrieval, PipelineProtocolProbe}
+
+// budgetStage returns the stage of Options.StageBudgets and Options.OnStage
+// a pipeline stage runs in
+func budgetStage(stage string) string {
+	switch stage {
+	case PipelineDial:
+		return StageDial
+	case PipelineRetrieval:
+		return StageBitswap
+	case PipelineProtocolProbe:
+		return StageDiagnostics
+	}
+	return StageRouting
+}
+
+// Probe is a check of peers added to the pipeline of peer checks with
+// RegisterProbe, e.g. to try a new transport, without changing CheckPeer
+type Probe struct {
+	// Name identifies the probe and its result in PeerCheckOutput.Pipeline
+	Name string
+	// Stage is the stage of PipelineStages the probe runs at the end of.
+	// The probe is skipped when the check stops before.
+	Stage string
+	// Run probes the peer, within the budget of its stage. Its result is
+	// reported as is, and must encode to JSON.
+	Run func(ctx context.Context, t *ProbeTarget) (any, error)
+}
+
+// ProbeTarget is the peer a probe runs against, as known at its stage
+type ProbeTarget struct {
+	Peer peer.ID
+	// Addrs are the addresses of the peer: the passed ones or the ones found
+	// in the DHT, only the dialable ones from PipelineAddressFilter on, and
+	// only the working ones from PipelineDial on
+	Addrs []multiaddr.Multiaddr
+	// CID is the checked CID
+	CID cid.Cid
+	// Host is the host of the check, connected to the peer when Connected.
+	// It is nil before PipelineDial.
+	Host      host.Host
+	Connected bool
+	Options   Options
+}
+
+// PipelineStepOutput is the result of a stage of the pipeline of a peer
+// check, or of a probe registered with RegisterProbe
+type PipelineStepOutput struct {
+	Stage string
+	// Probe is the name of the probe, empty for the stage itself, whose
+	// results are in the other fields of the output
+	Probe string
+	// Status is StageOK, StageFailed, or StageSkipped when the check stopped
+	// before, with the Error of failed and skipped steps
+	Status   string
+	Error    string
+	Duration time.Duration
+	// Result is the result of the probe
+	Result any
+}
+
+// RegisterProbe adds a probe to the pipeline of the peer checks run after
+// it. Probes run in the order they were registered within their stage.
+func (ck *Checker) RegisterProbe(p Probe) error {
+	if p.Name == "" || p.Run == nil {
+		return fmt.Errorf("the probe needs a name and a Run function")
+	}
+	if !slices.Contains(PipelineStages, p.Stage) {
+		return fmt.Errorf("unknown pipeline stage %q of probe %q", p.Stage, p.Name)
+	}
+	ck.probesMu.Lock()
+	defer ck.probesMu.Unlock()
+	if slices.ContainsFunc(ck.probes, func(o Probe) bool { return o.Name == p.Name }) {
+		return fmt.Errorf("a probe named %q is already registered", p.Name)
+	}
+	ck.probes = append(ck.probes, p)
+	return nil
+}
+
+// probesOf returns the registered probes of stage
+func (ck *Checker) probesOf(stage string) []Probe {
+	ck.probesMu.RLock()
+	defer ck.probesMu.RUnlock()
+	var out []Probe
+	for _, p := range ck.probes {
+		if p.Stage == stage {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// pipelineStage is a stage of the pipeline with its built-in checks. run
+// returns the status of the stage, whether the check stops at it, and an
+// error if the check could not be run.
+type pipelineStage struct {
+	name string
+	run  func(ctx context.Context) (status StageOutput, stop bool, err error)
+}
+
+// runPipeline runs the stages in order with their probes, reporting each
+// step, until one stops the check
+func (ck *Checker) runPipeline(tracker *stageTracker, target *ProbeTarget, stages []pipelineStage) ([]PipelineStepOutput, error) {
+	var steps []PipelineStepOutput
+	var stopped string
+	var ctx context.Context
+	current := ""
+	for _, s := range stages {
+		probes := ck.probesOf(s.name)
+		if stopped != "" {
+			steps = append(steps, PipelineStepOutput{Stage: s.name, Status: StageSkipped, Error: stopped})
+			for _, p := range probes {
+				steps = append(steps, PipelineStepOutput{Stage: s.name, Probe: p.Name, Status: StageSkipped, Error: stopped})
+			}
+			continue
+		}
+		if bs := budgetStage(s.name); bs != current {
+			current = bs
+			ctx = tracker.start(bs)
+		}
+
+		start := time.Now()
+		status, stop, err := s.run(ctx)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, PipelineStepOutput{Stage: s.name, Status: status.Status, Error: status.Error, Duration: time.Since(start)})
+
+		for _, p := range probes {
+			start := time.Now()
+			result, err := p.Run(ctx, target)
+			step := PipelineStepOutput{Stage: s.name, Probe: p.Name, Status: StageOK, Duration: time.Since(start), Result: result}
+			if err != nil {
+				step.Status, step.Error = StageFailed, err.Error()
+			}
+			steps = append(steps, step)
+		}
+		if stop {
+			stopped = fmt.Sprintf("the check stopped at the %s stage", s.name)
+		}
+	}
+	return steps, nil
+}
@@ -0,0 +1,63 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterProbe(t *testing.T) {
+	ck := &Checker{}
+	run := func(context.Context, *ProbeTarget) (any, error) { return nil, nil }
+	require.NoError(t, ck.RegisterProbe(Probe{Name: "webrtc", Stage: PipelineDial, Run: run}))
+	require.Error(t, ck.RegisterProbe(Probe{Name: "webrtc", Stage: PipelineRetrieval, Run: run}), "the names are unique")
+	require.Error(t, ck.RegisterProbe(Probe{Name: "other", Stage: "bitswap", Run: run}))
+	require.Error(t, ck.RegisterProbe(Probe{Name: "other", Stage: PipelineDial}))
+	require.Len(t, ck.probesOf(PipelineDial), 1)
+	require.Empty(t, ck.probesOf(PipelineRetrieval))
+}
+
+func TestRunPipeline(t *testing.T) {
+	ck := &Checker{}
+	var entered []string
+	opts := Options{OnStage: func(stage string) { entered = append(entered, stage) }}
+	target := &ProbeTarget{}
+	require.NoError(t, ck.RegisterProbe(Probe{Name: "quic-v2", Stage: PipelineDial, Run: func(_ context.Context, t *ProbeTarget) (any, error) {
+		if !t.Connected {
+			return nil, errors.New("not connected")
+		}
+		return "ok", nil
+	}}))
+	require.NoError(t, ck.RegisterProbe(Probe{Name: "car", Stage: PipelineRetrieval, Run: func(context.Context, *ProbeTarget) (any, error) {
+		return "ok", nil
+	}}))
+
+	ok := func(context.Context) (StageOutput, bool, error) { return stageOK(), false, nil }
+	steps, err := ck.runPipeline(newStageTracker(context.Background(), opts), target, []pipelineStage{
+		{PipelineRouting, ok},
+		{PipelineAddressFilter, ok},
+		{PipelineDial, func(context.Context) (StageOutput, bool, error) {
+			return stageFailed("connection refused"), true, nil
+		}},
+		{PipelineRetrieval, ok},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{StageRouting, StageDial}, entered, "the address filter runs in the routing stage")
+	require.Len(t, steps, 6)
+	require.Equal(t, StageFailed, steps[2].Status)
+	require.Equal(t, PipelineStepOutput{Stage: PipelineDial, Probe: "quic-v2", Status: StageFailed, Error: "not connected", Duration: steps[3].Duration}, steps[3],
+		"the probes of the stage the check stopped at run")
+	stopped := "the check stopped at the dial stage"
+	require.Equal(t, PipelineStepOutput{Stage: PipelineRetrieval, Status: StageSkipped, Error: stopped}, steps[4])
+	require.Equal(t, PipelineStepOutput{Stage: PipelineRetrieval, Probe: "car", Status: StageSkipped, Error: stopped}, steps[5])
+
+	// The check fails when a stage can not run
+	_, err = ck.runPipeline(newStageTracker(context.Background(), Options{}), target, []pipelineStage{
+		{PipelineRouting, func(context.Context) (StageOutput, bool, error) {
+			return StageOutput{}, true, errors.New("server error")
+		}},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,224 @@
+package check
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// CheckPlan describes what a check would do, as returned by the Plan methods
+// of Checker, which do not touch the network
+type CheckPlan struct {
+	// Routing are the routing systems the check would query
+	Routing []RoutingPlan
+	// Providers are the IDs of the providers passed to CheckProviders, nil
+	// when the providers would be found by routing
+	Providers []string
+	// MaxProviders is the number of providers a CID check would check,
+	// selected with ProviderSelection, 0 for other checks
+	MaxProviders      int
+	ProviderSelection string
+	// Addrs are the addresses of the peer a peer check would dial, nil when
+	// they would be looked up in the DHT
+	Addrs []string
+	// Protocols are the protocols a peer check would probe on the peer
+	Protocols []string
+	// Steps are the stages of the check, in order
+	Steps []string
+	// DialTimeout bounds connecting to each peer, and BitswapTimeout waiting
+	// for its Bitswap answer
+	DialTimeout    time.Duration
+	BitswapTimeout time.Duration
+	// CID describes the checked CID
+	CID CIDInfoOutput
+}
+
+// RoutingPlan is a routing system a check would query
+type RoutingPlan struct {
+	// System is DHTSource, IPNISource, KuboSource or ClusterSource
+	System string
+	// Endpoint is the DHT client used, StandardDHTRouting or
+	// AcceleratedDHTRouting, or the URL of the IPNI indexer, Kubo node or
+	// IPFS Cluster
+	Endpoint string
+	// Purpose is what the system would be queried for
+	Purpose string
+}
+
+// PlanCID returns what CheckCID would do
+func (ck *Checker) PlanCID(c cid.Cid, opts Options) CheckPlan {
+	opts = opts.withDefaults()
+	plan := ck.newPlan(c, opts, opts.ProviderDialTimeout)
+	plan.MaxProviders = opts.MaxProviders
+	plan.ProviderSelection = opts.ProviderSelection
+
+	purpose := "providers of the CID"
+	plan.Routing = []RoutingPlan{
+		{System: DHTSource, Endpoint: ck.Routing(), Purpose: purpose},
+		{System: IPNISource, Endpoint: opts.IPNIIndexer, Purpose: purpose},
+	}
+	if opts.ProviderSelection != SelectFirst || opts.PreferQUIC {
+		step := fmt.Sprintf("Collect up to %d providers in the DHT and IPNI, and select %d of them (%s)", maxProviderCandidates, opts.MaxProviders, opts.ProviderSelection)
+		if opts.PreferQUIC {
+			step += ", preferring the ones with QUIC addresses"
+		}
+		plan.Steps = append(plan.Steps, step)
+	} else {
+		plan.Steps = append(plan.Steps, fmt.Sprintf("Find up to %d providers in the DHT and IPNI", opts.MaxProviders))
+	}
+	if opts.KuboRPC != "" {
+		plan.Routing = append(plan.Routing, RoutingPlan{System: KuboSource, Endpoint: opts.KuboRPC, Purpose: purpose})
+		plan.Steps = append(plan.Steps, "Ask the Kubo node for providers, and also check the ones only it found")
+	}
+	if opts.ClusterAPI != "" {
+		plan.Routing = append(plan.Routing, RoutingPlan{System: ClusterSource, Endpoint: opts.ClusterAPI, Purpose: "status of the pins of the CID"})
+		plan.Steps = append(plan.Steps, "Ask the IPFS Cluster for the status of the pins of the CID, and also check the peers it says pinned it")
+	}
+	plan.Steps = append(plan.Steps, providerSteps(opts)...)
+	if opts.FilecoinRetrieval {
+		plan.Steps = append(plan.Steps, "Probe the Graphsync and HTTP piece retrieval endpoints of the Filecoin storage providers found in IPNI")
+	}
+	plan.Steps = append(plan.Steps, "Look up all the provider records of the CID in the DHT and IPNI to tell where each provider advertises it")
+	return plan
+}
+
+// PlanProviders returns what CheckProviders would do
+func (ck *Checker) PlanProviders(c cid.Cid, providers []peer.AddrInfo, opts Options) CheckPlan {
+	opts = opts.withDefaults()
+	plan := ck.newPlan(c, opts, opts.ProviderDialTimeout)
+	plan.Providers = []string{}
+	var lookup bool
+	for _, p := range providers {
+		plan.Providers = append(plan.Providers, p.ID.String())
+		lookup = lookup || len(p.Addrs) == 0
+	}
+	if lookup {
+		plan.Routing = append(plan.Routing, RoutingPlan{System: DHTSource, Endpoint: ck.Routing(), Purpose: "addresses of the providers passed without any"})
+		plan.Steps = append(plan.Steps, "Look up the addresses of the providers passed without any in the DHT")
+	}
+	plan.Steps = append(plan.Steps, providerSteps(opts)...)
+	return plan
+}
+
+// PlanPeer returns what CheckPeer would do
+func (ck *Checker) PlanPeer(ma multiaddr.Multiaddr, c cid.Cid, opts Options) (CheckPlan, error) {
+	opts = opts.withDefaults()
+	ai, err := peer.AddrInfoFromP2pAddr(ma)
+	if err != nil {
+		return CheckPlan{}, err
+	}
+	plan := ck.newPlan(c, opts, opts.PeerDialTimeout)
+	plan.Routing = []RoutingPlan{
+		{System: DHTSource, Endpoint: ck.Routing(), Purpose: "addresses and provider records of the peer"},
+		{System: IPNISource, Endpoint: opts.IPNIIndexer, Purpose: "provider records and last advertisement of the peer"},
+	}
+	plan.Steps = []string{
+		"Look up the addresses of the peer in the DHT",
+		"Look up the provider records of the peer in the DHT and IPNI",
+	}
+	if opts.KuboRPC != "" {
+		plan.Routing = append(plan.Routing, RoutingPlan{System: KuboSource, Endpoint: opts.KuboRPC, Purpose: "view of the peer from the Kubo node"})
+		plan.Steps = append(plan.Steps, "Ask the Kubo node whether it finds and can connect to the peer")
+	}
+	if opts.ClusterAPI != "" {
+		plan.Routing = append(plan.Routing, RoutingPlan{System: ClusterSource, Endpoint: opts.ClusterAPI, Purpose: "status of the pins of the CID"})
+		plan.Steps = append(plan.Steps, "Ask the IPFS Cluster for the status of the pins of the CID on its peers")
+	}
+	if opts.DeepCheck {
+		plan.Steps = append(plan.Steps, "Ask the DHT servers closest to the CID for a provider record of the peer")
+	}
+
+	addrs := ai.Addrs
+	if opts.Transport != "" {
+		addrs = filterTransport(addrs, opts.Transport)
+	}
+	if len(ai.Addrs) > 0 {
+		plan.Addrs = []string{}
+		for _, a := range addrs {
+			plan.Addrs = append(plan.Addrs, a.String())
+		}
+	}
+	plan.Steps = append(plan.Steps, "Resolve the DNS addresses of the peer", "Dial each address of the peer separately"+overTransport(opts))
+	if len(addrs) > 0 && !slices.ContainsFunc(addrs, func(a multiaddr.Multiaddr) bool { return !isRelayAddr(a) }) {
+		plan.Steps = append(plan.Steps, "Connect to the peer through each of its relays")
+	}
+	plan.Steps = append(plan.Steps, "Connect to the peer with the addresses that work"+withRetries(opts))
+	if opts.AutoNAT {
+		plan.Steps = append(plan.Steps, "Ask the peer to dial ipfs-check back with AutoNAT")
+	}
+	plan.Steps = append(plan.Steps, dataSteps(opts, "the peer")...)
+	if opts.BitswapVersions {
+		plan.Steps = append(plan.Steps, "Ask the peer for the CID over each Bitswap protocol version")
+	}
+	if opts.DAGMaxBlocks > 0 {
+		plan.Steps = append(plan.Steps, fmt.Sprintf("Download the DAG of the CID from the peer, up to %d blocks", opts.DAGMaxBlocks))
+	}
+	if opts.ThroughputMiB > 0 {
+		plan.Steps = append(plan.Steps, fmt.Sprintf("Measure the throughput of the peer, downloading up to %d MiB of the DAG of the CID", opts.ThroughputMiB))
+	}
+	plan.Steps = append(plan.Steps,
+		"Query the peer as a DHT server",
+		"Probe the protocols supported by the peer",
+	)
+	for _, p := range probedProtocols {
+		plan.Protocols = append(plan.Protocols, string(p.id))
+	}
+	plan.Protocols = append(plan.Protocols, string(ck.dhtProtocol))
+	return plan, nil
+}
+
+func (ck *Checker) newPlan(c cid.Cid, opts Options, dialTimeout time.Duration) CheckPlan {
+	return CheckPlan{
+		Routing:        []RoutingPlan{},
+		Steps:          []string{},
+		DialTimeout:    dialTimeout,
+		BitswapTimeout: opts.BitswapTimeout,
+		CID:            inspectCID(c),
+	}
+}
+
+// providerSteps are the steps of checking each provider
+func providerSteps(opts Options) []string {
+	steps := []string{
+		"Resolve the DNS addresses of each provider",
+		"Dial the IPv4 and IPv6 addresses of each dual-stack provider separately",
+		"Connect to each provider" + overTransport(opts) + withRetries(opts),
+	}
+	steps = append(steps, dataSteps(opts, "each provider")...)
+	if opts.RankBy != "" {
+		steps = append(steps, "Rank the providers that serve the block by "+opts.RankBy)
+	}
+	return steps
+}
+
+// dataSteps are the steps of checking whether who serves the CID over Bitswap
+func dataSteps(opts Options, who string) []string {
+	var steps []string
+	if len(opts.Path) > 0 {
+		steps = append(steps, fmt.Sprintf("Resolve /%s with the blocks of %s", strings.Join(opts.Path, "/"), who))
+	}
+	step := "Ask " + who + " for the block over Bitswap"
+	if opts.FetchBlock {
+		step += ", and fetch it"
+	}
+	return append(steps, step+withRetries(opts))
+}
+
+func withRetries(opts Options) string {
+	if opts.Retries == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", retrying up to %d times", opts.Retries)
+}
+
+func overTransport(opts Options) string {
+	if opts.Transport == "" {
+		return ""
+	}
+	return " over " + opts.Transport
+}
@@ -0,0 +1,50 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	ck := &Checker{dhtProtocol: "/test/kad/1.0.0"}
+	c := cid.MustParse("bafkreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy")
+	p, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+
+	plan := ck.PlanCID(c, Options{KuboRPC: "http://127.0.0.1:5001", FetchBlock: true, Path: []string{"a", "b"}})
+	require.Equal(t, 10, plan.MaxProviders)
+	require.Equal(t, SelectFirst, plan.ProviderSelection)
+	require.Len(t, plan.Routing, 3)
+	require.Equal(t, StandardDHTRouting, plan.Routing[0].Endpoint)
+	require.Equal(t, DefaultIndexerURL, plan.Routing[1].Endpoint)
+	require.Equal(t, KuboSource, plan.Routing[2].System)
+	require.Contains(t, plan.Steps, "Resolve /a/b with the blocks of each provider")
+	require.Contains(t, plan.Steps, "Ask each provider for the block over Bitswap, and fetch it")
+	require.Nil(t, plan.Addrs)
+	require.Nil(t, plan.Protocols)
+
+	plan = ck.PlanProviders(c, []peer.AddrInfo{{ID: p}}, Options{})
+	require.Equal(t, []string{p.String()}, plan.Providers)
+	require.Len(t, plan.Routing, 1, "the addresses of the provider are looked up")
+
+	tcp := multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001/p2p/" + p.String())
+	plan, err = ck.PlanPeer(tcp, c, Options{Transport: "quic-v1", AutoNAT: true, Retries: 2})
+	require.NoError(t, err)
+	require.Empty(t, plan.Addrs, "the TCP address is filtered out")
+	require.NotNil(t, plan.Addrs)
+	require.Contains(t, plan.Steps, "Ask the peer to dial ipfs-check back with AutoNAT")
+	require.Contains(t, plan.Steps, "Connect to the peer with the addresses that work, retrying up to 2 times")
+	require.Contains(t, plan.Steps, "Ask the peer for the block over Bitswap, retrying up to 2 times")
+	require.Contains(t, plan.Protocols, "/test/kad/1.0.0")
+
+	plan, err = ck.PlanPeer(multiaddr.StringCast("/p2p/"+p.String()), c, Options{})
+	require.NoError(t, err)
+	require.Nil(t, plan.Addrs, "the addresses would be looked up in the DHT")
+
+	_, err = ck.PlanPeer(multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001"), c, Options{})
+	require.Error(t, err)
+}
@@ -0,0 +1,23 @@
+package check
+
+import (
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/libp2p/go-libp2p/p2p/transport/websocket"
+)
+
+// privateNetworkOption returns the libp2p options to join the private network
+// protected by psk, or a no-op option when psk is nil. The hosts must listen
+// on the addresses of listenAddrsOption.
+func privateNetworkOption(psk pnet.PSK) libp2p.Option {
+	if psk == nil {
+		return func(cfg *libp2p.Config) error { return nil }
+	}
+	return libp2p.ChainOptions(
+		libp2p.PrivateNetwork(psk),
+		// QUIC based transports do not support private networks
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.Transport(websocket.New),
+	)
+}
@@ -0,0 +1,76 @@
+package check
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateNetwork(t *testing.T) {
+	newPSK := func() pnet.PSK {
+		psk := make([]byte, 32)
+		_, err := rand.Read(psk)
+		require.NoError(t, err)
+		return psk
+	}
+	psk := newPSK()
+	newTarget := func(opts ...libp2p.Option) peer.AddrInfo {
+		h, err := libp2p.New(append(opts, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/tcp/0/ws"))...)
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		return peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	}
+	ck := &Checker{
+		newIsolatedHost: func() (host.Host, error) {
+			return libp2p.New(libp2p.NoListenAddrs, privateNetworkOption(psk))
+		},
+	}
+
+	// Peers of the private network can be dialed, over TCP and WebSocket
+	member := newTarget(privateNetworkOption(psk))
+	require.Len(t, member.Addrs, 2)
+	for _, a := range member.Addrs {
+		state, _, err := ck.dialPeer(context.Background(), peer.AddrInfo{ID: member.ID, Addrs: []multiaddr.Multiaddr{a}}, 5*time.Second)
+		require.NoError(t, err, a)
+		require.NotNil(t, state, a)
+	}
+
+	// Peers of the public network and of other private networks can not
+	for _, target := range []peer.AddrInfo{newTarget(), newTarget(privateNetworkOption(newPSK()))} {
+		_, _, err := ck.dialPeer(context.Background(), target, 5*time.Second)
+		require.Error(t, err)
+	}
+
+	// The QUIC based transports do not support private networks
+	h, err := ck.newIsolatedHost()
+	require.NoError(t, err)
+	defer h.Close()
+	sw := h.Network().(*swarm.Swarm)
+	for _, a := range []string{"/ip4/1.2.3.4/tcp/4001", "/ip4/1.2.3.4/tcp/4001/ws"} {
+		require.NotNil(t, sw.TransportForDialing(multiaddr.StringCast(a)), a)
+	}
+	for _, a := range []string{"/ip4/1.2.3.4/udp/4001/quic-v1", "/ip4/1.2.3.4/udp/4001/quic-v1/webtransport", "/ip4/1.2.3.4/udp/4001/webrtc-direct"} {
+		require.Nil(t, sw.TransportForDialing(multiaddr.StringCast(a)), a)
+	}
+	require.Equal(t, []string{"/ip4/0.0.0.0/tcp/0", "/ip4/0.0.0.0/tcp/0/ws"}, listenAddrStrings(t, listenAddrsOption(AddrFamilyIPv4, true)))
+}
+
+// listenAddrStrings returns the listen addresses set by opt
+func listenAddrStrings(t *testing.T, opt libp2p.Option) []string {
+	var cfg libp2p.Config
+	require.NoError(t, opt(&cfg))
+	var addrs []string
+	for _, a := range cfg.ListenAddrs {
+		addrs = append(addrs, a.String())
+	}
+	return addrs
+}
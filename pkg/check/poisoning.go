@@ -0,0 +1,111 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+// Codes of the problems found in the answers of DHT servers, which flag
+// servers returning bad or poisoned records
+const (
+	// DHTRecordInvalidPeerID is for providers or closer peers whose peer ID
+	// is not a valid peer ID, e.g. an identity multihash of a malformed key
+	DHTRecordInvalidPeerID = "invalid-peer-id"
+	// DHTRecordMismatchedPeerID is for addresses of a peer that end with the
+	// /p2p component of another peer
+	DHTRecordMismatchedPeerID = "mismatched-peer-id"
+	// DHTRecordUnsignedAddrs is for addresses of a peer that are not in the
+	// signed peer record the checker holds for it
+	DHTRecordUnsignedAddrs = "addrs-not-in-signed-record"
+)
+
+// DHTRecordProblem is unverifiable or contradictory data returned by a DHT
+// server about a provider or closer peer
+type DHTRecordProblem struct {
+	Server string
+	Peer   string
+	Code   string
+	// Provider is whether Peer was returned as a provider, else as a closer peer
+	Provider bool
+	Message  string
+}
+
+// diagnoseDHTAnswer validates the providers and closer peers returned by
+// server against the signed peer records held in ps, when it has some
+func diagnoseDHTAnswer(ps peerstore.Peerstore, server peer.ID, provs, closer []*peer.AddrInfo) []DHTRecordProblem {
+	var problems []DHTRecordProblem
+	for i, ai := range append(append([]*peer.AddrInfo{}, provs...), closer...) {
+		add := func(code, format string, args ...any) {
+			problems = append(problems, DHTRecordProblem{
+				Server:   server.String(),
+				Peer:     ai.ID.String(),
+				Code:     code,
+				Provider: i < len(provs),
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+		if err := validatePeerID(ai.ID); err != nil {
+			add(DHTRecordInvalidPeerID, "invalid peer ID: %s", err)
+			continue
+		}
+		var unsigned []string
+		signed := signedAddrs(ps, ai.ID)
+		for _, a := range ai.Addrs {
+			if _, id := peer.SplitAddr(a); id != "" && id != ai.ID {
+				add(DHTRecordMismatchedPeerID, "the address %s is the address of another peer", a)
+				continue
+			}
+			if signed != nil && !multiaddr.Contains(signed, a) {
+				unsigned = append(unsigned, a.String())
+			}
+		}
+		if len(unsigned) > 0 {
+			add(DHTRecordUnsignedAddrs, "%d addresses are not in the signed peer record of the peer: %v", len(unsigned), unsigned)
+		}
+	}
+	return problems
+}
+
+// validatePeerID checks that id is a multihash, and for identity multihashes
+// that it embeds a valid public key
+func validatePeerID(id peer.ID) error {
+	if err := id.Validate(); err != nil {
+		return err
+	}
+	dh, err := multihash.Decode([]byte(id))
+	if err != nil {
+		return err
+	}
+	if dh.Code == multihash.IDENTITY {
+		if _, err := id.ExtractPublicKey(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signedAddrs returns the addresses of the signed peer record of p in ps, nil
+// when it has none
+func signedAddrs(ps peerstore.Peerstore, p peer.ID) []multiaddr.Multiaddr {
+	cab, ok := peerstore.GetCertifiedAddrBook(ps)
+	if !ok {
+		return nil
+	}
+	env := cab.GetPeerRecord(p)
+	if env == nil {
+		return nil
+	}
+	rec, err := env.Record()
+	if err != nil {
+		return nil
+	}
+	pr, ok := rec.(*peer.PeerRecord)
+	if !ok {
+		return nil
+	}
+	return pr.Addrs
+}
@@ -0,0 +1,54 @@
+package check
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnoseDHTAnswer(t *testing.T) {
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	sk, _, err := ic.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	signedPeer, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	signed := multiaddr.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1")
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: signedPeer, Addrs: []multiaddr.Multiaddr{signed}}), sk)
+	require.NoError(t, err)
+	cab, _ := peerstore.GetCertifiedAddrBook(ps)
+	_, err = cab.ConsumePeerRecord(env, time.Hour)
+	require.NoError(t, err)
+
+	server, other := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	require.Empty(t, diagnoseDHTAnswer(ps, server, []*peer.AddrInfo{
+		{ID: signedPeer, Addrs: []multiaddr.Multiaddr{signed}},
+		{ID: other, Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/5.6.7.8/tcp/4001")}},
+	}, nil), "the addresses of peers without a signed record can not be verified")
+
+	junk, err := multihash.Sum([]byte("junk"), multihash.IDENTITY, -1)
+	require.NoError(t, err)
+	problems := diagnoseDHTAnswer(ps, server, []*peer.AddrInfo{
+		{ID: signedPeer, Addrs: []multiaddr.Multiaddr{signed, multiaddr.StringCast("/ip4/6.6.6.6/tcp/4001")}},
+		{ID: other, Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/5.6.7.8/tcp/4001/p2p/" + signedPeer.String())}},
+	}, []*peer.AddrInfo{{ID: peer.ID(junk)}})
+	var codes []string
+	for _, p := range problems {
+		require.Equal(t, server.String(), p.Server)
+		codes = append(codes, p.Code)
+	}
+	require.Equal(t, []string{DHTRecordUnsignedAddrs, DHTRecordMismatchedPeerID, DHTRecordInvalidPeerID}, codes)
+	require.True(t, problems[1].Provider)
+	require.False(t, problems[2].Provider, "the invalid peer was returned as a closer peer")
+}
@@ -0,0 +1,74 @@
+package check
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	dhtpb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const propagationQueryTimeout = 5 * time.Second
+
+// RecordPropagationOutput tells how many of the DHT servers closest to a CID,
+// which are the ones a provide stores records on and lookups query, hold a
+// provider record of the peer. The DHT protocol does not expose the age of
+// provider records, so expiring records show as partial propagation.
+type RecordPropagationOutput struct {
+	// ClosestPeers is the number of closest DHT servers found, and Responded
+	// the number of them that answered GET_PROVIDERS
+	ClosestPeers int
+	Responded    int
+	// Holders are the DHT servers holding a provider record of the peer
+	Holders []string
+	// Partial is whether some, but not all, of the DHT servers that answered
+	// hold a provider record, i.e. the peer provided the CID but its records
+	// are expiring or did not reach all the closest servers
+	Partial bool
+	Error   string
+}
+
+// checkRecordPropagation asks each of the DHT servers closest to c whether
+// they hold a provider record of p
+func checkRecordPropagation(ctx context.Context, d DHT, messenger *dhtpb.ProtocolMessenger, c cid.Cid, p peer.ID) *RecordPropagationOutput {
+	out := &RecordPropagationOutput{Holders: []string{}}
+	closestPeers, err := d.GetClosestPeers(ctx, string(c.Hash()))
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.ClosestPeers = len(closestPeers)
+
+	// Unlike the other DHT queries, wait for every server to answer or time out
+	ctx, cancel := context.WithTimeout(ctx, propagationQueryTimeout)
+	defer cancel()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, server := range closestPeers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			provs, _, err := messenger.GetProviders(ctx, server, c.Hash())
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			out.Responded++
+			for _, prov := range provs {
+				if prov.ID == p {
+					out.Holders = append(out.Holders, server.String())
+					break
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(out.Holders)
+	out.Partial = len(out.Holders) > 0 && len(out.Holders) < out.Responded
+	return out
+}
@@ -0,0 +1,104 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// protocolProbeTimeout bounds negotiating each protocol with the peer
+const protocolProbeTimeout = 5 * time.Second
+
+type namedProtocol struct {
+	name string
+	id   protocol.ID
+}
+
+// probedProtocols are the protocols whose support is reported, by name
+var probedProtocols = []namedProtocol{
+	{"Bitswap 1.2.0", bsnet.ProtocolBitswap},
+	{"Bitswap 1.1.0", bsnet.ProtocolBitswapOneOne},
+	{"Bitswap 1.0.0", bsnet.ProtocolBitswapOneZero},
+	{"GraphSync 2.0.0", "/ipfs/graphsync/2.0.0"},
+	{"DCUtR", holepunch.Protocol},
+	{"Identify push", identify.IDPush},
+	{"Ping", ping.ID},
+	{"Circuit relay v2 hop", proto.ProtoIDv2Hop},
+}
+
+// ProtocolSupportOutput tells whether the peer supports a protocol
+type ProtocolSupportOutput struct {
+	Name     string
+	Protocol string
+	// Advertised is whether the peer lists the protocol over identify
+	Advertised bool
+	// Supported is whether the peer advertises the protocol or accepted to
+	// negotiate it
+	Supported bool
+	// Error is why the protocol could not be probed, empty if the peer
+	// refused to negotiate it
+	Error string
+}
+
+// checkProtocols reports which of probedProtocols and the DHT protocol peer
+// p, which h is connected to and has identified, supports. The protocols the
+// peer does not advertise over identify are negotiated on a new stream, which
+// is reset right away.
+func (ck *Checker) checkProtocols(ctx context.Context, h host.Host, p peer.ID) []ProtocolSupportOutput {
+	protocols := append(slices.Clone(probedProtocols), namedProtocol{"Kademlia DHT", ck.dhtProtocol})
+
+	out := make([]ProtocolSupportOutput, len(protocols))
+	var wg sync.WaitGroup
+	for i, np := range protocols {
+		out[i] = ProtocolSupportOutput{Name: np.name, Protocol: string(np.id)}
+		supported, err := h.Peerstore().SupportsProtocols(p, np.id)
+		if err == nil && len(supported) > 0 {
+			out[i].Advertised = true
+			out[i].Supported = true
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			supported, err := probeProtocol(ctx, h, p, np.id)
+			out[i].Supported = supported
+			if err != nil {
+				out[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// probeProtocol negotiates protocol id with p over a new stream. It returns
+// an error if the stream could not be opened or negotiation failed for
+// another reason than the peer not supporting the protocol.
+func probeProtocol(ctx context.Context, h host.Host, p peer.ID, id protocol.ID) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, protocolProbeTimeout)
+	defer cancel()
+	ctx = network.WithNoDial(ctx, "protocol probe")
+	ctx = network.WithAllowLimitedConn(ctx, "protocol probe")
+	s, err := h.NewStream(ctx, p, id)
+	if errors.Is(err, msmux.ErrNotSupported[protocol.ID]{}) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_ = s.Reset()
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckProtocols(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	target, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer target.Close()
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+	sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	require.NoError(t, err)
+	defer sub.Close()
+	require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()}))
+
+	supported, err := probeProtocol(ctx, h, target.ID(), ping.ID)
+	require.NoError(t, err)
+	require.True(t, supported)
+	supported, err = probeProtocol(ctx, h, target.ID(), "/ipfs/graphsync/2.0.0")
+	require.NoError(t, err, "refusing a protocol is not an error")
+	require.False(t, supported)
+
+	waitForIdentify(ctx, sub, target.ID())
+	ck := &Checker{dhtProtocol: "/test/kad/1.0.0"}
+	out := ck.checkProtocols(ctx, h, target.ID())
+	require.Len(t, out, len(probedProtocols)+1)
+	byName := make(map[string]ProtocolSupportOutput)
+	for _, p := range out {
+		byName[p.Name] = p
+	}
+	require.True(t, byName["Ping"].Advertised)
+	require.True(t, byName["Ping"].Supported)
+	require.True(t, byName["Identify push"].Supported)
+	require.False(t, byName["Bitswap 1.2.0"].Supported)
+	require.Empty(t, byName["Bitswap 1.2.0"].Error)
+	require.False(t, byName["Kademlia DHT"].Supported)
+	require.Equal(t, "/test/kad/1.0.0", byName["Kademlia DHT"].Protocol)
+}
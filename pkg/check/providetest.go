@@ -0,0 +1,60 @@
+package check
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// ProvideTestOutput is the result of providing a throwaway CID to the DHT and
+// checking that its provider record can be retrieved, a canary for the health
+// of the DHT
+type ProvideTestOutput struct {
+	// CID is the random CID that was provided
+	CID string
+	// ProvideDuration is how long providing the CID took
+	ProvideDuration time.Duration
+	// Propagation tells how many of the DHT servers closest to the CID hold
+	// the provider record, nil if the CID could not be provided
+	Propagation *RecordPropagationOutput
+	// LookupDuration is how long asking the closest DHT servers for the
+	// provider record took
+	LookupDuration time.Duration
+	// Retrievable is whether at least one DHT server returned the record
+	Retrievable bool
+	Error       string
+}
+
+// ProvideTest provides a random CID to the DHT from the host of the checker,
+// then asks the DHT servers closest to the CID for its provider record. The
+// record is not republished and expires from the DHT with time.
+func (ck *Checker) ProvideTest(ctx context.Context) (*ProvideTestOutput, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	if err != nil {
+		return nil, err
+	}
+	c := cid.NewCidV1(cid.Raw, mh)
+	out := &ProvideTestOutput{CID: c.String()}
+
+	routing := ck.timedRouting()
+	start := time.Now()
+	err = routing.Provide(ctx, c, true)
+	out.ProvideDuration = since(&start)
+	if err != nil {
+		out.Error = fmt.Errorf("providing %s: %w", c, err).Error()
+		return out, nil
+	}
+
+	out.Propagation = checkRecordPropagation(ctx, routing, ck.dhtMessenger, c, ck.h.ID())
+	out.LookupDuration = since(&start)
+	out.Retrievable = len(out.Propagation.Holders) > 0
+	return out, nil
+}
@@ -0,0 +1,156 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// publicDenylistFetchTimeout bounds the download of a public denylist, which
+// can be tens of megabytes
+const publicDenylistFetchTimeout = 5 * time.Minute
+
+// PublicDenylist is a list of CIDs public gateways refuse to serve, e.g. the
+// badbits list. Unlike the Denylist, it does not stop the checker from
+// checking the CIDs: the checks report whether the CID is listed, to explain
+// why gateways refuse content that is otherwise retrievable. It is safe for
+// concurrent use.
+type PublicDenylist struct {
+	name string
+	// source is the http(s) URL or the path of the list
+	source string
+
+	mu        sync.RWMutex
+	list      *Denylist
+	updatedAt time.Time
+	err       error
+}
+
+// DenylistOutput tells whether the checked CID is in a public denylist
+type DenylistOutput struct {
+	// Name identifies the denylist, e.g. badbits
+	Name   string
+	Listed bool
+	// UpdatedAt is when the denylist was last loaded, nil if it never was, in
+	// which case Listed is false
+	UpdatedAt *time.Time
+	// Error is why the denylist could not be loaded the last time
+	Error string
+}
+
+// NewPublicDenylist returns the public denylist name, read from source: an
+// http(s) URL or the path of a file, in the format of the CID files of the
+// Denylist. The list is empty until Load is called.
+func NewPublicDenylist(name, source string) *PublicDenylist {
+	return &PublicDenylist{name: name, source: source}
+}
+
+// Name returns the name of the denylist
+func (l *PublicDenylist) Name() string {
+	return l.name
+}
+
+// Load reads the denylist from its source, replacing the loaded one. The
+// previously loaded list is kept if it fails.
+func (l *PublicDenylist) Load(ctx context.Context) error {
+	list, err := l.read(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+	if err != nil {
+		return err
+	}
+	l.list = list
+	l.updatedAt = time.Now()
+	return nil
+}
+
+func (l *PublicDenylist) read(ctx context.Context) (*Denylist, error) {
+	list := &Denylist{cids: make(map[string]struct{}), hashedCIDs: make(map[string]struct{})}
+	if !strings.HasPrefix(l.source, "http://") && !strings.HasPrefix(l.source, "https://") {
+		if err := list.loadCIDs(l.source); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, publicDenylistFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("fetching %s: %s: %s", l.source, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := list.readCIDs(resp.Body); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", l.source, err)
+	}
+	return list, nil
+}
+
+// Run loads the denylist, then reloads it every interval until ctx is done,
+// so updates of the list are picked up
+func (l *PublicDenylist) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := l.Load(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error loading the public denylist %s: %v\n", l.name, err)
+		} else if err == nil {
+			log.Printf("Loaded the public denylist %s: %d CIDs\n", l.name, l.Len())
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Len returns the number of CIDs of the loaded denylist
+func (l *PublicDenylist) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.list.Len()
+}
+
+// lookup tells whether c is in the denylist
+func (l *PublicDenylist) lookup(c cid.Cid) DenylistOutput {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := DenylistOutput{Name: l.name, Listed: l.list.deniesCID(c)}
+	if l.list != nil {
+		updatedAt := l.updatedAt
+		out.UpdatedAt = &updatedAt
+	}
+	if l.err != nil {
+		out.Error = l.err.Error()
+	}
+	return out
+}
+
+// lookupPublicDenylists tells which of the public denylists of the checker
+// list c, nil if there are none
+func (ck *Checker) lookupPublicDenylists(c cid.Cid) []DenylistOutput {
+	if len(ck.publicDenylists) == 0 {
+		return nil
+	}
+	out := make([]DenylistOutput, 0, len(ck.publicDenylists))
+	for _, l := range ck.publicDenylists {
+		out = append(out, l.lookup(c))
+	}
+	return out
+}
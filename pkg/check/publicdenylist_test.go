@@ -0,0 +1,62 @@
+package check
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicDenylist(t *testing.T) {
+	listed := cid.MustParse("bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi")
+	sum := sha256.Sum256([]byte(listed.String() + "/"))
+	list := "//" + hex.EncodeToString(sum[:]) + "\n"
+	notListed := cid.MustParse("bafkqaaa")
+
+	served := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !served {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(list))
+	}))
+	defer srv.Close()
+
+	l := NewPublicDenylist("badbits", srv.URL)
+	require.Equal(t, DenylistOutput{Name: "badbits"}, l.lookup(listed), "the list is empty until loaded")
+
+	require.NoError(t, l.Load(context.Background()))
+	out := l.lookup(listed)
+	require.True(t, out.Listed)
+	require.NotNil(t, out.UpdatedAt)
+	require.Empty(t, out.Error)
+	require.True(t, l.lookup(cid.NewCidV0(listed.Hash())).Listed)
+	require.False(t, l.lookup(notListed).Listed)
+
+	served = false
+	require.Error(t, l.Load(context.Background()))
+	out = l.lookup(listed)
+	require.True(t, out.Listed, "the loaded list is kept when reloading fails")
+	require.Contains(t, out.Error, "503 Service Unavailable")
+
+	path := filepath.Join(t.TempDir(), "local.deny")
+	require.NoError(t, os.WriteFile(path, []byte("/ipfs/"+notListed.String()+"\n"), 0o644))
+	local := NewPublicDenylist("local", path)
+	require.NoError(t, local.Load(context.Background()))
+	require.Equal(t, 1, local.Len())
+
+	ck := &Checker{publicDenylists: []*PublicDenylist{l, local}}
+	outs := ck.lookupPublicDenylists(notListed)
+	require.Len(t, outs, 2)
+	require.False(t, outs[0].Listed)
+	require.True(t, outs[1].Listed)
+	require.Nil(t, (&Checker{}).lookupPublicDenylists(notListed))
+}
@@ -0,0 +1,76 @@
+package check
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Metrics the providers of a CID check are ranked by with Options.RankBy
+const (
+	// RankByLatency ranks first the providers that answered the Bitswap
+	// request, or served the block over HTTP, the fastest
+	RankByLatency = "latency"
+	// RankByThroughput ranks first the providers that sent the block the
+	// fastest. It requires Options.FetchBlock.
+	RankByThroughput = "throughput"
+)
+
+// RankMetrics lists the values of Options.RankBy
+var RankMetrics = []string{RankByLatency, RankByThroughput}
+
+// RankProviders orders the providers of a CID check by the metric, one of
+// RankMetrics, from the recommended one, and sets their Rank. The providers
+// that do not serve the CID, or for which the metric was not measured, are
+// not ranked and come last, in their previous order.
+func RankProviders(providers []ProviderOutput, metric string) {
+	for i := range providers {
+		providers[i].Rank = 0
+	}
+	slices.SortStableFunc(providers, func(a, b ProviderOutput) int {
+		la, oka := rankValue(&a, metric)
+		lb, okb := rankValue(&b, metric)
+		switch {
+		case oka && !okb:
+			return -1
+		case okb && !oka:
+			return 1
+		case !oka && !okb:
+			return 0
+		}
+		return cmp.Compare(la, lb)
+	})
+	for i := range providers {
+		if _, ok := rankValue(&providers[i], metric); !ok {
+			break
+		}
+		providers[i].Rank = i + 1
+	}
+}
+
+// rankValue returns the value of the metric of the provider, lower being
+// better, and false if the provider can not be ranked by it
+func rankValue(p *ProviderOutput, metric string) (float64, bool) {
+	if !p.Available() {
+		return 0, false
+	}
+	switch metric {
+	case RankByLatency:
+		return float64(retrievalLatency(p)), true
+	case RankByThroughput:
+		if p.DataAvailableOverBitswap.BytesPerSecond <= 0 {
+			return 0, false
+		}
+		return -p.DataAvailableOverBitswap.BytesPerSecond, true
+	}
+	return 0, false
+}
+
+// retrievalLatency returns how long the provider took to answer over Bitswap,
+// or over HTTP if it only served the block there
+func retrievalLatency(p *ProviderOutput) time.Duration {
+	if p.ConnectionError == "" && p.DataAvailableOverBitswap.Found {
+		return p.DataAvailableOverBitswap.Duration
+	}
+	return p.DataAvailableOverHTTP.Duration
+}
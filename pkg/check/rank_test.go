@@ -0,0 +1,38 @@
+package check
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankProviders(t *testing.T) {
+	bitswap := func(id string, d time.Duration, bps float64) ProviderOutput {
+		return ProviderOutput{ID: id, DataAvailableOverBitswap: BitswapCheckOutput{Found: true, Duration: d, BytesPerSecond: bps}}
+	}
+	providers := []ProviderOutput{
+		{ID: "unreachable", ConnectionError: "no route"},
+		bitswap("slow", 3*time.Second, 2e6),
+		{ID: "http", DataAvailableOverHTTP: &HTTPCheckOutput{Found: true, Duration: 2 * time.Second}},
+		bitswap("fast", time.Second, 1e6),
+		{ID: "missing", DataAvailableOverBitswap: BitswapCheckOutput{Responded: true}},
+	}
+	ids := func() []string {
+		var out []string
+		for _, p := range providers {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	RankProviders(providers, RankByLatency)
+	require.Equal(t, []string{"fast", "http", "slow", "unreachable", "missing"}, ids())
+	require.Equal(t, []int{1, 2, 3, 0, 0}, []int{providers[0].Rank, providers[1].Rank, providers[2].Rank, providers[3].Rank, providers[4].Rank})
+
+	// The provider that only served the block over HTTP has no Bitswap
+	// throughput
+	RankProviders(providers, RankByThroughput)
+	require.Equal(t, []string{"slow", "fast", "http", "unreachable", "missing"}, ids())
+	require.Equal(t, []int{1, 2, 0}, []int{providers[0].Rank, providers[1].Rank, providers[2].Rank})
+}
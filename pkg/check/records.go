@@ -0,0 +1,73 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/routing/http/client"
+	"github.com/ipfs/boxo/routing/http/contentrouter"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ProviderRecordsOutput is the result of looking up the provider records of a
+// CID in the DHT and in IPNI
+type ProviderRecordsOutput struct {
+	// DHT and IPNI are the IDs of the providers found in each system
+	DHT  []string
+	IPNI []string
+	// Duration is how long the lookups took
+	Duration time.Duration
+	Error    string
+}
+
+// LookupProviderRecords looks up the provider records of c in the DHT and in
+// opts.IPNIIndexer concurrently, until both lookups end or timeout elapses.
+// Unlike CheckCID, the providers are not checked.
+func (ck *Checker) LookupProviderRecords(ctx context.Context, c cid.Cid, opts Options, timeout time.Duration) ProviderRecordsOutput {
+	opts = opts.withDefaults()
+	out := ProviderRecordsOutput{DHT: []string{}, IPNI: []string{}}
+	if ck.denylist.deniesCID(c) {
+		out.Error = ErrDeniedCID.Error()
+		return out
+	}
+	start := time.Now()
+	crClient, err := client.New(opts.IPNIIndexer,
+		client.WithStreamResultsRequired(),
+		client.WithProtocolFilter(defaultProtocolFilter),
+		client.WithDisabledLocalFiltering(false),
+	)
+	if err != nil {
+		out.Error = fmt.Errorf("failed to create content router client: %w", err).Error()
+		return out
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var inDHT, inIPNI map[peer.ID]struct{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		inDHT = findAllProviders(ctx, ck.timedRouting(), c)
+	}()
+	go func() {
+		defer wg.Done()
+		inIPNI = findAllProviders(ctx, contentrouter.NewContentRoutingClient(crClient), c)
+	}()
+	wg.Wait()
+	out.Duration = time.Since(start)
+
+	for p := range inDHT {
+		out.DHT = append(out.DHT, p.String())
+	}
+	for p := range inIPNI {
+		out.IPNI = append(out.IPNI, p.String())
+	}
+	slices.Sort(out.DHT)
+	slices.Sort(out.IPNI)
+	return out
+}
@@ -0,0 +1,262 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	circuitpb "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	circuitproto "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	circuitutil "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// RelayCheckOutput reports each stage of reaching a peer through a relay, so
+// it is clear whether the relay or the peer's NAT is the problem
+type RelayCheckOutput struct {
+	// RelayAddr is the /p2p-circuit address of the peer that was checked
+	RelayAddr string
+	// RelayConnectionError is the error connecting to the relay itself
+	RelayConnectionError string
+	// CircuitConnectionError is the error connecting to the peer through the
+	// relay, which usually means the peer has no reservation with the relay
+	CircuitConnectionError string
+	// HolePunchError is the error upgrading the relayed connection to a direct one
+	HolePunchError string
+	// DirectConnectionMaddrs are the addresses of the direct connections
+	// established by hole punching
+	DirectConnectionMaddrs []string
+}
+
+// checkRelays checks every relay address of p, stage by stage
+func (ck *Checker) checkRelays(ctx context.Context, p peer.ID, addrs []multiaddr.Multiaddr, timeout time.Duration) []RelayCheckOutput {
+	var relayAddrs []multiaddr.Multiaddr
+	for _, addr := range addrs {
+		if isRelayAddr(addr) {
+			relayAddrs = append(relayAddrs, addr)
+		}
+	}
+
+	out := make([]RelayCheckOutput, len(relayAddrs))
+	var wg sync.WaitGroup
+	for i, addr := range relayAddrs {
+		wg.Add(1)
+		go func(i int, addr multiaddr.Multiaddr) {
+			defer wg.Done()
+			out[i] = ck.checkRelay(ctx, p, addr, timeout)
+		}(i, addr)
+	}
+	wg.Wait()
+	return out
+}
+
+func (ck *Checker) checkRelay(ctx context.Context, p peer.ID, addr multiaddr.Multiaddr, timeout time.Duration) RelayCheckOutput {
+	out := RelayCheckOutput{RelayAddr: addr.String()}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	testHost, err := ck.newTestHost()
+	if err != nil {
+		out.RelayConnectionError = err.Error()
+		return out
+	}
+	defer testHost.Close()
+
+	// Can we reach the relay?
+	relayAddr, _ := multiaddr.SplitFunc(addr, func(c multiaddr.Component) bool {
+		return c.Protocol().Code == multiaddr.P_CIRCUIT
+	})
+	relay, err := peer.AddrInfoFromP2pAddr(relayAddr)
+	if err != nil {
+		out.RelayConnectionError = fmt.Sprintf("invalid relay address %s: %s", relayAddr, err)
+		return out
+	}
+	if err := testHost.Connect(ctx, *relay); err != nil {
+		out.RelayConnectionError = err.Error()
+		return out
+	}
+
+	// Does the relay accept a connection to the peer?
+	if err := testHost.Connect(ctx, peer.AddrInfo{ID: p, Addrs: []multiaddr.Multiaddr{addr}}); err != nil {
+		out.CircuitConnectionError = err.Error()
+		return out
+	}
+
+	// Does hole punching upgrade the relayed connection to a direct one? New
+	// streams wait for a direct connection when only a limited one exists.
+	_, err = testHost.NewStream(ctx, p, "/ipfs/bitswap/1.2.0", "/ipfs/bitswap/1.1.0", "/ipfs/bitswap/1.0.0", "/ipfs/bitswap")
+	if err != nil {
+		out.HolePunchError = err.Error()
+	}
+	for _, c := range testHost.Network().ConnsToPeer(p) {
+		if !c.Stat().Limited {
+			out.DirectConnectionMaddrs = append(out.DirectConnectionMaddrs, c.RemoteMultiaddr().String())
+		}
+	}
+	if err == nil && len(out.DirectConnectionMaddrs) == 0 {
+		out.HolePunchError = "no direct connection was established"
+	}
+	return out
+}
+
+// Statuses of RelayReservationOutput, from the answer of the relay to a
+// request to connect to the peer
+const (
+	// ReservationActive is when the relay accepted to connect to the peer
+	ReservationActive = "active"
+	// ReservationMissing is when the relay has no reservation of the peer,
+	// e.g. because it expired and was not refreshed
+	ReservationMissing = "no-reservation"
+	// ReservationPeerUnreachable is when the peer has a reservation, but the
+	// relay failed to reach it over it
+	ReservationPeerUnreachable = "peer-unreachable"
+	// ReservationRelayOverloaded is when the relay refused the connection as
+	// it reached its resource limits
+	ReservationRelayOverloaded = "relay-overloaded"
+	// ReservationPermissionDenied is when the relay refused to connect to the
+	// peer, e.g. because of an ACL
+	ReservationPermissionDenied = "permission-denied"
+	// ReservationNotARelay is when the relay does not run a circuit relay v2
+	// service
+	ReservationNotARelay = "not-a-relay"
+)
+
+// relayMaxMessageSize bounds the messages of the circuit relay v2 protocol
+const relayMaxMessageSize = 4096
+
+// RelayReservationOutput is the status of the reservation of the peer with a
+// relay of its relay addresses. Relays do not report reservations, so the
+// relay is asked to connect to the peer, and its answer tells whether the
+// peer holds a reservation. Expired reservations are a silent cause of peers
+// behind NATs becoming unreachable.
+type RelayReservationOutput struct {
+	RelayPeerID string
+	// RelayAddrs are the addresses of the relay in the relay addresses of the peer
+	RelayAddrs []string
+	// Status is one of the Reservation constants, empty if the relay could not
+	// be asked, and Error why not or the answer of the relay otherwise
+	Status string
+	Error  string
+	// LimitDuration and LimitData are the limits of the connections relayed
+	// to the peer, zero if unlimited
+	LimitDuration time.Duration
+	LimitData     uint64
+}
+
+// checkRelayReservations asks each relay of the relay addresses of p whether p
+// holds a reservation with it, concurrently
+func (ck *Checker) checkRelayReservations(ctx context.Context, p peer.ID, addrs []multiaddr.Multiaddr, timeout time.Duration) []RelayReservationOutput {
+	var relays []*peer.AddrInfo
+	var badAddrs []string
+	for _, addr := range addrs {
+		if !isRelayAddr(addr) {
+			continue
+		}
+		relayAddr, _ := multiaddr.SplitFunc(addr, func(c multiaddr.Component) bool {
+			return c.Protocol().Code == multiaddr.P_CIRCUIT
+		})
+		relay, err := peer.AddrInfoFromP2pAddr(relayAddr)
+		if err != nil {
+			badAddrs = append(badAddrs, addr.String())
+			continue
+		}
+		i := slices.IndexFunc(relays, func(r *peer.AddrInfo) bool { return r.ID == relay.ID })
+		if i < 0 {
+			relays = append(relays, &peer.AddrInfo{ID: relay.ID})
+			i = len(relays) - 1
+		}
+		relays[i].Addrs = append(relays[i].Addrs, relay.Addrs...)
+	}
+
+	out := make([]RelayReservationOutput, len(relays))
+	var wg sync.WaitGroup
+	for i, relay := range relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out[i] = ck.checkRelayReservation(ctx, p, *relay, timeout)
+		}()
+	}
+	wg.Wait()
+	for _, addr := range badAddrs {
+		out = append(out, RelayReservationOutput{RelayAddrs: []string{addr}, Error: "invalid relay address"})
+	}
+	return out
+}
+
+// checkRelayReservation sends a circuit relay v2 CONNECT request for p to the
+// relay, and closes the relayed stream if the relay opens one
+func (ck *Checker) checkRelayReservation(ctx context.Context, p peer.ID, relay peer.AddrInfo, timeout time.Duration) RelayReservationOutput {
+	out := RelayReservationOutput{RelayPeerID: relay.ID.String()}
+	for _, a := range relay.Addrs {
+		out.RelayAddrs = append(out.RelayAddrs, a.String())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	testHost, err := ck.newIsolatedHost()
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	defer testHost.Close()
+	if err := testHost.Connect(ctx, relay); err != nil {
+		out.Error = fmt.Sprintf("connecting to the relay: %s", err)
+		return out
+	}
+	s, err := testHost.NewStream(ctx, relay.ID, circuitproto.ProtoIDv2Hop)
+	if err != nil {
+		out.Status = ReservationNotARelay
+		out.Error = err.Error()
+		return out
+	}
+	// The stream is relayed to the peer if the relay accepts, and is of no use
+	defer func() { _ = s.Reset() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+
+	rd := circuitutil.NewDelimitedReader(s, relayMaxMessageSize)
+	defer rd.Close()
+	msg := circuitpb.HopMessage{
+		Type: circuitpb.HopMessage_CONNECT.Enum(),
+		Peer: circuitutil.PeerInfoToPeerV2(peer.AddrInfo{ID: p}),
+	}
+	if err := circuitutil.NewDelimitedWriter(s).WriteMsg(&msg); err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	msg.Reset()
+	if err := rd.ReadMsg(&msg); err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	if msg.GetType() != circuitpb.HopMessage_STATUS {
+		out.Error = fmt.Sprintf("unexpected answer of the relay: %s", msg.GetType())
+		return out
+	}
+
+	switch msg.GetStatus() {
+	case circuitpb.Status_OK:
+		out.Status = ReservationActive
+		if limit := msg.GetLimit(); limit != nil {
+			out.LimitDuration = time.Duration(limit.GetDuration()) * time.Second
+			out.LimitData = limit.GetData()
+		}
+		return out
+	case circuitpb.Status_NO_RESERVATION:
+		out.Status = ReservationMissing
+	case circuitpb.Status_CONNECTION_FAILED:
+		out.Status = ReservationPeerUnreachable
+	case circuitpb.Status_RESOURCE_LIMIT_EXCEEDED, circuitpb.Status_RESERVATION_REFUSED:
+		out.Status = ReservationRelayOverloaded
+	case circuitpb.Status_PERMISSION_DENIED:
+		out.Status = ReservationPermissionDenied
+	}
+	out.Error = fmt.Sprintf("the relay answered %s", msg.GetStatus())
+	return out
+}
@@ -0,0 +1,146 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRelayReservations(t *testing.T) {
+	ctx := context.Background()
+	newHost := func() (host.Host, error) {
+		return libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	}
+
+	relayHost, err := newHost()
+	require.NoError(t, err)
+	defer relayHost.Close()
+	_, err = relay.New(relayHost)
+	require.NoError(t, err)
+	notRelayHost, err := newHost()
+	require.NoError(t, err)
+	defer notRelayHost.Close()
+
+	// The peer holds a reservation with the relay, but not with the other one
+	reserved, err := libp2p.New(libp2p.NoListenAddrs, libp2p.EnableRelay())
+	require.NoError(t, err)
+	defer reserved.Close()
+	relayInfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, reserved.Connect(ctx, relayInfo))
+	_, err = client.Reserve(ctx, reserved, relayInfo)
+	require.NoError(t, err)
+	unreserved, err := newHost()
+	require.NoError(t, err)
+	defer unreserved.Close()
+
+	circuitAddr := func(relay host.Host) multiaddr.Multiaddr {
+		return multiaddr.StringCast(relay.Addrs()[0].String() + "/p2p/" + relay.ID().String() + "/p2p-circuit")
+	}
+	ck := &Checker{newIsolatedHost: newHost}
+
+	out := ck.checkRelayReservations(ctx, reserved.ID(), []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/127.0.0.1/tcp/1"),
+		circuitAddr(relayHost),
+		circuitAddr(notRelayHost),
+	}, 10*time.Second)
+	require.Len(t, out, 2, "one result per relay")
+	require.Equal(t, relayHost.ID().String(), out[0].RelayPeerID)
+	require.Equal(t, ReservationActive, out[0].Status, out[0].Error)
+	require.NotZero(t, out[0].LimitDuration, "relays limit the relayed connections by default")
+	require.Equal(t, notRelayHost.ID().String(), out[1].RelayPeerID)
+	require.Equal(t, ReservationNotARelay, out[1].Status)
+
+	out = ck.checkRelayReservations(ctx, unreserved.ID(), []multiaddr.Multiaddr{circuitAddr(relayHost)}, 10*time.Second)
+	require.Equal(t, ReservationMissing, out[0].Status)
+	require.NotEmpty(t, out[0].Error)
+}
+
+func TestCheckRelay(t *testing.T) {
+	ctx := context.Background()
+	newHost := func(opts ...libp2p.Option) host.Host {
+		h, err := libp2p.New(append([]libp2p.Option{libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0")}, opts...)...)
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+
+	relayHost := newHost()
+	_, err := relay.New(relayHost)
+	require.NoError(t, err)
+	notRelayHost := newHost()
+	relayInfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	newReservedPeer := func() host.Host {
+		h := newHost(libp2p.EnableRelay())
+		require.NoError(t, h.Connect(ctx, relayInfo))
+		_, err := client.Reserve(ctx, h, relayInfo)
+		require.NoError(t, err)
+		h.SetStreamHandler("/ipfs/bitswap/1.2.0", func(s network.Stream) { _ = s.Close() })
+		return h
+	}
+	circuitAddr := func(relay host.Host) multiaddr.Multiaddr {
+		return multiaddr.StringCast(relay.Addrs()[0].String() + "/p2p/" + relay.ID().String() + "/p2p-circuit")
+	}
+
+	// Each check gets a new test host, which the peers can dial back
+	var (
+		testHost  host.Host
+		testAddrs []multiaddr.Multiaddr
+	)
+	ck := &Checker{newTestHost: func() (host.Host, error) { return testHost, nil }}
+	check := func(p host.Host, addr multiaddr.Multiaddr, timeout time.Duration) RelayCheckOutput {
+		testHost = newHost()
+		testAddrs = testHost.Addrs()
+		return ck.checkRelay(ctx, p.ID(), addr, timeout)
+	}
+
+	// The relay can not be reached
+	reserved := newReservedPeer()
+	closed := multiaddr.StringCast("/ip4/127.0.0.1/tcp/1/p2p/" + relayHost.ID().String() + "/p2p-circuit")
+	out := check(reserved, closed, 5*time.Second)
+	require.Equal(t, closed.String(), out.RelayAddr)
+	require.NotEmpty(t, out.RelayConnectionError)
+	require.Empty(t, out.CircuitConnectionError)
+
+	// The relay is reached, but does not relay connections to the peer
+	out = check(reserved, circuitAddr(notRelayHost), 5*time.Second)
+	require.Empty(t, out.RelayConnectionError)
+	require.NotEmpty(t, out.CircuitConnectionError)
+	out = check(newHost(), circuitAddr(relayHost), 5*time.Second)
+	require.Empty(t, out.RelayConnectionError)
+	require.NotEmpty(t, out.CircuitConnectionError, "the peer has no reservation")
+
+	// The peer is reached through the relay, but no direct connection follows
+	out = check(reserved, circuitAddr(relayHost), 3*time.Second)
+	require.Empty(t, out.RelayConnectionError)
+	require.Empty(t, out.CircuitConnectionError)
+	require.NotEmpty(t, out.HolePunchError)
+	require.Empty(t, out.DirectConnectionMaddrs)
+
+	// The peer connects back directly over the relayed connection, which
+	// hole punching can not do over loopback addresses
+	reversed := newReservedPeer()
+	reversed.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			if !c.Stat().Limited {
+				return
+			}
+			ai := peer.AddrInfo{ID: c.RemotePeer(), Addrs: testAddrs}
+			go func() { _ = reversed.Connect(network.WithForceDirectDial(ctx, "test"), ai) }()
+		},
+	})
+	out = check(reversed, circuitAddr(relayHost), 5*time.Second)
+	require.Empty(t, out.RelayConnectionError)
+	require.Empty(t, out.CircuitConnectionError)
+	require.Empty(t, out.HolePunchError)
+	require.Len(t, out.DirectConnectionMaddrs, 1)
+	require.False(t, isRelayAddr(multiaddr.StringCast(out.DirectConnectionMaddrs[0])))
+}
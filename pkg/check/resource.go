@@ -0,0 +1,57 @@
+package check
+
+import (
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+)
+
+// The auto-scaled resource limits give the DHT and IPNI lookups of the host a
+// base budget, plus a budget for each check that can run at the same time
+const (
+	baseConns      = 256
+	connsPerCheck  = 64
+	streamsPerConn = 4
+	baseMemory     = 256 << 20
+	memoryPerCheck = 32 << 20
+)
+
+// ResourceLimits bound the resources of the libp2p host of the checker, all
+// connections and streams included. Zero values are unlimited.
+type ResourceLimits struct {
+	Conns   int
+	Streams int
+	// Memory is the memory reserved by the connections and streams, in bytes
+	Memory int64
+}
+
+// AutoResourceLimits returns limits scaled to maxConcurrentChecks checks
+// running at the same time
+func AutoResourceLimits(maxConcurrentChecks int) ResourceLimits {
+	conns := baseConns + maxConcurrentChecks*connsPerCheck
+	return ResourceLimits{
+		Conns:   conns,
+		Streams: conns * streamsPerConn,
+		Memory:  baseMemory + int64(maxConcurrentChecks)*memoryPerCheck,
+	}
+}
+
+// NewResourceManager returns a resource manager enforcing limits, and nothing
+// else
+func NewResourceManager(limits ResourceLimits) (network.ResourceManager, error) {
+	cfg := rcmgr.PartialLimitConfig{
+		System: rcmgr.ResourceLimits{
+			Conns:   rcmgr.LimitVal(limits.Conns),
+			Streams: rcmgr.LimitVal(limits.Streams),
+			Memory:  rcmgr.LimitVal64(limits.Memory),
+		},
+	}.Build(rcmgr.InfiniteLimits)
+	return rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(cfg))
+}
+
+// isResourceLimited returns whether err comes from the resource manager of the
+// checker refusing a connection or stream, rather than from the checked peer
+func isResourceLimited(err error) bool {
+	return errors.Is(err, network.ErrResourceLimitExceeded)
+}
@@ -0,0 +1,76 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsResourceLimited(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	target, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer target.Close()
+
+	limits := rcmgr.PartialLimitConfig{
+		System: rcmgr.ResourceLimits{ConnsOutbound: rcmgr.BlockAllLimit},
+	}.Build(rcmgr.InfiniteLimits)
+	rm, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(limits))
+	require.NoError(t, err)
+	limited, err := libp2p.New(libp2p.NoListenAddrs, libp2p.ResourceManager(rm))
+	require.NoError(t, err)
+	defer limited.Close()
+
+	err = limited.Connect(ctx, peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()})
+	require.Error(t, err)
+	require.True(t, isResourceLimited(err), "the dial was refused by the local resource manager: %v", err)
+
+	// A peer that is not listening fails for another reason
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+	addrs := target.Addrs()
+	require.NoError(t, target.Close())
+	err = h.Connect(ctx, peer.AddrInfo{ID: target.ID(), Addrs: addrs})
+	require.Error(t, err)
+	require.False(t, isResourceLimited(err))
+}
+
+func TestNewResourceManager(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var targets []peer.AddrInfo
+	for range 2 {
+		target, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		defer target.Close()
+		targets = append(targets, peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()})
+	}
+
+	rm, err := NewResourceManager(ResourceLimits{Conns: 1})
+	require.NoError(t, err)
+	h, err := libp2p.New(libp2p.NoListenAddrs, libp2p.ResourceManager(rm))
+	require.NoError(t, err)
+	defer h.Close()
+
+	require.NoError(t, h.Connect(ctx, targets[0]))
+	err = h.Connect(ctx, targets[1])
+	require.True(t, isResourceLimited(err), "only one connection is allowed: %v", err)
+
+}
+
+func TestAutoResourceLimits(t *testing.T) {
+	small, large := AutoResourceLimits(1), AutoResourceLimits(100)
+	require.Less(t, small.Conns, large.Conns)
+	require.Less(t, small.Streams, large.Streams)
+	require.Less(t, small.Memory, large.Memory)
+	require.Greater(t, large.Streams, large.Conns)
+}
@@ -0,0 +1,104 @@
+package check
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// MaxRetries is the maximum of Options.Retries
+const MaxRetries = 5
+
+// errNoBitswapResponse is the error of the Bitswap attempts the peer did not
+// answer in time
+const errNoBitswapResponse = "the peer did not answer the Bitswap request in time"
+
+// AttemptOutput is an attempt of a step of a check that is retried on
+// transient failures
+type AttemptOutput struct {
+	Duration time.Duration
+	// Error is why the attempt failed, empty if it succeeded
+	Error string
+	// Backoff is how long the check waited before the attempt, 0 for the
+	// first one
+	Backoff time.Duration
+}
+
+// retry runs attempt until it succeeds, fails with a non-retryable error or
+// was retried retries times. The first retry waits backoff, and each next one
+// twice as long as the previous one. attempt returns the error of the attempt,
+// empty if it succeeded, and whether it is worth retrying. Every attempt is
+// returned.
+func retry(ctx context.Context, retries int, backoff time.Duration, attempt func() (errStr string, retryable bool)) []AttemptOutput {
+	var attempts []AttemptOutput
+	var wait time.Duration
+	for i := 0; ; i++ {
+		start := time.Now()
+		errStr, retryable := attempt()
+		attempts = append(attempts, AttemptOutput{Duration: time.Since(start), Error: errStr, Backoff: wait})
+		if errStr == "" || !retryable || i >= retries {
+			return attempts
+		}
+
+		if wait == 0 {
+			wait = backoff
+		} else {
+			wait *= 2
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return attempts
+		}
+	}
+}
+
+// retryableBitswap tells whether the Bitswap check of out is worth retrying:
+// the peer did not answer, e.g. because the stream could not be opened. An
+// answer is final, and so are the failures caused by the resource manager of
+// the checker.
+func retryableBitswap(out BitswapCheckOutput) bool {
+	return !out.Responded && !out.ResourceLimited
+}
+
+// checkBitswapCIDWithRetries runs checkBitswapCID, and up to opts.Retries
+// more times while the peer does not answer. It returns the result of the
+// last attempt, with all the Attempts.
+func checkBitswapCIDWithRetries(ctx context.Context, h host.Host, c cid.Cid, ma multiaddr.Multiaddr, opts Options) BitswapCheckOutput {
+	var out BitswapCheckOutput
+	attempts := retry(ctx, opts.Retries, opts.RetryBackoff, func() (string, bool) {
+		out = checkBitswapCID(ctx, h, c, ma, opts.FetchBlock, opts.BitswapTimeout)
+		errStr := out.Error
+		if errStr == "" && !out.Responded {
+			errStr = errNoBitswapResponse
+		}
+		return errStr, retryableBitswap(out) && ctx.Err() == nil
+	})
+	out.Attempts = attempts
+	return out
+}
+
+// connectBitswapWithRetries runs connectBitswap with a timeout of dialTimeout,
+// and up to opts.Retries more times while it fails. A peer ID mismatch and
+// the failures caused by the resource manager of the checker are final. It
+// returns the error and the start of the last attempt, with all the attempts.
+func connectBitswapWithRetries(ctx context.Context, h host.Host, ai peer.AddrInfo, dialTimeout time.Duration, timings *TimingsOutput, opts Options) ([]AttemptOutput, time.Time, error) {
+	var err error
+	var start time.Time
+	attempts := retry(ctx, opts.Retries, opts.RetryBackoff, func() (string, bool) {
+		start = time.Now()
+		dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+		if err = connectBitswap(dialCtx, h, ai, timings); err == nil {
+			return "", false
+		}
+		return err.Error(), peerIDMismatch(err) == nil && !isResourceLimited(err) && ctx.Err() == nil
+	})
+	return attempts, start, err
+}
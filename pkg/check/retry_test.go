@@ -0,0 +1,55 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	var calls int
+	failTwice := func() (string, bool) {
+		calls++
+		if calls <= 2 {
+			return "connection refused", true
+		}
+		return "", false
+	}
+
+	attempts := retry(ctx, 5, time.Millisecond, failTwice)
+	require.Len(t, attempts, 3)
+	require.Equal(t, "connection refused", attempts[0].Error)
+	require.Zero(t, attempts[0].Backoff)
+	require.Equal(t, time.Millisecond, attempts[1].Backoff)
+	require.Equal(t, 2*time.Millisecond, attempts[2].Backoff, "the backoff doubles")
+	require.Empty(t, attempts[2].Error)
+
+	calls = 0
+	attempts = retry(ctx, 1, time.Millisecond, failTwice)
+	require.Len(t, attempts, 2, "at most 1 retry")
+	require.Equal(t, "connection refused", attempts[1].Error)
+
+	calls = 0
+	attempts = retry(ctx, 0, time.Millisecond, failTwice)
+	require.Len(t, attempts, 1, "no retries by default")
+
+	attempts = retry(ctx, 5, time.Millisecond, func() (string, bool) { return "peer id mismatch", false })
+	require.Len(t, attempts, 1, "final errors are not retried")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	attempts = retry(canceled, 5, time.Hour, failTwice)
+	require.Len(t, attempts, 1, "retries stop when the context is done")
+}
+
+func TestRetryableBitswap(t *testing.T) {
+	require.True(t, retryableBitswap(BitswapCheckOutput{}), "the peer did not answer")
+	require.True(t, retryableBitswap(BitswapCheckOutput{Error: "stream reset"}))
+	require.False(t, retryableBitswap(BitswapCheckOutput{Responded: true, ReceivedDontHave: true}))
+	require.False(t, retryableBitswap(BitswapCheckOutput{Responded: true, Error: "the peer sent a block that does not match the CID"}))
+	require.False(t, retryableBitswap(BitswapCheckOutput{Error: "resource limit exceeded", ResourceLimited: true}))
+}
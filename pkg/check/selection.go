@@ -0,0 +1,104 @@
+package check
+
+import (
+	"math/rand/v2"
+	"slices"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Strategies to select the providers checked in a CID check with
+// Options.ProviderSelection
+const (
+	// SelectFirst checks the first Options.MaxProviders providers found,
+	// which gives the fastest answer
+	SelectFirst = "firstN"
+	// SelectRandom checks Options.MaxProviders providers sampled at random
+	// from the providers found, which gives an unbiased sample
+	SelectRandom = "random"
+	// SelectAll checks all the providers found, up to maxProviderCandidates
+	SelectAll = "all"
+)
+
+// ProviderSelections lists the values of Options.ProviderSelection
+var ProviderSelections = []string{SelectFirst, SelectRandom, SelectAll}
+
+// maxProviderCandidates bounds the number of providers collected to select
+// the checked ones from, as popular CIDs have thousands of providers in IPNI
+const maxProviderCandidates = 100
+
+// providerCandidate is a provider found by a source in a CID check
+type providerCandidate struct {
+	peer.AddrInfo
+	source string
+}
+
+// collectProviders collects the providers found by the DHT and IPNI until
+// both lookups end or max providers were found, ignoring duplicates
+func collectProviders(dhtProvs, ipniProvs <-chan peer.AddrInfo, max int) []providerCandidate {
+	var out []providerCandidate
+	seen := make(map[peer.ID]struct{})
+	for (dhtProvs != nil || ipniProvs != nil) && len(out) < max {
+		var provider peer.AddrInfo
+		var open bool
+		var source string
+		select {
+		case provider, open = <-dhtProvs:
+			if !open {
+				dhtProvs = nil
+				continue
+			}
+			source = DHTSource
+		case provider, open = <-ipniProvs:
+			if !open {
+				ipniProvs = nil
+				continue
+			}
+			source = IPNISource
+		}
+		if _, ok := seen[provider.ID]; ok {
+			continue
+		}
+		seen[provider.ID] = struct{}{}
+		out = append(out, providerCandidate{AddrInfo: provider, source: source})
+	}
+	return out
+}
+
+// selectProviders returns the candidates to check with the strategy, at most
+// n unless it is SelectAll. With preferQUIC, the providers with public QUIC
+// addresses are selected before the others.
+func selectProviders(candidates []providerCandidate, n int, strategy string, preferQUIC bool) []providerCandidate {
+	candidates = slices.Clone(candidates)
+	if strategy == SelectRandom {
+		rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+	}
+	if preferQUIC {
+		slices.SortStableFunc(candidates, func(a, b providerCandidate) int {
+			switch qa, qb := hasPublicQUIC(a.AddrInfo), hasPublicQUIC(b.AddrInfo); {
+			case qa && !qb:
+				return -1
+			case qb && !qa:
+				return 1
+			}
+			return 0
+		})
+	}
+	if strategy != SelectAll && len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// hasPublicQUIC returns whether the provider has a public QUIC address
+func hasPublicQUIC(ai peer.AddrInfo) bool {
+	for _, a := range ai.Addrs {
+		if manet.IsPublicAddr(a) && usesTransport(a, TransportQUIC) {
+			return true
+		}
+	}
+	return false
+}
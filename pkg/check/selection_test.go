@@ -0,0 +1,55 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectProviders(t *testing.T) {
+	p1, p2 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	dhtProvs := make(chan peer.AddrInfo, 2)
+	ipniProvs := make(chan peer.AddrInfo, 2)
+	dhtProvs <- peer.AddrInfo{ID: p1}
+	close(dhtProvs)
+	ipniProvs <- peer.AddrInfo{ID: p1}
+	ipniProvs <- peer.AddrInfo{ID: p2}
+	close(ipniProvs)
+
+	candidates := collectProviders(dhtProvs, ipniProvs, 10)
+	require.Len(t, candidates, 2, "duplicates are ignored")
+	sources := map[peer.ID]string{}
+	for _, c := range candidates {
+		sources[c.ID] = c.source
+	}
+	require.Equal(t, IPNISource, sources[p2])
+}
+
+func TestSelectProviders(t *testing.T) {
+	tcp := []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001")}
+	quic := []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1")}
+	privateQUIC := []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/192.168.1.1/udp/4001/quic-v1")}
+	var candidates []providerCandidate
+	for _, addrs := range [][]multiaddr.Multiaddr{tcp, privateQUIC, tcp, quic, quic} {
+		candidates = append(candidates, providerCandidate{AddrInfo: peer.AddrInfo{ID: test.RandPeerIDFatal(t), Addrs: addrs}})
+	}
+
+	first := selectProviders(candidates, 2, SelectFirst, false)
+	require.Equal(t, candidates[:2], first)
+	require.Len(t, selectProviders(candidates, 2, SelectAll, false), len(candidates))
+
+	random := selectProviders(candidates, 3, SelectRandom, false)
+	require.Len(t, random, 3)
+	for _, c := range random {
+		require.Contains(t, candidates, c)
+	}
+
+	preferred := selectProviders(candidates, 3, SelectFirst, true)
+	require.Equal(t, []providerCandidate{candidates[3], candidates[4], candidates[0]}, preferred)
+	for _, c := range selectProviders(candidates, 2, SelectRandom, true) {
+		require.True(t, hasPublicQUIC(c.AddrInfo))
+	}
+}
@@ -0,0 +1,246 @@
+package check
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	bsserver "github.com/ipfs/boxo/bitswap/server"
+	"github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+)
+
+// Steps of a self-test, in the order they run
+const (
+	// SelfTestProvide provides the block to the DHT from the second host
+	SelfTestProvide = "provide"
+	// SelfTestLookup finds the provider record with the DHT client of the
+	// checker
+	SelfTestLookup = "lookup"
+	// SelfTestDial connects to the second host on the addresses it announces
+	SelfTestDial = "dial"
+	// SelfTestBitswap retrieves the block from the second host over Bitswap
+	SelfTestBitswap = "bitswap"
+)
+
+// SelfTestSteps lists the steps of a self-test in order
+var SelfTestSteps = []string{SelfTestProvide, SelfTestLookup, SelfTestDial, SelfTestBitswap}
+
+const (
+	// selfTestBlockSize is the size of the block of self-tests, large enough
+	// to span several packets, so that a clamped MTU breaks the retrieval
+	selfTestBlockSize = 256 << 10
+	// selfTestLookupTimeout is how long the provider record is looked for
+	selfTestLookupTimeout = 30 * time.Second
+	// selfTestBitswapTimeout is how long the second host has to answer
+	selfTestBitswapTimeout = 15 * time.Second
+)
+
+// SelfTestOutput is the result of a self-test of the checker, see SelfTest
+type SelfTestOutput struct {
+	// CID is the random block provided by the second host
+	CID string
+	// Provider is the peer ID of the second host
+	Provider string
+	// Passed is whether all the steps succeeded
+	Passed bool
+	// Steps are the results of SelfTestSteps, the ones after a failed step
+	// skipped
+	Steps    []SelfTestStepOutput
+	Started  time.Time
+	Duration time.Duration
+}
+
+// SelfTestStepOutput is the result of a step of a self-test
+type SelfTestStepOutput struct {
+	Step string
+	// Status is StageOK, StageFailed, or StageSkipped after a failed step,
+	// with the Error of failed steps
+	Status   string
+	Error    string
+	Duration time.Duration
+}
+
+// SelfTest checks that the checker works end to end, against a peer known to
+// serve a block: a second in-process host provides a random block to the DHT
+// and serves it over Bitswap, and the checker finds its provider record,
+// connects to it and retrieves the block the way it checks other peers.
+// Failures point at the deployment, e.g. blocked UDP or a clamped MTU, rather
+// than at the checked peers.
+func (ck *Checker) SelfTest(ctx context.Context) (*SelfTestOutput, error) {
+	data := make([]byte, selfTestBlockSize)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	if err != nil {
+		return nil, err
+	}
+	block, err := blocks.NewBlockWithCid(data, cid.NewCidV1(cid.Raw, mh))
+	if err != nil {
+		return nil, err
+	}
+	out := &SelfTestOutput{CID: block.Cid().String(), Started: time.Now()}
+	defer func() { out.Duration = time.Since(out.Started) }()
+
+	provider, err := ck.newSelfTestHost()
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+	out.Provider = provider.ID().String()
+
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	if err := bstore.Put(ctx, block); err != nil {
+		return nil, err
+	}
+	bn := bsnet.NewFromIpfsHost(provider, rhelp.Null{})
+	server := bsserver.New(ctx, bn, bstore)
+	bn.Start(server)
+	defer bn.Stop()
+	defer server.Close()
+
+	var (
+		found  peer.AddrInfo
+		dialer host.Host
+		addr   multiaddr.Multiaddr
+	)
+	steps := []func(ctx context.Context) error{
+		func(ctx context.Context) error {
+			return ck.selfTestProvide(ctx, provider, block.Cid())
+		},
+		func(ctx context.Context) error {
+			found, err = ck.selfTestLookup(ctx, block.Cid(), provider.ID())
+			return err
+		},
+		func(ctx context.Context) error {
+			if dialer, err = ck.newSelfTestHost(); err != nil {
+				return err
+			}
+			// Provider records often come without addresses, which the
+			// checks then find in the DHT
+			ai := peer.AddrInfo{ID: provider.ID(), Addrs: found.Addrs}
+			if len(ai.Addrs) == 0 {
+				ai.Addrs = provider.Addrs()
+			}
+			if err := dialer.Connect(ctx, ai); err != nil {
+				return err
+			}
+			conns := dialer.Network().ConnsToPeer(provider.ID())
+			if len(conns) == 0 {
+				return errors.New("the connection to the second host was closed")
+			}
+			p2pAddr, err := multiaddr.NewMultiaddr("/p2p/" + provider.ID().String())
+			if err != nil {
+				return err
+			}
+			addr = conns[0].RemoteMultiaddr().Encapsulate(p2pAddr)
+			return nil
+		},
+		func(ctx context.Context) error {
+			bs := checkBitswapCID(ctx, dialer, block.Cid(), addr, true, selfTestBitswapTimeout)
+			switch {
+			case bs.Error != "":
+				return errors.New(bs.Error)
+			case !bs.Responded:
+				return errors.New("the second host did not answer over Bitswap")
+			case !bs.ReceivedBlock:
+				return errors.New("the block was not received over Bitswap")
+			}
+			return nil
+		},
+	}
+	defer func() {
+		if dialer != nil {
+			dialer.Close()
+		}
+	}()
+
+	out.Passed = true
+	for i, run := range steps {
+		step := SelfTestStepOutput{Step: SelfTestSteps[i]}
+		if !out.Passed {
+			step.Status, step.Error = StageSkipped, "a previous step failed"
+			out.Steps = append(out.Steps, step)
+			continue
+		}
+		start := time.Now()
+		err := run(ctx)
+		step.Duration = time.Since(start)
+		step.Status = StageOK
+		if err != nil {
+			step.Status, step.Error = StageFailed, err.Error()
+			out.Passed = false
+		}
+		out.Steps = append(out.Steps, step)
+	}
+	return out, nil
+}
+
+// selfTestProvide provides c to the DHT with a DHT client of the provider
+// host, which joins the DHT through the bootstrap peers of the checker
+func (ck *Checker) selfTestProvide(ctx context.Context, provider host.Host, c cid.Cid) error {
+	d, err := dht.New(ctx, provider, dht.Mode(dht.ModeClient), dht.ProtocolPrefix(ck.dhtPrefix), dht.BootstrapPeersFunc(ck.bootstrap.peers))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	connected := 0
+	for _, ai := range ck.bootstrap.peers() {
+		if provider.Connect(ctx, ai) == nil {
+			connected++
+		}
+	}
+	if connected == 0 {
+		return errors.New("none of the bootstrap peers could be connected to")
+	}
+	// The bootstrap peers are added to the routing table once identified
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for d.RoutingTable().Size() == 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("joining the DHT: %w", ctx.Err())
+		}
+	}
+	if err := d.Provide(ctx, c, true); err != nil {
+		return fmt.Errorf("providing %s: %w", c, err)
+	}
+	return nil
+}
+
+// selfTestLookup looks the provider record of the provider host up in the
+// DHT. The lookup is repeated for a while, as the DHT servers do not
+// acknowledge the records they store.
+func (ck *Checker) selfTestLookup(ctx context.Context, c cid.Cid, provider peer.ID) (peer.AddrInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, selfTestLookupTimeout)
+	defer cancel()
+	for {
+		lctx, lcancel := context.WithCancel(ctx)
+		for ai := range ck.timedRouting().FindProvidersAsync(lctx, c, 0) {
+			if ai.ID == provider {
+				lcancel()
+				return ai, nil
+			}
+		}
+		lcancel()
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return peer.AddrInfo{}, errors.New("the provider record was not found in the DHT")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfTest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	server := newLoopbackHost(t)
+	serverDHT, err := dht.New(ctx, server, dht.ProtocolPrefix("/test"), dht.Mode(dht.ModeServer))
+	require.NoError(t, err)
+	defer serverDHT.Close()
+	bootstrap := []peer.AddrInfo{{ID: server.ID(), Addrs: server.Addrs()}}
+
+	h := newLoopbackHost(t)
+	d, err := dht.New(ctx, h, dht.ProtocolPrefix("/test"), dht.Mode(dht.ModeClient), dht.BootstrapPeers(bootstrap...))
+	require.NoError(t, err)
+	defer d.Close()
+	require.NoError(t, h.Connect(ctx, bootstrap[0]))
+
+	ck, err := New(ctx, Config{
+		Host: h,
+		DHT:  d,
+		NewTestHost: func() (host.Host, error) {
+			return libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		},
+		DHTProtocolPrefix: "/test",
+		BootstrapPeers:    bootstrap,
+	})
+	require.NoError(t, err)
+	defer ck.Close()
+	// The client is added to the routing table of the server once identified
+	require.Eventually(t, func() bool { return d.RoutingTable().Size() > 0 }, 10*time.Second, 100*time.Millisecond)
+
+	out, err := ck.SelfTest(ctx)
+	require.NoError(t, err)
+	require.True(t, out.Passed, out.Steps)
+	require.Len(t, out.Steps, len(SelfTestSteps))
+	for i, s := range out.Steps {
+		require.Equal(t, SelfTestSteps[i], s.Step)
+		require.Equal(t, StageOK, s.Status)
+	}
+	require.NotEmpty(t, out.CID)
+	require.NotEqual(t, h.ID().String(), out.Provider)
+
+	// Without the DHT server, the block can not be provided
+	require.NoError(t, serverDHT.Close())
+	require.NoError(t, server.Close())
+	out, err = ck.SelfTest(ctx)
+	require.NoError(t, err)
+	require.False(t, out.Passed)
+	require.Equal(t, StageFailed, out.Steps[0].Status)
+	for _, s := range out.Steps[1:] {
+		require.Equal(t, StageSkipped, s.Status)
+	}
+}
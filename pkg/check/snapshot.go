@@ -0,0 +1,159 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/crawler"
+	"github.com/libp2p/go-libp2p-kad-dht/fullrt"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+const (
+	// snapshotFile is the name of the routing table snapshot in Config.DatastorePath
+	snapshotFile = "routing-table.json"
+	// snapshotMaxAge is the age after which a snapshot is too stale to replace a crawl
+	snapshotMaxAge = 24 * time.Hour
+	// snapshotDialParallelism and snapshotDialTimeout bound connecting to the
+	// peers of a snapshot
+	snapshotDialParallelism = 200
+	snapshotDialTimeout     = 5 * time.Second
+)
+
+// routingSnapshot is the peers of the routing table, with their addresses
+type routingSnapshot struct {
+	Saved time.Time
+	Peers []peer.AddrInfo
+}
+
+// loadSnapshot reads the snapshot in dir, returning nil if there is none
+func loadSnapshot(dir string) (*routingSnapshot, error) {
+	f, err := os.Open(filepath.Join(dir, snapshotFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s routingSnapshot
+	if err := json.NewDecoder(f).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// loadFreshSnapshot returns the snapshot in dir, or nil if there is none or
+// it is too old to be used
+func loadFreshSnapshot(dir string) *routingSnapshot {
+	s, err := loadSnapshot(dir)
+	if err != nil {
+		log.Printf("Error loading the routing table snapshot, ignoring it: %v\n", err)
+		return nil
+	}
+	if s == nil || time.Since(s.Saved) > snapshotMaxAge {
+		return nil
+	}
+	return s
+}
+
+// saveSnapshot saves the peers of the routing table of the ready DHT client
+func (ck *Checker) saveSnapshot() error {
+	var peers []peer.ID
+	switch d := ck.dht.(type) {
+	case *fullrt.FullRT:
+		if !d.Ready() {
+			// Keep the previous snapshot rather than a partial one
+			return nil
+		}
+		for _, p := range d.Stat() {
+			peers = append(peers, p)
+		}
+	case *dht.IpfsDHT:
+		peers = d.RoutingTable().ListPeers()
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+	return saveSnapshot(ck.datastorePath, ck.h.Peerstore(), peers)
+}
+
+// saveSnapshot writes the snapshot of peers to dir with their addresses in
+// the peerstore, replacing the previous one
+func saveSnapshot(dir string, ps peerstore.Peerstore, peers []peer.ID) error {
+	s := routingSnapshot{Saved: time.Now(), Peers: make([]peer.AddrInfo, 0, len(peers))}
+	for _, p := range peers {
+		if ai := ps.PeerInfo(p); len(ai.Addrs) > 0 {
+			s.Peers = append(s.Peers, ai)
+		}
+	}
+
+	tmp, err := os.CreateTemp(dir, snapshotFile+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(tmp).Encode(s); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, snapshotFile)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// replaySnapshot connects to the peers of a snapshot instead of crawling the
+// DHT, reporting each peer as a successful or failed crawl query. Connecting
+// to known peers takes seconds, where crawling takes minutes.
+func replaySnapshot(ctx context.Context, h host.Host, s *routingSnapshot, handleSuccess crawler.HandleQueryResult, handleFail crawler.HandleQueryFail) {
+	peers := make(chan peer.AddrInfo)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < snapshotDialParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ai := range peers {
+				dialCtx, cancel := context.WithTimeout(ctx, snapshotDialTimeout)
+				err := h.Connect(dialCtx, ai)
+				cancel()
+
+				// The crawler callbacks are not safe for concurrent use
+				mu.Lock()
+				if err != nil {
+					handleFail(ai.ID, err)
+				} else {
+					handleSuccess(ai.ID, nil)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+loop:
+	for _, ai := range s.Peers {
+		select {
+		case peers <- ai:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(peers)
+	wg.Wait()
+}
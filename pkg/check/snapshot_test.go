@@ -0,0 +1,77 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRoundtrip(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := loadSnapshot(dir)
+	require.NoError(t, err)
+	require.Nil(t, s)
+
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	defer h.Close()
+
+	withAddrs, err := test.RandPeerID()
+	require.NoError(t, err)
+	withoutAddrs, err := test.RandPeerID()
+	require.NoError(t, err)
+	addr := multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001")
+	h.Peerstore().AddAddr(withAddrs, addr, peerstore.PermanentAddrTTL)
+
+	require.NoError(t, saveSnapshot(dir, h.Peerstore(), []peer.ID{withAddrs, withoutAddrs}))
+	s, err = loadSnapshot(dir)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+	require.WithinDuration(t, time.Now(), s.Saved, time.Minute)
+	// Peers without addresses can not be reconnected to
+	require.Len(t, s.Peers, 1)
+	require.Equal(t, withAddrs, s.Peers[0].ID)
+	require.Equal(t, []multiaddr.Multiaddr{addr}, s.Peers[0].Addrs)
+	require.NotNil(t, loadFreshSnapshot(dir))
+
+	// Stale snapshots are ignored
+	s.Saved = time.Now().Add(-2 * snapshotMaxAge)
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFile), b, 0o644))
+	require.Nil(t, loadFreshSnapshot(dir))
+}
+
+func TestReplaySnapshot(t *testing.T) {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h.Close()
+	reachable, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer reachable.Close()
+	unreachable, err := test.RandPeerID()
+	require.NoError(t, err)
+
+	s := &routingSnapshot{Saved: time.Now(), Peers: []peer.AddrInfo{
+		{ID: reachable.ID(), Addrs: reachable.Addrs()},
+		// Nothing listens on port 1
+		{ID: unreachable, Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/1")}},
+	}}
+	var succeeded, failed []peer.ID
+	replaySnapshot(context.Background(), h, s,
+		func(p peer.ID, _ []*peer.AddrInfo) { succeeded = append(succeeded, p) },
+		func(p peer.ID, _ error) { failed = append(failed, p) })
+	require.Equal(t, []peer.ID{reachable.ID()}, succeeded)
+	require.Equal(t, []peer.ID{unreachable}, failed)
+}
@@ -0,0 +1,160 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Statuses of a stage of a check
+const (
+	StageOK      = "ok"
+	StageFailed  = "failed"
+	StageSkipped = "skipped"
+)
+
+// Names of the stages of a check, passed to Options.OnStage as the check
+// enters them
+const (
+	// StageRouting is looking the peer, or the providers of the CID, up
+	StageRouting = "routing"
+	// StageDial is connecting to the peer
+	StageDial = "dial"
+	// StageBitswap is asking the peer for the block
+	StageBitswap = "bitswap"
+	// StageDiagnostics is probing the protocols and the DHT server of the
+	// peer once connected
+	StageDiagnostics = "diagnostics"
+)
+
+// errNotConnected is why the stages needing a connection to the peer are
+// skipped when it could not be connected to
+const errNotConnected = "the peer could not be connected to"
+
+// StageOutput is the status of a stage of a check, with the Error of failed
+// and skipped stages
+type StageOutput struct {
+	Status string
+	Error  string
+}
+
+// StagesOutput tells which stages of the check of a peer ran, and which
+// failed. A failed stage does not stop the check: the next stages run when
+// they can, e.g. dialing a passed multiaddr when the DHT lookup failed, so
+// what could be learned is still reported.
+type StagesOutput struct {
+	// Routing is looking the peer up in the DHT
+	Routing StageOutput
+	// Dial is connecting to the peer
+	Dial StageOutput
+	// Bitswap is asking the peer for the block
+	Bitswap StageOutput
+	// Exhausted is the first stage cut short by its budget in
+	// Options.StageBudgets or by the deadline of the check, nil if none was
+	Exhausted *ExhaustedStageOutput
+}
+
+// stage reports that the check enters stage to opts.OnStage
+func (o Options) stage(stage string) {
+	if o.OnStage != nil {
+		o.OnStage(stage)
+	}
+}
+
+// StageBudgets bound the time each stage of a peer or node check can take,
+// so that a slow stage leaves time for the next ones within the deadline of
+// the check. The timeouts of the operations of a stage, e.g.
+// Options.AddrDialTimeout, are cut at its budget. Zero budgets are only
+// bounded by the deadline of the check.
+type StageBudgets struct {
+	Routing     time.Duration
+	Dial        time.Duration
+	Bitswap     time.Duration
+	Diagnostics time.Duration
+}
+
+func (b StageBudgets) of(stage string) time.Duration {
+	switch stage {
+	case StageRouting:
+		return b.Routing
+	case StageDial:
+		return b.Dial
+	case StageBitswap:
+		return b.Bitswap
+	case StageDiagnostics:
+		return b.Diagnostics
+	}
+	return 0
+}
+
+// ExhaustedStageOutput is a stage that ran out of time
+type ExhaustedStageOutput struct {
+	Stage string
+	// Budget is the budget of the stage, and Deadline whether the deadline of
+	// the whole check ran out first
+	Budget   time.Duration
+	Deadline bool
+}
+
+// errStageBudget is the cause of the contexts of the stages whose budget ran
+// out
+var errStageBudget = errors.New("the budget of the stage ran out")
+
+// stageTracker runs the stages of a check with contexts bounded by their
+// budgets, reporting them to Options.OnStage
+type stageTracker struct {
+	ctx       context.Context
+	opts      Options
+	stage     string
+	stageCtx  context.Context
+	cancel    context.CancelFunc
+	exhausted *ExhaustedStageOutput
+}
+
+func newStageTracker(ctx context.Context, opts Options) *stageTracker {
+	return &stageTracker{ctx: ctx, opts: opts}
+}
+
+// start ends the current stage and starts stage, returning the context its
+// operations run with
+func (t *stageTracker) start(stage string) context.Context {
+	t.end()
+	t.stage = stage
+	t.opts.stage(stage)
+	if budget := t.opts.StageBudgets.of(stage); budget > 0 {
+		t.stageCtx, t.cancel = context.WithTimeoutCause(t.ctx, budget, errStageBudget)
+	} else {
+		t.stageCtx, t.cancel = context.WithCancel(t.ctx)
+	}
+	return t.stageCtx
+}
+
+// end ends the current stage, and returns the first stage that ran out of
+// time
+func (t *stageTracker) end() *ExhaustedStageOutput {
+	if t.stageCtx == nil {
+		return t.exhausted
+	}
+	if t.stageCtx.Err() != nil && t.exhausted == nil {
+		t.exhausted = &ExhaustedStageOutput{
+			Stage:    t.stage,
+			Budget:   t.opts.StageBudgets.of(t.stage),
+			Deadline: context.Cause(t.stageCtx) != errStageBudget,
+		}
+	}
+	t.cancel()
+	t.stageCtx = nil
+	return t.exhausted
+}
+
+func stageOK() StageOutput {
+	return StageOutput{Status: StageOK}
+}
+
+func stageFailed(err string) StageOutput {
+	return StageOutput{Status: StageFailed, Error: err}
+}
+
+func stageSkipped(reason string) StageOutput {
+	return StageOutput{Status: StageSkipped, Error: reason}
+}
@@ -0,0 +1,50 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageTracker(t *testing.T) {
+	var entered []string
+	opts := Options{
+		StageBudgets: StageBudgets{Dial: 20 * time.Millisecond},
+		OnStage:      func(stage string) { entered = append(entered, stage) },
+	}
+	stages := newStageTracker(context.Background(), opts)
+
+	ctx := stages.start(StageRouting)
+	_, ok := ctx.Deadline()
+	require.False(t, ok, "stages without a budget are only bounded by the check")
+
+	ctx = stages.start(StageDial)
+	<-ctx.Done()
+	ctx = stages.start(StageBitswap)
+	require.NoError(t, ctx.Err(), "the next stage gets its own time")
+	require.Equal(t, &ExhaustedStageOutput{Stage: StageDial, Budget: 20 * time.Millisecond}, stages.end())
+	require.Equal(t, []string{StageRouting, StageDial, StageBitswap}, entered)
+
+	// The deadline of the check cuts the stage it runs out in
+	checkCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	stages = newStageTracker(checkCtx, Options{StageBudgets: StageBudgets{Bitswap: time.Minute}})
+	stages.start(StageRouting)
+	ctx = stages.start(StageBitswap)
+	<-ctx.Done()
+	require.Equal(t, &ExhaustedStageOutput{Stage: StageBitswap, Budget: time.Minute, Deadline: true}, stages.end())
+
+	stages = newStageTracker(context.Background(), Options{})
+	stages.start(StageRouting)
+	require.Nil(t, stages.end())
+
+	// The stages of the default checks are bounded by the timeouts of their
+	// operations only
+	stages = newStageTracker(context.Background(), DefaultOptions())
+	for _, stage := range []string{StageRouting, StageDial, StageBitswap, StageDiagnostics} {
+		_, ok := stages.start(stage).Deadline()
+		require.False(t, ok, stage)
+	}
+}
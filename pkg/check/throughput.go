@@ -0,0 +1,112 @@
+package check
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ThroughputOutput is the result of downloading part of the DAG rooted at the
+// checked CID from the peer to measure how fast it serves data, see
+// Options.ThroughputMiB
+type ThroughputOutput struct {
+	// Bytes and Blocks are the data received and verified in Duration
+	Bytes    int64
+	Blocks   int
+	Duration time.Duration
+	// MBPerSecond is the throughput, in megabytes (10^6 bytes) per second
+	MBPerSecond float64
+	// FirstByteLatency is the time until the first block was received
+	FirstByteLatency time.Duration
+	// MeanBlockInterval is the mean time between the arrival of two blocks,
+	// and Jitter its standard deviation
+	MeanBlockInterval time.Duration
+	Jitter            time.Duration
+	// Complete is whether the whole DAG was downloaded before reaching
+	// ThroughputMiB
+	Complete bool
+	// Error is why the download stopped early, the throughput of the blocks
+	// received before is still reported
+	Error string
+}
+
+// measureThroughput downloads the DAG rooted at c from the peer over Bitswap,
+// in depth-first order, until maxBytes bytes were received, and reports the
+// throughput of the download
+func measureThroughput(ctx context.Context, h host.Host, p peer.ID, c cid.Cid, maxBytes int64, timeout time.Duration) *ThroughputOutput {
+	out := &ThroughputOutput{}
+	f := newBlockFetcher(h, p, max(bitswapBlockTimeout, timeout))
+	defer f.close()
+
+	start := time.Now()
+	var arrivals []time.Time
+	seen := make(map[cid.Cid]struct{})
+	queue := []cid.Cid{c}
+	for len(queue) > 0 && out.Bytes < maxBytes {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+
+		b, err := f.fetch(ctx, c)
+		if err != nil {
+			out.Error = err.Error()
+			break
+		}
+		arrivals = append(arrivals, time.Now())
+		out.Blocks++
+		out.Bytes += int64(len(b.RawData()))
+		links, err := blockLinks(b)
+		if err != nil {
+			out.Error = err.Error()
+			break
+		}
+		for i := len(links) - 1; i >= 0; i-- {
+			queue = append(queue, links[i])
+		}
+	}
+	out.Duration = time.Since(start)
+	out.Complete = out.Error == ""
+	for _, c := range queue {
+		if _, ok := seen[c]; !ok {
+			out.Complete = false
+			break
+		}
+	}
+	if len(arrivals) == 0 {
+		return out
+	}
+
+	out.FirstByteLatency = arrivals[0].Sub(start)
+	if secs := arrivals[len(arrivals)-1].Sub(start).Seconds(); secs > 0 {
+		out.MBPerSecond = float64(out.Bytes) / secs / 1e6
+	}
+	out.MeanBlockInterval, out.Jitter = intervalStats(arrivals)
+	return out
+}
+
+// intervalStats returns the mean and the standard deviation of the intervals
+// between consecutive times
+func intervalStats(times []time.Time) (mean, stddev time.Duration) {
+	if len(times) < 2 {
+		return 0, 0
+	}
+	n := float64(len(times) - 1)
+	var sum float64
+	for i := 1; i < len(times); i++ {
+		sum += float64(times[i].Sub(times[i-1]))
+	}
+	m := sum / n
+	var variance float64
+	for i := 1; i < len(times); i++ {
+		d := float64(times[i].Sub(times[i-1])) - m
+		variance += d * d
+	}
+	return time.Duration(m), time.Duration(math.Sqrt(variance / n))
+}
@@ -0,0 +1,79 @@
+package check
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	bsnet "github.com/ipfs/boxo/bitswap/network"
+	bsserver "github.com/ipfs/boxo/bitswap/server"
+	"github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	rhelp "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasureThroughput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	h := newLoopbackHost(t)
+	target := newLoopbackHost(t)
+
+	// A DAG of 4 leaves of 512 KiB
+	var leaves []blocks.Block
+	var links []cid.Cid
+	for i := 0; i < 4; i++ {
+		leaf := rawBlock(t, strings.Repeat(string(rune('a'+i)), 512<<10))
+		leaves = append(leaves, leaf)
+		links = append(links, leaf.Cid())
+	}
+	root := dagCBORBlock(t, "root", links...)
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, bstore.PutMany(ctx, append(leaves, root)))
+	bn := bsnet.NewFromIpfsHost(target, rhelp.Null{})
+	server := bsserver.New(ctx, bn, bstore)
+	bn.Start(server)
+	defer server.Close()
+	require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()}))
+
+	out := measureThroughput(ctx, h, target.ID(), root.Cid(), 10<<20, 5*time.Second)
+	require.Empty(t, out.Error)
+	require.True(t, out.Complete)
+	require.Equal(t, 5, out.Blocks)
+	require.Equal(t, int64(4*512<<10+len(root.RawData())), out.Bytes)
+	require.Positive(t, out.MBPerSecond)
+	require.Positive(t, out.FirstByteLatency)
+	require.Positive(t, out.MeanBlockInterval)
+
+	// The download stops once the size is reached
+	out = measureThroughput(ctx, h, target.ID(), root.Cid(), 1<<20, 5*time.Second)
+	require.False(t, out.Complete)
+	require.Equal(t, 3, out.Blocks)
+}
+
+func TestIntervalStats(t *testing.T) {
+	start := time.Now()
+	at := func(ms ...int) []time.Time {
+		var times []time.Time
+		for _, m := range ms {
+			times = append(times, start.Add(time.Duration(m)*time.Millisecond))
+		}
+		return times
+	}
+	mean, jitter := intervalStats(at(0, 10, 20, 30))
+	require.Equal(t, 10*time.Millisecond, mean)
+	require.Zero(t, jitter)
+
+	mean, jitter = intervalStats(at(0, 10, 40))
+	require.Equal(t, 20*time.Millisecond, mean)
+	require.Equal(t, 10*time.Millisecond, jitter)
+
+	mean, jitter = intervalStats(at(0))
+	require.Zero(t, mean)
+	require.Zero(t, jitter)
+}
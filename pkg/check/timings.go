@@ -0,0 +1,37 @@
+package check
+
+import (
+	"time"
+)
+
+// TimingsOutput breaks the duration of the check of a peer down by stage, to
+// tell which one is slow. Stages that were not run are 0.
+type TimingsOutput struct {
+	// Routing is the time spent finding the peer, its addresses and its
+	// provider records in the DHT and IPNI. In CID checks, it starts with the
+	// lookup of the providers of the CID.
+	Routing time.Duration
+	// AddrResolution is the time spent resolving the DNS addresses of the peer
+	AddrResolution time.Duration
+	// Dial is the time spent connecting to the peer, including the security
+	// and muxer handshakes, and in peer checks the separate dials of each of
+	// its addresses
+	Dial time.Duration
+	// Negotiation is the time spent opening a Bitswap stream once connected
+	Negotiation time.Duration
+	// Bitswap is the time spent asking the peer for the block, and resolving
+	// the path if one was passed
+	Bitswap time.Duration
+	// Total is the time the whole check took, which also includes work that
+	// is not a stage, e.g. the AutoNAT check or waiting for identify
+	Total time.Duration
+}
+
+// since returns the time elapsed since *start and resets it to now, to time
+// consecutive stages
+func since(start *time.Time) time.Duration {
+	now := time.Now()
+	d := now.Sub(*start)
+	*start = now
+	return d
+}
@@ -0,0 +1,50 @@
+package check
+
+import (
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Transports a check can be restricted to with Options.Transport
+const (
+	TransportTCP          = "tcp"
+	TransportQUIC         = "quic"
+	TransportWebTransport = "webtransport"
+	TransportWebRTC       = "webrtc"
+)
+
+// Transports lists the values of Options.Transport
+var Transports = []string{TransportTCP, TransportQUIC, TransportWebTransport, TransportWebRTC}
+
+// usesTransport returns whether addr is a direct address of the transport.
+// Relay addresses never are, as the relay would be dialed over its own transport.
+func usesTransport(addr multiaddr.Multiaddr, transport string) bool {
+	if isRelayAddr(addr) {
+		return false
+	}
+	has := func(code int) bool {
+		_, err := addr.ValueForProtocol(code)
+		return err == nil
+	}
+	switch transport {
+	case TransportTCP:
+		return has(multiaddr.P_TCP) && !has(multiaddr.P_WS) && !has(multiaddr.P_WSS)
+	case TransportQUIC:
+		return (has(multiaddr.P_QUIC_V1) || has(multiaddr.P_QUIC)) && !has(multiaddr.P_WEBTRANSPORT)
+	case TransportWebTransport:
+		return has(multiaddr.P_WEBTRANSPORT)
+	case TransportWebRTC:
+		return has(multiaddr.P_WEBRTC_DIRECT)
+	}
+	return false
+}
+
+// filterTransport returns the addresses of addrs using the transport
+func filterTransport(addrs []multiaddr.Multiaddr, transport string) []multiaddr.Multiaddr {
+	var out []multiaddr.Multiaddr
+	for _, a := range addrs {
+		if usesTransport(a, transport) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
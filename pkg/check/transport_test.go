@@ -0,0 +1,28 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsesTransport(t *testing.T) {
+	for _, tc := range []struct {
+		addr      string
+		transport string
+	}{
+		{"/ip4/1.2.3.4/tcp/4001", TransportTCP},
+		{"/dns4/example.com/tcp/4001", TransportTCP},
+		{"/ip4/1.2.3.4/tcp/443/tls/sni/example.com/ws", ""},
+		{"/ip4/1.2.3.4/udp/4001/quic-v1", TransportQUIC},
+		{"/ip6/2001:db8::1/udp/4001/quic-v1/webtransport/certhash/uEiAkH5a4DPGKUuOBjYw0CgwjvcJCJMD2K_1aluKR_tpevQ", TransportWebTransport},
+		{"/ip4/1.2.3.4/udp/4001/webrtc-direct/certhash/uEiAkH5a4DPGKUuOBjYw0CgwjvcJCJMD2K_1aluKR_tpevQ", TransportWebRTC},
+		{"/ip4/1.2.3.4/tcp/4001/p2p/12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK/p2p-circuit", ""},
+	} {
+		addr := multiaddr.StringCast(tc.addr)
+		for _, transport := range Transports {
+			require.Equal(t, transport == tc.transport, usesTransport(addr, transport), "%s over %s", tc.addr, transport)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package check
+
+import "fmt"
+
+// Verdicts of CID checks, see CIDVerdict
+const (
+	// VerdictAvailable is when at least one provider serves the data
+	VerdictAvailable = "available"
+	// VerdictReachableNoData is when providers could be connected to, but
+	// none of them served the data
+	VerdictReachableNoData = "reachable-no-data"
+	// VerdictProvidersUnreachable is when providers were found, but none of
+	// them could be connected to
+	VerdictProvidersUnreachable = "providers-unreachable"
+	// VerdictNoProviders is when no provider was found in the DHT or IPNI
+	VerdictNoProviders = "no-providers"
+	// VerdictInconclusive is when none of the providers found could be
+	// checked, as they were denied or the checker ran out of resources
+	VerdictInconclusive = "inconclusive"
+)
+
+// Verdicts lists the verdicts of CID checks
+var Verdicts = []string{VerdictAvailable, VerdictReachableNoData, VerdictProvidersUnreachable, VerdictNoProviders, VerdictInconclusive}
+
+// Outcomes of the check of a provider, in VerdictEvidence
+const (
+	OutcomeAvailable   = "available"
+	OutcomeNoData      = "no-data"
+	OutcomeUnreachable = "unreachable"
+	OutcomeNotChecked  = "not-checked"
+)
+
+// VerdictOutput summarizes the result of a CID check, so that clients do
+// not have to classify the checks of the providers themselves
+type VerdictOutput struct {
+	// Verdict is one of Verdicts
+	Verdict string
+	// Summary explains the verdict in a sentence
+	Summary string
+	// Providers is the number of providers checked, and Available,
+	// ReachableNoData, Unreachable and NotChecked how many of them had each
+	// outcome
+	Providers       int
+	Available       int
+	ReachableNoData int
+	Unreachable     int
+	NotChecked      int
+	// Evidence is the outcome of each provider, in the order of the results
+	Evidence []VerdictEvidence
+}
+
+// VerdictEvidence is the outcome of the check of a provider that the verdict
+// is based on
+type VerdictEvidence struct {
+	Provider string
+	Source   string
+	// Outcome is OutcomeAvailable, OutcomeNoData, OutcomeUnreachable, or
+	// OutcomeNotChecked when the failure says nothing about the provider
+	Outcome string
+	// Reason tells what the outcome is based on, e.g. the connection error
+	Reason string
+}
+
+// CIDVerdict classifies the result of a CID check: whether providers were
+// found, whether any of them could be connected to, and whether any of those
+// served the data. Providers whose check failed because of the denylist or
+// the resource limits of the checker are not counted against the CID.
+func CIDVerdict(providers []ProviderOutput) VerdictOutput {
+	out := VerdictOutput{Providers: len(providers), Evidence: []VerdictEvidence{}}
+	for i := range providers {
+		e := providerEvidence(&providers[i])
+		switch e.Outcome {
+		case OutcomeAvailable:
+			out.Available++
+		case OutcomeNoData:
+			out.ReachableNoData++
+		case OutcomeUnreachable:
+			out.Unreachable++
+		default:
+			out.NotChecked++
+		}
+		out.Evidence = append(out.Evidence, e)
+	}
+
+	switch {
+	case out.Providers == 0:
+		out.Verdict = VerdictNoProviders
+		out.Summary = "No provider of the CID was found in the DHT or IPNI"
+	case out.Available > 0:
+		out.Verdict = VerdictAvailable
+		out.Summary = fmt.Sprintf("%d of the %d providers found serve the data", out.Available, out.Providers)
+	case out.ReachableNoData > 0:
+		out.Verdict = VerdictReachableNoData
+		out.Summary = fmt.Sprintf("%d of the %d providers found could be connected to, but none of them served the data", out.ReachableNoData, out.Providers)
+	case out.Unreachable > 0:
+		out.Verdict = VerdictProvidersUnreachable
+		out.Summary = fmt.Sprintf("%d providers were found, but none of them could be connected to", out.Unreachable)
+	default:
+		out.Verdict = VerdictInconclusive
+		out.Summary = "None of the providers found could be checked, as they are denied or the checker ran out of resources"
+	}
+	return out
+}
+
+// providerEvidence returns the outcome of the check of p
+func providerEvidence(p *ProviderOutput) VerdictEvidence {
+	e := VerdictEvidence{Provider: p.ID, Source: p.Source}
+	bs, httpOut := p.DataAvailableOverBitswap, p.DataAvailableOverHTTP
+	connected := p.ConnectionError == ""
+	switch {
+	case p.Available():
+		e.Outcome = OutcomeAvailable
+		switch {
+		case connected && bs.ReceivedBlock:
+			e.Reason = "sent the block over Bitswap"
+		case connected && bs.Found:
+			e.Reason = "answered that it has the block over Bitswap"
+		default:
+			e.Reason = "sent the block over HTTP"
+		}
+	case p.Denied:
+		e.Outcome, e.Reason = OutcomeNotChecked, "the provider is denied by the checker"
+	case p.ResourceLimited || bs.ResourceLimited:
+		e.Outcome, e.Reason = OutcomeNotChecked, "the checker ran out of resources"
+	case connected:
+		e.Outcome = OutcomeNoData
+		switch {
+		case bs.ReceivedDontHave:
+			e.Reason = "answered that it does not have the block over Bitswap"
+		case bs.Error != "":
+			e.Reason = "the Bitswap request failed: " + bs.Error
+		default:
+			e.Reason = "did not answer the Bitswap request"
+		}
+	case httpOut != nil && httpOut.StatusCode != 0:
+		e.Outcome = OutcomeNoData
+		e.Reason = fmt.Sprintf("answered the HTTP request with status %d", httpOut.StatusCode)
+	default:
+		e.Outcome, e.Reason = OutcomeUnreachable, p.ConnectionError
+	}
+	return e
+}
@@ -0,0 +1,42 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCIDVerdict(t *testing.T) {
+	available := ProviderOutput{ID: "available", Source: DHTSource, DataAvailableOverBitswap: BitswapCheckOutput{Found: true, Responded: true, ReceivedHave: true}}
+	dontHave := ProviderOutput{ID: "dont-have", Source: IPNISource, DataAvailableOverBitswap: BitswapCheckOutput{Responded: true, ReceivedDontHave: true}}
+	unreachable := ProviderOutput{ID: "unreachable", Source: DHTSource, ConnectionError: "failed to dial"}
+	limited := ProviderOutput{ID: "limited", ConnectionError: "resource limit exceeded", ResourceLimited: true}
+	denied := ProviderOutput{ID: "denied", ConnectionError: ErrDeniedPeer.Error(), Denied: true}
+	httpNotFound := ProviderOutput{ID: "http", ConnectionError: "no libp2p address", DataAvailableOverHTTP: &HTTPCheckOutput{StatusCode: 404}}
+
+	out := CIDVerdict(nil)
+	require.Equal(t, VerdictNoProviders, out.Verdict)
+	require.Empty(t, out.Evidence)
+
+	out = CIDVerdict([]ProviderOutput{unreachable, dontHave, available})
+	require.Equal(t, VerdictAvailable, out.Verdict)
+	require.Equal(t, "1 of the 3 providers found serve the data", out.Summary)
+	require.Equal(t, []VerdictEvidence{
+		{Provider: "unreachable", Source: DHTSource, Outcome: OutcomeUnreachable, Reason: "failed to dial"},
+		{Provider: "dont-have", Source: IPNISource, Outcome: OutcomeNoData, Reason: "answered that it does not have the block over Bitswap"},
+		{Provider: "available", Source: DHTSource, Outcome: OutcomeAvailable, Reason: "answered that it has the block over Bitswap"},
+	}, out.Evidence)
+
+	out = CIDVerdict([]ProviderOutput{unreachable, httpNotFound, limited})
+	require.Equal(t, VerdictReachableNoData, out.Verdict, "providers that could be connected to are the more telling ones")
+	require.Equal(t, 1, out.ReachableNoData)
+	require.Equal(t, 1, out.Unreachable)
+	require.Equal(t, 1, out.NotChecked)
+
+	out = CIDVerdict([]ProviderOutput{unreachable, limited, denied})
+	require.Equal(t, VerdictProvidersUnreachable, out.Verdict)
+	require.Equal(t, 2, out.NotChecked)
+
+	out = CIDVerdict([]ProviderOutput{limited, denied})
+	require.Equal(t, VerdictInconclusive, out.Verdict, "the failures of the checker say nothing about the providers")
+}
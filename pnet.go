@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/libp2p/go-libp2p/core/pnet"
+)
+
+// loadSwarmKey reads a private network pre-shared key in the swarm.key format
+// used by Kubo. An empty path returns a nil key (public network).
+func loadSwarmKey(path string) (pnet.PSK, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	psk, err := pnet.DecodeV1PSK(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding swarm key %s: %w", path, err)
+	}
+	return psk, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+)
+
+// provideTestInterval is how long the result of a provide test is served
+// before a request runs a new one, so polling the endpoint does not write to
+// the DHT on every request
+const provideTestInterval = time.Minute
+
+// provideTester serves the provide tests of the checker, running one at a time
+type provideTester struct {
+	d *daemon
+
+	mu     sync.Mutex
+	last   *check.ProvideTestOutput
+	lastAt time.Time
+}
+
+func newProvideTester(d *daemon) *provideTester {
+	return &provideTester{d: d}
+}
+
+func (pt *provideTester) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.last == nil || time.Since(pt.lastAt) >= provideTestInterval {
+		ctx, cancel := context.WithTimeout(r.Context(), pt.d.config().CheckTimeout)
+		defer cancel()
+		out, err := pt.d.checker.ProvideTest(ctx)
+		if err != nil {
+			log.Printf("Error running provide test: %v\n", err)
+			writeCheckError(w, err, 0)
+			return
+		}
+		pt.last, pt.lastAt = out, time.Now()
+	}
+
+	if pt.d.validateResponses {
+		if err := validateResponse(pt.last); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	writeResponse(w, r, pt.last)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// errQueueFull is returned by checkQueue.acquire when maxQueuedChecks checks
+// are already waiting
+var errQueueFull = errors.New("check queue is full")
+
+// checkQueue bounds the checks running at the same time to
+// maxConcurrentChecks, and the checks waiting for one of them to end to
+// maxQueuedChecks. Waiting checks start in the order they arrived. The zero
+// value is ready to use.
+type checkQueue struct {
+	mu      sync.Mutex
+	running int
+	// maxRunning is the limit of the last acquire, as the config may be
+	// reloaded while checks wait
+	maxRunning int
+	// waiting are the checks in the queue, in order. A slot is handed to a
+	// check by closing its channel.
+	waiting []chan struct{}
+}
+
+// queueStats are the checks running and waiting
+type queueStats struct {
+	Running int
+	Queued  int
+}
+
+// acquire waits for a slot to run a check in, and returns the function
+// releasing it. It returns errQueueFull without waiting if maxQueued checks
+// are waiting already, and the error of ctx if it is done first. Checks are
+// not limited when maxRunning is 0.
+func (q *checkQueue) acquire(ctx context.Context, maxRunning, maxQueued int) (func(), error) {
+	q.mu.Lock()
+	q.maxRunning = maxRunning
+	if maxRunning == 0 || (q.running < maxRunning && len(q.waiting) == 0) {
+		q.running++
+		q.mu.Unlock()
+		return q.release, nil
+	}
+	if len(q.waiting) >= maxQueued {
+		q.mu.Unlock()
+		return nil, errQueueFull
+	}
+	ready := make(chan struct{})
+	q.waiting = append(q.waiting, ready)
+	q.mu.Unlock()
+
+	select {
+	case <-ready:
+		return q.release, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if i := slices.Index(q.waiting, ready); i >= 0 {
+			q.waiting = slices.Delete(q.waiting, i, i+1)
+			return nil, ctx.Err()
+		}
+		// The slot was handed over as ctx ended, pass it on
+		q.releaseLocked()
+		return nil, ctx.Err()
+	}
+}
+
+// release ends a check, handing its slot to the first waiting check
+func (q *checkQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked()
+}
+
+func (q *checkQueue) releaseLocked() {
+	if len(q.waiting) > 0 && (q.maxRunning == 0 || q.running <= q.maxRunning) {
+		close(q.waiting[0])
+		q.waiting = q.waiting[1:]
+		return
+	}
+	q.running--
+}
+
+// stats returns the checks running and waiting
+func (q *checkQueue) stats() queueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return queueStats{Running: q.running, Queued: len(q.waiting)}
+}
+
+// acquireCheckSlot waits in the check queue for the request r. It answers
+// the request and returns false if the queue is full or the client went
+// away while waiting.
+func (d *daemon) acquireCheckSlot(w http.ResponseWriter, r *http.Request, cfg *config) (func(), bool) {
+	release, err := d.queue.acquire(r.Context(), cfg.MaxConcurrentChecks, cfg.MaxQueuedChecks)
+	switch {
+	case errors.Is(err, errQueueFull):
+		writeTooManyChecks(w, d.queue.stats(), cfg)
+		return nil, false
+	case err != nil:
+		writeCheckError(w, err, 0)
+		return nil, false
+	}
+	d.active.setStage(r.Context(), activeStageRunning)
+	return release, true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckQueue(t *testing.T) {
+	ctx := context.Background()
+	var q checkQueue
+
+	release1, err := q.acquire(ctx, 1, 2)
+	require.NoError(t, err)
+
+	// Checks beyond the running one wait, in order
+	started := make(chan int, 2)
+	for i := range 2 {
+		go func() {
+			release, err := q.acquire(ctx, 1, 2)
+			if err != nil {
+				return
+			}
+			started <- i
+			release()
+		}()
+		require.Eventually(t, func() bool { return q.stats().Queued == i+1 }, time.Second, time.Millisecond)
+	}
+	_, err = q.acquire(ctx, 1, 2)
+	require.ErrorIs(t, err, errQueueFull)
+	require.Equal(t, queueStats{Running: 1, Queued: 2}, q.stats())
+
+	release1()
+	require.Equal(t, 0, <-started)
+	require.Equal(t, 1, <-started)
+	require.Eventually(t, func() bool { return q.stats() == queueStats{} }, time.Second, time.Millisecond)
+
+	// A check given up on while waiting leaves the queue
+	release1, err = q.acquire(ctx, 1, 2)
+	require.NoError(t, err)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = q.acquire(cctx, 1, 2)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, queueStats{Running: 1}, q.stats())
+	release1()
+	require.Equal(t, queueStats{}, q.stats())
+
+	// Without a limit, checks are only counted
+	_, err = q.acquire(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, queueStats{Running: 1}, q.stats())
+}
+
+func TestCheckQueueFullResponse(t *testing.T) {
+	d := &daemon{}
+	cfg := defaultConfig()
+	cfg.MaxConcurrentChecks = 1
+	release, err := d.queue.acquire(context.Background(), cfg.MaxConcurrentChecks, cfg.MaxQueuedChecks)
+	require.NoError(t, err)
+	defer release()
+
+	rec := httptest.NewRecorder()
+	_, ok := d.acquireCheckSlot(rec, httptest.NewRequest(http.MethodGet, "/check", nil), cfg)
+	require.False(t, ok)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var out apiErrorOutput
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&out))
+	require.Equal(t, errCodeTooManyChecks, out.Error.Code)
+	require.Equal(t, map[string]string{"running": "1", "queued": "0", "maxConcurrentChecks": "1", "maxQueuedChecks": "0"}, out.Error.Details)
+}
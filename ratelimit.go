@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// how long a client has to be idle before its limiter is forgotten
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+// apiKeyHeader and apiKeyParam are the request header and query parameter an
+// API key can be passed in
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyParam  = "apiKey"
+)
+
+// apiKeyNameKey is the context key of the name of the API key a request was
+// made with
+type apiKeyNameKey struct{}
+
+// apiKeyName returns the name of the API key the request of ctx was made
+// with, empty for anonymous requests
+func apiKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameKey{}).(string)
+	return name
+}
+
+// clientRateLimiter applies a token bucket rate limit per client IP, or per
+// API key for the clients passing one
+type clientRateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+	// keys are the limiters of the API keys, by key
+	keys map[string]*keyLimiter
+	// keyRequests counts the requests made with each API key, by key name
+	// and whether they were allowed or limited
+	keyRequests *prometheus.CounterVec
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// keyLimiter limits the requests made with an API key
+type keyLimiter struct {
+	name    string
+	limiter *rate.Limiter
+}
+
+func newClientRateLimiter(perSecond float64, burst int, keys []apiKeyConfig) *clientRateLimiter {
+	rl := &clientRateLimiter{
+		clients: make(map[string]*clientLimiter),
+		keyRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ipfs_check_api_key_requests_total",
+			Help: "Number of requests made with each API key, by whether the rate limit of the key allowed or limited them",
+		}, []string{"key", "result"}),
+	}
+	rl.setLimit(perSecond, burst)
+	rl.setKeys(keys)
+	return rl
+}
+
+// setKeys replaces the API keys, resetting their limits
+func (rl *clientRateLimiter) setKeys(keys []apiKeyConfig) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.keys = make(map[string]*keyLimiter, len(keys))
+	for _, k := range keys {
+		limit := rate.Limit(k.RateLimit)
+		if k.RateLimit == 0 {
+			limit = rate.Inf
+		}
+		rl.keys[k.Key] = &keyLimiter{name: k.Name, limiter: rate.NewLimiter(limit, k.RateLimitBurst)}
+	}
+}
+
+// allowKey returns the name of key and whether a request made with it is
+// allowed, and false for ok if the key is unknown
+func (rl *clientRateLimiter) allowKey(key string) (name string, allowed, ok bool) {
+	rl.mu.Lock()
+	k, ok := rl.keys[key]
+	rl.mu.Unlock()
+	if !ok {
+		return "", false, false
+	}
+	allowed = k.limiter.Allow()
+	result := "allowed"
+	if !allowed {
+		result = "limited"
+	}
+	rl.keyRequests.WithLabelValues(k.name, result).Inc()
+	return k.name, allowed, true
+}
+
+// setLimit changes the limit for all clients. A limit of 0 disables rate limiting.
+func (rl *clientRateLimiter) setLimit(perSecond float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.limit = rate.Limit(perSecond)
+	if perSecond == 0 {
+		rl.limit = rate.Inf
+	}
+	rl.burst = burst
+	// Start from a clean slate rather than adjusting every existing limiter
+	rl.clients = make(map[string]*clientLimiter)
+}
+
+func (rl *clientRateLimiter) allow(client string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.limit == rate.Inf {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(rl.lastSweep) > rateLimiterIdleTimeout {
+		for c, l := range rl.clients {
+			if now.Sub(l.lastSeen) > rateLimiterIdleTimeout {
+				delete(rl.clients, c)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	l, ok := rl.clients[client]
+	if !ok {
+		l = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[client] = l
+	}
+	l.lastSeen = now
+	return l.limiter.AllowN(now, 1)
+}
+
+// middleware rejects requests from clients over their limit with 429 Too
+// Many Requests. Requests passing an API key are limited by the limit of the
+// key instead of the one of their IP, and rejected with 401 Unauthorized if
+// the key is unknown. The name of the key is passed to next in the context of
+// the request, see apiKeyName.
+func (rl *clientRateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := requestAPIKey(r)
+		if q := r.URL.Query(); q.Has(apiKeyParam) {
+			// Keep the key out of cache keys and of the requests forwarded
+			// to federated instances
+			q.Del(apiKeyParam)
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = q.Encode()
+		}
+
+		var allowed bool
+		if key != "" {
+			name, keyAllowed, ok := rl.allowKey(key)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid API key", nil)
+				return
+			}
+			allowed = keyAllowed
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyNameKey{}, name))
+		} else {
+			allowed = rl.allow(clientIP(r))
+		}
+		if !allowed {
+			writeError(w, http.StatusTooManyRequests, errCodeRateLimited, "rate limit exceeded, try again later", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestAPIKey returns the API key passed with r, empty if none is
+func requestAPIKey(r *http.Request) string {
+	if q := r.URL.Query(); q.Has(apiKeyParam) {
+		return q.Get(apiKeyParam)
+	}
+	return r.Header.Get(apiKeyHeader)
+}
+
+// clientIP returns the IP of the client that made the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
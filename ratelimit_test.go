@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	rl := newClientRateLimiter(1, 1, []apiKeyConfig{
+		{Name: "tool", Key: "secret", RateLimit: 1, RateLimitBurst: 3},
+		{Name: "unlimited", Key: "unlimited"},
+	})
+	var forwardedQuery, keyName string
+	h := rl.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedQuery = r.URL.RawQuery
+		keyName = apiKeyName(r.Context())
+	}))
+	status := func(target, key string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Anonymous clients share the limit of their IP
+	require.Equal(t, http.StatusOK, status("/check?cid=a", ""))
+	require.Equal(t, http.StatusTooManyRequests, status("/check?cid=a", ""))
+
+	// A key has its own limit, in the header or the query
+	require.Equal(t, http.StatusOK, status("/check?cid=a", "secret"))
+	require.Equal(t, http.StatusOK, status("/check?cid=a&apiKey=secret", ""))
+	require.Equal(t, "cid=a", forwardedQuery, "the key is removed from the query")
+	require.Equal(t, "tool", keyName, "the handler gets the name of the key")
+	require.Equal(t, http.StatusOK, status("/check?cid=a", "secret"))
+	require.Equal(t, http.StatusTooManyRequests, status("/check?cid=a", "secret"))
+	for range 10 {
+		require.Equal(t, http.StatusOK, status("/check?cid=a", "unlimited"))
+	}
+
+	require.Equal(t, http.StatusUnauthorized, status("/check?cid=a", "wrong"))
+
+	require.Equal(t, 3.0, testutil.ToFloat64(rl.keyRequests.WithLabelValues("tool", "allowed")))
+	require.Equal(t, 1.0, testutil.ToFloat64(rl.keyRequests.WithLabelValues("tool", "limited")))
+	require.Equal(t, 10.0, testutil.ToFloat64(rl.keyRequests.WithLabelValues("unlimited", "allowed")))
+}
@@ -1,13 +0,0 @@
-package main
-
-import (
-	"github.com/libp2p/go-libp2p/core/network"
-	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
-)
-
-func NewResourceManager() (network.ResourceManager, error) {
-	limiter := rcmgr.NewFixedLimiter(rcmgr.InfiniteLimits)
-	rm, err := rcmgr.NewResourceManager(limiter)
-
-	return rm, err
-}
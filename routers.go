@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// how often the configured delegated routing endpoints are health-checked
+const routerHealthInterval = 30 * time.Second
+
+// routerFailover picks the delegated routing endpoint of the checks whose
+// request does not pass one: ipniIndexer from the config, or the first of
+// fallbackIPNIIndexers that responds while it does not
+type routerFailover struct {
+	mu sync.Mutex
+	// unhealthy are the endpoints that did not respond to the last health
+	// check, by URL. Endpoints not checked yet are assumed healthy.
+	unhealthy map[string]bool
+	// checks counts the checks run with each endpoint
+	checks *prometheus.CounterVec
+}
+
+func newRouterFailover() *routerFailover {
+	return &routerFailover{
+		unhealthy: make(map[string]bool),
+		checks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ipfs_check_router_checks_total",
+			Help: "Number of checks that used each configured delegated routing endpoint, the primary one or a fallback one",
+		}, []string{"router"}),
+	}
+}
+
+// pick returns the endpoint the next check uses, and counts it
+func (f *routerFailover) pick(cfg *config) string {
+	f.mu.Lock()
+	router := cfg.IPNIIndexer
+	if f.unhealthy[router] {
+		for _, u := range cfg.FallbackIPNIIndexers {
+			if !f.unhealthy[u] {
+				router = u
+				break
+			}
+		}
+	}
+	f.mu.Unlock()
+	f.checks.WithLabelValues(router).Inc()
+	return router
+}
+
+// run health-checks the configured endpoints every routerHealthInterval until
+// ctx is done. It does nothing without fallback endpoints, as the primary one
+// is then always used.
+func (f *routerFailover) run(ctx context.Context, config func() *config) {
+	ticker := time.NewTicker(routerHealthInterval)
+	defer ticker.Stop()
+	for {
+		if cfg := config(); len(cfg.FallbackIPNIIndexers) > 0 {
+			f.healthCheck(ctx, append([]string{cfg.IPNIIndexer}, cfg.FallbackIPNIIndexers...))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthCheck queries each of urls and records which did not respond
+func (f *routerFailover) healthCheck(ctx context.Context, urls []string) {
+	statuses := make([]check.IPNIStatusOutput, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = check.IPNIStatus(ctx, u)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range statuses {
+		if f.unhealthy[s.URL] == s.Responding {
+			if s.Responding {
+				log.Printf("Delegated routing endpoint %s responds again\n", s.URL)
+			} else {
+				log.Printf("Delegated routing endpoint %s does not respond: %s\n", s.URL, s.Error)
+			}
+		}
+		f.unhealthy[s.URL] = !s.Responding
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterFailover(t *testing.T) {
+	primaryStatus := http.StatusOK
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(primaryStatus)
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fallback.Close()
+
+	cfg := defaultConfig()
+	cfg.IPNIIndexer = primary.URL
+	cfg.FallbackIPNIIndexers = []string{"http://127.0.0.1:1", fallback.URL}
+	f := newRouterFailover()
+	urls := append([]string{cfg.IPNIIndexer}, cfg.FallbackIPNIIndexers...)
+
+	require.Equal(t, primary.URL, f.pick(cfg), "endpoints are healthy until checked")
+	f.healthCheck(context.Background(), urls)
+	require.Equal(t, primary.URL, f.pick(cfg))
+
+	// The primary endpoint fails, and so does the first fallback one
+	primaryStatus = http.StatusBadGateway
+	f.healthCheck(context.Background(), urls)
+	require.Equal(t, fallback.URL, f.pick(cfg))
+
+	primaryStatus = http.StatusOK
+	f.healthCheck(context.Background(), urls)
+	require.Equal(t, primary.URL, f.pick(cfg))
+
+	require.Equal(t, 3.0, testutil.ToFloat64(f.checks.WithLabelValues(primary.URL)))
+	require.Equal(t, 1.0, testutil.ToFloat64(f.checks.WithLabelValues(fallback.URL)))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// responseTypes are the types of the JSON responses of the API, by the name
+// their schema is served under at /schemas/<name>.json
+var responseTypes = map[string]reflect.Type{
+	"cidCheckOutput":            reflect.TypeOf(cidCheckOutput(nil)),
+	"verdictCheckOutput":        reflect.TypeOf(verdictCheckOutput{}),
+	"peerCheckOutput":           reflect.TypeOf(check.PeerCheckOutput{}),
+	"providerOutput":            reflect.TypeOf(check.ProviderOutput{}),
+	"BitswapCheckOutput":        reflect.TypeOf(check.BitswapCheckOutput{}),
+	"federatedCheckOutput":      reflect.TypeOf(federatedCheckOutput{}),
+	"dhtStatusOutput":           reflect.TypeOf(check.DHTStatusOutput{}),
+	"provideTestOutput":         reflect.TypeOf(check.ProvideTestOutput{}),
+	"readinessOutput":           reflect.TypeOf(readinessOutput{}),
+	"networkStatusOutput":       reflect.TypeOf(check.NetworkStatusOutput{}),
+	"checkerInfoOutput":         reflect.TypeOf(check.CheckerInfoOutput{}),
+	"watchEvent":                reflect.TypeOf(watchEvent{}),
+	"pinningServiceCheckOutput": reflect.TypeOf(check.PinningServiceCheckOutput{}),
+	"nodeCheckOutput":           reflect.TypeOf(check.NodeCheckOutput{}),
+	"browserReachabilityOutput": reflect.TypeOf(check.BrowserReachabilityOutput{}),
+	"localPeersOutput":          reflect.TypeOf(check.LocalPeersOutput{}),
+	"ownershipChallengeOutput":  reflect.TypeOf(ownershipChallengeOutput{}),
+	"ownershipStatusOutput":     reflect.TypeOf(ownershipStatusOutput{}),
+	"activeChecksOutput":        reflect.TypeOf(activeChecksOutput{}),
+	"ipnsCheckOutput":           reflect.TypeOf(check.IPNSCheckOutput{}),
+	"gatewayRetrievalOutput":    reflect.TypeOf(check.GatewayRetrievalOutput{}),
+	"peerCIDsCheckOutput":       reflect.TypeOf(check.PeerCIDsCheckOutput{}),
+	"pieceCIDOutput":            reflect.TypeOf(check.PieceCIDOutput{}),
+	"recordCensusOutput":        reflect.TypeOf(check.RecordCensusOutput{}),
+	"attestation":               reflect.TypeOf(check.Attestation{}),
+	"monitorStatus":             reflect.TypeOf([]monitorStatus{}),
+	"peerStats":                 reflect.TypeOf(peerStats{}),
+	"aggregateStats":            reflect.TypeOf(aggregateStats{}),
+	"checkPlan":                 reflect.TypeOf(check.CheckPlan{}),
+	"inFlightChecks":            reflect.TypeOf([]inFlightCheck{}),
+	"cacheFlushOutput":          reflect.TypeOf(cacheFlushOutput{}),
+	"apiKeys":                   reflect.TypeOf([]apiKeyConfig{}),
+	"apiErrorOutput":            reflect.TypeOf(apiErrorOutput{}),
+}
+
+// schemaGenerator builds the draft-07 JSON Schema of a Go type, following the
+// rules of encoding/json, so the schemas can not drift from the responses
+type schemaGenerator struct {
+	definitions map[string]map[string]any
+}
+
+// responseSchema returns the JSON Schema of the response type called name
+func responseSchema(name string) (map[string]any, bool) {
+	t, ok := responseTypes[name]
+	if !ok {
+		return nil, false
+	}
+	g := &schemaGenerator{definitions: make(map[string]map[string]any)}
+	var s map[string]any
+	if t.Kind() == reflect.Struct {
+		// Inline the root type rather than referencing its definition
+		s = g.structSchema(t)
+	} else {
+		s = g.schema(t)
+	}
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = name
+	if len(g.definitions) > 0 {
+		s["definitions"] = g.definitions
+	}
+	return s, true
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "integer", "description": "duration in nanoseconds"}
+	case reflect.TypeOf([]byte(nil)):
+		// encoding/json encodes bytes as base64
+		return nullable(map[string]any{"type": "string", "contentEncoding": "base64"})
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(g.schema(t.Elem()))
+	case reflect.Slice:
+		return nullable(map[string]any{"type": "array", "items": g.schema(t.Elem())})
+	case reflect.Map:
+		return nullable(map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())})
+	case reflect.Struct:
+		if _, ok := g.definitions[t.Name()]; !ok {
+			// Reserve the name first in case the type refers to itself
+			g.definitions[t.Name()] = nil
+			g.definitions[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/definitions/" + t.Name()}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	default:
+		// interface{} fields, e.g. the result of a federated check, can be anything
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// nullable makes a schema also accept null, as encoding/json encodes nil
+// pointers, slices and maps
+func nullable(s map[string]any) map[string]any {
+	switch typ := s["type"].(type) {
+	case string:
+		s["type"] = []string{typ, "null"}
+		return s
+	case []string:
+		return s
+	}
+	return map[string]any{"anyOf": []any{map[string]any{"type": "null"}, s}}
+}
+
+// schemaHandler serves the JSON Schema of a response type at /schemas/<name>.json
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".json")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s, ok := responseSchema(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Add("Content-Type", "application/schema+json")
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// validateResponse checks data against the schema of its type, returning an
+// error listing the fields that do not match
+func validateResponse(data any) error {
+	dt := reflect.TypeOf(data)
+	if dt != nil && dt.Kind() == reflect.Pointer && dt.Elem().Kind() == reflect.Struct {
+		dt = dt.Elem()
+	}
+	var name string
+	for n, t := range responseTypes {
+		if t == dt {
+			name = n
+			break
+		}
+	}
+	s, ok := responseSchema(name)
+	if !ok {
+		return fmt.Errorf("no schema for responses of type %T", data)
+	}
+	res, err := gojsonschema.Validate(gojsonschema.NewGoLoader(s), gojsonschema.NewGoLoader(data))
+	if err != nil {
+		return err
+	}
+	if res.Valid() {
+		return nil
+	}
+	var errs []error
+	for _, e := range res.Errors() {
+		errs = append(errs, errors.New(e.String()))
+	}
+	return fmt.Errorf("response does not match the %s schema: %w", name, errors.Join(errs...))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateResponse(t *testing.T) {
+	lastAd := time.Now()
+	providers := []check.ProviderOutput{{
+		ID:                       "12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK",
+		Addrs:                    []string{"/ip4/1.2.3.4/tcp/4001"},
+		DataAvailableOverBitswap: check.BitswapCheckOutput{Found: true, Duration: time.Second},
+		Source:                   check.DHTSource,
+		Advertisements:           &check.AdvertisementsOutput{DHT: true, IPNILastAdvertisement: &lastAd},
+	}}
+	require.NoError(t, validateResponse(cidCheckOutput(&providers)))
+	require.NoError(t, validateResponse(&check.PeerCheckOutput{PeerFoundInDHT: map[string]int{"/ip4/1.2.3.4/tcp/4001": 3}}))
+	require.NoError(t, validateResponse(federatedCheckOutput{VantagePoints: []vantagePointOutput{{Result: &providers}}}))
+	require.NoError(t, validateResponse(check.DHTStatusOutput{Crawl: &check.CrawlProgressOutput{}}))
+	require.NoError(t, validateResponse(&check.Attestation{PublicKey: []byte{8, 1}, Signature: []byte{1, 2, 3}}))
+
+	require.Error(t, validateResponse(map[string]any{"ID": 1}))
+
+	s, ok := responseSchema("peerCheckOutput")
+	require.True(t, ok)
+	require.Contains(t, s["required"], "DataAvailableOverBitswap")
+	require.Contains(t, s["definitions"], "BitswapCheckOutput")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+)
+
+const (
+	// selfTestTimeout bounds a self-test
+	selfTestTimeout = 2 * time.Minute
+	// selfTestRetryInterval is how soon a failed self-test is run again,
+	// instead of selfTest.interval
+	selfTestRetryInterval = time.Minute
+)
+
+// selfTester keeps the result of the last self-test of the checker, which
+// the readiness of the daemon is gated on
+type selfTester struct {
+	mu   sync.RWMutex
+	last *check.SelfTestOutput
+}
+
+func (st *selfTester) lastResult() *check.SelfTestOutput {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.last
+}
+
+// runSelfTests runs a self-test of the checker right away, then every
+// selfTest.interval, or sooner after a failure, until ctx is done
+func (d *daemon) runSelfTests(ctx context.Context) {
+	for {
+		tctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+		out, err := d.checker.SelfTest(tctx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		next := d.config().SelfTest.Interval
+		switch {
+		case err != nil:
+			log.Printf("Error running self-test: %v\n", err)
+			next = min(next, selfTestRetryInterval)
+		case out.Passed:
+			log.Printf("Self-test passed in %s\n", out.Duration.Round(time.Millisecond))
+		default:
+			for _, s := range out.Steps {
+				if s.Status == check.StageFailed {
+					log.Printf("Self-test failed at the %s step, checks may report peers as unreachable wrongly: %s\n", s.Step, s.Error)
+				}
+			}
+			next = min(next, selfTestRetryInterval)
+		}
+		if out != nil {
+			d.selfTest.mu.Lock()
+			d.selfTest.last = out
+			d.selfTest.mu.Unlock()
+		}
+
+		select {
+		case <-time.After(next):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readinessOutput tells whether the daemon is ready to serve checks
+type readinessOutput struct {
+	Ready bool
+	// DHTReady is whether the DHT client is ready, see /dht/status
+	DHTReady bool
+	// SelfTestEnabled is whether readiness requires the last self-test to
+	// have passed
+	SelfTestEnabled bool
+	// SelfTest is the last self-test, nil before the first one completed
+	SelfTest *check.SelfTestOutput
+	// Error is why the daemon is not ready
+	Error string
+}
+
+// readiness returns whether the daemon is ready to serve checks: the DHT
+// client is ready, and the last self-test passed if they are enabled
+func (d *daemon) readiness() readinessOutput {
+	out := readinessOutput{
+		DHTReady:        d.checker.Ready(),
+		SelfTestEnabled: d.config().SelfTest.Enabled,
+		SelfTest:        d.selfTest.lastResult(),
+	}
+	switch {
+	case !out.DHTReady:
+		out.Error = "the DHT client is not ready yet"
+	case !out.SelfTestEnabled:
+	case out.SelfTest == nil:
+		out.Error = "the self-test has not completed yet"
+	case !out.SelfTest.Passed:
+		out.Error = "the last self-test failed"
+	}
+	out.Ready = out.Error == ""
+	return out
+}
+
+// readyHandler serves the readiness of the daemon, with status 503 when it
+// is not ready, e.g. for the readiness probes of orchestrators
+func (d *daemon) readyHandler(w http.ResponseWriter, r *http.Request) {
+	out := d.readiness()
+	if d.validateResponses {
+		if err := validateResponse(out); err != nil {
+			log.Printf("Invalid response: %v\n", err)
+			writeError(w, http.StatusInternalServerError, errCodeInternal, err.Error(), nil)
+			return
+		}
+	}
+	status := http.StatusOK
+	if !out.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeResponseStatus(w, r, status, out)
+}
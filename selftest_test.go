@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadyHandler(t *testing.T) {
+	d := &daemon{checker: &check.Checker{}, validateResponses: true}
+	ready := func() (int, readinessOutput) {
+		rec := httptest.NewRecorder()
+		d.readyHandler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		var out readinessOutput
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &out))
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		return rec.Code, out
+	}
+
+	code, out := ready()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.False(t, out.Ready)
+	require.True(t, out.DHTReady)
+	require.Equal(t, "the self-test has not completed yet", out.Error)
+
+	d.selfTest.last = &check.SelfTestOutput{Steps: []check.SelfTestStepOutput{{Step: check.SelfTestProvide, Status: check.StageFailed, Error: "blocked"}}}
+	code, out = ready()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "the last self-test failed", out.Error)
+	require.Equal(t, "blocked", out.SelfTest.Steps[0].Error)
+
+	d.selfTest.last = &check.SelfTestOutput{Passed: true}
+	code, out = ready()
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, out.Ready)
+	require.Empty(t, out.Error)
+
+	// Readiness does not wait for self-tests when they are disabled
+	cfg := defaultConfig()
+	cfg.SelfTest.Enabled = false
+	d.cfg.Store(cfg)
+	d.selfTest.last = nil
+	code, out = ready()
+	require.Equal(t, http.StatusOK, code)
+	require.False(t, out.SelfTestEnabled)
+}
@@ -71,6 +71,86 @@ func QueryCid(
 		JSON(opts).Array()
 }
 
+func QueryProviders(
+	t *testing.T,
+	url string,
+	cid string,
+	providers ...string,
+) *httpexpect.Array {
+	expectedContentType := "application/json"
+
+	opts := httpexpect.ContentOpts{
+		MediaType: expectedContentType,
+	}
+
+	e := httpexpect.Default(t, url)
+
+	req := e.GET("/check").
+		WithQuery("cid", cid)
+	for _, p := range providers {
+		req = req.WithQuery("providers", p)
+	}
+	return req.
+		Expect().
+		Status(http.StatusOK).
+		JSON(opts).Array()
+}
+
+func QueryCAR(
+	t *testing.T,
+	url string,
+	cid string,
+	multiaddr string,
+	depth int,
+) []byte {
+	e := httpexpect.Default(t, url)
+
+	return []byte(e.GET("/check").
+		WithQuery("cid", cid).
+		WithQuery("multiaddr", multiaddr).
+		WithQuery("car", true).
+		WithQuery("carDepth", depth).
+		Expect().
+		Status(http.StatusOK).
+		HasContentType("application/vnd.ipld.car").
+		Body().Raw())
+}
+
+func QueryTransport(
+	t *testing.T,
+	url string,
+	cid string,
+	multiaddr string,
+	transport string,
+) *httpexpect.Object {
+	e := httpexpect.Default(t, url)
+
+	return e.GET("/check").
+		WithQuery("cid", cid).
+		WithQuery("multiaddr", multiaddr).
+		WithQuery("transport", transport).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+}
+
+func QueryDeep(
+	t *testing.T,
+	url string,
+	cid string,
+	multiaddr string,
+) *httpexpect.Object {
+	e := httpexpect.Default(t, url)
+
+	return e.GET("/check").
+		WithQuery("cid", cid).
+		WithQuery("multiaddr", multiaddr).
+		WithQuery("deep", "true").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+}
+
 func GetEnv(key string, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -140,3 +220,20 @@ func callWhile(fct func(), name string, xs ...string) {
 
 	fct()
 }
+
+func QuerySelection(
+	t *testing.T,
+	url string,
+	cid string,
+	providerSelection string,
+) *httpexpect.Array {
+	e := httpexpect.Default(t, url)
+
+	return e.GET("/check").
+		WithQuery("cid", cid).
+		WithQuery("providerSelection", providerSelection).
+		WithQuery("preferQUIC", "true").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+	"gopkg.in/yaml.v3"
+)
+
+// formatTextOutput returns a human-readable summary of the result of a check,
+// e.g. for curl users. Results without a summary are returned as YAML.
+func formatTextOutput(data interface{}) string {
+	var b strings.Builder
+	switch out := data.(type) {
+	case cidCheckOutput:
+		writeProvidersText(&b, *out)
+	case verdictCheckOutput:
+		fmt.Fprintf(&b, "Verdict: %s\n%s\n\n", out.Verdict.Verdict, out.Verdict.Summary)
+		writeProvidersText(&b, out.Providers)
+	case *check.PeerCheckOutput:
+		writePeerText(&b, out)
+	case *check.PeerCIDsCheckOutput:
+		writePeerCIDsText(&b, out)
+	case *check.GatewayRetrievalOutput:
+		writeGatewayRetrievalText(&b, out)
+	case *check.IPNSCheckOutput:
+		writeIPNSText(&b, out)
+	case *check.RecordCensusOutput:
+		writeCensusText(&b, out)
+	case *check.NodeCheckOutput:
+		writeNodeText(&b, out)
+	case federatedCheckOutput:
+		for _, vp := range out.VantagePoints {
+			name := vp.URL
+			if name == "" {
+				name = "this server"
+			}
+			fmt.Fprintf(&b, "== %s (%s)\n", name, formatTextDuration(vp.Duration))
+			if vp.CheckerInfo != nil && len(vp.CheckerInfo.Addrs) > 0 {
+				fmt.Fprintf(&b, "Checked from %s\n", strings.Join(vp.CheckerInfo.Addrs, ", "))
+			}
+			if vp.Error != "" {
+				fmt.Fprintf(&b, "Error: %s\n\n", vp.Error)
+				continue
+			}
+			b.WriteString(formatTextOutput(vp.Result))
+			b.WriteString("\n")
+		}
+	default:
+		return formatYAMLOutput(data)
+	}
+	return b.String()
+}
+
+// formatYAMLOutput returns data as YAML, with the fields of its JSON encoding
+func formatYAMLOutput(data interface{}) string {
+	j, err := json.Marshal(data)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	var v interface{}
+	if err := json.Unmarshal(j, &v); err != nil {
+		return err.Error() + "\n"
+	}
+	y, err := yaml.Marshal(v)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	return string(y)
+}
+
+func writeProvidersText(b *strings.Builder, providers []check.ProviderOutput) {
+	available := 0
+	for _, p := range providers {
+		if p.DataAvailableOverBitswap.Found || (p.DataAvailableOverHTTP != nil && p.DataAvailableOverHTTP.Found) {
+			available++
+		}
+	}
+	fmt.Fprintf(b, "%d providers found, %d serving the data\n", len(providers), available)
+	for _, p := range providers {
+		if p.Rank > 0 {
+			fmt.Fprintf(b, "\n#%d %s (%s)\n", p.Rank, p.ID, p.Source)
+		} else {
+			fmt.Fprintf(b, "\n%s (%s)\n", p.ID, p.Source)
+		}
+		writeConnectionText(b, "  ", p.ConnectionError, p.ConnectionMaddrs)
+		if p.ConnectionError == "" {
+			writeBitswapText(b, "  ", p.DataAvailableOverBitswap)
+		}
+		if p.DataAvailableOverHTTP != nil {
+			if p.DataAvailableOverHTTP.Found {
+				fmt.Fprintf(b, "  HTTP: found (%s)\n", formatTextDuration(p.DataAvailableOverHTTP.Duration))
+			} else {
+				fmt.Fprintf(b, "  HTTP: not found: %s\n", p.DataAvailableOverHTTP.Error)
+			}
+		}
+	}
+}
+
+func writePeerText(b *strings.Builder, out *check.PeerCheckOutput) {
+	writeConnectionText(b, "", out.ConnectionError, out.ConnectionMaddrs)
+	fmt.Fprintf(b, "Found in the DHT: %s\n", yesNo(len(out.PeerFoundInDHT) > 0))
+	fmt.Fprintf(b, "Provider record in the DHT: %s\n", yesNo(out.ProviderRecordFromPeerInDHT))
+	fmt.Fprintf(b, "Provider record in IPNI: %s\n", yesNo(out.ProviderRecordFromPeerInIPNI))
+	if out.ConnectionError == "" {
+		writeBitswapText(b, "", out.DataAvailableOverBitswap)
+	}
+}
+
+func writePeerCIDsText(b *strings.Builder, out *check.PeerCIDsCheckOutput) {
+	writeConnectionText(b, "", out.ConnectionError, out.ConnectionMaddrs)
+	if out.ConnectionError != "" {
+		return
+	}
+	fmt.Fprintf(b, "%d of %d CIDs available\n", out.Available, len(out.CIDs))
+	for _, c := range out.CIDs {
+		fmt.Fprintf(b, "\n%s\n", c.CID)
+		writeBitswapText(b, "  ", c.DataAvailableOverBitswap)
+	}
+}
+
+func writeGatewayRetrievalText(b *strings.Builder, out *check.GatewayRetrievalOutput) {
+	if out.Retrieved {
+		fmt.Fprintf(b, "Retrieved from %s in %s\n", out.Provider, formatTextDuration(out.Duration))
+	} else {
+		fmt.Fprintf(b, "Not retrieved within %s: %s\n", formatTextDuration(out.Timeout), out.Error)
+	}
+	fmt.Fprintf(b, "%d providers tried\n", len(out.Providers))
+	for _, l := range out.Denylists {
+		if l.Listed {
+			fmt.Fprintf(b, "Listed in the %s denylist\n", l.Name)
+		}
+	}
+}
+
+func writeIPNSText(b *strings.Builder, out *check.IPNSCheckOutput) {
+	fmt.Fprintf(b, "Name: %s\n", out.Name)
+	if out.Error != "" {
+		fmt.Fprintf(b, "Error: %s\n", out.Error)
+	}
+	fmt.Fprintf(b, "%d of %d closest DHT servers responded\n", out.Responded, out.ClosestPeers)
+	if out.Conflicting {
+		b.WriteString("The servers hold conflicting records\n")
+	}
+	for _, r := range out.Records {
+		fmt.Fprintf(b, "\n%s (sequence %d, %d servers)\n", r.Value, r.Sequence, len(r.Servers))
+		if r.Expired {
+			fmt.Fprintf(b, "  expired on %s\n", r.EOL.Format(time.RFC3339))
+		}
+		if r.Error != "" {
+			fmt.Fprintf(b, "  invalid: %s\n", r.Error)
+		}
+	}
+}
+
+func writeCensusText(b *strings.Builder, out *check.RecordCensusOutput) {
+	fmt.Fprintf(b, "CID: %s\n", out.CID.CIDv1)
+	if out.Error != "" {
+		fmt.Fprintf(b, "Error: %s\n", out.Error)
+	}
+	fmt.Fprintf(b, "%d of %d closest DHT servers responded, %d hold provider records\n", out.Responded, out.ClosestPeers, out.Holders)
+	for _, s := range out.Servers {
+		switch {
+		case s.Error != "":
+			fmt.Fprintf(b, "  %s: no answer: %s\n", s.ID, s.Error)
+		case s.HoldsRecord:
+			fmt.Fprintf(b, "  %s: %s\n", s.ID, strings.Join(s.Providers, ", "))
+		default:
+			fmt.Fprintf(b, "  %s: no provider record\n", s.ID)
+		}
+	}
+	if len(out.Diagnostics) > 0 {
+		fmt.Fprintf(b, "\n%d problems found in the answers of the servers\n", len(out.Diagnostics))
+		for _, p := range out.Diagnostics {
+			fmt.Fprintf(b, "  %s about %s: %s: %s\n", p.Server, p.Peer, p.Code, p.Message)
+		}
+	}
+}
+
+func writeNodeText(b *strings.Builder, out *check.NodeCheckOutput) {
+	fmt.Fprintf(b, "Peer: %s\n", out.PeerID)
+	writeConnectionText(b, "", out.ConnectionError, out.ConnectionMaddrs)
+	if out.Healthy {
+		b.WriteString("Healthy: no problem found\n")
+		return
+	}
+	fmt.Fprintf(b, "%d problems found\n", len(out.Problems))
+	for _, p := range out.Problems {
+		fmt.Fprintf(b, "  %s: %s\n", p.Code, p.Message)
+	}
+}
+
+func writeConnectionText(b *strings.Builder, indent, connErr string, maddrs []string) {
+	if connErr != "" {
+		fmt.Fprintf(b, "%sConnection: failed: %s\n", indent, connErr)
+		return
+	}
+	fmt.Fprintf(b, "%sConnection: ok (%s)\n", indent, strings.Join(maddrs, ", "))
+}
+
+func writeBitswapText(b *strings.Builder, indent string, out check.BitswapCheckOutput) {
+	switch {
+	case out.Found:
+		fmt.Fprintf(b, "%sBitswap: found (%s)\n", indent, formatTextDuration(out.Duration))
+	case out.Error != "":
+		fmt.Fprintf(b, "%sBitswap: not found: %s\n", indent, out.Error)
+	default:
+		fmt.Fprintf(b, "%sBitswap: not found\n", indent)
+	}
+}
+
+func formatTextDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsOptions configures the TLS termination of the API, which is then also
+// served over HTTP/2, and over HTTP/3 with http3, without a reverse proxy
+type tlsOptions struct {
+	// certFile and keyFile are the PEM certificate chain and private key,
+	// reloaded when the certificate file changes
+	certFile string
+	keyFile  string
+	// acmeDomains get certificates from Let's Encrypt instead, cached in
+	// acmeCacheDir
+	acmeDomains  []string
+	acmeCacheDir string
+	acmeEmail    string
+	http3        bool
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.certFile != "" || len(o.acmeDomains) > 0
+}
+
+func (o tlsOptions) validate() error {
+	if (o.certFile == "") != (o.keyFile == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be passed together")
+	}
+	if o.certFile != "" && len(o.acmeDomains) > 0 {
+		return fmt.Errorf("--tls-cert can not be used with --acme-domain, which gets the certificates from Let's Encrypt")
+	}
+	if len(o.acmeDomains) == 0 && (o.acmeCacheDir != "" || o.acmeEmail != "") {
+		return fmt.Errorf("--acme-cache-dir and --acme-email require --acme-domain")
+	}
+	if o.http3 && !o.enabled() {
+		return fmt.Errorf("--http3 requires TLS, with --tls-cert or --acme-domain")
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS config of the API, negotiating HTTP/2
+func (o tlsOptions) tlsConfig() (*tls.Config, error) {
+	if len(o.acmeDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(o.acmeDomains...),
+			Email:      o.acmeEmail,
+		}
+		if o.acmeCacheDir != "" {
+			m.Cache = autocert.DirCache(o.acmeCacheDir)
+		}
+		// The TLS-ALPN-01 challenge is answered on the TLS listener, which
+		// must be reachable on port 443
+		return m.TLSConfig(), nil
+	}
+	kp := &keyPairReloader{certFile: o.certFile, keyFile: o.keyFile}
+	if _, err := kp.load(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: kp.getCertificate,
+	}, nil
+}
+
+// keyPairReloader serves a certificate from files, reloading it when they
+// change, e.g. after a renewal by certbot
+type keyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// load loads the certificate if its files changed since the last load, and
+// returns whether it did
+func (kp *keyPairReloader) load() (bool, error) {
+	var latest time.Time
+	for _, f := range []string{kp.certFile, kp.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return false, fmt.Errorf("reading the TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	if latest.Equal(kp.modTime) {
+		return false, nil
+	}
+	// Files that are being written are loaded again once they change again
+	kp.modTime = latest
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading the TLS certificate: %w", err)
+	}
+	kp.cert = &cert
+	return true, nil
+}
+
+func (kp *keyPairReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if loaded, err := kp.load(); err != nil {
+		log.Printf("Keeping the previous TLS certificate: %v\n", err)
+	} else if loaded {
+		log.Printf("Reloaded the TLS certificate from %s\n", kp.certFile)
+	}
+	return kp.cert, nil
+}
+
+// altSvcMiddleware advertises the HTTP/3 server to the clients of the TCP
+// listener, which switch to it for their next requests
+func altSvcMiddleware(h3 *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			_ = h3.SetQUICHeaders(w.Header())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSOptions(t *testing.T) {
+	require.NoError(t, tlsOptions{}.validate())
+	require.False(t, tlsOptions{}.enabled())
+	require.NoError(t, tlsOptions{certFile: "cert.pem", keyFile: "key.pem", http3: true}.validate())
+	require.NoError(t, tlsOptions{acmeDomains: []string{"check.example.com"}, acmeCacheDir: "acme"}.validate())
+
+	require.Error(t, tlsOptions{certFile: "cert.pem"}.validate(), "the key is missing")
+	require.Error(t, tlsOptions{certFile: "cert.pem", keyFile: "key.pem", acmeDomains: []string{"check.example.com"}}.validate())
+	require.Error(t, tlsOptions{acmeEmail: "ops@example.com"}.validate(), "ACME settings without domain")
+	require.Error(t, tlsOptions{http3: true}.validate(), "HTTP/3 without TLS")
+}
+
+func TestKeyPairReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestKeyPair(t, certFile, keyFile, "first")
+
+	conf, err := tlsOptions{certFile: certFile, keyFile: keyFile}.tlsConfig()
+	require.NoError(t, err)
+	require.Contains(t, conf.NextProtos, "h2")
+	cert, err := conf.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "first", leafName(t, cert))
+
+	// A renewed certificate is served without restart
+	writeTestKeyPair(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	cert, err = conf.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "second", leafName(t, cert))
+
+	// The previous certificate is kept while the files do not match
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	require.NoError(t, os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute)))
+	cert, err = conf.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "second", leafName(t, cert))
+
+	_, err = tlsOptions{certFile: filepath.Join(dir, "missing.pem"), keyFile: keyFile}.tlsConfig()
+	require.Error(t, err)
+}
+
+// writeTestKeyPair writes a self-signed certificate for name and its key
+func writeTestKeyPair(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func leafName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
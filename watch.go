@@ -0,0 +1,145 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ipfs/ipfs-check/pkg/check"
+)
+
+const (
+	// watchInterval is the default time between two lookups of a watch, and
+	// watchMinInterval and watchMaxInterval its bounds
+	watchInterval    = 10 * time.Second
+	watchMinInterval = 5 * time.Second
+	watchMaxInterval = time.Minute
+	// watchDuration is how long a watch lasts by default, and
+	// watchMaxDuration at most
+	watchDuration    = 5 * time.Minute
+	watchMaxDuration = 30 * time.Minute
+)
+
+// watchEvent is sent after each lookup of the provider records of a watch
+type watchEvent struct {
+	// Elapsed is the time since the start of the watch
+	Elapsed time.Duration
+	Records check.ProviderRecordsOutput
+	// FirstFoundInDHT and FirstFoundInIPNI are the Elapsed time of the first
+	// lookup that found a provider record in each system, nil until then
+	FirstFoundInDHT  *time.Duration
+	FirstFoundInIPNI *time.Duration
+}
+
+// watchHandler looks up the provider records of a CID every intervalSec
+// seconds for durationSec seconds, streaming the results as server-sent
+// events, to watch the records of a freshly provided CID propagate
+func (d *daemon) watchHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := d.config()
+	cidStr := r.URL.Query().Get("cid")
+	if cidStr == "" {
+		writeMissingParam(w, "cid")
+		return
+	}
+	cidKey, _, err := parseCid(cidStr)
+	if err != nil {
+		writeInvalidParam(w, "cid", err.Error())
+		return
+	}
+	if err := d.checker.Denied(cidKey, nil); err != nil {
+		writeCheckError(w, err, 0)
+		return
+	}
+	interval, err := parseTimeoutParam(r.URL.Query(), "intervalSec", watchMaxInterval)
+	if err != nil || (interval != 0 && interval < watchMinInterval) {
+		writeInvalidParam(w, "intervalSec", fmt.Sprintf("Invalid intervalSec value (in seconds, %d to %d)", int(watchMinInterval.Seconds()), int(watchMaxInterval.Seconds())))
+		return
+	}
+	interval = cmp.Or(interval, watchInterval)
+	duration, err := parseTimeoutParam(r.URL.Query(), "durationSec", watchMaxDuration)
+	if err != nil {
+		writeInvalidParam(w, "durationSec", err.Error())
+		return
+	}
+	duration = cmp.Or(duration, watchDuration)
+	opts := cfg.checkOptions()
+	if ipniURL := r.URL.Query().Get("ipniIndexer"); ipniURL != "" {
+		opts.IPNIIndexer = ipniURL
+	} else {
+		opts.IPNIIndexer = d.routers.pick(cfg)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "streaming is not supported", nil)
+		return
+	}
+	// A watch runs lookups for minutes, so it takes a check slot
+	release, ok := d.acquireCheckSlot(w, r, cfg)
+	if !ok {
+		return
+	}
+	defer release()
+
+	log.Printf("Watching the provider records of %s every %s for %s\n", cidKey, interval, duration)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx, cancel := context.WithTimeout(r.Context(), duration)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	start := time.Now()
+	var ev watchEvent
+	for ctx.Err() == nil {
+		ev.Records = d.checker.LookupProviderRecords(ctx, cidKey, opts, min(interval, cfg.CheckTimeout))
+		if ctx.Err() != nil {
+			// The lookup was cut short by the end of the watch
+			break
+		}
+		ev.Elapsed = time.Since(start)
+		if ev.FirstFoundInDHT == nil && len(ev.Records.DHT) > 0 {
+			elapsed := ev.Elapsed
+			ev.FirstFoundInDHT = &elapsed
+		}
+		if ev.FirstFoundInIPNI == nil && len(ev.Records.IPNI) > 0 {
+			elapsed := ev.Elapsed
+			ev.FirstFoundInIPNI = &elapsed
+		}
+		if err := d.writeEvent(w, "records", ev); err != nil {
+			log.Printf("Error sending watch event: %v\n", err)
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	if r.Context().Err() == nil {
+		_, _ = fmt.Fprint(w, "event: done\ndata: {}\n\n")
+		flusher.Flush()
+	}
+}
+
+// writeEvent sends data as a server-sent event
+func (d *daemon) writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	if d.validateResponses {
+		if err := validateResponse(data); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
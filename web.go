@@ -0,0 +1,30 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+//go:embed web
+var webFS embed.FS
+
+// webHandler serves the web UI from dir, or from the copy embedded in the
+// binary when dir is empty. dir must contain an index.html.
+func webHandler(dir string) (http.Handler, error) {
+	var fsys fs.FS
+	if dir == "" {
+		var err error
+		if fsys, err = fs.Sub(webFS, "web"); err != nil {
+			return nil, err
+		}
+	} else {
+		fsys = os.DirFS(dir)
+		if _, err := fs.Stat(fsys, "index.html"); err != nil {
+			return nil, fmt.Errorf("web UI directory %s: %w", dir, err)
+		}
+	}
+	return http.FileServer(http.FS(fsys)), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebHandler(t *testing.T) {
+	get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// The embedded web UI is served by default
+	h, err := webHandler("")
+	require.NoError(t, err)
+	rec := get(h, "/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "<title>IPFS Check</title>")
+	require.Equal(t, http.StatusOK, get(h, "/tachyons.min.css").Code)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("custom UI"), 0o644))
+	h, err = webHandler(dir)
+	require.NoError(t, err)
+	rec = get(h, "/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "custom UI", rec.Body.String())
+	require.Equal(t, http.StatusNotFound, get(h, "/tachyons.min.css").Code)
+
+	_, err = webHandler(t.TempDir())
+	require.Error(t, err, "directories without an index.html are refused")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// webhookPayload is POSTed as JSON to the configured webhooks when the
+// availability of a monitored target changes.
+type webhookPayload struct {
+	CID               string
+	Multiaddr         string
+	Available         bool
+	PreviousAvailable bool
+	CheckedAt         time.Time
+	Error             string
+	// Text is a human readable summary. It uses a lowercase key so the
+	// payload can be sent as is to Slack (and compatible) incoming webhooks.
+	Text string `json:"text"`
+}
+
+func newWebhookPayload(cidStr, maStr string, available, previous bool, checkedAt time.Time, errStr string) webhookPayload {
+	target := cidStr
+	if maStr != "" {
+		target = fmt.Sprintf("%s on %s", cidStr, maStr)
+	}
+	state := "unavailable"
+	if available {
+		state = "available"
+	}
+
+	return webhookPayload{
+		CID:               cidStr,
+		Multiaddr:         maStr,
+		Available:         available,
+		PreviousAvailable: previous,
+		CheckedAt:         checkedAt,
+		Error:             errStr,
+		Text:              fmt.Sprintf("ipfs-check: %s is now %s", target, state),
+	}
+}
+
+// notifyWebhooks sends the payload to all urls concurrently with client,
+// logging failures
+func notifyWebhooks(ctx context.Context, client *http.Client, urls []string, payload webhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding webhook payload: %v\n", err)
+		return
+	}
+
+	for _, u := range urls {
+		go func(u string) {
+			if err := postWebhook(ctx, client, u, body); err != nil {
+				log.Printf("Error sending webhook to %s: %v\n", u, err)
+			}
+		}(u)
+	}
+}
+
+func postWebhook(ctx context.Context, client *http.Client, url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
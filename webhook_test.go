@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorWebhooks(t *testing.T) {
+	received := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer receiver.Close()
+	noNotification := func() {
+		select {
+		case body := <-received:
+			t.Fatalf("unexpected notification: %s", body)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := &daemon{promRegistry: prometheus.NewRegistry()}
+	m := newMonitor(d, time.Hour, 0, []string{receiver.URL})
+	m.ctx = ctx
+	// The check of an invalid CID fails right away, without a checker
+	const target = "not-a-cid"
+	m.targets[monitorKey(target, "")] = &monitorTarget{CID: target}
+
+	// The first check of a target is not a change
+	m.runOnce(ctx, target, "", defaultIndexerURL)
+	noNotification()
+
+	m.mu.Lock()
+	m.targets[monitorKey(target, "")].Available = true
+	m.mu.Unlock()
+	m.runOnce(ctx, target, "", defaultIndexerURL)
+	var body []byte
+	select {
+	case body = <-received:
+	case <-time.After(webhookTimeout):
+		t.Fatal("no notification of the availability change")
+	}
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(body, &payload))
+	require.Equal(t, target, payload["CID"])
+	require.Equal(t, false, payload["Available"])
+	require.Equal(t, true, payload["PreviousAvailable"])
+	require.NotEmpty(t, payload["Error"])
+	// Slack and compatible incoming webhooks show the text field
+	require.Equal(t, "ipfs-check: not-a-cid is now unavailable", payload["text"])
+
+	// Still unavailable, nothing changed
+	m.runOnce(ctx, target, "", defaultIndexerURL)
+	noNotification()
+}
+
+func TestMonitorWebhookURL(t *testing.T) {
+	d := &daemon{promRegistry: prometheus.NewRegistry()}
+	cfg := defaultConfig()
+	cfg.MonitorWebhookOrigins = []string{"https://hooks.example.com"}
+	d.cfg.Store(cfg)
+	m := newMonitor(d, time.Hour, 0, nil)
+
+	post := func(webhook string) int {
+		q := url.Values{"cid": {"bafkqaaa"}, "webhookURL": {webhook}}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/monitor?"+q.Encode(), nil))
+		return w.Code
+	}
+	require.Equal(t, http.StatusBadRequest, post("ftp://hooks.example.com/hook"))
+	require.Equal(t, http.StatusBadRequest, post("https://other.example.com/hook"), "not an allowed origin")
+	require.Equal(t, http.StatusBadRequest, post("http://127.0.0.1:8080/hook"), "not an allowed origin")
+	cfg.MonitorWebhookOrigins = nil
+	require.Equal(t, http.StatusBadRequest, post("https://hooks.example.com/hook"), "no webhookURL is allowed by default")
+
+	// The webhookURL of targets is not posted to on loopback addresses,
+	// whatever the origins allowed
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+	err := postWebhook(context.Background(), m.requestClient, receiver.URL, []byte("{}"))
+	require.ErrorContains(t, err, "address policy")
+	require.NoError(t, postWebhook(context.Background(), m.webhookClient, receiver.URL, []byte("{}")), "the webhooks of the config can be local")
+	require.NotZero(t, m.requestClient.Timeout)
+	require.NotZero(t, m.webhookClient.Timeout)
+}